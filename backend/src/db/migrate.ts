@@ -11,6 +11,24 @@ interface Migration {
     content: string;
 }
 
+// Header line of migrations that can't run in a transaction (CREATE INDEX CONCURRENTLY)
+const NO_TRANSACTION_MARKER = /^-- migrate: no-transaction\b/m;
+
+/**
+ * Statements of a migration, run one at a time outside a transaction
+ * (Postgres runs a multi-statement query as one implicit transaction).
+ * Comments are dropped; statements end with ";" at the end of a line.
+ */
+function splitStatements(content: string): string[] {
+    return content
+        .split('\n')
+        .filter((line) => !line.trimStart().startsWith('--'))
+        .join('\n')
+        .split(/;\s*$/m)
+        .map((statement) => statement.trim())
+        .filter((statement) => statement.length > 0);
+}
+
 async function getMigrationFiles(): Promise<Migration[]> {
     const files = readdirSync(MIGRATIONS_DIR)
         .filter((f) => f.endsWith('.sql'))
@@ -48,12 +66,21 @@ async function runMigrations(): Promise<void> {
 
         console.log(`📄 Applying ${migration.name}...`);
 
+        const record = `INSERT INTO _migrations (name) VALUES ('${migration.name.replace(/'/g, "''")}')`;
         try {
-            // Run migration in a transaction
-            await sql.begin(async (tx) => {
-                await tx.unsafe(migration.content);
-                await tx.unsafe(`INSERT INTO _migrations (name) VALUES ('${migration.name.replace(/'/g, "''")}')`);
-            });
+            if (NO_TRANSACTION_MARKER.test(migration.content)) {
+                // Statement by statement; they must be safe to run again if a later one fails
+                for (const statement of splitStatements(migration.content)) {
+                    await sql.unsafe(statement);
+                }
+                await sql.unsafe(record);
+            } else {
+                // Run migration in a transaction
+                await sql.begin(async (tx) => {
+                    await tx.unsafe(migration.content);
+                    await tx.unsafe(record);
+                });
+            }
 
             console.log(`✅ Applied ${migration.name}`);
             appliedCount++;
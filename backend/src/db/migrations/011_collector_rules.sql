@@ -0,0 +1,31 @@
+-- Migration: 011_collector_rules
+-- Description: Rule sets pushed to collectors over the control channel, with staged rollout
+
+CREATE TABLE IF NOT EXISTS collector_rule_sets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    rules JSONB NOT NULL, -- array of filter/redact/tag rules
+    tests JSONB NOT NULL DEFAULT '[]', -- test cases collectors run before activating
+    rollout_percent INTEGER NOT NULL DEFAULT 0 CHECK (rollout_percent BETWEEN 0 AND 100),
+    created_by UUID,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (tenant_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_collector_rule_sets_tenant_version ON collector_rule_sets(tenant_id, version DESC);
+
+-- Latest outcome reported by each collector for each version
+CREATE TABLE IF NOT EXISTS collector_rule_acks (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    collector_name TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL, -- applied, rejected, deferred, dry_run
+    error TEXT,
+    reported_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, collector_name, version)
+);
+
+COMMENT ON TABLE collector_rule_sets IS 'Versioned collector rule sets; the latest version per tenant is served to collectors';
+COMMENT ON COLUMN collector_rule_sets.rollout_percent IS 'Share of collectors (by stable name bucket) that should apply this version';
@@ -0,0 +1,22 @@
+-- Migration: 012_collector_enrollment
+-- Description: Single-use enrollment tokens exchanged by `collector init` for an API key
+
+CREATE TABLE IF NOT EXISTS collector_enrollment_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    site_id UUID REFERENCES sites(id) ON DELETE SET NULL,
+    token_hash TEXT NOT NULL,
+    name TEXT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    used_by TEXT, -- Collector name that enrolled with it
+    api_key_id UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+    created_by UUID,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_collector_enrollment_tokens_hash ON collector_enrollment_tokens(token_hash);
+CREATE INDEX IF NOT EXISTS idx_collector_enrollment_tokens_tenant ON collector_enrollment_tokens(tenant_id, created_at DESC);
+
+COMMENT ON TABLE collector_enrollment_tokens IS 'Short-lived tokens an installer pastes into `collector init`; each can enroll one collector';
+COMMENT ON COLUMN collector_enrollment_tokens.token_hash IS 'SHA-256 hash of the full token';
@@ -0,0 +1,10 @@
+-- Migration: 013_raw_events_event_id
+-- Description: Event ID assigned by the collector at receive time (UUIDv7), stored once per
+-- tenant: a batch retried or replayed from the collector's write-ahead log is not stored twice
+-- migrate: no-transaction (the index is built without locking raw_events against writes)
+
+ALTER TABLE raw_events ADD COLUMN IF NOT EXISTS event_id UUID;
+
+-- Per tenant, so one tenant's IDs can't suppress another's events.
+-- Events from older collectors have none (NULLs don't conflict)
+CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS idx_raw_events_tenant_event_id ON raw_events(tenant_id, event_id);
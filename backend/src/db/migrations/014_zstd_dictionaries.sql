@@ -0,0 +1,14 @@
+-- Migration: 014_zstd_dictionaries
+-- Description: zstd dictionaries collectors trained on a tenant's traffic, to decompress
+-- bulk requests that name them (X-Centinela-Zstd-Dictionary)
+
+CREATE TABLE IF NOT EXISTS zstd_dictionaries (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    dictionary_id BIGINT NOT NULL, -- ID in the dictionary header (unsigned 32-bit)
+    dictionary BYTEA NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    PRIMARY KEY (tenant_id, dictionary_id)
+);
+
+COMMENT ON TABLE zstd_dictionaries IS 'Uploaded by collectors (POST /v1/ingest/syslog/dictionaries) before they compress with them; they contain samples of tenant logs';
@@ -0,0 +1,7 @@
+-- Migration: 015_raw_events_syslog
+-- Description: Syslog header fields parsed by the collector (PARSE_SYSLOG): format, PRI,
+-- facility, severity, timestamp, hostname, app name, structured data...
+
+ALTER TABLE raw_events ADD COLUMN IF NOT EXISTS syslog JSONB;
+
+COMMENT ON COLUMN raw_events.syslog IS 'Parsed header as sent by the collector ({"format": "rfc5424" | "rfc3164", ...}); NULL when not parsed';
@@ -0,0 +1,11 @@
+-- Migration: 016_raw_events_origin
+-- Description: Where an event came from as the collector saw it: the sender's port, the
+-- transport (udp, tcp, file, journald, http-push, ...) and the relay chain in concentrator mode
+
+ALTER TABLE raw_events ADD COLUMN IF NOT EXISTS source_port INTEGER;
+ALTER TABLE raw_events ADD COLUMN IF NOT EXISTS relay_hops JSONB;
+
+-- Collector inputs have longer names than udp/tcp
+ALTER TABLE raw_events ALTER COLUMN transport TYPE VARCHAR(32);
+
+COMMENT ON COLUMN raw_events.relay_hops IS 'Collectors that relayed the event, first hop first: [{"collector", "received_at", "peer_ip"}]';
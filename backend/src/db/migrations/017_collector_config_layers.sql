@@ -0,0 +1,38 @@
+-- Migration: 017_collector_config_layers
+-- Description: Fleet groups for collectors and backend-managed configuration layers
+-- (global, group, collector) served over the control channel, with the outcome each collector reports
+
+-- Group a collector enrolled into: the token's own, or the one `collector init --group` asked for
+ALTER TABLE collector_enrollment_tokens ADD COLUMN IF NOT EXISTS group_name TEXT;
+ALTER TABLE collector_enrollment_tokens ADD COLUMN IF NOT EXISTS used_group TEXT;
+
+CREATE TABLE IF NOT EXISTS collector_config_layers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    layer VARCHAR(20) NOT NULL CHECK (layer IN ('global', 'group', 'collector')),
+    scope TEXT NOT NULL DEFAULT '', -- Group name or collector name; '' for global
+    version INTEGER NOT NULL,
+    settings JSONB NOT NULL, -- {"BATCH_SIZE": 500, ...}: same keys as the collector's environment
+    created_by UUID,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (tenant_id, layer, scope, version),
+    CHECK ((layer = 'global') = (scope = ''))
+);
+
+CREATE INDEX IF NOT EXISTS idx_collector_config_layers_latest ON collector_config_layers(tenant_id, layer, scope, version DESC);
+
+-- Latest outcome reported by each collector for each combination of layer versions
+CREATE TABLE IF NOT EXISTS collector_config_acks (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    collector_name TEXT NOT NULL,
+    received TEXT NOT NULL, -- Versions received, e.g. "global=3,group=7" ('' = no layers)
+    group_name TEXT,
+    versions JSONB NOT NULL DEFAULT '{}', -- Versions in effect after this outcome
+    status VARCHAR(20) NOT NULL, -- applied, rejected
+    error TEXT,
+    reported_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, collector_name, received)
+);
+
+COMMENT ON TABLE collector_config_layers IS 'Versioned collector settings; the latest version of each layer that applies is served to a collector';
+COMMENT ON COLUMN collector_enrollment_tokens.group_name IS 'Fleet group collectors enrolled with this token join (COLLECTOR_GROUP)';
@@ -0,0 +1,23 @@
+-- Migration: 018_collector_support_bundles
+-- Description: Support bundles requested from a collector over the control channel and the
+-- encrypted bundle it uploads (POST /v1/collector/support-bundles/:id)
+
+CREATE TABLE IF NOT EXISTS collector_support_bundles (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    collector_name TEXT NOT NULL,
+    public_key TEXT, -- PEM the bundle is encrypted for; NULL = the collector's SUPPORT_BUNDLE_PUBLIC_KEY
+    cpu_seconds INTEGER CHECK (cpu_seconds BETWEEN 0 AND 60),
+    heap BOOLEAN NOT NULL DEFAULT false,
+    bundle BYTEA, -- Encrypted .tar.gz, as uploaded
+    size_bytes INTEGER,
+    requested_by UUID,
+    requested_at TIMESTAMPTZ DEFAULT NOW(),
+    uploaded_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_collector_support_bundles_pending ON collector_support_bundles(tenant_id, collector_name, requested_at)
+    WHERE uploaded_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_collector_support_bundles_tenant ON collector_support_bundles(tenant_id, requested_at DESC);
+
+COMMENT ON TABLE collector_support_bundles IS 'Diagnostics bundles: logs, metrics, configuration (secrets fingerprinted) and profiles, encrypted by the collector';
@@ -0,0 +1,10 @@
+-- Migration: 019_raw_events_quarantined
+-- Description: Events from senders the collector hasn't approved yet (greylist mode), kept for
+-- review but left out of normalization and detection until released (POST /v1/sources/quarantined/release)
+
+ALTER TABLE raw_events ADD COLUMN IF NOT EXISTS quarantined BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_raw_events_quarantined
+    ON raw_events(tenant_id, received_at DESC) WHERE quarantined = TRUE;
+
+COMMENT ON COLUMN raw_events.quarantined IS 'Sent by a source not yet approved on the collector (greylist); not normalized until released';
@@ -0,0 +1,10 @@
+-- Migration: 020_raw_events_stream
+-- Description: Chunks of raw TCP streams the collector forwards unframed (RAW_TCP_*): which
+-- stream a row belongs to and where, so a stream can be reassembled by ordering its chunks on offset
+
+ALTER TABLE raw_events ADD COLUMN IF NOT EXISTS stream JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_raw_events_stream
+    ON raw_events(tenant_id, (stream->>'id'), ((stream->>'offset')::BIGINT)) WHERE stream IS NOT NULL;
+
+COMMENT ON COLUMN raw_events.stream IS 'Raw stream chunk: {"id", "offset", "length", "encoding": "utf8" | "base64", "final"}; NULL for messages';
@@ -0,0 +1,10 @@
+-- Migration: 021_raw_events_meta
+-- Description: Meta-events the collector generates itself (TCP session connected/disconnected,
+-- with duration and byte, message and keepalive counts) stored with what they describe
+
+ALTER TABLE raw_events ADD COLUMN IF NOT EXISTS meta JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_raw_events_meta_type
+    ON raw_events(tenant_id, (meta->>'type'), received_at DESC) WHERE meta IS NOT NULL;
+
+COMMENT ON COLUMN raw_events.meta IS 'Collector meta-event: {"type": "tcp_session", "action": "connected" | "disconnected", ...}; NULL for device messages';
@@ -0,0 +1,9 @@
+-- Migration: 022_raw_events_tags
+-- Description: Labels added to an event by collector tag rules (control channel rule sets),
+-- searchable by key and value
+
+ALTER TABLE raw_events ADD COLUMN IF NOT EXISTS tags JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_raw_events_tags ON raw_events USING GIN (tags jsonb_path_ops) WHERE tags IS NOT NULL;
+
+COMMENT ON COLUMN raw_events.tags IS 'Labels from collector tag rules: {"key": "value"}; NULL when no rule tagged the event';
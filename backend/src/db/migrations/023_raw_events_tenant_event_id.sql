@@ -0,0 +1,10 @@
+-- Migration: 023_raw_events_tenant_event_id
+-- Description: Databases that applied 013 before it indexed (tenant_id, event_id): build the
+-- per-tenant unique index and drop the global one. Run before deploying the ingest worker that
+-- inserts with ON CONFLICT (tenant_id, event_id). If the build fails it leaves an INVALID index:
+-- DROP INDEX CONCURRENTLY idx_raw_events_tenant_event_id, then run the migration again.
+-- migrate: no-transaction
+
+CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS idx_raw_events_tenant_event_id ON raw_events(tenant_id, event_id);
+
+DROP INDEX CONCURRENTLY IF EXISTS idx_raw_events_event_id;
@@ -1,6 +1,6 @@
 import 'dotenv/config';
 
-import Fastify from 'fastify';
+import Fastify, { type FastifyRequest } from 'fastify';
 import cors from '@fastify/cors';
 import helmet from '@fastify/helmet';
 import rateLimit from '@fastify/rate-limit';
@@ -12,10 +12,15 @@ import { randomUUID } from 'node:crypto';
 import { testConnection, closeDatabase } from './db/index.js';
 import { dashboardRoutes } from './routes/dashboard.js';
 import { sourcesRoutes } from './routes/sources.js';
+import { collectorRulesRoutes } from './routes/collector-rules.js';
+import { collectorEnrollmentRoutes } from './routes/collector-enrollment.js';
+import { collectorConfigRoutes } from './routes/collector-config.js';
+import { collectorSupportBundleRoutes } from './routes/collector-support-bundles.js';
 import authPlugin from './plugins/auth.js';
 import tenantRateLimitPlugin from './plugins/rate-limit-tenant.js';
 import { ingestQueue } from './lib/queue.js';
 import { redis } from './lib/redis.js';
+import { DICTIONARY_MAX_BYTES, decodeBody, dictionaryHeader, dictionaryId, storeDictionary, zstdDictionariesSupported } from './services/compression.js';
 
 type Env = {
   NODE_ENV: string;
@@ -37,27 +42,146 @@ function getEnv(): Env {
   return parsed.data;
 }
 
+// Header fields the collector parsed from an RFC 5424 message (PARSE_SYSLOG)
+const Rfc5424SyslogSchema = z.object({
+  format: z.literal('rfc5424'),
+  pri: z.number().int().min(0).max(191),
+  facility: z.number().int().min(0).max(23),
+  severity: z.number().int().min(0).max(7),
+  version: z.number().int().positive(),
+  timestamp: z.string().datetime({ offset: true }).optional(),
+  hostname: z.string().max(255).optional(),
+  app_name: z.string().max(48).optional(),
+  procid: z.string().max(128).optional(),
+  msgid: z.string().max(32).optional(),
+  structured_data: z.record(z.record(z.string())).optional(), // SD-ID -> PARAM-NAME -> PARAM-VALUE
+  message: z.string().optional(),
+});
+
+// Header fields the collector parsed from an RFC 3164 (BSD) message; the
+// timestamp is resolved to UTC with its SYSLOG_DEFAULT_TIMEZONE and year rules
+const Rfc3164SyslogSchema = z.object({
+  format: z.literal('rfc3164'),
+  pri: z.number().int().min(0).max(191),
+  facility: z.number().int().min(0).max(23),
+  severity: z.number().int().min(0).max(7),
+  timestamp: z.string().datetime({ offset: true }).optional(),
+  raw_timestamp: z.string().max(64).optional(), // As sent
+  hostname: z.string().max(255).optional(),
+  tag: z.string().max(48).optional(),
+  procid: z.string().max(128).optional(),
+  message: z.string().optional(),
+});
+
 const SyslogIngestBodySchema = z.object({
   // Tenant ID is inferred from API Key
+  event_id: z.string().uuid().optional(), // Assigned by the collector at receive time
   site_id: z.string().min(1).optional(),
   source_id: z.string().min(1).optional(),
   received_at: z.string().datetime().optional(),
   source_ip: z.string().min(1).optional(),
+  source_port: z.number().int().min(0).max(65535).optional(),
+  transport: z.string().min(1).max(32).optional(), // udp, tcp, file, journald, ... (the original one for relayed events)
   raw_message: z.string().min(1),
   collector_name: z.string().min(1).optional(),
+  // Collectors that relayed the event (concentrator mode), first hop first
+  relay_hops: z.array(z.object({
+    collector: z.string().min(1),
+    received_at: z.string().datetime({ offset: true }),
+    peer_ip: z.string().min(1),
+  })).max(32).optional(),
+  // Parsed syslog header, stored alongside the raw message
+  syslog: z.discriminatedUnion('format', [Rfc5424SyslogSchema, Rfc3164SyslogSchema]).optional(),
+  // Chunk of a raw TCP stream; reassemble by ordering chunks of stream.id on offset
+  stream: z.object({
+    id: z.string().uuid(),
+    offset: z.number().int().nonnegative(),
+    length: z.number().int().nonnegative(),
+    encoding: z.enum(['utf8', 'base64']),
+    final: z.boolean(),
+  }).optional(),
+  // Part of a message split by the collector (longer than MAX_MESSAGE_BYTES);
+  // the parts sharing continuation.id are stored as one message once all arrived
+  continuation: z.object({
+    id: z.string().uuid(),
+    index: z.number().int().nonnegative(),
+    total: z.number().int().min(2).max(1024),
+    truncated: z.boolean().optional(),
+  }).refine((c) => c.index < c.total, 'index must be below total').optional(),
+  // Sender not yet approved on the collector (greylist mode)
+  quarantined: z.boolean().optional(),
+  // Labels added by collector tag rules
+  tags: z.record(z.string()).optional(),
+  // Collector-generated meta-event (e.g. TCP session connected/disconnected)
+  meta: z.object({
+    type: z.literal('tcp_session'),
+    action: z.enum(['connected', 'disconnected']),
+    connected_at: z.string().datetime(),
+    reason: z.enum(['peer_closed', 'idle_timeout', 'error', 'shutdown']).optional(),
+    duration_ms: z.number().int().nonnegative().optional(),
+    bytes: z.number().int().nonnegative().optional(),
+    messages: z.number().int().nonnegative().optional(),
+    keepalives: z.number().int().nonnegative().optional(),
+  }).optional(),
 });
 
-// Bulk ingest: array of events (max 100 per request)
+// Bulk ingest: array of events (max 100 per request).
+// Events are validated one by one so a bad event doesn't fail the whole batch.
 const BulkSyslogIngestBodySchema = z.object({
-  events: z.array(SyslogIngestBodySchema).min(1).max(100),
+  events: z.array(z.unknown()).min(1).max(100),
 });
 
+// Per-event outcome in a bulk response; events not listed were accepted
+type BulkRejection = {
+  index: number;
+  event_id?: string;
+  reason: string;
+  retryable: boolean;
+};
+
+// A bulk body carries up to 100 events of up to the collector's MAX_MESSAGE_BYTES (64 KiB by default)
+const BULK_BODY_LIMIT = 8 * 1024 * 1024;
+
+/**
+ * NDJSON bulk body (collector BATCH_FORMAT=ndjson): one event per line, read
+ * as {"events": [...]}. A line that isn't JSON becomes null, so only that
+ * event is rejected.
+ */
+function parseNdjsonEvents(body: string): { events: unknown[] } {
+  const events = body.split('\n').filter((line) => line.trim().length > 0).map((line) => {
+    try {
+      return JSON.parse(line) as unknown;
+    } catch {
+      return null;
+    }
+  });
+  return { events };
+}
+
 type _SyslogIngestBody = z.infer<typeof SyslogIngestBodySchema>;
 type _BulkSyslogIngestBody = z.infer<typeof BulkSyslogIngestBodySchema>;
 
+// Identification headers sent by collectors (X-Centinela-*), for request logs
+function collectorIdentity(req: FastifyRequest) {
+  const header = (name: string) => {
+    const value = req.headers[name];
+    return typeof value === 'string' ? value : undefined;
+  };
+  return {
+    collector_id: header('x-centinela-collector-id'),
+    collector_version: header('x-centinela-collector-version'),
+    collector_labels: header('x-centinela-labels'),
+  };
+}
+
 async function main() {
   const env = getEnv();
 
+  // Bulk requests may be compressed with the tenant's zstd dictionary
+  if (!zstdDictionariesSupported()) {
+    throw new Error(`Node.js 22.19 / 24.6 or later is required for zstd dictionaries (running ${process.version})`);
+  }
+
   const app = Fastify({
     logger: env.NODE_ENV === 'development'
       ? {
@@ -81,6 +205,15 @@ async function main() {
 
   await app.register(sensible);
 
+  app.addContentTypeParser('application/x-ndjson', { parseAs: 'string', bodyLimit: BULK_BODY_LIMIT }, (_req, body, done) => {
+    done(null, parseNdjsonEvents(body as string));
+  });
+
+  // zstd dictionary and support bundle uploads (see services/compression.ts, routes/collector-support-bundles.ts)
+  app.addContentTypeParser('application/octet-stream', { parseAs: 'buffer', bodyLimit: DICTIONARY_MAX_BYTES }, (_req, body, done) => {
+    done(null, body);
+  });
+
   await app.register(rateLimit, {
     max: 1000,
     timeWindow: '1 minute',
@@ -126,12 +259,17 @@ async function main() {
       },
       defaultTier: process.env['RATE_LIMIT_DEFAULT_TIER'] || 'basic',
     },
+    collectorShare: parseFloat(process.env['RATE_LIMIT_COLLECTOR_SHARE'] || '0'),
     skipRoutes: ['/healthz', '/readyz', '/docs'],
   });
 
   // Register Routes
   await app.register(dashboardRoutes);
   await app.register(sourcesRoutes);
+  await app.register(collectorRulesRoutes);
+  await app.register(collectorEnrollmentRoutes);
+  await app.register(collectorConfigRoutes);
+  await app.register(collectorSupportBundleRoutes);
 
   app.get('/healthz', async () => {
     return { ok: true, service: 'centinela-backend', ts: new Date().toISOString() };
@@ -185,7 +323,7 @@ async function main() {
       received_at: body.received_at || new Date().toISOString(),
     });
 
-    req.log.debug({ job_id: job.id, tenant_id: tenantId }, 'Syslog event enqueued');
+    req.log.debug({ job_id: job.id, tenant_id: tenantId, ...collectorIdentity(req) }, 'Syslog event enqueued');
 
     return reply.code(202).send({
       ok: true,
@@ -196,10 +334,20 @@ async function main() {
 
   /**
    * Bulk Ingest Endpoint (for Smart Collector optimization)
-   * Accepts up to 100 events per request
+   * Accepts up to 100 events per request, as {"events": [...]} (application/json)
+   * or one event per line (application/x-ndjson), optionally compressed
+   * (Content-Encoding gzip or zstd, see services/compression.ts; the API key is
+   * checked first, since a dictionary belongs to the tenant).
+   * Invalid events are listed in `rejected` (index + reason) and the rest are
+   * accepted; `retryable` marks rejections the collector should retry.
+   * With `X-Centinela-Dry-Run: true` (collector validate --dry-post) the
+   * request is authenticated and validated but nothing is enqueued.
    */
   app.post('/v1/ingest/syslog/bulk', {
-    preHandler: [app.verifyApiKey, app.tenantRateLimit],
+    onRequest: app.verifyApiKey,
+    preParsing: async (req, _reply, payload) => decodeBody(req.tenantId ?? '', req.headers, payload),
+    preHandler: app.tenantRateLimit,
+    bodyLimit: BULK_BODY_LIMIT,
     schema: {
       security: [{ bearerAuth: [] }],
       description: 'Bulk syslog ingestion - accepts up to 100 events per request',
@@ -210,6 +358,18 @@ async function main() {
             ok: { type: 'boolean' },
             accepted: { type: 'number' },
             job_ids: { type: 'array', items: { type: 'string' } },
+            rejected: {
+              type: 'array',
+              items: {
+                type: 'object',
+                properties: {
+                  index: { type: 'number' },
+                  event_id: { type: 'string' },
+                  reason: { type: 'string' },
+                  retryable: { type: 'boolean' },
+                },
+              },
+            },
           }
         },
       },
@@ -227,12 +387,35 @@ async function main() {
       return reply.badRequest(JSON.stringify(result.error.format()));
     }
 
-    const { events } = result.data;
     const now = new Date().toISOString();
+    const rejected: BulkRejection[] = [];
+    const valid: Array<{ index: number; event: z.infer<typeof SyslogIngestBodySchema> }> = [];
+
+    result.data.events.forEach((input, index) => {
+      const parsed = SyslogIngestBodySchema.safeParse(input);
+      if (parsed.success) {
+        valid.push({ index, event: parsed.data });
+        return;
+      }
 
-    // Enqueue all events in parallel
-    const jobs = await Promise.all(
-      events.map(event =>
+      const issue = parsed.error.issues[0];
+      const eventId = (input as { event_id?: unknown } | null)?.event_id;
+      rejected.push({
+        index,
+        event_id: typeof eventId === 'string' ? eventId : undefined,
+        reason: `${issue?.path.join('.') || 'event'}: ${issue?.message ?? 'invalid'}`,
+        retryable: false,
+      });
+    });
+
+    if (req.headers['x-centinela-dry-run'] === 'true') {
+      req.log.info({ count: result.data.events.length, rejected: rejected.length, tenant_id: tenantId, ...collectorIdentity(req) }, 'Bulk syslog dry run');
+      return reply.code(202).send({ ok: true, accepted: valid.length, job_ids: [], rejected });
+    }
+
+    // Enqueue valid events in parallel
+    const jobs = await Promise.allSettled(
+      valid.map(({ event }) =>
         ingestQueue.add('syslog-event', {
           tenant_id: tenantId,
           ...event,
@@ -241,25 +424,95 @@ async function main() {
       )
     );
 
-    const jobIds = jobs.map(j => j.id).filter((id): id is string => id !== undefined);
+    const jobIds: string[] = [];
+    let accepted = 0;
+    jobs.forEach((job, i) => {
+      const { index, event } = valid[i]!;
+      if (job.status === 'fulfilled') {
+        accepted++;
+        if (job.value.id !== undefined) jobIds.push(job.value.id);
+      } else {
+        rejected.push({ index, event_id: event.event_id, reason: 'enqueue failed', retryable: true });
+      }
+    });
+    rejected.sort((a, b) => a.index - b.index);
 
     req.log.info(
-      { count: events.length, tenant_id: tenantId },
+      {
+        count: result.data.events.length,
+        accepted,
+        rejected: rejected.length,
+        tenant_id: tenantId,
+        ...collectorIdentity(req),
+      },
       'Bulk syslog events enqueued'
     );
 
     return reply.code(202).send({
       ok: true,
-      accepted: events.length,
+      accepted,
       job_ids: jobIds,
+      rejected,
     });
   });
 
+  /**
+   * zstd Dictionary Upload
+   * A dictionary a collector trained on the tenant's traffic, as
+   * application/octet-stream with X-Centinela-Zstd-Dictionary: <id> (the ID in
+   * its header). Bulk requests may name it once this answered 201.
+   */
+  app.post('/v1/ingest/syslog/dictionaries', {
+    preHandler: app.verifyApiKey,
+    bodyLimit: DICTIONARY_MAX_BYTES,
+    schema: {
+      security: [{ bearerAuth: [] }],
+      description: 'Store a zstd dictionary for compressed bulk requests',
+      response: {
+        201: {
+          type: 'object',
+          properties: {
+            ok: { type: 'boolean' },
+            dictionary_id: { type: 'number' },
+          },
+        },
+      },
+    },
+  }, async (req, reply) => {
+    const tenantId = req.tenantId;
+
+    if (!tenantId) {
+      return reply.unauthorized('Tenant context missing');
+    }
+
+    const id = dictionaryHeader(req.headers);
+    if (!Buffer.isBuffer(req.body)) {
+      return reply.unsupportedMediaType('Expected application/octet-stream');
+    }
+    if (id === null || dictionaryId(req.body) !== id) {
+      return reply.badRequest('Body must be a zstd dictionary whose ID matches X-Centinela-Zstd-Dictionary');
+    }
+
+    await storeDictionary(tenantId, id, req.body);
+    req.log.info({ dictionary_id: id, bytes: req.body.length, tenant_id: tenantId, ...collectorIdentity(req) }, 'zstd dictionary stored');
+
+    return reply.code(201).send({ ok: true, dictionary_id: id });
+  });
+
   // Global Error Handler
   app.setErrorHandler(async (err, req, reply) => {
-    req.log.error({ err }, 'request error');
     const message = err instanceof Error ? err.message : 'unknown error';
 
+    // Client errors raised before the handler (body too large, unparsable body)
+    // keep their status, so collectors can tell them from outages
+    const statusCode = (err as { statusCode?: number }).statusCode;
+    if (statusCode !== undefined && statusCode >= 400 && statusCode < 500) {
+      req.log.warn({ err }, 'request refused');
+      return reply.code(statusCode).send({ ok: false, error: (err as { code?: string }).code ?? 'bad_request', message });
+    }
+
+    req.log.error({ err }, 'request error');
+
     if (env.NODE_ENV === 'development') {
       return reply.code(500).send({
         ok: false,
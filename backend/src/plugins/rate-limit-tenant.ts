@@ -33,6 +33,8 @@ export interface TenantRateLimitOptions {
     keyPrefix?: string;
     skipRoutes?: string[];
     getTenantTier?: (tenantId: string) => Promise<string>;
+    // Share of the tenant's limit a single collector (X-Centinela-Collector-Id) may use; 0 = no per-collector limit
+    collectorShare?: number;
 }
 
 // Extend FastifyInstance with our decorator
@@ -50,6 +52,7 @@ const tenantRateLimitPlugin: FastifyPluginAsync<TenantRateLimitOptions> = async
         defaultTier: opts.config?.defaultTier || DEFAULT_CONFIG.defaultTier,
     };
     const skipRoutes = new Set(opts.skipRoutes || []);
+    const collectorShare = opts.collectorShare ?? 0;
 
     /**
      * Get tenant tier from database or cache
@@ -66,13 +69,12 @@ const tenantRateLimitPlugin: FastifyPluginAsync<TenantRateLimitOptions> = async
      * Sliding Window Rate Limiter using Redis
      * Uses sorted sets for an accurate sliding window approach
      */
-    async function checkRateLimit(tenantId: string, tierConfig: RateLimitTierConfig): Promise<{
+    async function checkRateLimit(key: string, tierConfig: RateLimitTierConfig): Promise<{
         allowed: boolean;
         remaining: number;
         resetAt: number;
         limit: number;
     }> {
-        const key = `${keyPrefix}${tenantId}`;
         const now = Date.now();
         const windowStart = now - (tierConfig.windowSeconds * 1000);
 
@@ -95,7 +97,7 @@ const tenantRateLimitPlugin: FastifyPluginAsync<TenantRateLimitOptions> = async
 
         if (!results) {
             // Redis error - fail open (allow request)
-            fastify.log.warn({ tenantId }, 'Rate limit Redis error - failing open');
+            fastify.log.warn({ key }, 'Rate limit Redis error - failing open');
             return {
                 allowed: true,
                 remaining: tierConfig.maxRequests,
@@ -140,7 +142,19 @@ const tenantRateLimitPlugin: FastifyPluginAsync<TenantRateLimitOptions> = async
             const tier = await getTenantTier(tenantId);
             const tierConfig = config.tiers[tier] || config.tiers[config.defaultTier]!;
 
-            const result = await checkRateLimit(tenantId, tierConfig);
+            let result = await checkRateLimit(`${keyPrefix}${tenantId}`, tierConfig);
+
+            // Keep one misbehaving collector from exhausting the whole tenant budget
+            const collectorId = request.headers['x-centinela-collector-id'];
+            if (result.allowed && collectorShare > 0 && typeof collectorId === 'string') {
+                const collectorResult = await checkRateLimit(`${keyPrefix}${tenantId}:collector:${collectorId}`, {
+                    maxRequests: Math.max(1, Math.floor(tierConfig.maxRequests * collectorShare)),
+                    windowSeconds: tierConfig.windowSeconds,
+                });
+                if (!collectorResult.allowed || collectorResult.remaining < result.remaining) {
+                    result = collectorResult;
+                }
+            }
 
             // Add rate limit headers to response
             reply.header('X-RateLimit-Limit', result.limit.toString());
@@ -153,7 +167,7 @@ const tenantRateLimitPlugin: FastifyPluginAsync<TenantRateLimitOptions> = async
                 reply.header('Retry-After', retryAfter.toString());
 
                 request.log.warn(
-                    { tenantId, tier, limit: result.limit },
+                    { tenantId, tier, limit: result.limit, collectorId },
                     'Rate limit exceeded'
                 );
 
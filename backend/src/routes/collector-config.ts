@@ -0,0 +1,182 @@
+import type { FastifyPluginAsync, FastifyRequest } from 'fastify';
+import { z } from 'zod';
+import { sql } from '../db/index.js';
+
+const CONFIG_LAYERS = ['global', 'group', 'collector'] as const;
+
+type ConfigLayerName = (typeof CONFIG_LAYERS)[number];
+
+export interface ConfigLayer {
+    layer: ConfigLayerName;
+    version: string;
+    settings: Record<string, unknown>;
+}
+
+// Same as the collector's COLLECTOR_GROUP
+const GroupSchema = z.string().regex(/^[\w.-]{1,64}$/);
+
+// Keys as in the collector's environment; the collector rejects those it doesn't know or won't take from the backend
+const PublishLayerSchema = z.object({
+    scope: z.string().min(1).max(200).optional(), // Group or collector name (not for global)
+    settings: z.record(
+        z.string().regex(/^[A-Z][A-Z0-9_]*$/),
+        z.union([z.string().max(10000), z.number(), z.boolean(), z.array(z.string().max(1000)).max(1000)]),
+    ).refine((settings) => Object.keys(settings).length <= 500, 'At most 500 settings'),
+});
+
+const ConfigAckSchema = z.object({
+    collector_name: z.string().min(1),
+    group: GroupSchema.nullable().optional(),
+    versions: z.record(z.enum(CONFIG_LAYERS), z.string()).default({}),
+    received: z.string().max(200),
+    status: z.enum(['applied', 'rejected']),
+    error: z.string().max(2000).optional(),
+});
+
+function header(req: FastifyRequest, name: string): string | undefined {
+    const value = req.headers[name];
+    if (typeof value !== 'string') return undefined;
+    try {
+        return decodeURIComponent(value); // Collectors percent-encode non-ASCII values
+    } catch {
+        return value;
+    }
+}
+
+/**
+ * Latest version of each layer that applies to a collector: global, its
+ * group (X-Centinela-Collector-Group) and its own (X-Centinela-Collector-Name)
+ */
+export async function configLayersFor(req: FastifyRequest, tenantId: string): Promise<ConfigLayer[]> {
+    const group = GroupSchema.safeParse(header(req, 'x-centinela-collector-group'));
+    const collectorName = header(req, 'x-centinela-collector-name');
+
+    const rows = await sql`
+    SELECT DISTINCT ON (layer) layer, version, settings
+    FROM collector_config_layers
+    WHERE tenant_id = ${tenantId}
+      AND (
+        layer = 'global'
+        OR (layer = 'group' AND scope = ${group.success ? group.data : null})
+        OR (layer = 'collector' AND scope = ${collectorName ?? null})
+      )
+    ORDER BY layer, version DESC
+  `;
+
+    return CONFIG_LAYERS.flatMap((name) => rows
+        .filter((row) => row.layer === name)
+        .map((row) => ({ layer: name, version: String(row.version), settings: row.settings as Record<string, unknown> })));
+}
+
+/**
+ * Collector Configuration (control channel)
+ *
+ * Tenants publish versioned settings for all their collectors (global), a
+ * fleet group (the collector's COLLECTOR_GROUP, chosen at enrollment) or a
+ * single collector. Collectors receive the layers that apply to them with
+ * the rule set (GET /v1/collector/rules, "config_layers"), check them
+ * against their local configuration and report whether they applied or
+ * rejected them.
+ */
+export const collectorConfigRoutes: FastifyPluginAsync = async (fastify) => {
+
+    // --- Collector side (API key) ---
+
+    // Outcome reported by a collector
+    fastify.post('/v1/collector/config/ack', {
+        preHandler: fastify.verifyApiKey,
+    }, async (req, reply) => {
+        const tenantId = req.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const result = ConfigAckSchema.safeParse(req.body);
+        if (!result.success) {
+            return reply.code(400).send({ error: 'Invalid input', details: result.error });
+        }
+
+        const { collector_name, group, versions, received, status, error } = result.data;
+        await sql`
+      INSERT INTO collector_config_acks (tenant_id, collector_name, received, group_name, versions, status, error)
+      VALUES (${tenantId}, ${collector_name}, ${received}, ${group ?? null}, ${JSON.stringify(versions)}, ${status}, ${error ?? null})
+      ON CONFLICT (tenant_id, collector_name, received)
+      DO UPDATE SET group_name = EXCLUDED.group_name, versions = EXCLUDED.versions, status = EXCLUDED.status,
+        error = EXCLUDED.error, reported_at = NOW()
+    `;
+
+        return { ok: true };
+    });
+
+    // --- Management side (user auth) ---
+
+    // Publish a new version of a layer: PUT /v1/collector-config/group with {"scope": "branch-offices-es", "settings": {...}}
+    fastify.put('/v1/collector-config/:layer', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const layer = z.enum(CONFIG_LAYERS).safeParse((req.params as { layer: string }).layer);
+        const result = PublishLayerSchema.safeParse(req.body);
+        if (!layer.success || !result.success) {
+            return reply.code(400).send({ error: 'Invalid input', details: result.error });
+        }
+
+        const { scope, settings } = result.data;
+        if ((layer.data === 'global') !== (scope === undefined)) {
+            return reply.code(400).send({ error: layer.data === 'global' ? 'The global layer has no scope' : 'scope is required' });
+        }
+        if (layer.data === 'group' && !GroupSchema.safeParse(scope).success) {
+            return reply.code(400).send({ error: 'Invalid group (letters, digits, _, . or -)' });
+        }
+
+        const rows = await sql`
+      INSERT INTO collector_config_layers (tenant_id, layer, scope, version, settings, created_by)
+      SELECT
+        ${tenantId},
+        ${layer.data},
+        ${scope ?? ''},
+        COALESCE(MAX(version), 0) + 1,
+        ${JSON.stringify(settings)},
+        ${req.user?.id ?? null}
+      FROM collector_config_layers
+      WHERE tenant_id = ${tenantId} AND layer = ${layer.data} AND scope = ${scope ?? ''}
+      RETURNING layer, scope, version, created_at
+    `;
+
+        return reply.code(201).send({ data: rows[0] });
+    });
+
+    // Latest version of every layer
+    fastify.get('/v1/collector-config', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const layers = await sql`
+      SELECT DISTINCT ON (layer, scope) layer, scope, version, settings, created_at
+      FROM collector_config_layers
+      WHERE tenant_id = ${tenantId}
+      ORDER BY layer, scope, version DESC
+    `;
+
+        return { data: layers };
+    });
+
+    // What each collector last reported
+    fastify.get('/v1/collector-config/acks', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const acks = await sql`
+      SELECT DISTINCT ON (collector_name) collector_name, group_name, received, versions, status, error, reported_at
+      FROM collector_config_acks
+      WHERE tenant_id = ${tenantId}
+      ORDER BY collector_name, reported_at DESC
+    `;
+
+        return { data: acks };
+    });
+};
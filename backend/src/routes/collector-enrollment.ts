@@ -0,0 +1,135 @@
+import type { FastifyPluginAsync } from 'fastify';
+import { z } from 'zod';
+import { createHash, randomBytes } from 'node:crypto';
+import { sql } from '../db/index.js';
+
+const CreateEnrollmentTokenSchema = z.object({
+    name: z.string().min(1).max(100).optional(), // Shown in the token list, e.g. "Madrid branch"
+    site_id: z.string().uuid().optional(),
+    group: z.string().regex(/^[\w.-]{1,64}$/).optional(), // Fleet group the collector joins (COLLECTOR_GROUP)
+    ttl_hours: z.number().int().min(1).max(168).default(24),
+});
+
+const EnrollSchema = z.object({
+    token: z.string().min(1),
+    collector_name: z.string().min(1).max(200),
+    collector_version: z.string().max(50).optional(),
+    group: z.string().regex(/^[\w.-]{1,64}$/).optional(), // `collector init --group`; overrides the token's
+});
+
+function sha256(value: string): string {
+    return createHash('sha256').update(value).digest('hex');
+}
+
+/**
+ * Collector Enrollment
+ *
+ * An admin creates a short-lived, single-use enrollment token; the installer
+ * passes it to `collector init`, which exchanges it here for the collector's
+ * own API key. The API key never has to be copied around by hand. A token
+ * can put the collector in a fleet group, whose configuration layer then
+ * applies to it (see collector-config.ts).
+ */
+export const collectorEnrollmentRoutes: FastifyPluginAsync = async (fastify) => {
+
+    // --- Collector side (enrollment token) ---
+
+    // Exchange an enrollment token for an API key (once)
+    fastify.post('/v1/collector/enroll', async (req, reply) => {
+        const result = EnrollSchema.safeParse(req.body);
+        if (!result.success) {
+            return reply.code(400).send({ error: 'Invalid input', details: result.error });
+        }
+
+        const { token, collector_name, group } = result.data;
+
+        const enrolled = await sql.begin(async (tx) => {
+            // Claim the token atomically, so two installs can't both use it
+            const claimed = await tx`
+        UPDATE collector_enrollment_tokens
+        SET used_at = NOW(), used_by = ${collector_name}, used_group = COALESCE(${group ?? null}, group_name)
+        WHERE token_hash = ${sha256(token)} AND used_at IS NULL AND expires_at > NOW()
+        RETURNING id, tenant_id, site_id, used_group
+      `;
+            const row = claimed[0];
+            if (!row) return null;
+
+            // Format: sk_live_<48 hex chars>, as for source keys
+            const apiKey = `sk_live_${randomBytes(24).toString('hex')}`;
+            const keys = await tx`
+        INSERT INTO api_keys (tenant_id, key_hash, prefix, name, is_active)
+        VALUES (${row.tenant_id}, ${sha256(apiKey)}, ${apiKey.substring(0, 15)}, ${`Collector: ${collector_name}`}, true)
+        RETURNING id
+      `;
+            await tx`
+        UPDATE collector_enrollment_tokens SET api_key_id = ${keys[0]!.id} WHERE id = ${row.id}
+      `;
+
+            return { apiKey, tenantId: row.tenant_id as string, siteId: row.site_id as string | null, group: row.used_group as string | null };
+        });
+
+        if (!enrolled) {
+            // Slow down token guessing, as for API keys
+            await new Promise(resolve => setTimeout(resolve, 100));
+            return reply.code(401).send({ error: 'Invalid, expired or already used enrollment token' });
+        }
+
+        req.log.info({ tenant_id: enrolled.tenantId, collector_name, group: enrolled.group }, 'Collector enrolled');
+        return reply.code(201).send({
+            api_key: enrolled.apiKey, // Only time it's shown
+            tenant_id: enrolled.tenantId,
+            site_id: enrolled.siteId,
+            group: enrolled.group,
+            ingest_url: `${process.env.APP_BASE_URL || 'https://api.centinela.cloud'}/v1/ingest/syslog`,
+        });
+    });
+
+    // --- Management side (user auth) ---
+
+    // Create an enrollment token (the full token is only returned here)
+    fastify.post('/v1/enrollment-tokens', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const result = CreateEnrollmentTokenSchema.safeParse(req.body ?? {});
+        if (!result.success) {
+            return reply.code(400).send({ error: 'Invalid input', details: result.error });
+        }
+
+        const { name, site_id, group, ttl_hours } = result.data;
+        const token = `cet_${randomBytes(24).toString('hex')}`;
+        const rows = await sql`
+      INSERT INTO collector_enrollment_tokens (tenant_id, site_id, group_name, token_hash, name, expires_at, created_by)
+      VALUES (${tenantId}, ${site_id ?? null}, ${group ?? null}, ${sha256(token)}, ${name ?? null}, NOW() + make_interval(hours => ${ttl_hours}), ${req.user?.id ?? null})
+      RETURNING id, name, site_id, group_name AS "group", expires_at
+    `;
+
+        return reply.code(201).send({
+            data: {
+                ...rows[0],
+                token,
+                instructions: { command: `collector init --token ${token}` },
+            },
+        });
+    });
+
+    // Tokens and which collector used them
+    fastify.get('/v1/enrollment-tokens', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const tokens = await sql`
+      SELECT id, name, site_id, group_name AS "group", expires_at, used_at, used_by, used_group, created_at
+      FROM collector_enrollment_tokens
+      WHERE tenant_id = ${tenantId}
+      ORDER BY created_at DESC
+      LIMIT 100
+    `;
+
+        return { data: tokens };
+    });
+};
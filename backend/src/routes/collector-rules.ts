@@ -0,0 +1,196 @@
+import type { FastifyPluginAsync } from 'fastify';
+import { z } from 'zod';
+import { sql } from '../db/index.js';
+import { configLayersFor } from './collector-config.js';
+import { pendingSupportBundle } from './collector-support-bundles.js';
+
+// Structural validation only; collectors compile patterns and run the tests before activating
+const CollectorRuleSchema = z.object({
+    id: z.string().min(1).max(100),
+    description: z.string().optional(),
+    enabled: z.boolean().optional(),
+    action: z.enum(['drop', 'redact', 'tag']),
+    pattern: z.string().min(1).max(1000).optional(),
+    flags: z.string().regex(/^[imsu]*$/).optional(),
+    sources: z.array(z.string()).optional(),
+    replacement: z.string().optional(),
+    tags: z.record(z.string()).optional(),
+});
+
+const CollectorRuleTestSchema = z.object({
+    message: z.string(),
+    source_ip: z.string().optional(),
+    expect: z.enum(['drop', 'keep']),
+    output: z.string().optional(),
+});
+
+const PublishRuleSetSchema = z.object({
+    rules: z.array(CollectorRuleSchema).max(500),
+    tests: z.array(CollectorRuleTestSchema).default([]),
+    rollout_percent: z.number().int().min(0).max(100).default(0),
+});
+
+const RolloutSchema = z.object({
+    rollout_percent: z.number().int().min(0).max(100),
+});
+
+const AckSchema = z.object({
+    collector_name: z.string().min(1),
+    version: z.coerce.number().int(),
+    status: z.enum(['applied', 'rejected', 'deferred', 'dry_run']),
+    error: z.string().max(2000).optional(),
+});
+
+/**
+ * Collector Rules (control channel)
+ *
+ * Tenants publish versioned filter/redaction/tag rule sets and widen the
+ * rollout percentage in stages; collectors poll for the latest version and
+ * report whether they applied, rejected (failed local validation), deferred it
+ * (outside the rollout) or only evaluated it (dry_run).
+ */
+export const collectorRulesRoutes: FastifyPluginAsync = async (fastify) => {
+
+    // --- Collector side (API key) ---
+
+    // Latest rule set for the tenant, the configuration layers for the
+    // collector (see collector-config.ts) and a support bundle waiting for it
+    // (see collector-support-bundles.ts). ETag changes with any of them.
+    fastify.get('/v1/collector/rules', {
+        preHandler: fastify.verifyApiKey,
+    }, async (req, reply) => {
+        const tenantId = req.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const rows = await sql`
+      SELECT version, rules, tests, rollout_percent
+      FROM collector_rule_sets
+      WHERE tenant_id = ${tenantId}
+      ORDER BY version DESC
+      LIMIT 1
+    `;
+        const latest = rows[0];
+        const layers = await configLayersFor(req, tenantId);
+        const supportBundle = await pendingSupportBundle(req, tenantId);
+        if (!latest && layers.length === 0 && !supportBundle) return reply.code(204).send();
+
+        const layerTag = layers.map((layer) => `${layer.layer}=${layer.version}`).join(',');
+        const etag = `"${latest ? `${latest.version}-${latest.rollout_percent}` : 'none'}-${layerTag}-${supportBundle?.id ?? ''}"`;
+        if (req.headers['if-none-match'] === etag) {
+            return reply.code(304).send();
+        }
+
+        reply.header('ETag', etag);
+        return {
+            ...(latest && {
+                rollout_percent: latest.rollout_percent,
+                rule_set: {
+                    version: latest.version,
+                    rules: latest.rules,
+                    tests: latest.tests,
+                },
+            }),
+            config_layers: layers,
+            ...(supportBundle && { support_bundle: supportBundle }),
+        };
+    });
+
+    // Outcome reported by a collector
+    fastify.post('/v1/collector/rules/ack', {
+        preHandler: fastify.verifyApiKey,
+    }, async (req, reply) => {
+        const tenantId = req.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const result = AckSchema.safeParse(req.body);
+        if (!result.success) {
+            return reply.code(400).send({ error: 'Invalid input', details: result.error });
+        }
+
+        const { collector_name, version, status, error } = result.data;
+        await sql`
+      INSERT INTO collector_rule_acks (tenant_id, collector_name, version, status, error)
+      VALUES (${tenantId}, ${collector_name}, ${version}, ${status}, ${error ?? null})
+      ON CONFLICT (tenant_id, collector_name, version)
+      DO UPDATE SET status = EXCLUDED.status, error = EXCLUDED.error, reported_at = NOW()
+    `;
+
+        return { ok: true };
+    });
+
+    // --- Management side (user auth) ---
+
+    // Publish a new version (starts at rollout_percent, 0 by default)
+    fastify.post('/v1/collector-rules', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const result = PublishRuleSetSchema.safeParse(req.body);
+        if (!result.success) {
+            return reply.code(400).send({ error: 'Invalid input', details: result.error });
+        }
+
+        const { rules, tests, rollout_percent } = result.data;
+        const rows = await sql`
+      INSERT INTO collector_rule_sets (tenant_id, version, rules, tests, rollout_percent, created_by)
+      SELECT
+        ${tenantId},
+        COALESCE(MAX(version), 0) + 1,
+        ${JSON.stringify(rules)},
+        ${JSON.stringify(tests)},
+        ${rollout_percent},
+        ${req.user?.id ?? null}
+      FROM collector_rule_sets
+      WHERE tenant_id = ${tenantId}
+      RETURNING version, rollout_percent, created_at
+    `;
+
+        return reply.code(201).send({ data: rows[0] });
+    });
+
+    // Widen (or roll back) the rollout of a version
+    fastify.put('/v1/collector-rules/:version/rollout', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const version = Number((req.params as { version: string }).version);
+        const result = RolloutSchema.safeParse(req.body);
+        if (!Number.isInteger(version) || !result.success) {
+            return reply.code(400).send({ error: 'Invalid input' });
+        }
+
+        const rows = await sql`
+      UPDATE collector_rule_sets
+      SET rollout_percent = ${result.data.rollout_percent}, updated_at = NOW()
+      WHERE tenant_id = ${tenantId} AND version = ${version}
+      RETURNING version, rollout_percent, updated_at
+    `;
+        if (rows.length === 0) return reply.code(404).send({ error: 'Rule set not found' });
+
+        return { data: rows[0] };
+    });
+
+    // Rollout status: what each collector reported for a version
+    fastify.get('/v1/collector-rules/:version/acks', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const version = Number((req.params as { version: string }).version);
+        if (!Number.isInteger(version)) return reply.code(400).send({ error: 'Invalid version' });
+
+        const acks = await sql`
+      SELECT collector_name, status, error, reported_at
+      FROM collector_rule_acks
+      WHERE tenant_id = ${tenantId} AND version = ${version}
+      ORDER BY reported_at DESC
+    `;
+
+        return { data: acks };
+    });
+};
@@ -0,0 +1,166 @@
+import type { FastifyPluginAsync, FastifyRequest } from 'fastify';
+import { z } from 'zod';
+import { sql } from '../db/index.js';
+
+// Bundles carry logs, metrics and a CPU profile; a heap snapshot may take most of this
+const SUPPORT_BUNDLE_MAX_BYTES = 64 * 1024 * 1024;
+
+const RequestBundleSchema = z.object({
+    collector_name: z.string().min(1).max(200),
+    public_key: z.string().min(1).max(10000).regex(/-----BEGIN PUBLIC KEY-----/, 'Expected a PEM public key').optional(),
+    cpu_seconds: z.number().int().min(0).max(60).optional(),
+    heap: z.boolean().default(false),
+});
+
+export interface SupportBundleRequest {
+    id: string;
+    public_key?: string;
+    cpu_seconds?: number;
+    heap: boolean;
+}
+
+function collectorName(req: FastifyRequest): string | undefined {
+    const value = req.headers['x-centinela-collector-name'];
+    if (typeof value !== 'string') return undefined;
+    try {
+        return decodeURIComponent(value); // Collectors percent-encode non-ASCII values
+    } catch {
+        return value;
+    }
+}
+
+/**
+ * Oldest bundle still waiting for the collector making the request (by
+ * X-Centinela-Collector-Name), requested in the last day
+ */
+export async function pendingSupportBundle(req: FastifyRequest, tenantId: string): Promise<SupportBundleRequest | null> {
+    const name = collectorName(req);
+    if (!name) return null;
+
+    const rows = await sql`
+    SELECT id, public_key, cpu_seconds, heap
+    FROM collector_support_bundles
+    WHERE tenant_id = ${tenantId} AND collector_name = ${name}
+      AND uploaded_at IS NULL AND requested_at > NOW() - INTERVAL '1 day'
+    ORDER BY requested_at
+    LIMIT 1
+  `;
+    const row = rows[0];
+    if (!row) return null;
+
+    return {
+        id: row.id as string,
+        ...(row.public_key && { public_key: row.public_key as string }),
+        ...(row.cpu_seconds !== null && { cpu_seconds: row.cpu_seconds as number }),
+        heap: row.heap as boolean,
+    };
+}
+
+/**
+ * Collector Support Bundles
+ *
+ * An admin asks a collector for a support bundle; the collector sees the
+ * request on its next control channel poll (GET /v1/collector/rules,
+ * "support_bundle"), makes the bundle, encrypted for the given public key,
+ * and uploads it here once. The backend only stores the encrypted file:
+ * it is downloaded and decrypted by support.
+ */
+export const collectorSupportBundleRoutes: FastifyPluginAsync = async (fastify) => {
+
+    // --- Collector side (API key) ---
+
+    // Upload of a requested bundle (application/octet-stream)
+    fastify.post('/v1/collector/support-bundles/:id', {
+        preHandler: fastify.verifyApiKey,
+        bodyLimit: SUPPORT_BUNDLE_MAX_BYTES,
+    }, async (req, reply) => {
+        const tenantId = req.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const id = z.string().uuid().safeParse((req.params as { id: string }).id);
+        if (!id.success) return reply.code(404).send({ error: 'Support bundle request not found' });
+        if (!Buffer.isBuffer(req.body) || req.body.length === 0) {
+            return reply.code(415).send({ error: 'Expected application/octet-stream' });
+        }
+
+        // Only the collector it was asked of, once
+        const rows = await sql`
+      UPDATE collector_support_bundles
+      SET bundle = ${req.body}, size_bytes = ${req.body.length}, uploaded_at = NOW()
+      WHERE id = ${id.data} AND tenant_id = ${tenantId} AND collector_name = ${collectorName(req) ?? null}
+        AND uploaded_at IS NULL
+      RETURNING id
+    `;
+        if (rows.length === 0) return reply.code(404).send({ error: 'Support bundle request not found or already uploaded' });
+
+        req.log.info({ tenant_id: tenantId, support_bundle_id: id.data, bytes: req.body.length }, 'Support bundle uploaded');
+        return reply.code(201).send({ ok: true });
+    });
+
+    // --- Management side (user auth) ---
+
+    // Ask a collector for a bundle
+    fastify.post('/v1/collector-support-bundles', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const result = RequestBundleSchema.safeParse(req.body);
+        if (!result.success) {
+            return reply.code(400).send({ error: 'Invalid input', details: result.error });
+        }
+
+        const { collector_name, public_key, cpu_seconds, heap } = result.data;
+        const rows = await sql`
+      INSERT INTO collector_support_bundles (tenant_id, collector_name, public_key, cpu_seconds, heap, requested_by)
+      VALUES (${tenantId}, ${collector_name}, ${public_key ?? null}, ${cpu_seconds ?? null}, ${heap}, ${req.user?.id ?? null})
+      RETURNING id, collector_name, cpu_seconds, heap, requested_at
+    `;
+
+        return reply.code(201).send({ data: rows[0] });
+    });
+
+    // Requests and their uploads
+    fastify.get('/v1/collector-support-bundles', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const bundles = await sql`
+      SELECT id, collector_name, cpu_seconds, heap, size_bytes, requested_at, uploaded_at
+      FROM collector_support_bundles
+      WHERE tenant_id = ${tenantId}
+      ORDER BY requested_at DESC
+      LIMIT 100
+    `;
+
+        return { data: bundles };
+    });
+
+    // The encrypted bundle, as uploaded
+    fastify.get('/v1/collector-support-bundles/:id/download', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const id = z.string().uuid().safeParse((req.params as { id: string }).id);
+        if (!id.success) return reply.code(404).send({ error: 'Support bundle not found' });
+
+        const rows = await sql`
+      SELECT collector_name, bundle
+      FROM collector_support_bundles
+      WHERE id = ${id.data} AND tenant_id = ${tenantId} AND bundle IS NOT NULL
+    `;
+        const row = rows[0];
+        if (!row) return reply.code(404).send({ error: 'Support bundle not found' });
+
+        const fileName = `${String(row.collector_name).replace(/[^\w.-]/g, '_')}-${id.data}.tar.gz.enc`;
+        return reply
+            .header('Content-Type', 'application/octet-stream')
+            .header('Content-Disposition', `attachment; filename="${fileName}"`)
+            .send(row.bundle as Buffer);
+    });
+};
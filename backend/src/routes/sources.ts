@@ -13,6 +13,11 @@ const CreateSourceSchema = z.object({
     type: z.enum(['fortigate_syslog']).default('fortigate_syslog'),
 });
 
+const ReleaseQuarantineSchema = z.object({
+    source_ip: z.string().ip(),
+    collector_name: z.string().min(1).optional(), // Default: from every collector
+});
+
 const TestLogSchema = z.object({
     log: z.string().min(1),
     source_type: z.enum(['fortigate_syslog']).default('fortigate_syslog')
@@ -154,6 +159,48 @@ export const sourcesRoutes: FastifyPluginAsync = async (fastify) => {
         }
     });
 
+    // Senders whose events arrived quarantined (greylist mode on the collector)
+    fastify.get('/v1/sources/quarantined', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const senders = await sql`
+      SELECT source_ip, collector_name, COUNT(*) AS events, MIN(received_at) AS first_seen, MAX(received_at) AS last_seen
+      FROM raw_events
+      WHERE tenant_id = ${tenantId} AND quarantined = TRUE
+      GROUP BY source_ip, collector_name
+      ORDER BY last_seen DESC
+      LIMIT 500
+    `;
+
+        return { data: senders };
+    });
+
+    // Approve a sender's quarantined events: they are normalized and run through detection
+    fastify.post('/v1/sources/quarantined/release', {
+        preHandler: fastify.verifyAuth,
+    }, async (req, reply) => {
+        const tenantId = req.user?.tenantId;
+        if (!tenantId) return reply.code(401).send({ error: 'Unauthorized' });
+
+        const result = ReleaseQuarantineSchema.safeParse(req.body);
+        if (!result.success) {
+            return reply.code(400).send({ error: 'Invalid input', details: result.error });
+        }
+
+        const { source_ip, collector_name } = result.data;
+        const released = await sql`
+      UPDATE raw_events
+      SET quarantined = FALSE
+      WHERE tenant_id = ${tenantId} AND quarantined = TRUE AND source_ip = ${source_ip}
+        ${collector_name ? sql`AND collector_name = ${collector_name}` : sql``}
+    `;
+
+        return { ok: true, released: released.count };
+    });
+
     // Delete source
     fastify.delete('/v1/sources/:id', {
         preHandler: fastify.verifyAuth,
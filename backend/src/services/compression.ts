@@ -0,0 +1,139 @@
+/**
+ * Bulk Request Compression
+ *
+ * Collectors may compress bulk requests (their BATCH_COMPRESSION):
+ * Content-Encoding gzip or zstd, zstd optionally with a dictionary the
+ * collector trained on the tenant's traffic. A dictionary is uploaded once
+ * (POST /v1/ingest/syslog/dictionaries, X-Centinela-Zstd-Dictionary: <id>)
+ * and stored per tenant; requests compressed with it name it in the same
+ * header. A request naming a dictionary the tenant never uploaded is
+ * answered 412: the collector resends it without and uploads it again.
+ *
+ * Bodies are decompressed as they stream in, so the route's bodyLimit
+ * applies to the decompressed size.
+ */
+
+import type { IncomingHttpHeaders } from 'node:http';
+import type { Readable } from 'node:stream';
+import { createGunzip, createZstdDecompress, zstdCompressSync, type ZstdOptions } from 'node:zlib';
+import { sql } from '../db/index.js';
+
+// The collector's ZSTD_DICTIONARY_MAX_BYTES limit
+export const DICTIONARY_MAX_BYTES = 1024 * 1024;
+
+const DICTIONARY_MAGIC = 0xec30a437; // Header of a zstd dictionary ("zstd --train" output)
+const DICTIONARY_CACHE_SIZE = 256; // Dictionaries kept in memory, least recently used dropped
+
+const dictionaryCache = new Map<string, Buffer>();
+
+// Thrown while decoding; the error handler answers with statusCode
+export class ContentEncodingError extends Error {
+  constructor(public readonly statusCode: number, public readonly code: string, message: string) {
+    super(message);
+  }
+}
+
+/**
+ * Whether zlib applies zstd dictionaries (Node.js 22.19 / 24.6 or later;
+ * 22.15-22.18 have zstd but ignore the dictionary option). Probed: a
+ * dictionary holding the input must shrink it.
+ */
+export function zstdDictionariesSupported(): boolean {
+  const probe = Buffer.from('centinela zstd dictionary probe '.repeat(4));
+  const options: ZstdOptions & { dictionary?: Buffer } = { dictionary: Buffer.concat([probe, probe]) };
+  return zstdCompressSync(probe, options).length < zstdCompressSync(probe).length;
+}
+
+/**
+ * Dictionary ID from a zstd dictionary header (magic, then the ID, little endian)
+ */
+export function dictionaryId(dictionary: Buffer): number | null {
+  if (dictionary.length < 8 || dictionary.readUInt32LE(0) !== DICTIONARY_MAGIC) return null;
+  return dictionary.readUInt32LE(4);
+}
+
+/**
+ * X-Centinela-Zstd-Dictionary as a dictionary ID, null if absent or invalid
+ */
+export function dictionaryHeader(headers: IncomingHttpHeaders): number | null {
+  const value = headers['x-centinela-zstd-dictionary'];
+  if (typeof value !== 'string' || !/^\d{1,10}$/.test(value)) return null;
+  const id = Number(value);
+  return id <= 0xffffffff ? id : null;
+}
+
+export async function storeDictionary(tenantId: string, id: number, dictionary: Buffer): Promise<void> {
+  await sql`
+    INSERT INTO zstd_dictionaries (tenant_id, dictionary_id, dictionary)
+    VALUES (${tenantId}, ${id}, ${dictionary})
+    ON CONFLICT (tenant_id, dictionary_id) DO UPDATE SET dictionary = EXCLUDED.dictionary, created_at = NOW()
+  `;
+  remember(`${tenantId}:${id}`, dictionary);
+}
+
+async function loadDictionary(tenantId: string, id: number): Promise<Buffer | null> {
+  const key = `${tenantId}:${id}`;
+  const cached = dictionaryCache.get(key);
+  if (cached) {
+    remember(key, cached);
+    return cached;
+  }
+
+  const rows = await sql`
+    SELECT dictionary FROM zstd_dictionaries
+    WHERE tenant_id = ${tenantId} AND dictionary_id = ${id}
+  `;
+  const dictionary = rows[0]?.dictionary as Buffer | undefined;
+  if (!dictionary) return null;
+
+  remember(key, dictionary);
+  await sql`
+    UPDATE zstd_dictionaries SET last_used_at = NOW()
+    WHERE tenant_id = ${tenantId} AND dictionary_id = ${id}
+  `;
+  return dictionary;
+}
+
+function remember(key: string, dictionary: Buffer): void {
+  dictionaryCache.delete(key);
+  dictionaryCache.set(key, dictionary);
+  if (dictionaryCache.size > DICTIONARY_CACHE_SIZE) {
+    dictionaryCache.delete(dictionaryCache.keys().next().value!);
+  }
+}
+
+/**
+ * preParsing step: the request body decompressed per its Content-Encoding
+ * (none, identity, gzip, zstd). Throws 415 for other encodings, 412 for an
+ * unknown dictionary.
+ */
+export async function decodeBody(tenantId: string, headers: IncomingHttpHeaders, payload: Readable): Promise<Readable> {
+  const encoding = headers['content-encoding']?.trim().toLowerCase();
+  if (!encoding || encoding === 'identity') return payload;
+
+  let decoder;
+  if (encoding === 'gzip') {
+    decoder = createGunzip();
+  } else if (encoding === 'zstd') {
+    const id = dictionaryHeader(headers);
+    const options: ZstdOptions & { dictionary?: Buffer } = {};
+    if (id !== null) {
+      const dictionary = await loadDictionary(tenantId, id);
+      if (!dictionary) {
+        throw new ContentEncodingError(412, 'unknown_dictionary', `zstd dictionary ${id} is not known for this tenant`);
+      }
+      options.dictionary = dictionary;
+    }
+    decoder = createZstdDecompress(options);
+  } else {
+    throw new ContentEncodingError(415, 'unsupported_encoding', `Content-Encoding ${encoding} is not supported (gzip, zstd)`);
+  }
+
+  // Fastify compares Content-Length with the bytes received, not the decompressed ones
+  const decoded = Object.assign(decoder, { receivedEncodedLength: 0 });
+  payload.on('data', (chunk: Buffer) => {
+    decoded.receivedEncodedLength += chunk.length;
+  });
+  payload.on('error', (err) => decoded.destroy(err));
+  return payload.pipe(decoded);
+}
@@ -0,0 +1,45 @@
+/**
+ * Continuation Reassembly
+ *
+ * Collectors split messages longer than their MAX_MESSAGE_BYTES into ordered
+ * parts (large Windows event XML, stack traces) instead of truncating them.
+ * Every part carries continuation = { id, index, total }: the same id for
+ * all parts of a message, index 0..total-1. Parts are kept in Redis until
+ * all of them have arrived (in any order, from any ingest worker); the
+ * message is then stored once. Parts of a message that never completes
+ * expire after CONTINUATION_TTL_SECONDS.
+ */
+
+import { redis } from '../lib/redis.js';
+
+const CONTINUATION_TTL_SECONDS = parseInt(process.env['CONTINUATION_TTL_SECONDS'] || '3600', 10);
+
+export interface Continuation {
+  id: string;
+  index: number;
+  total: number;
+  truncated?: boolean; // The collector dropped the rest (more parts than it sends per message)
+}
+
+/**
+ * Store one part; returns the whole message once this part completes it,
+ * null while parts are missing (or if another worker already completed it)
+ */
+export async function collectPart(tenantId: string, continuation: Continuation, rawMessage: string): Promise<string | null> {
+  const key = `continuation:${tenantId}:${continuation.id}`;
+
+  // Atomic, so exactly one worker sees the last new part arrive (a retried part adds nothing)
+  const results = await redis
+    .multi()
+    .hset(key, String(continuation.index), rawMessage)
+    .hlen(key)
+    .expire(key, CONTINUATION_TTL_SECONDS)
+    .exec();
+  const added = Number(results?.[0]?.[1] ?? 0);
+  const parts = Number(results?.[1]?.[1] ?? 0);
+  if (added === 0 || parts < continuation.total) return null;
+
+  const stored = await redis.hgetall(key);
+  await redis.del(key);
+  return Array.from({ length: continuation.total }, (_, index) => stored[String(index)] ?? '').join('');
+}
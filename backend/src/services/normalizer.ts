@@ -58,11 +58,11 @@ export interface NormalizedEvent {
  * @returns Number of events processed
  */
 export async function processRawEvents(batchSize: number = 100): Promise<number> {
-  // Fetch unparsed events
+  // Fetch unparsed events; quarantined ones wait until they are released (routes/sources.ts)
   const rawEvents = await sql<RawEvent[]>`
     SELECT id, tenant_id, site_id, source_id, received_at, source_ip, raw_message, collector_name, parsed
     FROM raw_events
-    WHERE parsed = FALSE
+    WHERE parsed = FALSE AND quarantined = FALSE
     ORDER BY received_at ASC
     LIMIT ${batchSize}
   `;
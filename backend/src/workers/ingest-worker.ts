@@ -1,15 +1,67 @@
 import type { Job } from 'bullmq';
 import { createWorker, QUEUE_NAMES } from '../lib/queue.js';
 import { sql } from '../db/index.js';
+import { collectPart, type Continuation } from '../services/continuation.js';
 
 interface IngestJobData {
   tenant_id: string;
+  event_id?: string;
   site_id?: string;
   source_id?: string;
   received_at: string;
   source_ip?: string;
+  source_port?: number;
+  transport?: string;
   raw_message: string;
   collector_name?: string;
+  relay_hops?: Array<{ collector: string; received_at: string; peer_ip: string }>;
+  // Header fields parsed by the collector (RFC 5424 or RFC 3164)
+  syslog?: {
+    format: 'rfc5424';
+    pri: number;
+    facility: number;
+    severity: number;
+    version: number;
+    timestamp?: string;
+    hostname?: string;
+    app_name?: string;
+    procid?: string;
+    msgid?: string;
+    structured_data?: Record<string, Record<string, string>>;
+    message?: string;
+  } | {
+    format: 'rfc3164';
+    pri: number;
+    facility: number;
+    severity: number;
+    timestamp?: string;
+    raw_timestamp?: string;
+    hostname?: string;
+    tag?: string;
+    procid?: string;
+    message?: string;
+  };
+  stream?: {
+    id: string;
+    offset: number;
+    length: number;
+    encoding: 'utf8' | 'base64';
+    final: boolean;
+  };
+  // Part of a message the collector split (longer than its MAX_MESSAGE_BYTES)
+  continuation?: Continuation;
+  quarantined?: boolean;
+  tags?: Record<string, string>;
+  meta?: {
+    type: 'tcp_session';
+    action: 'connected' | 'disconnected';
+    connected_at: string;
+    reason?: string;
+    duration_ms?: number;
+    bytes?: number;
+    messages?: number;
+    keepalives?: number;
+  };
 }
 
 /**
@@ -18,47 +70,88 @@ interface IngestJobData {
  * Consumes raw syslog events from the 'ingest-queue'.
  * Inserts them into the Postgres database for further processing by the pipeline.
  * This decouples the API ingestion speed from the DB write speed.
+ *
+ * Events are stored once per tenant and event_id (assigned by the collector), so
+ * batches the collector retries or replays after a crash are not
+ * duplicated. A split message is stored under its continuation id.
  */
 export const ingestWorker = createWorker(QUEUE_NAMES.INGEST, async (job: Job<IngestJobData>) => {
   const {
     tenant_id,
+    event_id,
     site_id,
     source_id,
     received_at,
     source_ip,
-    raw_message,
-    collector_name
+    source_port,
+    transport,
+    collector_name,
+    relay_hops,
+    syslog,
+    continuation,
+    stream,
+    quarantined,
+    meta,
+    tags
   } = job.data;
 
+  // Parts are stored once the whole message has arrived
+  let raw_message = job.data.raw_message;
+  if (continuation) {
+    const message = await collectPart(tenant_id, continuation, raw_message);
+    if (message === null) return { pending_continuation: continuation.id };
+    raw_message = message;
+  }
+
   // Bulk insert could be implemented here for higher throughput by buffering jobs,
   // but for now, we process one by one to ensure durability.
 
   try {
     const result = await sql`
       INSERT INTO raw_events (
+        event_id,
         tenant_id,
         site_id,
         source_id,
         received_at,
         source_ip,
+        source_port,
+        transport,
         raw_message,
-        collector_name
+        collector_name,
+        relay_hops,
+        syslog,
+        stream,
+        quarantined,
+        meta,
+        tags
       ) VALUES (
+        ${continuation?.id ?? event_id ?? null},
         ${tenant_id},
         ${site_id ?? null},
         ${source_id ?? null},
         ${received_at},
         ${source_ip ?? null},
+        ${source_port ?? null},
+        ${transport ?? null},
         ${raw_message},
-        ${collector_name ?? null}
+        ${collector_name ?? null},
+        ${relay_hops ? JSON.stringify(relay_hops) : null},
+        ${syslog ? JSON.stringify(syslog) : null},
+        ${stream ? JSON.stringify(stream) : null},
+        ${quarantined ?? false},
+        ${meta ? JSON.stringify(meta) : null},
+        ${tags ? JSON.stringify(tags) : null}
       )
+      ON CONFLICT (tenant_id, event_id) DO NOTHING
       RETURNING id
     `;
 
     // Logging every single insert might be too noisy for high throughput
     // console.log(`📥 [Job ${job.id}] Persisted event ${result[0].id}`);
 
-    return { event_id: result[0]!.id };
+    // No row: this event_id was already stored (a retry or replay)
+    return { id: result[0]?.id ?? null, event_id: continuation?.id ?? event_id ?? null, duplicate: result.length === 0 };
 
   } catch (error) {
     const msg = error instanceof Error ? error.message : 'Unknown DB error';
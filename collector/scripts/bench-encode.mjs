@@ -0,0 +1,151 @@
+// Encoding benchmark for bulk ingest requests (BATCH_FORMAT=json).
+// Compares JSON.stringify of the whole {"events": [...]} body, JSON.stringify
+// per record joined into the body, and a hand-rolled encoder that writes the
+// record fields in a fixed order and uses JSON.stringify only to escape
+// strings. Records have the shape buildIngestPayload() gives (serializers.ts)
+// and carry typical firewall messages with their parsed RFC 5424 header;
+// --without-syslog leaves the header out (records as sent before the
+// syslog field existed, about two thirds the size).
+//
+// Usage: node scripts/bench-encode.mjs [--events 50000] [--runs 15] [--without-syslog]
+// Prints the median and min-max time per approach, after warmup runs.
+import { performance } from 'node:perf_hooks';
+import { parseArgs } from 'node:util';
+
+const { values } = parseArgs({
+  options: {
+    events: { type: 'string', default: '50000' },
+    runs: { type: 'string', default: '15' },
+    'without-syslog': { type: 'boolean', default: false },
+  },
+});
+const EVENTS = Number(values.events);
+const RUNS = Number(values.runs);
+const WARMUP_RUNS = 5;
+
+const ACTIONS = ['accept', 'deny', 'close', 'timeout'];
+const SERVICES = ['HTTPS', 'HTTP', 'DNS', 'SSH', 'SMB', 'RDP'];
+const PORTS = [443, 80, 53, 22, 445, 3389];
+
+function firewallRecord(i) {
+  const timestamp = new Date(Date.UTC(2026, 0, 1) + i * 37).toISOString();
+  const srcip = `10.${(i >> 16) & 255}.${(i >> 8) & 255}.${i & 255}`;
+  const dstip = `203.0.113.${i % 254 + 1}`;
+  const service = i % SERVICES.length;
+  const action = ACTIONS[i % ACTIONS.length];
+  const message = `srcip=${srcip} srcport=${49152 + (i % 16384)} dstip=${dstip} dstport=${PORTS[service]} proto=6 `
+    + `action=${action} policyid=${i % 40 + 1} service=${SERVICES[service]} sentbyte=${(i * 31) % 100000} rcvdbyte=${(i * 17) % 500000}`;
+  const raw = `<189>1 ${timestamp} FGT-EDGE-01 - - traffic - ${message}`;
+
+  return {
+    event_id: `0195c2a4-7e1b-7000-8000-${String(i).padStart(12, '0')}`,
+    raw_message: raw,
+    received_at: timestamp,
+    source_ip: '192.0.2.10',
+    source_port: 514,
+    transport: 'udp',
+    syslog: values['without-syslog'] ? undefined : {
+      format: 'rfc5424',
+      pri: 189,
+      facility: 23,
+      severity: 5,
+      version: 1,
+      timestamp,
+      hostname: 'FGT-EDGE-01',
+      app_name: null,
+      procid: null,
+      msgid: 'traffic',
+      structured_data: null,
+    },
+    collector_name: 'collector-hq-01',
+    tenant_id: '6f1c2b1e-3f4a-4b8e-9a51-2d0c7e5b9a10',
+    site_id: 'hq',
+    source_id: undefined,
+    relay_hops: undefined,
+    stream: undefined,
+    continuation: undefined,
+    meta: undefined,
+    quarantined: undefined,
+    tags: undefined,
+  };
+}
+
+// --- hand-rolled encoder: fixed field order, JSON.stringify only for strings ---
+
+const str = (value) => JSON.stringify(value);
+
+function field(out, key, value) {
+  if (value === undefined) return out;
+  return `${out},"${key}":${typeof value === 'string' ? str(value) : value === null ? 'null' : typeof value === 'object' ? JSON.stringify(value) : value}`;
+}
+
+function encodeSyslog(syslog) {
+  let out = `{"format":${str(syslog.format)},"pri":${syslog.pri},"facility":${syslog.facility},"severity":${syslog.severity}`;
+  out = field(out, 'version', syslog.version);
+  out = field(out, 'timestamp', syslog.timestamp);
+  out = field(out, 'hostname', syslog.hostname);
+  out = field(out, 'app_name', syslog.app_name);
+  out = field(out, 'procid', syslog.procid);
+  out = field(out, 'msgid', syslog.msgid);
+  out = field(out, 'structured_data', syslog.structured_data);
+  return `${out}}`;
+}
+
+function encodeRecord(record) {
+  let out = `{"event_id":${str(record.event_id)},"raw_message":${str(record.raw_message)}`
+    + `,"received_at":${str(record.received_at)},"source_ip":${str(record.source_ip)}`;
+  out = field(out, 'source_port', record.source_port);
+  out = field(out, 'transport', record.transport);
+  if (record.syslog) out += `,"syslog":${encodeSyslog(record.syslog)}`;
+  out = field(out, 'collector_name', record.collector_name);
+  out = field(out, 'tenant_id', record.tenant_id);
+  out = field(out, 'site_id', record.site_id);
+  out = field(out, 'source_id', record.source_id);
+  out = field(out, 'relay_hops', record.relay_hops);
+  out = field(out, 'stream', record.stream);
+  out = field(out, 'continuation', record.continuation);
+  out = field(out, 'meta', record.meta);
+  out = field(out, 'quarantined', record.quarantined);
+  out = field(out, 'tags', record.tags);
+  return `${out}}`;
+}
+
+function encodeBatch(records) {
+  let out = '{"events":[';
+  for (let i = 0; i < records.length; i++) {
+    if (i > 0) out += ',';
+    out += encodeRecord(records[i]);
+  }
+  return `${out}]}`;
+}
+
+// --- benchmark ---
+
+const APPROACHES = {
+  'JSON.stringify of the whole batch': (records) => JSON.stringify({ events: records }),
+  'JSON.stringify per record + join': (records) => `{"events":[${records.map((record) => JSON.stringify(record)).join(',')}]}`,
+  'hand-rolled encoder': encodeBatch,
+};
+
+const records = Array.from({ length: EVENTS }, (_, i) => firewallRecord(i));
+
+// Same output, or the comparison means nothing
+const expected = APPROACHES['JSON.stringify of the whole batch'](records);
+for (const [name, encode] of Object.entries(APPROACHES)) {
+  if (encode(records) !== expected) throw new Error(`${name}: output differs from JSON.stringify`);
+}
+
+console.log(`Node ${process.version}, ${EVENTS} events${values['without-syslog'] ? ' without syslog header' : ''}, ${(Buffer.byteLength(expected) / 1024 / 1024).toFixed(1)} MiB body, ${RUNS} runs`);
+for (const [name, encode] of Object.entries(APPROACHES)) {
+  for (let i = 0; i < WARMUP_RUNS; i++) encode(records);
+
+  const times = [];
+  for (let i = 0; i < RUNS; i++) {
+    const start = performance.now();
+    encode(records);
+    times.push(performance.now() - start);
+  }
+  times.sort((a, b) => a - b);
+  const median = times[Math.floor(times.length / 2)];
+  console.log(`  ${name.padEnd(36)} median ${median.toFixed(1).padStart(6)} ms  (${times[0].toFixed(1)}-${times[times.length - 1].toFixed(1)} ms, ${(median * 1000 / EVENTS).toFixed(2)} us/event)`);
+}
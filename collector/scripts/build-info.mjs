@@ -0,0 +1,21 @@
+// Stamp the commit and build date into dist/build-info.json (read by src/version.ts).
+// COLLECTOR_COMMIT / COLLECTOR_BUILD_DATE win (Docker builds have no .git);
+// otherwise the checked-out commit and the current time are used.
+import { execFileSync } from 'node:child_process';
+import { writeFileSync } from 'node:fs';
+
+function gitCommit() {
+  try {
+    return execFileSync('git', ['rev-parse', '--short=12', 'HEAD'], { encoding: 'utf8', stdio: ['ignore', 'pipe', 'ignore'] }).trim();
+  } catch {
+    return 'unknown';
+  }
+}
+
+const info = {
+  commit: process.env.COLLECTOR_COMMIT || gitCommit(),
+  build_date: process.env.COLLECTOR_BUILD_DATE || new Date().toISOString(),
+};
+
+writeFileSync(new URL('../dist/build-info.json', import.meta.url), `${JSON.stringify(info)}\n`);
+console.log(`build-info: ${info.commit} ${info.build_date}`);
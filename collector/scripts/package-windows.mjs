@@ -0,0 +1,37 @@
+// Assemble the Windows package in release/windows (run after `npm run build`):
+//   node.exe                            NODE_EXE, or this Node when building on Windows
+//   centinela-collector-service.exe     WINSW_EXE: the WinSW (x64) service wrapper
+//   collector.cmd                       `collector <command>` from an elevated prompt
+//   app\                                dist, package.json and the production node_modules
+// Zip the directory for distribution; `collector init --install-service` or
+// `collector service install` registers the service from it.
+import { execFileSync } from 'node:child_process';
+import { cpSync, existsSync, mkdirSync, rmSync, writeFileSync } from 'node:fs';
+
+const root = new URL('../', import.meta.url);
+const out = new URL('release/windows/', root);
+const app = new URL('app/', out);
+
+const nodeExe = process.env.NODE_EXE || (process.platform === 'win32' ? process.execPath : undefined);
+const winswExe = process.env.WINSW_EXE;
+if (!nodeExe || !winswExe) {
+  console.error('Set NODE_EXE (node.exe for Windows x64) and WINSW_EXE (WinSW-x64.exe)');
+  process.exit(2);
+}
+if (!existsSync(new URL('dist/index.js', root))) {
+  console.error('dist/ not found: run npm run build first');
+  process.exit(2);
+}
+
+rmSync(out, { recursive: true, force: true });
+mkdirSync(app, { recursive: true });
+cpSync(new URL('dist/', root), new URL('dist/', app), { recursive: true });
+cpSync(new URL('package.json', root), new URL('package.json', app));
+if (existsSync(new URL('package-lock.json', root))) cpSync(new URL('package-lock.json', root), new URL('package-lock.json', app));
+execFileSync('npm', ['ci', '--omit=dev', '--ignore-scripts'], { cwd: app, stdio: 'inherit', shell: process.platform === 'win32' });
+
+cpSync(nodeExe, new URL('node.exe', out));
+cpSync(winswExe, new URL('centinela-collector-service.exe', out));
+writeFileSync(new URL('collector.cmd', out), '@echo off\r\n"%~dp0node.exe" "%~dp0app\\dist\\index.js" %*\r\n');
+
+console.log(`windows package: ${out.pathname}`);
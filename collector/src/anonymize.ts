@@ -0,0 +1,155 @@
+import net from 'node:net';
+import { createHmac } from 'node:crypto';
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+
+export type AnonymizationProfile = 'none' | 'pseudonymize' | 'minimize' | 'strict';
+
+type ProcessorName = 'usernames' | 'emails' | 'ips' | 'query_strings';
+
+export interface AnonymizationStats {
+    profile: AnonymizationProfile;
+    processors: ProcessorName[];
+    events: number; // Events processed
+    modified: number; // Events with at least one replacement
+    replacements: Record<ProcessorName, number>;
+}
+
+/**
+ * What each profile applies. Hashing is a keyed HMAC (ANONYMIZATION_KEY), so
+ * the same user always maps to the same pseudonym and investigations can
+ * still correlate, while the name can't be recovered by hashing a dictionary.
+ *
+ * - pseudonymize: usernames and email addresses hashed, URL query strings dropped
+ * - minimize:     as pseudonymize, plus IPs truncated (IPv4 /24, IPv6 /48)
+ * - strict:       usernames and emails removed, IPs truncated, query strings dropped
+ */
+const PROFILES: Record<AnonymizationProfile, ProcessorName[]> = {
+    none: [],
+    pseudonymize: ['usernames', 'emails', 'query_strings'],
+    minimize: ['usernames', 'emails', 'ips', 'query_strings'],
+    strict: ['usernames', 'emails', 'ips', 'query_strings'],
+};
+
+// Service and built-in accounts are not personal data; keeping them readable keeps alerts useful
+const SYSTEM_ACCOUNTS = new Set([
+    '-', 'n/a', 'root', 'system', 'nobody', 'daemon', 'anonymous', 'local service', 'network service',
+]);
+
+// user=bob, suser="Bob Smith", Account Name: bob, sshd "password for [invalid user] bob"
+const USERNAME_PATTERNS = [
+    /\b((?:[sd]?user(?:_?name)?|usr|login|account(?:_?name)?|acct)=)("[^"]*"|[^\s",;]+)/gi,
+    /\b(Account Name:\s+)([^\s]+)/g,
+    /\b((?:password|publickey|keyboard-interactive(?:\/pam)?|hostbased|gssapi-with-mic|none) for (?:invalid user )?|(?:invalid|illegal) user |for user )([^\s()]+)/gi,
+];
+
+const EMAIL = /\b([A-Za-z0-9._%+-]+)@([A-Za-z0-9.-]+\.[A-Za-z]{2,})\b/g;
+const IPV4 = /\b(25[0-5]|2[0-4]\d|1?\d?\d)\.(25[0-5]|2[0-4]\d|1?\d?\d)\.(25[0-5]|2[0-4]\d|1?\d?\d)\.(25[0-5]|2[0-4]\d|1?\d?\d)\b/g;
+const IPV6_CANDIDATE = /(?<![\w:])(?:[0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4}(?![\w:.])/gi; // Not the IPv4 part of ::ffff:a.b.c.d
+
+// Absolute URLs and request paths ("GET /search?q=...", url=/login?token=...)
+const QUERY_STRING = /((?:\b[a-z][a-z0-9+.-]*:\/\/|(?:^|(?<=[\s"'=(]))\/)[^\s?#"']*)\?[^\s#"']*/gi;
+
+/**
+ * Log Anonymizer
+ *
+ * Applies the ANONYMIZATION_PROFILE processor bundle to every event from a
+ * local listener, after the rules (which are written against the original
+ * messages) and before the event leaves the collector, so privacy officers
+ * can approve a deployment without reviewing custom redaction rules.
+ * Raw stream chunks are left untouched.
+ */
+class Anonymizer {
+    private counters = { events: 0, modified: 0 };
+    private replacements: Record<ProcessorName, number> = { usernames: 0, emails: 0, ips: 0, query_strings: 0 };
+
+    public apply(event: SyslogEvent): void {
+        const processors = PROFILES[config.ANONYMIZATION_PROFILE];
+        if (processors.length === 0 || event.stream) return;
+
+        this.counters.events++;
+        let message = event.raw_message;
+        for (const processor of processors) {
+            message = this.run(processor, message);
+        }
+
+        if (message !== event.raw_message) {
+            event.raw_message = message;
+            this.counters.modified++;
+        }
+    }
+
+    public getStats(): AnonymizationStats {
+        return {
+            profile: config.ANONYMIZATION_PROFILE,
+            processors: PROFILES[config.ANONYMIZATION_PROFILE],
+            ...this.counters,
+            replacements: { ...this.replacements },
+        };
+    }
+
+    private run(processor: ProcessorName, message: string): string {
+        const count = () => this.replacements[processor]++;
+        const strict = config.ANONYMIZATION_PROFILE === 'strict';
+
+        switch (processor) {
+            case 'usernames':
+                return USERNAME_PATTERNS.reduce((text, pattern) => text.replace(pattern, (match, prefix: string, value: string) => {
+                    const quoted = value.startsWith('"');
+                    const name = quoted ? value.slice(1, -1) : value;
+                    if (name.length === 0 || SYSTEM_ACCOUNTS.has(name.toLowerCase()) || name.startsWith('user-')) return match;
+                    count();
+                    const replacement = strict ? '[USER]' : `user-${this.hash(name)}`;
+                    return prefix + (quoted ? `"${replacement}"` : replacement);
+                }), message);
+
+            case 'emails':
+                return message.replace(EMAIL, (_match, local: string, domain: string) => {
+                    count();
+                    return strict ? '[EMAIL]' : `${this.hash(local)}@${domain}`;
+                });
+
+            case 'ips':
+                return message
+                    .replace(IPV4, (match, a: string, b: string, c: string, d: string) => {
+                        if (d === '0') return match;
+                        count();
+                        return `${a}.${b}.${c}.0`;
+                    })
+                    .replace(IPV6_CANDIDATE, (match) => {
+                        if (!net.isIPv6(match)) return match;
+                        const truncated = truncateIpv6(match);
+                        if (truncated === match.toLowerCase()) return match;
+                        count();
+                        return truncated;
+                    });
+
+            case 'query_strings':
+                return message.replace(QUERY_STRING, (_match, base: string) => {
+                    count();
+                    return base;
+                });
+        }
+    }
+
+    private hash(value: string): string {
+        return createHmac('sha256', config.ANONYMIZATION_KEY ?? '').update(value.toLowerCase()).digest('hex').slice(0, 12);
+    }
+}
+
+/**
+ * Keep the first 48 bits (the site prefix): 2001:db8:85a3:8d3::1 becomes 2001:db8:85a3::
+ */
+function truncateIpv6(address: string): string {
+    const [head = '', tail = ''] = address.toLowerCase().split('::');
+    const headGroups = head ? head.split(':') : [];
+    const tailGroups = tail ? tail.split(':') : [];
+    const groups = address.includes('::')
+        ? [...headGroups, ...Array(8 - headGroups.length - tailGroups.length).fill('0'), ...tailGroups]
+        : headGroups;
+    const prefix = groups.slice(0, 3).map((group) => group.replace(/^0+(?=.)/, ''));
+    while (prefix.length > 0 && prefix[prefix.length - 1] === '0') prefix.pop();
+    return `${prefix.join(':')}::`;
+}
+
+export const anonymizer = new Anonymizer();
@@ -0,0 +1,57 @@
+import { readFileSync, unwatchFile, watchFile } from 'node:fs';
+import { config } from './config.js';
+import { log } from './logger.js';
+
+// Rotations are noticed within this delay (fs.watchFile follows the symlinks
+// Kubernetes secret volumes swap on update)
+const WATCH_INTERVAL_MS = 5000;
+
+let fileKey: string | null = null;
+
+/**
+ * The API key for backend requests: the current content of
+ * CENTINELA_API_KEY_FILE, or CENTINELA_API_KEY. Read on every request, so a
+ * rotated key is used from the next request on.
+ */
+export function apiKey(): string {
+    return fileKey ?? config.CENTINELA_API_KEY ?? '';
+}
+
+/**
+ * Read CENTINELA_API_KEY_FILE and keep watching it, for keys rotated by a
+ * Kubernetes secret or a Vault agent without restarting the collector (and
+ * losing UDP traffic meanwhile). Throws if the file can't be read at startup;
+ * a failed read later keeps the current key.
+ */
+export function watchApiKeyFile(): void {
+    const path = config.CENTINELA_API_KEY_FILE;
+    if (!path) return;
+
+    fileKey = readKey(path);
+    log.info(`🔑 API key read from ${path} (checked for rotation every ${WATCH_INTERVAL_MS / 1000}s)`);
+
+    watchFile(path, { interval: WATCH_INTERVAL_MS }, (current, previous) => {
+        if (current.mtimeMs === previous.mtimeMs && current.ino === previous.ino) return;
+
+        try {
+            const key = readKey(path);
+            if (key !== fileKey) {
+                fileKey = key;
+                log.info(`🔑 API key rotated (${path})`);
+            }
+        } catch (err) {
+            // Mid-rotation (file briefly missing or empty): the next change retries
+            log.warn(`⚠️ Cannot read ${path}, keeping the current API key: ${(err as Error).message}`);
+        }
+    });
+}
+
+export function unwatchApiKeyFile(): void {
+    if (config.CENTINELA_API_KEY_FILE) unwatchFile(config.CENTINELA_API_KEY_FILE);
+}
+
+function readKey(path: string): string {
+    const key = readFileSync(path, 'utf8').trim();
+    if (!key) throw new Error(`${path} is empty`);
+    return key;
+}
@@ -0,0 +1,343 @@
+import path from 'node:path';
+import { promisify } from 'node:util';
+import { gzip as gzipCallback } from 'node:zlib';
+import { randomBytes } from 'node:crypto';
+import { mkdir, readdir, readFile, rename, stat, unlink, writeFile } from 'node:fs/promises';
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { buildIngestPayload } from './serializers.js';
+import { OutputQueue, type OverflowPolicy } from './output-queue.js';
+import { objectUrl, putObject, S3Error, type S3Target } from './s3.js';
+import { log } from './logger.js';
+
+const gzip = promisify(gzipCallback);
+
+const TICK_MS = 1000; // Object age and retry checks
+
+export interface ArchiveStats {
+    bucket: string; // URL of the bucket (and prefix)
+    partition: 'hour' | 'day';
+    uploaded_objects: number;
+    uploaded_events: number;
+    uploaded_bytes: number; // Compressed
+    open_objects: number; // Being filled
+    open_events: number;
+    pending_objects: number; // Failed uploads waiting for a retry (spool or memory)
+    pending_bytes: number;
+    spool_dir: string | null;
+    given_up: number; // Events: retries exhausted (memory only) or spool full
+    dropped: number; // Queue full
+    queue: number;
+    queue_capacity: number;
+    overflow: OverflowPolicy;
+    responses: Record<string, number>; // HTTP status (or "error") -> count
+    last_error: string | null;
+}
+
+interface OpenObject {
+    partition: string; // dt=2024-01-15/hour=10
+    lines: string[];
+    openedAt: number;
+}
+
+interface PendingUpload {
+    key: string;
+    body: Buffer;
+    events: number;
+    attempts: number;
+    nextRetryAt: number;
+}
+
+/**
+ * S3 Archive (ARCHIVE_ENABLED)
+ *
+ * Long-term raw retention next to the backend: every forwarded event is also
+ * written (and archive_only events only, see forwarding-policy.ts), as the
+ * backend receives it (one JSON object per line), into
+ * gzip-compressed objects in an S3-compatible bucket (AWS S3, MinIO, Ceph),
+ * partitioned by receive time in the layout query engines expect:
+ *
+ *   <ARCHIVE_PREFIX>collector=<name>/dt=2024-01-15/hour=10/<name>-20240115T100512Z-<id>.ndjson.gz
+ *
+ * An object is uploaded when it holds ARCHIVE_OBJECT_MAX_EVENTS events, when
+ * it is ARCHIVE_OBJECT_MAX_AGE_MS old, or at shutdown. Like the other
+ * secondary outputs it has its own bounded queue (OutputQueue) and never
+ * touches the primary's retries, DLQ or write-ahead log. Failed uploads are
+ * spooled to ARCHIVE_SPOOL_DIR and retried with backoff until they succeed,
+ * across restarts; without a spool directory they are retried from memory
+ * MAX_RETRIES times and then given up.
+ */
+export class ArchiveSink {
+    private readonly target: S3Target;
+    private readonly queue: OutputQueue;
+    private open = new Map<string, OpenObject>();
+    private closing: Promise<void> = Promise.resolve(); // Uploads run one at a time, in order
+    private retries: PendingUpload[] = []; // Memory only (no spool directory)
+    private spoolFiles = 0;
+    private spoolBytes = 0;
+    private failures = 0; // Consecutive failed spool retries, for the backoff
+    private nextSpoolRetryAt = 0;
+    private retrying = false;
+    private timer: NodeJS.Timeout | null = null;
+
+    private uploadedObjects = 0;
+    private uploadedEvents = 0;
+    private uploadedBytes = 0;
+    private givenUp = 0;
+    private responses: Record<string, number> = {};
+    private lastError: string | null = null;
+
+    constructor() {
+        this.target = {
+            endpoint: config.ARCHIVE_S3_ENDPOINT,
+            region: config.ARCHIVE_S3_REGION,
+            bucket: config.ARCHIVE_S3_BUCKET!,
+            accessKeyId: config.ARCHIVE_S3_ACCESS_KEY_ID!,
+            secretAccessKey: config.ARCHIVE_S3_SECRET_ACCESS_KEY!,
+            sessionToken: config.ARCHIVE_S3_SESSION_TOKEN,
+            pathStyle: config.ARCHIVE_S3_PATH_STYLE,
+        };
+        this.queue = new OutputQueue('Archive', {
+            capacity: () => config.ARCHIVE_QUEUE_SIZE,
+            overflow: () => config.ARCHIVE_OVERFLOW,
+            send: (batch) => this.add(batch),
+        });
+    }
+
+    /**
+     * Offer events that are about to be sent to the primary (all of them are queued)
+     */
+    public offer(events: SyslogEvent[]): void {
+        this.queue.offer(events);
+    }
+
+    public async start(): Promise<void> {
+        if (config.ARCHIVE_SPOOL_DIR) {
+            await mkdir(config.ARCHIVE_SPOOL_DIR, { recursive: true });
+            for (const file of await this.spooled()) {
+                this.spoolFiles++;
+                this.spoolBytes += (await stat(path.join(config.ARCHIVE_SPOOL_DIR, file))).size;
+            }
+        }
+
+        log.info(`🗄️ Archiving events to ${this.bucketUrl()} (gzip NDJSON per ${config.ARCHIVE_PARTITION})` +
+            (this.spoolFiles > 0 ? `, ${this.spoolFiles} spooled objects to upload` : ''));
+        this.queue.start();
+
+        const tick = async () => {
+            this.closeExpired();
+            await this.retry();
+            this.timer = setTimeout(tick, TICK_MS);
+        };
+        this.timer = setTimeout(tick, TICK_MS);
+    }
+
+    /**
+     * Upload what is queued and open (shutdown); failures go to the spool
+     */
+    public async stop(): Promise<void> {
+        this.queue.stop();
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+        await this.queue.flush();
+        for (const object of [...this.open.values()]) this.close(object);
+        await this.closing;
+
+        const lost = this.retries.reduce((sum, retry) => sum + retry.events, 0);
+        if (lost > 0) log.warn(`   ⚠️ ${lost} events not archived (upload failed, no ARCHIVE_SPOOL_DIR)`);
+    }
+
+    public getStats(): ArchiveStats {
+        const queue = this.queue.getStats();
+        const open = [...this.open.values()];
+        return {
+            bucket: this.bucketUrl(),
+            partition: config.ARCHIVE_PARTITION,
+            uploaded_objects: this.uploadedObjects,
+            uploaded_events: this.uploadedEvents,
+            uploaded_bytes: this.uploadedBytes,
+            open_objects: open.length,
+            open_events: open.reduce((sum, object) => sum + object.lines.length, 0),
+            pending_objects: this.spoolFiles + this.retries.length,
+            pending_bytes: this.spoolBytes + this.retries.reduce((sum, retry) => sum + retry.body.length, 0),
+            spool_dir: config.ARCHIVE_SPOOL_DIR ?? null,
+            given_up: this.givenUp,
+            dropped: queue.dropped,
+            queue: queue.queued,
+            queue_capacity: config.ARCHIVE_QUEUE_SIZE,
+            overflow: queue.overflow,
+            responses: { ...this.responses },
+            last_error: this.lastError,
+        };
+    }
+
+    private bucketUrl(): string {
+        return objectUrl(this.target, config.ARCHIVE_PREFIX).href;
+    }
+
+    // OutputQueue sender: one line per event, into the object of its partition
+    private async add(batch: SyslogEvent[]): Promise<void> {
+        for (const event of batch) {
+            const partition = partitionOf(event.received_at);
+            let object = this.open.get(partition);
+            if (!object) {
+                object = { partition, lines: [], openedAt: Date.now() };
+                this.open.set(partition, object);
+            }
+            object.lines.push(JSON.stringify(buildIngestPayload(event)));
+            if (object.lines.length >= config.ARCHIVE_OBJECT_MAX_EVENTS) this.close(object);
+        }
+        // Back-pressure: the queue fills (and applies its overflow policy) while uploads lag
+        await this.closing;
+    }
+
+    private closeExpired(): void {
+        const now = Date.now();
+        for (const object of [...this.open.values()]) {
+            if (now - object.openedAt >= config.ARCHIVE_OBJECT_MAX_AGE_MS) this.close(object);
+        }
+    }
+
+    private close(object: OpenObject): void {
+        this.open.delete(object.partition);
+        const collector = safeName(config.COLLECTOR_NAME);
+        const stamp = new Date(object.openedAt).toISOString().replace(/[-:]/g, '').replace(/\.\d{3}/, '');
+        const key = `${config.ARCHIVE_PREFIX}collector=${collector}/${object.partition}/${collector}-${stamp}-${randomBytes(4).toString('hex')}.ndjson.gz`;
+
+        this.closing = this.closing.then(async () => {
+            const body = await gzip(object.lines.join('\n') + '\n');
+            try {
+                await this.upload(key, body, object.lines.length);
+            } catch (err) {
+                await this.keep(key, body, object.lines.length, err as Error);
+            }
+        }).catch((err) => {
+            this.givenUp += object.lines.length;
+            log.warn(`⚠️ Cannot archive ${object.lines.length} events: ${(err as Error).message}`);
+        });
+    }
+
+    private async upload(key: string, body: Buffer, events: number | null): Promise<void> {
+        try {
+            await putObject(this.target, key, body, { 'content-type': 'application/gzip' });
+        } catch (err) {
+            const outcome = err instanceof S3Error ? String(err.status) : 'error';
+            this.responses[outcome] = (this.responses[outcome] ?? 0) + 1;
+            if (this.lastError === null) log.warn(`⚠️ Archive upload to ${this.bucketUrl()} failed: ${(err as Error).message}`);
+            this.lastError = (err as Error).message;
+            throw err;
+        }
+
+        this.responses['200'] = (this.responses['200'] ?? 0) + 1;
+        this.uploadedObjects++;
+        this.uploadedBytes += body.length;
+        if (events !== null) this.uploadedEvents += events;
+        if (this.lastError !== null) log.info('🗄️ Archive uploads recovered');
+        this.lastError = null;
+    }
+
+    /**
+     * A failed upload: to the spool (retried until it succeeds), else to the
+     * memory retries
+     */
+    private async keep(key: string, body: Buffer, events: number, err: Error): Promise<void> {
+        if (!config.ARCHIVE_SPOOL_DIR) {
+            this.scheduleRetry({ key, body, events, attempts: 1, nextRetryAt: 0 });
+            return;
+        }
+
+        if (this.spoolBytes + body.length > config.ARCHIVE_SPOOL_MAX_BYTES) {
+            this.givenUp += events;
+            log.warn(`⚠️ Archive spool full (ARCHIVE_SPOOL_MAX_BYTES), dropping ${events} events: ${err.message}`);
+            return;
+        }
+        try {
+            // The key is the file name, so a spooled object keeps its partition across restarts
+            const file = path.join(config.ARCHIVE_SPOOL_DIR, encodeURIComponent(key));
+            await writeFile(`${file}.tmp`, body);
+            await rename(`${file}.tmp`, file);
+            this.spoolFiles++;
+            this.spoolBytes += body.length;
+        } catch (spoolErr) {
+            this.givenUp += events;
+            log.warn(`⚠️ Cannot spool an archive object, dropping ${events} events: ${(spoolErr as Error).message}`);
+        }
+    }
+
+    private scheduleRetry(retry: PendingUpload): void {
+        if (retry.attempts > config.MAX_RETRIES) {
+            this.givenUp += retry.events;
+            log.debug(`⚠️ Archive: gave up on ${retry.events} events after ${config.MAX_RETRIES} retries`);
+            return;
+        }
+        retry.nextRetryAt = Date.now() + backoff(retry.attempts);
+        this.retries.push(retry);
+    }
+
+    private async retry(): Promise<void> {
+        if (this.retrying) return;
+        this.retrying = true;
+
+        try {
+            const now = Date.now();
+            const ready = this.retries.filter((retry) => retry.nextRetryAt <= now);
+            this.retries = this.retries.filter((retry) => retry.nextRetryAt > now);
+            for (const retry of ready) {
+                try {
+                    await this.upload(retry.key, retry.body, retry.events);
+                } catch {
+                    this.scheduleRetry({ ...retry, attempts: retry.attempts + 1 });
+                }
+            }
+
+            // Spooled objects, oldest partition first; stop at the first failure
+            if (!config.ARCHIVE_SPOOL_DIR || this.spoolFiles === 0 || now < this.nextSpoolRetryAt) return;
+            for (const file of await this.spooled()) {
+                const fullPath = path.join(config.ARCHIVE_SPOOL_DIR, file);
+                const body = await readFile(fullPath);
+                try {
+                    await this.upload(decodeURIComponent(file), body, null);
+                } catch {
+                    this.failures++;
+                    this.nextSpoolRetryAt = Date.now() + backoff(this.failures);
+                    return;
+                }
+                await unlink(fullPath);
+                this.failures = 0;
+                this.spoolFiles--;
+                this.spoolBytes -= body.length;
+            }
+        } catch (err) {
+            log.warn(`⚠️ Archive spool retry failed: ${(err as Error).message}`);
+        } finally {
+            this.retrying = false;
+        }
+    }
+
+    private async spooled(): Promise<string[]> {
+        return (await readdir(config.ARCHIVE_SPOOL_DIR!)).filter((file) => !file.endsWith('.tmp')).sort();
+    }
+}
+
+/**
+ * Hive-style partition of a receive time (UTC)
+ */
+function partitionOf(receivedAt: string): string {
+    const time = new Date(receivedAt);
+    const iso = (Number.isNaN(time.getTime()) ? new Date() : time).toISOString();
+    return config.ARCHIVE_PARTITION === 'day'
+        ? `dt=${iso.slice(0, 10)}`
+        : `dt=${iso.slice(0, 10)}/hour=${iso.slice(11, 13)}`;
+}
+
+function safeName(name: string): string {
+    return name.replace(/[^A-Za-z0-9_.-]/g, '_');
+}
+
+// Exponential backoff with ±10% jitter, as for the primary
+function backoff(attempts: number): number {
+    const delay = Math.min(config.RETRY_BASE_DELAY_MS * Math.pow(2, attempts - 1), config.RETRY_MAX_DELAY_MS);
+    return Math.floor(delay + delay * 0.2 * (Math.random() - 0.5));
+}
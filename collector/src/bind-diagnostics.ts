@@ -0,0 +1,106 @@
+import { readdirSync, readFileSync, readlinkSync } from 'node:fs';
+import { log } from './logger.js';
+
+const BIND_ERRORS = new Set(['EADDRINUSE', 'EACCES', 'EADDRNOTAVAIL']);
+
+/**
+ * Whether a listener failed to start because of its address or port (as
+ * opposed to, say, an unreadable certificate)
+ */
+export function isBindError(err: unknown): err is NodeJS.ErrnoException & { address?: string; port?: number } {
+    return BIND_ERRORS.has((err as NodeJS.ErrnoException)?.code ?? '');
+}
+
+/**
+ * Log why a listener could not start. Bind failures (port in use, privileged
+ * port, unknown address) get a plain explanation and what to do about it,
+ * including which local process holds the port when it can be found.
+ */
+export function logStartError(what: string, err: unknown): void {
+    if (!isBindError(err)) {
+        log.error(`❌ Failed to start ${what}: ${(err as Error).message}`);
+        return;
+    }
+
+    // dgram reports bind(), net reports listen()
+    const transport = err.syscall === 'bind' ? 'udp' : 'tcp';
+    const where = `${transport} ${err.address ?? '*'}:${err.port ?? '?'}`;
+
+    switch (err.code) {
+        case 'EADDRINUSE': {
+            const owner = err.port !== undefined ? findPortOwner(transport, err.port) : null;
+            log.error(`❌ Failed to start ${what}: ${where} is already in use` +
+                (owner ? ` by ${owner}` : ''));
+            log.error('   Stop or reconfigure that service (e.g. a local rsyslog/syslog-ng receiving on the same port), ' +
+                'choose another port, or set a fallback port');
+            if (!owner) {
+                log.error(`   To see which process holds it: ss -${transport === 'udp' ? 'u' : 't'}lnp 'sport = :${err.port}' (as root)`);
+            }
+            break;
+        }
+        case 'EACCES':
+            log.error(`❌ Failed to start ${what}: permission denied for ${where}`);
+            if (err.port !== undefined && err.port < 1024) {
+                log.error('   Ports below 1024 need root or the CAP_NET_BIND_SERVICE capability. Either:');
+                log.error(`   - grant it to Node: sudo setcap 'cap_net_bind_service=+ep' ${process.execPath}`);
+                log.error('   - under systemd: AmbientCapabilities=CAP_NET_BIND_SERVICE in the unit');
+                log.error('   - in a container: --cap-add NET_BIND_SERVICE (or sysctl net.ipv4.ip_unprivileged_port_start)');
+                log.error('   - or listen on a port >= 1024 and redirect 514 to it (iptables/nftables REDIRECT)');
+            }
+            break;
+        case 'EADDRNOTAVAIL':
+            log.error(`❌ Failed to start ${what}: ${err.address ?? 'the bind address'} is not an address of this host (${where})`);
+            log.error('   Check the *_BIND_ADDRESS setting, or use 0.0.0.0 to listen on every interface');
+            break;
+    }
+}
+
+/**
+ * "name (pid N)" of the local process listening on a port (Linux, from
+ * /proc). Only processes we may inspect are found: all of them as root.
+ */
+function findPortOwner(transport: 'udp' | 'tcp', port: number): string | null {
+    if (process.platform !== 'linux') return null;
+
+    const inodes = new Set<string>();
+    for (const table of [`/proc/net/${transport}`, `/proc/net/${transport}6`]) {
+        let content: string;
+        try {
+            content = readFileSync(table, 'utf8');
+        } catch {
+            continue;
+        }
+
+        // sl local_address rem_address st ... inode
+        for (const line of content.split('\n').slice(1)) {
+            const fields = line.trim().split(/\s+/);
+            if (fields.length < 10) continue;
+            const localPort = parseInt(fields[1]!.split(':')[1] ?? '', 16);
+            const listening = transport === 'udp' || fields[3] === '0A'; // TCP_LISTEN
+            if (localPort === port && listening && fields[9] !== '0') inodes.add(fields[9]!);
+        }
+    }
+    if (inodes.size === 0) return null;
+
+    for (const pid of readdirSync('/proc').filter((entry) => /^\d+$/.test(entry))) {
+        let fds: string[];
+        try {
+            fds = readdirSync(`/proc/${pid}/fd`);
+        } catch {
+            continue; // Another user's process
+        }
+
+        for (const fd of fds) {
+            try {
+                const inode = /^socket:\[(\d+)\]$/.exec(readlinkSync(`/proc/${pid}/fd/${fd}`))?.[1];
+                if (inode && inodes.has(inode)) {
+                    const name = readFileSync(`/proc/${pid}/comm`, 'utf8').trim();
+                    return `${name} (pid ${pid})`;
+                }
+            } catch {
+                // Closed meanwhile
+            }
+        }
+    }
+    return null;
+}
@@ -1,53 +1,274 @@
 import { config } from './config.js';
+import { wal } from './wal.js';
+import type { Rfc5424Message } from './parsers/rfc5424.js';
+import type { Rfc3164Message } from './parsers/rfc3164.js';
+import { log } from './logger.js';
+
+/**
+ * One hop in an event's relay chain: the collector that received it,
+ * when, and from which (possibly NATed) peer address
+ */
+export interface RelayHop {
+  collector: string;
+  received_at: string;
+  peer_ip: string;
+}
+
+/**
+ * Position of a chunk within a raw TCP stream, so the backend can
+ * reassemble the original bytes by ordering chunks on offset
+ */
+export interface StreamChunk {
+  id: string; // One ID per TCP connection
+  offset: number; // Byte offset of this chunk within the stream
+  length: number; // Chunk length in bytes (before encoding)
+  encoding: 'utf8' | 'base64';
+  final: boolean; // Last chunk (connection closed)
+}
+
+/**
+ * Position of a part of a message longer than MAX_MESSAGE_BYTES (see
+ * continuation.ts), so the backend can store the parts as one message
+ */
+export interface MessageContinuation {
+  id: string; // Shared by all parts of the message
+  index: number; // 0..total-1
+  total: number;
+  truncated?: boolean; // The message didn't fit in MAX_MESSAGE_PARTS parts
+}
+
+/**
+ * TCP session lifecycle meta-event (TCP_SESSION_EVENTS).
+ * Totals are only present on disconnect.
+ */
+export interface SessionMeta {
+  type: 'tcp_session';
+  action: 'connected' | 'disconnected';
+  connected_at: string;
+  reason?: 'peer_closed' | 'idle_timeout' | 'error' | 'shutdown';
+  duration_ms?: number;
+  bytes?: number;
+  messages?: number;
+  keepalives?: number;
+}
 
 export interface SyslogEvent {
+  event_id: string; // UUIDv7 assigned at receive time
   raw_message: string;
   received_at: string;
   source_ip: string;
+  source_port?: number;
+  transport: string; // udp, tcp, ... (original transport is kept across relays)
+
+  // Set when the event was relayed by another collector (concentrator mode)
+  origin_collector?: string;
+  site_id?: string;
+  tenant_id?: string;
+  relay_hops?: RelayHop[];
+
+  // Set by the named listener that received the event (LISTENERS)
+  source_id?: string;
+
+  // Header fields parsed from RFC 5424 / RFC 3164 messages (PARSE_SYSLOG)
+  syslog?: Rfc5424Message | Rfc3164Message;
+
+  // Set for chunks of a raw TCP stream (see RawStreamServer)
+  stream?: StreamChunk;
+
+  // Set for the parts of a message split because it was too long
+  continuation?: MessageContinuation;
+
+  // Labels added by tag rules (see rules.ts)
+  tags?: Record<string, string>;
+
+  // Sender is not in ALLOWED_SOURCES (UNKNOWN_SOURCE_POLICY=greylist)
+  quarantined?: boolean;
+
+  // Set for collector-generated meta-events (not sent by the device)
+  meta?: SessionMeta;
+}
+
+/**
+ * Batch partition of an event: batches never mix tenants or sites, so each
+ * bulk request can be routed and accounted for per tenant
+ */
+export function batchPartition(event: SyslogEvent): string {
+  return `${event.tenant_id ?? config.TENANT_ID ?? ''}/${event.site_id ?? config.SITE_ID ?? ''}`;
 }
 
 /**
- * Simple in-memory FIFO buffer for log events.
- * Uses a standard array, which is sufficient for typical sidecar loads (up to ~1k ops/sec).
+ * Split items into one group per batch partition, keeping their order
+ */
+export function groupByPartition<T>(items: T[], eventOf: (item: T) => SyslogEvent): T[][] {
+  const groups = new Map<string, T[]>();
+  for (const item of items) {
+    const key = batchPartition(eventOf(item));
+    const group = groups.get(key);
+    if (group) {
+      group.push(item);
+    } else {
+      groups.set(key, [item]);
+    }
+  }
+  return [...groups.values()];
+}
+
+/**
+ * Simple in-memory FIFO buffer for log events, one queue per batch partition.
+ * Uses standard arrays, which is sufficient for typical sidecar loads (up to ~1k ops/sec).
  * For extremely high throughput, a RingBuffer or LinkedList implementation would be preferred.
+ *
+ * With BUFFER_SPILL_HIGH_WATER (and the write-ahead log), the buffer is a
+ * hybrid queue: above the high-water mark new events are written to disk only
+ * and stay there, in order, until the buffer drains below
+ * BUFFER_SPILL_LOW_WATER and refill() reads them back. Normal traffic never
+ * waits on the disk; bursts and slow backends cost disk space, not memory or
+ * drops.
  */
 export class MessageBuffer {
-  private queue: SyslogEvent[] = [];
+  private partitions = new Map<string, SyslogEvent[]>();
+  private count = 0;
   private droppedCount = 0;
+  private spilling = false;
+  private spilledCount = 0;
 
   /**
-   * Add an event to the buffer.
-   * Drops the event if the buffer is full (Tail Drop).
+   * Add an event to the buffer (and the write-ahead log, if enabled).
+   * Spills it to disk above the high-water mark; drops it if the buffer is
+   * full (Tail Drop).
    */
   public push(event: SyslogEvent): boolean {
-    if (this.queue.length >= config.MAX_BUFFER_SIZE) {
+    // Once spilling, everything goes to disk until the backlog is read back (keeps the order)
+    if (config.BUFFER_SPILL_HIGH_WATER !== undefined && (this.spilling || this.count >= config.BUFFER_SPILL_HIGH_WATER)) {
+      if (wal.spill(event)) {
+        if (!this.spilling) {
+          log.warn(`💾 Buffer above ${config.BUFFER_SPILL_HIGH_WATER} events, spilling new events to disk`);
+        }
+        this.spilling = true;
+        this.spilledCount++;
+        return true;
+      }
+    }
+
+    if (this.count >= config.MAX_BUFFER_SIZE) {
       this.droppedCount++;
       return false;
     }
-    this.queue.push(event);
+    wal.append(event);
+    this.insert(event);
     return true;
   }
 
   /**
-   * Remove and return a batch of events from the start of the queue.
+   * Read spilled events back from disk once the buffer is at or below the
+   * low-water mark, up to the high-water mark. Returns how many came back.
+   */
+  public async refill(): Promise<number> {
+    const highWater = config.BUFFER_SPILL_HIGH_WATER;
+    if (!this.spilling || highWater === undefined) return 0;
+
+    const lowWater = config.BUFFER_SPILL_LOW_WATER ?? Math.floor(highWater / 2);
+    if (this.count > lowWater) return 0;
+
+    let restored = 0;
+    while (this.count < highWater && wal.hasSpilled) {
+      const events = await wal.takeSpilled(highWater - this.count);
+      if (events.length === 0) break;
+      events.forEach((event) => this.insert(event));
+      restored += events.length;
+    }
+
+    if (!wal.hasSpilled) {
+      this.spilling = false;
+      log.info('✅ Buffer caught up with the events spilled to disk');
+    }
+    return restored;
+  }
+
+  private insert(event: SyslogEvent): void {
+    const key = batchPartition(event);
+    const queue = this.partitions.get(key);
+    if (queue) {
+      queue.push(event);
+    } else {
+      this.partitions.set(key, [event]);
+    }
+    this.count++;
+  }
+
+  /**
+   * Remove and return up to `size` events of one partition, taking
+   * partitions in turn. With `fullOnly`, only a partition with at least
+   * `size` events qualifies (size-based flush); otherwise partial batches
+   * are returned too (time-based flush).
+   */
+  public popBatch(size: number, fullOnly = false): SyslogEvent[] {
+    for (const [key, queue] of this.partitions) {
+      if (fullOnly && queue.length < size) continue;
+
+      // splice removes elements from index 0
+      const batch = queue.splice(0, size);
+      this.partitions.delete(key);
+      if (queue.length > 0) this.partitions.set(key, queue); // Back of the line
+      this.count -= batch.length;
+      return batch;
+    }
+    return [];
+  }
+
+  /**
+   * Remove and return every buffered event (all partitions)
    */
-  public popBatch(size: number): SyslogEvent[] {
-    if (this.queue.length === 0) return [];
+  public popAll(): SyslogEvent[] {
+    const events = [...this.partitions.values()].flat();
+    this.partitions.clear();
+    this.count = 0;
+    return events;
+  }
 
-    // splice removes elements from index 0
-    const batchSize = Math.min(size, this.queue.length);
-    return this.queue.splice(0, batchSize);
+  /**
+   * Whether some partition has at least `size` events waiting
+   */
+  public hasFullBatch(size: number): boolean {
+    for (const queue of this.partitions.values()) {
+      if (queue.length >= size) return true;
+    }
+    return false;
+  }
+
+  /**
+   * Buffered events per partition
+   */
+  public partitionSizes(): Record<string, number> {
+    return Object.fromEntries([...this.partitions].map(([key, queue]) => [key, queue.length]));
   }
 
   public get size(): number {
-    return this.queue.length;
+    return this.count;
+  }
+
+  /**
+   * Number of events that can still be accepted before tail drop
+   */
+  public get available(): number {
+    if (config.BUFFER_SPILL_HIGH_WATER !== undefined && wal.enabled && !wal.isFull) {
+      return Number.POSITIVE_INFINITY; // Spills to disk (until WAL_MAX_BYTES)
+    }
+    return Math.max(0, config.MAX_BUFFER_SIZE - this.count);
   }
 
   public get dropped(): number {
     return this.droppedCount;
   }
 
+  /**
+   * Events written to disk instead of memory since startup
+   */
+  public get spilled(): number {
+    return this.spilledCount;
+  }
+
   public isEmpty(): boolean {
-    return this.queue.length === 0;
+    return this.count === 0;
   }
 }
@@ -0,0 +1,106 @@
+import { constants, createCipheriv, createDecipheriv, privateDecrypt, publicEncrypt, randomBytes, scryptSync } from 'node:crypto';
+
+/**
+ * Support bundle file format (no configuration needed, so support staff can
+ * decrypt a bundle with `collector support-bundle decrypt` anywhere).
+ *
+ * The bundle is a gzipped tar, encrypted with AES-256-GCM under a random key:
+ *   "CSB1" | 1 | key length (uint16) | key wrapped with RSA-OAEP (SHA-256) | iv | tag | ciphertext
+ * or, with a passphrase instead of a public key (key from scrypt):
+ *   "CSB1" | 2 | salt (16) | iv | tag | ciphertext
+ */
+
+const MAGIC = Buffer.from('CSB1');
+const MODE_PUBLIC_KEY = 1;
+const MODE_PASSPHRASE = 2;
+const IV_BYTES = 12;
+const TAG_BYTES = 16;
+const SALT_BYTES = 16;
+const BLOCK = 512;
+
+export type BundleKey = { publicKey: string } | { passphrase: string };
+export type BundleSecret = { privateKey: string } | { passphrase: string };
+
+export interface ArchiveEntry {
+    name: string;
+    data: Buffer;
+}
+
+/**
+ * POSIX ustar archive of regular files (names up to 100 bytes)
+ */
+export function tarArchive(entries: ArchiveEntry[], mtime = new Date()): Buffer {
+    const blocks: Buffer[] = [];
+    for (const entry of entries) {
+        const header = Buffer.alloc(BLOCK);
+        header.write(entry.name.slice(0, 100), 0, 'utf8');
+        header.write('0000600\0', 100); // mode
+        header.write('0000000\0', 108); // uid
+        header.write('0000000\0', 116); // gid
+        header.write(`${entry.data.length.toString(8).padStart(11, '0')}\0`, 124);
+        header.write(`${Math.floor(mtime.getTime() / 1000).toString(8).padStart(11, '0')}\0`, 136);
+        header.write('        ', 148); // checksum, counted as spaces
+        header.write('0', 156); // regular file
+        header.write('ustar\0' + '00', 257);
+        let checksum = 0;
+        for (const byte of header) checksum += byte;
+        header.write(`${checksum.toString(8).padStart(6, '0')}\0 `, 148);
+
+        blocks.push(header, entry.data, Buffer.alloc((BLOCK - (entry.data.length % BLOCK)) % BLOCK));
+    }
+    blocks.push(Buffer.alloc(BLOCK * 2)); // End of archive
+    return Buffer.concat(blocks);
+}
+
+export function encryptBundle(data: Buffer, key: BundleKey): Buffer {
+    const dataKey = 'publicKey' in key ? randomBytes(32) : null;
+    const salt = 'passphrase' in key ? randomBytes(SALT_BYTES) : null;
+    const aesKey = dataKey ?? scryptSync((key as { passphrase: string }).passphrase, salt!, 32);
+
+    const iv = randomBytes(IV_BYTES);
+    const cipher = createCipheriv('aes-256-gcm', aesKey, iv);
+    const ciphertext = Buffer.concat([cipher.update(data), cipher.final()]);
+
+    let header: Buffer;
+    if (dataKey) {
+        const wrapped = publicEncrypt({ key: (key as { publicKey: string }).publicKey, padding: constants.RSA_PKCS1_OAEP_PADDING, oaepHash: 'sha256' }, dataKey);
+        const length = Buffer.alloc(2);
+        length.writeUInt16BE(wrapped.length);
+        header = Buffer.concat([MAGIC, Buffer.from([MODE_PUBLIC_KEY]), length, wrapped]);
+    } else {
+        header = Buffer.concat([MAGIC, Buffer.from([MODE_PASSPHRASE]), salt!]);
+    }
+    return Buffer.concat([header, iv, cipher.getAuthTag(), ciphertext]);
+}
+
+/**
+ * Decrypt a bundle; throws on a wrong key or passphrase, or a damaged file
+ */
+export function decryptBundle(bundle: Buffer, secret: BundleSecret): Buffer {
+    if (bundle.length < MAGIC.length + 1 || !bundle.subarray(0, MAGIC.length).equals(MAGIC)) {
+        throw new Error('not a collector support bundle');
+    }
+
+    const mode = bundle[MAGIC.length];
+    let offset = MAGIC.length + 1;
+    let aesKey: Buffer;
+    if (mode === MODE_PUBLIC_KEY) {
+        if (!('privateKey' in secret)) throw new Error('this bundle was encrypted with a public key: pass the private key');
+        const length = bundle.readUInt16BE(offset);
+        offset += 2;
+        aesKey = privateDecrypt({ key: secret.privateKey, padding: constants.RSA_PKCS1_OAEP_PADDING, oaepHash: 'sha256' }, bundle.subarray(offset, offset + length));
+        offset += length;
+    } else if (mode === MODE_PASSPHRASE) {
+        if (!('passphrase' in secret)) throw new Error('this bundle was encrypted with a passphrase: pass it');
+        aesKey = scryptSync(secret.passphrase, bundle.subarray(offset, offset + SALT_BYTES), 32);
+        offset += SALT_BYTES;
+    } else {
+        throw new Error(`unknown bundle encryption mode ${mode}`);
+    }
+
+    const iv = bundle.subarray(offset, offset + IV_BYTES);
+    const tag = bundle.subarray(offset + IV_BYTES, offset + IV_BYTES + TAG_BYTES);
+    const decipher = createDecipheriv('aes-256-gcm', aesKey, iv);
+    decipher.setAuthTag(tag);
+    return Buffer.concat([decipher.update(bundle.subarray(offset + IV_BYTES + TAG_BYTES)), decipher.final()]);
+}
@@ -0,0 +1,54 @@
+import net from 'node:net';
+
+/**
+ * Normalize a socket address: IPv4-mapped IPv6 (::ffff:10.0.0.1) becomes plain IPv4
+ */
+export function normalizeIp(address: string): string {
+    return address.startsWith('::ffff:') && net.isIPv4(address.slice(7)) ? address.slice(7) : address;
+}
+
+/**
+ * Check that an entry is an IP address or CIDR range (v4 or v6)
+ */
+export function isValidCidr(entry: string): boolean {
+    const [address, prefix] = entry.split('/');
+    const family = net.isIP(address ?? '');
+    if (family === 0) return false;
+    if (prefix === undefined) return true;
+    const bits = Number(prefix);
+    return Number.isInteger(bits) && bits >= 0 && bits <= (family === 4 ? 32 : 128);
+}
+
+/**
+ * A set of IP addresses / CIDR ranges backed by net.BlockList
+ */
+export class CidrList {
+    private list = new net.BlockList();
+    public readonly entries: string[];
+
+    constructor(entries: string[]) {
+        this.entries = entries;
+
+        for (const entry of entries) {
+            const [address, prefix] = entry.split('/');
+            const type = net.isIPv6(address!) ? 'ipv6' : 'ipv4';
+
+            if (prefix === undefined) {
+                this.list.addAddress(address!, type);
+            } else {
+                this.list.addSubnet(address!, Number(prefix), type);
+            }
+        }
+    }
+
+    public get isEmpty(): boolean {
+        return this.entries.length === 0;
+    }
+
+    public contains(address: string): boolean {
+        const ip = normalizeIp(address);
+        const type = net.isIPv6(ip) ? 'ipv6' : 'ipv4';
+        if (net.isIP(ip) === 0) return false;
+        return this.list.check(ip, type);
+    }
+}
@@ -0,0 +1,136 @@
+import { config } from './config.js';
+import { log } from './logger.js';
+
+const PROBE_TIMEOUT_MS = 35000; // Longer than a bulk request (30s): a probe that never reported back is given up
+
+export type CircuitState = 'closed' | 'open' | 'half_open';
+
+export interface CircuitBreakerStats {
+    enabled: boolean;
+    state: CircuitState;
+    consecutive_failures: number;
+    opened_at: string | null;
+    probe_at: string | null; // When the next probe may go out (open)
+    opens: number;
+    held_events: number; // Routed to the disk spool instead of sent, since startup
+    last_error: string | null;
+}
+
+/**
+ * Thrown instead of sending while the circuit is open (nothing reached the backend)
+ */
+export class CircuitOpenError extends Error {
+    constructor() {
+        super('Circuit open: backend unavailable');
+    }
+}
+
+/**
+ * Backend Circuit Breaker
+ *
+ * During an outage every batch would otherwise go through the whole retry
+ * ladder (MAX_RETRIES requests each, all failing). After
+ * CIRCUIT_BREAKER_THRESHOLD consecutive failures (network errors, 5xx, on
+ * any endpoint) the circuit opens: nothing is sent and the transport routes
+ * events to the disk spool. After CIRCUIT_BREAKER_OPEN_MS it is half-open:
+ * one request at a time goes out as a probe (the next batch); a success
+ * closes the circuit and the spool is replayed at the drain pace, a failure
+ * opens it again. Any answer below 500 counts as a success: the backend is
+ * up, even if it refused the request.
+ */
+export class CircuitBreaker {
+    private state: CircuitState = 'closed';
+    private failures = 0;
+    private openedAt: number | null = null;
+    private probeAt = 0;
+    private probeStartedAt: number | null = null;
+    private opens = 0;
+    private held = 0;
+    private lastError: string | null = null;
+
+    public get enabled(): boolean {
+        return config.CIRCUIT_BREAKER_THRESHOLD > 0;
+    }
+
+    /**
+     * Open and not yet due for a probe: nothing may be sent
+     */
+    public get isOpen(): boolean {
+        return this.enabled && this.state === 'open' && Date.now() < this.probeAt;
+    }
+
+    /**
+     * Whether a request may go out now. Half-open, only one at a time does
+     * (the probe) until it reports back.
+     */
+    public tryAcquire(): boolean {
+        if (this.state === 'closed' || !this.enabled) return true;
+        const now = Date.now();
+        if (this.state === 'open') {
+            if (now < this.probeAt) return false;
+            this.state = 'half_open';
+            log.info('🔌 Circuit half-open: probing the backend');
+        }
+        if (this.probeStartedAt !== null && now - this.probeStartedAt < PROBE_TIMEOUT_MS) return false;
+        this.probeStartedAt = now;
+        return true;
+    }
+
+    public recordSuccess(): void {
+        this.failures = 0;
+        this.probeStartedAt = null;
+        if (this.state === 'closed') return;
+
+        log.info(`✅ Circuit closed: backend answered after ${Math.round((Date.now() - this.openedAt!) / 1000)}s, replaying spooled events`);
+        this.state = 'closed';
+        this.openedAt = null;
+    }
+
+    public recordFailure(error: string): void {
+        this.failures++;
+        this.lastError = error;
+        this.probeStartedAt = null;
+        if (!this.enabled) return;
+
+        if (this.state === 'half_open') {
+            this.state = 'open';
+            this.probeAt = Date.now() + config.CIRCUIT_BREAKER_OPEN_MS;
+            log.debug(`🔌 Circuit probe failed (${error}), open for ${config.CIRCUIT_BREAKER_OPEN_MS}ms more`);
+        } else if (this.state === 'closed' && this.failures >= config.CIRCUIT_BREAKER_THRESHOLD) {
+            this.state = 'open';
+            this.openedAt = Date.now();
+            this.probeAt = this.openedAt + config.CIRCUIT_BREAKER_OPEN_MS;
+            this.opens++;
+            log.warn(`🔌 Circuit open after ${this.failures} consecutive failures (${error}): ` +
+                `spooling events to disk, probing the backend every ${config.CIRCUIT_BREAKER_OPEN_MS / 1000}s`,
+            { consecutive_failures: this.failures });
+        }
+    }
+
+    /**
+     * Count events routed to the spool (or held back) instead of sent
+     */
+    public recordHeld(count: number): void {
+        this.held += count;
+    }
+
+    /**
+     * Time until the next probe may go out (0 unless open)
+     */
+    public retryDelayMs(): number {
+        return this.state === 'open' ? Math.max(0, this.probeAt - Date.now()) : 0;
+    }
+
+    public getStats(): CircuitBreakerStats {
+        return {
+            enabled: this.enabled,
+            state: this.state,
+            consecutive_failures: this.failures,
+            opened_at: this.openedAt ? new Date(this.openedAt).toISOString() : null,
+            probe_at: this.state === 'open' ? new Date(this.probeAt).toISOString() : null,
+            opens: this.opens,
+            held_events: this.held,
+            last_error: this.lastError,
+        };
+    }
+}
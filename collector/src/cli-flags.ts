@@ -0,0 +1,61 @@
+/**
+ * Configuration flags on the command line
+ *
+ * Every configuration variable can also be given as a flag of the service:
+ * --udp-port 5514 sets UDP_PORT, --tls-enabled sets TLS_ENABLED=true and
+ * --config-file points at CONFIG_FILE. Flags take precedence over the
+ * environment and CONFIG_FILE, and stay in effect on reload. Unknown flags
+ * are reported by resolveConfig like any other configuration error.
+ *
+ * Kept free of imports so the entry point can record flags before the
+ * configuration is loaded.
+ */
+const flags: Record<string, string> = {};
+
+/** "UDP_PORT" -> "--udp-port" */
+export function flagName(key: string): string {
+  return `--${key.toLowerCase().replaceAll('_', '-')}`;
+}
+
+/**
+ * Parse "--udp-port 5514 --tls-enabled --tenant-id=acme" into configuration
+ * keys. A flag without a value is "true"; --no-<flag> is "false". Throws on
+ * anything that isn't a flag.
+ */
+export function parseConfigFlags(args: string[]): Record<string, string> {
+  const values: Record<string, string> = {};
+  for (let i = 0; i < args.length; i++) {
+    const arg = args[i]!;
+    const match = /^--([a-z0-9][a-z0-9-]*)(?:=(.*))?$/s.exec(arg);
+    if (!match) {
+      throw new Error(`Unexpected argument "${arg}": expected --<setting> <value> (e.g. --udp-port 5514)`);
+    }
+
+    let name = match[1]!;
+    let value = match[2];
+    if (value === undefined) {
+      const next = args[i + 1];
+      if (name.startsWith('no-')) {
+        name = name.slice(3);
+        value = 'false';
+      } else if (next !== undefined && !next.startsWith('--')) {
+        value = next;
+        i++;
+      } else {
+        value = 'true';
+      }
+    }
+    values[name.toUpperCase().replaceAll('-', '_')] = value;
+  }
+  return values;
+}
+
+/** Record the flags the service was started with (before the configuration is loaded) */
+export function setConfigFlags(values: Record<string, string>): void {
+  Object.assign(flags, values);
+}
+
+/** Configuration values given as flags, by key */
+export function configFlags(): Readonly<Record<string, string>> {
+  return flags;
+}
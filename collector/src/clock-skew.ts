@@ -0,0 +1,165 @@
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { log } from './logger.js';
+import { eventContext, eventLogFields } from './event-context.js';
+
+const MAX_TRACKED_SOURCES = 10000;
+const REALERT_INTERVAL_MS = 24 * 60 * 60 * 1000; // A source still skewed a day later is reported again
+
+export interface ClockSkewStats {
+    policy: 'off' | 'flag' | 'clamp';
+    max_future_ms: number;
+    max_past_ms: number;
+    future: number; // Events
+    past: number;
+    sources: number; // Skewed sources tracked
+}
+
+export interface SkewedSource {
+    source_ip: string;
+    hostname?: string;
+    direction: 'future' | 'past';
+    last_skew_ms: number; // Device time minus receive time
+    last_device_timestamp: string;
+    events: number;
+    first_seen: string;
+    last_seen: string;
+}
+
+interface SourceState {
+    hostname?: string;
+    direction: 'future' | 'past';
+    lastSkewMs: number;
+    lastDeviceTimestamp: string;
+    events: number;
+    firstSeen: number;
+    lastSeen: number;
+    alertedAt: number;
+}
+
+/**
+ * Timestamp Sanity Check (clock skew)
+ *
+ * Devices with a dead CMOS battery or no NTP log with timestamps years off
+ * (1970, 2000, the far future), which breaks time-based queries in the
+ * backend. An event whose parsed timestamp is more than CLOCK_SKEW_MAX_FUTURE_MS
+ * ahead of, or CLOCK_SKEW_MAX_PAST_MS behind, its receive time is:
+ * - flag: tagged clock_skew=future|past and clock_skew_ms
+ * - clamp: tagged as well, and its timestamp replaced by the receive time (the
+ *   device's is kept in the device_timestamp tag)
+ *
+ * The first skewed event of each source (and again daily while it lasts)
+ * raises a misconfiguration alert: a warning in the log and an event for the
+ * backend, so the device owner can fix its clock.
+ */
+class ClockSkewCheck {
+    private sources = new Map<string, SourceState>();
+    private counts = { future: 0, past: 0 };
+
+    /**
+     * Check an event's timestamp (after header parsing) and flag or clamp it.
+     * Returns an alert event to ingest when its source needs reporting.
+     */
+    public apply(event: SyslogEvent): SyslogEvent | null {
+        const policy = config.CLOCK_SKEW_POLICY;
+        const deviceTimestamp = event.syslog?.timestamp;
+        if (policy === 'off' || !deviceTimestamp) return null;
+
+        const deviceTime = Date.parse(deviceTimestamp);
+        const receivedAt = Date.parse(event.received_at);
+        if (Number.isNaN(deviceTime) || Number.isNaN(receivedAt)) return null;
+
+        const skewMs = deviceTime - receivedAt;
+        let direction: 'future' | 'past';
+        if (skewMs > config.CLOCK_SKEW_MAX_FUTURE_MS) {
+            direction = 'future';
+        } else if (-skewMs > config.CLOCK_SKEW_MAX_PAST_MS) {
+            direction = 'past';
+        } else {
+            return null;
+        }
+
+        this.counts[direction]++;
+        event.tags = { ...event.tags, clock_skew: direction, clock_skew_ms: String(skewMs) };
+        if (policy === 'clamp') {
+            event.tags.device_timestamp = deviceTimestamp;
+            event.syslog!.timestamp = event.received_at;
+        }
+
+        return this.track(event, direction, skewMs, deviceTimestamp);
+    }
+
+    public getStats(): ClockSkewStats {
+        return {
+            policy: config.CLOCK_SKEW_POLICY,
+            max_future_ms: config.CLOCK_SKEW_MAX_FUTURE_MS,
+            max_past_ms: config.CLOCK_SKEW_MAX_PAST_MS,
+            ...this.counts,
+            sources: this.sources.size,
+        };
+    }
+
+    /**
+     * Sources whose clock is off, most recent first
+     */
+    public getSources(): SkewedSource[] {
+        return [...this.sources.entries()]
+            .sort(([, a], [, b]) => b.lastSeen - a.lastSeen)
+            .map(([ip, state]) => ({
+                source_ip: ip,
+                hostname: state.hostname,
+                direction: state.direction,
+                last_skew_ms: state.lastSkewMs,
+                last_device_timestamp: state.lastDeviceTimestamp,
+                events: state.events,
+                first_seen: new Date(state.firstSeen).toISOString(),
+                last_seen: new Date(state.lastSeen).toISOString(),
+            }));
+    }
+
+    private track(event: SyslogEvent, direction: 'future' | 'past', skewMs: number, deviceTimestamp: string): SyslogEvent | null {
+        const now = Date.now();
+        let state = this.sources.get(event.source_ip);
+        if (!state) {
+            if (this.sources.size >= MAX_TRACKED_SOURCES) return null;
+            state = { direction, lastSkewMs: skewMs, lastDeviceTimestamp: deviceTimestamp, events: 0, firstSeen: now, lastSeen: now, alertedAt: 0 };
+            this.sources.set(event.source_ip, state);
+        }
+
+        state.hostname = event.syslog?.hostname ?? state.hostname;
+        state.direction = direction;
+        state.lastSkewMs = skewMs;
+        state.lastDeviceTimestamp = deviceTimestamp;
+        state.events++;
+        state.lastSeen = now;
+
+        if (now - state.alertedAt < REALERT_INTERVAL_MS) return null;
+        state.alertedAt = now;
+
+        const days = Math.round(Math.abs(skewMs) / 86400000 * 10) / 10;
+        log.warn(
+            `🕰️ CLOCK SKEW: ${event.source_ip}${state.hostname ? ` (${state.hostname})` : ''} logs ${deviceTimestamp}, ` +
+            `${days} days in the ${direction}. Check its clock/NTP; events are ${config.CLOCK_SKEW_POLICY === 'clamp' ? 'clamped' : 'flagged'}.`,
+            eventLogFields(event),
+        );
+
+        const alert = createSyslogEvent(JSON.stringify({
+            event: 'collector.clock_skew',
+            severity: 'medium',
+            source_ip: event.source_ip,
+            hostname: state.hostname,
+            direction,
+            skew_ms: skewMs,
+            device_timestamp: deviceTimestamp,
+            received_at: event.received_at,
+            trace_id: eventContext(event).traceId,
+            policy: config.CLOCK_SKEW_POLICY,
+        }), { address: '127.0.0.1' }, 'internal');
+        alert.tags = { clock_skew_alert: 'true' };
+        return alert;
+    }
+}
+
+// Singleton instance
+export const clockSkew = new ClockSkewCheck();
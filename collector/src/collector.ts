@@ -0,0 +1,1131 @@
+import { config, loadConfig, resolveConfig } from './config.js';
+import { diffConfig, formatDiff, sanitizeConfig } from './config-diff.js';
+import { MessageBuffer } from './buffer.js';
+import { HttpTransport } from './transport.js';
+import { TcpServer } from './tcp-server.js';
+import { RelayServer } from './relay-server.js';
+import { WefServer } from './wef-server.js';
+import { HttpPushServer } from './http-push-server.js';
+import { FilePickup } from './file-pickup.js';
+import { ModbusListener } from './ot/modbus.js';
+import { OpcUaEventReceiver } from './ot/opcua.js';
+import { Honeypot } from './honeypot.js';
+import { DnsInput } from './dns-input.js';
+import { KmsgInput } from './kmsg-input.js';
+import { WinlogInput } from './winlog-input.js';
+import { JournaldInput } from './journald-input.js';
+import { KafkaInput } from './kafka-input.js';
+import { FileTail } from './file-tail.js';
+import { SimulationInput } from './simulation.js';
+import { NetworkDiscovery } from './discovery.js';
+import { RawStreamServer } from './raw-stream-server.js';
+import { ingestEvent } from './pipeline.js';
+import { ControlChannel } from './control-channel.js';
+import { ShadowForwarder } from './shadow.js';
+import { DualWriteForwarder } from './dual-write.js';
+import { OtlpLogsExporter } from './otlp-logs.js';
+import { ArchiveSink } from './archive.js';
+import { MdnsAdvertiser, SERVICE_TYPES, type AdvertisedService } from './mdns.js';
+import { HealthServer } from './health-server.js';
+import { MetricsReporter } from './metrics-reporter.js';
+import { metrics } from './metrics.js';
+import { createSyslogEvent } from './events.js';
+import { DrainController } from './drain.js';
+import { maintenance } from './maintenance.js';
+import { tokenVault } from './token-vault.js';
+import { wal } from './wal.js';
+import { stateDir } from './state-dir.js';
+import { deadLetterFile } from './dead-letter.js';
+import { sourceMap } from './source-map.js';
+import { parserOverrides } from './parser-overrides.js';
+import { multilineRules } from './multiline.js';
+import { forwardingPolicy } from './forwarding-policy.js';
+import { sourceRateLimit } from './source-rate-limit.js';
+import { tracer } from './tracing.js';
+import { loadBackendTls } from './http-client.js';
+import { unwatchApiKeyFile, watchApiKeyFile } from './api-key.js';
+import { ForwardPool } from './forward-pool.js';
+import { UdpDropMonitor } from './udp-stats.js';
+import { UdpListener } from './udp-listener.js';
+import { NamedListeners } from './named-listeners.js';
+import { ListenerAcl } from './listener-acl.js';
+import { NetworkWatcher } from './network-watch.js';
+import { logStartError } from './bind-diagnostics.js';
+import { COLLECTOR_VERSION } from './identity.js';
+import { configureLogger, log } from './logger.js';
+import { leakWatchdog, WATCHDOG_RESTART_EXIT_CODE } from './leak-watchdog.js';
+import { systemdNotify } from './systemd-notify.js';
+import { supportBundles } from './support-bundle.js';
+
+const TCP_SHUTDOWN_GRACE_MS = 2000; // Longest wait for TCP senders to deliver what they already sent
+const SHUTDOWN_EXIT_MARGIN_MS = 5000; // After SHUTDOWN_TIMEOUT_MS, for persisting what's left (WAL, spool)
+const FLUSH_LOOP_STALL_MS = 60000; // Main loop not run for this long: hung, systemd watchdog pings stop
+
+/**
+ * Run the collector service (listeners, forwarding loops, health server).
+ * Loads the configuration first; throws ConfigError if it is invalid.
+ */
+export async function runCollector(): Promise<void> {
+  loadConfig();
+  configureLogger();
+  log.info(`🚀 Centinela Smart Collector v${COLLECTOR_VERSION} starting...`);
+  log.info(`   Mode: ${config.NODE_ENV}`);
+  if (config.OUTPUT_TYPE === 'kafka') {
+    log.info(`   Target: kafka://${config.KAFKA_BROKERS.join(',')}/${config.KAFKA_TOPIC}`);
+  } else if (config.OUTPUT_TYPE === 'grpc') {
+    log.info(`   Target: gRPC stream to ${config.GRPC_URL ?? new URL(config.CENTINELA_API_URL).origin}`);
+  } else {
+    log.info(`   Target: ${config.CENTINELA_API_URL}${config.CENTINELA_API_REGION ? ` (${config.CENTINELA_API_REGION})` : ''}`);
+  }
+  if (config.DATA_RESIDENCY_REGIONS.length > 0) {
+    log.info(`   Residency: ${config.DATA_RESIDENCY_REGIONS.join(', ')}`);
+  }
+  log.info(`   Collector: ${config.COLLECTOR_NAME}`);
+  if (config.COLLECTOR_PROFILE !== 'none') {
+    log.info(`   Profile: ${config.COLLECTOR_PROFILE}`);
+  }
+
+  // Core Components
+  const buffer = new MessageBuffer();
+  const transport = new HttpTransport();
+  const drain = new DrainController();
+
+  // Bounded pool of forwarding workers, fed by the flush loop (dispatch)
+  const forwardPool = new ForwardPool(async (batch) => {
+    const start = Date.now();
+    try {
+      await transport.sendBatch(batch);
+      const duration = Date.now() - start;
+
+      if (log.enabled('debug')) {
+        const retryStats = transport.getRetryStats();
+        log.debug(
+          `📤 Sent ${batch.length} events in ${duration}ms. ` +
+          `Buffer: ${buffer.size}, Retries: ${retryStats.pending}, DLQ: ${retryStats.dlq}`
+        );
+      }
+    } catch (err) {
+      log.error(`❌ Flush error: ${(err as Error).message}`);
+    }
+  }, () => dispatch(false));
+
+  // Optional: TCP Server
+  let tcpServer: TcpServer | null = null;
+  if (config.TCP_ENABLED) {
+    tcpServer = new TcpServer(buffer);
+  }
+
+  // Optional: Syslog over TLS
+  let tlsServer: TcpServer | null = null;
+  if (config.TLS_ENABLED) {
+    tlsServer = new TcpServer(buffer, 'tls');
+  }
+
+  // Optional: Raw TCP stream listener
+  let rawStreamServer: RawStreamServer | null = null;
+  if (config.RAW_TCP_ENABLED) {
+    rawStreamServer = new RawStreamServer(buffer);
+  }
+
+  // Optional: UDP Server
+  let udpListener: UdpListener | null = null;
+  let udpMonitor: UdpDropMonitor | null = null;
+  let udpPort = config.UDP_PORT; // UDP_FALLBACK_PORT if that is where it ended up
+  if (config.UDP_ENABLED) {
+    const udpAcl = new ListenerAcl('udp', config.UDP_ALLOWED_SOURCES, config.UDP_DENIED_SOURCES);
+    udpListener = new UdpListener({
+      label: 'UDP',
+      port: config.UDP_PORT,
+      fallbackPort: config.UDP_FALLBACK_PORT,
+      bindAddress: config.UDP_BIND_ADDRESS,
+      readers: config.UDP_READERS,
+      recvBufferSize: config.UDP_RCVBUF_BYTES,
+      onMessage: (msg, rinfo) => {
+        udpMonitor?.recordDatagram();
+        if (!udpAcl.admits(rinfo.address)) return;
+        ingestEvent(buffer, createSyslogEvent(msg.toString('utf8'), rinfo, 'udp'));
+      },
+      onListening: (port, sockets) => {
+        udpPort = port;
+        udpMonitor?.stop();
+        udpMonitor = new UdpDropMonitor(port, sockets);
+        udpMonitor.start();
+      },
+    });
+  }
+
+  // Optional: named listeners (LISTENERS), e.g. one port per customer site; changed at runtime on reload
+  const namedListeners = new NamedListeners(buffer);
+
+  // Optional: Relay ingest for edge collectors (concentrator mode)
+  let relayServer: RelayServer | null = null;
+  if (config.RELAY_ENABLED) {
+    relayServer = new RelayServer(buffer);
+  }
+
+  // Optional: Windows Event Forwarding (WEC) listener
+  let wefServer: WefServer | null = null;
+  if (config.WEF_ENABLED) {
+    wefServer = new WefServer(buffer);
+  }
+
+  // Optional: HTTP push input for cloud log delivery
+  let httpPushServer: HttpPushServer | null = null;
+  if (config.HTTP_PUSH_ENABLED) {
+    httpPushServer = new HttpPushServer(buffer);
+  }
+
+  // Optional: OT listeners (Modbus TCP, OPC UA events from gateways)
+  let modbusListener: ModbusListener | null = null;
+  if (config.OT_MODBUS_ENABLED) {
+    modbusListener = new ModbusListener(buffer);
+  }
+  let opcUaReceiver: OpcUaEventReceiver | null = null;
+  if (config.OT_OPCUA_ENABLED) {
+    opcUaReceiver = new OpcUaEventReceiver(buffer);
+  }
+
+  // Optional: Honeypot decoys
+  let honeypot: Honeypot | null = null;
+  if (config.HONEYPOT_ENABLED) {
+    honeypot = new Honeypot(buffer);
+  }
+
+  // Optional: Passive DNS (sniffing, dnstap)
+  let dnsInput: DnsInput | null = null;
+  if (config.DNS_SNIFF_ENABLED || config.DNS_DNSTAP_ENABLED) {
+    dnsInput = new DnsInput(buffer);
+  }
+
+  // Optional: Kernel log
+  let kmsgInput: KmsgInput | null = null;
+  if (config.KMSG_ENABLED) {
+    kmsgInput = new KmsgInput(buffer);
+  }
+
+  // Optional: Windows Event Log
+  let winlogInput: WinlogInput | null = null;
+  if (config.WINLOG_ENABLED) {
+    winlogInput = new WinlogInput(buffer);
+  }
+
+  // Optional: systemd journal
+  let journaldInput: JournaldInput | null = null;
+  if (config.JOURNALD_ENABLED) {
+    journaldInput = new JournaldInput(buffer);
+  }
+
+  // Optional: Kafka topics
+  let kafkaInput: KafkaInput | null = null;
+  if (config.KAFKA_INPUT_TOPICS.length > 0) {
+    kafkaInput = new KafkaInput(buffer);
+  }
+
+  // Optional: Local log files
+  let fileTail: FileTail | null = null;
+  if (config.FILE_TAIL_ENABLED) {
+    fileTail = new FileTail(buffer);
+  }
+
+  // Optional: Simulated traffic (demos, capacity tests)
+  let simulation: SimulationInput | null = null;
+  if (config.SIMULATION_PROFILE !== 'off') {
+    simulation = new SimulationInput(buffer);
+  }
+
+  // Optional: Network discovery (ARP sweeps)
+  let discovery: NetworkDiscovery | null = null;
+  if (config.DISCOVERY_ENABLED) {
+    discovery = new NetworkDiscovery(buffer);
+  }
+
+  // Optional: File pickup from SFTP/FTP servers
+  let filePickup: FilePickup | null = null;
+  if (config.PICKUP_ENABLED) {
+    filePickup = new FilePickup(buffer);
+  }
+
+  // Optional: Rule sets and configuration layers from the backend
+  let controlChannel: ControlChannel | null = null;
+  if (config.CONTROL_CHANNEL_ENABLED) {
+    controlChannel = new ControlChannel();
+  }
+
+  // Optional: Shadow forwarding to a secondary backend
+  let shadow: ShadowForwarder | null = null;
+  if (config.SHADOW_URL) {
+    shadow = new ShadowForwarder(config.SHADOW_URL);
+  }
+
+  // Optional: Dual-write to a new backend during an ingest migration
+  let dualWrite: DualWriteForwarder | null = null;
+  if (config.DUAL_WRITE_URL) {
+    dualWrite = new DualWriteForwarder(config.DUAL_WRITE_URL);
+  }
+
+  // Optional: Events as OpenTelemetry logs to an OTLP receiver
+  let otlpLogs: OtlpLogsExporter | null = null;
+  if (config.OTEL_LOGS_EXPORTER === 'otlp') {
+    otlpLogs = new OtlpLogsExporter();
+  }
+
+  // Optional: Raw events archived to an S3-compatible bucket
+  let archive: ArchiveSink | null = null;
+  if (config.ARCHIVE_ENABLED) {
+    archive = new ArchiveSink();
+  }
+
+  // Optional: Collector metrics as events
+  let metricsReporter: MetricsReporter | null = null;
+  if (config.METRICS_EVENTS_ENABLED) {
+    metricsReporter = new MetricsReporter(buffer, {
+      getRetryStats: () => transport.getRetryStats(),
+      getTcpConnections: () => (tcpServer?.connectionCount ?? 0) + (tlsServer?.connectionCount ?? 0) + (rawStreamServer?.connectionCount ?? 0) +
+        namedListeners.connectionCount,
+      getUdpKernelStats: () => udpMonitor?.getStats() ?? null,
+    });
+  }
+
+  // Health Check Server
+  let healthServer: HealthServer | null = null;
+  if (config.HEALTH_ENABLED) {
+    healthServer = new HealthServer({
+      getBufferStats: () => ({ size: buffer.size, dropped: buffer.dropped, spilled: buffer.spilled }),
+      getRetryStats: () => transport.getRetryStats(),
+      getTcpConnections: () => (tcpServer?.connectionCount ?? 0) + (tlsServer?.connectionCount ?? 0) + (rawStreamServer?.connectionCount ?? 0) +
+        namedListeners.connectionCount,
+      getDrainStats: () => drain.getStats(),
+      getEndpointStats: () => transport.getEndpointStats(),
+      getCircuitStats: () => transport.getCircuitStats(),
+      getUdpKernelStats: () => udpMonitor?.getStats() ?? null,
+      getTcpConnectionDetails: () => [
+        ...(tcpServer?.getConnectionDetails() ?? []),
+        ...(tlsServer?.getConnectionDetails() ?? []),
+        ...namedListeners.getConnectionDetails(),
+      ],
+      getControlStats: () => controlChannel?.getStats() ?? null,
+      getShadowStats: () => shadow?.getStats() ?? null,
+      getDualWriteStats: () => dualWrite?.getStats() ?? null,
+      getOtlpLogsStats: () => otlpLogs?.getStats() ?? null,
+      getArchiveStats: () => archive?.getStats() ?? null,
+      replayDeadLetters: async () => {
+        const events = await deadLetterFile.takeAll();
+        transport.replay(events);
+        return events.length;
+      },
+      listeners: namedListeners,
+      getRateLimitStats: () => transport.getRateLimitStats(),
+      getWefStats: () => wefServer?.getStats() ?? null,
+      getHttpPushStats: () => httpPushServer?.getStats() ?? null,
+      getPickupStats: () => filePickup?.getStats() ?? null,
+      getOtStats: () => (modbusListener || opcUaReceiver)
+        ? { modbus: modbusListener?.getStats() ?? null, opcua: opcUaReceiver?.getStats() ?? null }
+        : null,
+      getHoneypotStats: () => honeypot?.getStats() ?? null,
+      getDnsStats: () => dnsInput?.getStats() ?? null,
+      getKmsgStats: () => kmsgInput?.getStats() ?? null,
+      getWinlogStats: () => winlogInput?.getStats() ?? null,
+      getJournaldStats: () => journaldInput?.getStats() ?? null,
+      getKafkaInputStats: () => kafkaInput?.getStats() ?? null,
+      getFileTailStats: () => fileTail?.getStats() ?? null,
+      getSimulationStats: () => simulation?.getStats() ?? null,
+      getDiscoveryStats: () => discovery?.getStats() ?? null,
+      getForwardingStats: () => forwardPool.getStats(),
+      getPartitionStats: () => transport.getPartitionStats(buffer.partitionSizes()),
+      getKafkaStats: () => transport.getKafkaStats(),
+      getGrpcStats: () => transport.getGrpcStats(),
+      getCompressionStats: () => transport.getCompressionStats(),
+    });
+  }
+
+  // ============= STATE DIRECTORY =============
+  // Before anything writes to disk: read-only mounts fail here, with the setting to fix
+  try {
+    await stateDir.prepare();
+  } catch (err) {
+    log.error(`❌ Persistent state check failed:\n${(err as Error).message}`);
+    process.exit(1);
+  }
+
+  // ============= TOKEN VAULT =============
+  // Before any listener, so tokenized originals have somewhere to go
+  try {
+    await tokenVault.open();
+  } catch (err) {
+    log.error(`❌ Failed to open token vault: ${(err as Error).message}`);
+    process.exit(1);
+  }
+
+  // ============= API KEY FILE =============
+  try {
+    watchApiKeyFile();
+  } catch (err) {
+    log.error(`❌ Cannot read the API key: ${(err as Error).message}`);
+    process.exit(1);
+  }
+
+  // ============= BACKEND TLS =============
+  try {
+    loadBackendTls();
+  } catch (err) {
+    log.error(`❌ Cannot load the backend TLS files: ${(err as Error).message}`);
+    process.exit(1);
+  }
+  if (config.SOCKS_PROXY) {
+    const proxy = new URL(config.SOCKS_PROXY);
+    log.info(`🧦 Egress through SOCKS5 proxy ${proxy.host}${proxy.username ? ' (authenticated)' : ''}`);
+  }
+
+  // ============= SOURCE MAP =============
+  try {
+    sourceMap.reload();
+  } catch (err) {
+    log.error(`❌ Invalid source map: ${(err as Error).message}`);
+    process.exit(1);
+  }
+
+  // ============= PARSER OVERRIDES =============
+  try {
+    parserOverrides.reload();
+  } catch (err) {
+    log.error(`❌ Invalid parser overrides: ${(err as Error).message}`);
+    process.exit(1);
+  }
+
+  // ============= MULTILINE RULES =============
+  try {
+    multilineRules.reload();
+  } catch (err) {
+    log.error(`❌ Invalid multiline rules: ${(err as Error).message}`);
+    process.exit(1);
+  }
+
+  // ============= FORWARDING POLICIES =============
+  try {
+    forwardingPolicy.reload();
+  } catch (err) {
+    log.error(`❌ Invalid forwarding policies: ${(err as Error).message}`);
+    process.exit(1);
+  }
+
+  // ============= WRITE-AHEAD LOG =============
+  // Recover events a previous run didn't deliver; they are replayed by the retry loop
+  try {
+    await wal.open();
+  } catch (err) {
+    log.error(`❌ Failed to open write-ahead log: ${(err as Error).message}`);
+    process.exit(1);
+  }
+  await deadLetterFile.open();
+
+  // ============= UDP SERVER =============
+  void udpListener?.start();
+
+  // ============= NAMED LISTENERS =============
+  await namedListeners.apply(config.LISTENERS);
+
+  // ============= TCP SERVER =============
+  if (tcpServer) {
+    try {
+      await tcpServer.start();
+    } catch (err) {
+      logStartError('TCP server', err);
+    }
+  }
+
+  // ============= TLS SERVER =============
+  if (tlsServer) {
+    try {
+      await tlsServer.start();
+    } catch (err) {
+      logStartError('TLS server', err);
+    }
+  }
+
+  // ============= RAW STREAM SERVER =============
+  if (rawStreamServer) {
+    try {
+      await rawStreamServer.start();
+    } catch (err) {
+      logStartError('raw stream server', err);
+    }
+  }
+
+  // ============= RELAY SERVER =============
+  if (relayServer) {
+    try {
+      await relayServer.start();
+    } catch (err) {
+      logStartError('relay server', err);
+    }
+  }
+
+  // ============= WEF SERVER =============
+  if (wefServer) {
+    try {
+      await wefServer.start();
+    } catch (err) {
+      logStartError('WEF server', err);
+    }
+  }
+
+  // ============= HTTP PUSH SERVER =============
+  if (httpPushServer) {
+    try {
+      await httpPushServer.start();
+    } catch (err) {
+      logStartError('HTTP push server', err);
+    }
+  }
+
+  // ============= OT LISTENERS =============
+  if (modbusListener) {
+    try {
+      await modbusListener.start();
+    } catch (err) {
+      logStartError('Modbus listener', err);
+    }
+  }
+
+  if (opcUaReceiver) {
+    try {
+      await opcUaReceiver.start();
+    } catch (err) {
+      logStartError('OPC UA event receiver', err);
+    }
+  }
+
+  // ============= HONEYPOT =============
+  if (honeypot) {
+    try {
+      await honeypot.start();
+    } catch (err) {
+      logStartError('honeypot', err);
+    }
+  }
+
+  // ============= PASSIVE DNS =============
+  if (dnsInput) {
+    try {
+      await dnsInput.start();
+    } catch (err) {
+      logStartError('DNS input', err);
+    }
+  }
+
+  // ============= KERNEL LOG =============
+  if (kmsgInput) {
+    try {
+      await kmsgInput.start();
+    } catch (err) {
+      const code = (err as NodeJS.ErrnoException).code;
+      if (code === 'EACCES' || code === 'EPERM') {
+        log.error(`❌ Failed to start kernel log input: permission denied for ${config.KMSG_PATH}`);
+        log.error('   Reading it needs root or CAP_SYSLOG (in a container: --cap-add SYSLOG)');
+      } else {
+        logStartError('kernel log input', err);
+      }
+    }
+  }
+
+  // ============= WINDOWS EVENT LOG =============
+  if (winlogInput) {
+    try {
+      await winlogInput.start();
+    } catch (err) {
+      logStartError('Windows Event Log input', err);
+    }
+  }
+
+  // ============= SYSTEMD JOURNAL =============
+  if (journaldInput) {
+    await journaldInput.start();
+  }
+
+  // ============= KAFKA INPUT =============
+  if (kafkaInput) {
+    try {
+      await kafkaInput.start();
+    } catch (err) {
+      logStartError('Kafka input', err);
+    }
+  }
+
+  // ============= FILE TAIL =============
+  if (fileTail) {
+    await fileTail.start();
+  }
+
+  // ============= FILE PICKUP =============
+  if (filePickup) {
+    await filePickup.start();
+  }
+
+  // ============= NETWORK DISCOVERY =============
+  if (discovery) {
+    await discovery.start();
+  }
+
+  // ============= MDNS ADVERTISEMENT =============
+  let mdns: MdnsAdvertiser | null = null;
+  if (config.MDNS_ENABLED) {
+    const services: AdvertisedService[] = [];
+    if (udpListener) services.push({ type: SERVICE_TYPES.syslogUdp, port: udpPort });
+    if (tcpServer?.listeningPort) services.push({ type: SERVICE_TYPES.syslogTcp, port: tcpServer.listeningPort });
+    if (tlsServer) services.push({ type: SERVICE_TYPES.syslogTls, port: config.TLS_PORT });
+    if (relayServer) services.push({ type: SERVICE_TYPES.relay, port: config.RELAY_PORT });
+
+    mdns = new MdnsAdvertiser({
+      instanceName: config.MDNS_INSTANCE_NAME ?? config.COLLECTOR_NAME,
+      services,
+      txt: { collector: config.COLLECTOR_NAME, site: config.SITE_ID, version: COLLECTOR_VERSION },
+    });
+
+    try {
+      await mdns.start();
+    } catch (err) {
+      logStartError('mDNS advertisement', err);
+      mdns = null;
+    }
+  }
+
+  // ============= MAINTENANCE MODE =============
+  // Resume a window (or a pending replay) from before a restart
+  await maintenance.restore();
+
+  // ============= CONTROL CHANNEL =============
+  if (controlChannel) {
+    await controlChannel.start();
+  }
+
+  // ============= SHADOW FORWARDING =============
+  shadow?.start();
+
+  // ============= DUAL-WRITE =============
+  dualWrite?.start();
+
+  // ============= OTLP LOGS =============
+  otlpLogs?.start();
+
+  // ============= ARCHIVE =============
+  try {
+    await archive?.start();
+  } catch (err) {
+    log.error(`❌ Cannot start the archive: ${(err as Error).message}`);
+    process.exit(1);
+  }
+
+  // ============= METRICS EVENTS =============
+  metricsReporter?.start();
+
+  // ============= PER-SOURCE RATE LIMIT =============
+  sourceRateLimit.start((summary) => ingestEvent(buffer, summary, { skipSourcePolicy: true }));
+  if (config.SOURCE_RATE_LIMIT_EPS > 0) {
+    log.info(`🚦 Per-source rate limit: ${config.SOURCE_RATE_LIMIT_EPS} EPS, excess ${config.SOURCE_RATE_LIMIT_ACTION === 'drop' ? 'dropped' : 'tagged'}`);
+  }
+
+  // ============= TRACING =============
+  tracer.start();
+  if (config.OTEL_TRACES_EXPORTER === 'otlp') {
+    log.info(`🔭 Tracing ${config.OTEL_TRACES_SAMPLER_ARG * 100}% of events to ${config.OTEL_EXPORTER_OTLP_ENDPOINT}`);
+  }
+
+  // ============= SUPPORT BUNDLES / LEAK WATCHDOG =============
+  supportBundles.setMetricsSource(() => healthServer?.getMetrics() ?? { ...metrics.getSnapshot() });
+  leakWatchdog.start({
+    restart: (reason) => {
+      log.warn(`🩺 Restarting the collector (leak watchdog: ${reason})`);
+      void shutdown(WATCHDOG_RESTART_EXIT_CODE);
+    },
+    quiet: () => !transport.hasPendingRetries(),
+    breach: (reason) => config.SUPPORT_BUNDLE_ON_LEAK ? supportBundles.writeLocal(`leak watchdog: ${reason}`) : Promise.resolve(),
+  });
+  if (leakWatchdog.enabled) {
+    log.info(`🩺 Leak watchdog: sampling every ${config.LEAK_WATCHDOG_INTERVAL_MS / 1000}s, action ${config.LEAK_WATCHDOG_ACTION}`);
+  }
+
+  // ============= HEALTH SERVER =============
+  if (healthServer) {
+    try {
+      await healthServer.start();
+    } catch (err) {
+      logStartError('health server', err);
+    }
+  }
+
+  // ============= MAIN FLUSH LOOP =============
+  let shuttingDown = false; // From then on, shutdown() drains what's left
+  let flushLoopAt = Date.now();
+  const flushLoop = async () => {
+    if (shuttingDown) return;
+    flushLoopAt = Date.now();
+
+    // Maintenance: everything buffered goes to the disk spool instead of the backend
+    if (maintenance.active && !buffer.isEmpty()) {
+      const batch = buffer.popAll();
+      if (!(await maintenance.spool(batch))) {
+        await transport.sendBatch(batch).catch((err) => log.error(`❌ Flush error: ${(err as Error).message}`));
+      }
+    }
+
+    // Events spilled to disk come back once the buffer has drained
+    if (!maintenance.active) {
+      await buffer.refill().catch((err) => log.error(`❌ Cannot read spilled events back: ${(err as Error).message}`));
+    }
+
+    // Process main buffer, partial batches included
+    dispatch(true);
+
+    // Schedule next flush
+    setTimeout(flushLoop, config.FLUSH_INTERVAL_MS);
+  };
+
+  /**
+   * Hand batches (one tenant/site each) to idle forwarding workers; events
+   * stay buffered while the backend rate limit is exhausted. Between flush
+   * ticks only full batches go out, so bursts are sent as back-to-back bulk
+   * requests; partial batches wait for the next tick.
+   */
+  const dispatch = (partial: boolean) => {
+    while (!buffer.isEmpty() && (partial || buffer.hasFullBatch(config.BATCH_SIZE)) && transport.canSend() && !maintenance.active) {
+      const taken = forwardPool.run(() => {
+        const batch = buffer.popBatch(config.BATCH_SIZE, !partial);
+        shadow?.offer(batch);
+        dualWrite?.offer(batch);
+        otlpLogs?.offer(batch);
+        archive?.offer(batch);
+        return batch;
+      });
+      if (!taken) break;
+    }
+  };
+
+  // Immediate forwarding policies: partial batches go out on the next turn
+  // of the event loop instead of the next flush tick (coalesced)
+  let flushPending = false;
+  forwardingPolicy.connect({
+    archive,
+    flushNow: () => {
+      if (flushPending || shuttingDown) return;
+      flushPending = true;
+      setImmediate(() => {
+        flushPending = false;
+        dispatch(true);
+      });
+    },
+  });
+
+  // ============= RETRY PROCESSING LOOP =============
+  let walProbeAt = 0;
+
+  // ============= NETWORK CHANGES =============
+  // Rebind listeners that are down and recheck the backend when the host's addresses change
+  let networkWatcher: NetworkWatcher | null = null;
+  if (config.NETWORK_WATCH_INTERVAL_MS > 0) {
+    networkWatcher = new NetworkWatcher(({ addresses }) => {
+      udpListener?.revalidate(addresses);
+      tcpServer?.revalidate(addresses);
+      tlsServer?.revalidate(addresses);
+      namedListeners.revalidate(addresses);
+      walProbeAt = 0;
+      void transport.handleNetworkChange();
+    });
+    networkWatcher.start();
+  }
+  const retryLoop = async () => {
+    if (shuttingDown) return;
+
+    try {
+      // Backlog is paced by the drain controller so live traffic goes first,
+      // and never faster than the backend rate limit allows. Retries wait
+      // while in maintenance.
+      if (!maintenance.active) {
+        // Retries go out in bulk requests of BATCH_SIZE events
+        const allowance = Math.min(drain.allowance(buffer.size), transport.requestAllowance() * config.BATCH_SIZE);
+        const { attempted, delivered } = await transport.processRetries(allowance);
+        drain.consume(attempted);
+        drain.recordDrained(delivered);
+        drain.update(transport.getRetryStats().pending);
+
+        // Then events spooled during a maintenance window or while the circuit was open,
+        // with what's left of the budget (half-open, the first batch is the probe)
+        let budget = Math.min(allowance - attempted, config.BATCH_SIZE * 10);
+        while (budget >= 1 && maintenance.hasSpool && !maintenance.active && !transport.isCircuitOpen()) {
+          const events = await maintenance.readSpool(Math.min(budget, config.BATCH_SIZE));
+          if (events.length === 0) break;
+          dualWrite?.offer(events); // Never went through dispatch()
+          otlpLogs?.offer(events);
+          archive?.offer(events);
+          await transport.sendBatch(events);
+          drain.consume(events.length);
+          budget -= events.length;
+        }
+
+        // Then events parked in the write-ahead log, once the retry queue is clear and the
+        // backend answers again (probed at most every RETRY_MAX_DELAY_MS while it doesn't)
+        const backendUp = () => transport.getEndpointStats().consecutive_failures === 0;
+        while (budget >= 1 && wal.hasParked && !transport.hasPendingRetries() && !maintenance.active &&
+          !transport.isCircuitOpen() && (backendUp() || Date.now() >= walProbeAt)) {
+          const events = await wal.takeParked(Math.min(budget, config.BATCH_SIZE));
+          if (events.length === 0) break;
+          await transport.sendBatch(events);
+          drain.consume(events.length);
+          budget -= events.length;
+          if (!backendUp()) {
+            walProbeAt = Date.now() + config.RETRY_MAX_DELAY_MS;
+            break;
+          }
+        }
+      }
+    } catch (err) {
+      log.error(`❌ Retry processing error: ${(err as Error).message}`);
+    }
+
+    // Schedule next retry check
+    setTimeout(retryLoop, config.RETRY_CHECK_INTERVAL_MS);
+  };
+
+  // ============= PERIODIC STATUS LOG =============
+  const statusLoop = () => {
+    if (!log.enabled('info')) {
+      return;
+    }
+
+    const snapshot = metrics.getSnapshot();
+    const retryStats = transport.getRetryStats();
+    const udpStats = udpMonitor?.getStats();
+
+    // Only log if there's activity
+    if (snapshot.events.received > 0 || retryStats.pending > 0) {
+      log.info(
+        `📈 [${snapshot.uptime_human}] ` +
+        `Recv: ${snapshot.events.received} | ` +
+        `Sent: ${snapshot.events.sent} | ` +
+        `Failed: ${snapshot.events.failed} | ` +
+        `Retries: ${retryStats.pending} | ` +
+        `DLQ: ${retryStats.dlq} | ` +
+        `Rate: ${snapshot.rates.events_per_second}/s | ` +
+        `Success: ${snapshot.rates.success_rate}%` +
+        (udpStats?.available ? ` | UDP kernel drops: ${udpStats.socket_drops} (${udpStats.estimated_loss_percent}%)` : '')
+      );
+    }
+
+    setTimeout(statusLoop, 60000); // Log every minute
+  };
+
+  // Start all loops
+  flushLoop();
+  retryLoop();
+  setTimeout(statusLoop, 60000); // First status log after 1 minute
+
+  // ============= CONFIG RELOAD (SIGHUP) =============
+  // Re-reads CONFIG_FILE and the environment, logs a structured diff and applies
+  // the settings that can change live. Use `collector config diff` for a dry-run.
+  const reload = () => {
+    const resolved = resolveConfig();
+    if (!resolved.ok) {
+      log.error(`❌ Config reload rejected, keeping current configuration: ${resolved.error}`);
+      return;
+    }
+
+    // Also picks up edits to SOURCE_MAP_FILE, which the diff doesn't see
+    try {
+      sourceMap.reload(resolved.config);
+    } catch (err) {
+      log.error(`❌ Source map reload rejected, keeping the current map: ${(err as Error).message}`);
+    }
+
+    // Same for PARSER_OVERRIDES_FILE
+    try {
+      parserOverrides.reload(resolved.config);
+    } catch (err) {
+      log.error(`❌ Parser overrides reload rejected, keeping the current table: ${(err as Error).message}`);
+    }
+
+    // MULTILINE_RULES_FILE
+    try {
+      multilineRules.reload(resolved.config);
+    } catch (err) {
+      log.error(`❌ Multiline rules reload rejected, keeping the current rules: ${(err as Error).message}`);
+    }
+
+    // And FORWARDING_POLICIES_FILE
+    try {
+      forwardingPolicy.reload(resolved.config);
+    } catch (err) {
+      log.error(`❌ Forwarding policies reload rejected, keeping the current table: ${(err as Error).message}`);
+    }
+
+    // Also picks up renewed certificates at the same paths
+    try {
+      loadBackendTls(resolved.config);
+    } catch (err) {
+      log.error(`❌ Backend TLS reload rejected, keeping the current certificates: ${(err as Error).message}`);
+    }
+
+    // Named listeners follow LISTENERS; those that couldn't listen are tried again
+    void namedListeners.apply(resolved.config.LISTENERS).then((result) => {
+      const changes = [
+        ...result.added.map((name) => `${name} added`),
+        ...result.removed.map((name) => `${name} removed`),
+        ...result.updated.map((name) => `${name} updated`),
+        ...result.rebound.map((name) => `${name} rebound`),
+        ...result.failed.map(({ name, error }) => `${name} failed (${error})`),
+      ];
+      if (changes.length > 0) log.info(`🔧 Listeners: ${changes.join(', ')}`);
+    });
+
+    const diff = diffConfig(sanitizeConfig(config), sanitizeConfig(resolved.config));
+    if (diff.listeners.length === 0 && diff.settings.length === 0) {
+      log.info('🔧 Config reload: no changes');
+      return;
+    }
+
+    log.info(`🔧 Config reload: ${diff.live} live change(s), ${diff.restart_required} require a restart`);
+    for (const line of formatDiff(diff)) {
+      log.info(`   ${line}`);
+    }
+    // Machine-readable record of the reload (its fields, with LOG_FORMAT=json)
+    if (config.LOG_FORMAT === 'json') {
+      log.info('Config reload applied', { event: 'config_reload', ...diff });
+    } else {
+      log.info(JSON.stringify({ event: 'config_reload', ts: new Date().toISOString(), ...diff }));
+    }
+
+    const target = config as Record<string, unknown>;
+    const next = resolved.config as Record<string, unknown>;
+    for (const change of diff.settings) {
+      if (change.apply === 'live') {
+        target[change.key] = next[change.key];
+      }
+    }
+    configureLogger(); // LOG_LEVEL, LOG_FORMAT
+  };
+
+  // Configuration layers accepted from the backend apply the same way
+  controlChannel?.setConfigChangeHandler(reload);
+
+  // ============= GRACEFUL SHUTDOWN =============
+  /**
+   * Deliver what is buffered (spilled events included) and retrying, until
+   * nothing is left, the backend is known to be unavailable (circuit open,
+   * maintenance) or the deadline passes. Returns false if it ran out of time.
+   */
+  const drainForShutdown = async (deadline: number): Promise<boolean> => {
+    const work = (async () => {
+      await forwardPool.drain(); // Batches already in flight
+      transport.retryNow();
+      while (Date.now() < deadline && !maintenance.active && !transport.isCircuitOpen()) {
+        await buffer.refill().catch((err) => log.error(`   ❌ Cannot read spilled events back: ${(err as Error).message}`));
+        if (!buffer.isEmpty()) {
+          const batch = buffer.popBatch(config.BATCH_SIZE);
+          archive?.offer(batch);
+          await transport.sendBatch(batch);
+          continue;
+        }
+        if (!transport.hasPendingRetries()) return;
+        const { attempted } = await transport.processRetries();
+        if (attempted === 0) await new Promise((resolve) => setTimeout(resolve, config.RETRY_CHECK_INTERVAL_MS));
+      }
+    })();
+
+    let timer: NodeJS.Timeout | undefined;
+    const timedOut = new Promise<boolean>((resolve) => {
+      timer = setTimeout(() => resolve(false), Math.max(0, deadline - Date.now()));
+    });
+    const finished = await Promise.race([
+      work.then(() => Date.now() < deadline, (err) => {
+        log.error(`   ❌ Drain failed: ${(err as Error).message}`);
+        return true;
+      }),
+      timedOut,
+    ]);
+    clearTimeout(timer);
+    return finished;
+  };
+
+  const shutdown = async (exitCode = 0) => {
+    // A signal during a watchdog restart (or the other way round)
+    if (shuttingDown) return;
+    shuttingDown = true;
+    log.info('\n🛑 Shutting down collector...');
+    systemdNotify.notifyStopping(config.SHUTDOWN_TIMEOUT_MS + SHUTDOWN_EXIT_MARGIN_MS);
+
+    // Bounded: even if something hangs, the process exits
+    const deadline = Date.now() + config.SHUTDOWN_TIMEOUT_MS;
+    setTimeout(() => {
+      log.error(`   ❌ Shutdown still not finished ${SHUTDOWN_EXIT_MARGIN_MS / 1000}s after SHUTDOWN_TIMEOUT_MS, exiting`);
+      process.exit(exitCode);
+    }, config.SHUTDOWN_TIMEOUT_MS + SHUTDOWN_EXIT_MARGIN_MS).unref();
+
+    // Stop accepting new connections; TCP senders get a moment to deliver what they already sent
+    const graceMs = Math.min(TCP_SHUTDOWN_GRACE_MS, config.SHUTDOWN_TIMEOUT_MS / 4);
+    await Promise.all([tcpServer?.stop(graceMs), tlsServer?.stop(graceMs), namedListeners.stop(graceMs)]);
+
+    if (rawStreamServer) {
+      await rawStreamServer.stop();
+    }
+
+    if (relayServer) {
+      await relayServer.stop();
+    }
+
+    if (wefServer) {
+      await wefServer.stop();
+    }
+
+    if (httpPushServer) {
+      await httpPushServer.stop();
+    }
+
+    if (filePickup) {
+      await filePickup.stop();
+    }
+
+    if (modbusListener) {
+      await modbusListener.stop();
+    }
+
+    if (opcUaReceiver) {
+      await opcUaReceiver.stop();
+    }
+
+    if (honeypot) {
+      await honeypot.stop();
+    }
+
+    if (dnsInput) {
+      await dnsInput.stop();
+    }
+
+    if (kmsgInput) {
+      await kmsgInput.stop();
+    }
+
+    if (winlogInput) {
+      await winlogInput.stop();
+    }
+
+    if (journaldInput) {
+      await journaldInput.stop();
+    }
+
+    if (kafkaInput) {
+      await kafkaInput.stop();
+    }
+
+    if (fileTail) {
+      await fileTail.stop();
+    }
+
+    simulation?.stop();
+
+    if (discovery) {
+      await discovery.stop();
+    }
+
+    if (mdns) {
+      await mdns.stop();
+    }
+
+    udpMonitor?.stop();
+    networkWatcher?.stop();
+    leakWatchdog.stop();
+    unwatchApiKeyFile();
+    controlChannel?.stop();
+    shadow?.stop();
+    dualWrite?.stop();
+    otlpLogs?.stop();
+    metricsReporter?.stop();
+    sourceRateLimit.stop();
+
+    if (udpListener) {
+      await udpListener.close();
+      log.info('   UDP socket closed.');
+    }
+
+    // Originals of the last tokenized values
+    await tokenVault.flush();
+
+    // Deliver what is pending, until SHUTDOWN_TIMEOUT_MS
+    const drainStart = Date.now();
+    const sentBefore = metrics.getSnapshot().events.sent;
+    if (!buffer.isEmpty() || transport.hasPendingRetries()) {
+      log.info(`   Draining ${buffer.size} buffered and ${transport.getRetryStats().pending} retrying events...`);
+    }
+    const finished = await drainForShutdown(deadline);
+    const delivered = metrics.getSnapshot().events.sent - sentBefore;
+    const seconds = ((Date.now() - drainStart) / 1000).toFixed(1);
+
+    // The rest: the write-ahead log already has it; otherwise (and in maintenance) to the disk spool
+    const remaining = [...buffer.popAll(), ...transport.exportRetries()];
+    if (remaining.length === 0) {
+      if (delivered > 0) log.info(`   ✅ Drained: ${delivered} events delivered in ${seconds}s, none left behind.`);
+    } else {
+      const why = !finished ? 'SHUTDOWN_TIMEOUT_MS reached'
+        : maintenance.active ? 'maintenance mode'
+          : transport.isCircuitOpen() ? 'backend unavailable, circuit open' : 'backend unavailable';
+      let fate: string;
+      if (wal.enabled && !maintenance.active) {
+        fate = 'kept in the write-ahead log for the next start';
+      } else if (await maintenance.spool(remaining)) {
+        fate = `spooled to ${config.MAINTENANCE_SPOOL_DIR} for the next start`;
+      } else {
+        fate = 'lost (no WAL_DIR, and the disk spool is unavailable)';
+      }
+      log.warn(`   ⚠️ ${remaining.length} events left behind after ${seconds}s (${why}; ${delivered} delivered): ${fate}.`);
+    }
+
+    // Last archive objects: uploaded, or spooled for the next start
+    await archive?.stop();
+
+    // Whatever wasn't delivered stays in the write-ahead log for the next start
+    await wal.flush();
+    await deadLetterFile.flush();
+    await stateDir.release();
+
+    await transport.close();
+
+    // Spans of the final flush
+    await tracer.stop();
+
+    // Export any DLQ events
+    const dlqEvents = transport.exportDLQ();
+    if (dlqEvents.length > 0) {
+      log.warn(`   ⚠️ ${dlqEvents.length} events in DLQ will be lost` +
+        (deadLetterFile.enabled ? ' (those the backend refused are kept in the dead-letter file).' : '.'));
+    }
+
+    // Stop health server
+    if (healthServer) {
+      await healthServer.stop();
+    }
+
+    // Final metrics
+    const finalMetrics = metrics.getSnapshot();
+    log.info(
+      `📊 Final stats: Received ${finalMetrics.events.received}, ` +
+      `Sent ${finalMetrics.events.sent}, ` +
+      `Failed ${finalMetrics.events.failed}, ` +
+      `Success rate: ${finalMetrics.rates.success_rate}%`
+    );
+
+    process.exit(exitCode);
+  };
+
+  process.on('SIGINT', () => void shutdown());
+  process.on('SIGTERM', () => void shutdown());
+  process.on('SIGHUP', reload);
+
+  // Log startup complete
+  log.info('✅ Collector ready and listening for events.');
+
+  // ============= SYSTEMD =============
+  // Watchdog pings go on during the drain (systemd's stop timeout bounds it)
+  systemdNotify.describe();
+  systemdNotify.notifyReady(`Listening, forwarding to ${config.OUTPUT_TYPE}`);
+  systemdNotify.startWatchdog(() => shuttingDown || Date.now() - flushLoopAt < FLUSH_LOOP_STALL_MS);
+
+  // ============= SIMULATION =============
+  simulation?.start();
+}
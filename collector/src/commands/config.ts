@@ -0,0 +1,64 @@
+import { parseArgs } from 'node:util';
+import { config, resolveConfig } from '../config.js';
+import { diffConfig, formatDiff, sanitizeConfig } from '../config-diff.js';
+
+/**
+ * `collector config diff` - dry-run of a reload
+ *
+ * Resolves the configuration a reload (SIGHUP) would produce from CONFIG_FILE
+ * and the environment, compares it with the running collector's GET /config,
+ * and prints what would change without applying anything.
+ *
+ * Options:
+ *   --url <url>   Running collector's health server (default http://127.0.0.1:HEALTH_PORT)
+ *   --json        Print machine-readable output
+ *
+ * Exit code: 0 no changes, 1 changes pending, 2 error.
+ */
+export async function runConfig(args: string[]): Promise<void> {
+  const [subcommand, ...rest] = args;
+  if (subcommand !== 'diff') {
+    console.error('Usage: collector config diff [--url <health-url>] [--json]');
+    process.exit(2);
+  }
+
+  const { values } = parseArgs({
+    args: rest,
+    options: {
+      url: { type: 'string', default: `http://127.0.0.1:${config.HEALTH_PORT}` },
+      json: { type: 'boolean', default: false },
+    },
+  });
+
+  const resolved = resolveConfig();
+  if (!resolved.ok) {
+    console.error(`❌ New configuration is invalid: ${resolved.error}`);
+    process.exit(2);
+  }
+
+  let running: Record<string, unknown>;
+  try {
+    const response = await fetch(`${values.url}/config`, { signal: AbortSignal.timeout(5000) });
+    if (!response.ok) throw new Error(`HTTP ${response.status}`);
+    running = (await response.json() as { config: Record<string, unknown> }).config;
+  } catch (err) {
+    console.error(`❌ Cannot read running config from ${values.url}/config: ${(err as Error).message}`);
+    process.exit(2);
+  }
+
+  const diff = diffConfig(running, sanitizeConfig(resolved.config));
+  const changes = diff.listeners.length + diff.settings.length;
+
+  if (values.json) {
+    console.log(JSON.stringify(diff, null, 2));
+  } else if (changes === 0) {
+    console.log('✅ No changes: running configuration matches.');
+  } else {
+    console.log(`🔧 Reload would apply ${diff.live} live change(s); ${diff.restart_required} require a restart:`);
+    for (const line of formatDiff(diff)) {
+      console.log(`   ${line}`);
+    }
+  }
+
+  process.exit(changes === 0 ? 0 : 1);
+}
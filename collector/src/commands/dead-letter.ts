@@ -0,0 +1,71 @@
+import { parseArgs } from 'node:util';
+import { config } from '../config.js';
+import type { DeadLetterStats } from '../dead-letter.js';
+
+/**
+ * `collector dead-letter status|replay` - inspect or resend refused events
+ *
+ * Talks to the running collector's health server (GET /dead-letter, POST
+ * /dead-letter/replay). Replay sends every event in the dead-letter file
+ * again through the retry queue, once the cause of the rejections (schema,
+ * API key, tenant) has been fixed; events refused again are written back.
+ * The file itself is NDJSON and can be read directly (jq, grep).
+ *
+ * Options:
+ *   --url <url>      Running collector's health server (default http://127.0.0.1:HEALTH_PORT)
+ *   --token <token>  Admin token (default ADMIN_TOKEN)
+ *   --json           Print machine-readable output
+ *
+ * Exit code: 0 success, 2 error.
+ */
+export async function runDeadLetter(args: string[]): Promise<void> {
+  const [action, ...rest] = args;
+  if (action !== 'status' && action !== 'replay') {
+    console.error('Usage: collector dead-letter status|replay [--url <health-url>] [--token <admin-token>] [--json]');
+    process.exit(2);
+  }
+
+  const { values } = parseArgs({
+    args: rest,
+    options: {
+      url: { type: 'string', default: `http://127.0.0.1:${config.HEALTH_PORT}` },
+      token: { type: 'string', default: config.ADMIN_TOKEN },
+      json: { type: 'boolean', default: false },
+    },
+  });
+
+  const endpoint = action === 'status' ? `${values.url}/dead-letter` : `${values.url}/dead-letter/replay`;
+  let state: DeadLetterStats & { queued?: number };
+  try {
+    const response = await fetch(endpoint, action === 'status'
+      ? { signal: AbortSignal.timeout(5000) }
+      : {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          ...(values.token && { 'Authorization': `Bearer ${values.token}` }),
+        },
+        body: '{}',
+        signal: AbortSignal.timeout(30000),
+      });
+    const body = await response.json() as DeadLetterStats & { queued?: number; error?: string };
+    if (!response.ok) throw new Error(body.error ?? `HTTP ${response.status}`);
+    state = body;
+  } catch (err) {
+    console.error(`❌ Dead-letter ${action} failed (${endpoint}): ${(err as Error).message}`);
+    process.exit(2);
+  }
+
+  if (values.json) {
+    console.log(JSON.stringify(state, null, 2));
+  } else if (action === 'replay') {
+    console.log(`💀 Replaying ${state.queued ?? 0} dead-lettered events; those refused again go back to ${state.file}.`);
+  } else if (!state.enabled) {
+    console.log('Dead-letter file disabled (set DEAD_LETTER_FILE or STATE_DIR): refused events are only counted.');
+  } else {
+    console.log(`💀 ${state.file}: ${state.bytes} bytes; ${state.written} events written since startup, ${state.replayed} replayed`);
+    if (state.rotated > 0) console.log(`   Rotated ${state.rotated} times (DEAD_LETTER_MAX_BYTES); older records are in ${state.file}.1`);
+    if (state.last_error) console.log(`   ⚠️ Last error: ${state.last_error}`);
+  }
+  process.exit(0);
+}
@@ -0,0 +1,543 @@
+import dns from 'node:dns/promises';
+import net from 'node:net';
+import tls from 'node:tls';
+import { execFile } from 'node:child_process';
+import { readFileSync, readdirSync } from 'node:fs';
+import { parseArgs, promisify } from 'node:util';
+import { config } from '../config.js';
+import { backendFetch, chainPins, loadBackendTls } from '../http-client.js';
+import { connectSocks, parseSocksUrl } from '../socks.js';
+
+const execFileAsync = promisify(execFile);
+
+const CERT_EXPIRY_WARN_DAYS = 14;
+const CLOCK_SKEW_WARN_S = 5;
+const CLOCK_SKEW_FAIL_S = 300; // Signed requests and token expiry start failing around here
+const MTU_PROBE_MIN = 1200; // Payload sizes; + 28 bytes of IP/ICMP headers
+const MTU_PROBE_MAX = 1472; // 1500 on the wire
+
+type CheckStatus = 'ok' | 'warn' | 'fail' | 'skip';
+
+interface CheckResult {
+  check: 'dns' | 'proxy' | 'tcp' | 'tls' | 'http' | 'clock' | 'mtu';
+  target: string;
+  status: CheckStatus;
+  message: string;
+  duration_ms: number;
+  hint?: string;
+  details?: Record<string, unknown>;
+}
+
+interface Target {
+  name: string; // "primary", "failover", a BACKEND_ENDPOINTS region, or "kafka"
+  host: string;
+  port: number;
+  url?: string; // HTTP(S) targets
+  tls: boolean;
+}
+
+const ICONS: Record<CheckStatus, string> = { ok: '✅', warn: '⚠️', fail: '❌', skip: '⏭️' };
+
+/**
+ * `collector diagnose` - check the path from this host to the backend
+ *
+ * Runs the checks support otherwise does by hand, for every configured
+ * endpoint (CENTINELA_API_URL, BACKEND_INGEST_URL_FAILOVER, BACKEND_ENDPOINTS,
+ * GRPC_URL, or the Kafka brokers with OUTPUT_TYPE=kafka), the way the collector itself connects (SOCKS_PROXY,
+ * BACKEND_TLS_*):
+ *
+ *   dns    resolution of the endpoint's name (skipped when socks5h resolves it)
+ *   proxy  SOCKS5 handshake, and HTTP(S)_PROXY variables the collector ignores
+ *   tcp    connection time
+ *   tls    handshake, protocol, certificate chain, expiry, hostname and pins
+ *   http   an authenticated request (API key accepted?)
+ *   clock  local clock against the backend's Date header
+ *   mtu    path MTU (ping with don't-fragment), the usual cause of TLS hangs
+ *
+ * Options:
+ *   --timeout <ms>   Per-check timeout (default 10000)
+ *   --json           Print the report as JSON (attach it to support tickets)
+ *
+ * Exit code: 0 no failures (warnings allowed), 1 a check failed, 2 error.
+ */
+export async function runDiagnose(args: string[]): Promise<void> {
+  const { values } = parseArgs({
+    args,
+    options: {
+      timeout: { type: 'string', default: '10000' },
+      json: { type: 'boolean', default: false },
+    },
+  });
+
+  const timeoutMs = Number(values.timeout);
+  if (!Number.isInteger(timeoutMs) || timeoutMs <= 0) {
+    console.error(`❌ Invalid --timeout: ${values.timeout}`);
+    process.exit(2);
+  }
+
+  // Quiet the "Backend TLS: ..." line in JSON mode
+  const log = console.log;
+  if (values.json) console.log = () => undefined;
+  try {
+    loadBackendTls();
+  } catch (err) {
+    console.error(`❌ Cannot load the backend TLS files: ${(err as Error).message}`);
+    process.exit(2);
+  } finally {
+    console.log = log;
+  }
+
+  const results: CheckResult[] = [];
+  const report = (result: CheckResult) => {
+    results.push(result);
+    if (!values.json) printResult(result);
+  };
+
+  if (!values.json) console.log(`🩺 Diagnosing connectivity of ${config.COLLECTOR_NAME}...\n`);
+
+  report(await checkProxy(timeoutMs));
+
+  let serverDate: { date: Date; rtt: number } | null = null;
+  for (const target of targets()) {
+    const dnsResult = await checkDns(target);
+    report(dnsResult);
+    if (dnsResult.status === 'fail') continue;
+
+    const tcpResult = await checkTcp(target, timeoutMs);
+    report(tcpResult);
+    if (tcpResult.status === 'fail') continue;
+
+    if (target.tls) {
+      const tlsResult = await checkTls(target, timeoutMs);
+      report(tlsResult);
+      if (tlsResult.status === 'fail') continue;
+    }
+
+    if (target.url) {
+      const { result, date } = await checkHttp(target, timeoutMs);
+      report(result);
+      serverDate ??= date;
+    }
+  }
+
+  report(checkClock(serverDate));
+  const primary = targets()[0]!;
+  report(await checkMtu(primary));
+
+  const failed = results.filter((result) => result.status === 'fail').length;
+  const warned = results.filter((result) => result.status === 'warn').length;
+
+  if (values.json) {
+    console.log(JSON.stringify({
+      collector: config.COLLECTOR_NAME,
+      generated_at: new Date().toISOString(),
+      output: config.OUTPUT_TYPE,
+      proxy: config.SOCKS_PROXY ? new URL(config.SOCKS_PROXY).host : null,
+      summary: { failed, warnings: warned, checks: results.length },
+      results,
+    }, null, 2));
+  } else {
+    console.log(failed > 0
+      ? `\n❌ ${failed} check(s) failed, ${warned} warning(s).`
+      : `\n${warned > 0 ? '⚠️' : '✅'} No failures${warned > 0 ? `, ${warned} warning(s)` : ''}.`);
+  }
+
+  process.exit(failed > 0 ? 1 : 0);
+}
+
+function targets(): Target[] {
+  if (config.OUTPUT_TYPE === 'kafka') {
+    return config.KAFKA_BROKERS.map((broker) => {
+      const separator = broker.lastIndexOf(':');
+      return {
+        name: 'kafka',
+        host: broker.slice(0, separator).replace(/^\[|\]$/g, ''),
+        port: Number(broker.slice(separator + 1)),
+        tls: config.KAFKA_TLS_ENABLED,
+      };
+    });
+  }
+
+  const endpoints = [
+    { name: 'primary', url: config.CENTINELA_API_URL },
+    ...(config.BACKEND_INGEST_URL_FAILOVER ? [{ name: config.BACKEND_INGEST_URL_FAILOVER.region ?? 'failover', url: config.BACKEND_INGEST_URL_FAILOVER.url }] : []),
+    ...config.BACKEND_ENDPOINTS.map((endpoint) => ({ name: endpoint.region, url: endpoint.url })),
+  ];
+  const resolved: Target[] = endpoints.map(({ name, url }) => {
+    const parsed = new URL(url);
+    const secure = parsed.protocol === 'https:';
+    return {
+      name,
+      host: parsed.hostname.replace(/^\[|\]$/g, ''),
+      port: Number(parsed.port) || (secure ? 443 : 80),
+      url,
+      tls: secure,
+    };
+  });
+  // A separate gRPC listener (OUTPUT_TYPE=grpc): reachability and TLS only
+  if (config.OUTPUT_TYPE === 'grpc' && config.GRPC_URL) {
+    const parsed = new URL(config.GRPC_URL);
+    const secure = parsed.protocol === 'https:';
+    resolved.push({
+      name: 'grpc',
+      host: parsed.hostname.replace(/^\[|\]$/g, ''),
+      port: Number(parsed.port) || (secure ? 443 : 80),
+      tls: secure,
+    });
+  }
+  return resolved;
+}
+
+function label(target: Target): string {
+  return `${target.name} ${target.host}:${target.port}`;
+}
+
+function printResult(result: CheckResult): void {
+  console.log(`${ICONS[result.status]} ${result.check.padEnd(5)} ${result.target}: ${result.message}` +
+    (result.status !== 'skip' ? ` (${result.duration_ms}ms)` : ''));
+  if (result.hint) console.log(`   💡 ${result.hint}`);
+}
+
+async function timed<T>(run: () => Promise<T>): Promise<{ value: T; duration: number }> {
+  const start = Date.now();
+  const value = await run();
+  return { value, duration: Date.now() - start };
+}
+
+function withTimeout<T>(promise: Promise<T>, timeoutMs: number, what: string): Promise<T> {
+  return Promise.race([
+    promise,
+    new Promise<never>((_, reject) => setTimeout(() => reject(new Error(`${what} timed out after ${timeoutMs}ms`)), timeoutMs).unref()),
+  ]);
+}
+
+/** A TCP connection to the target, direct or through SOCKS_PROXY */
+async function openSocket(target: Target, timeoutMs: number): Promise<net.Socket> {
+  if (config.SOCKS_PROXY) {
+    return withTimeout(connectSocks(parseSocksUrl(config.SOCKS_PROXY), target.host, target.port), timeoutMs, 'connection');
+  }
+
+  return withTimeout(new Promise<net.Socket>((resolve, reject) => {
+    const socket = net.connect(target.port, target.host, () => resolve(socket));
+    socket.once('error', reject);
+  }), timeoutMs, 'connection');
+}
+
+async function checkProxy(timeoutMs: number): Promise<CheckResult> {
+  const ignored = ['HTTPS_PROXY', 'HTTP_PROXY', 'https_proxy', 'http_proxy'].filter((key) => process.env[key]);
+  const hint = ignored.length > 0
+    ? `${ignored.join(', ')} is set, but the collector doesn't use HTTP proxies; egress goes direct unless SOCKS_PROXY is set`
+    : undefined;
+
+  if (!config.SOCKS_PROXY) {
+    return {
+      check: 'proxy', target: 'none', status: ignored.length > 0 ? 'warn' : 'skip',
+      message: 'no SOCKS_PROXY configured, connecting directly', duration_ms: 0, hint,
+    };
+  }
+
+  const proxy = parseSocksUrl(config.SOCKS_PROXY);
+  const target = targets()[0]!;
+  const start = Date.now();
+  try {
+    const socket = await withTimeout(connectSocks(proxy, target.host, target.port), timeoutMs, 'SOCKS handshake');
+    socket.destroy();
+    return {
+      check: 'proxy', target: `${proxy.host}:${proxy.port}`, status: 'ok', duration_ms: Date.now() - start, hint,
+      message: `SOCKS5 tunnel to ${target.host}:${target.port} established${proxy.username ? ' (authenticated)' : ''}` +
+        (proxy.remoteDns ? ', names resolved by the proxy' : ''),
+    };
+  } catch (err) {
+    const message = (err as Error).message;
+    return {
+      check: 'proxy', target: `${proxy.host}:${proxy.port}`, status: 'fail', message, duration_ms: Date.now() - start,
+      hint: /authentication/.test(message)
+        ? 'Check the user and password in SOCKS_PROXY (URL-encoded)'
+        : /ECONNREFUSED|timed out/.test(message)
+          ? 'The proxy itself is unreachable; is the SSH tunnel (ssh -D) up?'
+          : 'The proxy could not reach the backend; check the egress rules on the proxy side',
+    };
+  }
+}
+
+async function checkDns(target: Target): Promise<CheckResult> {
+  if (net.isIP(target.host)) {
+    return { check: 'dns', target: label(target), status: 'skip', message: 'IP address, nothing to resolve', duration_ms: 0 };
+  }
+  const proxy = config.SOCKS_PROXY ? parseSocksUrl(config.SOCKS_PROXY) : null;
+
+  try {
+    const { value: addresses, duration } = await timed(() => dns.lookup(target.host, { all: true }));
+    const [v4, v6] = [addresses.filter((a) => a.family === 4).length, addresses.filter((a) => a.family === 6).length];
+    return {
+      check: 'dns', target: label(target), status: 'ok', duration_ms: duration,
+      message: `resolves to ${addresses.map((a) => a.address).join(', ')}`,
+      details: { addresses: addresses.map((a) => a.address), ipv4: v4, ipv6: v6, servers: dns.getServers() },
+      hint: v6 > 0 && v4 === 0 ? 'IPv6 only: make sure this host has IPv6 egress' : undefined,
+    };
+  } catch (err) {
+    const code = (err as NodeJS.ErrnoException).code;
+    // With socks5h the proxy resolves the name; not resolving locally is expected
+    if (proxy?.remoteDns) {
+      return {
+        check: 'dns', target: label(target), status: 'skip', duration_ms: 0,
+        message: `not resolvable locally (${code}), resolved by the SOCKS proxy (socks5h)`,
+      };
+    }
+    return {
+      check: 'dns', target: label(target), status: 'fail', duration_ms: 0,
+      message: `cannot resolve ${target.host} (${code ?? (err as Error).message})`,
+      details: { servers: dns.getServers() },
+      hint: code === 'ENOTFOUND'
+        ? 'The name does not exist for this resolver: split-horizon DNS or a typo in the URL?'
+        : 'The resolver did not answer: check /etc/resolv.conf and that DNS (udp/tcp 53) is allowed out' +
+          (proxy ? ', or use socks5h:// so the proxy resolves names' : ''),
+    };
+  }
+}
+
+async function checkTcp(target: Target, timeoutMs: number): Promise<CheckResult> {
+  try {
+    const { value: socket, duration } = await timed(() => openSocket(target, timeoutMs));
+    const details = config.SOCKS_PROXY ? { via: 'socks' } : { remote_address: socket.remoteAddress, local_address: socket.localAddress };
+    socket.destroy();
+    return { check: 'tcp', target: label(target), status: 'ok', message: 'connected', duration_ms: duration, details };
+  } catch (err) {
+    const message = (err as Error).message;
+    return {
+      check: 'tcp', target: label(target), status: 'fail', message, duration_ms: 0,
+      hint: /timed out/.test(message)
+        ? `No answer: a firewall is probably dropping outbound tcp/${target.port}`
+        : /ECONNREFUSED|refused/.test(message)
+          ? 'Refused: nothing listens on that port, or a firewall on the path rejects the connection'
+          : undefined,
+    };
+  }
+}
+
+async function checkTls(target: Target, timeoutMs: number): Promise<CheckResult> {
+  const ca = config.OUTPUT_TYPE === 'kafka' ? config.KAFKA_TLS_CA : config.BACKEND_TLS_CA;
+  const cert = config.OUTPUT_TYPE === 'kafka' ? config.KAFKA_TLS_CERT : config.BACKEND_TLS_CERT;
+  const key = config.OUTPUT_TYPE === 'kafka' ? config.KAFKA_TLS_KEY : config.BACKEND_TLS_KEY;
+  const start = Date.now();
+
+  let socket: net.Socket;
+  try {
+    socket = await openSocket(target, timeoutMs);
+  } catch (err) {
+    return { check: 'tls', target: label(target), status: 'fail', message: (err as Error).message, duration_ms: 0 };
+  }
+
+  try {
+    const secure = await withTimeout(new Promise<tls.TLSSocket>((resolve, reject) => {
+      const connection = tls.connect({
+        socket,
+        servername: net.isIP(target.host) ? undefined : target.host,
+        ca: ca ? readFileSync(ca) : undefined,
+        cert: cert ? readFileSync(cert) : undefined,
+        key: key ? readFileSync(key) : undefined,
+        rejectUnauthorized: false, // Verified below, to report why
+      }, () => resolve(connection));
+      connection.once('error', reject);
+    }), timeoutMs, 'TLS handshake');
+
+    const peer = secure.getPeerCertificate(true);
+    const chain: Array<{ subject: string; issuer: string; valid_to: string }> = [];
+    for (let current: tls.DetailedPeerCertificate | undefined = peer; current && Object.keys(current).length > 0;) {
+      chain.push({ subject: current.subject?.CN ?? '?', issuer: current.issuer?.CN ?? '?', valid_to: current.valid_to });
+      if (current.issuerCertificate === current) break;
+      current = current.issuerCertificate;
+    }
+    const daysLeft = Math.floor((Date.parse(peer.valid_to) - Date.now()) / 86_400_000);
+    const authorizationError = secure.authorizationError ? String(secure.authorizationError) : null;
+    const hostnameError = tls.checkServerIdentity(target.host, peer);
+    const details = {
+      protocol: secure.getProtocol(),
+      cipher: secure.getCipher().name,
+      alpn: secure.alpnProtocol || null,
+      chain,
+      expires_in_days: daysLeft,
+      authorization_error: authorizationError,
+      spki_pins: chainPins(peer), // Leaf first, for BACKEND_TLS_PINS
+    };
+    secure.destroy();
+
+    const duration = Date.now() - start;
+    const issuer = peer.issuer?.O ?? peer.issuer?.CN ?? 'unknown issuer';
+    if (authorizationError) {
+      return {
+        check: 'tls', target: label(target), status: 'fail', duration_ms: duration, details,
+        message: `certificate not trusted (${authorizationError}), issued by ${issuer}`,
+        hint: /SELF_SIGNED|UNABLE_TO_GET_ISSUER|UNABLE_TO_VERIFY/.test(authorizationError)
+          ? 'A TLS-inspecting proxy or firewall is probably re-signing traffic: allow-list the backend or set BACKEND_TLS_CA to its CA'
+          : authorizationError === 'CERT_HAS_EXPIRED' ? 'Expired certificate: check this host\'s clock too' : undefined,
+      };
+    }
+    if (hostnameError) {
+      return {
+        check: 'tls', target: label(target), status: 'fail', duration_ms: duration, details,
+        message: `certificate does not match ${target.host}: ${hostnameError.message}`,
+        hint: 'Something on the path answers in the backend\'s place (transparent proxy, captive portal)',
+      };
+    }
+    const pins = config.OUTPUT_TYPE === 'kafka' ? [] : config.BACKEND_TLS_PINS;
+    if (pins.length > 0 && !details.spki_pins.some((pin) => pins.includes(pin))) {
+      return {
+        check: 'tls', target: label(target), status: 'fail', duration_ms: duration, details,
+        message: `certificate does not match BACKEND_TLS_PINS (presented ${details.spki_pins[0]}, issued by ${issuer})`,
+        hint: 'A TLS-inspecting proxy is intercepting the connection: allow-list the backend on it (don\'t pin the proxy\'s key)',
+      };
+    }
+    return {
+      check: 'tls', target: label(target), status: daysLeft < CERT_EXPIRY_WARN_DAYS ? 'warn' : 'ok', duration_ms: duration, details,
+      message: `${details.protocol}, certificate valid for ${daysLeft} more days, issued by ${issuer}${pins.length > 0 ? ', pin matched' : ''}`,
+    };
+  } catch (err) {
+    socket.destroy();
+    const message = (err as Error).message;
+    return {
+      check: 'tls', target: label(target), status: 'fail', message, duration_ms: Date.now() - start,
+      hint: /timed out/.test(message)
+        ? 'TCP works but the handshake hangs: the classic sign of an MTU black hole (see the mtu check) or a DPI device'
+        : /ECONNRESET|socket hang up|disconnected/.test(message)
+          ? 'The connection was reset during the handshake: a firewall filtering by SNI?'
+          : undefined,
+    };
+  }
+}
+
+async function checkHttp(target: Target, timeoutMs: number): Promise<{ result: CheckResult; date: { date: Date; rtt: number } | null }> {
+  const url = `${new URL(target.url!).origin}/v1/collector/rules`;
+  let key = config.CENTINELA_API_KEY ?? '';
+  if (config.CENTINELA_API_KEY_FILE) {
+    try {
+      key = readFileSync(config.CENTINELA_API_KEY_FILE, 'utf8').trim();
+    } catch (err) {
+      return {
+        result: { check: 'http', target: label(target), status: 'fail', duration_ms: 0, message: `cannot read CENTINELA_API_KEY_FILE: ${(err as Error).message}` },
+        date: null,
+      };
+    }
+  }
+
+  const start = Date.now();
+  try {
+    const response = await backendFetch(url, {
+      headers: { Authorization: `Bearer ${key}` },
+      signal: AbortSignal.timeout(timeoutMs),
+    });
+    await response.body?.cancel();
+    const rtt = Date.now() - start;
+    const header = response.headers.get('date');
+    const date = header ? { date: new Date(header), rtt } : null;
+    const details = { status: response.status, server: response.headers.get('server') };
+
+    if (response.status === 401 || response.status === 403) {
+      return {
+        result: {
+          check: 'http', target: label(target), status: 'fail', duration_ms: rtt, details,
+          message: `HTTP ${response.status}: API key rejected`, hint: 'Check CENTINELA_API_KEY (or re-run collector init)',
+        },
+        date,
+      };
+    }
+    if (response.status >= 500 || response.status === 407) {
+      return {
+        result: {
+          check: 'http', target: label(target), status: 'fail', duration_ms: rtt, details,
+          message: `HTTP ${response.status}`,
+          hint: response.status === 407 ? 'An HTTP proxy intercepts the traffic and wants authentication' : 'The backend answered with an error; retry later or contact support',
+        },
+        date,
+      };
+    }
+    return {
+      result: { check: 'http', target: label(target), status: 'ok', duration_ms: rtt, details, message: `HTTP ${response.status}, API key accepted` },
+      date,
+    };
+  } catch (err) {
+    return { result: { check: 'http', target: label(target), status: 'fail', duration_ms: Date.now() - start, message: (err as Error).message }, date: null };
+  }
+}
+
+function checkClock(server: { date: Date; rtt: number } | null): CheckResult {
+  if (!server || Number.isNaN(server.date.getTime())) {
+    return { check: 'clock', target: 'backend', status: 'skip', message: 'no Date header from the backend to compare with', duration_ms: 0 };
+  }
+
+  // The header has 1s resolution and was produced somewhere within the round trip
+  const skew = (Date.now() - server.rtt / 2 - server.date.getTime()) / 1000;
+  const magnitude = Math.abs(skew);
+  const direction = skew > 0 ? 'ahead of' : 'behind';
+  return {
+    check: 'clock', target: 'backend', duration_ms: 0,
+    status: magnitude >= CLOCK_SKEW_FAIL_S ? 'fail' : magnitude >= CLOCK_SKEW_WARN_S ? 'warn' : 'ok',
+    message: magnitude < 1 ? 'in sync (within 1s)' : `local clock ${magnitude.toFixed(0)}s ${direction} the backend`,
+    details: { skew_seconds: Number(skew.toFixed(1)) },
+    hint: magnitude >= CLOCK_SKEW_WARN_S ? 'Enable NTP (timedatectl set-ntp true); received_at timestamps are taken from this clock' : undefined,
+  };
+}
+
+/**
+ * Largest ICMP echo that passes with don't-fragment set (binary search with
+ * Linux ping). Not conclusive when ICMP is filtered, and not possible through
+ * the SOCKS proxy; the local interface MTUs are reported either way.
+ */
+async function checkMtu(target: Target): Promise<CheckResult> {
+  const interfaces = interfaceMtus();
+  if (config.SOCKS_PROXY) {
+    return { check: 'mtu', target: target.host, status: 'skip', message: 'path MTU is not measurable through the SOCKS proxy', duration_ms: 0, details: { interfaces } };
+  }
+
+  const ping = async (size: number): Promise<boolean> => {
+    try {
+      await execFileAsync('ping', ['-M', 'do', '-c', '1', '-W', '2', '-s', String(size), target.host], { timeout: 5000 });
+      return true;
+    } catch {
+      return false;
+    }
+  };
+
+  const start = Date.now();
+  if (!(await ping(56))) {
+    return {
+      check: 'mtu', target: target.host, status: 'skip', duration_ms: Date.now() - start, details: { interfaces },
+      message: 'ICMP echo is not answered (or ping is unavailable); path MTU not measured',
+    };
+  }
+  if (await ping(MTU_PROBE_MAX)) {
+    return {
+      check: 'mtu', target: target.host, status: 'ok', duration_ms: Date.now() - start, details: { path_mtu: MTU_PROBE_MAX + 28, interfaces },
+      message: `full-size packets pass (path MTU ${MTU_PROBE_MAX + 28})`,
+    };
+  }
+
+  let [low, high] = [0, MTU_PROBE_MAX];
+  if (await ping(MTU_PROBE_MIN)) low = MTU_PROBE_MIN;
+  else high = MTU_PROBE_MIN;
+  while (high - low > 1) {
+    const middle = Math.floor((low + high) / 2);
+    if (await ping(middle)) low = middle;
+    else high = middle;
+  }
+  const pathMtu = low > 0 ? low + 28 : null;
+  return {
+    check: 'mtu', target: target.host, status: 'warn', duration_ms: Date.now() - start, details: { path_mtu: pathMtu, interfaces },
+    message: pathMtu ? `path MTU is ${pathMtu}, below 1500` : `even ${MTU_PROBE_MIN + 28}-byte packets don't pass unfragmented`,
+    hint: 'A tunnel (VPN, PPPoE, GRE) on the path: if TLS or large batches hang, lower the interface MTU or enable MSS clamping on the router',
+  };
+}
+
+function interfaceMtus(): Record<string, number> {
+  const mtus: Record<string, number> = {};
+  try {
+    for (const name of readdirSync('/sys/class/net')) {
+      if (name === 'lo') continue;
+      const mtu = Number(readFileSync(`/sys/class/net/${name}/mtu`, 'utf8'));
+      if (Number.isFinite(mtu)) mtus[name] = mtu;
+    }
+  } catch {
+    // Not Linux
+  }
+  return mtus;
+}
@@ -0,0 +1,48 @@
+import { parseArgs } from 'node:util';
+import { browse, SERVICE_TYPES } from '../mdns.js';
+
+/**
+ * `collector discover` - list collectors advertising themselves via mDNS
+ *
+ * Options:
+ *   --timeout <ms>   How long to wait for responses (default 3000)
+ *   --json           Print machine-readable output
+ */
+export async function runDiscover(args: string[]): Promise<void> {
+  const { values } = parseArgs({
+    args,
+    options: {
+      timeout: { type: 'string', default: '3000' },
+      json: { type: 'boolean', default: false },
+    },
+  });
+
+  const timeoutMs = Number(values.timeout);
+  if (!Number.isInteger(timeoutMs) || timeoutMs <= 0) {
+    throw new Error(`Invalid --timeout: ${values.timeout}`);
+  }
+
+  if (!values.json) {
+    console.log(`🔎 Browsing the local network for ${timeoutMs}ms...`);
+  }
+
+  const services = await browse(Object.values(SERVICE_TYPES), timeoutMs);
+
+  if (values.json) {
+    console.log(JSON.stringify(services, null, 2));
+    return;
+  }
+
+  if (services.length === 0) {
+    console.log('No collectors found. Make sure MDNS_ENABLED=true and multicast is allowed on this network.');
+    return;
+  }
+
+  for (const service of services) {
+    const endpoint = service.port !== null ? `${service.host}:${service.port}` : 'unknown endpoint';
+    const addresses = service.addresses.length > 0 ? service.addresses.join(', ') : 'no addresses';
+    const meta = Object.entries(service.txt).map(([key, value]) => `${key}=${value}`).join(' ');
+
+    console.log(`📡 ${service.instance}  ${service.type.replace('.local', '')}  ${endpoint}  [${addresses}]  ${meta}`);
+  }
+}
@@ -0,0 +1,116 @@
+import { readFileSync, writeFileSync } from 'node:fs';
+import { parseArgs } from 'node:util';
+import { importRsyslog } from '../importers/rsyslog.js';
+import { importSyslogNg } from '../importers/syslog-ng.js';
+import type { ImportResult } from '../importers/types.js';
+
+/**
+ * `collector import-config <file>` - migrate from rsyslog / syslog-ng
+ *
+ * Reads a forwarding configuration and generates the equivalent collector
+ * settings (listeners, allowed senders) as a CONFIG_FILE, plus a rule set
+ * with its filters as drop rules, to publish via POST /v1/collector-rules.
+ *
+ * Options:
+ *   --format <rsyslog|syslog-ng>   Input format (detected by default)
+ *   --config-out <path>            Write the collector config (CONFIG_FILE JSON)
+ *   --rules-out <path>             Write the rule set (POST /v1/collector-rules body)
+ *   --json                         Print machine-readable output
+ *
+ * Exit code: 0 fully translated, 1 translated with warnings, 2 error.
+ */
+export async function runImportConfig(args: string[]): Promise<void> {
+  const { values, positionals } = parseArgs({
+    args,
+    allowPositionals: true,
+    options: {
+      format: { type: 'string' },
+      'config-out': { type: 'string' },
+      'rules-out': { type: 'string' },
+      json: { type: 'boolean', default: false },
+    },
+  });
+
+  const [file] = positionals;
+  if (!file) {
+    console.error('Usage: collector import-config <file> [--format rsyslog|syslog-ng] [--config-out <path>] [--rules-out <path>] [--json]');
+    process.exit(2);
+  }
+
+  let text: string;
+  try {
+    text = readFileSync(file, 'utf8');
+  } catch (err) {
+    console.error(`❌ Cannot read ${file}: ${(err as Error).message}`);
+    process.exit(2);
+  }
+
+  const format = values.format ?? detectFormat(text);
+  let result: ImportResult;
+  if (format === 'rsyslog') {
+    result = importRsyslog(text);
+  } else if (format === 'syslog-ng') {
+    result = importSyslogNg(text);
+  } else {
+    console.error(`❌ Unknown format "${format}" (expected rsyslog or syslog-ng)`);
+    process.exit(2);
+  }
+
+  const ruleSet = { rules: result.rules, tests: [], rollout_percent: 0 };
+
+  if (values['config-out']) writeFileSync(values['config-out'], JSON.stringify(result.settings, null, 2) + '\n');
+  if (values['rules-out'] && result.rules.length > 0) writeFileSync(values['rules-out'], JSON.stringify(ruleSet, null, 2) + '\n');
+
+  if (values.json) {
+    console.log(JSON.stringify({
+      format: result.format,
+      config: result.settings,
+      rule_set: ruleSet,
+      replaced_destinations: result.destinations,
+      warnings: result.warnings,
+    }, null, 2));
+  } else {
+    printReport(result, values['config-out'], values['rules-out']);
+    if (!values['config-out']) {
+      console.log('\nCollector config (CONFIG_FILE):');
+      console.log(JSON.stringify(result.settings, null, 2));
+    }
+    if (!values['rules-out'] && result.rules.length > 0) {
+      console.log('\nRule set (publish with POST /v1/collector-rules):');
+      console.log(JSON.stringify(ruleSet, null, 2));
+    }
+  }
+
+  process.exit(result.warnings.length === 0 ? 0 : 1);
+}
+
+/**
+ * syslog-ng configs are built from `source/destination/log { ... };` blocks
+ */
+function detectFormat(text: string): 'rsyslog' | 'syslog-ng' {
+  return /^\s*(@version|source\s+\w+\s*\{|log\s*\{)/m.test(text) ? 'syslog-ng' : 'rsyslog';
+}
+
+function printReport(result: ImportResult, configOut: string | undefined, rulesOut: string | undefined): void {
+  const s = result.settings;
+  console.log(`📥 Imported ${result.format} configuration`);
+  console.log(`   UDP listener: ${s.UDP_ENABLED === 'true' ? `${s.UDP_BIND_ADDRESS ?? '0.0.0.0'}:${s.UDP_PORT}` : 'disabled'}`);
+  console.log(`   TCP listener: ${s.TCP_ENABLED === 'true' ? `${s.TCP_BIND_ADDRESS ?? '0.0.0.0'}:${s.TCP_PORT}` : 'disabled'}`);
+  if (s.ALLOWED_SOURCES) {
+    console.log(`   Allowed senders: ${s.ALLOWED_SOURCES} (others rejected)`);
+  }
+  console.log(`   Drop rules: ${result.rules.length}`);
+
+  if (result.destinations.length > 0) {
+    console.log(`   Replaced destinations (now sent to Centinela): ${[...new Set(result.destinations)].join(', ')}`);
+  }
+  if (configOut) console.log(`   Config written to ${configOut}`);
+  if (rulesOut && result.rules.length > 0) console.log(`   Rule set written to ${rulesOut}`);
+
+  if (result.warnings.length > 0) {
+    console.log(`\n⚠️ ${result.warnings.length} item(s) need manual review:`);
+    for (const warning of result.warnings) {
+      console.log(`   ${warning}`);
+    }
+  }
+}
@@ -0,0 +1,235 @@
+import os from 'node:os';
+import { execFileSync } from 'node:child_process';
+import { existsSync, mkdirSync, realpathSync, writeFileSync } from 'node:fs';
+import { dirname, join, resolve } from 'node:path';
+import { createInterface } from 'node:readline/promises';
+import { parseArgs } from 'node:util';
+import { COLLECTOR_VERSION } from '../version.js';
+import { installWindowsService, WINDOWS_DATA_DIR, WINDOWS_SERVICE_NAME } from './service.js';
+
+const DEFAULT_BACKEND_URL = 'https://api.centinela.cloud';
+const DEFAULT_CONFIG_PATH = process.platform === 'win32' ? join(WINDOWS_DATA_DIR, 'collector.json') : '/etc/centinela/collector.json';
+const PROFILES = ['none', 'edge-small', 'datacenter', 'msp-concentrator'];
+const SERVICE_NAME = 'centinela-collector';
+const SERVICE_UNIT_PATH = `/etc/systemd/system/${SERVICE_NAME}.service`;
+
+interface Enrollment {
+  api_key: string;
+  tenant_id?: string;
+  site_id?: string | null;
+  ingest_url?: string;
+  group?: string | null; // Fleet group, when the enrollment token is bound to one
+}
+
+/**
+ * `collector init` - first-run setup
+ *
+ * Turns an install runbook into one command: exchanges an enrollment token
+ * (created in the console, POST /v1/enrollment-tokens) for this collector's
+ * API key, writes the key file and a CONFIG_FILE, checks that the backend
+ * accepts the key, and optionally installs and starts a systemd unit (or,
+ * on Windows, the service, see `collector service`).
+ * Missing answers are asked interactively on a terminal; everything can be
+ * passed as flags for unattended installs.
+ *
+ * Options:
+ *   --token <token>       Enrollment token (single use)
+ *   --api-key <key>       Use an existing API key instead of enrolling
+ *   --url <url>           Backend base URL (default https://api.centinela.cloud)
+ *   --name <name>         Collector name (default: the host name)
+ *   --group <group>       Fleet group (COLLECTOR_GROUP) whose managed configuration applies;
+ *                         default: the group the enrollment token belongs to, if any
+ *   --profile <profile>   COLLECTOR_PROFILE (none, edge-small, datacenter, msp-concentrator)
+ *   --config <path>       Config file to write (default /etc/centinela/collector.json,
+ *                         Windows: %ProgramData%\Centinela\collector.json);
+ *                         the API key goes to api-key in the same directory
+ *   --install-service     Install and start the systemd unit (Windows: the service)
+ *   --force               Overwrite an existing config file
+ *   --non-interactive     Never prompt; fail if something required is missing
+ *
+ * Exit code: 0 ready, 1 set up but the backend check failed, 2 error.
+ */
+export async function runInit(args: string[]): Promise<void> {
+  const { values } = parseArgs({
+    args,
+    options: {
+      token: { type: 'string' },
+      'api-key': { type: 'string' },
+      url: { type: 'string' },
+      name: { type: 'string' },
+      group: { type: 'string' },
+      profile: { type: 'string' },
+      config: { type: 'string' },
+      'install-service': { type: 'boolean' },
+      force: { type: 'boolean', default: false },
+      'non-interactive': { type: 'boolean', default: false },
+    },
+  });
+
+  const interactive = !values['non-interactive'] && process.stdin.isTTY === true;
+  const prompt = interactive ? createInterface({ input: process.stdin, output: process.stdout }) : null;
+  const ask = async (question: string, fallback = ''): Promise<string> => {
+    if (!prompt) return fallback;
+    const answer = (await prompt.question(fallback ? `${question} [${fallback}]: ` : `${question}: `)).trim();
+    return answer || fallback;
+  };
+  const fail = (message: string): never => {
+    prompt?.close();
+    console.error(`❌ ${message}`);
+    process.exit(2);
+  };
+
+  console.log(`🧭 Centinela collector setup (v${COLLECTOR_VERSION})`);
+
+  // ---- Answers ----
+  let token = values.token;
+  let apiKey = values['api-key'];
+  if (!token && !apiKey) {
+    const answer = await ask('Enrollment token (or an existing API key)');
+    if (answer.startsWith('sk_')) apiKey = answer;
+    else token = answer;
+  }
+  if (!token && !apiKey) fail('An enrollment token (--token) or API key (--api-key) is required');
+
+  const backendUrl = (values.url ?? await ask('Backend URL', DEFAULT_BACKEND_URL)).replace(/\/+$/, '');
+  try {
+    new URL(backendUrl);
+  } catch {
+    fail(`Invalid backend URL: ${backendUrl}`);
+  }
+  const name = values.name ?? await ask('Collector name', os.hostname());
+  if (values.group !== undefined && !/^[\w.-]{1,64}$/.test(values.group)) fail(`Invalid group "${values.group}" (letters, digits, _, . or -)`);
+  const profile = values.profile ?? await ask(`Profile (${PROFILES.join(', ')})`, 'none');
+  if (!PROFILES.includes(profile)) fail(`Unknown profile "${profile}" (expected ${PROFILES.join(', ')})`);
+
+  const configPath = resolve(values.config ?? await ask('Config file', DEFAULT_CONFIG_PATH));
+  const keyPath = join(dirname(configPath), 'api-key');
+  if (existsSync(configPath) && !values.force) {
+    const overwrite = await ask(`${configPath} exists. Overwrite? (y/N)`, 'n');
+    if (!/^y(es)?$/i.test(overwrite)) fail(`${configPath} already exists (use --force to overwrite)`);
+  }
+
+  const windows = process.platform === 'win32';
+  const canInstallService = windows || (process.platform === 'linux' && existsSync('/run/systemd/system'));
+  const installService = values['install-service']
+    ?? (canInstallService && /^y(es)?$/i.test(await ask(`Install and start the ${windows ? 'Windows' : 'systemd'} service? (y/N)`, 'n')));
+  prompt?.close();
+
+  // ---- Enrollment ----
+  let enrollment: Enrollment = { api_key: apiKey ?? '' };
+  if (token) {
+    console.log(`🔐 Enrolling "${name}" with ${backendUrl}...`);
+    try {
+      enrollment = await enroll(backendUrl, token, name, values.group);
+    } catch (err) {
+      fail(`Enrollment failed: ${(err as Error).message}`);
+    }
+    console.log(`   ✅ Enrolled${enrollment.tenant_id ? ` (tenant ${enrollment.tenant_id})` : ''}` +
+      `${enrollment.group ? ` in group ${enrollment.group}` : ''}`);
+  }
+
+  // ---- Files ----
+  const settings: Record<string, string> = {
+    CENTINELA_API_URL: enrollment.ingest_url ?? `${backendUrl}/v1/ingest/syslog`,
+    CENTINELA_API_KEY_FILE: keyPath,
+    COLLECTOR_NAME: name,
+  };
+  if (profile !== 'none') settings.COLLECTOR_PROFILE = profile;
+  if (enrollment.tenant_id) settings.TENANT_ID = enrollment.tenant_id;
+  if (enrollment.site_id) settings.SITE_ID = enrollment.site_id;
+  const group = values.group ?? enrollment.group;
+  if (group) settings.COLLECTOR_GROUP = group;
+
+  try {
+    mkdirSync(dirname(configPath), { recursive: true });
+    writeFileSync(keyPath, `${enrollment.api_key}\n`, { mode: 0o600 });
+    writeFileSync(configPath, JSON.stringify(settings, null, 2) + '\n', { mode: 0o640 });
+  } catch (err) {
+    // The enrollment token is used up: print the key so the install can be finished by hand
+    if (token) console.error(`   API key (store it, it is not shown again): ${enrollment.api_key}`);
+    fail(`Cannot write the configuration: ${(err as Error).message}`);
+  }
+  console.log(`📝 Config written to ${configPath} (API key in ${keyPath})`);
+
+  // ---- Connectivity ----
+  const check = await checkBackend(settings.CENTINELA_API_URL!, enrollment.api_key);
+  console.log(check.ok ? `🌐 Backend reachable, API key accepted` : `⚠️ Backend check failed: ${check.error}`);
+
+  // ---- Service ----
+  if (installService) {
+    if (!canInstallService) fail('systemd was not found; start the collector with CONFIG_FILE set instead');
+    try {
+      if (windows) {
+        installWindowsService(configPath);
+        console.log(`⚙️ Service ${WINDOWS_SERVICE_NAME} installed and started (logs in ${join(WINDOWS_DATA_DIR, 'logs')})`);
+      } else {
+        installUnit(configPath);
+        console.log(`⚙️ Service ${SERVICE_NAME} installed and started (journalctl -u ${SERVICE_NAME} -f)`);
+      }
+    } catch (err) {
+      fail(`Cannot install the service: ${(err as Error).message}`);
+    }
+  } else {
+    console.log(windows
+      ? `\nInstall it as a service with:\n   collector service install --config ${configPath}`
+      : `\nStart the collector with:\n   CONFIG_FILE=${configPath} collector run`);
+  }
+
+  process.exit(check.ok ? 0 : 1);
+}
+
+async function enroll(backendUrl: string, token: string, name: string, group?: string): Promise<Enrollment> {
+  const response = await fetch(`${backendUrl}/v1/collector/enroll`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ token, collector_name: name, collector_version: COLLECTOR_VERSION, group }),
+    signal: AbortSignal.timeout(15000),
+  });
+  const body = await response.json().catch(() => ({})) as Partial<Enrollment> & { error?: string };
+  if (!response.ok) throw new Error(body.error ?? `HTTP ${response.status}`);
+  if (!body.api_key) throw new Error('the backend returned no API key');
+  return body as Enrollment;
+}
+
+/**
+ * Authenticated request that changes nothing: the control channel's rule
+ * endpoint answers 200/204 to a valid key and 401 otherwise
+ */
+async function checkBackend(ingestUrl: string, apiKey: string): Promise<{ ok: boolean; error?: string }> {
+  try {
+    const response = await fetch(`${new URL(ingestUrl).origin}/v1/collector/rules`, {
+      headers: { Authorization: `Bearer ${apiKey}` },
+      signal: AbortSignal.timeout(10000),
+    });
+    if (response.status === 401 || response.status === 403) return { ok: false, error: 'API key rejected' };
+    if (response.status >= 500) return { ok: false, error: `HTTP ${response.status}` };
+    return { ok: true };
+  } catch (err) {
+    return { ok: false, error: (err as Error).message };
+  }
+}
+
+function installUnit(configPath: string): void {
+  const script = realpathSync(process.argv[1]!);
+  writeFileSync(SERVICE_UNIT_PATH, `[Unit]
+Description=Centinela Smart Collector
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=all
+WatchdogSec=120
+Environment=CONFIG_FILE=${configPath}
+ExecStart=${process.execPath} ${script} run
+Restart=always
+RestartSec=5
+AmbientCapabilities=CAP_NET_BIND_SERVICE
+NoNewPrivileges=true
+
+[Install]
+WantedBy=multi-user.target
+`);
+  execFileSync('systemctl', ['daemon-reload'], { stdio: 'inherit' });
+  execFileSync('systemctl', ['enable', '--now', SERVICE_NAME], { stdio: 'inherit' });
+}
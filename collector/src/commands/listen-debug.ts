@@ -0,0 +1,289 @@
+import dgram from 'node:dgram';
+import net from 'node:net';
+import { parseArgs } from 'node:util';
+import { parseStructuredData } from '../parsers/structured-data.js';
+
+/**
+ * `collector listen-debug` - standalone syslog test target
+ *
+ * Listens on UDP and/or TCP and pretty-prints whatever arrives: sender,
+ * decoded PRI (facility.severity), detected format and header fields, TCP
+ * framing, and anything a device commonly gets wrong. Nothing is forwarded,
+ * so a device can be pointed at it before being wired to production.
+ *
+ * Options:
+ *   --port <port>          Port for both protocols (default 5140)
+ *   --bind <address>       Bind address (default 0.0.0.0)
+ *   --protocol <udp|tcp|both>  (default both)
+ *   --hex                  Also print a hex dump of each message
+ *   --json                 Print one JSON object per message
+ */
+
+const FACILITIES = [
+  'kern', 'user', 'mail', 'daemon', 'auth', 'syslog', 'lpr', 'news', 'uucp', 'cron', 'authpriv',
+  'ftp', 'ntp', 'security', 'console', 'solaris-cron', 'local0', 'local1', 'local2', 'local3',
+  'local4', 'local5', 'local6', 'local7',
+];
+const SEVERITIES = ['emerg', 'alert', 'crit', 'err', 'warning', 'notice', 'info', 'debug'];
+
+const MAX_TCP_FRAME = 64 * 1024;
+
+type Framing = 'octet-counting' | 'lf' | 'crlf' | 'nul' | 'none';
+
+interface Decoded {
+  received_at: string;
+  protocol: 'udp' | 'tcp';
+  peer: string;
+  bytes: number;
+  framing?: Framing;
+  pri?: number;
+  facility?: string;
+  severity?: string;
+  format: 'rfc5424' | 'rfc3164' | 'no-pri';
+  timestamp?: string;
+  hostname?: string;
+  app?: string;
+  procid?: string;
+  msgid?: string;
+  structured_data?: unknown;
+  content?: string;
+  message: string;
+  warnings: string[];
+}
+
+export async function runListenDebug(args: string[]): Promise<void> {
+  const { values } = parseArgs({
+    args,
+    options: {
+      port: { type: 'string', default: '5140' },
+      bind: { type: 'string', default: '0.0.0.0' },
+      protocol: { type: 'string', default: 'both' },
+      hex: { type: 'boolean', default: false },
+      json: { type: 'boolean', default: false },
+    },
+  });
+
+  const port = Number(values.port);
+  if (!Number.isInteger(port) || port <= 0 || port > 65535) {
+    throw new Error(`Invalid --port: ${values.port}`);
+  }
+  if (!['udp', 'tcp', 'both'].includes(values.protocol!)) {
+    throw new Error(`Invalid --protocol: ${values.protocol} (expected udp, tcp or both)`);
+  }
+
+  const print = (data: Buffer, decoded: Decoded) => {
+    if (values.json) {
+      console.log(JSON.stringify(values.hex ? { ...decoded, hex: data.toString('hex') } : decoded));
+    } else {
+      printMessage(decoded, values.hex ? data : null);
+    }
+  };
+
+  if (values.protocol !== 'tcp') {
+    const socket = dgram.createSocket(net.isIPv6(values.bind!) ? 'udp6' : 'udp4');
+    socket.on('message', (data, rinfo) => {
+      print(data, decode(data, 'udp', `${rinfo.address}:${rinfo.port}`));
+    });
+    await new Promise<void>((resolve, reject) => {
+      socket.once('error', reject);
+      socket.bind(port, values.bind, () => resolve());
+    });
+    if (!values.json) console.log(`👂 Listening on udp://${values.bind}:${port}`);
+  }
+
+  if (values.protocol !== 'udp') {
+    const server = net.createServer((socket) => handleTcp(socket, print, !values.json));
+    await new Promise<void>((resolve, reject) => {
+      server.once('error', reject);
+      server.listen(port, values.bind, () => resolve());
+    });
+    if (!values.json) console.log(`👂 Listening on tcp://${values.bind}:${port}`);
+  }
+
+  if (!values.json) console.log('   Nothing is forwarded. Press Ctrl+C to stop.\n');
+  process.on('SIGINT', () => process.exit(0));
+}
+
+function handleTcp(socket: net.Socket, print: (data: Buffer, decoded: Decoded) => void, verbose: boolean): void {
+  const peer = `${socket.remoteAddress}:${socket.remotePort}`;
+  let pending = Buffer.alloc(0);
+  let framing: Framing | null = null;
+
+  if (verbose) console.log(`🔌 TCP connection from ${peer}`);
+
+  socket.on('data', (data: Buffer) => {
+    pending = Buffer.concat([pending, data]);
+
+    for (;;) {
+      // Octet counting (RFC 6587 3.4.1): "<length> <message>"; anything else is delimited
+      framing ??= /^\d/.test(pending.toString('latin1', 0, 1)) ? 'octet-counting' : null;
+
+      if (framing === 'octet-counting') {
+        const space = pending.indexOf(0x20);
+        if (space < 0) break;
+        const length = Number(pending.toString('latin1', 0, space));
+        if (!Number.isInteger(length) || length > MAX_TCP_FRAME) {
+          console.log(`⚠️ ${peer}: invalid octet count "${pending.toString('latin1', 0, Math.min(space, 20))}", closing`);
+          socket.destroy();
+          return;
+        }
+        if (pending.length < space + 1 + length) break;
+
+        const frame = pending.subarray(space + 1, space + 1 + length);
+        pending = pending.subarray(space + 1 + length);
+        print(frame, decode(frame, 'tcp', peer, framing));
+        continue;
+      }
+
+      const end = pending.findIndex((byte) => byte === 0x0a || byte === 0x00);
+      if (end < 0) {
+        if (pending.length > MAX_TCP_FRAME) {
+          console.log(`⚠️ ${peer}: ${pending.length} bytes without a delimiter (LF, CRLF or NUL expected)`);
+          pending = Buffer.alloc(0);
+        }
+        break;
+      }
+
+      const delimiter: Framing = pending[end] === 0x00 ? 'nul' : end > 0 && pending[end - 1] === 0x0d ? 'crlf' : 'lf';
+      const frame = pending.subarray(0, delimiter === 'crlf' ? end - 1 : end);
+      pending = pending.subarray(end + 1);
+      if (frame.length > 0) print(frame, decode(frame, 'tcp', peer, delimiter));
+    }
+  });
+
+  socket.on('close', () => {
+    if (pending.length > 0) {
+      print(pending, decode(pending, 'tcp', peer, 'none'));
+    }
+    if (verbose) console.log(`🔌 TCP connection closed from ${peer}`);
+  });
+  socket.on('error', () => socket.destroy());
+}
+
+function decode(data: Buffer, protocol: 'udp' | 'tcp', peer: string, framing?: Framing): Decoded {
+  const message = data.toString('utf8');
+  const decoded: Decoded = {
+    received_at: new Date().toISOString(),
+    protocol,
+    peer,
+    bytes: data.length,
+    ...(framing && { framing }),
+    format: 'no-pri',
+    message,
+    warnings: [],
+  };
+  const warn = (warning: string) => decoded.warnings.push(warning);
+
+  if (message.includes('\uFFFD')) warn('Not valid UTF-8 (check the device character set)');
+  if (framing === 'none') warn('Connection closed with an unterminated message (no trailing LF)');
+  if (framing === 'nul') warn('NUL-delimited frames: accepted by some receivers only, prefer LF');
+  if (protocol === 'udp' && data.length > 1472) warn(`${data.length} bytes over UDP: likely fragmented or truncated on the way, prefer TCP`);
+
+  const pri = /^<(\d{1,3})>/.exec(message);
+  if (!pri) {
+    warn('No <PRI> header: the device is not sending syslog format (raw text?)');
+    return decoded;
+  }
+
+  decoded.pri = Number(pri[1]);
+  if (decoded.pri > 191) {
+    warn(`PRI ${decoded.pri} out of range (0-191)`);
+  } else {
+    decoded.facility = FACILITIES[decoded.pri >> 3];
+    decoded.severity = SEVERITIES[decoded.pri & 7];
+  }
+
+  const rest = message.slice(pri[0].length);
+
+  // RFC 5424: VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP SD [SP MSG]
+  const header = /^1 (\S+) (\S+) (\S+) (\S+) (\S+) /.exec(rest);
+  if (header) {
+    decoded.format = 'rfc5424';
+    decoded.timestamp = header[1];
+    decoded.hostname = header[2];
+    decoded.app = header[3];
+    decoded.procid = header[4];
+    decoded.msgid = header[5];
+
+    const sd = parseStructuredData(rest, header[0].length);
+    if (!sd) {
+      warn('Invalid STRUCTURED-DATA (use "-" when there is none)');
+      decoded.content = rest.slice(header[0].length);
+    } else {
+      if (Object.keys(sd.data).length > 0) decoded.structured_data = sd.data;
+      decoded.content = rest.slice(sd.end).replace(/^ /, '').replace(/^\uFEFF/, '');
+    }
+
+    if (decoded.timestamp !== '-' && Number.isNaN(Date.parse(decoded.timestamp!))) {
+      warn(`Timestamp "${decoded.timestamp}" is not RFC 3339`);
+    } else if (decoded.timestamp !== '-' && !/(Z|[+-]\d\d:\d\d)$/.test(decoded.timestamp!)) {
+      warn('Timestamp without time zone');
+    }
+    if (decoded.hostname === '-') warn('No HOSTNAME: the source IP will identify the device');
+    return decoded;
+  }
+
+  if (/^1 /.test(rest)) {
+    warn('Looks like RFC 5424 but the header is incomplete');
+  }
+
+  // RFC 3164: TIMESTAMP ("Mmm dd hh:mm:ss") SP HOSTNAME SP TAG[PID]: MSG
+  decoded.format = 'rfc3164';
+  const bsd = /^([A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d) (\S+) (.*)$/s.exec(rest);
+  if (!bsd) {
+    warn('No RFC 3164 timestamp/hostname after the PRI: the collector will use the receive time and the source IP');
+    decoded.content = rest;
+    return decoded;
+  }
+
+  decoded.timestamp = bsd[1];
+  decoded.hostname = bsd[2];
+  const tag = /^([^:[\s]{1,48})(?:\[([^\]]+)\])?: ?(.*)$/s.exec(bsd[3]!);
+  if (tag) {
+    decoded.app = tag[1];
+    decoded.procid = tag[2];
+    decoded.content = tag[3];
+  } else {
+    decoded.content = bsd[3];
+  }
+
+  if (/:$/.test(decoded.hostname!)) warn('HOSTNAME ends with ":" (the device probably omits the hostname)');
+  warn('RFC 3164 timestamps have no year or time zone: prefer RFC 5424 when the device supports it');
+  return decoded;
+}
+
+function printMessage(decoded: Decoded, data: Buffer | null): void {
+  const rows: [string, string | undefined][] = [
+    ['PRI', decoded.pri !== undefined ? `<${decoded.pri}> ${decoded.facility ?? '?'}.${decoded.severity ?? '?'}` : undefined],
+    ['Format', { rfc5424: 'RFC 5424', rfc3164: 'RFC 3164 (BSD)', 'no-pri': 'not syslog' }[decoded.format]],
+    ['Framing', decoded.framing],
+    ['Timestamp', decoded.timestamp],
+    ['Hostname', decoded.hostname],
+    ['App', decoded.app],
+    ['Proc ID', decoded.procid],
+    ['Msg ID', decoded.msgid],
+    ['SD', decoded.structured_data ? JSON.stringify(decoded.structured_data) : undefined],
+    ['Message', decoded.content ?? decoded.message],
+  ];
+
+  console.log(`── ${decoded.received_at}  ${decoded.protocol} ${decoded.peer}  (${decoded.bytes} bytes)`);
+  for (const [label, value] of rows) {
+    if (value !== undefined && value !== '-') console.log(`   ${label.padEnd(10)} ${value}`);
+  }
+  for (const warning of decoded.warnings) {
+    console.log(`   ⚠️ ${warning}`);
+  }
+  if (data) console.log(hexDump(data));
+  console.log('');
+}
+
+function hexDump(data: Buffer): string {
+  const lines: string[] = [];
+  for (let offset = 0; offset < data.length; offset += 16) {
+    const chunk = data.subarray(offset, offset + 16);
+    const hex = Array.from(chunk, (byte) => byte.toString(16).padStart(2, '0')).join(' ');
+    const ascii = Array.from(chunk, (byte) => (byte >= 0x20 && byte < 0x7f ? String.fromCharCode(byte) : '.')).join('');
+    lines.push(`   ${offset.toString(16).padStart(6, '0')}  ${hex.padEnd(47)}  ${ascii}`);
+  }
+  return lines.join('\n');
+}
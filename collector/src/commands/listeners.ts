@@ -0,0 +1,82 @@
+import { parseArgs } from 'node:util';
+import { config } from '../config.js';
+import type { NamedListenerStatus } from '../named-listeners.js';
+
+/**
+ * `collector listeners list|add <spec>|remove <name>` - named listeners at runtime
+ *
+ * Talks to the running collector's health server (GET/POST /listeners). A
+ * spec uses the LISTENERS syntax (name:udp|tcp:port[:tenant=..][:site=..]...).
+ * Listeners added this way last until the collector restarts: add them to
+ * LISTENERS too to keep them. Removing one closes its socket (and its TCP
+ * connections) without touching the others.
+ *
+ * Options:
+ *   --url <url>      Running collector's health server (default http://127.0.0.1:HEALTH_PORT)
+ *   --token <token>  Admin token (default ADMIN_TOKEN)
+ *   --json           Print machine-readable output
+ *
+ * Exit code: 0 success, 2 error.
+ */
+export async function runListeners(args: string[]): Promise<void> {
+  const { values, positionals } = parseArgs({
+    args,
+    allowPositionals: true,
+    options: {
+      url: { type: 'string', default: `http://127.0.0.1:${config.HEALTH_PORT}` },
+      token: { type: 'string', default: config.ADMIN_TOKEN },
+      json: { type: 'boolean', default: false },
+    },
+  });
+
+  const [action, target] = positionals;
+  if (!(action === 'list' && !target) && !((action === 'add' || action === 'remove') && target)) {
+    console.error('Usage: collector listeners list|add <name:udp|tcp:port[:options]>|remove <name> [--url <health-url>] [--token <admin-token>] [--json]');
+    process.exit(2);
+  }
+
+  const endpoint = `${values.url}/listeners`;
+  let state: { listeners: NamedListenerStatus[]; added?: NamedListenerStatus; removed?: string };
+  try {
+    const response = await fetch(endpoint, action === 'list'
+      ? { signal: AbortSignal.timeout(5000) }
+      : {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          ...(values.token && { 'Authorization': `Bearer ${values.token}` }),
+        },
+        body: JSON.stringify({ [action]: target }),
+        signal: AbortSignal.timeout(10000),
+      });
+    const body = await response.json() as typeof state & { error?: string };
+    if (!response.ok) throw new Error(body.error ?? `HTTP ${response.status}`);
+    state = body;
+  } catch (err) {
+    console.error(`❌ Listeners ${action} failed (${endpoint}): ${(err as Error).message}`);
+    process.exit(2);
+  }
+
+  if (values.json) {
+    console.log(JSON.stringify(state, null, 2));
+    process.exit(0);
+  }
+  if (state.added) console.log(`➕ ${state.added.name} listening on ${state.added.transport}/${state.added.port} (until restart: add it to LISTENERS to keep it)`);
+  if (state.removed) console.log(`➖ ${state.removed} removed`);
+  if (action !== 'list') process.exit(0);
+
+  if (state.listeners.length === 0) {
+    console.log('No named listeners (LISTENERS).');
+  }
+  for (const listener of state.listeners) {
+    const labels = [
+      listener.tenant && `tenant=${listener.tenant}`,
+      listener.site && `site=${listener.site}`,
+      listener.source && `source=${listener.source}`,
+      listener.connections !== null && `${listener.connections} connections`,
+      listener.origin === 'admin' && 'added at runtime',
+    ].filter(Boolean).join(', ');
+    console.log(`${listener.listening ? '🟢' : '🔴'} ${listener.name} ${listener.transport}/${listener.port}${labels ? ` (${labels})` : ''}`);
+  }
+  process.exit(0);
+}
@@ -0,0 +1,71 @@
+import { parseArgs } from 'node:util';
+import { config } from '../config.js';
+import type { MaintenanceStats } from '../maintenance.js';
+
+/**
+ * `collector maintenance on|off|status` - toggle maintenance mode
+ *
+ * Talks to the running collector's health server (POST /maintenance). While
+ * on, nothing is forwarded and events are spooled to disk; they are replayed
+ * when the window ends.
+ *
+ * Options:
+ *   --duration <d>   Window length, e.g. 30m or 2h (default and cap: MAINTENANCE_MAX_DURATION_MS)
+ *   --reason <text>  Shown in status and logs
+ *   --url <url>      Running collector's health server (default http://127.0.0.1:HEALTH_PORT)
+ *   --token <token>  Admin token (default ADMIN_TOKEN)
+ *   --json           Print machine-readable output
+ *
+ * Exit code: 0 success, 2 error.
+ */
+export async function runMaintenance(args: string[]): Promise<void> {
+  const [action, ...rest] = args;
+  if (action !== 'on' && action !== 'off' && action !== 'status') {
+    console.error('Usage: collector maintenance on|off|status [--duration 2h] [--reason <text>] [--url <health-url>] [--token <admin-token>] [--json]');
+    process.exit(2);
+  }
+
+  const { values } = parseArgs({
+    args: rest,
+    options: {
+      duration: { type: 'string' },
+      reason: { type: 'string' },
+      url: { type: 'string', default: `http://127.0.0.1:${config.HEALTH_PORT}` },
+      token: { type: 'string', default: config.ADMIN_TOKEN },
+      json: { type: 'boolean', default: false },
+    },
+  });
+
+  let state: MaintenanceStats;
+  try {
+    const response = await fetch(`${values.url}/maintenance`, action === 'status'
+      ? { signal: AbortSignal.timeout(5000) }
+      : {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          ...(values.token && { 'Authorization': `Bearer ${values.token}` }),
+        },
+        body: JSON.stringify({ enabled: action === 'on', duration: values.duration, reason: values.reason }),
+        signal: AbortSignal.timeout(5000),
+      });
+    const body = await response.json() as MaintenanceStats & { error?: string };
+    if (!response.ok) throw new Error(body.error ?? `HTTP ${response.status}`);
+    state = body;
+  } catch (err) {
+    console.error(`❌ Maintenance ${action} failed (${values.url}/maintenance): ${(err as Error).message}`);
+    process.exit(2);
+  }
+
+  if (values.json) {
+    console.log(JSON.stringify(state, null, 2));
+  } else if (state.active) {
+    console.log(`🚧 Maintenance mode ON until ${state.until} (${state.remaining_seconds}s left, ${state.source}${state.reason ? `: ${state.reason}` : ''})`);
+    console.log(`   ${state.spooled} events spooled (${state.spool_bytes} bytes); nothing is forwarded.`);
+  } else {
+    console.log('✅ Maintenance mode off: forwarding normally.');
+    if (state.spooled > 0) console.log(`   Replaying ${state.spooled} spooled events.`);
+    if (state.last_error) console.log(`   ⚠️ Last error: ${state.last_error}`);
+  }
+  process.exit(0);
+}
@@ -0,0 +1,230 @@
+import path from 'node:path';
+import { createReadStream } from 'node:fs';
+import { access, readdir } from 'node:fs/promises';
+import { createInterface } from 'node:readline';
+import { createGunzip } from 'node:zlib';
+import { parseArgs } from 'node:util';
+import { config } from '../config.js';
+import type { SyslogEvent } from '../buffer.js';
+import { CidrList, isValidCidr } from '../cidr.js';
+
+const STORES = ['dead-letter', 'archive', 'maintenance', 'wal'] as const;
+
+type Store = (typeof STORES)[number] | 'file';
+
+interface SearchFile {
+  store: Store;
+  file: string;
+}
+
+// What an event in any of the stores has (archive lines are ingest payloads)
+type StoredEvent = Pick<SyslogEvent, 'raw_message' | 'received_at' | 'source_ip' | 'syslog' | 'tenant_id' | 'site_id'> & { event_id?: string };
+
+interface Match {
+  store: Store;
+  file: string;
+  event: StoredEvent;
+  dead_letter?: { dead_lettered_at: string; status: number | null; error: string };
+}
+
+/**
+ * `collector search` - find events in the collector's local files
+ *
+ * Answers "did the device actually send it?" on site, without backend
+ * access: scans the dead-letter file (and its rotated copy), archive objects
+ * waiting for upload (ARCHIVE_SPOOL_DIR), the maintenance spool and the
+ * write-ahead log (recent events, sent or not), and prints the events matching a receive-time range, a
+ * source and a regex, oldest store first. Files given as arguments (e.g.
+ * archive objects downloaded from the bucket, .ndjson.gz) are searched
+ * instead. The collector doesn't need to be running.
+ *
+ * Options:
+ *   --from <time>      Received at or after: ISO 8601, or a duration ago (90s, 30m, 2h, 7d)
+ *   --to <time>        Received before (same syntax)
+ *   --source <s>       Sender IP or CIDR range, or the hostname in the syslog header
+ *   --grep <regex>     Matches the raw message (case-insensitive with -i)
+ *   -i                 Case-insensitive --grep
+ *   --in <stores>      Comma-separated: dead-letter, archive, maintenance, wal (default: all)
+ *   --limit <n>        Stop after n matches (default 100, 0 = no limit)
+ *   --json             Print one JSON object per match (store, file, event)
+ *
+ * Exit code: 0 matches found, 1 none, 2 error.
+ */
+export async function runSearch(args: string[]): Promise<void> {
+  const usage = 'Usage: collector search [--from <time>] [--to <time>] [--source <ip|cidr|hostname>] [--grep <regex> [-i]] ' +
+    `[--in ${STORES.join(',')}] [--limit 100] [--json] [file...]`;
+  let parsed;
+  try {
+    parsed = parseArgs({
+      args,
+      allowPositionals: true,
+      options: {
+        from: { type: 'string' },
+        to: { type: 'string' },
+        source: { type: 'string' },
+        grep: { type: 'string' },
+        i: { type: 'boolean', short: 'i', default: false },
+        in: { type: 'string', default: STORES.join(',') },
+        limit: { type: 'string', default: '100' },
+        json: { type: 'boolean', default: false },
+      },
+    });
+  } catch (err) {
+    console.error(`${(err as Error).message}\n${usage}`);
+    process.exit(2);
+  }
+  const { values, positionals } = parsed;
+
+  const from = values.from === undefined ? null : parseTime(values.from);
+  const to = values.to === undefined ? null : parseTime(values.to);
+  const stores = values.in.split(',').map((store) => store.trim());
+  const limit = Number(values.limit);
+  let pattern: RegExp | null = null;
+  try {
+    if (values.grep !== undefined) pattern = new RegExp(values.grep, values.i ? 'i' : '');
+  } catch (err) {
+    console.error(`❌ Invalid --grep: ${(err as Error).message}`);
+    process.exit(2);
+  }
+  if (Number.isNaN(from) || Number.isNaN(to) || !Number.isInteger(limit) || limit < 0 ||
+    !stores.every((store) => (STORES as readonly string[]).includes(store))) {
+    console.error(usage);
+    process.exit(2);
+  }
+
+  const source = values.source;
+  const addresses = source !== undefined && isValidCidr(source) ? new CidrList([source]) : null;
+  const matches = (event: StoredEvent): boolean => {
+    const receivedAt = Date.parse(event.received_at);
+    if (from !== null && !(receivedAt >= from)) return false;
+    if (to !== null && !(receivedAt < to)) return false;
+    if (addresses && !addresses.contains(event.source_ip)) return false;
+    if (source !== undefined && !addresses && event.syslog?.hostname?.toLowerCase() !== source.toLowerCase()) return false;
+    return pattern === null || pattern.test(event.raw_message);
+  };
+
+  const files = positionals.length > 0
+    ? positionals.map((file): SearchFile => ({ store: 'file', file }))
+    : await localFiles(stores as Array<(typeof STORES)[number]>);
+  if (files.length === 0) {
+    console.error('Nothing to search: no dead-letter file, archive spool, maintenance spool or write-ahead log here ' +
+      '(set STATE_DIR, or pass files)');
+    process.exit(1);
+  }
+
+  let found = 0;
+  let scanned = 0;
+  let unreadable = 0;
+  for (const { store, file } of files) {
+    if (limit > 0 && found >= limit) break;
+    try {
+      for await (const line of lines(file)) {
+        const match = parseLine(store, file, line);
+        if (!match) continue;
+        scanned++;
+        if (!matches(match.event)) continue;
+
+        found++;
+        print(match, values.json);
+        if (limit > 0 && found >= limit) break;
+      }
+    } catch (err) {
+      unreadable++;
+      console.error(`⚠️ Cannot read ${file}: ${(err as Error).message}`);
+    }
+  }
+
+  console.error(`${found} match${found === 1 ? '' : 'es'} in ${scanned} events, ${files.length - unreadable} file(s)` +
+    (limit > 0 && found >= limit ? ` (stopped at --limit ${limit})` : ''));
+  process.exit(found > 0 ? 0 : unreadable === files.length ? 2 : 1);
+}
+
+/**
+ * The local stores' files that exist, oldest first within each store
+ */
+async function localFiles(stores: Array<(typeof STORES)[number]>): Promise<SearchFile[]> {
+  const inDir = async (dir: string | undefined, pattern: RegExp): Promise<string[]> => {
+    if (!dir) return [];
+    const names = await readdir(dir).catch(() => [] as string[]);
+    return names.filter((name) => pattern.test(name)).sort().map((name) => path.join(dir, name));
+  };
+  const existing = async (candidates: string[]): Promise<string[]> => {
+    const present = await Promise.all(candidates.map((file) => access(file).then(() => true, () => false)));
+    return candidates.filter((_, index) => present[index]);
+  };
+
+  const files: SearchFile[] = [];
+  for (const store of stores) {
+    let found: string[] = [];
+    if (store === 'dead-letter' && config.DEAD_LETTER_FILE) {
+      found = await existing([`${config.DEAD_LETTER_FILE}.1`, config.DEAD_LETTER_FILE]);
+    } else if (store === 'archive') {
+      found = await inDir(config.ARCHIVE_SPOOL_DIR, /\.ndjson\.gz$/);
+    } else if (store === 'maintenance') {
+      found = await inDir(config.MAINTENANCE_SPOOL_DIR, /^spool\.ndjson$/);
+    } else if (store === 'wal') {
+      found = await inDir(config.WAL_DIR, /^segment-\d+\.ndjson$/);
+    }
+    files.push(...found.map((file) => ({ store, file })));
+  }
+  return files;
+}
+
+async function* lines(file: string): AsyncGenerator<string> {
+  const stream = createReadStream(file);
+  const input = file.endsWith('.gz') ? stream.pipe(createGunzip()) : stream;
+  stream.on('error', (err) => input.destroy(err));
+  yield* createInterface({ input, crlfDelay: Infinity });
+}
+
+/**
+ * One stored record: a WAL line (checksum, tab, event), a dead-letter
+ * record, or an event/ingest payload (spools, archive objects)
+ */
+function parseLine(store: Store, file: string, line: string): Match | null {
+  if (!line.trim()) return null;
+  const json = /^[0-9a-f]{8}\t/.test(line) ? line.slice(9) : line;
+  let record: Record<string, unknown>;
+  try {
+    record = JSON.parse(json) as Record<string, unknown>;
+  } catch {
+    return null; // Torn write
+  }
+
+  if (record.dead_lettered_at && record.event) {
+    return {
+      store,
+      file,
+      event: record.event as StoredEvent,
+      dead_letter: {
+        dead_lettered_at: String(record.dead_lettered_at),
+        status: (record.status as number | null) ?? null,
+        error: String(record.error ?? ''),
+      },
+    };
+  }
+  if (typeof record.raw_message !== 'string') return null;
+  return { store, file, event: record as unknown as StoredEvent };
+}
+
+function print(match: Match, json: boolean): void {
+  if (json) {
+    console.log(JSON.stringify(match));
+    return;
+  }
+  const { event } = match;
+  const note = match.dead_letter ? ` refused: ${match.dead_letter.error}` : '';
+  console.log(`${event.received_at} ${event.source_ip.padEnd(15)} [${match.store}${note}] ${event.raw_message}`);
+}
+
+/**
+ * An ISO 8601 timestamp, or a duration ago ("90s", "30m", "2h", "7d")
+ */
+function parseTime(value: string): number {
+  const match = /^(\d+)(s|m|h|d)$/.exec(value.trim());
+  if (match) {
+    const units = { s: 1000, m: 60000, h: 3600000, d: 86400000 };
+    return Date.now() - Number(match[1]) * units[match[2] as keyof typeof units];
+  }
+  return Date.parse(value);
+}
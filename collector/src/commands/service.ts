@@ -0,0 +1,123 @@
+import { execFileSync } from 'node:child_process';
+import { existsSync, mkdirSync, realpathSync, writeFileSync } from 'node:fs';
+import { dirname, join, resolve } from 'node:path';
+import { parseArgs } from 'node:util';
+
+export const WINDOWS_SERVICE_NAME = 'centinela-collector';
+export const WINDOWS_DATA_DIR = join(process.env.ProgramData ?? 'C:\\ProgramData', 'Centinela');
+
+// WinSW, shipped next to node.exe in the Windows package; its XML must sit beside it with the same name
+const WRAPPER_NAME = 'centinela-collector-service';
+const STOP_TIMEOUT_SECONDS = 90; // Above SHUTDOWN_TIMEOUT_MS, like systemd's TimeoutStopSec
+
+function escapeXml(value: string): string {
+  return value.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;');
+}
+
+function wrapperPath(override?: string): string {
+  return resolve(override ?? join(dirname(process.execPath), `${WRAPPER_NAME}.exe`));
+}
+
+/**
+ * Register the collector as a Windows service (automatic start, restarted on
+ * failure, LocalSystem) and start it
+ */
+export function installWindowsService(configPath: string, wrapper = wrapperPath()): void {
+  if (!existsSync(wrapper)) {
+    throw new Error(`service wrapper not found at ${wrapper} (it ships with the Windows package; pass --wrapper <WinSW exe>)`);
+  }
+
+  const script = realpathSync(process.argv[1]!);
+  const logDir = join(WINDOWS_DATA_DIR, 'logs');
+  mkdirSync(logDir, { recursive: true });
+  writeFileSync(wrapper.replace(/\.exe$/i, '.xml'), `<service>
+  <id>${WINDOWS_SERVICE_NAME}</id>
+  <name>Centinela Collector</name>
+  <description>Centinela Smart Collector</description>
+  <executable>${escapeXml(process.execPath)}</executable>
+  <arguments>"${escapeXml(script)}" run</arguments>
+  <env name="CONFIG_FILE" value="${escapeXml(configPath)}"/>
+  <startmode>Automatic</startmode>
+  <delayedAutoStart>true</delayedAutoStart>
+  <onfailure action="restart" delay="5 sec"/>
+  <stoptimeout>${STOP_TIMEOUT_SECONDS} sec</stoptimeout>
+  <logpath>${escapeXml(logDir)}</logpath>
+  <log mode="roll-by-size">
+    <sizeThreshold>10240</sizeThreshold>
+    <keepFiles>8</keepFiles>
+  </log>
+</service>
+`);
+  execFileSync(wrapper, ['install'], { stdio: 'inherit' });
+  execFileSync(wrapper, ['start'], { stdio: 'inherit' });
+}
+
+/**
+ * `collector service` - run the collector as a Windows service
+ *
+ * Node can't answer the Service Control Manager itself, so the service is
+ * hosted by WinSW, shipped in the Windows package as
+ * centinela-collector-service.exe next to node.exe. install writes its
+ * configuration (CONFIG_FILE, automatic delayed start, restart after 5s on
+ * failure, logs rolled under %ProgramData%\Centinela\logs) and registers and
+ * starts the service. Stopping it sends Ctrl+C, which the collector handles
+ * like SIGINT: listeners close and the buffer is drained within
+ * SHUTDOWN_TIMEOUT_MS. On Linux, use `collector init --install-service`.
+ *
+ * Usage:
+ *   collector service install [--config <file>] [--wrapper <exe>]
+ *   collector service uninstall|start|stop|restart|status [--wrapper <exe>]
+ *
+ * --config defaults to %ProgramData%\Centinela\collector.json (what
+ * `collector init` writes on Windows). Needs an elevated prompt.
+ */
+export async function runService(args: string[]): Promise<void> {
+  const { values, positionals } = parseArgs({
+    args,
+    allowPositionals: true,
+    options: {
+      config: { type: 'string' },
+      wrapper: { type: 'string' },
+    },
+  });
+  const usage = 'Usage: collector service install [--config <file>] [--wrapper <exe>] | uninstall | start | stop | restart | status';
+  const action = positionals[0];
+
+  if (process.platform !== 'win32') {
+    console.error('collector service manages the Windows service; on Linux use `collector init --install-service` (systemd)');
+    process.exit(2);
+  }
+
+  const wrapper = wrapperPath(values.wrapper);
+  try {
+    switch (action) {
+      case 'install': {
+        const configPath = resolve(values.config ?? join(WINDOWS_DATA_DIR, 'collector.json'));
+        if (!existsSync(configPath)) {
+          console.error(`${configPath} not found: run \`collector init\` first, or pass --config`);
+          process.exit(2);
+        }
+        installWindowsService(configPath, wrapper);
+        console.log(`⚙️ Service ${WINDOWS_SERVICE_NAME} installed and started (logs in ${join(WINDOWS_DATA_DIR, 'logs')})`);
+        break;
+      }
+      case 'uninstall':
+        execFileSync(wrapper, ['stop'], { stdio: 'inherit' });
+        execFileSync(wrapper, ['uninstall'], { stdio: 'inherit' });
+        console.log(`⚙️ Service ${WINDOWS_SERVICE_NAME} removed`);
+        break;
+      case 'start':
+      case 'stop':
+      case 'restart':
+      case 'status':
+        execFileSync(wrapper, [action], { stdio: 'inherit' });
+        break;
+      default:
+        console.error(usage);
+        process.exit(2);
+    }
+  } catch (err) {
+    console.error(`❌ ${(err as Error).message}`);
+    process.exit(1);
+  }
+}
@@ -0,0 +1,155 @@
+import http from 'node:http';
+import { parseArgs } from 'node:util';
+import { TRAFFIC_PROFILES } from '../simulation/profiles.js';
+
+const REPORT_INTERVAL_MS = 10000;
+
+/**
+ * `collector simulate` - run the collector on generated traffic
+ *
+ * Starts the collector with SIMULATION_PROFILE set, so a bundled traffic
+ * profile flows through the whole pipeline at the given rate (see
+ * simulation.ts). With --mock-backend, batches go to a mock backend in this
+ * process that accepts everything and reports the throughput it sees,
+ * instead of CENTINELA_API_URL: for demos and capacity tests on a laptop.
+ * The rest of the configuration (.env, CONFIG_FILE) applies as usual.
+ *
+ * Options:
+ *   --profile <name>  mixed (default), firewall, windows, linux-auth
+ *   --eps <n>         Events per second (default 100)
+ *   --duration <d>    Stop after e.g. 90s, 10m or 2h, then shut down gracefully (default: until Ctrl-C)
+ *   --mock-backend    Forward to a local mock backend
+ *   --mock-port <n>   Its port (default: any free port)
+ *   --list            Print the bundled profiles
+ *
+ * Exit code: 0 when stopped, 2 on invalid options.
+ */
+export async function runSimulate(args: string[]): Promise<void> {
+  const { values } = parseArgs({
+    args,
+    options: {
+      profile: { type: 'string', default: 'mixed' },
+      eps: { type: 'string', default: '100' },
+      duration: { type: 'string' },
+      'mock-backend': { type: 'boolean', default: false },
+      'mock-port': { type: 'string', default: '0' },
+      list: { type: 'boolean', default: false },
+    },
+  });
+
+  if (values.list) {
+    for (const [name, profile] of Object.entries(TRAFFIC_PROFILES)) {
+      console.log(`${name.padEnd(12)}${profile.description}`);
+    }
+    process.exit(0);
+  }
+
+  const usage = 'Usage: collector simulate [--profile mixed|firewall|windows|linux-auth] [--eps 100] [--duration 10m] [--mock-backend [--mock-port <n>]] [--list]';
+  const eps = Number(values.eps);
+  const durationMs = values.duration === undefined ? 0 : parseDuration(values.duration);
+  if (!TRAFFIC_PROFILES[values.profile] || !Number.isInteger(eps) || eps <= 0 || durationMs === null) {
+    console.error(usage);
+    process.exit(2);
+  }
+
+  // Read by the configuration when the collector is loaded below
+  process.env.SIMULATION_PROFILE = values.profile;
+  process.env.SIMULATION_EPS = String(eps);
+  process.env.SIMULATION_DURATION_MS = String(durationMs);
+
+  if (values['mock-backend']) {
+    const port = await startMockBackend(Number(values['mock-port']));
+    process.env.CENTINELA_API_URL = `http://127.0.0.1:${port}/v1/ingest/syslog`;
+    process.env.OUTPUT_TYPE = 'http';
+    process.env.BACKEND_ENDPOINTS = '';
+    if (!process.env.CENTINELA_API_KEY_FILE) process.env.CENTINELA_API_KEY = 'simulation';
+    console.log(`🧪 Mock backend on http://127.0.0.1:${port} (accepts every batch)`);
+  }
+
+  const { runCollector } = await import('../collector.js');
+  await runCollector();
+
+  // Whatever is still buffered is flushed by the graceful shutdown
+  if (durationMs > 0) {
+    setTimeout(() => process.kill(process.pid, 'SIGTERM'), durationMs + 1000);
+  }
+}
+
+/**
+ * "90s", "10m", "2h" or milliseconds (as `collector maintenance --duration`)
+ */
+function parseDuration(value: string): number | null {
+  const match = /^(\d+)(ms|s|m|h)?$/.exec(value.trim());
+  if (!match) return null;
+  const units = { ms: 1, s: 1000, m: 60000, h: 3600000 };
+  const ms = Number(match[1]) * units[(match[2] ?? 'ms') as keyof typeof units];
+  return ms > 0 ? ms : null;
+}
+
+/**
+ * Accepts every ingest request and logs what it received every
+ * REPORT_INTERVAL_MS, and in total on exit
+ */
+async function startMockBackend(port: number): Promise<number> {
+  const startedAt = Date.now();
+  const totals = { requests: 0, events: 0, bytes: 0 };
+  let reported = { events: 0, at: startedAt };
+
+  const server = http.createServer((req, res) => {
+    const chunks: Buffer[] = [];
+    req.on('data', (chunk: Buffer) => chunks.push(chunk));
+    req.on('end', () => {
+      if (req.method !== 'POST' || !req.url?.startsWith('/v1/ingest/')) {
+        res.writeHead(404, { 'Content-Type': 'application/json' });
+        res.end('{"error":"Not Found"}');
+        return;
+      }
+
+      const body = Buffer.concat(chunks);
+      totals.requests++;
+      totals.bytes += body.length;
+      totals.events += countEvents(body, req.headers['content-type'] ?? '', req.url.endsWith('/bulk'));
+      res.writeHead(202, { 'Content-Type': 'application/json' });
+      res.end('{"ok":true}');
+    });
+  });
+
+  await new Promise<void>((resolve, reject) => {
+    server.once('error', reject);
+    server.listen(port, '127.0.0.1', resolve);
+  });
+  server.unref();
+
+  const report = setInterval(() => {
+    const now = Date.now();
+    const rate = (totals.events - reported.events) / ((now - reported.at) / 1000);
+    reported = { events: totals.events, at: now };
+    console.log(`🧪 Mock backend: ${totals.events} events in ${totals.requests} requests (${Math.round(rate)} events/s now)`);
+  }, REPORT_INTERVAL_MS);
+  report.unref();
+
+  process.on('exit', () => {
+    const seconds = (Date.now() - startedAt) / 1000;
+    console.log(`🧪 Mock backend received ${totals.events} events in ${totals.requests} requests, ` +
+      `${(totals.bytes / 1024 ** 2).toFixed(1)} MiB (${Math.round(totals.events / seconds)} events/s average)`);
+  });
+
+  return (server.address() as { port: number }).port;
+}
+
+// Events in a request: a JSON bulk body, NDJSON lines, or one per request for other formats
+function countEvents(body: Buffer, contentType: string, bulk: boolean): number {
+  if (!bulk) return 1;
+  if (contentType.startsWith('application/x-ndjson')) {
+    return body.toString('utf8').split('\n').filter((line) => line.length > 0).length;
+  }
+  if (contentType.startsWith('application/json')) {
+    try {
+      const parsed = JSON.parse(body.toString('utf8')) as { events?: unknown[] };
+      return parsed.events?.length ?? 0;
+    } catch {
+      return 0;
+    }
+  }
+  return 1;
+}
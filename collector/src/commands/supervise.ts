@@ -0,0 +1,229 @@
+import http from 'node:http';
+import { readFileSync, realpathSync } from 'node:fs';
+import { dirname, resolve } from 'node:path';
+import { timingSafeEqual } from 'node:crypto';
+import { parseArgs } from 'node:util';
+import { z } from 'zod';
+import { Supervisor } from '../supervisor.js';
+
+const DEFAULT_INSTANCES_PATH = '/etc/centinela/instances.json';
+const INSTANCE_NAME = /^[a-z0-9][a-z0-9_-]{0,62}$/i;
+const INSTANCE_ACTIONS = ['start', 'stop', 'restart', 'reload'] as const;
+
+const InstancesFileSchema = z.object({
+  admin_port: z.number().int().min(1).max(65535).default(8079),
+  admin_bind: z.string().default('127.0.0.1'),
+  admin_token: z.string().min(16).optional(),
+  instances: z.record(
+    z.string().regex(INSTANCE_NAME, 'Instance names are letters, digits, "-" and "_"'),
+    z.object({
+      config_file: z.string().min(1),
+      env: z.record(z.string()).optional(),
+      autostart: z.boolean().default(true),
+    }),
+  ),
+});
+
+type InstancesFile = z.infer<typeof InstancesFileSchema>;
+
+/**
+ * `collector supervise` - run several collectors from one deployment
+ *
+ * For MSP appliance hosts serving many customers: each instance of the
+ * instances file is a separate collector process with its own CONFIG_FILE
+ * (tenant, API key, ports, buffer and WAL directories), restarted with
+ * backoff if it crashes. Instances are controlled through a small admin API:
+ *
+ *   GET  /instances                 State of every instance
+ *   GET  /instances/<name>          State of one instance
+ *   POST /instances/<name>/start|stop|restart|reload
+ *
+ * The API requires `Authorization: Bearer <admin_token>` when admin_token is
+ * set, and is only served to localhost otherwise. SIGHUP re-reads the
+ * instances file (added instances start, removed ones stop, changed ones
+ * restart); SIGTERM/SIGINT stop every instance gracefully.
+ *
+ * Instances file (JSON; relative config_file paths are resolved against it):
+ *   {
+ *     "admin_port": 8079,
+ *     "admin_token": "...",
+ *     "instances": {
+ *       "acme": { "config_file": "acme.json" },
+ *       "globex": { "config_file": "globex.json", "env": { "LOG_FORMAT": "json" }, "autostart": false }
+ *     }
+ *   }
+ *
+ * Only PATH, HOME, TZ, LANG, NODE_OPTIONS and NODE_EXTRA_CA_CERTS are passed
+ * down from the supervisor's environment, so settings of one customer never
+ * leak into another's instance.
+ *
+ * Options:
+ *   --instances <path>  Instances file (default /etc/centinela/instances.json)
+ */
+export async function runSupervise(args: string[]): Promise<void> {
+  const { values } = parseArgs({
+    args,
+    options: {
+      instances: { type: 'string', default: process.env.INSTANCES_FILE ?? DEFAULT_INSTANCES_PATH },
+    },
+  });
+  const instancesPath = resolve(values.instances!);
+
+  let settings: InstancesFile;
+  try {
+    settings = loadInstances(instancesPath);
+  } catch (err) {
+    console.error(`❌ ${(err as Error).message}`);
+    process.exit(2);
+  }
+
+  const supervisor = new Supervisor(realpathSync(process.argv[1]!));
+  const server = http.createServer((req, res) => {
+    handleAdmin(supervisor, settings, req, res).catch((err) => {
+      if (!res.headersSent) {
+        res.writeHead(500, { 'Content-Type': 'application/json' });
+        res.end(JSON.stringify({ error: (err as Error).message }));
+      }
+    });
+  });
+
+  server.on('error', (err) => {
+    console.error(`❌ Supervisor admin API: ${err.message}`);
+    process.exit(2);
+  });
+  server.listen(settings.admin_port, settings.admin_bind, () => {
+    console.log(`🧩 Supervisor admin API on http://${settings.admin_bind}:${settings.admin_port}/instances`);
+  });
+
+  console.log(`🧩 Supervising ${Object.keys(settings.instances).length} instance(s) from ${instancesPath}`);
+  await supervisor.apply(settings.instances);
+
+  process.on('SIGHUP', () => {
+    let next: InstancesFile;
+    try {
+      next = loadInstances(instancesPath);
+    } catch (err) {
+      console.error(`❌ Instances reload rejected, keeping current: ${(err as Error).message}`);
+      return;
+    }
+    if (next.admin_port !== settings.admin_port || next.admin_bind !== settings.admin_bind) {
+      console.warn('⚠️ admin_port/admin_bind changes apply after a supervisor restart');
+    }
+    settings = { ...next, admin_port: settings.admin_port, admin_bind: settings.admin_bind };
+    console.log('🔄 Instances file reloaded');
+    supervisor.apply(settings.instances).catch((err) => console.error('❌ Applying instances failed:', err));
+  });
+
+  let stopping = false;
+  const shutdown = async (signal: string) => {
+    if (stopping) return;
+    stopping = true;
+    console.log(`\n🛑 Received ${signal}, stopping all instances...`);
+    server.close();
+    await supervisor.stopAll();
+    process.exit(0);
+  };
+  process.on('SIGTERM', () => void shutdown('SIGTERM'));
+  process.on('SIGINT', () => void shutdown('SIGINT'));
+}
+
+function loadInstances(path: string): InstancesFile {
+  let raw: unknown;
+  try {
+    raw = JSON.parse(readFileSync(path, 'utf8'));
+  } catch (err) {
+    throw new Error(`Cannot read instances file ${path}: ${(err as Error).message}`);
+  }
+
+  const result = InstancesFileSchema.safeParse(raw);
+  if (!result.success) {
+    const issues = result.error.issues.map((issue) => `${issue.path.join('.')}: ${issue.message}`).join('; ');
+    throw new Error(`Invalid instances file ${path}: ${issues}`);
+  }
+  if (Object.keys(result.data.instances).length === 0) {
+    throw new Error(`Invalid instances file ${path}: no instances defined`);
+  }
+
+  for (const instance of Object.values(result.data.instances)) {
+    instance.config_file = resolve(dirname(path), instance.config_file);
+  }
+  return result.data;
+}
+
+async function handleAdmin(
+  supervisor: Supervisor,
+  settings: InstancesFile,
+  req: http.IncomingMessage,
+  res: http.ServerResponse,
+): Promise<void> {
+  const reply = (status: number, body: unknown) => {
+    res.writeHead(status, { 'Content-Type': 'application/json' });
+    res.end(JSON.stringify(body, null, 2));
+  };
+
+  if (!isAdmin(settings, req)) {
+    reply(403, { error: settings.admin_token ? 'Invalid admin token' : 'Only accepted from localhost (set admin_token)' });
+    return;
+  }
+
+  const [resource, name, action, ...extra] = new URL(req.url ?? '/', 'http://localhost').pathname.split('/').filter(Boolean);
+  if (resource !== 'instances' || extra.length > 0) {
+    reply(404, { error: 'Not Found', endpoints: ['/instances', '/instances/<name>', '/instances/<name>/start|stop|restart|reload'] });
+    return;
+  }
+
+  if (!name) {
+    if (req.method !== 'GET') return reply(405, { error: 'Method Not Allowed' });
+    reply(200, { instances: supervisor.getStatus() });
+    return;
+  }
+  if (!supervisor.has(name)) {
+    reply(404, { error: `Unknown instance "${name}"` });
+    return;
+  }
+
+  if (!action) {
+    if (req.method !== 'GET') return reply(405, { error: 'Method Not Allowed' });
+    reply(200, supervisor.getStatus(name)[0]);
+    return;
+  }
+  if (!(INSTANCE_ACTIONS as readonly string[]).includes(action)) {
+    reply(404, { error: `Unknown action "${action}" (expected ${INSTANCE_ACTIONS.join(', ')})` });
+    return;
+  }
+  if (req.method !== 'POST') {
+    reply(405, { error: 'Method Not Allowed' });
+    return;
+  }
+
+  switch (action as typeof INSTANCE_ACTIONS[number]) {
+    case 'start':
+      supervisor.start(name);
+      break;
+    case 'stop':
+      await supervisor.stop(name);
+      break;
+    case 'restart':
+      await supervisor.restart(name);
+      break;
+    case 'reload':
+      if (!supervisor.reload(name)) {
+        reply(409, { error: `Instance "${name}" is not running` });
+        return;
+      }
+      break;
+  }
+  console.log(`🧩 [${name}] ${action} requested via admin API`);
+  reply(200, supervisor.getStatus(name)[0]);
+}
+
+function isAdmin(settings: InstancesFile, req: http.IncomingMessage): boolean {
+  if (!settings.admin_token) {
+    const address = req.socket.remoteAddress ?? '';
+    return address === '127.0.0.1' || address === '::1' || address === '::ffff:127.0.0.1';
+  }
+
+  const candidate = Buffer.from(req.headers.authorization ?? '');
+  const expected = Buffer.from(`Bearer ${settings.admin_token}`);
+  return candidate.length === expected.length && timingSafeEqual(candidate, expected);
+}
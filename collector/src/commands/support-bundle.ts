@@ -0,0 +1,109 @@
+import { readFile, writeFile } from 'node:fs/promises';
+import { parseArgs } from 'node:util';
+import { decryptBundle } from '../bundle-archive.js';
+
+/**
+ * `collector support-bundle` - collect an encrypted diagnostic bundle
+ *
+ * Asks the running collector's health server (POST /support-bundle) for a
+ * bundle: recent logs, metrics, queue state, sanitized configuration,
+ * stacks and a CPU profile (see support-bundle.ts). It is encrypted for
+ * SUPPORT_BUNDLE_PUBLIC_KEY, or with --passphrase, and can be attached to a
+ * ticket as is.
+ *
+ * `collector support-bundle decrypt <file>` opens one (support side; needs
+ * no collector configuration) into a .tar.gz.
+ *
+ * Options:
+ *   --output <file>      Where to write (default: the name the collector gives, or <file> without .enc)
+ *   --cpu-seconds <n>    CPU profile length, 0-60 (default SUPPORT_BUNDLE_CPU_SECONDS)
+ *   --heap               Include a heap snapshot (large; pauses the collector while taken)
+ *   --passphrase <p>     Encrypt (or decrypt) with a passphrase instead of a key pair
+ *   --key <file>         Private key PEM (decrypt)
+ *   --url <url>          Running collector's health server (default http://127.0.0.1:HEALTH_PORT)
+ *   --token <token>      Admin token (default ADMIN_TOKEN)
+ *
+ * Exit code: 0 success, 2 error.
+ */
+export async function runSupportBundle(args: string[]): Promise<void> {
+  if (args[0] === 'decrypt') {
+    await decrypt(args.slice(1));
+    return;
+  }
+
+  const { config } = await import('../config.js');
+  const { values } = parseArgs({
+    args,
+    options: {
+      output: { type: 'string' },
+      'cpu-seconds': { type: 'string' },
+      heap: { type: 'boolean', default: false },
+      passphrase: { type: 'string' },
+      url: { type: 'string', default: `http://127.0.0.1:${config.HEALTH_PORT}` },
+      token: { type: 'string', default: config.ADMIN_TOKEN },
+    },
+  });
+
+  const cpuSeconds = values['cpu-seconds'] !== undefined ? Number(values['cpu-seconds']) : undefined;
+  if (cpuSeconds !== undefined && (!Number.isInteger(cpuSeconds) || cpuSeconds < 0 || cpuSeconds > 60)) {
+    console.error('❌ --cpu-seconds must be an integer from 0 to 60');
+    process.exit(2);
+  }
+
+  const seconds = cpuSeconds ?? config.SUPPORT_BUNDLE_CPU_SECONDS;
+  console.log(`🧰 Collecting a support bundle from ${values.url}${seconds > 0 ? ` (${seconds}s CPU profile)` : ''}...`);
+  try {
+    const response = await fetch(`${values.url}/support-bundle`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        ...(values.token && { 'Authorization': `Bearer ${values.token}` }),
+      },
+      body: JSON.stringify({ cpu_seconds: cpuSeconds, heap: values.heap, passphrase: values.passphrase }),
+      signal: AbortSignal.timeout((seconds + 120) * 1000),
+    });
+    if (!response.ok) {
+      const body = await response.json().catch(() => ({})) as { error?: string };
+      throw new Error(body.error ?? `HTTP ${response.status}`);
+    }
+
+    const bundle = Buffer.from(await response.arrayBuffer());
+    const suggested = /filename="([^"]+)"/.exec(response.headers.get('content-disposition') ?? '')?.[1];
+    const output = values.output ?? suggested ?? 'support-bundle.tar.gz.enc';
+    await writeFile(output, bundle, { mode: 0o600 });
+    console.log(`✅ Support bundle written to ${output} (${bundle.length} bytes, encrypted${values.passphrase ? ' with the passphrase' : ' for SUPPORT_BUNDLE_PUBLIC_KEY'})`);
+  } catch (err) {
+    console.error(`❌ Support bundle failed (${values.url}/support-bundle): ${(err as Error).message}`);
+    process.exit(2);
+  }
+  process.exit(0);
+}
+
+async function decrypt(args: string[]): Promise<void> {
+  const { values, positionals } = parseArgs({
+    args,
+    allowPositionals: true,
+    options: {
+      key: { type: 'string' },
+      passphrase: { type: 'string' },
+      output: { type: 'string' },
+    },
+  });
+
+  const [file] = positionals;
+  if (!file || !values.key === !values.passphrase) {
+    console.error('Usage: collector support-bundle decrypt <file> (--key <private-key.pem> | --passphrase <p>) [--output <file.tar.gz>]');
+    process.exit(2);
+  }
+
+  const output = values.output ?? (file.endsWith('.enc') ? file.slice(0, -'.enc'.length) : `${file}.tar.gz`);
+  try {
+    const secret = values.key ? { privateKey: await readFile(values.key, 'utf8') } : { passphrase: values.passphrase! };
+    await writeFile(output, decryptBundle(await readFile(file), secret), { mode: 0o600 });
+  } catch (err) {
+    console.error(`❌ Cannot decrypt ${file}: ${(err as Error).message}`);
+    process.exit(2);
+  }
+  console.log(`✅ Decrypted to ${output} (tar -xzf ${output})`);
+  process.exit(0);
+}
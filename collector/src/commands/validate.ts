@@ -0,0 +1,232 @@
+import dns from 'node:dns/promises';
+import net from 'node:net';
+import os from 'node:os';
+import { readFileSync } from 'node:fs';
+import { parseArgs } from 'node:util';
+import { config } from '../config.js';
+import { lintConfig, type ConfigWarning } from '../config-lint.js';
+import { buildIngestPayload } from '../serializers.js';
+import { createSyslogEvent } from '../events.js';
+
+const DRY_POST_TIMEOUT_MS = 10000;
+
+interface ConfigError extends ConfigWarning {
+  hint?: string;
+}
+
+/** Enabled listeners: the setting to fix, bind address and transport/port */
+function listenerBindings(): Array<{ key: string; address: string; port: string }> {
+  const bindings: Array<{ key: string; address: string; port: string; enabled: boolean }> = [
+    { key: 'UDP_BIND_ADDRESS', address: config.UDP_BIND_ADDRESS, port: `udp/${config.UDP_PORT}`, enabled: config.UDP_ENABLED },
+    { key: 'TCP_BIND_ADDRESS', address: config.TCP_BIND_ADDRESS, port: `tcp/${config.TCP_PORT}`, enabled: config.TCP_ENABLED },
+    { key: 'TLS_BIND_ADDRESS', address: config.TLS_BIND_ADDRESS, port: `tcp/${config.TLS_PORT}`, enabled: config.TLS_ENABLED },
+    { key: 'RAW_TCP_BIND_ADDRESS', address: config.RAW_TCP_BIND_ADDRESS, port: `tcp/${config.RAW_TCP_PORT}`, enabled: config.RAW_TCP_ENABLED },
+    { key: 'RELAY_BIND_ADDRESS', address: config.RELAY_BIND_ADDRESS, port: `tcp/${config.RELAY_PORT}`, enabled: config.RELAY_ENABLED },
+    { key: 'WEF_BIND_ADDRESS', address: config.WEF_BIND_ADDRESS, port: `tcp/${config.WEF_PORT}`, enabled: config.WEF_ENABLED },
+    { key: 'HTTP_PUSH_BIND_ADDRESS', address: config.HTTP_PUSH_BIND_ADDRESS, port: `tcp/${config.HTTP_PUSH_PORT}`, enabled: config.HTTP_PUSH_ENABLED },
+    { key: 'HEALTH_PORT', address: '0.0.0.0', port: `tcp/${config.HEALTH_PORT}`, enabled: true },
+    ...config.LISTENERS.map((listener) => ({
+      key: `LISTENERS (${listener.name})`,
+      address: listener.transport === 'udp' ? config.UDP_BIND_ADDRESS : config.TCP_BIND_ADDRESS,
+      port: `${listener.transport}/${listener.port}`,
+      enabled: true,
+    })),
+  ];
+  return bindings.filter((binding) => binding.enabled);
+}
+
+/**
+ * Listener problems the service would only hit when binding: addresses that
+ * aren't on this host, the same port used twice, privileged ports
+ */
+function checkListeners(): { errors: ConfigError[]; warnings: ConfigWarning[] } {
+  const errors: ConfigError[] = [];
+  const warnings: ConfigWarning[] = [];
+  const local = new Set(Object.values(os.networkInterfaces()).flatMap((addresses) => addresses ?? []).map((info) => info.address));
+  const bindings = listenerBindings();
+
+  for (const { key, address } of bindings) {
+    if (net.isIP(address) === 0) {
+      errors.push({ key, message: `"${address}" is not an IP address`, hint: 'Use an address of this host, or 0.0.0.0 to listen on every interface' });
+    } else if (address !== '0.0.0.0' && address !== '::' && !local.has(address)) {
+      errors.push({ key, message: `${address} is not an address of this host (${[...local].join(', ')})`, hint: 'Use one of those, or 0.0.0.0' });
+    }
+  }
+
+  const seen = new Map<string, string>();
+  for (const { key, port } of bindings) {
+    const other = seen.get(port);
+    if (other) {
+      errors.push({ key, message: `${port} is also used by ${other}`, hint: 'Give each listener its own port' });
+    }
+    seen.set(port, key);
+  }
+
+  const privileged = bindings.filter(({ port }) => Number(port.split('/')[1]) < 1024);
+  if (privileged.length > 0 && process.getuid?.() !== 0) {
+    warnings.push({
+      key: privileged[0]!.key,
+      message: `${privileged.map(({ port }) => port).join(', ')} below 1024 need root or CAP_NET_BIND_SERVICE (not checked for this process)`,
+    });
+  }
+  return { errors, warnings };
+}
+
+/** Every backend URL the collector may send to */
+function backendUrls(): Array<{ key: string; url: string }> {
+  if (config.OUTPUT_TYPE === 'kafka') return [];
+  return [
+    { key: 'CENTINELA_API_URL', url: config.CENTINELA_API_URL },
+    ...(config.BACKEND_INGEST_URL_FAILOVER ? [{ key: 'BACKEND_INGEST_URL_FAILOVER', url: config.BACKEND_INGEST_URL_FAILOVER.url }] : []),
+    ...config.BACKEND_ENDPOINTS.map((endpoint) => ({ key: 'BACKEND_ENDPOINTS', url: endpoint.url })),
+    ...(config.OUTPUT_TYPE === 'grpc' && config.GRPC_URL ? [{ key: 'GRPC_URL', url: config.GRPC_URL }] : []),
+  ];
+}
+
+/**
+ * Resolve the backend host names (unless the SOCKS proxy resolves them)
+ */
+async function checkBackendNames(): Promise<ConfigError[]> {
+  if (config.SOCKS_PROXY?.startsWith('socks5h:')) return [];
+
+  const errors: ConfigError[] = [];
+  for (const { key, url } of backendUrls()) {
+    const host = new URL(url).hostname.replace(/^\[|\]$/g, '');
+    if (net.isIP(host) !== 0) continue;
+    try {
+      await dns.lookup(host);
+    } catch (err) {
+      errors.push({
+        key,
+        message: `cannot resolve ${host}: ${(err as NodeJS.ErrnoException).code ?? (err as Error).message}`,
+        hint: 'Check the URL and this host\'s DNS (/etc/resolv.conf); `collector diagnose` checks the rest of the path',
+      });
+    }
+  }
+  return errors;
+}
+
+/**
+ * Authenticated POST of one test event to the bulk endpoint with
+ * X-Centinela-Dry-Run: the backend checks the API key and the payload but
+ * stores nothing
+ */
+async function dryPost(): Promise<ConfigError[]> {
+  if (config.OUTPUT_TYPE !== 'http') {
+    return [{ key: 'OUTPUT_TYPE', message: `--dry-post only applies to OUTPUT_TYPE=http (is ${config.OUTPUT_TYPE})` }];
+  }
+
+  let key = config.CENTINELA_API_KEY ?? '';
+  if (config.CENTINELA_API_KEY_FILE) {
+    try {
+      key = readFileSync(config.CENTINELA_API_KEY_FILE, 'utf8').trim();
+    } catch (err) {
+      return [{ key: 'CENTINELA_API_KEY_FILE', message: `cannot read it: ${(err as Error).message}` }];
+    }
+  }
+
+  const { backendFetch, loadBackendTls } = await import('../http-client.js');
+  const { identityHeaders } = await import('../identity.js');
+  const log = console.log;
+  console.log = () => undefined; // "Backend TLS: ..." line
+  try {
+    loadBackendTls();
+  } catch (err) {
+    return [{ key: 'BACKEND_TLS_CERT', message: `cannot load the backend TLS files: ${(err as Error).message}` }];
+  } finally {
+    console.log = log;
+  }
+
+  const event = createSyslogEvent('<14>1 - - centinela-collector - - - collector validate dry run', { address: '127.0.0.1' }, 'udp');
+  const url = config.CENTINELA_API_URL.replace('/syslog', '/syslog/bulk');
+  try {
+    const response = await backendFetch(url, {
+      method: 'POST',
+      headers: {
+        ...identityHeaders(),
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${key}`,
+        'X-Centinela-Dry-Run': 'true',
+      },
+      body: JSON.stringify({ events: [buildIngestPayload(event)] }),
+      signal: AbortSignal.timeout(DRY_POST_TIMEOUT_MS),
+    });
+    const text = await response.text().catch(() => '');
+    if (response.ok) return [];
+
+    const hint = response.status === 401 || response.status === 403
+      ? 'The API key was rejected: check CENTINELA_API_KEY / CENTINELA_API_KEY_FILE (or re-run collector init)'
+      : response.status === 404
+        ? 'No ingest endpoint at that URL: check CENTINELA_API_URL (…/v1/ingest/syslog)'
+        : response.status === 429
+          ? 'Rate limited: the key works, retry later'
+          : undefined;
+    return [{ key: 'CENTINELA_API_URL', message: `dry POST to ${url}: HTTP ${response.status} ${text.slice(0, 200)}`.trim(), hint }];
+  } catch (err) {
+    return [{
+      key: 'CENTINELA_API_URL',
+      message: `dry POST to ${url} failed: ${(err as Error).message}`,
+      hint: 'Run `collector diagnose` to find where the connection breaks',
+    }];
+  }
+}
+
+/**
+ * `collector validate` - check the configuration without starting anything
+ *
+ * A pre-flight check for deployments: resolves CONFIG_FILE and the
+ * environment exactly like the service does (an invalid configuration is
+ * reported and exits 1 while loading), then checks what the service would
+ * only find out when starting: listener addresses that aren't on this host,
+ * ports used twice, and backend host names that don't resolve. With
+ * --dry-post it also sends an authenticated test request that the backend
+ * checks but doesn't store. With --strict, best-practice warnings are
+ * printed too and make it fail, so it can gate deployments in CI.
+ *
+ * Options:
+ *   --strict     Print best-practice warnings; exit 1 if there are any
+ *   --dry-post   Authenticated dry-run POST to the bulk endpoint (API key, URL, TLS)
+ *   --offline    Skip the checks that need the network (name resolution)
+ *   --json       Print machine-readable output
+ *
+ * Exit code: 0 valid, 1 invalid (or warnings with --strict).
+ */
+export async function runValidate(args: string[]): Promise<void> {
+  const { values } = parseArgs({
+    args,
+    options: {
+      strict: { type: 'boolean', default: false },
+      'dry-post': { type: 'boolean', default: false },
+      offline: { type: 'boolean', default: false },
+      json: { type: 'boolean', default: false },
+    },
+  });
+
+  const listeners = checkListeners();
+  const errors: ConfigError[] = [...listeners.errors];
+  if (!values.offline) errors.push(...await checkBackendNames());
+  if (values['dry-post'] && !values.offline) errors.push(...await dryPost());
+  const warnings = values.strict ? [...lintConfig(config), ...listeners.warnings] : [];
+
+  if (values.json) {
+    console.log(JSON.stringify({ valid: errors.length === 0, errors, warnings }, null, 2));
+  } else {
+    if (errors.length === 0) {
+      console.log('✅ Configuration is valid.');
+    } else {
+      console.log(`❌ ${errors.length} problem(s):`);
+      for (const error of errors) {
+        console.log(`   ${error.key}: ${error.message}`);
+        if (error.hint) console.log(`      💡 ${error.hint}`);
+      }
+    }
+    if (warnings.length > 0) {
+      console.log(`⚠️ ${warnings.length} warning(s):`);
+      for (const warning of warnings) {
+        console.log(`   ${warning.key}: ${warning.message}`);
+      }
+    }
+  }
+
+  process.exit(errors.length === 0 && warnings.length === 0 ? 0 : 1);
+}
@@ -0,0 +1,72 @@
+import os from 'node:os';
+import { appendFile } from 'node:fs/promises';
+import { parseArgs } from 'node:util';
+import { config } from '../config.js';
+import { tokenVault } from '../token-vault.js';
+
+/**
+ * `collector vault reveal <token...>` - recover tokenized originals on-prem
+ *
+ * Reads TOKEN_VAULT_FILE directly (the collector doesn't need to be running)
+ * and decrypts it with TOKEN_VAULT_KEY. Every reveal is appended to
+ * <TOKEN_VAULT_FILE>.audit with who asked, who approved and why, before
+ * anything is printed.
+ *
+ * Options:
+ *   --reason <text>       Why the originals are needed (required)
+ *   --approved-by <name>  Who approved the reveal (required)
+ *   --json                Print machine-readable output
+ *
+ * Exit code: 0 all found, 1 some tokens not in the vault, 2 error.
+ */
+export async function runVault(args: string[]): Promise<void> {
+  const [action, ...rest] = args;
+  const { values, positionals } = parseArgs({
+    args: rest,
+    allowPositionals: true,
+    options: {
+      reason: { type: 'string' },
+      'approved-by': { type: 'string' },
+      json: { type: 'boolean', default: false },
+    },
+  });
+
+  if (action !== 'reveal' || positionals.length === 0 || !values.reason?.trim() || !values['approved-by']?.trim()) {
+    console.error('Usage: collector vault reveal <token...> --reason <text> --approved-by <name> [--json]');
+    process.exit(2);
+  }
+  if (!tokenVault.enabled) {
+    console.error('❌ No token vault configured (TOKEN_VAULT_FILE, TOKEN_VAULT_KEY)');
+    process.exit(2);
+  }
+
+  let originals: Map<string, string>;
+  try {
+    originals = await tokenVault.reveal(positionals);
+    await appendFile(`${config.TOKEN_VAULT_FILE}.audit`, JSON.stringify({
+      ts: new Date().toISOString(),
+      operator: os.userInfo().username,
+      host: os.hostname(),
+      approved_by: values['approved-by'],
+      reason: values.reason,
+      tokens: positionals,
+      found: [...originals.keys()],
+    }) + '\n', { mode: 0o600 });
+  } catch (err) {
+    console.error(`❌ Reveal failed: ${(err as Error).message}`);
+    process.exit(2);
+  }
+
+  const missing = positionals.filter((token) => !originals.has(token));
+  if (values.json) {
+    console.log(JSON.stringify({ originals: Object.fromEntries(originals), missing }, null, 2));
+  } else {
+    for (const [token, value] of originals) {
+      console.log(`${token}\t${value}`);
+    }
+    for (const token of missing) {
+      console.error(`⚠️ ${token} is not in the vault`);
+    }
+  }
+  process.exit(missing.length > 0 ? 1 : 0);
+}
@@ -0,0 +1,216 @@
+import { createHash } from 'node:crypto';
+import type { Config } from './config.js';
+
+// Settings that are read on every use and can change without a restart
+const LIVE_KEYS = new Set<string>([
+    'LOG_LEVEL',
+    'LOG_FORMAT',
+    'PROFILING_ENABLED',
+    'SUPPORT_BUNDLE_PUBLIC_KEY',
+    'SUPPORT_BUNDLE_CPU_SECONDS',
+    'SUPPORT_BUNDLE_ON_LEAK',
+    'OTEL_TRACES_SAMPLER_ARG',
+    'BATCH_SIZE',
+    'FLUSH_INTERVAL_MS',
+    'BATCH_FORMAT',
+    'FORWARD_WORKERS',
+    'SHADOW_FORMAT',
+    'WAL_MAX_BYTES',
+    'WAL_SEGMENT_BYTES',
+    'MAX_BUFFER_SIZE',
+    'BUFFER_SPILL_HIGH_WATER',
+    'BUFFER_SPILL_LOW_WATER',
+    'MAX_MESSAGE_BYTES',
+    'OVERSIZE_MESSAGES',
+    'MAX_MESSAGE_PARTS',
+    'PARSE_SYSLOG',
+    'SYSLOG_DEFAULT_TIMEZONE',
+    'SYSLOG_YEAR_ROLLOVER',
+    'PARSER_OVERRIDES',
+    'PARSER_OVERRIDES_FILE',
+    'FORWARDING_POLICIES',
+    'FORWARDING_POLICIES_FILE',
+    'MULTILINE_RULES',
+    'MULTILINE_RULES_FILE',
+    'LISTENERS', // Applied by NamedListeners
+    'CLOCK_SKEW_POLICY',
+    'CLOCK_SKEW_MAX_FUTURE_MS',
+    'CLOCK_SKEW_MAX_PAST_MS',
+    'REVERSE_DNS_ENABLED',
+    'ANONYMIZATION_PROFILE',
+    'ANONYMIZATION_KEY',
+    'RETRY_CHECK_INTERVAL_MS',
+    'SHUTDOWN_TIMEOUT_MS',
+    'FAILOVER_THRESHOLD',
+    'FAILBACK_PROBE_INTERVAL_MS',
+    'CIRCUIT_BREAKER_THRESHOLD',
+    'CIRCUIT_BREAKER_OPEN_MS',
+    'BACKEND_TLS_CERT',
+    'BACKEND_TLS_KEY',
+    'BACKEND_TLS_CA',
+    'BACKEND_TLS_PINS',
+    'UNKNOWN_SOURCE_POLICY',
+    'GREYLIST_MAX_EPS',
+    'SOURCE_RATE_LIMIT_EPS',
+    'SOURCE_RATE_LIMIT_BURST',
+    'SOURCE_RATE_LIMIT_ACTION',
+    'SOURCE_RATE_LIMIT_SUMMARY_INTERVAL_MS',
+    'SOURCE_MAP',
+    'SOURCE_MAP_FILE',
+    'UNMAPPED_SOURCE_POLICY',
+    'SHADOW_SAMPLE_RATE',
+    'SHADOW_QUEUE_SIZE',
+    'SHADOW_OVERFLOW',
+    'DUAL_WRITE_QUEUE_SIZE',
+    'DUAL_WRITE_OVERFLOW',
+    'DUAL_WRITE_REPORT_INTERVAL_MS',
+    'OTLP_LOGS_QUEUE_SIZE',
+    'OTLP_LOGS_OVERFLOW',
+    'ARCHIVE_OBJECT_MAX_EVENTS',
+    'ARCHIVE_OBJECT_MAX_AGE_MS',
+    'ARCHIVE_QUEUE_SIZE',
+    'ARCHIVE_OVERFLOW',
+    'ARCHIVE_SPOOL_MAX_BYTES',
+    'DEAD_LETTER_MAX_BYTES',
+    'LEAK_WATCHDOG_ACTION',
+    'LEAK_HEAP_MAX_BYTES',
+    'LEAK_HEAP_GROWTH_MAX_BYTES_PER_HOUR',
+    'LEAK_FDS_MAX',
+    'LEAK_HANDLES_MAX',
+    'RAW_CHUNK_BYTES',
+    'RAW_CHUNK_TIMEOUT_MS',
+    'RAW_ENCODING',
+    'TCP_SESSION_EVENTS',
+    'TCP_FRAMING',
+    'TLS_FRAMING',
+    'CONTROL_POLL_INTERVAL_MS',
+    'UDP_STATS_INTERVAL_MS',
+    'RATE_LIMIT_HEADROOM',
+    'PICKUP_INTERVAL_MS',
+    'PICKUP_MIN_AGE_MS',
+    'DNS_LOG_QUERIES',
+    'KMSG_CATCH_UP',
+    'KMSG_MIN_LEVEL',
+    'JOURNALD_FIELDS',
+    'FILE_TAIL_PATHS',
+    'FILE_TAIL_INTERVAL_MS',
+    'FILE_TAIL_ENCODING',
+    'SIMULATION_EPS',
+    'DISCOVERY_INTERVAL_MS',
+    'METRICS_EVENTS_INTERVAL_MS',
+    'RULE_SAMPLE_SIZE',
+    'MAINTENANCE_MAX_DURATION_MS',
+    'MAINTENANCE_MAX_SPOOL_BYTES',
+]);
+
+const SECRET_KEYS = new Set<string>(['CENTINELA_API_KEY', 'SHADOW_API_KEY', 'DUAL_WRITE_API_KEY', 'RELAY_TOKENS', 'HTTP_PUSH_SOURCES', 'HTTP_PUSH_AUTH', 'PICKUP_URLS', 'PICKUP_HTTP_HEADERS', 'OT_OPCUA_TOKENS', 'ADMIN_TOKEN', 'ANONYMIZATION_KEY', 'TOKEN_VAULT_KEY', 'SCHEMA_REGISTRY_AUTH', 'OTEL_EXPORTER_OTLP_HEADERS', 'OTEL_EXPORTER_OTLP_LOGS_HEADERS', 'KAFKA_SASL_PASSWORD', 'SOCKS_PROXY', 'ARCHIVE_S3_SECRET_ACCESS_KEY', 'ARCHIVE_S3_SESSION_TOKEN']);
+
+// Listener keys, grouped so a diff reads as "listener added/removed/changed"
+const LISTENERS: Record<string, { enabled: string; keys: string[] }> = {
+    udp: { enabled: 'UDP_ENABLED', keys: ['UDP_BIND_ADDRESS', 'UDP_PORT', 'UDP_ALLOWED_SOURCES', 'UDP_DENIED_SOURCES'] },
+    tcp: { enabled: 'TCP_ENABLED', keys: ['TCP_BIND_ADDRESS', 'TCP_PORT', 'TCP_ALLOWED_SOURCES', 'TCP_DENIED_SOURCES'] },
+    tls: { enabled: 'TLS_ENABLED', keys: ['TLS_BIND_ADDRESS', 'TLS_PORT', 'TLS_ALLOWED_SOURCES', 'TLS_DENIED_SOURCES'] },
+    raw_tcp: { enabled: 'RAW_TCP_ENABLED', keys: ['RAW_TCP_BIND_ADDRESS', 'RAW_TCP_PORT', 'RAW_TCP_ALLOWED_SOURCES', 'RAW_TCP_DENIED_SOURCES'] },
+    relay: { enabled: 'RELAY_ENABLED', keys: ['RELAY_BIND_ADDRESS', 'RELAY_PORT'] },
+    wef: { enabled: 'WEF_ENABLED', keys: ['WEF_BIND_ADDRESS', 'WEF_PORT'] },
+    http_push: { enabled: 'HTTP_PUSH_ENABLED', keys: ['HTTP_PUSH_BIND_ADDRESS', 'HTTP_PUSH_PORT'] },
+    ot_modbus: { enabled: 'OT_MODBUS_ENABLED', keys: ['OT_MODBUS_BIND_ADDRESS', 'OT_MODBUS_PORT'] },
+    ot_opcua: { enabled: 'OT_OPCUA_ENABLED', keys: ['OT_OPCUA_BIND_ADDRESS', 'OT_OPCUA_PORT'] },
+    honeypot: { enabled: 'HONEYPOT_ENABLED', keys: ['HONEYPOT_BIND_ADDRESS', 'HONEYPOT_LISTENERS'] },
+    dns_sniff: { enabled: 'DNS_SNIFF_ENABLED', keys: ['DNS_SNIFF_INTERFACE', 'DNS_SNIFF_FILTER'] },
+    dnstap: { enabled: 'DNS_DNSTAP_ENABLED', keys: ['DNS_DNSTAP_SOCKET', 'DNS_DNSTAP_PORT', 'DNS_DNSTAP_BIND_ADDRESS'] },
+    health: { enabled: 'HEALTH_ENABLED', keys: ['HEALTH_PORT'] },
+};
+
+export interface ListenerChange {
+    listener: string;
+    change: 'added' | 'removed' | 'changed';
+    from: string | null; // bind:port
+    to: string | null;
+}
+
+export interface SettingChange {
+    key: string;
+    from: unknown;
+    to: unknown;
+    apply: 'live' | 'restart';
+}
+
+export interface ConfigDiff {
+    listeners: ListenerChange[];
+    settings: SettingChange[];
+    live: number;
+    restart_required: number;
+}
+
+/**
+ * A config safe to expose (GET /config) and to compare across processes:
+ * secrets are replaced by a short fingerprint.
+ */
+export function sanitizeConfig(config: Config): Record<string, unknown> {
+    const out: Record<string, unknown> = {};
+    for (const [key, value] of Object.entries(config)) {
+        if (SECRET_KEYS.has(key) && value !== undefined) {
+            const hash = createHash('sha256').update(JSON.stringify(value)).digest('hex').slice(0, 12);
+            out[key] = `sha256:${hash}`;
+        } else {
+            out[key] = value;
+        }
+    }
+    return out;
+}
+
+/**
+ * Structured difference between two (sanitized) configurations
+ */
+export function diffConfig(current: Record<string, unknown>, next: Record<string, unknown>): ConfigDiff {
+    const listeners: ListenerChange[] = [];
+    const listenerKeys = new Set<string>();
+
+    for (const [name, spec] of Object.entries(LISTENERS)) {
+        listenerKeys.add(spec.enabled);
+        spec.keys.forEach((key) => listenerKeys.add(key));
+
+        const from = current[spec.enabled] ? spec.keys.map((key) => current[key]).join(':') : null;
+        const to = next[spec.enabled] ? spec.keys.map((key) => next[key]).join(':') : null;
+        if (from === to) continue;
+
+        const change = from === null ? 'added' : to === null ? 'removed' : 'changed';
+        listeners.push({ listener: name, change, from, to });
+    }
+
+    const settings: SettingChange[] = [];
+    const keys = new Set([...Object.keys(current), ...Object.keys(next)]);
+    for (const key of [...keys].sort()) {
+        if (listenerKeys.has(key)) continue;
+        if (JSON.stringify(current[key]) === JSON.stringify(next[key])) continue;
+
+        settings.push({
+            key,
+            from: current[key] ?? null,
+            to: next[key] ?? null,
+            apply: LIVE_KEYS.has(key) ? 'live' : 'restart',
+        });
+    }
+
+    const live = settings.filter((s) => s.apply === 'live').length;
+    return {
+        listeners,
+        settings,
+        live,
+        restart_required: settings.length - live + listeners.length,
+    };
+}
+
+/**
+ * Human-readable lines for a diff (one per change)
+ */
+export function formatDiff(diff: ConfigDiff): string[] {
+    const lines = diff.listeners.map((l) =>
+        `listener ${l.listener} ${l.change}: ${l.from ?? '-'} -> ${l.to ?? '-'} (restart)`
+    );
+    for (const s of diff.settings) {
+        lines.push(`${s.key}: ${JSON.stringify(s.from)} -> ${JSON.stringify(s.to)} (${s.apply})`);
+    }
+    return lines;
+}
@@ -0,0 +1,80 @@
+import os from 'node:os';
+import net from 'node:net';
+import type { Config } from './config.js';
+import { CidrList } from './cidr.js';
+
+export interface ConfigWarning {
+    key: string;
+    message: string;
+}
+
+// Loopback, RFC 1918, CGNAT, link-local and IPv6 ULA/link-local ranges
+const NON_PUBLIC = new CidrList([
+    '127.0.0.0/8', '10.0.0.0/8', '172.16.0.0/12', '192.168.0.0/16', '100.64.0.0/10', '169.254.0.0/16',
+    '::1', 'fc00::/7', 'fe80::/10',
+]);
+
+// RFC 5425 receivers must accept 2048 bytes and should accept 8192; firewall
+// and proxy logs with long URLs or many fields routinely exceed 4 KB
+const RECOMMENDED_MESSAGE_BYTES = 8192;
+
+// Listeners that receive syslog in clear text, with the TLS alternative to suggest
+const PLAINTEXT_LISTENERS: { name: string; enabled: keyof Config; bind: keyof Config }[] = [
+    { name: 'UDP', enabled: 'UDP_ENABLED', bind: 'UDP_BIND_ADDRESS' },
+    { name: 'TCP', enabled: 'TCP_ENABLED', bind: 'TCP_BIND_ADDRESS' },
+    { name: 'Raw TCP', enabled: 'RAW_TCP_ENABLED', bind: 'RAW_TCP_BIND_ADDRESS' },
+];
+
+/**
+ * Best-practice checks on a valid configuration
+ *
+ * Unlike schema errors these never stop the collector: they flag settings
+ * that work but are risky in production (open listeners without limits,
+ * clear text on public addresses, memory-only queues, message sizes that
+ * truncate common vendor logs). Printed by `collector validate --strict`.
+ */
+export function lintConfig(config: Config, publicAddresses = hostPublicAddresses()): ConfigWarning[] {
+    const warnings: ConfigWarning[] = [];
+    const warn = (key: string, message: string) => warnings.push({ key, message });
+
+    if (config.UDP_ENABLED && config.UNKNOWN_SOURCE_POLICY === 'accept') {
+        warn('UNKNOWN_SOURCE_POLICY', 'UDP listener accepts any sender without a rate limit (spoofable source IPs can flood the pipeline); ' +
+            'set ALLOWED_SOURCES with UNKNOWN_SOURCE_POLICY=greylist or reject');
+    }
+
+    for (const listener of PLAINTEXT_LISTENERS) {
+        if (!config[listener.enabled]) continue;
+        const bind = config[listener.bind] as string;
+        const exposed = isWildcard(bind) ? publicAddresses : NON_PUBLIC.contains(bind) ? [] : [bind];
+        if (exposed.length > 0) {
+            warn(listener.bind, `${listener.name} listener receives clear text on a public address (${exposed.join(', ')}); ` +
+                `bind it to an internal address or use the TLS listener (TLS_ENABLED)`);
+        }
+    }
+
+    if (!config.WAL_DIR) {
+        warn('WAL_DIR', `No disk queue: up to ${config.MAX_BUFFER_SIZE} buffered events and the retry queue are held in memory ` +
+            'and lost on restart, crash or an outage longer than the retries');
+    }
+
+    if (config.MAX_MESSAGE_BYTES < RECOMMENDED_MESSAGE_BYTES) {
+        warn('MAX_MESSAGE_BYTES', `${config.MAX_MESSAGE_BYTES} bytes ${config.OVERSIZE_MESSAGES === 'split' ? 'splits' : 'truncates'} ` +
+            `common firewall/proxy logs; use at least ${RECOMMENDED_MESSAGE_BYTES} (RFC 5425)`);
+    }
+
+    return warnings;
+}
+
+function isWildcard(address: string): boolean {
+    return address === '0.0.0.0' || address === '::';
+}
+
+/**
+ * Public addresses on this host's interfaces (what a wildcard bind exposes)
+ */
+function hostPublicAddresses(): string[] {
+    return Object.values(os.networkInterfaces())
+        .flatMap((addresses) => addresses ?? [])
+        .map((info) => info.address)
+        .filter((address) => net.isIP(address) !== 0 && !NON_PUBLIC.contains(address));
+}
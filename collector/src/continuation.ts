@@ -0,0 +1,55 @@
+import { config } from './config.js';
+import type { MessageContinuation } from './buffer.js';
+import { uuidv7 } from './event-id.js';
+
+export interface MessagePart {
+    text: string;
+    continuation?: MessageContinuation;
+}
+
+/**
+ * Split a message longer than maxBytes (UTF-8) into ordered parts.
+ *
+ * With OVERSIZE_MESSAGES=split (default) the message becomes up to
+ * MAX_MESSAGE_PARTS parts of at most maxBytes, cut between characters,
+ * sharing one continuation ID; the backend stores them as one message once
+ * all have arrived. Whatever doesn't fit in MAX_MESSAGE_PARTS is dropped and
+ * every part is marked truncated. With OVERSIZE_MESSAGES=truncate only the
+ * first maxBytes are kept (the behavior of earlier versions).
+ */
+export function splitMessage(message: string, maxBytes: number): MessagePart[] {
+    const bytes = Buffer.from(message, 'utf8');
+    if (bytes.length <= maxBytes) return [{ text: message }];
+    if (config.OVERSIZE_MESSAGES === 'truncate') return [{ text: bytes.toString('utf8', 0, cutPoint(bytes, 0, maxBytes)) }];
+
+    const texts: string[] = [];
+    let start = 0;
+    while (start < bytes.length && texts.length < config.MAX_MESSAGE_PARTS) {
+        const end = cutPoint(bytes, start, maxBytes);
+        texts.push(bytes.toString('utf8', start, end));
+        start = end;
+    }
+
+    const id = uuidv7();
+    const truncated = start < bytes.length;
+    return texts.map((text, index) => ({
+        text,
+        continuation: { id, index, total: texts.length, ...(truncated && { truncated }) },
+    }));
+}
+
+/**
+ * Longest message kept whole or in parts: what newline-framed inputs buffer
+ * at most while waiting for the end of a line
+ */
+export function maxMessageSpan(maxBytes: number): number {
+    return config.OVERSIZE_MESSAGES === 'split' ? maxBytes * config.MAX_MESSAGE_PARTS : maxBytes;
+}
+
+// End of a part starting at start: at most maxBytes, never inside a UTF-8 sequence
+function cutPoint(bytes: Buffer, start: number, maxBytes: number): number {
+    let end = Math.min(start + maxBytes, bytes.length);
+    if (end === bytes.length) return end;
+    while (end > start && (bytes[end]! & 0xc0) === 0x80) end--;
+    return end > start ? end : start + maxBytes;
+}
@@ -0,0 +1,429 @@
+import { createHash } from 'node:crypto';
+import { readFile, writeFile, rename } from 'node:fs/promises';
+import { config, isManagedSetting, resolveConfig } from './config.js';
+import { diffRuleSets, ruleEngine, validateRuleSet, type RuleSetDiff } from './rules.js';
+import { headerValue, identityHeaders } from './identity.js';
+import { backendFetch } from './http-client.js';
+import { apiKey } from './api-key.js';
+import { maintenance } from './maintenance.js';
+import { supportBundles } from './support-bundle.js';
+import {
+    layerVersions, managedLayers, parseConfigLayers, setManagedLayers, writeManagedConfigFile, type ConfigLayerName,
+} from './managed-config.js';
+import { log } from './logger.js';
+
+const REQUEST_TIMEOUT_MS = 10000;
+const UPLOAD_TIMEOUT_MS = 300000; // Support bundles with a heap snapshot are large
+
+type AckStatus = 'applied' | 'rejected' | 'deferred' | 'dry_run';
+
+export interface ControlChannelStats {
+    enabled: boolean;
+    rollout_bucket: number;
+    last_poll_at: string | null;
+    last_error: string | null;
+    last_rejected: { version: string; error: string } | null;
+    deferred_version: string | null;
+    dry_run: boolean;
+    pending_diff: RuleSetDiff | null; // Dry-run: what the latest version would change
+    group: string | null; // COLLECTOR_GROUP
+    config_layers: Partial<Record<ConfigLayerName, string>>; // Versions in effect
+    last_config_rejected: { versions: string; error: string } | null;
+}
+
+/**
+ * Control Channel (backend -> collector)
+ *
+ * Polls the backend for the tenant's collector rule set and applies it without a redeploy:
+ * - Staged rollout: the backend publishes a rollout percentage; this collector only
+ *   applies a version once its stable bucket (hash of COLLECTOR_NAME, 0-99) falls inside it
+ * - Local validation: schema, regex compilation and the rule set's own tests must pass,
+ *   otherwise the version is rejected and the current rules stay active
+ * - Every outcome is acknowledged to the backend so rollouts can be monitored
+ * - The last applied rule set is cached (RULES_CACHE_FILE) and restored on startup
+ * - Each change is logged as a structured diff (rules added/removed/changed);
+ *   with CONTROL_DRY_RUN the diff is only reported, never applied
+ * - The response may also request a maintenance window
+ *   ({"maintenance": {"enabled": true, "duration_ms": ..., "reason": "..."}})
+ * - And carry configuration layers for all collectors, this collector's
+ *   group (COLLECTOR_GROUP) and this collector ("config_layers", see
+ *   managed-config.ts). They are checked against the local configuration,
+ *   kept in MANAGED_CONFIG_FILE and applied like a reload; the versions in
+ *   effect are sent on every poll (X-Centinela-Config-Versions) and each
+ *   outcome is acknowledged (POST /v1/collector/config/ack).
+ * - Or ask for a support bundle ({"support_bundle": {"id": "...",
+ *   "public_key": "<PEM>", "cpu_seconds": 10, "heap": false}}, see
+ *   support-bundle.ts), made once per id and uploaded to
+ *   POST /v1/collector/support-bundles/<id>
+ */
+export class ControlChannel {
+    private readonly rulesUrl: string;
+    private readonly ackUrl: string;
+    private readonly configAckUrl: string;
+    private readonly supportBundleUrl: string;
+    private readonly bucket: number;
+    private timer: NodeJS.Timeout | null = null;
+    private etag: string | null = null;
+    private lastAck: string | null = null;
+
+    private lastPollAt: string | null = null;
+    private lastError: string | null = null;
+    private lastRejected: { version: string; error: string } | null = null;
+    private deferredVersion: string | null = null;
+    private pendingDiff: RuleSetDiff | null = null;
+    private lastMaintenance: string | null = null;
+    private lastSupportBundle: string | null = null;
+    private lastConfigAck: string | null = null;
+    private lastConfigRejected: { versions: string; error: string } | null = null;
+    private onConfigChange: (() => void) | null = null;
+    private configChanged = false; // Before a handler was set
+
+    constructor() {
+        const origin = new URL(config.CENTINELA_API_URL).origin;
+        this.rulesUrl = `${origin}/v1/collector/rules`;
+        this.ackUrl = `${origin}/v1/collector/rules/ack`;
+        this.configAckUrl = `${origin}/v1/collector/config/ack`;
+        this.supportBundleUrl = `${origin}/v1/collector/support-bundles`;
+        this.bucket = createHash('sha256').update(config.COLLECTOR_NAME).digest().readUInt32BE(0) % 100;
+    }
+
+    public async start(): Promise<void> {
+        await this.restoreCache();
+
+        log.info(`📡 Control channel polling ${this.rulesUrl} every ${config.CONTROL_POLL_INTERVAL_MS / 1000}s (rollout bucket ${this.bucket})`);
+
+        const tick = async () => {
+            await this.poll();
+            this.timer = setTimeout(tick, config.CONTROL_POLL_INTERVAL_MS);
+        };
+        void tick();
+    }
+
+    /**
+     * Called after new configuration layers were accepted (apply them like a
+     * reload). Layers accepted before the handler is set apply right away.
+     */
+    public setConfigChangeHandler(handler: () => void): void {
+        this.onConfigChange = handler;
+        if (this.configChanged) {
+            this.configChanged = false;
+            handler();
+        }
+    }
+
+    public stop(): void {
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+    }
+
+    public getStats(): ControlChannelStats {
+        return {
+            enabled: true,
+            rollout_bucket: this.bucket,
+            last_poll_at: this.lastPollAt,
+            last_error: this.lastError,
+            last_rejected: this.lastRejected,
+            deferred_version: this.deferredVersion,
+            dry_run: config.CONTROL_DRY_RUN,
+            pending_diff: this.pendingDiff,
+            group: config.COLLECTOR_GROUP ?? null,
+            config_layers: layerVersions(managedLayers()),
+            last_config_rejected: this.lastConfigRejected,
+        };
+    }
+
+    private async poll(): Promise<void> {
+        const controller = new AbortController();
+        const timeout = setTimeout(() => controller.abort(), REQUEST_TIMEOUT_MS);
+
+        try {
+            const response = await backendFetch(this.rulesUrl, {
+                headers: {
+                    'Authorization': `Bearer ${apiKey()}`,
+                    ...identityHeaders(),
+                    ...(managedLayers().length > 0 && { 'X-Centinela-Config-Versions': headerValue(formatVersions(layerVersions(managedLayers()))) }),
+                    ...(this.etag && { 'If-None-Match': this.etag }),
+                },
+                signal: controller.signal,
+            });
+
+            this.lastPollAt = new Date().toISOString();
+
+            // 304: unchanged, 204: neither rules nor configuration published for this tenant
+            if (response.status === 304 || response.status === 204) {
+                this.lastError = null;
+                return;
+            }
+            if (!response.ok) {
+                throw new Error(`HTTP ${response.status}`);
+            }
+
+            const body = await response.json() as { rollout_percent?: number; rule_set?: unknown; maintenance?: unknown; config_layers?: unknown; support_bundle?: unknown };
+            this.etag = response.headers.get('etag');
+            this.lastError = null;
+            await this.handleMaintenance(body.maintenance);
+            this.handleSupportBundle(body.support_bundle);
+            await this.handleConfigLayers(body.config_layers);
+            await this.handleRuleSet(body.rule_set, body.rollout_percent ?? 100);
+        } catch (err) {
+            const message = (err as Error).name === 'AbortError' ? 'timeout' : (err as Error).message;
+            if (this.lastError !== message) {
+                log.warn(`⚠️ Control channel poll failed: ${message}`);
+            }
+            this.lastError = message;
+        } finally {
+            clearTimeout(timeout);
+        }
+    }
+
+    private async handleRuleSet(raw: unknown, rolloutPercent: number): Promise<void> {
+        if (raw === undefined) return; // Only configuration layers published
+        const version = String((raw as { version?: unknown } | null)?.version ?? 'unknown');
+        if (version === ruleEngine.activeVersion) return;
+
+        const result = validateRuleSet(raw);
+        if (!result.ok) {
+            if (this.lastRejected?.version !== version) {
+                log.error(`❌ Rejected rule set ${version}: ${result.error}. Keeping ${ruleEngine.activeVersion ?? 'no rules'}.`);
+            }
+            this.lastRejected = { version, error: result.error };
+            await this.ack(version, 'rejected', result.error);
+            return;
+        }
+
+        if (this.bucket >= rolloutPercent) {
+            this.deferredVersion = version;
+            await this.ack(version, 'deferred');
+            return;
+        }
+
+        const diff = diffRuleSets(ruleEngine.activeRuleSet, result.ruleSet);
+        const summary = `+${diff.added.length} -${diff.removed.length} ~${diff.changed.length}`;
+
+        if (config.CONTROL_DRY_RUN) {
+            if (this.pendingDiff?.to_version !== version) {
+                log.info(`📜 Dry-run: rule set ${version} would change ${summary} rules (not applied)`);
+                log.info(JSON.stringify({ event: 'rules_diff', dry_run: true, ts: new Date().toISOString(), ...diff }));
+            }
+            this.pendingDiff = diff;
+            await this.ack(version, 'dry_run');
+            return;
+        }
+
+        ruleEngine.activate(result.ruleSet, result.compiled);
+        this.deferredVersion = null;
+        this.pendingDiff = null;
+        log.info(`📜 Activated rule set ${version} (${result.compiled.length} rules, ${summary}, rollout ${rolloutPercent}%)`);
+        log.info(JSON.stringify({ event: 'rules_diff', dry_run: false, ts: new Date().toISOString(), ...diff }));
+
+        await this.saveCache(raw);
+        await this.ack(version, 'applied');
+    }
+
+    /**
+     * Only a change in the backend's request is applied, so it doesn't fight
+     * a window toggled locally; the backend can only end windows it started.
+     */
+    private async handleMaintenance(request: unknown): Promise<void> {
+        if (request === undefined) return;
+
+        const key = JSON.stringify(request);
+        if (key === this.lastMaintenance) return;
+        this.lastMaintenance = key;
+
+        const { enabled, duration_ms: durationMs, reason } = (request ?? {}) as { enabled?: unknown; duration_ms?: unknown; reason?: unknown };
+        try {
+            if (enabled === true) {
+                await maintenance.enable({
+                    durationMs: Number.isInteger(durationMs) && (durationMs as number) > 0 ? durationMs as number : undefined,
+                    reason: typeof reason === 'string' ? reason.slice(0, 200) : undefined,
+                    source: 'remote',
+                });
+            } else if (enabled === false && maintenance.getStats().source === 'remote') {
+                await maintenance.disable('ended by the backend');
+            }
+        } catch (err) {
+            log.warn(`⚠️ Cannot apply maintenance request from the backend: ${(err as Error).message}`);
+        }
+    }
+
+    /**
+     * Make and upload a bundle once per request id, in the background (the
+     * CPU profile takes a while)
+     */
+    private handleSupportBundle(request: unknown): void {
+        if (request === undefined || request === null) return;
+
+        const { id, public_key: publicKey, cpu_seconds: cpuSeconds, heap } =
+            request as { id?: unknown; public_key?: unknown; cpu_seconds?: unknown; heap?: unknown };
+        if (typeof id !== 'string' || id.length === 0 || id === this.lastSupportBundle) return;
+        this.lastSupportBundle = id;
+
+        void (async () => {
+            try {
+                log.info(`🧰 Support bundle ${id} requested by the backend`);
+                const bundle = await supportBundles.create({
+                    reason: `requested by the backend (${id})`,
+                    cpuSeconds: Number.isInteger(cpuSeconds) && (cpuSeconds as number) >= 0 ? cpuSeconds as number : undefined,
+                    heap: heap === true,
+                    key: typeof publicKey === 'string' && publicKey.length > 0 ? { publicKey } : undefined,
+                });
+                const response = await backendFetch(`${this.supportBundleUrl}/${encodeURIComponent(id)}`, {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/octet-stream',
+                        'Authorization': `Bearer ${apiKey()}`,
+                        ...identityHeaders(),
+                    },
+                    body: bundle,
+                    signal: AbortSignal.timeout(UPLOAD_TIMEOUT_MS),
+                });
+                if (!response.ok) throw new Error(`upload failed: HTTP ${response.status}`);
+                log.info(`🧰 Support bundle ${id} uploaded (${bundle.length} bytes)`);
+            } catch (err) {
+                log.warn(`⚠️ Cannot provide support bundle ${id}: ${(err as Error).message}`);
+            }
+        })();
+    }
+
+    /**
+     * Accept the configuration layers if they differ from those in effect and
+     * the merged configuration is valid; otherwise keep the current ones
+     */
+    private async handleConfigLayers(raw: unknown): Promise<void> {
+        if (raw === undefined) return;
+
+        let versions = '';
+        try {
+            const layers = parseConfigLayers(raw);
+            versions = formatVersions(layerVersions(layers));
+            if (versions === formatVersions(layerVersions(managedLayers()))) return;
+
+            const unmanaged = layers.flatMap((layer) => Object.keys(layer.settings)
+                .filter((key) => !isManagedSetting(key))
+                .map((key) => `${layer.layer}.${key}`));
+            if (unmanaged.length > 0) throw new Error(`settings that can't be managed: ${unmanaged.join(', ')}`);
+
+            const resolved = resolveConfig(layers);
+            if (!resolved.ok) throw new Error(resolved.error);
+
+            setManagedLayers(layers);
+            if (config.MANAGED_CONFIG_FILE) {
+                await writeManagedConfigFile(config.MANAGED_CONFIG_FILE, layers).catch((err: Error) => {
+                    log.warn(`⚠️ Could not write managed configuration: ${err.message}`);
+                });
+            }
+            this.lastConfigRejected = null;
+            log.info(`🧩 Accepted managed configuration ${versions || '(no layers)'}`);
+            if (this.onConfigChange) this.onConfigChange();
+            else this.configChanged = true;
+            await this.ackConfig(versions, 'applied');
+        } catch (err) {
+            const error = (err as Error).message;
+            if (this.lastConfigRejected?.versions !== versions) {
+                log.error(`❌ Rejected managed configuration ${versions || '(unreadable)'}: ${error}. ` +
+                    `Keeping ${formatVersions(layerVersions(managedLayers())) || 'local settings only'}.`);
+            }
+            this.lastConfigRejected = { versions, error };
+            await this.ackConfig(versions, 'rejected', error);
+        }
+    }
+
+    private async ackConfig(versions: string, status: 'applied' | 'rejected', error?: string): Promise<void> {
+        const key = `${versions}:${status}`;
+        if (this.lastConfigAck === key) return;
+
+        try {
+            const response = await backendFetch(this.configAckUrl, {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'Authorization': `Bearer ${apiKey()}`,
+                    ...identityHeaders(),
+                },
+                body: JSON.stringify({
+                    collector_name: config.COLLECTOR_NAME,
+                    group: config.COLLECTOR_GROUP ?? null,
+                    versions: layerVersions(managedLayers()),
+                    received: versions,
+                    status,
+                    error,
+                }),
+                signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS),
+            });
+            if (response.ok) {
+                this.lastConfigAck = key;
+                return;
+            }
+        } catch {
+            // Fall through
+        }
+        this.etag = null;
+    }
+
+    private async ack(version: string, status: AckStatus, error?: string): Promise<void> {
+        // Only report state changes, not every poll
+        const key = `${version}:${status}`;
+        if (this.lastAck === key) return;
+
+        try {
+            const response = await backendFetch(this.ackUrl, {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'Authorization': `Bearer ${apiKey()}`,
+                    ...identityHeaders(),
+                },
+                body: JSON.stringify({ collector_name: config.COLLECTOR_NAME, version, status, error }),
+                signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS),
+            });
+            if (response.ok) {
+                this.lastAck = key;
+                return;
+            }
+        } catch {
+            // Fall through
+        }
+        // Force a full response on the next poll so the ack is retried
+        this.etag = null;
+    }
+
+    private async restoreCache(): Promise<void> {
+        if (!config.RULES_CACHE_FILE) return;
+
+        let raw: unknown;
+        try {
+            raw = JSON.parse(await readFile(config.RULES_CACHE_FILE, 'utf8'));
+        } catch {
+            return; // No cache yet
+        }
+
+        const result = validateRuleSet(raw);
+        if (!result.ok) {
+            log.warn(`⚠️ Ignoring cached rule set in ${config.RULES_CACHE_FILE}: ${result.error}`);
+            return;
+        }
+
+        ruleEngine.activate(result.ruleSet, result.compiled);
+        log.info(`📜 Restored cached rule set ${result.ruleSet.version} (${result.compiled.length} rules)`);
+    }
+
+    private async saveCache(raw: unknown): Promise<void> {
+        if (!config.RULES_CACHE_FILE) return;
+
+        try {
+            const tmp = `${config.RULES_CACHE_FILE}.tmp`;
+            await writeFile(tmp, JSON.stringify(raw, null, 2));
+            await rename(tmp, config.RULES_CACHE_FILE);
+        } catch (err) {
+            log.warn(`⚠️ Could not write rules cache: ${(err as Error).message}`);
+        }
+    }
+}
+
+/** "global=12,group=7,collector=3" */
+function formatVersions(versions: Partial<Record<ConfigLayerName, string>>): string {
+    return Object.entries(versions).map(([layer, version]) => `${layer}=${version}`).join(',');
+}
@@ -0,0 +1,165 @@
+import { appendFile, readFile, rename, stat, unlink } from 'node:fs/promises';
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { log } from './logger.js';
+import { eventContext } from './event-context.js';
+
+export interface DeadLetterStats {
+    enabled: boolean;
+    file: string | null;
+    written: number; // Since startup
+    bytes: number; // Current file
+    rotated: number; // Times the file reached DEAD_LETTER_MAX_BYTES
+    replayed: number;
+    last_error: string | null;
+}
+
+/**
+ * Why the backend refused an event: the HTTP status of its own request, or
+ * none when it was rejected in a bulk response's manifest
+ */
+export interface DeadLetterReason {
+    status?: number;
+    error: string;
+}
+
+interface DeadLetterRecord {
+    dead_lettered_at: string;
+    trace_id: string; // As in the collector's logs and exported traces
+    status: number | null;
+    error: string;
+    event: SyslogEvent;
+}
+
+/**
+ * Dead-Letter File (DEAD_LETTER_FILE)
+ *
+ * Events the backend refused for themselves (a non-retryable 4xx, or a
+ * rejection in the bulk manifest) are appended here as NDJSON, one record per
+ * event with the status and the error, instead of only being counted in the
+ * in-memory DLQ. The record's trace_id finds the event's log records and
+ * trace. After fixing the cause (schema mismatch, revoked key) they can be
+ * inspected with any JSON tool and replayed with `collector dead-letter replay`.
+ *
+ * The file is capped at DEAD_LETTER_MAX_BYTES: when full it is renamed to
+ * <file>.1 (replacing the previous one) and a new one is started, so at most
+ * twice the cap is used.
+ */
+export class DeadLetterFile {
+    private lines: string[] = [];
+    private writing: Promise<void> | null = null;
+    private bytes = 0;
+    private counters = { written: 0, rotated: 0, replayed: 0 };
+    private lastError: string | null = null;
+
+    public get enabled(): boolean {
+        return Boolean(config.DEAD_LETTER_FILE);
+    }
+
+    public async open(): Promise<void> {
+        if (!this.enabled) return;
+        this.bytes = await stat(config.DEAD_LETTER_FILE!).then((info) => info.size, () => 0);
+        log.info(`💀 Dead-letter file ${config.DEAD_LETTER_FILE}` + (this.bytes > 0 ? ` (${this.bytes} bytes from earlier runs)` : ''));
+    }
+
+    /**
+     * Record a refused event (written in the background, in order)
+     */
+    public write(event: SyslogEvent, reason: DeadLetterReason): void {
+        if (!this.enabled) return;
+        const record: DeadLetterRecord = {
+            dead_lettered_at: new Date().toISOString(),
+            trace_id: eventContext(event).traceId,
+            status: reason.status ?? null,
+            error: reason.error,
+            event,
+        };
+        this.lines.push(JSON.stringify(record) + '\n');
+        this.writing ??= this.writeAll();
+    }
+
+    /**
+     * Wait for pending writes (shutdown)
+     */
+    public async flush(): Promise<void> {
+        while (this.writing) await this.writing;
+    }
+
+    /**
+     * Take every dead-lettered event out of the files (rotated one first) to
+     * send them again; those refused again are written back
+     */
+    public async takeAll(): Promise<SyslogEvent[]> {
+        if (!this.enabled) return [];
+        await this.flush();
+
+        const file = config.DEAD_LETTER_FILE!;
+        const events: SyslogEvent[] = [];
+        let corrupt = 0;
+        for (const source of [`${file}.1`, file]) {
+            // Moved aside first: events refused again go to a fresh file
+            const taken = `${source}.replay`;
+            try {
+                await rename(source, taken);
+            } catch {
+                continue; // Doesn't exist
+            }
+            for (const line of (await readFile(taken, 'utf8')).split('\n')) {
+                if (!line) continue;
+                try {
+                    events.push((JSON.parse(line) as DeadLetterRecord).event);
+                } catch {
+                    corrupt++;
+                }
+            }
+            await unlink(taken);
+        }
+        this.bytes = 0;
+
+        if (corrupt > 0) log.warn(`⚠️ Skipped ${corrupt} unreadable dead-letter records`);
+        this.counters.replayed += events.length;
+        return events;
+    }
+
+    public getStats(): DeadLetterStats {
+        return {
+            enabled: this.enabled,
+            file: config.DEAD_LETTER_FILE ?? null,
+            written: this.counters.written,
+            bytes: this.bytes,
+            rotated: this.counters.rotated,
+            replayed: this.counters.replayed,
+            last_error: this.lastError,
+        };
+    }
+
+    private async writeAll(): Promise<void> {
+        const file = config.DEAD_LETTER_FILE!;
+        try {
+            while (this.lines.length > 0) {
+                const lines = this.lines.splice(0);
+                const data = lines.join('');
+                const size = Buffer.byteLength(data);
+
+                if (this.bytes > 0 && this.bytes + size > config.DEAD_LETTER_MAX_BYTES) {
+                    await rename(file, `${file}.1`);
+                    this.bytes = 0;
+                    this.counters.rotated++;
+                    log.warn(`⚠️ Dead-letter file reached DEAD_LETTER_MAX_BYTES, rotated to ${file}.1 (the previous one is discarded)`);
+                }
+                await appendFile(file, data);
+                this.bytes += size;
+                this.counters.written += lines.length;
+                this.lastError = null;
+            }
+        } catch (err) {
+            if (this.lastError === null) log.error(`❌ Cannot write the dead-letter file ${file}: ${(err as Error).message}`);
+            this.lastError = (err as Error).message;
+            this.lines = [];
+        } finally {
+            this.writing = null;
+        }
+    }
+}
+
+export const deadLetterFile = new DeadLetterFile();
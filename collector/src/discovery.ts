@@ -0,0 +1,183 @@
+import { readFile, writeFile, rename } from 'node:fs/promises';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { arpScan, type ArpHost } from './discovery/arp-scan.js';
+import { netbiosNames } from './discovery/netbios.js';
+import { log } from './logger.js';
+
+const NETBIOS_TIMEOUT_MS = 2000;
+
+interface KnownDevice {
+    ip: string;
+    vendor?: string;
+    hostname?: string;
+    workgroup?: string;
+    first_seen: string;
+    last_seen: string;
+}
+
+export interface DiscoveryStats {
+    last_sweep: string | null;
+    last_error: string | null;
+    sweeps: number;
+    devices: number;
+    seen_last_sweep: number;
+    new_devices: number;
+}
+
+/**
+ * Network Discovery (ARP / NetBIOS)
+ *
+ * Every DISCOVERY_INTERVAL_MS the DISCOVERY_SUBNETS are ARP-swept (arp-scan,
+ * which also resolves the MAC vendor) and responding hosts are asked for their
+ * NetBIOS name. Devices are tracked by MAC address in DISCOVERY_STATE_FILE:
+ * a MAC seen for the first time produces a discovery.new_device event, a known
+ * MAC on another IP a discovery.ip_changed event, so the backend can keep an
+ * asset inventory from the collector already on site.
+ *
+ * ARP only works on directly attached subnets (no routers in between).
+ */
+export class NetworkDiscovery {
+    private buffer: MessageBuffer;
+    private devices = new Map<string, KnownDevice>(); // mac -> device
+    private stats: DiscoveryStats = { last_sweep: null, last_error: null, sweeps: 0, devices: 0, seen_last_sweep: 0, new_devices: 0 };
+    private timer: NodeJS.Timeout | null = null;
+    private sweeping: Promise<void> | null = null;
+    private isRunning = false;
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+    }
+
+    public async start(): Promise<void> {
+        this.isRunning = true;
+        await this.restoreState();
+
+        log.info(`🛰️ Network discovery of ${config.DISCOVERY_SUBNETS.join(', ')} every ${config.DISCOVERY_INTERVAL_MS / 60000} min`);
+        if (!config.DISCOVERY_STATE_FILE) {
+            log.warn('⚠️ DISCOVERY_STATE_FILE not set: every device will be reported as new after a restart');
+        }
+
+        this.schedule(0);
+    }
+
+    public async stop(): Promise<void> {
+        this.isRunning = false;
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+        await this.sweeping;
+        log.info('   Network discovery stopped.');
+    }
+
+    public getStats(): DiscoveryStats {
+        return { ...this.stats, devices: this.devices.size };
+    }
+
+    private schedule(delayMs: number): void {
+        this.timer = setTimeout(() => {
+            this.sweeping = this.sweep().finally(() => {
+                this.sweeping = null;
+                if (this.isRunning) this.schedule(config.DISCOVERY_INTERVAL_MS);
+            });
+        }, delayMs);
+    }
+
+    private async sweep(): Promise<void> {
+        const found: { host: ArpHost; subnet: string }[] = [];
+        const errors: string[] = [];
+
+        for (const subnet of config.DISCOVERY_SUBNETS) {
+            if (!this.isRunning) return;
+            try {
+                const hosts = await arpScan(subnet, config.DISCOVERY_INTERFACE);
+                found.push(...hosts.map((host) => ({ host, subnet })));
+            } catch (err) {
+                errors.push(`${subnet}: ${(err as Error).message}`);
+                log.error(`❌ ARP sweep of ${subnet} failed: ${(err as Error).message}`);
+            }
+        }
+
+        const names = config.DISCOVERY_NETBIOS
+            ? await netbiosNames([...new Set(found.map(({ host }) => host.ip))], NETBIOS_TIMEOUT_MS)
+            : new Map();
+
+        const now = new Date().toISOString();
+        let added = 0;
+        for (const { host, subnet } of found) {
+            const netbios = names.get(host.ip);
+            const known = this.devices.get(host.mac);
+
+            const device: KnownDevice = {
+                ip: host.ip,
+                vendor: host.vendor ?? known?.vendor,
+                hostname: netbios?.name ?? known?.hostname,
+                workgroup: netbios?.workgroup ?? known?.workgroup,
+                first_seen: known?.first_seen ?? now,
+                last_seen: now,
+            };
+            this.devices.set(host.mac, device);
+
+            if (!known) {
+                added++;
+                this.report('discovery.new_device', host.mac, device, subnet);
+            } else if (known.ip !== host.ip) {
+                this.report('discovery.ip_changed', host.mac, device, subnet, { previous_ip: known.ip });
+            }
+        }
+
+        this.stats.sweeps++;
+        this.stats.last_sweep = now;
+        this.stats.last_error = errors.length > 0 ? errors.join('; ') : null;
+        this.stats.seen_last_sweep = found.length;
+        this.stats.new_devices += added;
+        log.info(`🛰️ Discovery sweep: ${found.length} devices up, ${added} new`);
+
+        await this.saveState();
+    }
+
+    private report(action: string, mac: string, device: KnownDevice, subnet: string, details: Record<string, unknown> = {}): void {
+        const record = {
+            event: action,
+            mac,
+            ip: device.ip,
+            vendor: device.vendor,
+            hostname: device.hostname,
+            workgroup: device.workgroup,
+            subnet,
+            first_seen: device.first_seen,
+            ...details,
+        };
+
+        // The device is the subject of the event, not its sender
+        const event = createSyslogEvent(JSON.stringify(record), { address: device.ip }, 'discovery');
+        event.tags = { discovery: 'arp' };
+        ingestEvent(this.buffer, event, { skipSourcePolicy: true });
+    }
+
+    private async restoreState(): Promise<void> {
+        if (!config.DISCOVERY_STATE_FILE) return;
+
+        try {
+            const state = JSON.parse(await readFile(config.DISCOVERY_STATE_FILE, 'utf8')) as { devices?: Record<string, KnownDevice> };
+            this.devices = new Map(Object.entries(state.devices ?? {}));
+        } catch {
+            // No state yet
+        }
+    }
+
+    private async saveState(): Promise<void> {
+        if (!config.DISCOVERY_STATE_FILE) return;
+
+        try {
+            const tmp = `${config.DISCOVERY_STATE_FILE}.tmp`;
+            await writeFile(tmp, JSON.stringify({ devices: Object.fromEntries(this.devices) }, null, 2));
+            await rename(tmp, config.DISCOVERY_STATE_FILE);
+        } catch (err) {
+            log.warn(`⚠️ Could not write discovery state: ${(err as Error).message}`);
+        }
+    }
+}
@@ -0,0 +1,46 @@
+import { execFile } from 'node:child_process';
+
+const SCAN_TIMEOUT_MS = 10 * 60000;
+
+// "192.168.1.10\t00:11:32:aa:bb:cc\tSynology Incorporated"
+const RESULT_LINE = /^(\d{1,3}(?:\.\d{1,3}){3})\t([0-9a-f]{2}(?::[0-9a-f]{2}){5})\t?(.*)$/i;
+
+export interface ArpHost {
+    ip: string;
+    mac: string;
+    vendor?: string;
+}
+
+/**
+ * ARP sweep of a subnet with arp-scan (raw sockets, needs CAP_NET_RAW).
+ * arp-scan resolves the MAC vendor from its IEEE OUI database.
+ */
+export function arpScan(subnet: string, iface?: string): Promise<ArpHost[]> {
+    const args = ['--plain', '--retry=2', ...(iface ? [`--interface=${iface}`] : []), subnet];
+
+    return new Promise((resolve, reject) => {
+        execFile('arp-scan', args, { timeout: SCAN_TIMEOUT_MS, maxBuffer: 16 * 1024 * 1024 }, (err, stdout, stderr) => {
+            if ((err as NodeJS.ErrnoException | null)?.code === 'ENOENT') {
+                reject(new Error('arp-scan not found (install it and grant CAP_NET_RAW)'));
+                return;
+            }
+            if (err) {
+                reject(new Error(stderr.trim().split('\n').pop() || err.message));
+                return;
+            }
+
+            const hosts = new Map<string, ArpHost>();
+            for (const line of stdout.split('\n')) {
+                const m = RESULT_LINE.exec(line.trim());
+                if (!m) continue;
+
+                // Hosts answering more than once are listed with "(DUP: n)"
+                const vendor = m[3]!.replace(/\s*\(DUP: \d+\)$/, '').trim();
+                const host: ArpHost = { ip: m[1]!, mac: m[2]!.toLowerCase() };
+                if (vendor && !/^\(Unknown/.test(vendor)) host.vendor = vendor;
+                if (!hosts.has(`${host.ip}/${host.mac}`)) hosts.set(`${host.ip}/${host.mac}`, host);
+            }
+            resolve([...hosts.values()]);
+        });
+    });
+}
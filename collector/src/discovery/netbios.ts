@@ -0,0 +1,108 @@
+import dgram from 'node:dgram';
+
+const NETBIOS_PORT = 137;
+const NBSTAT = 0x21;
+const GROUP_FLAG = 0x8000;
+
+export interface NetbiosInfo {
+    name?: string;
+    workgroup?: string;
+}
+
+/**
+ * NetBIOS node status (NBSTAT, RFC 1002 4.2.17) queries: Windows hosts, Samba
+ * servers, printers and NAS devices answer with their name and workgroup.
+ * All hosts are queried from one socket; silent hosts are simply missing.
+ */
+export function netbiosNames(addresses: string[], timeoutMs: number): Promise<Map<string, NetbiosInfo>> {
+    return new Promise((resolve) => {
+        const results = new Map<string, NetbiosInfo>();
+        if (addresses.length === 0) {
+            resolve(results);
+            return;
+        }
+
+        const socket = dgram.createSocket('udp4');
+        const finish = () => {
+            socket.close();
+            resolve(results);
+        };
+
+        socket.on('message', (message, rinfo) => {
+            try {
+                const info = parseNodeStatus(message);
+                if (info) results.set(rinfo.address, info);
+            } catch {
+                // Malformed answer
+            }
+            if (results.size === addresses.length) {
+                clearTimeout(timer);
+                finish();
+            }
+        });
+        socket.on('error', () => undefined); // ICMP unreachable from hosts without NetBIOS
+
+        const query = nodeStatusQuery();
+        for (const address of addresses) {
+            socket.send(query, NETBIOS_PORT, address);
+        }
+        const timer = setTimeout(finish, timeoutMs);
+    });
+}
+
+function nodeStatusQuery(): Buffer {
+    const header = Buffer.alloc(12);
+    header.writeUInt16BE(Math.floor(Math.random() * 0xffff), 0);
+    header.writeUInt16BE(1, 4); // One question
+
+    // "*" padded to 16 bytes, first-level encoded (each nibble + 'A')
+    const name = Buffer.alloc(34);
+    name[0] = 32;
+    const raw = Buffer.alloc(16);
+    raw[0] = 0x2a;
+    for (let i = 0; i < 16; i++) {
+        name[1 + i * 2] = 0x41 + (raw[i]! >> 4);
+        name[2 + i * 2] = 0x41 + (raw[i]! & 0x0f);
+    }
+
+    const question = Buffer.alloc(4);
+    question.writeUInt16BE(NBSTAT, 0);
+    question.writeUInt16BE(1, 2); // IN
+    return Buffer.concat([header, name, question]);
+}
+
+function parseNodeStatus(message: Buffer): NetbiosInfo | null {
+    if (message.readUInt16BE(6) === 0) return null; // No answer records
+
+    // Skip the answer name (labels up to the terminating zero)
+    let offset = 12;
+    while (message[offset]! !== 0) {
+        if ((message[offset]! & 0xc0) === 0xc0) {
+            offset += 1;
+            break;
+        }
+        offset += 1 + message[offset]!;
+    }
+    offset += 1;
+
+    if (message.readUInt16BE(offset) !== NBSTAT) return null;
+    offset += 10; // Type, class, TTL, RDLENGTH
+
+    const count = message[offset]!;
+    offset += 1;
+
+    const info: NetbiosInfo = {};
+    for (let i = 0; i < count && offset + 18 <= message.length; i++, offset += 18) {
+        const name = message.subarray(offset, offset + 15).toString('latin1').trim();
+        const suffix = message[offset + 15]!;
+        const flags = message.readUInt16BE(offset + 16);
+        if (suffix !== 0x00) continue; // Workstation service names only
+
+        if (flags & GROUP_FLAG) {
+            info.workgroup ??= name;
+        } else {
+            info.name ??= name;
+        }
+    }
+    return info.name || info.workgroup ? info : null;
+}
@@ -0,0 +1,298 @@
+import { spawn, type ChildProcess } from 'node:child_process';
+import { chmod, unlink } from 'node:fs/promises';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { parseDnsMessage, type DnsAnswer, type DnsMessage } from './dns/message.js';
+import { PcapReader, type CapturedSegment } from './dns/pcap.js';
+import { DnstapReceiver, type DnstapMessage } from './dns/dnstap.js';
+import { log } from './logger.js';
+
+const QUERY_TIMEOUT_MS = 5000;
+const MAX_PENDING_QUERIES = 50000;
+const RESTART_DELAY_MS = 5000;
+
+export interface DnsInputStats {
+    sniff: { running: boolean; packets: number; unanswered: number; invalid: number } | null;
+    dnstap: { messages: number; invalid: number } | null;
+    events: number;
+}
+
+/**
+ * Normalized DNS transaction, sent as the event's raw message (JSON)
+ */
+interface DnsRecord {
+    dns: 'query' | 'response' | 'unanswered';
+    input: 'sniff' | 'dnstap';
+    client?: string;
+    client_port?: number;
+    server?: string;
+    server_port?: number;
+    protocol?: string;
+    id?: number;
+    query?: string;
+    qtype?: string;
+    rcode?: string;
+    flags?: string[];
+    answers?: DnsAnswer[];
+    latency_ms?: number;
+    dnstap_type?: string;
+    dnstap_identity?: string;
+}
+
+interface PendingQuery {
+    time: number;
+    segment: CapturedSegment;
+    message: DnsMessage;
+}
+
+/**
+ * Passive DNS Input
+ *
+ * DNS visibility at sites whose resolver can't log queries:
+ *  - Sniffing (DNS_SNIFF_ENABLED): tcpdump captures port 53 on DNS_SNIFF_INTERFACE
+ *    (AF_PACKET) and writes pcap to us; queries are paired with their responses
+ *    to measure latency and report unanswered queries.
+ *  - dnstap (DNS_DNSTAP_ENABLED): resolvers with dnstap support (BIND, Unbound,
+ *    Knot, PowerDNS, CoreDNS) stream their query log over a unix or TCP socket.
+ *
+ * Each transaction becomes one event whose source is the DNS client. Queries
+ * are only reported on their own with DNS_LOG_QUERIES=true (responses already
+ * carry the question).
+ */
+export class DnsInput {
+    private buffer: MessageBuffer;
+    private capture: ChildProcess | null = null;
+    private captureTimer: NodeJS.Timeout | null = null;
+    private sweepTimer: NodeJS.Timeout | null = null;
+    private pending = new Map<string, PendingQuery>(); // client:port:id -> query
+    private dnstap: DnstapReceiver | null = null;
+    private stats: DnsInputStats;
+    private isRunning = false;
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+        this.stats = {
+            sniff: config.DNS_SNIFF_ENABLED ? { running: false, packets: 0, unanswered: 0, invalid: 0 } : null,
+            dnstap: config.DNS_DNSTAP_ENABLED ? { messages: 0, invalid: 0 } : null,
+            events: 0,
+        };
+    }
+
+    public async start(): Promise<void> {
+        this.isRunning = true;
+
+        if (config.DNS_SNIFF_ENABLED) {
+            this.startCapture();
+            this.sweepTimer = setInterval(() => this.sweepPending(), QUERY_TIMEOUT_MS);
+        }
+
+        if (config.DNS_DNSTAP_ENABLED) {
+            this.dnstap = new DnstapReceiver((message) => this.handleDnstap(message));
+            if (config.DNS_DNSTAP_PORT) {
+                await this.dnstap.listen(config.DNS_DNSTAP_PORT, config.DNS_DNSTAP_BIND_ADDRESS);
+                log.info(`🔎 dnstap receiver on tcp://${config.DNS_DNSTAP_BIND_ADDRESS}:${config.DNS_DNSTAP_PORT}`);
+            } else {
+                await unlink(config.DNS_DNSTAP_SOCKET).catch(() => undefined); // Stale socket from a previous run
+                await this.dnstap.listen(config.DNS_DNSTAP_SOCKET);
+                // The resolver runs as its own user; restrict access with the directory permissions
+                await chmod(config.DNS_DNSTAP_SOCKET, 0o666);
+                log.info(`🔎 dnstap receiver on unix:${config.DNS_DNSTAP_SOCKET}`);
+            }
+        }
+    }
+
+    public async stop(): Promise<void> {
+        this.isRunning = false;
+
+        if (this.captureTimer) {
+            clearTimeout(this.captureTimer);
+            this.captureTimer = null;
+        }
+        if (this.sweepTimer) {
+            clearInterval(this.sweepTimer);
+            this.sweepTimer = null;
+        }
+        this.capture?.kill();
+        this.capture = null;
+
+        if (this.dnstap) {
+            await this.dnstap.close();
+            if (!config.DNS_DNSTAP_PORT) await unlink(config.DNS_DNSTAP_SOCKET).catch(() => undefined);
+        }
+
+        log.info('   DNS input stopped.');
+    }
+
+    public getStats(): DnsInputStats {
+        return {
+            sniff: this.stats.sniff && { ...this.stats.sniff },
+            dnstap: this.stats.dnstap && { ...this.stats.dnstap, invalid: this.dnstap?.invalid ?? 0 },
+            events: this.stats.events,
+        };
+    }
+
+    // ============= SNIFFING =============
+
+    private startCapture(): void {
+        const args = ['-i', config.DNS_SNIFF_INTERFACE, '-n', '-s', '0', '-U', '--immediate-mode', '-w', '-', config.DNS_SNIFF_FILTER];
+        const capture = spawn('tcpdump', args, { stdio: ['ignore', 'pipe', 'pipe'] });
+        this.capture = capture;
+
+        const reader = new PcapReader((segment) => this.handleSegment(segment));
+        capture.stdout!.on('data', (data: Buffer) => {
+            try {
+                reader.write(data);
+            } catch (err) {
+                log.error(`❌ DNS capture: ${(err as Error).message}`);
+                capture.kill();
+            }
+        });
+
+        capture.stderr!.on('data', (data: Buffer) => {
+            const text = data.toString('utf8').trim();
+            if (text.startsWith('tcpdump: listening') || text.startsWith('listening on')) {
+                this.stats.sniff!.running = true;
+                log.info(`🔎 DNS sniffing on ${config.DNS_SNIFF_INTERFACE} (${config.DNS_SNIFF_FILTER})`);
+            } else if (text.length > 0 && !/packets? (captured|received|dropped)/.test(text)) {
+                log.warn(`⚠️ tcpdump: ${text}`);
+            }
+        });
+
+        capture.on('error', (err: NodeJS.ErrnoException) => {
+            log.error(err.code === 'ENOENT'
+                ? '❌ DNS sniffing needs tcpdump (install it and grant CAP_NET_RAW)'
+                : `❌ DNS capture error: ${err.message}`);
+        });
+
+        capture.on('close', (code) => {
+            this.stats.sniff!.running = false;
+            if (!this.isRunning || this.capture !== capture) return;
+
+            log.warn(`⚠️ DNS capture exited (code ${code}), restarting in ${RESTART_DELAY_MS / 1000}s`);
+            this.captureTimer = setTimeout(() => {
+                this.captureTimer = null;
+                if (this.isRunning) this.startCapture();
+            }, RESTART_DELAY_MS);
+        });
+    }
+
+    private handleSegment(segment: CapturedSegment): void {
+        this.stats.sniff!.packets++;
+
+        let message: DnsMessage;
+        try {
+            message = parseDnsMessage(segment.payload);
+        } catch {
+            this.stats.sniff!.invalid++;
+            return;
+        }
+
+        if (!message.response) {
+            if (this.pending.size < MAX_PENDING_QUERIES) {
+                this.pending.set(`${segment.src}:${segment.srcPort}:${message.id}`, { time: segment.time, segment, message });
+            }
+            if (config.DNS_LOG_QUERIES) {
+                this.emit(this.sniffRecord('query', segment, message, 'client'), segment.src, segment.srcPort);
+            }
+            return;
+        }
+
+        const key = `${segment.dst}:${segment.dstPort}:${message.id}`;
+        const query = this.pending.get(key);
+        this.pending.delete(key);
+
+        const record = this.sniffRecord('response', segment, message, 'server');
+        if (query) record.latency_ms = Math.round((segment.time - query.time) * 1000) / 1000;
+        this.emit(record, segment.dst, segment.dstPort);
+    }
+
+    /**
+     * Queries without a response within QUERY_TIMEOUT_MS (blocked, unreachable
+     * resolver, or exfiltration to a server that doesn't answer)
+     */
+    private sweepPending(): void {
+        const cutoff = Date.now() - QUERY_TIMEOUT_MS;
+        for (const [key, query] of this.pending) {
+            if (query.time > cutoff) continue;
+            this.pending.delete(key);
+            this.stats.sniff!.unanswered++;
+            this.emit(this.sniffRecord('unanswered', query.segment, query.message, 'client'), query.segment.src, query.segment.srcPort);
+        }
+    }
+
+    private sniffRecord(kind: DnsRecord['dns'], segment: CapturedSegment, message: DnsMessage, sender: 'client' | 'server'): DnsRecord {
+        const [client, clientPort, server, serverPort] = sender === 'client'
+            ? [segment.src, segment.srcPort, segment.dst, segment.dstPort]
+            : [segment.dst, segment.dstPort, segment.src, segment.srcPort];
+
+        return {
+            dns: kind,
+            input: 'sniff',
+            client,
+            client_port: clientPort,
+            server,
+            server_port: serverPort,
+            protocol: segment.protocol,
+            ...describe(message, kind === 'response'),
+        };
+    }
+
+    // ============= DNSTAP =============
+
+    private handleDnstap(tap: DnstapMessage): void {
+        this.stats.dnstap!.messages++;
+
+        const isResponse = tap.type.endsWith('_response');
+        if (!isResponse && !config.DNS_LOG_QUERIES) return;
+
+        const wire = isResponse ? tap.responseMessage : tap.queryMessage;
+        let message: DnsMessage | null = null;
+        if (wire) {
+            try {
+                message = parseDnsMessage(wire);
+            } catch {
+                this.stats.dnstap!.invalid++;
+            }
+        }
+
+        const record: DnsRecord = {
+            dns: isResponse ? 'response' : 'query',
+            input: 'dnstap',
+            client: tap.queryAddress,
+            client_port: tap.queryPort,
+            server: tap.responseAddress,
+            server_port: tap.responsePort,
+            protocol: tap.protocol,
+            ...(message && describe(message, isResponse)),
+            dnstap_type: tap.type,
+            dnstap_identity: tap.identity,
+        };
+        if (isResponse && tap.queryTime !== undefined && tap.responseTime !== undefined) {
+            record.latency_ms = Math.round((tap.responseTime - tap.queryTime) * 1000) / 1000;
+        }
+
+        this.emit(record, tap.queryAddress ?? 'unknown', tap.queryPort);
+    }
+
+    // ============= EVENTS =============
+
+    private emit(record: DnsRecord, address: string, port: number | undefined): void {
+        // The DNS client is the subject of the event, not its sender
+        const event = createSyslogEvent(JSON.stringify(record), { address, port }, 'dns');
+        event.tags = { dns_input: record.input };
+        ingestEvent(this.buffer, event, { skipSourcePolicy: true });
+        this.stats.events++;
+    }
+}
+
+function describe(message: DnsMessage, isResponse: boolean): Partial<DnsRecord> {
+    return {
+        id: message.id,
+        query: message.query,
+        qtype: message.qtype,
+        flags: message.flags,
+        ...(isResponse && { rcode: message.rcode, answers: message.answers }),
+    };
+}
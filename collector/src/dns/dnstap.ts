@@ -0,0 +1,233 @@
+import net from 'node:net';
+import { formatIpv6 } from './message.js';
+import { fields } from '../serializers/protobuf.js';
+import { log } from '../logger.js';
+
+/**
+ * dnstap receiver: Frame Streams (bidirectional handshake) over a unix or TCP
+ * socket, carrying protobuf dnstap.Dnstap messages (https://dnstap.info).
+ * Supported by BIND, Unbound, Knot Resolver, PowerDNS, CoreDNS and dnsdist.
+ */
+
+const CONTENT_TYPE = 'protobuf:dnstap.Dnstap';
+const MAX_FRAME_BYTES = 1024 * 1024;
+
+const CONTROL_ACCEPT = 0x01;
+const CONTROL_START = 0x02;
+const CONTROL_STOP = 0x03;
+const CONTROL_READY = 0x04;
+const CONTROL_FINISH = 0x05;
+const CONTROL_FIELD_CONTENT_TYPE = 0x01;
+
+const MESSAGE_TYPES: Record<number, string> = {
+    1: 'auth_query', 2: 'auth_response', 3: 'resolver_query', 4: 'resolver_response',
+    5: 'client_query', 6: 'client_response', 7: 'forwarder_query', 8: 'forwarder_response',
+    9: 'stub_query', 10: 'stub_response', 11: 'tool_query', 12: 'tool_response',
+    13: 'update_query', 14: 'update_response',
+};
+
+const SOCKET_PROTOCOLS: Record<number, string> = {
+    1: 'udp', 2: 'tcp', 3: 'dot', 4: 'doh', 5: 'dnscrypt_udp', 6: 'dnscrypt_tcp', 7: 'doq',
+};
+
+export interface DnstapMessage {
+    identity?: string;
+    type: string;
+    protocol?: string;
+    queryAddress?: string;
+    queryPort?: number;
+    responseAddress?: string;
+    responsePort?: number;
+    queryTime?: number; // Epoch ms
+    responseTime?: number;
+    queryMessage?: Buffer;
+    responseMessage?: Buffer;
+}
+
+/**
+ * Accepts Frame Streams connections from DNS servers; each decoded dnstap
+ * message is passed to the callback. Malformed data frames are counted and skipped.
+ */
+export class DnstapReceiver {
+    private server: net.Server;
+    private sockets = new Set<net.Socket>();
+    private onMessage: (message: DnstapMessage, peer: string) => void;
+    public invalid = 0;
+
+    constructor(onMessage: (message: DnstapMessage, peer: string) => void) {
+        this.onMessage = onMessage;
+        this.server = net.createServer(this.handleConnection.bind(this));
+        this.server.on('error', (err) => {
+            log.error(`❌ dnstap Receiver Error: ${err.message}`);
+        });
+    }
+
+    private handleConnection(socket: net.Socket): void {
+        this.sockets.add(socket);
+        const peer = socket.remoteAddress || 'local';
+        let pending = Buffer.alloc(0);
+
+        socket.on('data', (data: Buffer) => {
+            pending = Buffer.concat([pending, data]);
+
+            while (pending.length >= 4) {
+                const length = pending.readUInt32BE(0);
+
+                if (length === 0) {
+                    // Control frame: escape, length, type, fields
+                    if (pending.length < 8) break;
+                    const controlLength = pending.readUInt32BE(4);
+                    if (controlLength < 4 || controlLength > MAX_FRAME_BYTES) {
+                        socket.destroy();
+                        return;
+                    }
+                    if (pending.length < 8 + controlLength) break;
+
+                    const type = pending.readUInt32BE(8);
+                    pending = pending.subarray(8 + controlLength);
+                    if (!this.handleControl(type, socket)) return;
+                    continue;
+                }
+
+                if (length > MAX_FRAME_BYTES) {
+                    log.warn(`⚠️ Oversized dnstap frame from ${peer}, closing connection`);
+                    socket.destroy();
+                    return;
+                }
+                if (pending.length < 4 + length) break;
+
+                const frame = pending.subarray(4, 4 + length);
+                pending = pending.subarray(4 + length);
+                try {
+                    const message = decodeDnstap(frame);
+                    if (message) this.onMessage(message, peer);
+                } catch {
+                    this.invalid++;
+                }
+            }
+        });
+
+        socket.on('close', () => this.sockets.delete(socket));
+        socket.on('error', (err) => {
+            if ((err as NodeJS.ErrnoException).code !== 'ECONNRESET') {
+                log.error(`❌ dnstap socket error from ${peer}: ${err.message}`);
+            }
+            socket.destroy();
+        });
+    }
+
+    /**
+     * Returns false once the stream is finished
+     */
+    private handleControl(type: number, socket: net.Socket): boolean {
+        switch (type) {
+            case CONTROL_READY:
+                socket.write(controlFrame(CONTROL_ACCEPT));
+                return true;
+            case CONTROL_START:
+                return true;
+            case CONTROL_STOP:
+                socket.end(controlFrame(CONTROL_FINISH));
+                return false;
+            default:
+                return true;
+        }
+    }
+
+    public listen(path: string): Promise<void>;
+    public listen(port: number, host: string): Promise<void>;
+    public listen(pathOrPort: string | number, host?: string): Promise<void> {
+        return new Promise((resolve, reject) => {
+            this.server.once('error', reject);
+            const ready = () => {
+                this.server.off('error', reject);
+                resolve();
+            };
+            if (typeof pathOrPort === 'number') {
+                this.server.listen(pathOrPort, host, ready);
+            } else {
+                this.server.listen(pathOrPort, ready);
+            }
+        });
+    }
+
+    public close(): Promise<void> {
+        return new Promise((resolve) => {
+            for (const socket of this.sockets) {
+                socket.destroy();
+            }
+            this.server.close(() => resolve());
+        });
+    }
+}
+
+function controlFrame(type: number): Buffer {
+    // FINISH carries no fields; ACCEPT echoes the content type
+    const contentType = type === CONTROL_FINISH ? Buffer.alloc(0) : Buffer.from(CONTENT_TYPE);
+    const fieldBytes = contentType.length > 0 ? 8 + contentType.length : 0;
+
+    const frame = Buffer.alloc(12 + fieldBytes);
+    frame.writeUInt32BE(0, 0); // Escape
+    frame.writeUInt32BE(4 + fieldBytes, 4);
+    frame.writeUInt32BE(type, 8);
+    if (fieldBytes > 0) {
+        frame.writeUInt32BE(CONTROL_FIELD_CONTENT_TYPE, 12);
+        frame.writeUInt32BE(contentType.length, 16);
+        contentType.copy(frame, 20);
+    }
+    return frame;
+}
+
+/**
+ * Dnstap { identity = 1, version = 2, message = 14, type = 15 }
+ */
+function decodeDnstap(frame: Buffer): DnstapMessage | null {
+    let identity: string | undefined;
+    let message: DnstapMessage | null = null;
+
+    for (const field of fields(frame)) {
+        if (field.number === 1 && Buffer.isBuffer(field.value)) identity = field.value.toString('utf8');
+        if (field.number === 14 && Buffer.isBuffer(field.value)) message = decodeMessage(field.value);
+    }
+
+    if (message && identity) message.identity = identity;
+    return message;
+}
+
+/**
+ * Message { type = 1, socket_family = 2, socket_protocol = 3, query_address = 4,
+ * response_address = 5, query_port = 6, response_port = 7, query_time_sec = 8,
+ * query_time_nsec = 9, query_message = 10, response_time_sec = 12,
+ * response_time_nsec = 13, response_message = 14 }
+ */
+function decodeMessage(data: Buffer): DnstapMessage {
+    const message: DnstapMessage = { type: 'unknown' };
+    let queryNs = 0;
+    let responseNs = 0;
+
+    for (const { number, value } of fields(data)) {
+        switch (number) {
+            case 1: message.type = MESSAGE_TYPES[value as number] ?? `type_${value as number}`; break;
+            case 3: message.protocol = SOCKET_PROTOCOLS[value as number]; break;
+            case 4: message.queryAddress = formatAddress(value as Buffer); break;
+            case 5: message.responseAddress = formatAddress(value as Buffer); break;
+            case 6: message.queryPort = value as number; break;
+            case 7: message.responsePort = value as number; break;
+            case 8: message.queryTime = (value as number) * 1000; break;
+            case 9: queryNs = value as number; break;
+            case 10: message.queryMessage = value as Buffer; break;
+            case 12: message.responseTime = (value as number) * 1000; break;
+            case 13: responseNs = value as number; break;
+            case 14: message.responseMessage = value as Buffer; break;
+        }
+    }
+
+    if (message.queryTime !== undefined) message.queryTime += queryNs / 1e6;
+    if (message.responseTime !== undefined) message.responseTime += responseNs / 1e6;
+    return message;
+}
+
+function formatAddress(bytes: Buffer): string {
+    if (bytes.length === 16) return formatIpv6(bytes);
+    return Array.from(bytes).join('.');
+}
@@ -0,0 +1,176 @@
+/**
+ * DNS wire format (RFC 1035) decoding for the passive DNS inputs: header,
+ * first question and answer records, with the common record types decoded.
+ */
+
+const TYPES: Record<number, string> = {
+    1: 'A', 2: 'NS', 5: 'CNAME', 6: 'SOA', 12: 'PTR', 15: 'MX', 16: 'TXT', 28: 'AAAA',
+    33: 'SRV', 35: 'NAPTR', 41: 'OPT', 43: 'DS', 46: 'RRSIG', 47: 'NSEC', 48: 'DNSKEY',
+    64: 'SVCB', 65: 'HTTPS', 252: 'AXFR', 255: 'ANY', 257: 'CAA',
+};
+
+const RCODES: Record<number, string> = {
+    0: 'NOERROR', 1: 'FORMERR', 2: 'SERVFAIL', 3: 'NXDOMAIN', 4: 'NOTIMP', 5: 'REFUSED',
+};
+
+const MAX_ANSWERS = 20;
+
+export interface DnsAnswer {
+    name: string;
+    type: string;
+    ttl: number;
+    data?: string;
+}
+
+export interface DnsMessage {
+    id: number;
+    response: boolean;
+    opcode: number;
+    rcode: string;
+    flags: string[]; // aa, tc, rd, ra, ad, cd
+    query?: string;
+    qtype?: string;
+    answers: DnsAnswer[];
+}
+
+export function typeName(type: number): string {
+    return TYPES[type] ?? `TYPE${type}`;
+}
+
+/**
+ * Decode a DNS message; throws on truncated or malformed input
+ */
+export function parseDnsMessage(data: Buffer): DnsMessage {
+    if (data.length < 12) throw new Error('DNS message too short');
+
+    const flags = data.readUInt16BE(2);
+    const qdcount = data.readUInt16BE(4);
+    const ancount = data.readUInt16BE(6);
+
+    const message: DnsMessage = {
+        id: data.readUInt16BE(0),
+        response: (flags & 0x8000) !== 0,
+        opcode: (flags >> 11) & 0xf,
+        rcode: RCODES[flags & 0xf] ?? `RCODE${flags & 0xf}`,
+        flags: [
+            ...(flags & 0x0400 ? ['aa'] : []),
+            ...(flags & 0x0200 ? ['tc'] : []),
+            ...(flags & 0x0100 ? ['rd'] : []),
+            ...(flags & 0x0080 ? ['ra'] : []),
+            ...(flags & 0x0020 ? ['ad'] : []),
+            ...(flags & 0x0010 ? ['cd'] : []),
+        ],
+        answers: [],
+    };
+
+    let offset = 12;
+    for (let i = 0; i < qdcount; i++) {
+        const name = readName(data, offset);
+        offset = name.next;
+        const type = data.readUInt16BE(offset);
+        offset += 4; // Type, class
+        if (i === 0) {
+            message.query = name.name;
+            message.qtype = typeName(type);
+        }
+    }
+
+    for (let i = 0; i < ancount && message.answers.length < MAX_ANSWERS; i++) {
+        const name = readName(data, offset);
+        offset = name.next;
+        const type = data.readUInt16BE(offset);
+        const ttl = data.readUInt32BE(offset + 4);
+        const length = data.readUInt16BE(offset + 8);
+        offset += 10;
+        if (offset + length > data.length) throw new Error('Truncated resource record');
+
+        message.answers.push({ name: name.name, type: typeName(type), ttl, data: readRdata(data, offset, length, type) });
+        offset += length;
+    }
+
+    return message;
+}
+
+function readRdata(data: Buffer, offset: number, length: number, type: number): string | undefined {
+    switch (type) {
+        case 1:
+            return length === 4 ? Array.from(data.subarray(offset, offset + 4)).join('.') : undefined;
+        case 28:
+            return length === 16 ? formatIpv6(data.subarray(offset, offset + 16)) : undefined;
+        case 2:
+        case 5:
+        case 12:
+            return readName(data, offset).name;
+        case 15:
+            return `${data.readUInt16BE(offset)} ${readName(data, offset + 2).name}`;
+        case 33:
+            return `${data.readUInt16BE(offset)} ${data.readUInt16BE(offset + 2)} ${data.readUInt16BE(offset + 4)} ${readName(data, offset + 6).name}`;
+        case 16: {
+            const parts: string[] = [];
+            let i = offset;
+            while (i < offset + length) {
+                const size = data[i]!;
+                parts.push(data.subarray(i + 1, i + 1 + size).toString('utf8'));
+                i += 1 + size;
+            }
+            return parts.join('');
+        }
+        default:
+            return undefined;
+    }
+}
+
+/**
+ * Domain name with compression pointers (RFC 1035 4.1.4)
+ */
+function readName(data: Buffer, start: number): { name: string; next: number } {
+    const labels: string[] = [];
+    let offset = start;
+    let next = -1;
+    let jumps = 0;
+
+    for (;;) {
+        if (offset >= data.length) throw new Error('Truncated name');
+        const length = data[offset]!;
+
+        if ((length & 0xc0) === 0xc0) {
+            if (++jumps > 32) throw new Error('Compression loop');
+            if (next < 0) next = offset + 2;
+            offset = ((length & 0x3f) << 8) | data[offset + 1]!;
+            continue;
+        }
+        if (length === 0) {
+            if (next < 0) next = offset + 1;
+            break;
+        }
+
+        labels.push(data.subarray(offset + 1, offset + 1 + length).toString('latin1'));
+        offset += 1 + length;
+    }
+
+    return { name: labels.length > 0 ? labels.join('.') : '.', next };
+}
+
+export function formatIpv6(bytes: Buffer): string {
+    const groups: string[] = [];
+    for (let i = 0; i < 16; i += 2) {
+        groups.push(bytes.readUInt16BE(i).toString(16));
+    }
+
+    // Compress the longest run of zero groups (RFC 5952)
+    let bestStart = -1;
+    let bestLength = 1;
+    for (let i = 0; i < 8; i++) {
+        let j = i;
+        while (j < 8 && groups[j] === '0') j++;
+        if (j - i > bestLength) {
+            bestStart = i;
+            bestLength = j - i;
+        }
+    }
+    if (bestStart < 0) return groups.join(':');
+
+    const head = groups.slice(0, bestStart).join(':');
+    const tail = groups.slice(bestStart + bestLength).join(':');
+    return `${head}::${tail}`;
+}
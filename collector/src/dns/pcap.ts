@@ -0,0 +1,172 @@
+import { formatIpv6 } from './message.js';
+
+/**
+ * Streaming pcap (libpcap savefile) reader for the DNS sniffer: tcpdump writes
+ * the capture to stdout and packets are decoded down to the UDP/TCP payload.
+ */
+
+const LINKTYPE_NULL = 0;
+const LINKTYPE_ETHERNET = 1;
+const LINKTYPE_RAW = 101;
+const LINKTYPE_LINUX_SLL = 113;
+const LINKTYPE_LINUX_SLL2 = 276;
+
+const GLOBAL_HEADER_BYTES = 24;
+const RECORD_HEADER_BYTES = 16;
+const MAX_RECORD_BYTES = 262144;
+
+export interface CapturedSegment {
+    time: number; // Epoch ms
+    protocol: 'udp' | 'tcp';
+    src: string;
+    srcPort: number;
+    dst: string;
+    dstPort: number;
+    payload: Buffer;
+}
+
+export class PcapReader {
+    private pending = Buffer.alloc(0);
+    private littleEndian = true;
+    private nanoseconds = false;
+    private linkType = -1;
+    private onSegment: (segment: CapturedSegment) => void;
+
+    constructor(onSegment: (segment: CapturedSegment) => void) {
+        this.onSegment = onSegment;
+    }
+
+    /**
+     * Feed capture bytes; throws if the stream is not a pcap savefile
+     */
+    public write(data: Buffer): void {
+        this.pending = this.pending.length > 0 ? Buffer.concat([this.pending, data]) : data;
+
+        if (this.linkType < 0) {
+            if (this.pending.length < GLOBAL_HEADER_BYTES) return;
+            this.readGlobalHeader(this.pending);
+            this.pending = this.pending.subarray(GLOBAL_HEADER_BYTES);
+        }
+
+        while (this.pending.length >= RECORD_HEADER_BYTES) {
+            const seconds = this.readUInt32(this.pending, 0);
+            const fraction = this.readUInt32(this.pending, 4);
+            const captured = this.readUInt32(this.pending, 8);
+            if (captured > MAX_RECORD_BYTES) throw new Error(`Invalid pcap record length ${captured}`);
+            if (this.pending.length < RECORD_HEADER_BYTES + captured) break;
+
+            const packet = this.pending.subarray(RECORD_HEADER_BYTES, RECORD_HEADER_BYTES + captured);
+            this.pending = this.pending.subarray(RECORD_HEADER_BYTES + captured);
+
+            const time = seconds * 1000 + (this.nanoseconds ? fraction / 1e6 : fraction / 1e3);
+            const segment = this.decode(packet, time);
+            if (segment) this.onSegment(segment);
+        }
+    }
+
+    private readGlobalHeader(header: Buffer): void {
+        const magic = header.readUInt32LE(0);
+        if (magic === 0xa1b2c3d4 || magic === 0xa1b23c4d) {
+            this.littleEndian = true;
+        } else if (header.readUInt32BE(0) === 0xa1b2c3d4 || header.readUInt32BE(0) === 0xa1b23c4d) {
+            this.littleEndian = false;
+        } else {
+            throw new Error('Not a pcap stream');
+        }
+        this.nanoseconds = (this.littleEndian ? magic : header.readUInt32BE(0)) === 0xa1b23c4d;
+        this.linkType = this.readUInt32(header, 20) & 0x0fffffff;
+
+        if (![LINKTYPE_NULL, LINKTYPE_ETHERNET, LINKTYPE_RAW, LINKTYPE_LINUX_SLL, LINKTYPE_LINUX_SLL2].includes(this.linkType)) {
+            throw new Error(`Unsupported link type ${this.linkType}`);
+        }
+    }
+
+    private readUInt32(data: Buffer, offset: number): number {
+        return this.littleEndian ? data.readUInt32LE(offset) : data.readUInt32BE(offset);
+    }
+
+    private decode(packet: Buffer, time: number): CapturedSegment | null {
+        try {
+            let etherType: number;
+            let offset: number;
+
+            switch (this.linkType) {
+                case LINKTYPE_ETHERNET:
+                    etherType = packet.readUInt16BE(12);
+                    offset = 14;
+                    while (etherType === 0x8100 || etherType === 0x88a8) { // VLAN tags
+                        etherType = packet.readUInt16BE(offset + 2);
+                        offset += 4;
+                    }
+                    break;
+                case LINKTYPE_LINUX_SLL:
+                    etherType = packet.readUInt16BE(14);
+                    offset = 16;
+                    break;
+                case LINKTYPE_LINUX_SLL2:
+                    etherType = packet.readUInt16BE(0);
+                    offset = 20;
+                    break;
+                case LINKTYPE_NULL: {
+                    const family = packet.readUInt32LE(0) > 0xffff ? packet.readUInt32BE(0) : packet.readUInt32LE(0);
+                    etherType = family === 2 ? 0x0800 : 0x86dd;
+                    offset = 4;
+                    break;
+                }
+                default: // Raw IP
+                    etherType = (packet[0]! >> 4) === 6 ? 0x86dd : 0x0800;
+                    offset = 0;
+            }
+
+            if (etherType === 0x0800) return this.decodeIpv4(packet.subarray(offset), time);
+            if (etherType === 0x86dd) return this.decodeIpv6(packet.subarray(offset), time);
+            return null;
+        } catch {
+            return null; // Truncated (snaplen) or malformed
+        }
+    }
+
+    private decodeIpv4(ip: Buffer, time: number): CapturedSegment | null {
+        const headerLength = (ip[0]! & 0x0f) * 4;
+        const fragment = ip.readUInt16BE(6);
+        if ((fragment & 0x1fff) !== 0 || (fragment & 0x2000) !== 0) return null; // Fragments are not reassembled
+
+        const totalLength = ip.readUInt16BE(2);
+        const src = Array.from(ip.subarray(12, 16)).join('.');
+        const dst = Array.from(ip.subarray(16, 20)).join('.');
+        return decodeTransport(ip[9]!, ip.subarray(headerLength, totalLength), src, dst, time);
+    }
+
+    private decodeIpv6(ip: Buffer, time: number): CapturedSegment | null {
+        const payloadLength = ip.readUInt16BE(4);
+        const src = formatIpv6(ip.subarray(8, 24));
+        const dst = formatIpv6(ip.subarray(24, 40));
+        // Extension headers are not followed (DNS traffic rarely carries them)
+        return decodeTransport(ip[6]!, ip.subarray(40, 40 + payloadLength), src, dst, time);
+    }
+}
+
+function decodeTransport(protocol: number, data: Buffer, src: string, dst: string, time: number): CapturedSegment | null {
+    if (protocol === 17) {
+        return {
+            time, protocol: 'udp', src, dst,
+            srcPort: data.readUInt16BE(0),
+            dstPort: data.readUInt16BE(2),
+            payload: data.subarray(8, data.readUInt16BE(4)),
+        };
+    }
+
+    if (protocol === 6) {
+        const payload = data.subarray((data[12]! >> 4) * 4);
+        // Only messages carried whole in one segment (2-byte length prefix, RFC 1035 4.2.2)
+        if (payload.length < 14 || payload.readUInt16BE(0) !== payload.length - 2) return null;
+        return {
+            time, protocol: 'tcp', src, dst,
+            srcPort: data.readUInt16BE(0),
+            dstPort: data.readUInt16BE(2),
+            payload: payload.subarray(2),
+        };
+    }
+
+    return null;
+}
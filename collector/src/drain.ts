@@ -0,0 +1,143 @@
+import { config } from './config.js';
+import { log } from './logger.js';
+
+export interface DrainStats {
+    active: boolean;
+    max_eps: number;
+    backlog: number;
+    drained: number;
+    started_at: string | null;
+    progress_percent: number;
+    eta_seconds: number | null;
+}
+
+/**
+ * Drain Controller
+ *
+ * Paces delivery of backlogged events (retries after an outage) so recovery
+ * doesn't starve real-time traffic:
+ * - Token bucket caps backlog throughput at DRAIN_MAX_EPS
+ * - Live traffic always goes first; the backlog only gets a turn when the
+ *   live buffer is below one batch
+ * - Reports progress/ETA while a large backlog (>= DRAIN_THRESHOLD) is draining
+ */
+export class DrainController {
+    private readonly maxEps = config.DRAIN_MAX_EPS;
+    private readonly threshold = config.DRAIN_THRESHOLD;
+
+    private tokens: number;
+    private lastRefill = Date.now();
+
+    // Progress tracking for the current drain cycle
+    private active = false;
+    private startedAt = 0;
+    private initialBacklog = 0;
+    private drainedCount = 0;
+    private lastBacklog = 0;
+    private lastProgressLog = 0;
+
+    constructor() {
+        this.tokens = this.maxEps;
+    }
+
+    /**
+     * How many backlog events may be sent right now.
+     * Returns 0 while live traffic still has a full batch waiting.
+     */
+    public allowance(liveBacklog: number): number {
+        if (liveBacklog >= config.BATCH_SIZE) {
+            return 0;
+        }
+
+        if (this.maxEps === 0) {
+            return Number.POSITIVE_INFINITY;
+        }
+
+        this.refill();
+        return Math.floor(this.tokens);
+    }
+
+    /**
+     * Consume budget for backlog events that were handed to the transport
+     */
+    public consume(count: number): void {
+        if (this.maxEps === 0) return;
+        this.tokens = Math.max(0, this.tokens - count);
+    }
+
+    /**
+     * Record events successfully delivered from the backlog
+     */
+    public recordDrained(count: number): void {
+        this.drainedCount += count;
+    }
+
+    /**
+     * Update drain state with the current backlog size.
+     * Should be called on every retry tick.
+     */
+    public update(backlog: number): void {
+        this.lastBacklog = backlog;
+        const now = Date.now();
+
+        if (!this.active && backlog >= this.threshold) {
+            this.active = true;
+            this.startedAt = now;
+            this.initialBacklog = backlog;
+            this.drainedCount = 0;
+            this.lastProgressLog = now;
+            const limit = this.maxEps === 0 ? 'unlimited' : `${this.maxEps} EPS`;
+            log.info(`🚰 Draining backlog of ${backlog} events (${limit}, live traffic first)`);
+            return;
+        }
+
+        if (!this.active) return;
+
+        if (backlog === 0) {
+            const seconds = Math.round((now - this.startedAt) / 1000);
+            log.info(`✅ Backlog drained: ${this.drainedCount} events in ${seconds}s`);
+            this.active = false;
+            return;
+        }
+
+        // A growing backlog (outage still ongoing) extends the current cycle
+        if (backlog + this.drainedCount > this.initialBacklog) {
+            this.initialBacklog = backlog + this.drainedCount;
+        }
+
+        if (now - this.lastProgressLog >= 30000) {
+            this.lastProgressLog = now;
+            const stats = this.getStats();
+            const eta = stats.eta_seconds === null ? 'unknown' : `${stats.eta_seconds}s`;
+            log.info(
+                `🚰 Drain progress: ${stats.drained}/${this.initialBacklog} ` +
+                `(${stats.progress_percent}%), remaining ${backlog}, ETA ${eta}`
+            );
+        }
+    }
+
+    public getStats(): DrainStats {
+        const elapsedSeconds = (Date.now() - this.startedAt) / 1000;
+        const rate = this.active && elapsedSeconds > 0 ? this.drainedCount / elapsedSeconds : 0;
+
+        return {
+            active: this.active,
+            max_eps: this.maxEps,
+            backlog: this.lastBacklog,
+            drained: this.active ? this.drainedCount : 0,
+            started_at: this.active ? new Date(this.startedAt).toISOString() : null,
+            progress_percent: this.active && this.initialBacklog > 0
+                ? Math.round((this.drainedCount / this.initialBacklog) * 10000) / 100
+                : 0,
+            eta_seconds: rate > 0 ? Math.round(this.lastBacklog / rate) : null,
+        };
+    }
+
+    private refill(): void {
+        const now = Date.now();
+        const elapsed = (now - this.lastRefill) / 1000;
+        this.lastRefill = now;
+        // Allow bursting up to one second's worth of budget
+        this.tokens = Math.min(this.maxEps, this.tokens + elapsed * this.maxEps);
+    }
+}
@@ -0,0 +1,252 @@
+import { config } from './config.js';
+import { groupByPartition, type SyslogEvent } from './buffer.js';
+import { metrics } from './metrics.js';
+import { buildIngestPayload, getSerializer } from './serializers.js';
+import { identityHeaders, partitionHeaders } from './identity.js';
+import { OutputQueue, type OverflowPolicy } from './output-queue.js';
+import { backendFetch } from './http-client.js';
+import { apiKey } from './api-key.js';
+import { log } from './logger.js';
+
+const REQUEST_TIMEOUT_MS = 30000;
+
+// Refused for the request itself: sending it again won't help
+const isPermanent = (status: number) => status >= 400 && status < 500 && status !== 408 && status !== 429;
+
+interface PendingRetry {
+    events: SyslogEvent[];
+    attempts: number;
+    nextRetryAt: number;
+}
+
+/**
+ * One side of the comparison (events since dual-write started)
+ */
+export interface DualWriteSide {
+    delivered: number;
+    rejected: number;
+    avg_latency_ms: number;
+}
+
+export interface DualWriteStats {
+    url: string;
+    started_at: string;
+    queue: number;
+    queue_capacity: number;
+    overflow: OverflowPolicy;
+    retrying: number;
+    dropped: number; // Queue full
+    given_up: number; // Still failing after MAX_RETRIES
+    responses: Record<string, number>; // HTTP status (or "error") -> count
+    primary: DualWriteSide;
+    secondary: DualWriteSide;
+    delivered_gap: number; // Delivered by the primary but (not yet) by the new backend
+}
+
+/**
+ * Dual-Write Forwarder (backend migration)
+ *
+ * Sends every event the primary backend gets (CENTINELA_API_URL) to a new
+ * backend (DUAL_WRITE_URL) as well, to validate an ingest migration on real
+ * traffic before cutting over. The primary stays authoritative: the new
+ * backend has its own bounded queue (OutputQueue) and its own retries with
+ * backoff, and never touches the primary's retry queue, DLQ, write-ahead log
+ * or endpoint failover. Events it still can't take after MAX_RETRIES are
+ * counted as given up, not dead-lettered.
+ *
+ * The comparison report (log and /metrics) puts both sides next to each
+ * other: delivered, rejected and latency, and the delivery gap.
+ */
+export class DualWriteForwarder {
+    private readonly bulkUrl: string;
+    private readonly headers: Record<string, string>;
+    private readonly queue: OutputQueue;
+    private readonly startedAt = new Date();
+    private readonly baseline = metrics.getSnapshot(); // Primary counters before dual-write
+
+    private retries: PendingRetry[] = [];
+    private retrying = 0; // Events in `retries`
+    private processingRetries = false;
+    private retryTimer: NodeJS.Timeout | null = null;
+    private reportTimer: NodeJS.Timeout | null = null;
+
+    private delivered = 0;
+    private rejected = 0;
+    private givenUp = 0;
+    private latencySum = 0;
+    private latencyCount = 0;
+    private responses: Record<string, number> = {};
+
+    constructor(url: string) {
+        this.bulkUrl = url.replace('/syslog', '/syslog/bulk');
+        this.headers = {
+            ...identityHeaders(),
+            'X-Centinela-Dual-Write': 'true',
+        };
+        // Retrying events count towards the queue size
+        this.queue = new OutputQueue('Dual-write', {
+            capacity: () => Math.max(0, config.DUAL_WRITE_QUEUE_SIZE - this.retrying),
+            overflow: () => config.DUAL_WRITE_OVERFLOW,
+            send: (batch) => this.sendBatch(batch, 0),
+        });
+    }
+
+    /**
+     * Offer events that are about to be sent to the primary (all of them are queued)
+     */
+    public offer(events: SyslogEvent[]): void {
+        this.queue.offer(events);
+    }
+
+    public start(): void {
+        log.info(`🔀 Dual-writing every event to ${this.bulkUrl} (primary stays ${config.CENTINELA_API_URL})`);
+
+        this.queue.start();
+
+        const retryTick = async () => {
+            await this.processRetries();
+            this.retryTimer = setTimeout(retryTick, config.RETRY_CHECK_INTERVAL_MS);
+        };
+        this.retryTimer = setTimeout(retryTick, config.RETRY_CHECK_INTERVAL_MS);
+
+        const reportTick = () => {
+            this.logReport();
+            this.reportTimer = setTimeout(reportTick, config.DUAL_WRITE_REPORT_INTERVAL_MS);
+        };
+        this.reportTimer = setTimeout(reportTick, config.DUAL_WRITE_REPORT_INTERVAL_MS);
+    }
+
+    public stop(): void {
+        this.queue.stop();
+        if (this.retryTimer) {
+            clearTimeout(this.retryTimer);
+            this.retryTimer = null;
+        }
+        if (this.reportTimer) {
+            clearTimeout(this.reportTimer);
+            this.reportTimer = null;
+        }
+        this.logReport();
+    }
+
+    public getStats(): DualWriteStats {
+        const queue = this.queue.getStats();
+        const primary = this.primarySide();
+        return {
+            url: this.bulkUrl,
+            started_at: this.startedAt.toISOString(),
+            queue: queue.queued,
+            queue_capacity: config.DUAL_WRITE_QUEUE_SIZE,
+            overflow: queue.overflow,
+            retrying: this.retrying,
+            dropped: queue.dropped,
+            given_up: this.givenUp,
+            responses: { ...this.responses },
+            primary,
+            secondary: {
+                delivered: this.delivered,
+                rejected: this.rejected,
+                avg_latency_ms: this.latencyCount > 0 ? Math.round(this.latencySum / this.latencyCount) : 0,
+            },
+            delivered_gap: primary.delivered - this.delivered,
+        };
+    }
+
+    private primarySide(): DualWriteSide {
+        const snapshot = metrics.getSnapshot();
+        return {
+            delivered: snapshot.events.sent - this.baseline.events.sent,
+            rejected: snapshot.events.rejected - this.baseline.events.rejected,
+            avg_latency_ms: snapshot.latency.avg_ms,
+        };
+    }
+
+    private logReport(): void {
+        const stats = this.getStats();
+        const side = (s: DualWriteSide) => `${s.delivered} delivered, ${s.rejected} rejected, ${s.avg_latency_ms}ms avg`;
+        log.info(`🔀 Dual-write report: primary ${side(stats.primary)} | new backend ${side(stats.secondary)}`);
+        log.info(`   Gap ${stats.delivered_gap} (queued ${stats.queue}, retrying ${stats.retrying}, ` +
+            `dropped ${stats.dropped}, given up ${stats.given_up})`);
+    }
+
+    /**
+     * Send one batch per tenant/site; failures are retried with backoff,
+     * refusals (4xx) are counted as rejected
+     */
+    private async sendBatch(batch: SyslogEvent[], attempts: number): Promise<void> {
+        for (const events of groupByPartition(batch, (event) => event)) {
+            const start = Date.now();
+            let outcome: string;
+
+            try {
+                const serializer = getSerializer(config.BATCH_FORMAT);
+                const response = await backendFetch(this.bulkUrl, {
+                    method: 'POST',
+                    headers: {
+                        ...this.headers,
+                        'Authorization': `Bearer ${config.DUAL_WRITE_API_KEY ?? apiKey()}`,
+                        ...partitionHeaders(events[0]!),
+                        'Content-Type': serializer.contentType,
+                    },
+                    body: serializer.batch(events.map(buildIngestPayload)),
+                    signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS),
+                });
+                outcome = String(response.status);
+
+                if (response.ok) {
+                    const body = await response.json().catch(() => null) as { rejected?: unknown } | null;
+                    const rejected = Array.isArray(body?.rejected) ? Math.min(body.rejected.length, events.length) : 0;
+                    this.delivered += events.length - rejected;
+                    this.rejected += rejected;
+                    this.latencySum += Date.now() - start;
+                    this.latencyCount++;
+                } else {
+                    await response.text().catch(() => '');
+                    if (isPermanent(response.status)) {
+                        this.rejected += events.length;
+                    } else {
+                        this.scheduleRetry(events, attempts + 1);
+                    }
+                }
+            } catch {
+                outcome = 'error';
+                this.scheduleRetry(events, attempts + 1);
+            }
+
+            this.responses[outcome] = (this.responses[outcome] ?? 0) + 1;
+        }
+    }
+
+    private scheduleRetry(events: SyslogEvent[], attempts: number): void {
+        if (attempts > config.MAX_RETRIES) {
+            this.givenUp += events.length;
+            log.debug(`⚠️ Dual-write: gave up on ${events.length} events after ${config.MAX_RETRIES} retries`);
+            return;
+        }
+
+        // Exponential backoff with ±10% jitter, as for the primary
+        const delay = Math.min(config.RETRY_BASE_DELAY_MS * Math.pow(2, attempts - 1), config.RETRY_MAX_DELAY_MS);
+        const jitter = delay * 0.2 * (Math.random() - 0.5);
+        this.retries.push({ events, attempts, nextRetryAt: Date.now() + Math.floor(delay + jitter) });
+        this.retrying += events.length;
+    }
+
+    private async processRetries(): Promise<void> {
+        if (this.processingRetries) return;
+        this.processingRetries = true;
+
+        try {
+            const now = Date.now();
+            const ready = this.retries.filter((retry) => retry.nextRetryAt <= now);
+            if (ready.length === 0) return;
+
+            this.retries = this.retries.filter((retry) => retry.nextRetryAt > now);
+            for (const retry of ready) {
+                this.retrying -= retry.events.length;
+                await this.sendBatch(retry.events, retry.attempts);
+            }
+        } finally {
+            this.processingRetries = false;
+        }
+    }
+}
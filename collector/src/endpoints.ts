@@ -0,0 +1,190 @@
+import { config, type BackendEndpoint } from './config.js';
+import { backendFetch } from './http-client.js';
+import { log } from './logger.js';
+
+const PROBE_TIMEOUT_MS = 10000;
+
+export interface EndpointStats {
+    current_url: string;
+    current_region: string | null;
+    allowed_regions: string[];
+    consecutive_failures: number;
+    failovers: number;
+    failbacks: number;
+    residency_blocks: number;
+    last_probe_at: string | null; // Last check of the primary while failed over
+    last_probe_error: string | null;
+}
+
+/**
+ * Backend Endpoint Selector
+ *
+ * Tracks the ingest endpoints this collector may talk to and which one is active:
+ * - The primary (CENTINELA_API_URL) is always first, followed by the standby
+ *   (BACKEND_INGEST_URL_FAILOVER) and BACKEND_ENDPOINTS
+ * - After FAILOVER_THRESHOLD consecutive failures, moves to the next endpoint
+ * - While away from the primary, probes it every FAILBACK_PROBE_INTERVAL_MS
+ *   and fails back as soon as it answers without a 5xx: any other status,
+ *   even 401 or 405 to the probe's GET, means the region is serving again
+ * - Never fails over to an endpoint outside DATA_RESIDENCY_REGIONS; instead it
+ *   stays on the current endpoint (events keep queueing for retry) and raises an alert
+ */
+export class EndpointSelector {
+    private endpoints: BackendEndpoint[];
+    private readonly allowedRegions = config.DATA_RESIDENCY_REGIONS;
+    private currentIndex = 0;
+    private consecutiveFailures = 0;
+    private failoverCount = 0;
+    private failbackCount = 0;
+    private residencyBlockCount = 0;
+    private lastAlertAt = 0;
+    private probing = false;
+    private nextProbeAt = 0;
+    private lastProbeAt: string | null = null;
+    private lastProbeError: string | null = null;
+
+    constructor() {
+        this.endpoints = [
+            { region: config.CENTINELA_API_REGION ?? null, url: config.CENTINELA_API_URL },
+            ...(config.BACKEND_INGEST_URL_FAILOVER ? [config.BACKEND_INGEST_URL_FAILOVER] : []),
+            ...config.BACKEND_ENDPOINTS,
+        ];
+
+        const primary = this.endpoints[0]!;
+        if (this.allowedRegions.length > 0 && !this.isAllowed(primary)) {
+            throw new Error(
+                `Primary endpoint region "${primary.region ?? 'unset'}" is outside DATA_RESIDENCY_REGIONS ` +
+                `(${this.allowedRegions.join(', ')}). Set CENTINELA_API_REGION or fix the residency list.`
+            );
+        }
+    }
+
+    /**
+     * The endpoint events should currently be sent to
+     */
+    public current(): BackendEndpoint {
+        // Probed on use: a collector with nothing to send has no reason to fail back
+        if (this.currentIndex !== 0 && config.FAILBACK_PROBE_INTERVAL_MS > 0 && !this.probing && Date.now() >= this.nextProbeAt) {
+            void this.probePrimary();
+        }
+        return this.endpoints[this.currentIndex]!;
+    }
+
+    public recordSuccess(): void {
+        this.consecutiveFailures = 0;
+    }
+
+    /**
+     * Record a failed request (network error or 5xx).
+     * Triggers failover once the threshold is reached.
+     */
+    public recordFailure(): void {
+        this.consecutiveFailures++;
+
+        if (this.consecutiveFailures < config.FAILOVER_THRESHOLD || this.endpoints.length < 2) {
+            return;
+        }
+
+        const next = this.findNextCandidate();
+        const current = this.current();
+
+        if (next === null) {
+            this.residencyBlockCount++;
+            this.alertResidencyBlock(current);
+            this.consecutiveFailures = 0;
+            return;
+        }
+
+        const target = this.endpoints[next]!;
+        log.warn(
+            `🔀 Failing over from ${current.url} (${current.region ?? 'no region'}) ` +
+            `to ${target.url} (${target.region ?? 'no region'}) after ${this.consecutiveFailures} consecutive failures`
+        );
+
+        this.currentIndex = next;
+        this.consecutiveFailures = 0;
+        this.failoverCount++;
+        // The primary just failed: first probe one interval from now
+        this.nextProbeAt = Date.now() + config.FAILBACK_PROBE_INTERVAL_MS;
+    }
+
+    public getStats(): EndpointStats {
+        const current = this.current();
+        return {
+            current_url: current.url,
+            current_region: current.region,
+            allowed_regions: this.allowedRegions,
+            consecutive_failures: this.consecutiveFailures,
+            failovers: this.failoverCount,
+            failbacks: this.failbackCount,
+            residency_blocks: this.residencyBlockCount,
+            last_probe_at: this.lastProbeAt,
+            last_probe_error: this.lastProbeError,
+        };
+    }
+
+    /**
+     * Check whether the primary is serving again and, if so, go back to it
+     */
+    private async probePrimary(): Promise<void> {
+        this.probing = true;
+        this.nextProbeAt = Date.now() + config.FAILBACK_PROBE_INTERVAL_MS;
+        this.lastProbeAt = new Date().toISOString();
+        const primary = this.endpoints[0]!;
+
+        try {
+            const response = await backendFetch(primary.url, { signal: AbortSignal.timeout(PROBE_TIMEOUT_MS) });
+            await response.body?.cancel();
+            if (response.status >= 500) throw new Error(`HTTP ${response.status}`);
+        } catch (err) {
+            this.lastProbeError = (err as Error).message;
+            return;
+        } finally {
+            this.probing = false;
+        }
+
+        if (this.currentIndex === 0) return;
+        const current = this.endpoints[this.currentIndex]!;
+        log.info(`🔀 Primary ${primary.url} (${primary.region ?? 'no region'}) is back, failing back from ${current.url}`);
+        this.currentIndex = 0;
+        this.consecutiveFailures = 0;
+        this.failbackCount++;
+        this.lastProbeError = null;
+    }
+
+    /**
+     * Next endpoint in rotation that respects data residency.
+     * Returns null if the only alternatives would cross a residency boundary.
+     */
+    private findNextCandidate(): number | null {
+        for (let step = 1; step < this.endpoints.length; step++) {
+            const index = (this.currentIndex + step) % this.endpoints.length;
+            if (this.isAllowed(this.endpoints[index]!)) {
+                return index;
+            }
+        }
+        return null;
+    }
+
+    private isAllowed(endpoint: BackendEndpoint): boolean {
+        if (this.allowedRegions.length === 0) return true;
+        return endpoint.region !== null && this.allowedRegions.includes(endpoint.region);
+    }
+
+    private alertResidencyBlock(current: BackendEndpoint): void {
+        // Loud, but not once per failed request
+        const now = Date.now();
+        if (now - this.lastAlertAt < 60000) return;
+        this.lastAlertAt = now;
+
+        const blocked = this.endpoints
+            .filter((e) => e !== current && !this.isAllowed(e))
+            .map((e) => `${e.url} (${e.region ?? 'no region'})`);
+
+        log.error(
+            `🚨 RESIDENCY: backend ${current.url} (${current.region ?? 'no region'}) is failing, ` +
+            `but failover is blocked by DATA_RESIDENCY_REGIONS=${this.allowedRegions.join(',')}. ` +
+            `Refusing to send data to: ${blocked.join(', ')}. Events stay queued for retry.`
+        );
+    }
+}
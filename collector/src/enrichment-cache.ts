@@ -0,0 +1,172 @@
+import { config, ENRICHMENT_NAMESPACES } from './config.js';
+
+export type EnrichmentNamespace = (typeof ENRICHMENT_NAMESPACES)[number];
+
+export interface EnrichmentNamespaceStats {
+    entries: number;
+    ttl_ms: number;
+    hits: number;
+    misses: number;
+    negative_hits: number; // Cached "not found" answers
+    loads: number;
+    load_errors: number;
+    evictions: number; // Pushed out by the shared size bound
+    expirations: number;
+}
+
+export interface EnrichmentCacheStats {
+    max_entries: number;
+    entries: number;
+    namespaces: Record<string, EnrichmentNamespaceStats>;
+}
+
+interface Entry {
+    value: unknown; // null = looked up, not found
+    expiresAt: number;
+}
+
+/**
+ * Shared Enrichment Cache
+ *
+ * One size-bounded LRU for every enrichment lookup (GeoIP, reverse DNS,
+ * threat intel, LDAP), so memory stays predictable on small edge boxes
+ * however many processors are enabled: ENRICHMENT_CACHE_MAX_ENTRIES bounds
+ * all namespaces together, and the least recently used entry goes first,
+ * whichever namespace it belongs to. Each namespace has its own TTL
+ * (ENRICHMENT_CACHE_TTLS, default ENRICHMENT_CACHE_TTL_MS); "not found"
+ * answers are cached for ENRICHMENT_CACHE_NEGATIVE_TTL_MS so unknown
+ * addresses aren't looked up on every event.
+ *
+ * Processors use lookup(), or get() and prefetch() when they can't wait:
+ * concurrent misses for the same key share one load, and a failed load is
+ * not cached.
+ */
+class EnrichmentCache {
+    private entries = new Map<string, Entry>(); // "<namespace>:<key>", least recently used first
+    private pending = new Map<string, Promise<unknown>>();
+    private counters = new Map<EnrichmentNamespace, Omit<EnrichmentNamespaceStats, 'entries' | 'ttl_ms'>>();
+
+    /**
+     * The cached value of a key, or undefined if there is none (or it
+     * expired). null is a cached "not found".
+     */
+    public get<T>(namespace: EnrichmentNamespace, key: string): T | null | undefined {
+        const id = `${namespace}:${key}`;
+        const entry = this.entries.get(id);
+        const counters = this.countersOf(namespace);
+        if (!entry) {
+            counters.misses++;
+            return undefined;
+        }
+        if (entry.expiresAt <= Date.now()) {
+            this.entries.delete(id);
+            counters.expirations++;
+            counters.misses++;
+            return undefined;
+        }
+
+        // Most recently used last
+        this.entries.delete(id);
+        this.entries.set(id, entry);
+        counters.hits++;
+        if (entry.value === null) counters.negative_hits++;
+        return entry.value as T | null;
+    }
+
+    /**
+     * Cache a value (null: not found, kept for the negative TTL)
+     */
+    public set<T>(namespace: EnrichmentNamespace, key: string, value: T | null): void {
+        const id = `${namespace}:${key}`;
+        const ttl = value === null ? config.ENRICHMENT_CACHE_NEGATIVE_TTL_MS : this.ttl(namespace);
+        this.entries.delete(id);
+        if (ttl === 0 || config.ENRICHMENT_CACHE_MAX_ENTRIES === 0) return;
+
+        this.entries.set(id, { value, expiresAt: Date.now() + ttl });
+        while (this.entries.size > config.ENRICHMENT_CACHE_MAX_ENTRIES) {
+            const oldest = this.entries.keys().next().value!;
+            this.entries.delete(oldest);
+            this.countersOf(oldest.slice(0, oldest.indexOf(':')) as EnrichmentNamespace).evictions++;
+        }
+    }
+
+    /**
+     * The cached value, or load it (once, however many callers miss at the
+     * same time) and cache the result. load resolves null for "not found".
+     */
+    public async lookup<T>(namespace: EnrichmentNamespace, key: string, load: () => Promise<T | null>): Promise<T | null> {
+        const cached = this.get<T>(namespace, key);
+        if (cached !== undefined) return cached;
+        return this.load(namespace, key, load);
+    }
+
+    /**
+     * Load a key get() missed in the background, for processors that can't
+     * wait for the answer (unless it is being loaded already). A failed load
+     * only shows in the stats.
+     */
+    public prefetch<T>(namespace: EnrichmentNamespace, key: string, load: () => Promise<T | null>): void {
+        this.load(namespace, key, load).catch(() => undefined);
+    }
+
+    /**
+     * Drop a namespace's entries (e.g. a GeoIP database or threat feed was
+     * updated), or everything
+     */
+    public clear(namespace?: EnrichmentNamespace): void {
+        if (!namespace) {
+            this.entries.clear();
+            return;
+        }
+        for (const id of this.entries.keys()) {
+            if (id.startsWith(`${namespace}:`)) this.entries.delete(id);
+        }
+    }
+
+    public getStats(): EnrichmentCacheStats {
+        const sizes = new Map<string, number>();
+        for (const id of this.entries.keys()) {
+            const namespace = id.slice(0, id.indexOf(':'));
+            sizes.set(namespace, (sizes.get(namespace) ?? 0) + 1);
+        }
+
+        const namespaces: Record<string, EnrichmentNamespaceStats> = {};
+        for (const namespace of ENRICHMENT_NAMESPACES) {
+            namespaces[namespace] = { entries: sizes.get(namespace) ?? 0, ttl_ms: this.ttl(namespace), ...this.countersOf(namespace) };
+        }
+        return { max_entries: config.ENRICHMENT_CACHE_MAX_ENTRIES, entries: this.entries.size, namespaces };
+    }
+
+    private load<T>(namespace: EnrichmentNamespace, key: string, load: () => Promise<T | null>): Promise<T | null> {
+        const id = `${namespace}:${key}`;
+        const inFlight = this.pending.get(id);
+        if (inFlight) return inFlight as Promise<T | null>;
+
+        const counters = this.countersOf(namespace);
+        counters.loads++;
+        const loading = load().then((value) => {
+            this.set(namespace, key, value);
+            return value;
+        }, (err: unknown) => {
+            counters.load_errors++;
+            throw err;
+        }).finally(() => this.pending.delete(id));
+        this.pending.set(id, loading);
+        return loading;
+    }
+
+    private ttl(namespace: EnrichmentNamespace): number {
+        return config.ENRICHMENT_CACHE_TTLS[namespace] ?? config.ENRICHMENT_CACHE_TTL_MS;
+    }
+
+    private countersOf(namespace: EnrichmentNamespace): Omit<EnrichmentNamespaceStats, 'entries' | 'ttl_ms'> {
+        let counters = this.counters.get(namespace);
+        if (!counters) {
+            counters = { hits: 0, misses: 0, negative_hits: 0, loads: 0, load_errors: 0, evictions: 0, expirations: 0 };
+            this.counters.set(namespace, counters);
+        }
+        return counters;
+    }
+}
+
+export const enrichmentCache = new EnrichmentCache();
@@ -0,0 +1,80 @@
+import { createHash } from 'node:crypto';
+import type { SyslogEvent } from './buffer.js';
+import type { LogFields } from './logger.js';
+
+export interface EventContext {
+    traceId: string; // 32 hex digits (W3C trace-id)
+    receivedAt: number; // When this collector received the event (ms since epoch)
+    source: string; // ip:port/transport of the sender, before any processing
+}
+
+const contexts = new WeakMap<SyslogEvent, EventContext>();
+
+/**
+ * Trace ID of an event: its event_id (a UUIDv7, 16 bytes like a trace-id)
+ * as 32 hex digits. Derived rather than stored, so it is the same wherever
+ * the event goes: across relays, after a WAL replay, in the dead-letter file
+ * and at the backend, which can compute it from event_id too.
+ */
+export function traceIdOf(event: Pick<SyslogEvent, 'event_id'>): string {
+    const hex = event.event_id.replace(/-/g, '').toLowerCase();
+    if (/^[0-9a-f]{32}$/.test(hex) && !/^0+$/.test(hex)) return hex;
+    // Not a UUID (an importer's own ID): a stable hash of it instead
+    return createHash('sha256').update(event.event_id).digest('hex').slice(0, 32);
+}
+
+/**
+ * Event Context
+ *
+ * What's needed to follow one event through the pipeline: its trace ID, when
+ * it arrived and who sent it. Created on receive (ingestEvent) and read by
+ * every stage after it, the processors, the transport and the secondary
+ * outputs, for their log records, the dead-letter file and the exported
+ * traces and log records.
+ *
+ * Like the pipeline traces, the context is kept beside the event (WeakMap),
+ * not in it. Events that were never ingested here (read back from the WAL or
+ * a spool after a restart) get one derived from their own fields on first
+ * use, with the same trace ID.
+ */
+export function beginContext(event: SyslogEvent): EventContext {
+    const context: EventContext = {
+        traceId: traceIdOf(event),
+        receivedAt: Date.now(),
+        source: sourceOf(event),
+    };
+    contexts.set(event, context);
+    return context;
+}
+
+export function eventContext(event: SyslogEvent): EventContext {
+    let context = contexts.get(event);
+    if (!context) {
+        context = {
+            traceId: traceIdOf(event),
+            receivedAt: Date.parse(event.received_at) || Date.now(),
+            source: sourceOf(event),
+        };
+        contexts.set(event, context);
+    }
+    return context;
+}
+
+/**
+ * Log fields for a record about one event (trace_id first, to search by)
+ */
+export function eventLogFields(event: SyslogEvent): LogFields {
+    const context = eventContext(event);
+    return {
+        trace_id: context.traceId,
+        event_id: event.event_id,
+        source_ip: event.source_ip,
+        tenant_id: event.tenant_id,
+        age_ms: Date.now() - context.receivedAt,
+    };
+}
+
+function sourceOf(event: SyslogEvent): string {
+    const address = event.source_ip.includes(':') ? `[${event.source_ip}]` : event.source_ip;
+    return `${address}${event.source_port !== undefined ? `:${event.source_port}` : ''}/${event.transport}`;
+}
@@ -0,0 +1,60 @@
+import { createHash, randomBytes } from 'node:crypto';
+
+let lastTimestamp = 0;
+let sequence = 0;
+
+/**
+ * Generate a UUIDv7 (RFC 9562) for an event.
+ *
+ * Layout: 48-bit Unix timestamp (ms) | version | 12-bit sequence | variant | 62 random bits.
+ * The 12-bit field is used as a monotonic counter within the same millisecond, so IDs
+ * generated by one collector sort in receive order even under bursts.
+ */
+export function uuidv7(): string {
+  let now = Date.now();
+
+  if (now > lastTimestamp) {
+    lastTimestamp = now;
+    // Start each millisecond at a random point in the lower half to leave room for bursts
+    sequence = randomBytes(2).readUInt16BE(0) & 0x7ff;
+  } else {
+    sequence++;
+    if (sequence > 0xfff) {
+      // Counter exhausted: borrow the next millisecond to keep IDs monotonic
+      lastTimestamp++;
+      sequence = 0;
+    }
+    now = lastTimestamp;
+  }
+
+  const bytes = randomBytes(16);
+
+  // 48-bit big-endian timestamp
+  bytes.writeUIntBE(now, 0, 6);
+
+  // Version 7 + 12-bit sequence
+  bytes[6] = 0x70 | ((sequence >> 8) & 0x0f);
+  bytes[7] = sequence & 0xff;
+
+  // RFC 4122 variant (10xx)
+  bytes[8] = (bytes[8] & 0x3f) | 0x80;
+
+  return format(bytes);
+}
+
+/**
+ * Name-based UUIDv8 (RFC 9562, SHA-256 of the name): the same name always
+ * gives the same ID. For events read from a source that can deliver them
+ * again, e.g. a Kafka message's position, so a second copy is recognized.
+ */
+export function uuidv8(name: string): string {
+  const bytes = createHash('sha256').update(name).digest().subarray(0, 16);
+  bytes[6] = 0x80 | (bytes[6] & 0x0f);
+  bytes[8] = (bytes[8] & 0x3f) | 0x80;
+  return format(bytes);
+}
+
+function format(bytes: Buffer): string {
+  const hex = bytes.toString('hex');
+  return `${hex.slice(0, 8)}-${hex.slice(8, 12)}-${hex.slice(12, 16)}-${hex.slice(16, 20)}-${hex.slice(20)}`;
+}
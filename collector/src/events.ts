@@ -0,0 +1,90 @@
+import { config, type ParserOverride } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { uuidv7 } from './event-id.js';
+import { CidrList, normalizeIp } from './cidr.js';
+import { extractRelayedOrigin } from './origin.js';
+import { parseRfc5424 } from './parsers/rfc5424.js';
+import { parseRfc3164 } from './parsers/rfc3164.js';
+import { parserOverrides } from './parser-overrides.js';
+
+let trustedRelays: CidrList | null = null; // Built on first use: importing doesn't read the configuration
+
+/**
+ * Create an event for a message received on a syslog listener.
+ *
+ * If the sender is a trusted syslog relay (TRUSTED_RELAYS) and the message carries
+ * origin structured data, the original source IP, transport and receive time are
+ * restored and the relay is recorded as a hop, so NAT/relays don't erase the
+ * chain of custody.
+ */
+export function createSyslogEvent(
+    rawMessage: string,
+    remote: { address: string; port?: number },
+    transport: string,
+): SyslogEvent {
+    const now = new Date().toISOString();
+    const peerIp = normalizeIp(remote.address);
+
+    const event: SyslogEvent = {
+        event_id: uuidv7(),
+        raw_message: rawMessage,
+        received_at: now,
+        source_ip: peerIp,
+        source_port: remote.port,
+        transport,
+    };
+
+    trustedRelays ??= new CidrList(config.TRUSTED_RELAYS);
+    if (trustedRelays.isEmpty || !trustedRelays.contains(peerIp)) {
+        return event;
+    }
+
+    const origin = extractRelayedOrigin(rawMessage);
+    if (!origin) {
+        return event;
+    }
+
+    event.source_ip = origin.ip;
+    event.source_port = origin.port;
+    event.transport = origin.transport ?? transport;
+    event.received_at = origin.received_at ?? now;
+    event.relay_hops = [{ collector: config.COLLECTOR_NAME, received_at: now, peer_ip: peerIp }];
+
+    return event;
+}
+
+/**
+ * Attach the parsed header fields (PARSE_SYSLOG) so the backend doesn't have
+ * to re-parse every event: RFC 5424 when the message is valid 5424, else
+ * RFC 3164 with the year and time zone it lacks taken from
+ * SYSLOG_DEFAULT_TIMEZONE and SYSLOG_YEAR_ROLLOVER, unless PARSER_OVERRIDES
+ * pins or restricts the format for the source. Runs after the rules, so the
+ * parsed message reflects any redaction. Raw stream chunks are never parsed.
+ */
+export function parseSyslogFields(event: SyslogEvent): void {
+    if (!config.PARSE_SYSLOG || event.stream) return;
+
+    let override = parserOverrides.forAddress(event.source_ip);
+    let parsed = parseHeader(event, override);
+
+    // Hostname entries can only be matched once the header is parsed
+    if (!override && parsed?.hostname) {
+        override = parserOverrides.forHostname(parsed.hostname);
+        if (override) parsed = parseHeader(event, override);
+    }
+
+    if (parsed) event.syslog = parsed;
+    if (override) parserOverrides.record(event, override);
+}
+
+function parseHeader(event: SyslogEvent, override?: ParserOverride): SyslogEvent['syslog'] | null {
+    const format = override?.format ?? 'auto';
+    const tries = (candidate: 'rfc5424' | 'rfc3164') =>
+        format === candidate || (format === 'auto' && !override?.disable.includes(candidate));
+
+    return (tries('rfc5424') ? parseRfc5424(event.raw_message) : null) ?? (tries('rfc3164') ? parseRfc3164(event.raw_message, {
+        timezone: config.SYSLOG_DEFAULT_TIMEZONE,
+        receivedAt: new Date(event.received_at),
+        yearRollover: config.SYSLOG_YEAR_ROLLOVER,
+    }) : null);
+}
@@ -0,0 +1,382 @@
+import { readFile, writeFile, rename } from 'node:fs/promises';
+import { readFileSync } from 'node:fs';
+import { createHash } from 'node:crypto';
+import { lookup } from 'node:dns/promises';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { FtpClient } from './pickup/ftp.js';
+import { SftpClient } from './pickup/sftp.js';
+import { SmbClient } from './pickup/smb.js';
+import { fetchConditional, RateLimitedError, type HttpValidators } from './pickup/http.js';
+import { parseRecords } from './pickup/formats.js';
+import { globToRegExp, parseTarget, type PickupTarget, type RemoteClient, type RemoteFile } from './pickup/types.js';
+import { log } from './logger.js';
+
+const BUDGET_WINDOW_MS = 3600000; // PICKUP_REQUEST_BUDGET is per hour
+
+export interface PickupSourceStats {
+    last_poll: string | null;
+    last_error: string | null;
+    files: number;
+    events: number;
+    interval_ms: number; // Current poll interval (adapts with PICKUP_ADAPTIVE_INTERVAL)
+    next_poll: string | null;
+    requests_last_hour: number;
+    not_modified: number; // HTTP polls answered 304 or with an unchanged body
+    deferred: number; // Polls postponed by PICKUP_REQUEST_BUDGET or the server's Retry-After
+}
+
+export interface PickupStats {
+    sources: Record<string, PickupSourceStats>;
+    tracked_files: number;
+}
+
+/**
+ * File Pickup (SFTP / FTP / FTPS / SMB)
+ *
+ * For systems that can only export logs as files (ERPs, batch jobs, audit
+ * exports dropped on Windows shares): every PICKUP_INTERVAL_MS each PICKUP_URLS
+ * directory is listed, new files matching PICKUP_PATTERNS are downloaded, split
+ * into records (PICKUP_FORMAT) and go through the same pipeline as syslog.
+ *
+ * A file is processed once per (name, size, modification time), tracked in
+ * PICKUP_STATE_FILE across restarts. Files modified less than PICKUP_MIN_AGE_MS
+ * ago are left for the next poll, as they may still be being written.
+ *
+ * http(s):// URLs are fetched whole, conditionally (ETag / Last-Modified kept
+ * in the state file too), and a response identical to the last one is not
+ * forwarded again. Each source has its own schedule: with
+ * PICKUP_ADAPTIVE_INTERVAL its interval halves after a poll with new data and
+ * doubles after one without; PICKUP_REQUEST_BUDGET caps its requests per hour
+ * and a 429/503 Retry-After postpones it, so many sources on one collector
+ * stay within the upstream rate limits.
+ */
+export class FilePickup {
+    private buffer: MessageBuffer;
+    private targets: PickupTarget[];
+    private patterns: RegExp[];
+    private processed = new Map<string, string>(); // label/name -> "size:mtime" (HTTP: label -> body hash)
+    private validators = new Map<string, HttpValidators>(); // HTTP label -> last response's validators
+    private stats = new Map<string, PickupSourceStats>();
+    private nextPollAt = new Map<string, number>();
+    private requests = new Map<string, number[]>(); // Request times within the budget window
+    private timer: NodeJS.Timeout | null = null;
+    private polling: Promise<void> | null = null;
+    private isRunning = false;
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+        this.targets = config.PICKUP_URLS.map(parseTarget);
+        this.patterns = config.PICKUP_PATTERNS.map((pattern) => globToRegExp(pattern));
+        for (const target of this.targets) {
+            this.stats.set(target.label, {
+                last_poll: null,
+                last_error: null,
+                files: 0,
+                events: 0,
+                interval_ms: config.PICKUP_INTERVAL_MS,
+                next_poll: null,
+                requests_last_hour: 0,
+                not_modified: 0,
+                deferred: 0,
+            });
+            this.nextPollAt.set(target.label, 0);
+            this.requests.set(target.label, []);
+        }
+    }
+
+    public async start(): Promise<void> {
+        this.isRunning = true;
+        await this.restoreState();
+
+        const adaptive = config.PICKUP_ADAPTIVE_INTERVAL
+            ? ` (adaptive, ${config.PICKUP_MIN_INTERVAL_MS / 1000}-${config.PICKUP_MAX_INTERVAL_MS / 1000}s)`
+            : '';
+        const budget = config.PICKUP_REQUEST_BUDGET > 0 ? `, at most ${config.PICKUP_REQUEST_BUDGET} requests/h each` : '';
+        log.info(`📂 File pickup from ${this.targets.map((t) => t.label).join(', ')} every ${config.PICKUP_INTERVAL_MS / 1000}s${adaptive}${budget}`);
+        if (!config.PICKUP_STATE_FILE) {
+            log.warn('⚠️ PICKUP_STATE_FILE not set: files will be picked up again after a restart');
+        }
+
+        this.schedule();
+    }
+
+    public async stop(): Promise<void> {
+        this.isRunning = false;
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+        await this.polling;
+        log.info('   File pickup stopped.');
+    }
+
+    public getStats(): PickupStats {
+        for (const [label, stats] of this.stats) {
+            stats.requests_last_hour = this.recentRequests(label).length;
+        }
+        return {
+            sources: Object.fromEntries(this.stats),
+            tracked_files: this.processed.size,
+        };
+    }
+
+    /**
+     * Wake up when the next source is due
+     */
+    private schedule(): void {
+        const next = Math.min(...this.nextPollAt.values());
+        this.timer = setTimeout(() => {
+            this.polling = this.poll().finally(() => {
+                this.polling = null;
+                if (this.isRunning) this.schedule();
+            });
+        }, Math.max(0, next - Date.now()));
+    }
+
+    private async poll(): Promise<void> {
+        for (const target of this.targets) {
+            if (!this.isRunning) return;
+            if (this.nextPollAt.get(target.label)! > Date.now()) continue;
+
+            const stats = this.stats.get(target.label)!;
+            const budgetWait = this.budgetWait(target);
+            if (budgetWait > 0) {
+                stats.deferred++;
+                this.postpone(target, stats, budgetWait);
+                continue;
+            }
+
+            try {
+                const found = target.protocol === 'http' || target.protocol === 'https'
+                    ? await this.pollUrl(target, stats)
+                    : await this.pollTarget(target, stats);
+                stats.last_error = null;
+                if (config.PICKUP_ADAPTIVE_INTERVAL) {
+                    const interval = found > 0 ? stats.interval_ms / 2 : stats.interval_ms * 2;
+                    stats.interval_ms = Math.min(config.PICKUP_MAX_INTERVAL_MS, Math.max(config.PICKUP_MIN_INTERVAL_MS, Math.round(interval)));
+                }
+                this.postpone(target, stats, stats.interval_ms);
+            } catch (err) {
+                stats.last_error = (err as Error).message;
+                log.error(`❌ Pickup from ${target.label} failed: ${stats.last_error}`);
+                if (err instanceof RateLimitedError) stats.deferred++;
+                this.postpone(target, stats, err instanceof RateLimitedError ? err.retryAfterMs : stats.interval_ms);
+            }
+            stats.last_poll = new Date().toISOString();
+        }
+    }
+
+    private postpone(target: PickupTarget, stats: PickupSourceStats, delayMs: number): void {
+        const at = Date.now() + delayMs;
+        this.nextPollAt.set(target.label, at);
+        stats.next_poll = new Date(at).toISOString();
+    }
+
+    /**
+     * Fetch an http(s):// source if it changed; returns the records forwarded
+     */
+    private async pollUrl(target: PickupTarget, stats: PickupSourceStats): Promise<number> {
+        this.spend(target);
+        const result = await fetchConditional(target, this.validators.get(target.label), {
+            headers: config.PICKUP_HTTP_HEADERS,
+            ca: config.PICKUP_TLS_CA ? readFileSync(config.PICKUP_TLS_CA) : undefined,
+        });
+        if (!result.modified) {
+            stats.not_modified++;
+            return 0;
+        }
+
+        // Servers without validators: the same body again is nothing new
+        const hash = createHash('sha256').update(result.body).digest('hex');
+        if (this.processed.get(target.label) === hash) {
+            stats.not_modified++;
+            return 0;
+        }
+
+        let records: string[];
+        try {
+            records = parseRecords(result.body.toString(config.PICKUP_ENCODING), config.PICKUP_FORMAT, config.PICKUP_CSV_DELIMITER);
+        } catch (err) {
+            log.warn(`⚠️ Skipping the response of ${target.label}: not valid ${config.PICKUP_FORMAT} (${(err as Error).message})`);
+            records = [];
+        }
+        const { address } = await lookup(target.host);
+        await this.ingest(records, address, target, target.dir);
+
+        this.processed.set(target.label, hash);
+        this.validators.set(target.label, result.validators);
+        await this.saveState();
+        stats.events += records.length;
+        log.info(`📂 Fetched ${target.label}: ${records.length} records`);
+        return records.length;
+    }
+
+    /**
+     * List a file server directory and pick up the due files; returns the
+     * files picked up
+     */
+    private async pollTarget(target: PickupTarget, stats: PickupSourceStats): Promise<number> {
+        const client = this.createClient(target);
+        let picked = 0;
+        try {
+            await client.connect();
+            this.spend(target);
+            const listing = await client.list(target.dir);
+            if (this.forgetMissing(target, listing)) await this.saveState();
+
+            const cutoff = Date.now() - config.PICKUP_MIN_AGE_MS;
+            const due = listing
+                .filter((file) => this.patterns.some((pattern) => pattern.test(file.name)))
+                .filter((file) => file.modifiedAt <= cutoff)
+                .filter((file) => this.processed.get(fileKey(target, file)) !== version(file))
+                .sort((a, b) => a.modifiedAt - b.modifiedAt);
+            if (due.length === 0) return 0;
+
+            // Source policy (ALLOWED_SOURCES) sees the server's address, like a syslog sender
+            const { address } = await lookup(target.host);
+
+            for (const file of due) {
+                if (!this.isRunning) return picked;
+                // Out of budget: the rest is picked up next time
+                if (this.budgetWait(target) > 0) return picked;
+
+                this.spend(target);
+                const data = await client.download(file.path);
+                let records: string[];
+                try {
+                    records = parseRecords(data.toString(config.PICKUP_ENCODING), config.PICKUP_FORMAT, config.PICKUP_CSV_DELIMITER);
+                } catch (err) {
+                    // Marked as processed anyway so one bad export does not block the others
+                    log.warn(`⚠️ Skipping ${target.label}/${file.name}: not valid ${config.PICKUP_FORMAT} (${(err as Error).message})`);
+                    records = [];
+                }
+                await this.ingest(records, address, target, file.name);
+
+                this.processed.set(fileKey(target, file), version(file));
+                await this.saveState();
+                picked++;
+                stats.files++;
+                stats.events += records.length;
+                log.info(`📂 Picked up ${target.label}/${file.name}: ${records.length} records`);
+
+                if (config.PICKUP_AFTER === 'delete') {
+                    this.spend(target);
+                    await client.remove(file.path);
+                }
+            }
+            return picked;
+        } finally {
+            await client.close();
+        }
+    }
+
+    /**
+     * How long until the source may make another request (0: now)
+     */
+    private budgetWait(target: PickupTarget): number {
+        if (config.PICKUP_REQUEST_BUDGET === 0) return 0;
+        const recent = this.recentRequests(target.label);
+        if (recent.length < config.PICKUP_REQUEST_BUDGET) return 0;
+        return recent[recent.length - config.PICKUP_REQUEST_BUDGET]! + BUDGET_WINDOW_MS - Date.now();
+    }
+
+    private spend(target: PickupTarget): void {
+        this.recentRequests(target.label).push(Date.now());
+    }
+
+    private recentRequests(label: string): number[] {
+        const cutoff = Date.now() - BUDGET_WINDOW_MS;
+        const times = this.requests.get(label)!;
+        while (times.length > 0 && times[0]! <= cutoff) times.shift();
+        return times;
+    }
+
+    /**
+     * Feed records as the buffer frees up, so large exports are not dropped
+     */
+    private async ingest(records: string[], address: string, target: PickupTarget, name: string): Promise<void> {
+        let next = 0;
+        while (next < records.length) {
+            if (!this.isRunning) throw new Error(`stopped while reading ${name}; it will be picked up again`);
+
+            const count = Math.min(records.length - next, this.buffer.available);
+            if (count === 0) {
+                await new Promise((resolve) => setTimeout(resolve, 500));
+                continue;
+            }
+
+            for (const record of records.slice(next, next + count)) {
+                const event = createSyslogEvent(record, { address }, target.protocol);
+                event.tags = { pickup_source: target.label, pickup_file: name };
+                ingestEvent(this.buffer, event);
+            }
+            next += count;
+        }
+    }
+
+    private createClient(target: PickupTarget): RemoteClient {
+        if (target.protocol === 'sftp') {
+            return new SftpClient(target, {
+                privateKey: config.PICKUP_SSH_KEY ? readFileSync(config.PICKUP_SSH_KEY) : undefined,
+                hostKeys: config.PICKUP_SSH_HOST_KEYS,
+            });
+        }
+        if (target.protocol === 'smb') {
+            return new SmbClient(target);
+        }
+        return new FtpClient(target, config.PICKUP_TLS_CA ? readFileSync(config.PICKUP_TLS_CA) : undefined);
+    }
+
+    /**
+     * Drop state for files no longer on the server (deleted or rotated away)
+     */
+    private forgetMissing(target: PickupTarget, listing: RemoteFile[]): boolean {
+        const present = new Set(listing.map((file) => fileKey(target, file)));
+        let changed = false;
+        for (const key of this.processed.keys()) {
+            if (key.startsWith(`${target.label}/`) && !present.has(key)) {
+                this.processed.delete(key);
+                changed = true;
+            }
+        }
+        return changed;
+    }
+
+    private async restoreState(): Promise<void> {
+        if (!config.PICKUP_STATE_FILE) return;
+
+        try {
+            const state = JSON.parse(await readFile(config.PICKUP_STATE_FILE, 'utf8')) as {
+                files?: Record<string, string>;
+                http?: Record<string, HttpValidators>;
+            };
+            this.processed = new Map(Object.entries(state.files ?? {}));
+            this.validators = new Map(Object.entries(state.http ?? {}));
+        } catch {
+            // No state yet
+        }
+    }
+
+    private async saveState(): Promise<void> {
+        if (!config.PICKUP_STATE_FILE) return;
+
+        try {
+            const tmp = `${config.PICKUP_STATE_FILE}.tmp`;
+            await writeFile(tmp, JSON.stringify({ files: Object.fromEntries(this.processed), http: Object.fromEntries(this.validators) }, null, 2));
+            await rename(tmp, config.PICKUP_STATE_FILE);
+        } catch (err) {
+            log.warn(`⚠️ Could not write pickup state: ${(err as Error).message}`);
+        }
+    }
+}
+
+function fileKey(target: PickupTarget, file: RemoteFile): string {
+    return `${target.label}/${file.name}`;
+}
+
+function version(file: RemoteFile): string {
+    return `${file.size}:${file.modifiedAt}`;
+}
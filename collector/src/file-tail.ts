@@ -0,0 +1,353 @@
+import { open, readdir, readFile, writeFile, rename, stat, type FileHandle } from 'node:fs/promises';
+import type { Dirent } from 'node:fs';
+import { join, parse, resolve } from 'node:path';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { maxMessageSpan, splitMessage } from './continuation.js';
+import { globToRegExp } from './pickup/types.js';
+import { MultilineAggregator, multilineRules } from './multiline.js';
+import { log } from './logger.js';
+
+const READ_CHUNK_BYTES = 65536;
+const MIN_BUFFER_AVAILABLE = 1000; // Reading pauses below this much room in the buffer
+const PARTIAL_LINE_TIMEOUT_MS = 10000; // A last line without a newline is sent after this long
+
+export interface TailedFileStats {
+    offset: number;
+    events: number;
+}
+
+export interface FileTailStats {
+    running: boolean;
+    files: Record<string, TailedFileStats>;
+    rotations: number; // Files renamed or deleted away, read to the end before closing
+    truncations: number; // Files truncated in place (copytruncate), read again from the start
+    last_error: string | null;
+}
+
+interface TailedFile {
+    id: string; // "device:inode", follows the file across renames
+    path: string;
+    handle: FileHandle;
+    offset: number; // Bytes read
+    partial: Buffer; // Start of a line whose newline hasn't been written yet
+    partialSince: number;
+    multiline: MultilineAggregator | null; // Lines of an event not complete yet (MULTILINE_RULES)
+    events: number;
+}
+
+/**
+ * File Tailing Input
+ *
+ * Follows local log files that never speak syslog (auditd, application
+ * logs), so no third-party shipper is needed. Every FILE_TAIL_INTERVAL_MS the
+ * FILE_TAIL_PATHS globs (* and ? in any path segment) are expanded and the
+ * new lines of each matching file are sent, one event per line, as the
+ * collector's own host with tag file_path. Lines longer than
+ * MAX_MESSAGE_BYTES are split as for TCP (OVERSIZE_MESSAGES). Files with a
+ * multiline rule (MULTILINE_RULES) get one event per group of lines instead.
+ *
+ * Files are tracked by device and inode, not by name: when a file is rotated
+ * (renamed or deleted, and a new one created in its place) the old one is
+ * read to its end before it is closed and the new one is read from the
+ * start; a file truncated in place (copytruncate) is read again from the
+ * start. Offsets are kept in FILE_TAIL_STATE_FILE, so a restart resumes where
+ * it stopped. Files found at startup without a saved offset are read from
+ * their end, or from their start with FILE_TAIL_START_AT=beginning; files
+ * appearing later are always read from their start.
+ */
+export class FileTail {
+    private buffer: MessageBuffer;
+    private files = new Map<string, TailedFile>(); // id -> file
+    private saved = new Map<string, number>(); // id -> offset, from FILE_TAIL_STATE_FILE
+    private excludes: RegExp[];
+    private timer: NodeJS.Timeout | null = null;
+    private polling: Promise<void> | null = null;
+    private isRunning = false;
+    private firstScan = true;
+    private dirty = false;
+    private warnedMaxFiles = false;
+    private unreadable = new Set<string>(); // Paths already reported as unreadable
+    private stats: Omit<FileTailStats, 'running' | 'files'> = { rotations: 0, truncations: 0, last_error: null };
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+        this.excludes = config.FILE_TAIL_EXCLUDE.map((pattern) => globToRegExp(pattern, process.platform === 'win32'));
+    }
+
+    public async start(): Promise<void> {
+        this.saved = await this.restoreState();
+        this.isRunning = true;
+        log.info(`📄 File tail: ${config.FILE_TAIL_PATHS.join(', ')}` +
+            (this.saved.size > 0 ? ' (resuming)' : config.FILE_TAIL_START_AT === 'beginning' ? ' (from the beginning)' : ''));
+        this.schedule(0);
+    }
+
+    public async stop(): Promise<void> {
+        this.isRunning = false;
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+        await this.polling;
+        for (const file of this.files.values()) file.multiline?.flush();
+        await this.saveState();
+        for (const file of this.files.values()) await file.handle.close().catch(() => undefined);
+        this.files.clear();
+        log.info('   File tail input stopped.');
+    }
+
+    public getStats(): FileTailStats {
+        return {
+            running: this.isRunning,
+            files: Object.fromEntries([...this.files.values()].map((file) => [file.path, { offset: file.offset, events: file.events }])),
+            ...this.stats,
+        };
+    }
+
+    private schedule(delayMs: number): void {
+        this.timer = setTimeout(() => {
+            this.polling = this.poll().finally(() => {
+                this.polling = null;
+                if (this.isRunning) this.schedule(config.FILE_TAIL_INTERVAL_MS);
+            });
+        }, delayMs);
+    }
+
+    private async poll(): Promise<void> {
+        try {
+            const found = await this.scan();
+
+            // Rotated away or deleted: send the rest of the old file before the new one
+            for (const file of [...this.files.values()]) {
+                if (found.has(file.id)) continue;
+                if (!(await this.readNew(file))) continue; // Buffer full, the rest is read next poll
+                this.flushPartial(file);
+                file.multiline?.flush();
+                await file.handle.close().catch(() => undefined);
+                this.files.delete(file.id);
+                this.stats.rotations++;
+                this.dirty = true;
+            }
+
+            for (const [id, path] of found) {
+                if (!this.isRunning) break;
+                const file = this.files.get(id) ?? await this.open(id, path);
+                if (!file) continue;
+                file.path = path;
+                await this.readNew(file);
+                if (file.partial.length > 0 && Date.now() - file.partialSince >= PARTIAL_LINE_TIMEOUT_MS) this.flushPartial(file);
+            }
+            this.stats.last_error = null;
+        } catch (err) {
+            if (this.stats.last_error === null) log.error(`❌ File tail failed: ${(err as Error).message}`);
+            this.stats.last_error = (err as Error).message;
+        }
+        this.firstScan = false;
+        await this.saveState();
+    }
+
+    /**
+     * Regular files matching FILE_TAIL_PATHS now: id -> path
+     */
+    private async scan(): Promise<Map<string, string>> {
+        const found = new Map<string, string>();
+        for (const pattern of config.FILE_TAIL_PATHS) {
+            for (const path of await expandGlob(pattern)) {
+                const name = parse(path).base;
+                if (this.excludes.some((exclude) => exclude.test(name))) continue;
+                try {
+                    const info = await stat(path);
+                    if (info.isFile()) found.set(`${info.dev}:${info.ino}`, path);
+                } catch {
+                    // Gone between the listing and the stat
+                }
+            }
+        }
+        return found;
+    }
+
+    private async open(id: string, path: string): Promise<TailedFile | null> {
+        if (this.files.size >= config.FILE_TAIL_MAX_FILES) {
+            if (!this.warnedMaxFiles) log.warn(`⚠️ File tail: more than FILE_TAIL_MAX_FILES (${config.FILE_TAIL_MAX_FILES}) files match, ignoring ${path} and others`);
+            this.warnedMaxFiles = true;
+            return null;
+        }
+
+        let handle: FileHandle;
+        try {
+            handle = await open(path, 'r');
+        } catch (err) {
+            if (!this.unreadable.has(path)) log.warn(`⚠️ Cannot open ${path}: ${(err as Error).message}`);
+            this.unreadable.add(path);
+            return null;
+        }
+        this.unreadable.delete(path);
+
+        const { size } = await handle.stat();
+        const saved = this.saved.get(id);
+        const fromEnd = this.firstScan && config.FILE_TAIL_START_AT === 'end';
+        const file: TailedFile = {
+            id,
+            path,
+            handle,
+            offset: saved !== undefined && saved <= size ? saved : fromEnd ? size : 0,
+            partial: Buffer.alloc(0),
+            partialSince: 0,
+            multiline: null,
+            events: 0,
+        };
+        this.files.set(id, file);
+        this.dirty = true;
+        return file;
+    }
+
+    // Returns whether the file was read to its end
+    private async readNew(file: TailedFile): Promise<boolean> {
+        const { size } = await file.handle.stat();
+        if (size < file.offset) {
+            log.warn(`⚠️ ${file.path} was truncated, reading it from the start`);
+            file.offset = 0;
+            file.partial = Buffer.alloc(0);
+            file.multiline?.flush();
+            this.stats.truncations++;
+            this.dirty = true;
+        }
+
+        const chunk = Buffer.alloc(READ_CHUNK_BYTES);
+        // Leave room in the buffer; the rest is read next poll
+        while (file.offset < size && this.isRunning && this.buffer.available >= MIN_BUFFER_AVAILABLE) {
+            const { bytesRead } = await file.handle.read(chunk, 0, Math.min(chunk.length, size - file.offset), file.offset);
+            if (bytesRead === 0) break;
+            file.offset += bytesRead;
+            this.consume(file, chunk.subarray(0, bytesRead));
+            this.dirty = true;
+        }
+        return file.offset >= size;
+    }
+
+    private consume(file: TailedFile, data: Buffer): void {
+        let pending = file.partial.length > 0 ? Buffer.concat([file.partial, data]) : data;
+        let newline: number;
+        while ((newline = pending.indexOf(0x0a)) >= 0) {
+            this.emitLine(file, pending.subarray(0, newline), newline + 1);
+            pending = pending.subarray(newline + 1);
+        }
+
+        if (pending.length > maxMessageSpan(config.MAX_MESSAGE_BYTES)) {
+            this.emitLine(file, pending, pending.length);
+            pending = Buffer.alloc(0);
+        }
+
+        if (file.partial.length === 0 && pending.length > 0) file.partialSince = Date.now();
+        file.partial = Buffer.from(pending); // The read chunk is reused
+    }
+
+    private flushPartial(file: TailedFile): void {
+        if (file.partial.length === 0) return;
+        this.emitLine(file, file.partial, file.partial.length);
+        file.partial = Buffer.alloc(0);
+        this.dirty = true;
+    }
+
+    // inputBytes: what the line took in the file, newline included
+    private emitLine(file: TailedFile, line: Buffer, inputBytes: number): void {
+        const text = line.toString(config.FILE_TAIL_ENCODING).replace(/\r$/, '');
+
+        const rule = multilineRules.forFile(file.path);
+        if (file.multiline && file.multiline.rule !== rule) {
+            file.multiline.flush();
+            file.multiline = null;
+        }
+        if (!rule) {
+            this.send(file, text);
+            return;
+        }
+        file.multiline ??= new MultilineAggregator(rule, maxMessageSpan(config.MAX_MESSAGE_BYTES), (event) => this.send(file, event));
+        file.multiline.push(text, inputBytes);
+    }
+
+    private send(file: TailedFile, text: string): void {
+        if (text.trim().length === 0) return;
+
+        for (const part of splitMessage(text, config.MAX_MESSAGE_BYTES)) {
+            const event = createSyslogEvent(part.text, { address: '127.0.0.1' }, 'file');
+            event.tags = { file_path: file.path };
+            if (part.continuation) event.continuation = part.continuation;
+            ingestEvent(this.buffer, event, { skipSourcePolicy: true });
+        }
+        file.events++;
+        this.dirty = true;
+    }
+
+    private async restoreState(): Promise<Map<string, number>> {
+        if (!config.FILE_TAIL_STATE_FILE) return new Map();
+
+        try {
+            const state = JSON.parse(await readFile(config.FILE_TAIL_STATE_FILE, 'utf8')) as { files?: Record<string, { offset?: unknown }> };
+            return new Map(Object.entries(state.files ?? {})
+                .filter(([, file]) => Number.isInteger(file.offset))
+                .map(([id, file]) => [id, file.offset as number]));
+        } catch (err) {
+            if ((err as NodeJS.ErrnoException).code !== 'ENOENT') {
+                log.warn(`⚠️ Ignoring unreadable file tail state ${config.FILE_TAIL_STATE_FILE}: ${(err as Error).message}`);
+            }
+            return new Map();
+        }
+    }
+
+    // Offsets of the files tracked now; a partial line, and the lines of an
+    // event not sent yet, are read again after a restart
+    private async saveState(): Promise<void> {
+        if (!config.FILE_TAIL_STATE_FILE || !this.dirty) return;
+
+        const files = Object.fromEntries([...this.files.values()].map((file) => [file.id, {
+            path: file.path,
+            offset: file.offset - file.partial.length - (file.multiline?.heldBytes ?? 0),
+        }]));
+        try {
+            const tmp = `${config.FILE_TAIL_STATE_FILE}.tmp`;
+            await writeFile(tmp, JSON.stringify({ files }));
+            await rename(tmp, config.FILE_TAIL_STATE_FILE);
+            this.dirty = false;
+        } catch (err) {
+            log.warn(`⚠️ Cannot save file tail state: ${(err as Error).message}`);
+        }
+    }
+}
+
+/**
+ * Paths matching a pattern with * and ? in any segment (no **)
+ */
+async function expandGlob(pattern: string): Promise<string[]> {
+    const absolute = resolve(pattern);
+    const { root } = parse(absolute);
+    const segments = absolute.slice(root.length).split(/[\\/]+/).filter((segment) => segment.length > 0);
+
+    let paths = [root];
+    for (const [index, segment] of segments.entries()) {
+        if (!/[*?]/.test(segment)) {
+            paths = paths.map((path) => join(path, segment));
+            continue;
+        }
+
+        const matcher = globToRegExp(segment, process.platform === 'win32');
+        const last = index === segments.length - 1;
+        const next: string[] = [];
+        for (const dir of paths) {
+            let entries: Dirent[];
+            try {
+                entries = await readdir(dir, { withFileTypes: true });
+            } catch {
+                continue;
+            }
+            for (const entry of entries) {
+                if (matcher.test(entry.name) && (last || entry.isDirectory() || entry.isSymbolicLink())) next.push(join(dir, entry.name));
+            }
+        }
+        paths = next;
+    }
+    return paths;
+}
@@ -0,0 +1,75 @@
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+
+export interface ForwardPoolStats {
+    workers: number;
+    busy: number;
+    batches: number; // Batches handed to a worker
+    saturated: number; // Times a batch had to wait in the buffer because every worker was busy
+}
+
+/**
+ * Forwarding Worker Pool
+ *
+ * Bounds how many batches are in flight to the backend at once
+ * (FORWARD_WORKERS). Listeners never send anything themselves: they only
+ * push into the bounded buffer (MAX_BUFFER_SIZE, tail drop), and the flush
+ * loop hands batches to idle workers. Under a burst, memory is bounded by the
+ * buffer and connections by the pool. Batches sent concurrently may arrive
+ * out of order; the backend orders events by received_at.
+ */
+export class ForwardPool {
+    private readonly send: (batch: SyslogEvent[]) => Promise<void>;
+    private readonly onIdle: () => void;
+    private readonly inFlight = new Set<Promise<void>>();
+    private counters = { batches: 0, saturated: 0 };
+
+    /**
+     * @param send   Delivers one batch (must not throw)
+     * @param onIdle Called whenever a worker becomes free, to hand it more work
+     */
+    constructor(send: (batch: SyslogEvent[]) => Promise<void>, onIdle: () => void) {
+        this.send = send;
+        this.onIdle = onIdle;
+    }
+
+    public get idle(): number {
+        return Math.max(0, config.FORWARD_WORKERS - this.inFlight.size);
+    }
+
+    /**
+     * Send the batch returned by `take` on an idle worker. Returns false
+     * (without calling `take`) if every worker is busy.
+     */
+    public run(take: () => SyslogEvent[]): boolean {
+        if (this.idle === 0) {
+            this.counters.saturated++;
+            return false;
+        }
+
+        this.counters.batches++;
+        const task: Promise<void> = this.send(take()).finally(() => {
+            this.inFlight.delete(task);
+            this.onIdle();
+        });
+        this.inFlight.add(task);
+        return true;
+    }
+
+    /**
+     * Wait for every batch in flight (on shutdown)
+     */
+    public async drain(): Promise<void> {
+        while (this.inFlight.size > 0) {
+            await Promise.all(this.inFlight);
+        }
+    }
+
+    public getStats(): ForwardPoolStats {
+        return {
+            workers: config.FORWARD_WORKERS,
+            busy: this.inFlight.size,
+            ...this.counters,
+        };
+    }
+}
@@ -0,0 +1,158 @@
+import { readFileSync } from 'node:fs';
+import { config, parseForwardingPolicy, type Config, type ForwardingPolicy } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import type { ArchiveSink } from './archive.js';
+import { log } from './logger.js';
+
+const PRI = /^<(\d{1,3})>/;
+
+export type ForwardingRoute = 'batch' | 'immediate' | 'archived' | 'drop';
+
+export interface ForwardingPolicyStats {
+    entries: number;
+    tenants: number; // With entries of their own
+    immediate: number;
+    batched: number; // Matched a batch entry (unmatched events are batched too, not counted)
+    sampled_in: number;
+    sampled_out: number;
+    archived: number;
+    dropped: number;
+}
+
+/**
+ * Forwarding Policies (per severity and facility)
+ *
+ * Decides, from an event's syslog severity and facility, how it reaches the
+ * backend: immediate (sent right away, e.g. alerts), batch (the default),
+ * sample (a share of the events, rate=), archive_only (written to the S3
+ * archive only, never to the backend: debug noise kept for later) or drop.
+ * Entries come from FORWARDING_POLICIES and FORWARDING_POLICIES_FILE; the
+ * event's tenant's own entries are checked first, then those without a
+ * tenant, each in order, and the first match wins.
+ *
+ * The PRI comes from the parsed header, or the message itself with
+ * PARSE_SYSLOG=false. Events without one (raw streams, collector-generated
+ * events) only match entries without severity= and facility=.
+ */
+class ForwardingPolicies {
+    private global: ForwardingPolicy[] = [];
+    private byTenant = new Map<string, ForwardingPolicy[]>();
+    private archive: ArchiveSink | null = null;
+    private flushNow: (() => void) | null = null;
+    private counters = { immediate: 0, batched: 0, sampled_in: 0, sampled_out: 0, archived: 0, dropped: 0 };
+
+    /**
+     * (Re)build the table from a configuration (at startup and on SIGHUP,
+     * which also picks up edits to FORWARDING_POLICIES_FILE). Throws if the
+     * file can't be read or has an invalid line; the current table is then kept.
+     */
+    public reload(settings: Pick<Config, 'FORWARDING_POLICIES' | 'FORWARDING_POLICIES_FILE' | 'ARCHIVE_ENABLED'> = config): void {
+        const policies = [...settings.FORWARDING_POLICIES];
+        if (settings.FORWARDING_POLICIES_FILE) {
+            const lines = readFileSync(settings.FORWARDING_POLICIES_FILE, 'utf8').split('\n');
+            lines.forEach((line, index) => {
+                const content = line.replace(/#.*/, '').trim();
+                if (!content) return;
+                try {
+                    const policy = parseForwardingPolicy(content);
+                    if (policy.action === 'archive_only' && !settings.ARCHIVE_ENABLED) {
+                        throw new Error(`"${content}": archive_only requires ARCHIVE_ENABLED=true`);
+                    }
+                    policies.push(policy);
+                } catch (err) {
+                    throw new Error(`${settings.FORWARDING_POLICIES_FILE}:${index + 1}: ${(err as Error).message}`);
+                }
+            });
+        }
+
+        const byTenant = new Map<string, ForwardingPolicy[]>();
+        for (const policy of policies.filter((candidate) => candidate.tenant !== undefined)) {
+            byTenant.set(policy.tenant!, [...(byTenant.get(policy.tenant!) ?? []), policy]);
+        }
+        this.global = policies.filter((policy) => policy.tenant === undefined);
+        this.byTenant = byTenant;
+
+        if (policies.length > 0) {
+            log.info(`🚦 Forwarding policies: ${policies.length} entr${policies.length === 1 ? 'y' : 'ies'}` +
+                (byTenant.size > 0 ? ` (${byTenant.size} tenant(s) with their own)` : ''));
+        }
+    }
+
+    /**
+     * Where archive_only events go, and how to send the buffer right away
+     * for immediate ones (set once the outputs exist)
+     */
+    public connect(outputs: { archive: ArchiveSink | null; flushNow: () => void }): void {
+        this.archive = outputs.archive;
+        this.flushNow = outputs.flushNow;
+    }
+
+    /**
+     * Route an event: batch or immediate (buffer it), archived (handed to the
+     * archive already) or drop (policy drop, or sampled out)
+     */
+    public route(event: SyslogEvent): ForwardingRoute {
+        if (this.global.length === 0 && this.byTenant.size === 0) return 'batch';
+
+        const policy = this.match(event);
+        switch (policy?.action) {
+            case undefined:
+                return 'batch';
+            case 'immediate':
+                this.counters.immediate++;
+                return 'immediate';
+            case 'batch':
+                this.counters.batched++;
+                return 'batch';
+            case 'sample':
+                if (Math.random() < policy.rate!) {
+                    this.counters.sampled_in++;
+                    return 'batch';
+                }
+                this.counters.sampled_out++;
+                return 'drop';
+            case 'archive_only':
+                if (!this.archive) return 'batch'; // Not started: never lose it
+                this.archive.offer([event]);
+                this.counters.archived++;
+                return 'archived';
+            case 'drop':
+                this.counters.dropped++;
+                return 'drop';
+        }
+    }
+
+    /**
+     * Send what is buffered now (an immediate event was just buffered)
+     */
+    public flush(): void {
+        this.flushNow?.();
+    }
+
+    public getStats(): ForwardingPolicyStats {
+        return {
+            entries: this.global.length + [...this.byTenant.values()].reduce((sum, policies) => sum + policies.length, 0),
+            tenants: this.byTenant.size,
+            ...this.counters,
+        };
+    }
+
+    private match(event: SyslogEvent): ForwardingPolicy | undefined {
+        const pri = event.syslog?.pri ?? this.rawPri(event);
+        const matches = (policy: ForwardingPolicy) =>
+            (!policy.severities || (pri !== null && policy.severities.includes(pri & 7))) &&
+            (!policy.facilities || (pri !== null && policy.facilities.includes(pri >> 3)));
+
+        const tenant = event.tenant_id ?? config.TENANT_ID;
+        const own = tenant !== undefined ? this.byTenant.get(tenant) : undefined;
+        return own?.find(matches) ?? this.global.find(matches);
+    }
+
+    private rawPri(event: SyslogEvent): number | null {
+        if (event.stream) return null;
+        const match = PRI.exec(event.raw_message);
+        return match && Number(match[1]) <= 191 ? Number(match[1]) : null;
+    }
+}
+
+export const forwardingPolicy = new ForwardingPolicies();
@@ -0,0 +1,151 @@
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { CidrList } from './cidr.js';
+import { log } from './logger.js';
+import { eventLogFields } from './event-context.js';
+
+const MAX_TRACKED_SOURCES = 10000;
+
+export interface GreylistedSource {
+    source_ip: string;
+    first_seen: string;
+    last_seen: string;
+    events: number; // Quarantined and forwarded
+    rate_limited: number; // Dropped by GREYLIST_MAX_EPS
+}
+
+export interface GreylistStats {
+    policy: 'accept' | 'greylist' | 'reject';
+    allowed_sources: number;
+    pending_sources: number;
+    quarantined: number;
+    rate_limited: number;
+    rejected: number;
+}
+
+interface SourceState {
+    firstSeen: number;
+    lastSeen: number;
+    events: number;
+    rateLimited: number;
+    windowStart: number;
+    windowCount: number;
+}
+
+/**
+ * Unknown Source Policy
+ *
+ * Decides what happens to events from sources outside ALLOWED_SOURCES:
+ * - accept: forward as usual (default, previous behavior)
+ * - reject: drop them
+ * - greylist: forward them tagged `quarantined`, rate-limited per source
+ *   (GREYLIST_MAX_EPS), and alert once per new source, so admins can approve
+ *   a new device (add it to ALLOWED_SOURCES) without losing its first logs
+ */
+class SourcePolicy {
+    private allowedList: CidrList | null = null;
+    private sources = new Map<string, SourceState>();
+    private quarantinedCount = 0;
+    private rateLimitedCount = 0;
+    private rejectedCount = 0;
+
+    // Built on first use, not when the module is imported
+    private get allowed(): CidrList {
+        return this.allowedList ??= new CidrList(config.ALLOWED_SOURCES);
+    }
+
+    /**
+     * Apply the policy to an event. Returns false if the event must be dropped.
+     * Greylisted events are tagged in place.
+     */
+    public admit(event: SyslogEvent): boolean {
+        const policy = config.UNKNOWN_SOURCE_POLICY;
+        if (policy === 'accept' || this.allowed.contains(event.source_ip)) {
+            return true;
+        }
+
+        if (policy === 'reject') {
+            this.rejectedCount++;
+            return false;
+        }
+
+        const now = Date.now();
+        const state = this.track(event, now);
+        if (!state) {
+            // Too many distinct unknown sources to track: fail closed on rate
+            this.rateLimitedCount++;
+            return false;
+        }
+
+        state.lastSeen = now;
+        if (now - state.windowStart >= 1000) {
+            state.windowStart = now;
+            state.windowCount = 0;
+        }
+
+        if (state.windowCount >= config.GREYLIST_MAX_EPS) {
+            state.rateLimited++;
+            this.rateLimitedCount++;
+            return false;
+        }
+
+        state.windowCount++;
+        state.events++;
+        this.quarantinedCount++;
+        event.quarantined = true;
+        return true;
+    }
+
+    public getStats(): GreylistStats {
+        return {
+            policy: config.UNKNOWN_SOURCE_POLICY,
+            allowed_sources: this.allowed.entries.length,
+            pending_sources: this.sources.size,
+            quarantined: this.quarantinedCount,
+            rate_limited: this.rateLimitedCount,
+            rejected: this.rejectedCount,
+        };
+    }
+
+    /**
+     * Unknown sources seen in greylist mode, most recent first
+     */
+    public getSources(): GreylistedSource[] {
+        return [...this.sources.entries()]
+            .sort(([, a], [, b]) => b.lastSeen - a.lastSeen)
+            .map(([ip, state]) => ({
+                source_ip: ip,
+                first_seen: new Date(state.firstSeen).toISOString(),
+                last_seen: new Date(state.lastSeen).toISOString(),
+                events: state.events,
+                rate_limited: state.rateLimited,
+            }));
+    }
+
+    private track(event: SyslogEvent, now: number): SourceState | null {
+        const ip = event.source_ip;
+        const existing = this.sources.get(ip);
+        if (existing) return existing;
+        if (this.sources.size >= MAX_TRACKED_SOURCES) return null;
+
+        const state: SourceState = {
+            firstSeen: now,
+            lastSeen: now,
+            events: 0,
+            rateLimited: 0,
+            windowStart: now,
+            windowCount: 0,
+        };
+        this.sources.set(ip, state);
+
+        log.warn(
+            `🚨 GREYLIST: new unauthorized source ${ip}. Events are quarantined and limited to ` +
+            `${config.GREYLIST_MAX_EPS}/s. Add it to ALLOWED_SOURCES to approve.`,
+            eventLogFields(event), // Its first event
+        );
+        return state;
+    }
+}
+
+// Singleton instance
+export const sourcePolicy = new SourcePolicy();
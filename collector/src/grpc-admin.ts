@@ -0,0 +1,294 @@
+import http2 from 'node:http2';
+import type { Socket } from 'node:net';
+import { fields, Writer } from './serializers/protobuf.js';
+
+const WATCH_INTERVAL_MS = 1000; // Health.Watch: status re-checked this often, sent on change
+const MAX_MESSAGE_BYTES = 4 * 1024 * 1024; // gRPC's default message limit
+
+// gRPC status codes (https://grpc.github.io/grpc/core/md_doc_statuscodes.html)
+const GRPC_OK = 0;
+const GRPC_INVALID_ARGUMENT = 3;
+const GRPC_NOT_FOUND = 5;
+const GRPC_RESOURCE_EXHAUSTED = 8;
+const GRPC_UNIMPLEMENTED = 12;
+
+// grpc.health.v1.HealthCheckResponse.ServingStatus
+const SERVING = 1;
+const NOT_SERVING = 2;
+const SERVICE_UNKNOWN = 3;
+
+const HEALTH_SERVICE = 'grpc.health.v1.Health';
+const REFLECTION_SERVICES = ['grpc.reflection.v1.ServerReflection', 'grpc.reflection.v1alpha.ServerReflection'];
+const HEALTH_PROTO = 'grpc/health/v1/health.proto';
+
+/**
+ * HTTP/2 connection preface: a gRPC client's first bytes ("PRI * HTTP/2.0")
+ */
+export function isHttp2Preface(chunk: Buffer): boolean {
+    return chunk.toString('latin1', 0, 3) === 'PRI';
+}
+
+/**
+ * gRPC Admin Services (on HEALTH_PORT, next to the HTTP endpoints)
+ *
+ * The standard services orchestration platforms and gRPC tools expect, so
+ * they work against the collector out of the box:
+ * - grpc.health.v1.Health (Check, Watch): Kubernetes grpc probes, grpc-health-probe.
+ *   Service "" and "readiness" follow /readyz; "liveness" follows /healthz.
+ * - grpc.reflection.v1 and v1alpha ServerReflection: `grpcurl -plaintext
+ *   host:8080 list` and calls to the health service without a .proto.
+ *
+ * Cleartext HTTP/2 (h2c) only: the health server hands over connections
+ * that start with the HTTP/2 preface (see isHttp2Preface). Messages are
+ * encoded by hand, like the gRPC output's (see serializers/protobuf.ts).
+ */
+export class GrpcAdminServer {
+    private readonly server: http2.Http2Server;
+    private readonly isReady: () => boolean;
+    private sessions = new Set<http2.ServerHttp2Session>();
+
+    constructor(options: { isReady: () => boolean }) {
+        this.isReady = options.isReady;
+        this.server = http2.createServer();
+        this.server.on('session', (session) => {
+            this.sessions.add(session);
+            session.on('close', () => this.sessions.delete(session));
+        });
+        this.server.on('stream', (stream, headers) => this.handleStream(stream, headers));
+    }
+
+    /**
+     * Serve an accepted connection (its first bytes are the HTTP/2 preface)
+     */
+    public accept(socket: Socket): void {
+        this.server.emit('connection', socket);
+    }
+
+    /**
+     * Close every connection (open Watch streams included)
+     */
+    public close(): void {
+        for (const session of this.sessions) session.destroy();
+        this.sessions.clear();
+    }
+
+    private handleStream(stream: http2.ServerHttp2Stream, headers: http2.IncomingHttpHeaders): void {
+        stream.on('error', () => undefined); // Client went away
+        const path = String(headers[':path'] ?? '');
+        if (headers[':method'] !== 'POST' || !String(headers['content-type'] ?? '').startsWith('application/grpc')) {
+            stream.respond({ ':status': 415 }, { endStream: true });
+            return;
+        }
+
+        const [, service = '', method = ''] = path.split('/');
+        if (service === HEALTH_SERVICE && method === 'Check') {
+            this.unary(stream, (request) => this.check(request));
+        } else if (service === HEALTH_SERVICE && method === 'Watch') {
+            this.watch(stream);
+        } else if (REFLECTION_SERVICES.includes(service) && method === 'ServerReflectionInfo') {
+            this.reflect(stream);
+        } else {
+            stream.respond({
+                ':status': 200,
+                'content-type': 'application/grpc',
+                'grpc-status': String(GRPC_UNIMPLEMENTED),
+                'grpc-message': encodeURIComponent(`Unknown method ${path}`),
+            }, { endStream: true });
+        }
+    }
+
+    // ===== grpc.health.v1.Health =====
+
+    private status(service: string): number {
+        if (service === 'liveness') return SERVING;
+        if (service === '' || service === 'readiness') return this.isReady() ? SERVING : NOT_SERVING;
+        return SERVICE_UNKNOWN;
+    }
+
+    private check(request: Buffer): { message: Buffer } | { code: number; error: string } {
+        const service = readString(request, 1);
+        const status = this.status(service);
+        if (status === SERVICE_UNKNOWN) return { code: GRPC_NOT_FOUND, error: `Unknown service "${service}" (use "", readiness or liveness)` };
+        return { message: new Writer().uint(1, status).finish() };
+    }
+
+    private watch(stream: http2.ServerHttp2Stream): void {
+        const frames = new FrameReader();
+        let timer: NodeJS.Timeout | null = null;
+        stream.on('close', () => {
+            if (timer) clearInterval(timer);
+        });
+        stream.on('data', (chunk: Buffer) => {
+            let request: Buffer | undefined;
+            try {
+                request = frames.push(chunk)[0];
+            } catch (err) {
+                return end(stream, GRPC_RESOURCE_EXHAUSTED, (err as Error).message);
+            }
+            if (!request || timer) return;
+
+            const service = readString(request, 1);
+            let last = -1;
+            const send = () => {
+                const status = this.status(service);
+                if (status === last) return;
+                last = status;
+                stream.write(frame(new Writer().uint(1, status).finish()));
+            };
+            stream.respond({ ':status': 200, 'content-type': 'application/grpc' }, { waitForTrailers: true });
+            send();
+            // Ends when the client cancels (or at shutdown)
+            timer = setInterval(send, WATCH_INTERVAL_MS);
+        });
+    }
+
+    // ===== grpc.reflection.v1(alpha).ServerReflection =====
+
+    private reflect(stream: http2.ServerHttp2Stream): void {
+        const frames = new FrameReader();
+        stream.respond({ ':status': 200, 'content-type': 'application/grpc' }, { waitForTrailers: true });
+        stream.on('data', (chunk: Buffer) => {
+            try {
+                for (const request of frames.push(chunk)) stream.write(frame(this.reflection(request)));
+            } catch (err) {
+                end(stream, GRPC_INVALID_ARGUMENT, (err as Error).message);
+            }
+        });
+        stream.on('end', () => end(stream, GRPC_OK));
+    }
+
+    /**
+     * One ServerReflectionResponse: the service list, or health.proto for
+     * its file name or any of its symbols
+     */
+    private reflection(request: Buffer): Buffer {
+        const response = new Writer().string(1, readString(request, 1)).bytes(2, request);
+        for (const { number, value } of fields(request)) {
+            if (!Buffer.isBuffer(value)) continue;
+            const name = value.toString('utf8');
+
+            if (number === 7) { // list_services
+                const services = new Writer();
+                for (const service of [HEALTH_SERVICE, ...REFLECTION_SERVICES]) {
+                    services.bytes(1, new Writer().string(1, service).finish());
+                }
+                return response.bytes(6, services.finish()).finish();
+            }
+            if ((number === 3 && name === HEALTH_PROTO) || (number === 4 && name.startsWith('grpc.health.v1.'))) {
+                return response.bytes(4, new Writer().bytes(1, healthDescriptor()).finish()).finish();
+            }
+            if (number >= 3 && number <= 6) {
+                const error = new Writer().uint(1, GRPC_NOT_FOUND).string(2, `Not found: ${name || 'extensions'}`);
+                return response.bytes(7, error.finish()).finish();
+            }
+        }
+        const error = new Writer().uint(1, GRPC_UNIMPLEMENTED).string(2, 'Unsupported reflection request');
+        return response.bytes(7, error.finish()).finish();
+    }
+
+    private unary(stream: http2.ServerHttp2Stream, handler: (request: Buffer) => { message: Buffer } | { code: number; error: string }): void {
+        const frames = new FrameReader();
+        let request: Buffer | undefined;
+        stream.on('data', (chunk: Buffer) => {
+            try {
+                request ??= frames.push(chunk)[0];
+            } catch (err) {
+                stream.respond({ ':status': 200, 'content-type': 'application/grpc' }, { waitForTrailers: true });
+                end(stream, GRPC_RESOURCE_EXHAUSTED, (err as Error).message);
+            }
+        });
+        stream.on('end', () => {
+            if (stream.headersSent) return;
+            stream.respond({ ':status': 200, 'content-type': 'application/grpc' }, { waitForTrailers: true });
+            if (!request) return end(stream, GRPC_INVALID_ARGUMENT, 'Expected one request message');
+
+            const result = handler(request);
+            if ('error' in result) return end(stream, result.code, result.error);
+            stream.write(frame(result.message));
+            end(stream, GRPC_OK);
+        });
+    }
+}
+
+/**
+ * Length-prefixed gRPC messages out of a stream's DATA chunks
+ */
+class FrameReader {
+    private pending = Buffer.alloc(0);
+
+    public push(chunk: Buffer): Buffer[] {
+        this.pending = Buffer.concat([this.pending, chunk]);
+        const messages: Buffer[] = [];
+        while (this.pending.length >= 5) {
+            const length = this.pending.readUInt32BE(1);
+            if (this.pending[0] !== 0) throw new Error('Compressed messages are not supported');
+            if (length > MAX_MESSAGE_BYTES) throw new Error(`Message larger than ${MAX_MESSAGE_BYTES} bytes`);
+            if (this.pending.length < 5 + length) break;
+            messages.push(this.pending.subarray(5, 5 + length));
+            this.pending = this.pending.subarray(5 + length);
+        }
+        return messages;
+    }
+}
+
+function frame(message: Buffer): Buffer {
+    const header = Buffer.alloc(5);
+    header.writeUInt32BE(message.length, 1);
+    return Buffer.concat([header, message]);
+}
+
+// Trailers are sent once the response body is ended (respond() with waitForTrailers)
+function end(stream: http2.ServerHttp2Stream, code: number, message?: string): void {
+    if (stream.closed || stream.writableEnded) return;
+    stream.once('wantTrailers', () => {
+        stream.sendTrailers({ 'grpc-status': String(code), ...(message && { 'grpc-message': encodeURIComponent(message) }) });
+    });
+    stream.end();
+}
+
+function readString(message: Buffer, number: number): string {
+    for (const field of fields(message)) {
+        if (field.number === number && Buffer.isBuffer(field.value)) return field.value.toString('utf8');
+    }
+    return '';
+}
+
+let descriptor: Buffer | null = null;
+
+/**
+ * FileDescriptorProto of grpc/health/v1/health.proto, for reflection clients
+ */
+function healthDescriptor(): Buffer {
+    if (descriptor) return descriptor;
+
+    const LABEL_OPTIONAL = 1;
+    const TYPE_STRING = 9;
+    const TYPE_ENUM = 14;
+    const field = (name: string, type: number, typeName?: string) =>
+        new Writer().string(1, name).uint(3, 1).uint(4, LABEL_OPTIONAL).uint(5, type).string(6, typeName).finish();
+    const method = (name: string, serverStreaming: boolean) => new Writer()
+        .string(1, name)
+        .string(2, '.grpc.health.v1.HealthCheckRequest')
+        .string(3, '.grpc.health.v1.HealthCheckResponse')
+        .bool(6, serverStreaming)
+        .finish();
+
+    const servingStatus = new Writer().string(1, 'ServingStatus');
+    ['UNKNOWN', 'SERVING', 'NOT_SERVING', 'SERVICE_UNKNOWN'].forEach((name, number) => {
+        servingStatus.bytes(2, new Writer().string(1, name).uint(2, number).finish());
+    });
+
+    descriptor = new Writer()
+        .string(1, HEALTH_PROTO)
+        .string(2, 'grpc.health.v1')
+        .bytes(4, new Writer().string(1, 'HealthCheckRequest').bytes(2, field('service', TYPE_STRING)).finish())
+        .bytes(4, new Writer()
+            .string(1, 'HealthCheckResponse')
+            .bytes(2, field('status', TYPE_ENUM, '.grpc.health.v1.HealthCheckResponse.ServingStatus'))
+            .bytes(4, servingStatus.finish())
+            .finish())
+        .bytes(6, new Writer().string(1, 'Health').bytes(2, method('Check', false)).bytes(2, method('Watch', true)).finish())
+        .string(12, 'proto3')
+        .finish();
+    return descriptor;
+}
@@ -0,0 +1,310 @@
+import http2 from 'node:http2';
+import { readFileSync } from 'node:fs';
+import type { Duplex } from 'node:stream';
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import type { BatchRejection } from './transport.js';
+import { buildIngestPayload } from './serializers.js';
+import { decodeBatchAck, encodeStreamBatch, type BatchAck } from './serializers/protobuf.js';
+import { log } from './logger.js';
+import { parseSocksUrl, socksSocket } from './socks.js';
+import { pinnedServerIdentity } from './http-client.js';
+
+const STREAM_PATH = '/centinela.ingest.v1.IngestService/StreamEvents';
+const ACK_TIMEOUT_MS = 30000; // Same as a bulk request
+const KEEPALIVE_INTERVAL_MS = 30000;
+const PING_TIMEOUT_MS = 10000;
+const MAX_ACK_BYTES = 4 * 1024 * 1024; // gRPC's default message limit
+
+// gRPC status codes (https://grpc.github.io/grpc/core/md_doc_statuscodes.html)
+export const GRPC_RESOURCE_EXHAUSTED = 8;
+const GRPC_UNAVAILABLE = 14;
+
+export interface GrpcOutputStats {
+    target: string | null;
+    connected: boolean;
+    streams: number; // Opened since startup; more than a few means reconnects
+    batches: number;
+    events: number;
+    bytes: number;
+    in_flight: number; // Batches sent, not acknowledged yet
+    errors: number;
+    last_error: string | null;
+}
+
+/**
+ * The stream ended with a non-OK status
+ */
+export class GrpcError extends Error {
+    public readonly code: number;
+
+    constructor(code: number, message: string) {
+        super(`gRPC status ${code}: ${message}`);
+        this.code = code;
+    }
+}
+
+interface PendingBatch {
+    stream: http2.ClientHttp2Stream;
+    size: number;
+    timer: NodeJS.Timeout;
+    resolve: (rejected: BatchRejection[]) => void;
+    reject: (err: Error) => void;
+}
+
+/**
+ * gRPC Output (OUTPUT_TYPE=grpc)
+ *
+ * Streams batches to the backend's IngestService.StreamEvents
+ * (proto/centinela/ingest/v1/ingest.proto) over one long-lived HTTP/2
+ * connection instead of a JSON POST per batch: each batch is an EventBatch
+ * message numbered with a sequence, and the backend answers each with a
+ * BatchAck listing the events it rejected, like the bulk endpoint's manifest.
+ * Several batches are in flight at once on the same stream.
+ *
+ * Only the request changes: the transport keeps its retry queue, DLQ, WAL and
+ * endpoint failover. A stream that ends (server restart, GOAWAY, bad key)
+ * fails the batches in flight, which the transport retries, and the next
+ * batch opens a new one. Identity and authorization are sent as call
+ * metadata when the stream opens; after an API key rotation the current
+ * stream is closed and the next one carries the new key.
+ *
+ * Uses node:http2 directly (no gRPC library), with BACKEND_TLS_* for mutual
+ * TLS and pinning and SOCKS_PROXY for egress, like HTTP sends.
+ */
+export class GrpcOutput {
+    private session: http2.ClientHttp2Session | null = null;
+    private target: string | null = null;
+    private stream: http2.ClientHttp2Stream | null = null;
+    private authorization: string | null = null;
+    private sequence = 0;
+    private pending = new Map<number, PendingBatch>();
+    private counters = { streams: 0, batches: 0, events: 0, bytes: 0, errors: 0 };
+    private lastError: string | null = null;
+
+    /**
+     * Send a batch on the stream to `target` (an http(s) origin) and wait for
+     * its acknowledgement. Resolves with the events the backend rejected;
+     * throws if the batch wasn't acknowledged (the caller retries it whole).
+     */
+    public async send(
+        target: string,
+        events: SyslogEvent[],
+        metadata: Record<string, string>,
+        traceparent?: string,
+    ): Promise<BatchRejection[]> {
+        const sequence = ++this.sequence;
+        const message = encodeStreamBatch(events.map(event => buildIngestPayload(event)), sequence, traceparent);
+
+        try {
+            const stream = this.openStream(target, metadata);
+            const rejected = await new Promise<BatchRejection[]>((resolve, reject) => {
+                const timer = setTimeout(() => {
+                    // Acks come back in order of processing; one this late means the stream is stuck
+                    stream.close(http2.constants.NGHTTP2_CANCEL);
+                    this.fail(stream, new Error(`batch not acknowledged within ${ACK_TIMEOUT_MS / 1000}s`));
+                }, ACK_TIMEOUT_MS);
+                this.pending.set(sequence, { stream, size: events.length, timer, resolve, reject });
+
+                const frame = Buffer.alloc(5 + message.length);
+                frame.writeUInt8(0, 0); // Not compressed
+                frame.writeUInt32BE(message.length, 1);
+                message.copy(frame, 5);
+                stream.write(frame);
+                this.counters.bytes += frame.length;
+            });
+
+            this.counters.batches++;
+            this.counters.events += events.length;
+            this.lastError = null;
+            return rejected;
+        } catch (err) {
+            this.counters.errors++;
+            this.lastError = (err as Error).message;
+            throw err;
+        }
+    }
+
+    /**
+     * End the stream and the connection (shutdown, after the last send)
+     */
+    public async close(): Promise<void> {
+        const session = this.session;
+        this.stream?.end();
+        this.stream = null;
+        this.session = null;
+        if (!session || session.closed) return;
+        await new Promise<void>((resolve) => session.close(resolve));
+    }
+
+    public getStats(): GrpcOutputStats {
+        return {
+            target: this.target,
+            connected: this.session !== null && !this.session.closed && !this.session.destroyed,
+            streams: this.counters.streams,
+            batches: this.counters.batches,
+            events: this.counters.events,
+            bytes: this.counters.bytes,
+            in_flight: this.pending.size,
+            errors: this.counters.errors,
+            last_error: this.lastError,
+        };
+    }
+
+    /**
+     * The current stream, or a new one (and connection) if there is none,
+     * the target changed (failover) or the API key was rotated
+     */
+    private openStream(target: string, metadata: Record<string, string>): http2.ClientHttp2Stream {
+        const headers = Object.fromEntries(Object.entries(metadata).map(([key, value]) => [key.toLowerCase(), value]));
+        const authorization = headers['authorization'] ?? null;
+
+        if (this.stream && !this.stream.closed && target === this.target && authorization === this.authorization) {
+            return this.stream;
+        }
+        // Batches in flight on the previous stream still get their acks
+        this.stream?.end();
+        this.stream = null;
+
+        if (target !== this.target) {
+            this.session?.close();
+            this.session = null;
+            this.target = target;
+        }
+        const session = this.connect(target);
+
+        const stream = session.request({
+            ...headers,
+            ':method': 'POST',
+            ':path': STREAM_PATH,
+            'content-type': 'application/grpc+proto',
+            'te': 'trailers',
+            'grpc-accept-encoding': 'identity',
+        });
+        this.stream = stream;
+        this.authorization = authorization;
+        this.counters.streams++;
+
+        let received = Buffer.alloc(0);
+        stream.on('response', (responseHeaders) => {
+            const status = responseHeaders[':status'];
+            if (status !== 200) {
+                // Not a gRPC server (proxy error page, old backend without the gRPC listener)
+                this.fail(stream, new GrpcError(GRPC_UNAVAILABLE, `HTTP ${status} from ${target}${STREAM_PATH}`));
+                stream.close(http2.constants.NGHTTP2_CANCEL);
+            } else if (responseHeaders['grpc-status'] !== undefined) {
+                this.finish(stream, responseHeaders); // Trailers-only response: refused outright
+            }
+        });
+        stream.on('data', (chunk: Buffer) => {
+            received = Buffer.concat([received, chunk]);
+            while (received.length >= 5) {
+                const length = received.readUInt32BE(1);
+                if (length > MAX_ACK_BYTES || received[0] !== 0) {
+                    this.fail(stream, new Error(`unexpected ${received[0] !== 0 ? 'compressed' : `${length}-byte`} message from the backend`));
+                    stream.close(http2.constants.NGHTTP2_CANCEL);
+                    return;
+                }
+                if (received.length < 5 + length) break;
+                this.acknowledge(received.subarray(5, 5 + length));
+                received = received.subarray(5 + length);
+            }
+        });
+        stream.on('trailers', (trailers) => this.finish(stream, trailers));
+        stream.on('error', (err) => this.fail(stream, err));
+        stream.on('close', () => {
+            if (this.stream === stream) this.stream = null;
+            this.fail(stream, new GrpcError(GRPC_UNAVAILABLE, 'stream closed'));
+        });
+        return stream;
+    }
+
+    private connect(target: string): http2.ClientHttp2Session {
+        if (this.session && !this.session.closed && !this.session.destroyed) return this.session;
+
+        // Re-read on every connection, so renewed certificates are picked up
+        const tlsOptions = {
+            cert: config.BACKEND_TLS_CERT ? readFileSync(config.BACKEND_TLS_CERT) : undefined,
+            key: config.BACKEND_TLS_KEY ? readFileSync(config.BACKEND_TLS_KEY) : undefined,
+            ca: config.BACKEND_TLS_CA ? readFileSync(config.BACKEND_TLS_CA) : undefined,
+            checkServerIdentity: config.BACKEND_TLS_PINS.length > 0 ? pinnedServerIdentity(config.BACKEND_TLS_PINS) : undefined,
+        };
+        const url = new URL(target);
+        const secure = url.protocol === 'https:';
+
+        const session = http2.connect(target, {
+            ...tlsOptions,
+            // Through SOCKS_PROXY, TLS (ALPN h2) inside the tunnel
+            createConnection: config.SOCKS_PROXY
+                ? () => socksSocket(parseSocksUrl(config.SOCKS_PROXY!), {
+                    host: url.hostname.replace(/^\[|\]$/g, ''),
+                    port: Number(url.port) || (secure ? 443 : 80),
+                    tls: secure ? { ...tlsOptions, ALPNProtocols: ['h2'] } : false,
+                }) as Duplex
+                : undefined,
+        });
+        this.session = session;
+
+        session.once('connect', () => log.info(`📡 gRPC stream connected to ${target}`));
+        session.on('error', (err) => {
+            log.debug(`⚠️ gRPC connection to ${target} failed: ${err.message}`);
+        });
+        session.once('close', () => {
+            if (this.session === session) this.session = null;
+        });
+
+        // Detect dead connections (NAT timeouts) between batches
+        const keepAlive = setInterval(() => {
+            const deadline = setTimeout(() => session.destroy(new Error('keepalive ping timed out')), PING_TIMEOUT_MS);
+            deadline.unref();
+            session.ping((err) => {
+                clearTimeout(deadline);
+                if (err) session.destroy(err);
+            });
+        }, KEEPALIVE_INTERVAL_MS);
+        keepAlive.unref();
+        session.once('close', () => clearInterval(keepAlive));
+        session.unref();
+
+        return session;
+    }
+
+    private acknowledge(message: Buffer): void {
+        let ack: BatchAck;
+        try {
+            ack = decodeBatchAck(message);
+        } catch (err) {
+            log.warn(`⚠️ Malformed BatchAck from the backend: ${(err as Error).message}`);
+            return;
+        }
+
+        const batch = this.pending.get(ack.sequence);
+        if (!batch) return; // Timed out already
+        this.pending.delete(ack.sequence);
+        clearTimeout(batch.timer);
+        batch.resolve(ack.rejected.filter(rejection => rejection.index < batch.size));
+    }
+
+    /**
+     * The stream's final status: OK after the backend ended it cleanly, but
+     * batches still unacknowledged have failed either way
+     */
+    private finish(stream: http2.ClientHttp2Stream, trailers: http2.IncomingHttpHeaders): void {
+        const code = Number(trailers['grpc-status']);
+        const message = decodeURIComponent(String(trailers['grpc-message'] ?? ''));
+        this.fail(stream, code === 0
+            ? new GrpcError(GRPC_UNAVAILABLE, 'stream ended by the backend')
+            : new GrpcError(Number.isInteger(code) ? code : GRPC_UNAVAILABLE, message || 'no message'));
+    }
+
+    /** Fail every batch in flight on `stream` */
+    private fail(stream: http2.ClientHttp2Stream, err: Error): void {
+        if (this.stream === stream) this.stream = null;
+        for (const [sequence, batch] of this.pending) {
+            if (batch.stream !== stream) continue;
+            this.pending.delete(sequence);
+            clearTimeout(batch.timer);
+            batch.reject(err);
+        }
+    }
+}
@@ -1,6 +1,90 @@
 import http from 'node:http';
-import { config } from './config.js';
+import net from 'node:net';
+import { timingSafeEqual } from 'node:crypto';
+import { z } from 'zod';
+import { config, parseListener } from './config.js';
 import { metrics, type MetricsSnapshot } from './metrics.js';
+import type { DrainStats } from './drain.js';
+import type { EndpointStats } from './endpoints.js';
+import type { CircuitBreakerStats } from './circuit-breaker.js';
+import type { UdpKernelStats } from './udp-stats.js';
+import type { TcpConnectionInfo } from './tcp-server.js';
+import type { NamedListeners } from './named-listeners.js';
+import { sourcePolicy } from './greylist.js';
+import { sourceMap } from './source-map.js';
+import { sourceRateLimit } from './source-rate-limit.js';
+import { enrichmentCache } from './enrichment-cache.js';
+import { reverseDns } from './reverse-dns.js';
+import { tracer } from './tracing.js';
+import { parserOverrides } from './parser-overrides.js';
+import { multilineRules } from './multiline.js';
+import { forwardingPolicy } from './forwarding-policy.js';
+import { clockSkew } from './clock-skew.js';
+import { getListenerAclStats } from './listener-acl.js';
+import { ruleEngine } from './rules.js';
+import { anonymizer } from './anonymize.js';
+import { tokenVault } from './token-vault.js';
+import { wal } from './wal.js';
+import { stateDir } from './state-dir.js';
+import { leakWatchdog } from './leak-watchdog.js';
+import { systemdNotify } from './systemd-notify.js';
+import { deadLetterFile } from './dead-letter.js';
+import { sanitizeConfig } from './config-diff.js';
+import { GrpcAdminServer, isHttp2Preface } from './grpc-admin.js';
+import type { ControlChannelStats } from './control-channel.js';
+import type { ShadowStats } from './shadow.js';
+import type { DualWriteStats } from './dual-write.js';
+import type { OtlpLogsStats } from './otlp-logs.js';
+import type { ArchiveStats } from './archive.js';
+import type { RateLimitStats } from './rate-governor.js';
+import type { WefStats } from './wef-server.js';
+import type { HttpPushSourceStats } from './http-push-server.js';
+import type { PickupStats } from './file-pickup.js';
+import type { ModbusStats } from './ot/modbus.js';
+import type { OpcUaStats } from './ot/opcua.js';
+import type { HoneypotServiceStats } from './honeypot.js';
+import type { DnsInputStats } from './dns-input.js';
+import type { KmsgInputStats } from './kmsg-input.js';
+import type { WinlogInputStats } from './winlog-input.js';
+import type { JournaldInputStats } from './journald-input.js';
+import type { KafkaInputStats } from './kafka-input.js';
+import type { FileTailStats } from './file-tail.js';
+import type { SimulationStats } from './simulation.js';
+import type { DiscoveryStats } from './discovery.js';
+import type { ForwardPoolStats } from './forward-pool.js';
+import type { PartitionStats } from './transport.js';
+import type { KafkaOutputStats } from './kafka-output.js';
+import type { GrpcOutputStats } from './grpc-output.js';
+import type { CompressionStats } from './compression.js';
+import { maintenance, parseDuration } from './maintenance.js';
+import { COLLECTOR_VERSION } from './identity.js';
+import { captureCpuProfile, heapSnapshot, runtimeStats } from './profiler.js';
+import { bundleFileName, supportBundles } from './support-bundle.js';
+import { log } from './logger.js';
+
+const MAX_ADMIN_BODY_BYTES = 4096;
+const MAX_PROFILE_SECONDS = 300;
+
+// One of: add a listener (LISTENERS syntax), remove one by name
+const ListenerRequestSchema = z.union([
+    z.object({ add: z.string().min(1) }).strict(),
+    z.object({ remove: z.string().min(1) }).strict(),
+]);
+
+const SupportBundleRequestSchema = z.object({
+    cpu_seconds: z.number().int().min(0).max(60).optional(),
+    heap: z.boolean().optional(),
+    passphrase: z.string().min(8).optional(), // Instead of SUPPORT_BUNDLE_PUBLIC_KEY
+    reason: z.string().max(200).optional(),
+}).strict();
+
+const ROUTE_TIMEOUT_MS = 10000; // A connection that sends nothing is closed
+
+const MaintenanceRequestSchema = z.object({
+    enabled: z.boolean(),
+    duration: z.union([z.string(), z.number()]).optional(), // "2h", "30m" or milliseconds
+    reason: z.string().max(200).optional(),
+});
 
 interface HealthStatus {
     status: 'healthy' | 'degraded' | 'unhealthy';
@@ -20,30 +104,177 @@ interface HealthStatus {
  * - GET /healthz - Simple health check (for load balancers)
  * - GET /readyz - Readiness check
  * - GET /metrics - Detailed metrics in JSON format
+ * - GET /connections - Open TCP connections with last activity
+ * - GET /greylist - Unauthorized sources awaiting approval
+ * - GET /clock-skew - Sources logging timestamps far from the receive time
+ * - GET /rate-limit - Sources throttled by SOURCE_RATE_LIMIT_EPS since the last summary
+ * - GET /rules - Hit counts and recent matches for each active rule
+ * - GET /config - Running configuration (secrets fingerprinted)
+ * - GET/POST /maintenance - Maintenance mode state / toggle (admin: ADMIN_TOKEN,
+ *   or loopback only when unset)
+ * - GET /dead-letter, POST /dead-letter/replay - Dead-letter file state / send
+ *   its events again (admin)
+ * - GET/POST /listeners - Named listeners / add or remove one at runtime (admin)
+ * - POST /support-bundle - Encrypted diagnostic archive (admin, see support-bundle.ts)
+ * - GET /debug/pprof/profile?seconds=30, /debug/pprof/heap - CPU profile and heap
+ *   snapshot of the running process (PROFILING_ENABLED; admin only)
+ *
+ * On the same port, gRPC clients (told apart by the HTTP/2 preface) get the
+ * standard health and reflection services (HEALTH_GRPC_ENABLED, see grpc-admin.ts).
  */
 export class HealthServer {
     private server: http.Server;
+    private listener: net.Server;
+    private grpc: GrpcAdminServer | null;
     private isRunning = false;
-    private getBufferStats: () => { size: number; dropped: number };
+    private getBufferStats: () => { size: number; dropped: number; spilled: number };
     private getRetryStats: () => { pending: number; dlq: number };
     private getTcpConnections: () => number;
+    private getDrainStats: () => DrainStats;
+    private getEndpointStats: () => EndpointStats;
+    private getCircuitStats: () => CircuitBreakerStats;
+    private getUdpKernelStats: () => UdpKernelStats | null;
+    private getTcpConnectionDetails: () => TcpConnectionInfo[];
+    private getControlStats: () => ControlChannelStats | null;
+    private getShadowStats: () => ShadowStats | null;
+    private getDualWriteStats: () => DualWriteStats | null;
+    private getOtlpLogsStats: () => OtlpLogsStats | null;
+    private getArchiveStats: () => ArchiveStats | null;
+    private replayDeadLetters: () => Promise<number>;
+    private listeners: NamedListeners;
+    private getRateLimitStats: () => RateLimitStats;
+    private getWefStats: () => WefStats | null;
+    private getHttpPushStats: () => Record<string, HttpPushSourceStats> | null;
+    private getPickupStats: () => PickupStats | null;
+    private getOtStats: () => { modbus: ModbusStats | null; opcua: OpcUaStats | null } | null;
+    private getHoneypotStats: () => Record<string, HoneypotServiceStats> | null;
+    private getDnsStats: () => DnsInputStats | null;
+    private getKmsgStats: () => KmsgInputStats | null;
+    private getWinlogStats: () => WinlogInputStats | null;
+    private getJournaldStats: () => JournaldInputStats | null;
+    private getKafkaInputStats: () => KafkaInputStats | null;
+    private getFileTailStats: () => FileTailStats | null;
+    private getSimulationStats: () => SimulationStats | null;
+    private getDiscoveryStats: () => DiscoveryStats | null;
+    private getForwardingStats: () => ForwardPoolStats;
+    private getPartitionStats: () => Record<string, PartitionStats>;
+    private getKafkaStats: () => KafkaOutputStats | null;
+    private getGrpcStats: () => GrpcOutputStats | null;
+    private getCompressionStats: () => CompressionStats;
 
     constructor(options: {
-        getBufferStats: () => { size: number; dropped: number };
+        getBufferStats: () => { size: number; dropped: number; spilled: number };
         getRetryStats: () => { pending: number; dlq: number };
         getTcpConnections: () => number;
+        getDrainStats: () => DrainStats;
+        getEndpointStats: () => EndpointStats;
+        getCircuitStats: () => CircuitBreakerStats;
+        getUdpKernelStats: () => UdpKernelStats | null;
+        getTcpConnectionDetails: () => TcpConnectionInfo[];
+        getControlStats: () => ControlChannelStats | null;
+        getShadowStats: () => ShadowStats | null;
+        getDualWriteStats: () => DualWriteStats | null;
+        getOtlpLogsStats: () => OtlpLogsStats | null;
+        getArchiveStats: () => ArchiveStats | null;
+        replayDeadLetters: () => Promise<number>;
+        listeners: NamedListeners;
+        getRateLimitStats: () => RateLimitStats;
+        getWefStats: () => WefStats | null;
+        getHttpPushStats: () => Record<string, HttpPushSourceStats> | null;
+        getPickupStats: () => PickupStats | null;
+        getOtStats: () => { modbus: ModbusStats | null; opcua: OpcUaStats | null } | null;
+        getHoneypotStats: () => Record<string, HoneypotServiceStats> | null;
+        getDnsStats: () => DnsInputStats | null;
+        getKmsgStats: () => KmsgInputStats | null;
+        getWinlogStats: () => WinlogInputStats | null;
+        getJournaldStats: () => JournaldInputStats | null;
+        getKafkaInputStats: () => KafkaInputStats | null;
+        getFileTailStats: () => FileTailStats | null;
+        getSimulationStats: () => SimulationStats | null;
+        getDiscoveryStats: () => DiscoveryStats | null;
+        getForwardingStats: () => ForwardPoolStats;
+        getPartitionStats: () => Record<string, PartitionStats>;
+        getKafkaStats: () => KafkaOutputStats | null;
+        getGrpcStats: () => GrpcOutputStats | null;
+        getCompressionStats: () => CompressionStats;
     }) {
         this.getBufferStats = options.getBufferStats;
         this.getRetryStats = options.getRetryStats;
         this.getTcpConnections = options.getTcpConnections;
+        this.getDrainStats = options.getDrainStats;
+        this.getEndpointStats = options.getEndpointStats;
+        this.getCircuitStats = options.getCircuitStats;
+        this.getUdpKernelStats = options.getUdpKernelStats;
+        this.getTcpConnectionDetails = options.getTcpConnectionDetails;
+        this.getControlStats = options.getControlStats;
+        this.getShadowStats = options.getShadowStats;
+        this.getDualWriteStats = options.getDualWriteStats;
+        this.getOtlpLogsStats = options.getOtlpLogsStats;
+        this.getArchiveStats = options.getArchiveStats;
+        this.replayDeadLetters = options.replayDeadLetters;
+        this.listeners = options.listeners;
+        this.getRateLimitStats = options.getRateLimitStats;
+        this.getWefStats = options.getWefStats;
+        this.getHttpPushStats = options.getHttpPushStats;
+        this.getPickupStats = options.getPickupStats;
+        this.getOtStats = options.getOtStats;
+        this.getHoneypotStats = options.getHoneypotStats;
+        this.getDnsStats = options.getDnsStats;
+        this.getKmsgStats = options.getKmsgStats;
+        this.getWinlogStats = options.getWinlogStats;
+        this.getJournaldStats = options.getJournaldStats;
+        this.getKafkaInputStats = options.getKafkaInputStats;
+        this.getFileTailStats = options.getFileTailStats;
+        this.getSimulationStats = options.getSimulationStats;
+        this.getDiscoveryStats = options.getDiscoveryStats;
+        this.getForwardingStats = options.getForwardingStats;
+        this.getPartitionStats = options.getPartitionStats;
+        this.getKafkaStats = options.getKafkaStats;
+        this.getGrpcStats = options.getGrpcStats;
+        this.getCompressionStats = options.getCompressionStats;
 
         this.server = http.createServer(this.handleRequest.bind(this));
+        this.grpc = config.HEALTH_GRPC_ENABLED ? new GrpcAdminServer({ isReady: () => this.isReady() }) : null;
+        this.listener = net.createServer((socket) => this.route(socket));
 
-        this.server.on('error', (err) => {
-            console.error(`❌ Health Server Error: ${err.message}`);
+        this.listener.on('error', (err) => {
+            log.error(`❌ Health Server Error: ${err.message}`);
         });
     }
 
+    /**
+     * Hand a connection to the HTTP server, or to the gRPC services if its
+     * first bytes are the HTTP/2 preface
+     */
+    private route(socket: net.Socket): void {
+        const grpc = this.grpc;
+        if (!grpc) {
+            this.server.emit('connection', socket);
+            return;
+        }
+
+        socket.setTimeout(ROUTE_TIMEOUT_MS, () => socket.destroy());
+        socket.once('error', () => socket.destroy());
+        socket.once('data', (chunk: Buffer) => {
+            socket.setTimeout(0);
+            socket.pause();
+            socket.unshift(chunk);
+            if (isHttp2Preface(chunk)) {
+                grpc.accept(socket);
+            } else {
+                this.server.emit('connection', socket);
+            }
+            process.nextTick(() => socket.resume());
+        });
+    }
+
+    /**
+     * Readiness as /readyz reports it (also the gRPC health status)
+     */
+    private isReady(): boolean {
+        return this.getBufferStats().size / config.MAX_BUFFER_SIZE <= 0.9 && this.getRetryStats().dlq <= 100;
+    }
+
     /**
      * Handle incoming HTTP requests
      */
@@ -54,6 +285,11 @@ export class HealthServer {
         res.setHeader('Access-Control-Allow-Origin', '*');
         res.setHeader('Content-Type', 'application/json');
 
+        if (url.startsWith('/debug/pprof')) {
+            void this.handleProfiling(req, res);
+            return;
+        }
+
         switch (url) {
             case '/healthz':
             case '/health':
@@ -73,9 +309,51 @@ export class HealthServer {
                 this.handleStatus(res);
                 break;
 
+            case '/connections':
+                this.handleConnections(res);
+                break;
+
+            case '/greylist':
+                this.handleGreylist(res);
+                break;
+
+            case '/clock-skew':
+                this.handleClockSkew(res);
+                break;
+
+            case '/rate-limit':
+                this.handleRateLimit(res);
+                break;
+
+            case '/rules':
+                this.handleRules(res);
+                break;
+
+            case '/config':
+                res.writeHead(200);
+                res.end(JSON.stringify({ config: sanitizeConfig(config), ts: new Date().toISOString() }, null, 2));
+                break;
+
+            case '/maintenance':
+                void this.handleMaintenance(req, res);
+                break;
+
+            case '/dead-letter':
+            case '/dead-letter/replay':
+                void this.handleDeadLetter(req, res);
+                break;
+
+            case '/listeners':
+                void this.handleListeners(req, res);
+                break;
+
+            case '/support-bundle':
+                void this.handleSupportBundle(req, res);
+                break;
+
             default:
                 res.writeHead(404);
-                res.end(JSON.stringify({ error: 'Not Found', endpoints: ['/healthz', '/readyz', '/metrics', '/status'] }));
+                res.end(JSON.stringify({ error: 'Not Found', endpoints: ['/healthz', '/readyz', '/metrics', '/status', '/connections', '/greylist', '/clock-skew', '/rate-limit', '/rules', '/config', '/maintenance', '/dead-letter', '/listeners', '/support-bundle'] }));
         }
     }
 
@@ -139,18 +417,76 @@ export class HealthServer {
      * Detailed metrics endpoint
      */
     private handleMetrics(res: http.ServerResponse): void {
+        res.writeHead(200);
+        res.end(JSON.stringify(this.getMetrics(), null, 2));
+    }
+
+    /**
+     * Everything /metrics reports (also the metrics of support bundles)
+     */
+    public getMetrics(): Record<string, unknown> {
         const snapshot = metrics.getSnapshot();
         const bufferStats = this.getBufferStats();
         const retryStats = this.getRetryStats();
 
-        const fullMetrics = {
+        return {
             ...snapshot,
             buffer: {
                 size: bufferStats.size,
                 max: config.MAX_BUFFER_SIZE,
                 dropped: bufferStats.dropped,
+                spilled: bufferStats.spilled,
             },
+            forwarding: this.getForwardingStats(),
+            partitions: this.getPartitionStats(),
             retry_queue: retryStats,
+            drain: this.getDrainStats(),
+            maintenance: maintenance.getStats(),
+            wal: wal.getStats(),
+            dead_letter: deadLetterFile.getStats(),
+            state_dir: stateDir.getStats(),
+            leak_watchdog: leakWatchdog.getStats(),
+            systemd: systemdNotify.getStats(),
+            support_bundles: supportBundles.getStats(),
+            backend: this.getEndpointStats(),
+            circuit_breaker: this.getCircuitStats(),
+            kafka: this.getKafkaStats(),
+            grpc: this.getGrpcStats(),
+            compression: this.getCompressionStats(),
+            udp_kernel: this.getUdpKernelStats(),
+            listener_acl: getListenerAclStats(),
+            source_rate_limit: sourceRateLimit.getStats(),
+            enrichment_cache: enrichmentCache.getStats(),
+            reverse_dns: reverseDns.getStats(),
+            tracing: tracer.getStats(),
+            greylist: sourcePolicy.getStats(),
+            source_map: sourceMap.getStats(),
+            parser_overrides: parserOverrides.getStats(),
+            multiline: multilineRules.getStats(),
+            forwarding_policies: forwardingPolicy.getStats(),
+            clock_skew: clockSkew.getStats(),
+            rules: ruleEngine.getStats(),
+            anonymization: anonymizer.getStats(),
+            token_vault: tokenVault.getStats(),
+            control_channel: this.getControlStats(),
+            shadow: this.getShadowStats(),
+            dual_write: this.getDualWriteStats(),
+            otlp_logs: this.getOtlpLogsStats(),
+            archive: this.getArchiveStats(),
+            rate_limit: this.getRateLimitStats(),
+            wef: this.getWefStats(),
+            http_push: this.getHttpPushStats(),
+            pickup: this.getPickupStats(),
+            ot: this.getOtStats(),
+            honeypot: this.getHoneypotStats(),
+            dns: this.getDnsStats(),
+            kmsg: this.getKmsgStats(),
+            winlog: this.getWinlogStats(),
+            journald: this.getJournaldStats(),
+            kafka_input: this.getKafkaInputStats(),
+            file_tail: this.getFileTailStats(),
+            simulation: this.getSimulationStats(),
+            discovery: this.getDiscoveryStats(),
             connections: {
                 tcp: this.getTcpConnections(),
             },
@@ -160,9 +496,6 @@ export class HealthServer {
                 max_retries: config.MAX_RETRIES,
             },
         };
-
-        res.writeHead(200);
-        res.end(JSON.stringify(fullMetrics, null, 2));
     }
 
     /**
@@ -175,7 +508,7 @@ export class HealthServer {
         const health: HealthStatus = {
             status: retryStats.dlq > 100 ? 'unhealthy' : retryStats.dlq > 50 ? 'degraded' : 'healthy',
             service: 'centinela-collector',
-            version: '0.2.0',
+            version: COLLECTOR_VERSION,
             uptime: snapshot.uptime_human,
             checks: {
                 buffer: snapshot.events.pending > config.MAX_BUFFER_SIZE * 0.9 ? 'critical' : 'ok',
@@ -188,19 +521,391 @@ export class HealthServer {
         res.end(JSON.stringify(health));
     }
 
+    /**
+     * Open TCP connections, most recently active first
+     */
+    private handleConnections(res: http.ServerResponse): void {
+        const connections = this.getTcpConnectionDetails().sort((a, b) => a.idle_ms - b.idle_ms);
+
+        res.writeHead(200);
+        res.end(JSON.stringify({
+            count: connections.length,
+            connections,
+            ts: new Date().toISOString(),
+        }, null, 2));
+    }
+
+    /**
+     * Unauthorized sources seen in greylist mode
+     */
+    private handleGreylist(res: http.ServerResponse): void {
+        res.writeHead(200);
+        res.end(JSON.stringify({
+            ...sourcePolicy.getStats(),
+            sources: sourcePolicy.getSources(),
+            ts: new Date().toISOString(),
+        }, null, 2));
+    }
+
+    /**
+     * Sources logging timestamps far from the receive time
+     */
+    private handleClockSkew(res: http.ServerResponse): void {
+        res.writeHead(200);
+        res.end(JSON.stringify({
+            ...clockSkew.getStats(),
+            sources: clockSkew.getSources(),
+            ts: new Date().toISOString(),
+        }, null, 2));
+    }
+
+    /**
+     * Sources throttled by the per-source rate limit since the last summary
+     */
+    private handleRateLimit(res: http.ServerResponse): void {
+        res.writeHead(200);
+        res.end(JSON.stringify({
+            ...sourceRateLimit.getStats(),
+            sources: sourceRateLimit.getThrottledSources(),
+            ts: new Date().toISOString(),
+        }, null, 2));
+    }
+
+    /**
+     * Active rules with hit counts and sampled matches
+     */
+    private handleRules(res: http.ServerResponse): void {
+        res.writeHead(200);
+        res.end(JSON.stringify({
+            ...ruleEngine.getStats(),
+            rule_hits: ruleEngine.getRuleHits(),
+            ts: new Date().toISOString(),
+        }, null, 2));
+    }
+
+    /**
+     * Maintenance mode: GET returns the state, POST {"enabled": true, "duration": "2h",
+     * "reason": "..."} starts a window and {"enabled": false} ends it
+     */
+    private async handleMaintenance(req: http.IncomingMessage, res: http.ServerResponse): Promise<void> {
+        const reply = (status: number, body: unknown) => {
+            res.writeHead(status);
+            res.end(JSON.stringify(body, null, 2));
+        };
+
+        if (req.method === 'GET') {
+            reply(200, { ...maintenance.getStats(), ts: new Date().toISOString() });
+            return;
+        }
+        if (req.method !== 'POST') {
+            reply(405, { error: 'Method Not Allowed' });
+            return;
+        }
+        if (!this.isAdmin(req)) {
+            reply(403, { error: config.ADMIN_TOKEN ? 'Invalid admin token' : 'Admin actions are only accepted from localhost (set ADMIN_TOKEN)' });
+            return;
+        }
+        // Also forces a CORS preflight, which is never granted, for browser requests
+        if (!req.headers['content-type']?.startsWith('application/json')) {
+            reply(415, { error: 'Expected Content-Type: application/json' });
+            return;
+        }
+
+        let parsed;
+        try {
+            parsed = MaintenanceRequestSchema.safeParse(JSON.parse(await this.readBody(req)));
+        } catch (err) {
+            reply(400, { error: `Invalid JSON: ${(err as Error).message}` });
+            return;
+        }
+        if (!parsed.success) {
+            reply(400, { error: 'Invalid request', details: parsed.error.format() });
+            return;
+        }
+
+        const { enabled, duration, reason } = parsed.data;
+        if (!enabled) {
+            reply(200, await maintenance.disable('disabled locally'));
+            return;
+        }
+
+        const durationMs = duration === undefined ? undefined : parseDuration(duration);
+        if (durationMs === null) {
+            reply(400, { error: `Invalid duration "${duration}" (e.g. "90m", "2h" or milliseconds)` });
+            return;
+        }
+
+        try {
+            reply(200, await maintenance.enable({ durationMs, reason, source: 'local' }));
+        } catch (err) {
+            reply(500, { error: `Cannot start maintenance: ${(err as Error).message}` });
+        }
+    }
+
+    /**
+     * Dead-letter file: GET returns its state, POST /dead-letter/replay sends
+     * every event in it again (those refused again are written back)
+     */
+    private async handleDeadLetter(req: http.IncomingMessage, res: http.ServerResponse): Promise<void> {
+        const reply = (status: number, body: unknown) => {
+            res.writeHead(status);
+            res.end(JSON.stringify(body, null, 2));
+        };
+
+        const replay = req.url?.startsWith('/dead-letter/replay') ?? false;
+        if (req.method === 'GET' && !replay) {
+            reply(200, { ...deadLetterFile.getStats(), ts: new Date().toISOString() });
+            return;
+        }
+        if (req.method !== 'POST' || !replay) {
+            reply(405, { error: 'Method Not Allowed' });
+            return;
+        }
+        if (!this.isAdmin(req)) {
+            reply(403, { error: config.ADMIN_TOKEN ? 'Invalid admin token' : 'Admin actions are only accepted from localhost (set ADMIN_TOKEN)' });
+            return;
+        }
+        // Also forces a CORS preflight, which is never granted, for browser requests
+        if (!req.headers['content-type']?.startsWith('application/json')) {
+            reply(415, { error: 'Expected Content-Type: application/json' });
+            return;
+        }
+        if (!deadLetterFile.enabled) {
+            reply(409, { error: 'No dead-letter file configured (DEAD_LETTER_FILE or STATE_DIR)' });
+            return;
+        }
+
+        try {
+            const queued = await this.replayDeadLetters();
+            log.info(`💀 Replaying ${queued} dead-lettered events (requested by ${req.socket.remoteAddress})`);
+            reply(200, { ...deadLetterFile.getStats(), queued });
+        } catch (err) {
+            reply(500, { error: `Cannot replay the dead-letter file: ${(err as Error).message}` });
+        }
+    }
+
+    /**
+     * Named listeners: GET lists them, POST {"add": "name:udp|tcp:port[:options]"}
+     * binds a new one and {"remove": "name"} closes one, without a restart
+     */
+    private async handleListeners(req: http.IncomingMessage, res: http.ServerResponse): Promise<void> {
+        const reply = (status: number, body: unknown) => {
+            res.writeHead(status);
+            res.end(JSON.stringify(body, null, 2));
+        };
+
+        if (req.method === 'GET') {
+            reply(200, { listeners: this.listeners.list(), ts: new Date().toISOString() });
+            return;
+        }
+        if (req.method !== 'POST') {
+            reply(405, { error: 'Method Not Allowed' });
+            return;
+        }
+        if (!this.isAdmin(req)) {
+            reply(403, { error: config.ADMIN_TOKEN ? 'Invalid admin token' : 'Admin actions are only accepted from localhost (set ADMIN_TOKEN)' });
+            return;
+        }
+        // Also forces a CORS preflight, which is never granted, for browser requests
+        if (!req.headers['content-type']?.startsWith('application/json')) {
+            reply(415, { error: 'Expected Content-Type: application/json' });
+            return;
+        }
+
+        let parsed;
+        try {
+            parsed = ListenerRequestSchema.safeParse(JSON.parse(await this.readBody(req)));
+        } catch (err) {
+            reply(400, { error: `Invalid JSON: ${(err as Error).message}` });
+            return;
+        }
+        if (!parsed.success) {
+            reply(400, { error: 'Expected {"add": "name:udp|tcp:port[:options]"} or {"remove": "name"}' });
+            return;
+        }
+
+        if ('remove' in parsed.data) {
+            const removed = await this.listeners.remove(parsed.data.remove);
+            if (!removed) {
+                reply(404, { error: `No listener named "${parsed.data.remove}"` });
+                return;
+            }
+            reply(200, { removed: parsed.data.remove, listeners: this.listeners.list() });
+            return;
+        }
+
+        let spec;
+        try {
+            spec = parseListener(parsed.data.add);
+        } catch (err) {
+            reply(400, { error: `Invalid listener: ${(err as Error).message}` });
+            return;
+        }
+        try {
+            reply(201, { added: await this.listeners.add(spec), listeners: this.listeners.list() });
+        } catch (err) {
+            reply(409, { error: (err as Error).message });
+        }
+    }
+
+    /**
+     * Support bundle: POST {"cpu_seconds": 10, "heap": false, "passphrase": "..."}
+     * returns the encrypted archive (see support-bundle.ts)
+     */
+    private async handleSupportBundle(req: http.IncomingMessage, res: http.ServerResponse): Promise<void> {
+        const reply = (status: number, body: unknown) => {
+            res.writeHead(status);
+            res.end(JSON.stringify(body, null, 2));
+        };
+
+        if (req.method !== 'POST') {
+            reply(405, { error: 'Method Not Allowed' });
+            return;
+        }
+        if (!this.isAdmin(req)) {
+            reply(403, { error: config.ADMIN_TOKEN ? 'Invalid admin token' : 'Admin actions are only accepted from localhost (set ADMIN_TOKEN)' });
+            return;
+        }
+        if (!req.headers['content-type']?.startsWith('application/json')) {
+            reply(415, { error: 'Expected Content-Type: application/json' });
+            return;
+        }
+
+        let parsed;
+        try {
+            parsed = SupportBundleRequestSchema.safeParse(JSON.parse(await this.readBody(req)));
+        } catch (err) {
+            reply(400, { error: `Invalid JSON: ${(err as Error).message}` });
+            return;
+        }
+        if (!parsed.success) {
+            reply(400, { error: 'Expected {"cpu_seconds": 0-60, "heap": true|false, "passphrase": "...", "reason": "..."}' });
+            return;
+        }
+
+        const { cpu_seconds: cpuSeconds, heap, passphrase, reason } = parsed.data;
+        log.info(`🧰 Creating a support bundle for ${req.socket.remoteAddress}`);
+        try {
+            const bundle = await supportBundles.create({
+                reason: reason ?? 'requested on the health port',
+                cpuSeconds,
+                heap,
+                key: passphrase ? { passphrase } : undefined,
+            });
+            res.writeHead(200, {
+                'Content-Type': 'application/octet-stream',
+                'Content-Disposition': `attachment; filename="${bundleFileName()}"`,
+            });
+            res.end(bundle);
+        } catch (err) {
+            reply(409, { error: (err as Error).message });
+        }
+    }
+
+    /**
+     * Profiles of a production collector when it spikes, without a rebuild or
+     * restart: GET /debug/pprof (memory figures), /debug/pprof/profile?seconds=N
+     * (.cpuprofile) and /debug/pprof/heap (.heapsnapshot)
+     */
+    private async handleProfiling(req: http.IncomingMessage, res: http.ServerResponse): Promise<void> {
+        const reply = (status: number, body: unknown) => {
+            res.writeHead(status);
+            res.end(JSON.stringify(body, null, 2));
+        };
+
+        if (!config.PROFILING_ENABLED) {
+            reply(404, { error: 'Profiling is disabled (set PROFILING_ENABLED=true)' });
+            return;
+        }
+        if (!this.isAdmin(req)) {
+            reply(403, { error: config.ADMIN_TOKEN ? 'Invalid admin token' : 'Profiles are only served to localhost (set ADMIN_TOKEN)' });
+            return;
+        }
+        if (req.method !== 'GET') {
+            reply(405, { error: 'Method Not Allowed' });
+            return;
+        }
+
+        const url = new URL(req.url ?? '/', 'http://localhost');
+        const stamp = new Date().toISOString().replace(/[:.]/g, '-');
+        const attachment = (extension: string) => `attachment; filename="${config.COLLECTOR_NAME}-${stamp}.${extension}"`;
+
+        switch (url.pathname.replace(/\/$/, '')) {
+            case '/debug/pprof':
+                reply(200, { ...runtimeStats(), endpoints: ['/debug/pprof/profile?seconds=30', '/debug/pprof/heap'], ts: new Date().toISOString() });
+                return;
+
+            case '/debug/pprof/profile': {
+                const seconds = Number(url.searchParams.get('seconds') ?? 30);
+                if (!Number.isInteger(seconds) || seconds < 1 || seconds > MAX_PROFILE_SECONDS) {
+                    reply(400, { error: `seconds must be an integer from 1 to ${MAX_PROFILE_SECONDS}` });
+                    return;
+                }
+                log.info(`🔬 Recording a ${seconds}s CPU profile for ${req.socket.remoteAddress}`);
+                try {
+                    const profile = await captureCpuProfile(seconds);
+                    res.writeHead(200, { 'Content-Disposition': attachment('cpuprofile') });
+                    res.end(profile);
+                } catch (err) {
+                    reply(409, { error: (err as Error).message });
+                }
+                return;
+            }
+
+            case '/debug/pprof/heap':
+                log.info(`🔬 Taking a heap snapshot for ${req.socket.remoteAddress}`);
+                res.writeHead(200, { 'Content-Disposition': attachment('heapsnapshot') });
+                heapSnapshot().pipe(res);
+                return;
+
+            default:
+                reply(404, { error: 'Not Found', endpoints: ['/debug/pprof', '/debug/pprof/profile?seconds=30', '/debug/pprof/heap'] });
+        }
+    }
+
+    private isAdmin(req: http.IncomingMessage): boolean {
+        if (!config.ADMIN_TOKEN) {
+            const address = req.socket.remoteAddress ?? '';
+            return address === '127.0.0.1' || address === '::1' || address === '::ffff:127.0.0.1';
+        }
+
+        const candidate = Buffer.from(req.headers.authorization ?? '');
+        const expected = Buffer.from(`Bearer ${config.ADMIN_TOKEN}`);
+        return candidate.length === expected.length && timingSafeEqual(candidate, expected);
+    }
+
+    private readBody(req: http.IncomingMessage): Promise<string> {
+        return new Promise((resolve, reject) => {
+            const chunks: Buffer[] = [];
+            let size = 0;
+            req.on('data', (chunk: Buffer) => {
+                size += chunk.length;
+                if (size > MAX_ADMIN_BODY_BYTES) {
+                    reject(new Error('body too large'));
+                    req.destroy();
+                    return;
+                }
+                chunks.push(chunk);
+            });
+            req.on('end', () => resolve(Buffer.concat(chunks).toString('utf8')));
+            req.on('error', reject);
+        });
+    }
+
     /**
      * Start the health check server
      */
     public start(): Promise<void> {
         return new Promise((resolve, reject) => {
-            this.server.listen(config.HEALTH_PORT, '0.0.0.0', () => {
+            this.listener.listen(config.HEALTH_PORT, '0.0.0.0', () => {
                 this.isRunning = true;
-                console.log(`📊 Health/Metrics server on http://0.0.0.0:${config.HEALTH_PORT}`);
-                console.log(`   Endpoints: /healthz, /readyz, /metrics, /status`);
+                log.info(`📊 Health/Metrics server on http://0.0.0.0:${config.HEALTH_PORT}` +
+                    (this.grpc ? ' (and gRPC health/reflection, h2c)' : ''));
+                log.info(`   Endpoints: /healthz, /readyz, /metrics, /status, /connections, /greylist, /clock-skew, /rate-limit, /rules, /config, /maintenance, /dead-letter, /listeners`);
                 resolve();
             });
 
-            this.server.once('error', (err) => {
+            this.listener.once('error', (err) => {
                 reject(err);
             });
         });
@@ -216,9 +921,11 @@ export class HealthServer {
                 return;
             }
 
-            this.server.close(() => {
+            this.grpc?.close();
+            this.server.closeIdleConnections();
+            this.listener.close(() => {
                 this.isRunning = false;
-                console.log('   Health server stopped.');
+                log.info('   Health server stopped.');
                 resolve();
             });
         });
@@ -0,0 +1,387 @@
+import net from 'node:net';
+import { createHash, generateKeyPairSync } from 'node:crypto';
+import { readFileSync } from 'node:fs';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { log } from './logger.js';
+
+type Service = 'ssh' | 'telnet' | 'rdp';
+
+const SESSION_TIMEOUT_MS = 30000;
+const MAX_ATTEMPTS = 6; // Per connection, then the decoy hangs up
+
+// Telnet protocol bytes
+const IAC = 0xff;
+const WILL = 0xfb;
+const ECHO = 0x01;
+const SUPPRESS_GO_AHEAD = 0x03;
+
+export interface HoneypotServiceStats {
+    port: number;
+    connections: number;
+    attempts: number;
+    sources: number; // Distinct peer addresses seen
+}
+
+interface Closable {
+    close(callback?: () => void): unknown;
+}
+
+/**
+ * Honeypot (decoy listeners)
+ *
+ * Fake SSH, Telnet and RDP services that nobody legitimate should ever connect
+ * to. They never authenticate anyone; every connection and every credential
+ * tried becomes a high-severity security event (tags honeypot=<service>,
+ * severity=high), which makes lateral movement and internal scanning visible.
+ *
+ * - ssh: real SSH handshake (ssh2) with a configurable version string, records
+ *   passwords, keyboard-interactive answers and public key fingerprints. Without
+ *   ssh2 installed it degrades to banner-only (client version recorded).
+ * - telnet: login/password prompts, "Login incorrect" after each try
+ * - rdp: records the mstshash cookie (user name) of the X.224 connection request
+ *   and refuses the negotiation
+ */
+export class Honeypot {
+    private buffer: MessageBuffer;
+    private servers: { service: Service; server: Closable }[] = [];
+    private stats = new Map<Service, HoneypotServiceStats>();
+    private sources = new Map<Service, Set<string>>();
+    private sockets = new Set<net.Socket>();
+    private sshClients = new Set<{ end(): unknown }>();
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+        for (const [service, port] of Object.entries(config.HONEYPOT_LISTENERS) as [Service, number][]) {
+            this.stats.set(service, { port, connections: 0, attempts: 0, sources: 0 });
+            this.sources.set(service, new Set());
+        }
+    }
+
+    public getStats(): Record<string, HoneypotServiceStats> {
+        return Object.fromEntries(this.stats);
+    }
+
+    /**
+     * Start every configured decoy
+     */
+    public async start(): Promise<void> {
+        for (const [service, port] of Object.entries(config.HONEYPOT_LISTENERS) as [Service, number][]) {
+            const server = service === 'ssh'
+                ? await this.createSshServer()
+                : net.createServer((socket) => this.track(socket, service === 'telnet' ? this.handleTelnet : this.handleRdp));
+
+            await new Promise<void>((resolve, reject) => {
+                const listening = server as net.Server;
+                listening.once('error', reject);
+                listening.listen(port, config.HONEYPOT_BIND_ADDRESS, () => {
+                    listening.removeListener('error', reject);
+                    listening.on('error', (err) => log.error(`❌ Honeypot ${service} error: ${err.message}`));
+                    resolve();
+                });
+            });
+            this.servers.push({ service, server });
+        }
+
+        const list = this.servers.map(({ service }) => `${service}:${config.HONEYPOT_LISTENERS[service]}`).join(', ');
+        log.info(`🍯 Honeypot decoys listening on ${config.HONEYPOT_BIND_ADDRESS} (${list})`);
+    }
+
+    /**
+     * Stop every decoy
+     */
+    public async stop(): Promise<void> {
+        for (const socket of this.sockets) {
+            socket.destroy();
+        }
+        for (const client of this.sshClients) {
+            client.end();
+        }
+        await Promise.all(this.servers.map(({ server }) => new Promise<void>((resolve) => server.close(() => resolve()))));
+        if (this.servers.length > 0) log.info('   Honeypot stopped.');
+        this.servers = [];
+    }
+
+    private track(socket: net.Socket, handler: (socket: net.Socket) => void): void {
+        this.sockets.add(socket);
+        socket.on('close', () => this.sockets.delete(socket));
+        socket.on('error', () => socket.destroy());
+        socket.setTimeout(SESSION_TIMEOUT_MS, () => socket.destroy());
+        handler.call(this, socket);
+    }
+
+    // ============= SSH =============
+
+    private async createSshServer(): Promise<Closable> {
+        let ssh2: typeof import('ssh2');
+        try {
+            ssh2 = await import('ssh2');
+        } catch {
+            log.warn('⚠️ Honeypot: ssh2 is not installed, SSH decoy only records client versions');
+            return net.createServer((socket) => this.track(socket, this.handleSshBanner));
+        }
+
+        const hostKey = config.HONEYPOT_SSH_HOST_KEY
+            ? readFileSync(config.HONEYPOT_SSH_HOST_KEY)
+            : generateKeyPairSync('rsa', {
+                modulusLength: 2048,
+                publicKeyEncoding: { type: 'spki', format: 'pem' },
+                privateKeyEncoding: { type: 'pkcs1', format: 'pem' },
+            }).privateKey;
+
+        return new ssh2.Server({ hostKeys: [hostKey], ident: config.HONEYPOT_SSH_VERSION }, (client, info) => {
+            const peer = { address: info.ip, port: info.port };
+            const clientVersion = info.header.identRaw;
+            let attempts = 0;
+            this.connected('ssh', peer.address);
+            this.sshClients.add(client);
+            const timer = setTimeout(() => client.end(), SESSION_TIMEOUT_MS);
+
+            client.on('authentication', (ctx) => {
+                const record = (credentials: Record<string, unknown>) => {
+                    attempts++;
+                    this.report('ssh', peer, 'login_attempt', {
+                        username: ctx.username,
+                        method: ctx.method,
+                        client_version: clientVersion,
+                        ...credentials,
+                    });
+                };
+
+                switch (ctx.method) {
+                    case 'password':
+                        record(this.secret(ctx.password));
+                        break;
+                    case 'publickey':
+                        record({ key_type: ctx.key.algo, key_fingerprint: fingerprint(ctx.key.data) });
+                        break;
+                    case 'keyboard-interactive':
+                        ctx.prompt([{ prompt: 'Password: ', echo: false }], (answers) => {
+                            record(this.secret(answers[0] ?? ''));
+                            ctx.reject();
+                        });
+                        return;
+                }
+
+                if (attempts >= MAX_ATTEMPTS) {
+                    client.end();
+                    return;
+                }
+                ctx.reject(['password', 'keyboard-interactive', 'publickey']);
+            });
+
+            client.on('close', () => {
+                this.sshClients.delete(client);
+                clearTimeout(timer);
+                if (attempts === 0) this.report('ssh', peer, 'connection', { client_version: clientVersion });
+            });
+            client.on('error', () => undefined); // Scanners drop connections mid-handshake
+        });
+    }
+
+    private handleSshBanner(socket: net.Socket): void {
+        const peer = { address: socket.remoteAddress || 'unknown', port: socket.remotePort };
+        this.connected('ssh', peer.address);
+        socket.write(`SSH-2.0-${config.HONEYPOT_SSH_VERSION}\r\n`);
+
+        let received = '';
+        let reported = false;
+        const report = () => {
+            if (reported) return;
+            reported = true;
+            const version = /^SSH-[^\r\n]*/m.exec(received)?.[0];
+            this.report('ssh', peer, 'connection', { client_version: version });
+        };
+        socket.on('data', (data: Buffer) => {
+            received += data.toString('latin1');
+            if (received.includes('\n') || received.length > 255) {
+                report();
+                socket.end();
+            }
+        });
+        socket.on('close', report);
+    }
+
+    // ============= TELNET =============
+
+    private handleTelnet(socket: net.Socket): void {
+        const peer = { address: socket.remoteAddress || 'unknown', port: socket.remotePort };
+        this.connected('telnet', peer.address);
+
+        let attempts = 0;
+        let username: string | null = null;
+        let line = '';
+
+        socket.write(`\r\n${config.HONEYPOT_HOSTNAME} login: `);
+
+        socket.on('data', (data: Buffer) => {
+            for (const char of stripTelnetCommands(data)) {
+                if (char !== '\r' && char !== '\n') {
+                    if (line.length < 256) line += char;
+                    continue;
+                }
+                if (char === '\n' && line === '') continue; // \n of a \r\n pair
+
+                if (username === null) {
+                    username = line;
+                    // Ask the client to stop echoing while the password is typed
+                    socket.write(Buffer.from([IAC, WILL, ECHO, IAC, WILL, SUPPRESS_GO_AHEAD]));
+                    socket.write('Password: ');
+                } else {
+                    attempts++;
+                    this.report('telnet', peer, 'login_attempt', { username, ...this.secret(line) });
+                    username = null;
+                    if (attempts >= 3) {
+                        socket.end('\r\nLogin incorrect\r\n');
+                        return;
+                    }
+                    socket.write(`\r\nLogin incorrect\r\n${config.HONEYPOT_HOSTNAME} login: `);
+                }
+                line = '';
+            }
+        });
+
+        socket.on('close', () => {
+            if (attempts === 0) this.report('telnet', peer, 'connection', username ? { username } : {});
+        });
+    }
+
+    // ============= RDP =============
+
+    private handleRdp(socket: net.Socket): void {
+        const peer = { address: socket.remoteAddress || 'unknown', port: socket.remotePort };
+        this.connected('rdp', peer.address);
+
+        let received = Buffer.alloc(0);
+        let reported = false;
+        const report = (action: string, details: Record<string, unknown>) => {
+            if (reported) return;
+            reported = true;
+            this.report('rdp', peer, action, details);
+        };
+
+        socket.on('data', (data: Buffer) => {
+            received = Buffer.concat([received, data]);
+            // TPKT header: version 3, reserved, length (big endian)
+            if (received.length < 4) return;
+            if (received[0] !== 3) {
+                report('connection', { note: 'not an RDP client' });
+                socket.destroy();
+                return;
+            }
+            const length = received.readUInt16BE(2);
+            if (received.length < length) return;
+
+            const request = parseRdpConnectionRequest(received.subarray(0, length));
+            report(request.username ? 'login_attempt' : 'connection', request);
+
+            // X.224 Connection Confirm carrying RDP_NEG_FAILURE (HYBRID_REQUIRED_BY_SERVER)
+            socket.end(Buffer.from([
+                0x03, 0x00, 0x00, 0x13,
+                0x0e, 0xd0, 0x00, 0x00, 0x12, 0x34, 0x00,
+                0x03, 0x00, 0x08, 0x00, 0x05, 0x00, 0x00, 0x00,
+            ]));
+        });
+
+        socket.on('close', () => report('connection', {}));
+    }
+
+    // ============= EVENTS =============
+
+    private connected(service: Service, address: string): void {
+        const stats = this.stats.get(service)!;
+        stats.connections++;
+
+        const seen = this.sources.get(service)!;
+        if (seen.size < 10000) seen.add(address);
+        stats.sources = seen.size;
+    }
+
+    /**
+     * Record a decoy hit as a high-severity event
+     */
+    private report(service: Service, peer: { address: string; port?: number }, action: string, details: Record<string, unknown>): void {
+        if (action === 'login_attempt') this.stats.get(service)!.attempts++;
+
+        const event = createSyslogEvent(
+            JSON.stringify({
+                event: `honeypot.${action}`,
+                severity: 'high',
+                service,
+                port: config.HONEYPOT_LISTENERS[service],
+                peer: `${peer.address}:${peer.port}`,
+                ...details,
+            }),
+            peer,
+            service,
+        );
+        event.tags = { honeypot: service, severity: 'high' };
+        ingestEvent(this.buffer, event, { skipSourcePolicy: true });
+
+        log.warn(`🍯 Honeypot ${service} ${action.replace('_', ' ')} from ${peer.address}` +
+            (typeof details.username === 'string' ? ` (user "${details.username}")` : ''));
+    }
+
+    /**
+     * Passwords as typed, or only a fingerprint when HONEYPOT_RECORD_PASSWORDS=false
+     * (people mistyping a host also land here, with real credentials)
+     */
+    private secret(password: string): Record<string, unknown> {
+        return config.HONEYPOT_RECORD_PASSWORDS
+            ? { password }
+            : { password_sha256: createHash('sha256').update(password).digest('hex').slice(0, 16), password_length: password.length };
+    }
+}
+
+function fingerprint(key: Buffer): string {
+    return `SHA256:${createHash('sha256').update(key).digest('base64').replace(/=+$/, '')}`;
+}
+
+/**
+ * Drop telnet IAC command sequences (negotiation) from client input
+ */
+function stripTelnetCommands(data: Buffer): string {
+    let text = '';
+    for (let i = 0; i < data.length; i++) {
+        const byte = data[i]!;
+        if (byte === IAC) {
+            const command = data[i + 1];
+            if (command === 0xfa) {
+                // Subnegotiation: skip to IAC SE
+                while (i < data.length && !(data[i] === IAC && data[i + 1] === 0xf0)) i++;
+                i++;
+            } else {
+                i += command !== undefined && command >= WILL ? 2 : 1;
+            }
+            continue;
+        }
+        if (byte !== 0) text += String.fromCharCode(byte);
+    }
+    return text;
+}
+
+/**
+ * X.224 Connection Request: "Cookie: mstshash=<user>" and the RDP_NEG_REQ protocols
+ */
+function parseRdpConnectionRequest(packet: Buffer): Record<string, unknown> {
+    const body = packet.subarray(11); // TPKT (4) + X.224 CR fixed part (7)
+    const text = body.toString('latin1');
+    const result: Record<string, unknown> = {};
+
+    const cookie = /Cookie: mstshash=([^\r\n]*)\r\n/.exec(text);
+    if (cookie) result.username = cookie[1];
+
+    const negotiation = cookie ? body.subarray(cookie.index + cookie[0].length) : body;
+    if (negotiation.length >= 8 && negotiation[0] === 0x01) {
+        const protocols = negotiation.readUInt32LE(4);
+        result.requested_protocols = [
+            'rdp',
+            ...(protocols & 0x1 ? ['tls'] : []),
+            ...(protocols & 0x2 ? ['credssp'] : []),
+            ...(protocols & 0x8 ? ['rdstls'] : []),
+        ];
+    }
+    return result;
+}
@@ -0,0 +1,193 @@
+import http from 'node:http';
+import https from 'node:https';
+import net from 'node:net';
+import tls from 'node:tls';
+import { createHash } from 'node:crypto';
+import { readFileSync } from 'node:fs';
+import { Readable, type Duplex } from 'node:stream';
+import { config, type Config } from './config.js';
+import { connectSocks, parseSocksUrl, type SocksProxy } from './socks.js';
+import { log } from './logger.js';
+
+// Old agents keep serving requests already in flight (bulk sends time out after 30s)
+const AGENT_RETIRE_DELAY_MS = 60000;
+
+const NULL_BODY_STATUSES = new Set([101, 204, 205, 304]);
+
+let agent: https.Agent | null = null;
+let plainAgent: http.Agent | null = null; // http:// URLs, only through the SOCKS proxy
+const reportedMismatches = new Set<string>();
+
+type CreateConnectionCallback = (err: Error | null, socket?: Duplex) => void;
+
+/**
+ * https.Agent whose connections are tunnelled through a SOCKS5 proxy; TLS
+ * (with the backend client certificate, if any) runs inside the tunnel
+ */
+class SocksHttpsAgent extends https.Agent {
+    private readonly proxy: SocksProxy;
+
+    constructor(proxy: SocksProxy, options: https.AgentOptions) {
+        super(options);
+        this.proxy = proxy;
+    }
+
+    public createConnection(options: tls.ConnectionOptions, callback: CreateConnectionCallback): undefined {
+        const host = options.host ?? 'localhost';
+        connectSocks(this.proxy, host, Number(options.port) || 443).then((socket) => {
+            const secure = tls.connect({ ...options, socket, servername: options.servername ?? (net.isIP(host) ? undefined : host) });
+            callback(null, secure);
+        }, (err: Error) => callback(err));
+        return undefined;
+    }
+}
+
+class SocksHttpAgent extends http.Agent {
+    private readonly proxy: SocksProxy;
+
+    constructor(proxy: SocksProxy) {
+        super({ keepAlive: true });
+        this.proxy = proxy;
+    }
+
+    public createConnection(options: net.TcpNetConnectOpts, callback: CreateConnectionCallback): undefined {
+        connectSocks(this.proxy, options.host ?? 'localhost', Number(options.port) || 80)
+            .then((socket) => callback(null, socket), (err: Error) => callback(err));
+        return undefined;
+    }
+}
+
+/**
+ * SPKI pin of a certificate: sha256/<base64 of the SHA-256 of its
+ * SubjectPublicKeyInfo>, as `openssl x509 -pubkey | openssl pkey -pubin
+ * -outform der | openssl dgst -sha256 -binary | base64` prints it
+ */
+export function spkiPin(cert: tls.PeerCertificate): string {
+    return `sha256/${createHash('sha256').update(cert.pubkey).digest('base64')}`;
+}
+
+/**
+ * The pins of every certificate the server presented, leaf first
+ */
+export function chainPins(cert: tls.DetailedPeerCertificate): string[] {
+    const pins: string[] = [];
+    for (let current: tls.DetailedPeerCertificate | undefined = cert; current?.pubkey;) {
+        pins.push(spkiPin(current));
+        if (current.issuerCertificate === current) break;
+        current = current.issuerCertificate;
+    }
+    return pins;
+}
+
+/**
+ * checkServerIdentity for BACKEND_TLS_PINS: the usual hostname check, then
+ * one of the pins must match a certificate of the chain (the backend's own
+ * key, or its CA's, to survive renewals). A mismatch means something between
+ * us and the backend terminates TLS with another key, typically a
+ * TLS-inspecting proxy; the connection is refused before the API key is sent,
+ * and logged as an error once per certificate presented.
+ */
+export function pinnedServerIdentity(pins: string[]): (host: string, cert: tls.PeerCertificate) => Error | undefined {
+    return (host, cert) => {
+        const hostnameError = tls.checkServerIdentity(host, cert);
+        if (hostnameError || pins.length === 0) return hostnameError;
+
+        const presented = chainPins(cert as tls.DetailedPeerCertificate);
+        if (presented.some((pin) => pins.includes(pin))) return undefined;
+
+        const issuer = cert.issuer?.O ?? cert.issuer?.CN ?? 'unknown issuer';
+        if (!reportedMismatches.has(presented[0]!)) {
+            reportedMismatches.add(presented[0]!);
+            log.error(`🚨 Backend certificate for ${host} does not match BACKEND_TLS_PINS (issued by ${issuer}); ` +
+                'refusing to connect. A TLS-inspecting proxy is probably intercepting traffic: allow-list the backend on it', {
+                presented_pins: presented,
+            });
+        }
+        const error = new Error(`Certificate pin mismatch for ${host} (issued by ${issuer})`) as NodeJS.ErrnoException;
+        error.code = 'ERR_TLS_PIN_MISMATCH';
+        return error;
+    };
+}
+
+/**
+ * Load the client certificate, CA bundle and pins used towards the backend
+ * (BACKEND_TLS_CERT / BACKEND_TLS_KEY / BACKEND_TLS_CA / BACKEND_TLS_PINS). Called at startup and
+ * on SIGHUP, so renewed certificates are picked up without a restart. Throws
+ * if a file can't be read; the current ones are then kept.
+ *
+ * With SOCKS_PROXY, the agents also tunnel every backend connection through
+ * the proxy (the proxy itself is only read at startup).
+ */
+export function loadBackendTls(
+    settings: Pick<Config, 'BACKEND_TLS_CERT' | 'BACKEND_TLS_KEY' | 'BACKEND_TLS_CA' | 'BACKEND_TLS_PINS'> = config,
+): void {
+    const previous = agent;
+    const proxy = config.SOCKS_PROXY ? parseSocksUrl(config.SOCKS_PROXY) : null;
+    const options: https.AgentOptions = {
+        keepAlive: true,
+        cert: settings.BACKEND_TLS_CERT ? readFileSync(settings.BACKEND_TLS_CERT) : undefined,
+        key: settings.BACKEND_TLS_KEY ? readFileSync(settings.BACKEND_TLS_KEY) : undefined,
+        ca: settings.BACKEND_TLS_CA ? readFileSync(settings.BACKEND_TLS_CA) : undefined,
+        checkServerIdentity: settings.BACKEND_TLS_PINS.length > 0 ? pinnedServerIdentity(settings.BACKEND_TLS_PINS) : undefined,
+    };
+
+    if (proxy) {
+        agent = new SocksHttpsAgent(proxy, options);
+        plainAgent ??= new SocksHttpAgent(proxy);
+    } else if (!settings.BACKEND_TLS_CERT && !settings.BACKEND_TLS_CA && settings.BACKEND_TLS_PINS.length === 0) {
+        agent = null;
+    } else {
+        agent = new https.Agent(options);
+    }
+
+    if (settings.BACKEND_TLS_CERT || settings.BACKEND_TLS_CA) {
+        log.info(`🔐 Backend TLS: ${settings.BACKEND_TLS_CERT ? `client certificate ${settings.BACKEND_TLS_CERT}` : 'no client certificate'}` +
+            (settings.BACKEND_TLS_CA ? `, CA ${settings.BACKEND_TLS_CA}` : ''));
+    }
+    if (settings.BACKEND_TLS_PINS.length > 0) {
+        log.info(`📌 Backend certificate pinned (${settings.BACKEND_TLS_PINS.length} pin(s))`);
+    }
+
+    if (previous) {
+        setTimeout(() => previous.destroy(), AGENT_RETIRE_DELAY_MS).unref();
+    }
+}
+
+/**
+ * fetch() for requests to Centinela backends (ingest, shadow, dual-write,
+ * control channel). With a client certificate, CA bundle or pins configured,
+ * https:// requests go through node:https with them (mutual TLS), since the
+ * built-in fetch takes no TLS options; with SOCKS_PROXY, every request goes
+ * through node:http(s) and the proxy. Otherwise this is plain fetch().
+ */
+export function backendFetch(url: string, init: RequestInit = {}): Promise<Response> {
+    const secure = url.startsWith('https:');
+    const requestAgent = secure ? agent : plainAgent;
+    if (!requestAgent) return fetch(url, init);
+
+    return new Promise((resolve, reject) => {
+        const request = (secure ? https : http).request(url, {
+            method: init.method ?? 'GET',
+            headers: init.headers as Record<string, string> | undefined,
+            agent: requestAgent,
+            signal: init.signal ?? undefined,
+        }, (response) => {
+            const headers = new Headers();
+            for (const [name, value] of Object.entries(response.headers)) {
+                for (const item of [value ?? []].flat()) headers.append(name, item);
+            }
+
+            const status = response.statusCode ?? 502;
+            let body: ReadableStream | null = null;
+            if (NULL_BODY_STATUSES.has(status) || init.method === 'HEAD') {
+                response.resume();
+            } else {
+                body = Readable.toWeb(response) as ReadableStream;
+            }
+            resolve(new Response(body, { status, statusText: response.statusMessage, headers }));
+        });
+
+        request.on('error', reject);
+        request.end(init.body as string | Uint8Array | undefined);
+    });
+}
@@ -0,0 +1,266 @@
+import http from 'node:http';
+import https from 'node:https';
+import { createHash } from 'node:crypto';
+import { readFileSync } from 'node:fs';
+import { createGunzip } from 'node:zlib';
+import type { Readable } from 'node:stream';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { createPushAuth, type PushAuthProvider } from './push-auth.js';
+import { log } from './logger.js';
+
+const MAX_BODY_BYTES = 50 * 1024 * 1024; // After decompression
+const PUSH_PATH = /^\/v1\/push\/([\w-]+)\/?$/;
+const FASTLY_CHALLENGE_PATH = '/.well-known/fastly/logging/challenge';
+
+export interface HttpPushSourceStats {
+    auth: PushAuthProvider['scheme'];
+    requests: number;
+    events: number;
+    unauthorized: number;
+    last_push: string | null;
+}
+
+/**
+ * HTTP Push Server (cloud log delivery)
+ *
+ * Receives logs pushed by SaaS/CDN services over HTTPS so they go through the
+ * same pipeline (greylist, rules, buffer) as syslog:
+ * - POST /v1/push/<source> with the source's shared secret (HTTP_PUSH_SOURCES)
+ *   as `Authorization: Bearer <secret>` or `X-Push-Secret`, or the source's
+ *   own scheme (HTTP_PUSH_AUTH: basic auth, webhook HMAC signatures, client
+ *   certificates, see push-auth.ts)
+ * - Newline-delimited bodies (Cloudflare Logpush, Fastly "newline delimited")
+ *   and JSON arrays (Fastly "JSON array"); one event per line/item
+ * - gzip Content-Encoding (Cloudflare compresses by default)
+ * - GET /.well-known/fastly/logging/challenge for Fastly endpoint validation
+ *
+ * Cloudflare: destination_conf = "https://<collector>/v1/push/cloudflare?header_Authorization=Bearer%20<secret>"
+ * Fastly: HTTPS endpoint URL .../v1/push/fastly, custom header "Authorization: Bearer <secret>"
+ * GitHub: webhook URL .../v1/push/github, secret in HTTP_PUSH_AUTH (github=hmac-github:<secret>)
+ *
+ * With HTTP_PUSH_TLS_CERT/HTTP_PUSH_TLS_KEY the listener serves HTTPS itself;
+ * HTTP_PUSH_TLS_CA asks for client certificates, which only mtls sources
+ * require.
+ */
+export class HttpPushServer {
+    private server: http.Server;
+    private buffer: MessageBuffer;
+    private tls: boolean;
+    private auth = new Map<string, PushAuthProvider>();
+    private stats = new Map<string, HttpPushSourceStats>();
+    private isRunning = false;
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+        for (const [name, secret] of Object.entries(config.HTTP_PUSH_SOURCES)) {
+            this.auth.set(name, createPushAuth({ scheme: 'token', secret }));
+        }
+        for (const [name, spec] of Object.entries(config.HTTP_PUSH_AUTH)) {
+            this.auth.set(name, createPushAuth(spec));
+        }
+        for (const [name, auth] of this.auth) {
+            this.stats.set(name, { auth: auth.scheme, requests: 0, events: 0, unauthorized: 0, last_push: null });
+        }
+
+        this.tls = Boolean(config.HTTP_PUSH_TLS_CERT && config.HTTP_PUSH_TLS_KEY);
+        if (this.tls) {
+            const ca = config.HTTP_PUSH_TLS_CA ? readFileSync(config.HTTP_PUSH_TLS_CA) : undefined;
+            // Certificates are optional at the TLS layer: mtls sources check them, others use their own scheme
+            this.server = https.createServer({
+                cert: readFileSync(config.HTTP_PUSH_TLS_CERT!),
+                key: readFileSync(config.HTTP_PUSH_TLS_KEY!),
+                ca,
+                requestCert: Boolean(ca),
+                rejectUnauthorized: false,
+            }, this.handleRequest.bind(this));
+        } else {
+            this.server = http.createServer(this.handleRequest.bind(this));
+        }
+        this.server.on('error', (err) => {
+            log.error(`❌ HTTP Push Server Error: ${err.message}`);
+        });
+    }
+
+    /**
+     * Handle incoming HTTP requests
+     */
+    private handleRequest(req: http.IncomingMessage, res: http.ServerResponse): void {
+        const path = (req.url || '/').split('?')[0] ?? '/';
+
+        if (req.method === 'GET' && path === FASTLY_CHALLENGE_PATH) {
+            res.writeHead(200, { 'Content-Type': 'text/plain' });
+            res.end(this.fastlyChallenge());
+            return;
+        }
+
+        const source = PUSH_PATH.exec(path)?.[1];
+        const stats = source ? this.stats.get(source) : undefined;
+        if (req.method !== 'POST' || !source || !stats) {
+            this.reply(res, 404, { error: 'Not Found' });
+            return;
+        }
+
+        // Signatures cover the body, so those sources are checked once it is read
+        const auth = this.auth.get(source)!;
+        if (!auth.signsBody && !auth.authorize(req)) {
+            this.unauthorized(auth, stats, res);
+            return;
+        }
+
+        this.readBody(req, auth.signsBody)
+            .then(({ text, raw }) => {
+                if (auth.signsBody && !auth.authorize(req, raw)) {
+                    this.unauthorized(auth, stats, res);
+                    return;
+                }
+                this.handlePush(source, stats, req, text, res);
+            })
+            .catch((err: Error) => {
+                this.reply(res, 400, { error: err.message });
+            });
+    }
+
+    private handlePush(source: string, stats: HttpPushSourceStats, req: http.IncomingMessage, body: string, res: http.ServerResponse): void {
+        let records: string[];
+        try {
+            records = splitRecords(body);
+        } catch {
+            this.reply(res, 400, { error: 'Invalid JSON array' });
+            return;
+        }
+
+        // Backpressure: cloud senders retry on 5xx
+        if (this.buffer.available < records.length) {
+            this.reply(res, 503, { error: 'Buffer full, retry later' });
+            return;
+        }
+
+        const remote = { address: req.socket.remoteAddress || 'unknown', port: req.socket.remotePort };
+        for (const record of records) {
+            const event = createSyslogEvent(record, remote, 'http-push');
+            event.tags = { push_source: source };
+            ingestEvent(this.buffer, event);
+        }
+
+        stats.requests++;
+        stats.events += records.length;
+        stats.last_push = new Date().toISOString();
+        this.reply(res, 200, { ok: true, accepted: records.length });
+    }
+
+    private unauthorized(auth: PushAuthProvider, stats: HttpPushSourceStats, res: http.ServerResponse): void {
+        stats.unauthorized++;
+        this.reply(res, 401, { error: 'Invalid credentials' }, auth.challenge ? { 'WWW-Authenticate': auth.challenge } : {});
+    }
+
+    /**
+     * Fastly validates endpoints by fetching the SHA-256 of its service ID (or "*")
+     */
+    private fastlyChallenge(): string {
+        if (config.HTTP_PUSH_FASTLY_SERVICE_IDS.length === 0) return '*\n';
+        return config.HTTP_PUSH_FASTLY_SERVICE_IDS
+            .map((id) => createHash('sha256').update(id).digest('hex'))
+            .join('\n') + '\n';
+    }
+
+    /**
+     * Read the (decoded) body; keepRaw also returns the bytes as received,
+     * for signature checks
+     */
+    private readBody(req: http.IncomingMessage, keepRaw: boolean): Promise<{ text: string; raw?: Buffer }> {
+        const encoding = req.headers['content-encoding'];
+        const rawChunks: Buffer[] = [];
+        if (keepRaw && encoding === 'gzip') {
+            req.on('data', (chunk: Buffer) => rawChunks.push(chunk));
+        }
+        let stream: Readable = req;
+        if (encoding === 'gzip') {
+            stream = req.pipe(createGunzip());
+        } else if (encoding && encoding !== 'identity') {
+            return Promise.reject(new Error(`Unsupported Content-Encoding: ${encoding}`));
+        }
+
+        return new Promise((resolve, reject) => {
+            const chunks: Buffer[] = [];
+            let size = 0;
+
+            stream.on('data', (chunk: Buffer) => {
+                size += chunk.length;
+                if (size > MAX_BODY_BYTES) {
+                    reject(new Error('Payload too large'));
+                    req.destroy();
+                    return;
+                }
+                chunks.push(chunk);
+            });
+            stream.on('end', () => {
+                const body = Buffer.concat(chunks);
+                resolve({ text: body.toString('utf8'), raw: keepRaw ? (encoding === 'gzip' ? Buffer.concat(rawChunks) : body) : undefined });
+            });
+            stream.on('error', reject);
+        });
+    }
+
+    private reply(res: http.ServerResponse, status: number, body: object, headers: http.OutgoingHttpHeaders = {}): void {
+        res.writeHead(status, { ...headers, 'Content-Type': 'application/json' });
+        res.end(JSON.stringify(body));
+    }
+
+    public getStats(): Record<string, HttpPushSourceStats> {
+        return Object.fromEntries(this.stats);
+    }
+
+    /**
+     * Start the HTTP push server
+     */
+    public start(): Promise<void> {
+        return new Promise((resolve, reject) => {
+            this.server.listen(config.HTTP_PUSH_PORT, config.HTTP_PUSH_BIND_ADDRESS, () => {
+                this.isRunning = true;
+                log.info(
+                    `☁️  HTTP push input on ${this.tls ? 'https' : 'http'}://${config.HTTP_PUSH_BIND_ADDRESS}:${config.HTTP_PUSH_PORT}/v1/push/<source> ` +
+                    `(${[...this.auth].map(([name, auth]) => `${name}: ${auth.scheme}`).join(', ')})`
+                );
+                resolve();
+            });
+
+            this.server.once('error', (err) => {
+                reject(err);
+            });
+        });
+    }
+
+    /**
+     * Stop the HTTP push server
+     */
+    public stop(): Promise<void> {
+        return new Promise((resolve) => {
+            if (!this.isRunning) {
+                resolve();
+                return;
+            }
+
+            this.server.close(() => {
+                this.isRunning = false;
+                log.info('   HTTP push server stopped.');
+                resolve();
+            });
+        });
+    }
+}
+
+/**
+ * One record per line (NDJSON / plain text), or per item of a JSON array
+ */
+function splitRecords(body: string): string[] {
+    const trimmed = body.trim();
+    if (trimmed.startsWith('[')) {
+        const items: unknown = JSON.parse(trimmed);
+        if (!Array.isArray(items)) throw new Error('expected an array');
+        return items.map((item) => (typeof item === 'string' ? item : JSON.stringify(item)));
+    }
+    return trimmed.split(/\r?\n/).filter((line) => line.trim().length > 0);
+}
@@ -0,0 +1,48 @@
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { COLLECTOR_VERSION } from './version.js';
+
+export { COLLECTOR_VERSION };
+
+/**
+ * Headers identifying this collector to the backend, sent on every request
+ * (ingest, shadow, control channel) so requests can be traced and throttled
+ * per collector rather than only per tenant.
+ */
+export function identityHeaders(): Record<string, string> {
+    const headers: Record<string, string> = {
+        'User-Agent': config.USER_AGENT ?? `CentinelaCollector/${COLLECTOR_VERSION} (${config.COLLECTOR_NAME})`,
+        'X-Centinela-Collector-Id': headerValue(config.COLLECTOR_ID ?? config.COLLECTOR_NAME),
+        'X-Centinela-Collector-Name': headerValue(config.COLLECTOR_NAME),
+        'X-Centinela-Collector-Version': COLLECTOR_VERSION,
+    };
+
+    if (config.SITE_ID) headers['X-Centinela-Site'] = headerValue(config.SITE_ID);
+    if (config.TENANT_ID) headers['X-Centinela-Tenant'] = headerValue(config.TENANT_ID);
+    if (config.COLLECTOR_GROUP) headers['X-Centinela-Collector-Group'] = config.COLLECTOR_GROUP;
+
+    const labels = Object.entries(config.INSTANCE_LABELS);
+    if (labels.length > 0) {
+        headers['X-Centinela-Labels'] = labels.map(([key, value]) => `${key}=${headerValue(value)}`).join(',');
+    }
+
+    return headers;
+}
+
+/**
+ * Tenant and site of a bulk request, from its events (a batch never mixes
+ * them, see batchPartition), so the backend can route it per tenant
+ */
+export function partitionHeaders(event: SyslogEvent): Record<string, string> {
+    const headers: Record<string, string> = {};
+    const tenant = event.tenant_id ?? config.TENANT_ID;
+    const site = event.site_id ?? config.SITE_ID;
+    if (site) headers['X-Centinela-Site'] = headerValue(site);
+    if (tenant) headers['X-Centinela-Tenant'] = headerValue(tenant);
+    return headers;
+}
+
+// Header values must be visible ASCII; anything else is percent-encoded
+export function headerValue(value: string): string {
+    return /^[\x20-\x7e]*$/.test(value) && !value.includes(',') ? value : encodeURIComponent(value);
+}
@@ -0,0 +1,334 @@
+import net from 'node:net';
+import {
+    escapeRegex,
+    listenerSettings,
+    negatePattern,
+    prefixToCidr,
+    type ImportedRule,
+    type ImportResult,
+    type Listener,
+} from './types.js';
+
+type Match = Omit<ImportedRule, 'id' | 'description' | 'action'>;
+
+interface Statement {
+    text: string;
+    line: number;
+}
+
+const LISTENER_INPUTS: Record<string, 'udp' | 'tcp'> = { imudp: 'udp', imtcp: 'tcp', imptcp: 'tcp' };
+
+/**
+ * Translate an rsyslog configuration (legacy $-directives, selector lines,
+ * property filters and RainerScript input()/action()/if...then).
+ *
+ * - imudp/imtcp inputs ($UDPServerRun, input(type="imudp" ...)) become listeners
+ * - $AllowedSender becomes ALLOWED_SOURCES with UNKNOWN_SOURCE_POLICY=reject
+ * - Filters whose action is `stop` / `~` become drop rules
+ * - Forwarding actions (@host, @@host, omfwd) are reported as replaced destinations
+ */
+export function importRsyslog(text: string): ImportResult {
+    const warnings: string[] = [];
+    const listeners: Listener[] = [];
+    const destinations: string[] = [];
+    const rules: ImportedRule[] = [];
+    const allowed: string[] = [];
+    let udpAddress: string | undefined;
+    let previousFilter: ((line: number) => void) | null = null; // For "& action" lines
+
+    const addRule = (line: number, description: string, match: Match | string) => {
+        if (typeof match === 'string') {
+            warnings.push(`line ${line}: ${match}`);
+            return;
+        }
+        rules.push({ id: `rsyslog-line-${line}`, description, action: 'drop', ...match });
+    };
+
+    for (const { text: statement, line } of statements(text)) {
+        // --- Legacy directives ---
+        if (statement.startsWith('$')) {
+            const [directive = '', ...rest] = statement.split(/\s+/);
+            const value = rest.join(' ');
+
+            switch (directive.toLowerCase()) {
+                case '$udpserveraddress':
+                    udpAddress = value === '*' ? '0.0.0.0' : value;
+                    break;
+                case '$udpserverrun':
+                    listeners.push({ protocol: 'udp', port: Number(value), address: udpAddress, line });
+                    break;
+                case '$inputtcpserverrun':
+                case '$inputptcpserverrun':
+                    listeners.push({ protocol: 'tcp', port: Number(value), line });
+                    break;
+                case '$allowedsender':
+                    // $AllowedSender UDP, 192.168.0.0/16, 10.0.0.1
+                    allowed.push(...value.split(',').slice(1).map((s) => s.trim()).filter((s) => s.length > 0));
+                    break;
+                case '$includeconfig':
+                    warnings.push(`line ${line}: included files (${value}) must be imported separately`);
+                    break;
+                case '$modload':
+                case '$actionqueuetype':
+                case '$actionqueuefilename':
+                case '$actionqueuemaxdiskspace':
+                case '$actionqueuesaveonshutdown':
+                case '$actionresumeretrycount':
+                case '$workdirectory':
+                    break; // Handled implicitly (the collector has its own queueing)
+                default:
+                    break; // Local behaviour (file formats, permissions...) has no collector equivalent
+            }
+            continue;
+        }
+
+        // --- RainerScript objects ---
+        if (/^module\s*\(/.test(statement)) continue;
+
+        if (/^input\s*\(/.test(statement)) {
+            const params = objectParams(statement);
+            const protocol = LISTENER_INPUTS[params.type ?? ''];
+            if (!protocol) {
+                warnings.push(`line ${line}: input type "${params.type}" not supported`);
+                continue;
+            }
+            listeners.push({ protocol, port: Number(params.port ?? 514), address: params.address, line });
+            continue;
+        }
+
+        if (/^(ruleset|template|global|main_queue|lookup_table|parser)\s*\(/.test(statement)) {
+            if (statement.startsWith('ruleset')) {
+                warnings.push(`line ${line}: rulesets are not translated; review its filters manually`);
+            }
+            continue;
+        }
+
+        // --- & <action>: another action for the previous filter ---
+        if (statement.startsWith('&')) {
+            const filter = previousFilter;
+            handleAction(statement.slice(1), line, destinations, warnings, () =>
+                filter ? filter(line) : warnings.push(`line ${line}: "&" without a preceding filter`)
+            );
+            continue;
+        }
+        previousFilter = null;
+
+        // --- if <condition> then <action> ---
+        const ifMatch = /^if\s+([\s\S]+?)\s+then\s+([\s\S]+)$/.exec(statement);
+        if (ifMatch) {
+            const [, condition = '', action = ''] = ifMatch;
+            previousFilter = (at) => addRule(at, `if ${condition}`, parseCondition(condition));
+            handleAction(action, line, destinations, warnings, () => previousFilter!(line));
+            continue;
+        }
+
+        // --- :property, [!]compare-op, "value" <action> ---
+        const propertyMatch = /^:([\w-]+)\s*,\s*(!?)([\w_]+)\s*,\s*"((?:[^"\\]|\\.)*)"\s+([\s\S]+)$/.exec(statement);
+        if (propertyMatch) {
+            const [, property = '', negate, op = '', value = '', action = ''] = propertyMatch;
+            const description = `:${property}, ${negate}${op}, "${value}"`;
+            previousFilter = (at) => addRule(at, description, translate(property, op, value.replace(/\\(.)/g, '$1'), negate === '!'));
+            handleAction(action, line, destinations, warnings, () => previousFilter!(line));
+            continue;
+        }
+
+        // --- <facility.priority selector> <action> ---
+        const selectorMatch = /^(\S+)\s+([\s\S]+)$/.exec(statement);
+        if (selectorMatch) {
+            const [, selector = '', action = ''] = selectorMatch;
+            const everything = selector === '*.*';
+            previousFilter = (at) => {
+                warnings.push(`line ${at}: facility/priority filter "${selector}" not translated (drop rules match message content)`);
+            };
+            handleAction(action, line, destinations, warnings, () => previousFilter!(line));
+            if (!everything && isForward(action)) {
+                warnings.push(`line ${line}: only "${selector}" was forwarded; the collector forwards everything (add drop rules if needed)`);
+            }
+            continue;
+        }
+
+        warnings.push(`line ${line}: not understood: ${statement.slice(0, 80)}`);
+    }
+
+    const settings = listenerSettings(listeners, warnings);
+    if (allowed.length > 0) {
+        settings.ALLOWED_SOURCES = allowed.join(',');
+        settings.UNKNOWN_SOURCE_POLICY = 'reject';
+    }
+
+    return { format: 'rsyslog', settings, rules, destinations, warnings };
+}
+
+/**
+ * Run `onDrop` for discard actions; record forwarding targets.
+ * Other actions (files, pipes, databases) are local and ignored.
+ */
+function handleAction(action: string, line: number, destinations: string[], warnings: string[], onDrop: () => void): void {
+    const body = action.trim().replace(/^\{([\s\S]*)\}$/, '$1').trim();
+
+    if (body === 'stop' || body === '~') {
+        onDrop();
+        return;
+    }
+
+    const legacy = /^(@@?)(?:\([^)]*\))?\[?([\w.:-]+?)\]?(?::(\d+))?(?:;\S+)?$/.exec(body);
+    if (legacy) {
+        const [, at, host, port] = legacy;
+        destinations.push(`${at === '@@' ? 'tcp' : 'udp'}://${host}:${port ?? 514}`);
+        return;
+    }
+
+    if (/^action\s*\(/.test(body)) {
+        const params = objectParams(body);
+        if (params.type === 'omfwd') {
+            destinations.push(`${(params.protocol ?? 'udp').toLowerCase()}://${params.target}:${params.port ?? 514}`);
+        } else if (params.type === 'omrelp') {
+            destinations.push(`relp://${params.target}:${params.port ?? 514}`);
+        }
+        return;
+    }
+
+    if (/\bstop\b/.test(body)) {
+        warnings.push(`line ${line}: block with several actions not translated`);
+    }
+}
+
+function isForward(action: string): boolean {
+    return /^@|type\s*=\s*"om(fwd|relp)"/.test(action.trim());
+}
+
+/**
+ * `$msg contains 'x'`, `re_match($msg, 'x')`, `not (...)`, ...
+ */
+function parseCondition(condition: string): Match | string {
+    let expr = condition.trim();
+    let negate = false;
+
+    const not = /^not\s+\(?([\s\S]*?)\)?$/.exec(expr);
+    if (not) {
+        negate = true;
+        expr = not[1]!.trim();
+    }
+    expr = expr.replace(/^\(([\s\S]*)\)$/, '$1').trim();
+
+    if (/\s(and|or)\s/.test(expr)) {
+        return `compound condition "${condition}" not translated`;
+    }
+
+    const reMatch = /^re_match\(\s*\$([\w-]+)\s*,\s*(['"])([\s\S]*)\2\s*\)$/.exec(expr);
+    if (reMatch) {
+        return translate(reMatch[1]!, 'regex', reMatch[3]!, negate);
+    }
+
+    const compare = /^\$([\w-]+)\s+(contains_i|contains|startswith|==|!=)\s+(['"])([\s\S]*)\3$/.exec(expr);
+    if (compare) {
+        const [, property = '', op = '', , value = ''] = compare;
+        const mapped = op === '==' || op === '!=' ? 'isequal' : op;
+        return translate(property, mapped, value, negate !== (op === '!='));
+    }
+
+    return `condition "${condition}" not translated`;
+}
+
+/**
+ * Translate a property comparison into a drop rule match
+ */
+function translate(property: string, op: string, value: string, negate: boolean): Match | string {
+    const prop = property.toLowerCase();
+
+    if (prop === 'fromhost-ip') {
+        if (negate) return `negated source filter on ${property} not translated (use ALLOWED_SOURCES)`;
+        if (op === 'isequal' && net.isIP(value)) return { sources: [value] };
+        if (op === 'startswith') {
+            const cidr = prefixToCidr(value);
+            if (cidr) return { sources: [cidr] };
+        }
+        return `source filter ${property} ${op} "${value}" not translated`;
+    }
+
+    let pattern: string;
+    let flags = '';
+    if (prop === 'msg' || prop === 'rawmsg') {
+        switch (op) {
+            case 'contains': pattern = escapeRegex(value); break;
+            case 'contains_i': pattern = escapeRegex(value); flags = 'i'; break;
+            case 'startswith': pattern = prop === 'rawmsg' ? `^${escapeRegex(value)}` : escapeRegex(value); break;
+            case 'isequal': pattern = prop === 'rawmsg' ? `^${escapeRegex(value)}$` : `${escapeRegex(value)}$`; break;
+            case 'regex':
+            case 'ereregex': pattern = value; break;
+            default: return `comparison "${op}" on ${property} not translated`;
+        }
+    } else if (prop === 'programname' || prop === 'syslogtag') {
+        switch (op) {
+            case 'isequal': pattern = `\\s${escapeRegex(value.replace(/:$/, ''))}(?:\\[\\d+\\])?:`; break;
+            case 'startswith': pattern = `\\s${escapeRegex(value)}[^\\s:]*:`; break;
+            default: return `comparison "${op}" on ${property} not translated`;
+        }
+    } else {
+        return `property "${property}" not translated`;
+    }
+
+    return {
+        pattern: negate ? negatePattern(pattern) : pattern,
+        ...(flags && { flags }),
+    };
+}
+
+/**
+ * key="value" parameters of a RainerScript object, lower-cased keys
+ */
+function objectParams(text: string): Record<string, string> {
+    const params: Record<string, string> = {};
+    for (const [, key, value] of text.matchAll(/([\w.]+)\s*=\s*"([^"]*)"/g)) {
+        params[key!.toLowerCase()] = value!;
+    }
+    return params;
+}
+
+/**
+ * Split the config into logical statements: comments removed and lines
+ * joined while parentheses or braces are open.
+ */
+function statements(text: string): Statement[] {
+    const result: Statement[] = [];
+    let current = '';
+    let start = 0;
+    let depth = 0;
+
+    text.split('\n').forEach((raw, index) => {
+        const line = stripComment(raw).trim();
+        if (line === '') return;
+
+        if (current === '') start = index + 1;
+        current = current ? `${current}\n${line}` : line;
+        depth += count(line, /[({]/g) - count(line, /[)}]/g);
+        if (depth <= 0) {
+            result.push({ text: current, line: start });
+            current = '';
+            depth = 0;
+        }
+    });
+    if (current) result.push({ text: current, line: start });
+
+    return result;
+}
+
+function stripComment(line: string): string {
+    let quote: string | null = null;
+    for (let i = 0; i < line.length; i++) {
+        const c = line[i];
+        if (quote) {
+            if (c === '\\') i++;
+            else if (c === quote) quote = null;
+        } else if (c === '"' || c === "'") {
+            quote = c;
+        } else if (c === '#') {
+            return line.slice(0, i);
+        }
+    }
+    return line;
+}
+
+function count(text: string, pattern: RegExp): number {
+    return text.match(pattern)?.length ?? 0;
+}
@@ -0,0 +1,321 @@
+import {
+    lineAt,
+    listenerSettings,
+    negatePattern,
+    type ImportedRule,
+    type ImportResult,
+    type Listener,
+} from './types.js';
+
+interface Block {
+    kind: string;
+    name: string;
+    body: string;
+    offset: number; // Of the body, in the comment-stripped text
+}
+
+interface Call {
+    name: string;
+    args: string;
+    offset: number; // Relative to the text passed to calls()
+}
+
+type Term =
+    | { pattern: string; flags?: string }
+    | { netmask: string };
+
+const NETWORK_DRIVERS = new Set(['udp', 'tcp', 'udp6', 'tcp6', 'network', 'syslog']);
+
+/**
+ * Translate a syslog-ng configuration.
+ *
+ * - Network source drivers (udp/tcp/network/syslog) become listeners
+ * - Network destination drivers are reported as replaced destinations
+ * - Filters on the log path that forwards become drop rules for what the
+ *   filter excluded (or ALLOWED_SOURCES for a netmask() filter)
+ */
+export function importSyslogNg(input: string): ImportResult {
+    const text = stripComments(input);
+    const warnings: string[] = [];
+    const listeners: Listener[] = [];
+    const destinations: string[] = [];
+    const rules: ImportedRule[] = [];
+    const settings: Record<string, string> = {};
+
+    const forwarding = new Map<string, string[]>(); // destination name -> targets
+    const filters = new Map<string, Block>();
+    const logs: Block[] = [];
+
+    for (const block of blocks(text, warnings)) {
+        const line = lineAt(text, block.offset);
+
+        switch (block.kind) {
+            case 'source':
+                for (const call of calls(block.body)) {
+                    if (!NETWORK_DRIVERS.has(call.name)) continue;
+                    const listener = sourceListener(call);
+                    listeners.push({ ...listener, line: lineAt(text, block.offset + call.offset) });
+                    if (/\btls\b/.test(call.args)) {
+                        warnings.push(`line ${line}: TLS listener in source ${block.name} imported as plain ${listener.protocol}`);
+                    }
+                }
+                break;
+
+            case 'destination': {
+                const targets = calls(block.body)
+                    .filter((call) => NETWORK_DRIVERS.has(call.name))
+                    .map((call) => destinationTarget(call));
+                if (targets.length > 0) forwarding.set(block.name, targets);
+                break;
+            }
+
+            case 'filter':
+                filters.set(block.name, block);
+                break;
+
+            case 'log':
+                logs.push(block);
+                break;
+        }
+    }
+
+    // Only log paths that forward matter: the collector replaces the forwarding
+    const forwardingLogs = logs.filter((log) =>
+        calls(log.body).some((call) => call.name === 'destination' && forwarding.has(unquote(call.args)))
+    );
+
+    for (const log of forwardingLogs) {
+        for (const call of calls(log.body)) {
+            if (call.name === 'destination') destinations.push(...(forwarding.get(unquote(call.args)) ?? []));
+        }
+    }
+
+    const filtered = forwardingLogs.filter((log) => calls(log.body).some((call) => call.name === 'filter'));
+    if (filtered.length > 1 || (filtered.length === 1 && forwardingLogs.length > 1)) {
+        warnings.push('several log paths forward with different filters; filters not translated (everything will be forwarded)');
+    } else if (filtered.length === 1) {
+        const log = filtered[0]!;
+        for (const call of calls(log.body)) {
+            if (call.name === 'filter') {
+                const name = unquote(call.args);
+                const filter = filters.get(name);
+                const line = lineAt(text, filter?.offset ?? log.offset);
+                if (!filter) {
+                    warnings.push(`line ${line}: filter ${name} is not defined`);
+                    continue;
+                }
+                translateFilter(name, filter.body, line, rules, settings, warnings);
+            } else if (call.name === 'parser' || call.name === 'rewrite') {
+                warnings.push(`line ${lineAt(text, log.offset)}: ${call.name}() in log path not translated`);
+            }
+        }
+    }
+
+    return {
+        format: 'syslog-ng',
+        settings: { ...listenerSettings(listeners, warnings), ...settings },
+        rules,
+        destinations,
+        warnings,
+    };
+}
+
+/**
+ * Log path filter F forwarded only what matched F: drop the complement
+ */
+function translateFilter(
+    name: string,
+    expression: string,
+    line: number,
+    rules: ImportedRule[],
+    settings: Record<string, string>,
+    warnings: string[],
+): void {
+    let expr = expression.trim().replace(/;$/, '').trim();
+    let negate = false;
+
+    const not = /^not\s+([\s\S]+)$/.exec(expr);
+    if (not) {
+        negate = true;
+        expr = not[1]!.trim().replace(/^\(([\s\S]*)\)$/, '$1').trim();
+    }
+
+    const parsed = calls(expr);
+    const rest = expr.slice(parsed[0] ? parsed[0].offset + parsed[0].name.length + parsed[0].args.length + 2 : 0).trim();
+    if (parsed.length !== 1 || rest !== '') {
+        warnings.push(`line ${line}: filter ${name} (${expr}) not translated (only single conditions are supported)`);
+        return;
+    }
+
+    const term = filterTerm(parsed[0]!);
+    if (typeof term === 'string') {
+        warnings.push(`line ${line}: filter ${name}: ${term}`);
+        return;
+    }
+
+    const id = `syslog-ng-${name}`;
+    if ('netmask' in term) {
+        if (negate) {
+            rules.push({ id, description: `filter ${name}: not netmask(${term.netmask})`, action: 'drop', sources: [term.netmask] });
+        } else {
+            settings.ALLOWED_SOURCES = term.netmask;
+            settings.UNKNOWN_SOURCE_POLICY = 'reject';
+        }
+        return;
+    }
+
+    rules.push({
+        id,
+        description: `filter ${name}: ${negate ? 'not ' : ''}${parsed[0]!.name}(${parsed[0]!.args.trim()})`,
+        action: 'drop',
+        // Events matching a negated filter were excluded; otherwise everything else was
+        pattern: negate ? term.pattern : negatePattern(term.pattern),
+        ...(term.flags && { flags: term.flags }),
+    });
+}
+
+function filterTerm(call: Call): Term | string {
+    const flags = /flags\(\s*"?ignore-case"?\s*\)/.test(call.args) ? 'i' : undefined;
+    const value = /^\s*"((?:[^"\\]|\\.)*)"|^\s*'([^']*)'|^\s*([^\s)"']+)/.exec(call.args);
+    const argument = value ? (value[1]?.replace(/\\(["\\])/g, '$1') ?? value[2] ?? value[3] ?? '') : '';
+
+    switch (call.name) {
+        case 'message':
+            return { pattern: argument, flags };
+        case 'match': {
+            const field = /value\(\s*"?([\w.]+)"?\s*\)/.exec(call.args)?.[1];
+            if (field && field !== 'MESSAGE' && field !== 'MSG') return `match() on ${field} not translated`;
+            return { pattern: argument, flags };
+        }
+        case 'program':
+            return { pattern: `\\s(?:${argument})(?:\\[\\d+\\])?:`, flags };
+        case 'netmask':
+        case 'netmask6':
+            return { netmask: argument };
+        case 'host':
+            return { pattern: `\\s(?:${argument})\\s`, flags };
+        default:
+            return `${call.name}() not translated (drop rules match message content)`;
+    }
+}
+
+function sourceListener(call: Call): Omit<Listener, 'line'> {
+    const transport = option(call.args, 'transport')?.toLowerCase();
+    const protocol: 'udp' | 'tcp' = call.name.startsWith('udp') || transport === 'udp' ? 'udp' : 'tcp';
+    const defaultPort = call.name === 'syslog' ? 601 : 514;
+
+    return {
+        protocol,
+        port: Number(option(call.args, 'port') ?? defaultPort),
+        address: option(call.args, 'ip') ?? option(call.args, 'localip'),
+    };
+}
+
+function destinationTarget(call: Call): string {
+    const host = /^\s*"?([^"\s()]+)"?/.exec(call.args)?.[1] ?? '?';
+    const transport = option(call.args, 'transport')?.toLowerCase() ?? (call.name.startsWith('udp') ? 'udp' : 'tcp');
+    const port = option(call.args, 'port') ?? (call.name === 'syslog' ? '601' : '514');
+    return `${transport}://${host}:${port}`;
+}
+
+function option(args: string, name: string): string | undefined {
+    return new RegExp(`\\b${name}\\(\\s*"?([^"\\s)]+)"?\\s*\\)`).exec(args)?.[1];
+}
+
+function unquote(value: string): string {
+    return value.trim().replace(/^["']|["']$/g, '');
+}
+
+/**
+ * Top-level `kind [name] { ... };` blocks
+ */
+function blocks(text: string, warnings: string[]): Block[] {
+    const result: Block[] = [];
+    const header = /(@include\s+"[^"]*"|@\w+[^\n]*)|\b(source|destination|filter|log|parser|rewrite|template|options|block)\b\s*([\w-]*)\s*\{/g;
+
+    let match: RegExpExecArray | null;
+    while ((match = header.exec(text)) !== null) {
+        if (match[1]) {
+            if (match[1].startsWith('@include') && !match[1].includes('scl.conf')) {
+                warnings.push(`line ${lineAt(text, match.index)}: ${match[1]} must be imported separately`);
+            }
+            continue;
+        }
+
+        const open = header.lastIndex - 1;
+        const close = matching(text, open, '{', '}');
+        if (close < 0) {
+            warnings.push(`line ${lineAt(text, match.index)}: unterminated ${match[2]} block`);
+            break;
+        }
+
+        result.push({ kind: match[2]!, name: match[3] ?? '', body: text.slice(open + 1, close), offset: open + 1 });
+        header.lastIndex = close + 1;
+    }
+
+    return result;
+}
+
+/**
+ * Top-level `name(args)` calls in a block body
+ */
+function calls(text: string): Call[] {
+    const result: Call[] = [];
+    const start = /([\w-]+)\s*\(/g;
+
+    let match: RegExpExecArray | null;
+    while ((match = start.exec(text)) !== null) {
+        const open = start.lastIndex - 1;
+        const close = matching(text, open, '(', ')');
+        if (close < 0) break;
+
+        result.push({ name: match[1]!, args: text.slice(open + 1, close), offset: match.index });
+        start.lastIndex = close + 1;
+    }
+
+    return result;
+}
+
+/**
+ * Index of the bracket closing the one at `open`, skipping quoted strings
+ */
+function matching(text: string, open: number, left: string, right: string): number {
+    let depth = 0;
+    let quote: string | null = null;
+
+    for (let i = open; i < text.length; i++) {
+        const c = text[i];
+        if (quote) {
+            if (c === '\\') i++;
+            else if (c === quote) quote = null;
+        } else if (c === '"' || c === "'") {
+            quote = c;
+        } else if (c === left) {
+            depth++;
+        } else if (c === right && --depth === 0) {
+            return i;
+        }
+    }
+    return -1;
+}
+
+/**
+ * Remove # comments (outside strings), keeping line breaks so offsets map to lines
+ */
+function stripComments(text: string): string {
+    return text.split('\n').map((line) => {
+        let quote: string | null = null;
+        for (let i = 0; i < line.length; i++) {
+            const c = line[i];
+            if (quote) {
+                if (c === '\\') i++;
+                else if (c === quote) quote = null;
+            } else if (c === '"' || c === "'") {
+                quote = c;
+            } else if (c === '#') {
+                return line.slice(0, i);
+            }
+        }
+        return line;
+    }).join('\n');
+}
@@ -0,0 +1,93 @@
+/**
+ * Common result of translating a third-party syslog daemon configuration
+ * (rsyslog, syslog-ng) into collector settings.
+ */
+
+export interface ImportedRule {
+    id: string;
+    description: string;
+    action: 'drop';
+    pattern?: string;
+    flags?: string;
+    sources?: string[];
+}
+
+export interface ImportResult {
+    format: 'rsyslog' | 'syslog-ng';
+    settings: Record<string, string>; // CONFIG_FILE keys
+    rules: ImportedRule[]; // Rule set for the control channel (POST /v1/collector-rules)
+    destinations: string[]; // Forwarding targets the collector replaces
+    warnings: string[]; // Directives that could not be translated
+}
+
+export interface Listener {
+    protocol: 'udp' | 'tcp';
+    port: number;
+    address?: string;
+    line: number;
+}
+
+/**
+ * Turn the listeners found in a config into collector settings.
+ * The collector has one listener per protocol; extra ones are reported.
+ */
+export function listenerSettings(listeners: Listener[], warnings: string[]): Record<string, string> {
+    const settings: Record<string, string> = {
+        UDP_ENABLED: 'false',
+        TCP_ENABLED: 'false',
+    };
+
+    for (const protocol of ['udp', 'tcp'] as const) {
+        const [first, ...extra] = listeners.filter((l) => l.protocol === protocol);
+        if (!first) continue;
+
+        const prefix = protocol.toUpperCase();
+        settings[`${prefix}_ENABLED`] = 'true';
+        settings[`${prefix}_PORT`] = String(first.port);
+        if (first.address) settings[`${prefix}_BIND_ADDRESS`] = first.address;
+
+        for (const listener of extra) {
+            warnings.push(`line ${listener.line}: additional ${protocol} listener on port ${listener.port} not imported (one ${protocol} listener per collector)`);
+        }
+    }
+
+    return settings;
+}
+
+export function escapeRegex(value: string): string {
+    return value.replace(/[.*+?^${}()|[\]\\/]/g, '\\$&');
+}
+
+/**
+ * Pattern matching messages that do NOT match `pattern`
+ * (to drop what a forwarding filter used to exclude)
+ */
+export function negatePattern(pattern: string): string {
+    return `^(?![\\s\\S]*(?:${pattern}))`;
+}
+
+/**
+ * "192.168." style IP prefixes (rsyslog startswith) as a CIDR range
+ */
+export function prefixToCidr(prefix: string): string | null {
+    const octets = prefix.replace(/\.$/, '').split('.');
+    if (octets.length === 0 || octets.length > 4 || !octets.every((o) => /^\d{1,3}$/.test(o) && Number(o) <= 255)) {
+        return null;
+    }
+    if (octets.length < 4 && !prefix.endsWith('.')) return null;
+
+    const bits = octets.length * 8;
+    while (octets.length < 4) octets.push('0');
+    return `${octets.join('.')}/${bits}`;
+}
+
+/**
+ * 1-based line number of an offset in the source text
+ */
+export function lineAt(text: string, offset: number): number {
+    let line = 1;
+    for (let i = 0; i < offset && i < text.length; i++) {
+        if (text[i] === '\n') line++;
+    }
+    return line;
+}
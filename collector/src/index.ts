@@ -1,233 +1,231 @@
-import dgram from 'node:dgram';
-import { config } from './config.js';
-import { MessageBuffer, type SyslogEvent } from './buffer.js';
-import { HttpTransport } from './transport.js';
-import { TcpServer } from './tcp-server.js';
-import { HealthServer } from './health-server.js';
-import { metrics } from './metrics.js';
-
-async function main() {
-  console.log('🚀 Centinela Smart Collector v0.2.0 starting...');
-  console.log(`   Mode: ${config.NODE_ENV}`);
-  console.log(`   Target: ${config.CENTINELA_API_URL}`);
-  console.log(`   Collector: ${config.COLLECTOR_NAME}`);
-
-  // Core Components
-  const buffer = new MessageBuffer();
-  const transport = new HttpTransport();
-
-  // Optional: TCP Server
-  let tcpServer: TcpServer | null = null;
-  if (config.TCP_ENABLED) {
-    tcpServer = new TcpServer(buffer);
-  }
-
-  // Optional: UDP Server
-  let udpSocket: dgram.Socket | null = null;
-  if (config.UDP_ENABLED) {
-    udpSocket = dgram.createSocket('udp4');
-  }
-
-  // Health Check Server
-  let healthServer: HealthServer | null = null;
-  if (config.HEALTH_ENABLED) {
-    healthServer = new HealthServer({
-      getBufferStats: () => ({ size: buffer.size, dropped: buffer.dropped }),
-      getRetryStats: () => transport.getRetryStats(),
-      getTcpConnections: () => tcpServer?.connectionCount ?? 0,
-    });
-  }
+/**
+ * Centinela Collector entry point
+ *
+ * Usage:
+ *   collector [run] [flags]  Run the collector service (--udp-port 5514 = UDP_PORT=5514)
+ *   collector init           First-run setup: enroll, write the config, install the service
+ *   collector service        Install, start or remove the Windows service
+ *   collector supervise      Run several isolated collector instances (MSP appliances)
+ *   collector discover       Find collectors advertised via mDNS on the LAN
+ *   collector config diff    Show what a config reload would change (dry-run)
+ *   collector validate       Pre-flight check of the configuration, listeners and backend (--dry-post, --strict)
+ *   collector diagnose       Check DNS, proxy, TCP/TLS, clock and MTU on the way to the backend
+ *   collector maintenance    Pause forwarding and spool to disk for a bounded window
+ *   collector support-bundle Collect (or decrypt) an encrypted diagnostic bundle for support
+ *   collector dead-letter    Inspect or replay events the backend refused
+ *   collector search         Find events in the local dead-letter, spool, archive and WAL files
+ *   collector listeners      List, add or remove named listeners at runtime
+ *   collector vault reveal   Recover tokenized originals from the local token vault
+ *   collector import-config  Generate a collector config from rsyslog/syslog-ng
+ *   collector listen-debug   Print whatever a device sends (test target)
+ *   collector simulate       Run on generated traffic (demos, capacity tests)
+ *   collector --version      Print the version, commit and build date
+ *   collector --build-info   Print the same as JSON (fleet inventory)
+ *
+ * Subcommands are loaded lazily so tooling commands don't require the
+ * service configuration (e.g. CENTINELA_API_KEY) to be present.
+ */
+const argv = process.argv.slice(2);
+
+// Flags without a command run the service: collector --udp-port 5514
+const TOP_LEVEL_FLAGS = ['--help', '-h', '--version', '-v', '--build-info'];
+const [command, ...args] = argv[0]?.startsWith('-') && !TOP_LEVEL_FLAGS.includes(argv[0]) ? ['run', ...argv] : argv;
+
+function printUsage(): void {
+  console.log(`Usage: collector [command] [options]
+
+Commands:
+  run [--<setting> <value>...]
+              Run the collector service (default). Any setting can be given as a flag
+              (--udp-port 5514 for UDP_PORT, --tls-enabled, --no-tcp-enabled, --config-file <file>);
+              flags win over the environment and CONFIG_FILE
+  init [--token <token>] [--url <url>] [--group <group>] [--install-service] [--non-interactive]
+              Enroll this collector, write its config and API key, optionally install the service
+  service install|uninstall|start|stop|restart|status [--config <file>]
+              Run the collector as a Windows service (Linux: init --install-service)
+  supervise [--instances <file>]
+              Run several isolated collectors (one config each) with an admin API to control them
+  discover    Find collectors advertised via mDNS on the LAN
+  config diff Show what a config reload (SIGHUP) would change, without applying it
+  validate [--strict] [--dry-post] [--offline] [--json]
+              Pre-flight check: configuration, listener addresses and ports, backend name resolution;
+              --dry-post sends an authenticated test request the backend doesn't store;
+              --strict also reports best-practice warnings
+  diagnose [--timeout <ms>] [--json]
+              Check connectivity to the backend (DNS, proxy, TCP, TLS chain, API key, clock skew, MTU)
+  maintenance on|off|status [--duration 2h] [--reason <text>]
+              Stop forwarding for a window (events are spooled to disk and replayed after)
+  support-bundle [--output <file>] [--cpu-seconds 10] [--heap] [--passphrase <p>]
+              Collect logs, metrics, queues, config, stacks and a CPU profile in one encrypted file;
+              support-bundle decrypt <file> --key <private.pem> | --passphrase <p> opens one
+  dead-letter status|replay
+              Show the dead-letter file, or send its events again after fixing the cause
+  search [--from 2h] [--to <time>] [--source <ip|cidr|hostname>] [--grep <regex>] [--in <stores>] [--json] [file...]
+              Find events in the local dead-letter, spool, archive and WAL files ("did the device send it?")
+  listeners list|add <name:udp|tcp:port[:options]>|remove <name>
+              Show the named listeners, or open/close one without a restart
+  vault reveal <token...> --reason <text> --approved-by <name>
+              Recover the originals of tokenized values from the local token vault (audited)
+  import-config <file>
+              Generate a collector config and rule set from an rsyslog or syslog-ng config
+  listen-debug [--port 5140] [--protocol udp|tcp|both] [--hex] [--json]
+              Pretty-print whatever arrives (PRI, format, framing) without forwarding it
+  simulate [--profile mixed] [--eps 100] [--duration 10m] [--mock-backend] [--list]
+              Run the collector on generated firewall/Windows/Linux traffic, optionally to a local mock backend
+  help        Show this message
+
+Options:
+  --version     Print the version, commit and build date
+  --build-info  Print version, commit, build date and runtime as JSON`);
+}
 
-  // ============= UDP EVENT HANDLER =============
-  if (udpSocket) {
-    udpSocket.on('message', (msg, rinfo) => {
-      const event: SyslogEvent = {
-        raw_message: msg.toString('utf8'),
-        received_at: new Date().toISOString(),
-        source_ip: rinfo.address,
-      };
-
-      metrics.incrementReceived();
-
-      const added = buffer.push(event);
-      if (!added) {
-        metrics.incrementDropped();
-        if (buffer.dropped % 100 === 0) {
-          console.warn(`⚠️ Buffer full! Dropped ${buffer.dropped} events so far.`);
-        }
+async function main(): Promise<void> {
+  switch (command) {
+    case undefined:
+    case 'run': {
+      const { parseConfigFlags, setConfigFlags } = await import('./cli-flags.js');
+      try {
+        setConfigFlags(parseConfigFlags(args));
+      } catch (err) {
+        console.error(`${(err as Error).message}\n`);
+        printUsage();
+        process.exit(2);
       }
-    });
-
-    udpSocket.on('error', (err) => {
-      console.error(`❌ UDP Server Error:\n${err.stack}`);
-      udpSocket?.close();
-    });
-
-    udpSocket.on('listening', () => {
-      const address = udpSocket!.address();
-      console.log(`👂 UDP Syslog listening on udp://${address.address}:${address.port}`);
-    });
-
-    // Start UDP Server
-    udpSocket.bind(config.UDP_PORT, config.UDP_BIND_ADDRESS);
-  }
-
-  // ============= TCP SERVER =============
-  if (tcpServer) {
-    try {
-      await tcpServer.start();
-    } catch (err) {
-      console.error('❌ Failed to start TCP server:', err);
+      const { runCollector } = await import('./collector.js');
+      await runCollector();
+      break;
     }
-  }
 
-  // ============= HEALTH SERVER =============
-  if (healthServer) {
-    try {
-      await healthServer.start();
-    } catch (err) {
-      console.error('❌ Failed to start health server:', err);
+    case 'init': {
+      const { runInit } = await import('./commands/init.js');
+      await runInit(args);
+      break;
     }
-  }
-
-  // ============= MAIN FLUSH LOOP =============
-  const flushLoop = async () => {
-    // Process main buffer
-    if (!buffer.isEmpty()) {
-      const batch = buffer.popBatch(config.BATCH_SIZE);
-      const start = Date.now();
 
-      try {
-        await transport.sendBatch(batch);
-        const duration = Date.now() - start;
-
-        if (config.LOG_LEVEL === 'debug') {
-          const retryStats = transport.getRetryStats();
-          console.log(
-            `📤 Sent ${batch.length} events in ${duration}ms. ` +
-            `Buffer: ${buffer.size}, Retries: ${retryStats.pending}, DLQ: ${retryStats.dlq}`
-          );
-        }
-      } catch (err) {
-        console.error('❌ Flush error:', err);
-      }
+    case 'service': {
+      const { runService } = await import('./commands/service.js');
+      await runService(args);
+      break;
     }
 
-    // Schedule next flush
-    setTimeout(flushLoop, config.FLUSH_INTERVAL_MS);
-  };
-
-  // ============= RETRY PROCESSING LOOP =============
-  const retryLoop = async () => {
-    try {
-      await transport.processRetries();
-    } catch (err) {
-      console.error('❌ Retry processing error:', err);
+    case 'supervise': {
+      const { runSupervise } = await import('./commands/supervise.js');
+      await runSupervise(args);
+      break;
     }
 
-    // Schedule next retry check
-    setTimeout(retryLoop, config.RETRY_CHECK_INTERVAL_MS);
-  };
+    case 'discover': {
+      const { runDiscover } = await import('./commands/discover.js');
+      await runDiscover(args);
+      break;
+    }
 
-  // ============= PERIODIC STATUS LOG =============
-  const statusLoop = () => {
-    if (config.LOG_LEVEL !== 'debug' && config.LOG_LEVEL !== 'info') {
-      return;
+    case 'config': {
+      const { runConfig } = await import('./commands/config.js');
+      await runConfig(args);
+      break;
     }
 
-    const snapshot = metrics.getSnapshot();
-    const retryStats = transport.getRetryStats();
+    case 'validate': {
+      const { runValidate } = await import('./commands/validate.js');
+      await runValidate(args);
+      break;
+    }
 
-    // Only log if there's activity
-    if (snapshot.events.received > 0 || retryStats.pending > 0) {
-      console.log(
-        `📈 [${snapshot.uptime_human}] ` +
-        `Recv: ${snapshot.events.received} | ` +
-        `Sent: ${snapshot.events.sent} | ` +
-        `Failed: ${snapshot.events.failed} | ` +
-        `Retries: ${retryStats.pending} | ` +
-        `DLQ: ${retryStats.dlq} | ` +
-        `Rate: ${snapshot.rates.events_per_second}/s | ` +
-        `Success: ${snapshot.rates.success_rate}%`
-      );
+    case 'diagnose': {
+      const { runDiagnose } = await import('./commands/diagnose.js');
+      await runDiagnose(args);
+      break;
     }
 
-    setTimeout(statusLoop, 60000); // Log every minute
-  };
+    case 'maintenance': {
+      const { runMaintenance } = await import('./commands/maintenance.js');
+      await runMaintenance(args);
+      break;
+    }
 
-  // Start all loops
-  flushLoop();
-  retryLoop();
-  setTimeout(statusLoop, 60000); // First status log after 1 minute
+    case 'support-bundle': {
+      const { runSupportBundle } = await import('./commands/support-bundle.js');
+      await runSupportBundle(args);
+      break;
+    }
 
-  // ============= GRACEFUL SHUTDOWN =============
-  const shutdown = async () => {
-    console.log('\n🛑 Shutting down collector...');
+    case 'dead-letter': {
+      const { runDeadLetter } = await import('./commands/dead-letter.js');
+      await runDeadLetter(args);
+      break;
+    }
 
-    // Stop accepting new connections
-    if (tcpServer) {
-      await tcpServer.stop();
+    case 'search': {
+      const { runSearch } = await import('./commands/search.js');
+      await runSearch(args);
+      break;
     }
 
-    if (udpSocket) {
-      await new Promise<void>((resolve) => {
-        udpSocket!.close(() => {
-          console.log('   UDP socket closed.');
-          resolve();
-        });
-      });
+    case 'listeners': {
+      const { runListeners } = await import('./commands/listeners.js');
+      await runListeners(args);
+      break;
     }
 
-    // Flush remaining buffer
-    if (!buffer.isEmpty()) {
-      console.log(`   Flushing ${buffer.size} remaining events...`);
-      const remaining = buffer.popBatch(buffer.size);
-      try {
-        await transport.sendBatch(remaining);
-        console.log('   ✅ Buffer flushed.');
-      } catch (err) {
-        console.error('   ❌ Failed to flush buffer:', err);
-      }
+    case 'vault': {
+      const { runVault } = await import('./commands/vault.js');
+      await runVault(args);
+      break;
     }
 
-    // Process pending retries one last time
-    if (transport.hasPendingRetries()) {
-      console.log('   Processing pending retries...');
-      await transport.processRetries();
+    case 'import-config': {
+      const { runImportConfig } = await import('./commands/import-config.js');
+      await runImportConfig(args);
+      break;
     }
 
-    // Export any DLQ events
-    const dlqEvents = transport.exportDLQ();
-    if (dlqEvents.length > 0) {
-      console.warn(`   ⚠️ ${dlqEvents.length} events in DLQ will be lost.`);
-      // In production, you might want to write these to a file
+    case 'listen-debug': {
+      const { runListenDebug } = await import('./commands/listen-debug.js');
+      await runListenDebug(args);
+      break;
     }
 
-    // Stop health server
-    if (healthServer) {
-      await healthServer.stop();
+    case 'simulate': {
+      const { runSimulate } = await import('./commands/simulate.js');
+      await runSimulate(args);
+      break;
     }
 
-    // Final metrics
-    const finalMetrics = metrics.getSnapshot();
-    console.log(
-      `📊 Final stats: Received ${finalMetrics.events.received}, ` +
-      `Sent ${finalMetrics.events.sent}, ` +
-      `Failed ${finalMetrics.events.failed}, ` +
-      `Success rate: ${finalMetrics.rates.success_rate}%`
-    );
+    case '--version':
+    case '-v': {
+      const { buildInfo } = await import('./version.js');
+      const info = buildInfo();
+      console.log(`centinela-collector ${info.version} (commit ${info.commit}, built ${info.build_date}, node ${info.node} ${info.platform}/${info.arch})`);
+      break;
+    }
 
-    process.exit(0);
-  };
+    case '--build-info': {
+      const { buildInfo } = await import('./version.js');
+      console.log(JSON.stringify(buildInfo()));
+      break;
+    }
 
-  process.on('SIGINT', shutdown);
-  process.on('SIGTERM', shutdown);
+    case 'help':
+    case '--help':
+    case '-h':
+      printUsage();
+      break;
 
-  // Log startup complete
-  console.log('✅ Collector ready and listening for events.');
+    default:
+      console.error(`Unknown command: ${command}\n`);
+      printUsage();
+      process.exit(2);
+  }
 }
 
-main().catch((err) => {
-  console.error('💥 Fatal error:', err);
+main().catch(async (err) => {
+  // Commands load the configuration on first use (see loadConfig)
+  const { ConfigError } = await import('./config.js');
+  if (err instanceof ConfigError) {
+    console.error(`❌ ${err.message}`);
+  } else {
+    console.error('💥 Fatal error:', err);
+  }
   process.exit(1);
 });
@@ -0,0 +1,279 @@
+import os from 'node:os';
+import { spawn, type ChildProcess } from 'node:child_process';
+import { createInterface } from 'node:readline';
+import { readFile, writeFile, rename } from 'node:fs/promises';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { log } from './logger.js';
+
+const SAVE_INTERVAL_MS = 5000;
+const RESTART_DELAY_MS = 5000;
+const BACKPRESSURE_CHECK_MS = 1000;
+const MIN_BUFFER_AVAILABLE = 1000; // Reading pauses below this much room in the buffer
+const SD_ID = 'journal@32473'; // 32473: IANA example enterprise number (RFC 5612), as for centinela@32473
+const MAX_SD_NAME = 32; // RFC 5424 SD-NAME
+
+// journalctl -o json: repeated fields are arrays, binary values arrays of bytes
+type JournalValue = string | number[] | Array<string | number[]> | null;
+
+export interface JournaldInputStats {
+    running: boolean;
+    events: number;
+    restarts: number; // journalctl exited and was started again
+    paused: boolean; // Waiting for room in the buffer
+    last_entry_at: string | null;
+    last_error: string | null;
+}
+
+/**
+ * systemd Journal Input
+ *
+ * Follows the local journal (journalctl -o json), so a Linux host running the
+ * collector needs no rsyslog forwarding to localhost. Each entry becomes an
+ * RFC 5424 message with the entry's own priority, facility, identifier, PID,
+ * host and time; its other fields (_SYSTEMD_UNIT, _UID, _EXE, CODE_FILE...)
+ * are kept in a [journal@32473 ...] structured data element. JOURNALD_UNITS
+ * and JOURNALD_MIN_PRIORITY are passed to journalctl as filters. The
+ * collector's own entries are skipped.
+ *
+ * The cursor of the last entry sent is kept in JOURNALD_STATE_FILE, so a
+ * restart resumes right after it. Without a saved cursor reading starts at
+ * the end of the journal, or at its start with JOURNALD_READ_EXISTING. The
+ * system journal is readable by root and the systemd-journal/adm groups.
+ */
+export class JournaldInput {
+    private buffer: MessageBuffer;
+    private child: ChildProcess | null = null;
+    private cursor: string | null = null;
+    private savedCursor: string | null = null;
+    private saveTimer: NodeJS.Timeout | null = null;
+    private restartTimer: NodeJS.Timeout | null = null;
+    private resumeTimer: NodeJS.Timeout | null = null;
+    private isRunning = false;
+    private stats: Omit<JournaldInputStats, 'running' | 'paused'> = { events: 0, restarts: 0, last_entry_at: null, last_error: null };
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+    }
+
+    public async start(): Promise<void> {
+        this.cursor = await this.restoreState();
+        this.savedCursor = this.cursor;
+        this.isRunning = true;
+
+        log.info(`📓 Journal: following ${config.JOURNALD_DIRECTORY ?? 'the system journal'}` +
+            (config.JOURNALD_UNITS.length > 0 ? ` (${config.JOURNALD_UNITS.join(', ')})` : '') +
+            (this.cursor ? ' (resuming)' : config.JOURNALD_READ_EXISTING ? ' (with existing entries)' : ''));
+
+        this.spawn();
+        this.saveTimer = setInterval(() => void this.saveState(), SAVE_INTERVAL_MS);
+    }
+
+    public async stop(): Promise<void> {
+        this.isRunning = false;
+        for (const timer of [this.restartTimer, this.resumeTimer]) {
+            if (timer) clearTimeout(timer);
+        }
+        if (this.saveTimer) clearInterval(this.saveTimer);
+        this.restartTimer = this.resumeTimer = this.saveTimer = null;
+
+        // Entries not read yet stay after the saved cursor
+        const child = this.child;
+        if (child && child.exitCode === null && child.signalCode === null) {
+            await new Promise<void>((resolve) => {
+                child.once('exit', () => resolve());
+                child.stdout!.destroy();
+                child.kill('SIGTERM');
+            });
+        }
+        await this.saveState();
+        log.info('   Journal input stopped.');
+    }
+
+    public getStats(): JournaldInputStats {
+        return {
+            running: this.isRunning && this.child !== null,
+            paused: this.resumeTimer !== null,
+            ...this.stats,
+        };
+    }
+
+    private spawn(): void {
+        const args = ['--output=json', '--follow', '--no-pager', `--priority=${config.JOURNALD_MIN_PRIORITY}`];
+        if (config.JOURNALD_DIRECTORY) args.push(`--directory=${config.JOURNALD_DIRECTORY}`);
+        for (const unit of config.JOURNALD_UNITS) args.push(`--unit=${unit}`);
+        if (this.cursor) args.push(`--after-cursor=${this.cursor}`, '--no-tail');
+        else args.push(config.JOURNALD_READ_EXISTING ? '--no-tail' : '--lines=0');
+
+        const child = spawn('journalctl', args, { stdio: ['ignore', 'pipe', 'pipe'] });
+        this.child = child;
+        let stderr = '';
+        let entries = 0;
+
+        child.stderr!.setEncoding('utf8').on('data', (chunk: string) => {
+            stderr = (stderr + chunk).slice(-4096);
+        });
+
+        const lines = createInterface({ input: child.stdout!, crlfDelay: Infinity });
+        lines.on('line', (line) => {
+            entries++;
+            this.handleLine(line);
+            this.applyBackpressure(child);
+        });
+
+        child.on('error', (err) => {
+            if ((err as NodeJS.ErrnoException).code !== 'ENOENT') {
+                this.stats.last_error = err.message;
+                return;
+            }
+            this.stats.last_error = 'journalctl not found';
+            if (this.isRunning) log.error('❌ Journal input disabled: journalctl not found (systemd hosts only)');
+            this.isRunning = false;
+            this.child = null;
+        });
+
+        child.on('close', (code, signal) => {
+            if (this.child === child) this.child = null;
+            if (!this.isRunning) return;
+
+            const message = stderr.trim().split('\n').pop() || `exited with ${signal ?? code}`;
+            // A cursor from another journal (rotated away, machine-id changed) is dropped once
+            if (this.cursor && entries === 0 && /cursor/i.test(stderr)) {
+                log.warn(`⚠️ Journal cursor no longer valid, reading from ${config.JOURNALD_READ_EXISTING ? 'the start' : 'now on'}: ${message}`);
+                this.cursor = null;
+            } else {
+                log.error(`❌ journalctl ${message}; restarting in ${RESTART_DELAY_MS / 1000}s`);
+            }
+            this.stats.last_error = message;
+            this.stats.restarts++;
+            this.restartTimer = setTimeout(() => {
+                this.restartTimer = null;
+                if (this.isRunning) this.spawn();
+            }, RESTART_DELAY_MS);
+        });
+    }
+
+    // Stop reading while the buffer is nearly full; journalctl blocks on the pipe meanwhile
+    private applyBackpressure(child: ChildProcess): void {
+        if (this.resumeTimer || this.buffer.available >= MIN_BUFFER_AVAILABLE) return;
+
+        child.stdout!.pause();
+        const check = () => {
+            if (!this.isRunning || this.buffer.available >= MIN_BUFFER_AVAILABLE) {
+                this.resumeTimer = null;
+                child.stdout!.resume();
+            } else {
+                this.resumeTimer = setTimeout(check, BACKPRESSURE_CHECK_MS);
+            }
+        };
+        this.resumeTimer = setTimeout(check, BACKPRESSURE_CHECK_MS);
+    }
+
+    private handleLine(line: string): void {
+        let entry: Record<string, JournalValue>;
+        try {
+            entry = JSON.parse(line) as Record<string, JournalValue>;
+        } catch {
+            return;
+        }
+
+        const cursor = text(entry.__CURSOR);
+        if (cursor) this.cursor = cursor;
+        if (text(entry._PID) === String(process.pid)) return; // Our own output (running as a systemd service)
+
+        const realtimeUs = Number(text(entry.__REALTIME_TIMESTAMP));
+        const timestamp = Number.isFinite(realtimeUs) ? new Date(realtimeUs / 1000).toISOString() : new Date().toISOString();
+        const priority = code(text(entry.PRIORITY), 7, 6); // Default: info
+        const facility = code(text(entry.SYSLOG_FACILITY), 23, 3); // Default: daemon
+        const identifier = text(entry.SYSLOG_IDENTIFIER) ?? text(entry._COMM) ?? '-';
+        const pid = text(entry.SYSLOG_PID) ?? text(entry._PID) ?? '-';
+        const host = text(entry._HOSTNAME) ?? os.hostname();
+        const message = text(entry.MESSAGE) ?? '';
+
+        const raw = `<${facility * 8 + priority}>1 ${timestamp} ${header(host, 255)} ${header(identifier, 48)} ${header(pid, 128)} - ` +
+            `${structuredData(entry)} ${message}`;
+
+        const event = createSyslogEvent(raw, { address: '127.0.0.1' }, 'journald');
+        const unit = text(entry._SYSTEMD_UNIT);
+        if (unit) event.tags = { journald_unit: unit };
+        ingestEvent(this.buffer, event, { skipSourcePolicy: true });
+
+        this.stats.events++;
+        this.stats.last_entry_at = timestamp;
+    }
+
+    private async restoreState(): Promise<string | null> {
+        if (!config.JOURNALD_STATE_FILE) return null;
+
+        try {
+            const state = JSON.parse(await readFile(config.JOURNALD_STATE_FILE, 'utf8')) as { cursor?: unknown };
+            return typeof state.cursor === 'string' && state.cursor.length > 0 ? state.cursor : null;
+        } catch (err) {
+            if ((err as NodeJS.ErrnoException).code !== 'ENOENT') {
+                log.warn(`⚠️ Ignoring unreadable journal state ${config.JOURNALD_STATE_FILE}: ${(err as Error).message}`);
+            }
+            return null;
+        }
+    }
+
+    private async saveState(): Promise<void> {
+        if (!config.JOURNALD_STATE_FILE || this.cursor === null || this.cursor === this.savedCursor) return;
+
+        const cursor = this.cursor;
+        try {
+            const tmp = `${config.JOURNALD_STATE_FILE}.tmp`;
+            await writeFile(tmp, JSON.stringify({ cursor }));
+            await rename(tmp, config.JOURNALD_STATE_FILE);
+            this.savedCursor = cursor;
+        } catch (err) {
+            log.warn(`⚠️ Cannot save journal state: ${(err as Error).message}`);
+        }
+    }
+}
+
+/**
+ * The entry's fields other than the ones in the header and the journal's
+ * own (__CURSOR, __REALTIME_TIMESTAMP...), as a structured data element
+ */
+function structuredData(entry: Record<string, JournalValue>): string {
+    const header = new Set(['MESSAGE', 'PRIORITY', 'SYSLOG_FACILITY', 'SYSLOG_IDENTIFIER', 'SYSLOG_PID', '_HOSTNAME']);
+    const params: string[] = [];
+
+    for (const [name, value] of Object.entries(entry)) {
+        if (name.startsWith('__') || header.has(name)) continue;
+        if (config.JOURNALD_FIELDS.length > 0 && !config.JOURNALD_FIELDS.includes(name)) continue;
+
+        // Repeated fields become repeated params; binary values are left out
+        const values = Array.isArray(value) && value.some((item) => typeof item !== 'number') ? value : [value];
+        for (const item of values) {
+            const itemText = text(item as JournalValue);
+            if (itemText === undefined) continue;
+            params.push(`${name.slice(0, MAX_SD_NAME)}="${itemText.replace(/["\\\]]/g, '\\$&')}"`);
+        }
+    }
+    return params.length > 0 ? `[${SD_ID} ${params.join(' ')}]` : '-';
+}
+
+// String value of a field; binary values (byte arrays) only when they are valid UTF-8 text
+function text(value: JournalValue | undefined): string | undefined {
+    if (typeof value === 'string') return value;
+    if (Array.isArray(value) && value.every((item) => typeof item === 'number')) {
+        const decoded = Buffer.from(value as number[]).toString('utf8');
+        return decoded.includes('\ufffd') ? undefined : decoded;
+    }
+    return undefined;
+}
+
+// RFC 5424 header fields are printable ASCII without spaces
+function header(value: string, maxLength: number): string {
+    const cleaned = value.replace(/[^\x21-\x7e]/g, '_').slice(0, maxLength);
+    return cleaned.length > 0 ? cleaned : '-';
+}
+
+// PRIORITY / SYSLOG_FACILITY: an integer 0..max, else the fallback
+function code(value: string | undefined, max: number, fallback: number): number {
+    const parsed = Number(value);
+    return value !== undefined && Number.isInteger(parsed) && parsed >= 0 && parsed <= max ? parsed : fallback;
+}
@@ -0,0 +1,53 @@
+import { readFileSync } from 'node:fs';
+import type { Socket } from 'node:net';
+import type { Kafka, SASLOptions } from 'kafkajs';
+import { config } from './config.js';
+import { log } from './logger.js';
+import { parseSocksUrl, socksSocket } from './socks.js';
+
+export const KAFKA_REQUEST_TIMEOUT_MS = 30000;
+
+/**
+ * kafkajs client for KAFKA_BROKERS, shared by the Kafka output and input:
+ * TLS and SASL per KAFKA_TLS_* / KAFKA_SASL_*, broker connections through
+ * SOCKS_PROXY if set, kafkajs logs through the collector's logger. kafkajs
+ * is loaded on first use, so collectors without Kafka don't need it.
+ */
+export async function createKafkaClient(): Promise<Kafka> {
+    const { Kafka, logLevel } = await import('kafkajs');
+
+    const sasl: SASLOptions | undefined = config.KAFKA_SASL_MECHANISM === 'none'
+        ? undefined
+        : {
+            mechanism: config.KAFKA_SASL_MECHANISM,
+            username: config.KAFKA_SASL_USERNAME!,
+            password: config.KAFKA_SASL_PASSWORD!,
+        } as SASLOptions;
+
+    return new Kafka({
+        clientId: config.KAFKA_CLIENT_ID ?? config.COLLECTOR_NAME,
+        brokers: config.KAFKA_BROKERS,
+        ssl: config.KAFKA_TLS_ENABLED
+            ? {
+                ca: config.KAFKA_TLS_CA ? [readFileSync(config.KAFKA_TLS_CA)] : undefined,
+                cert: config.KAFKA_TLS_CERT ? readFileSync(config.KAFKA_TLS_CERT) : undefined,
+                key: config.KAFKA_TLS_KEY ? readFileSync(config.KAFKA_TLS_KEY) : undefined,
+            }
+            : false,
+        sasl,
+        // Broker connections through SOCKS_PROXY, TLS inside the tunnel
+        socketFactory: config.SOCKS_PROXY
+            ? (({ host, port, ssl, onConnect }) => socksSocket(parseSocksUrl(config.SOCKS_PROXY!), { host, port, tls: ssl, onConnect }) as Socket)
+            : undefined,
+        requestTimeout: KAFKA_REQUEST_TIMEOUT_MS,
+        // The transport's retry queue (output) or the consumer's restart (input) takes over after this
+        retry: { retries: 2 },
+        logLevel: logLevel.WARN,
+        logCreator: () => ({ level, log: entry }) => {
+            const message = `📨 Kafka: ${entry.message}`;
+            if (level <= logLevel.ERROR) log.error(message, { error: entry.error });
+            else if (level === logLevel.WARN) log.warn(message);
+            else log.debug(message);
+        },
+    });
+}
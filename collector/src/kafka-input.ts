@@ -0,0 +1,168 @@
+import type { Consumer, EachBatchPayload } from 'kafkajs';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { uuidv8 } from './event-id.js';
+import { ingestEvent } from './pipeline.js';
+import { wal } from './wal.js';
+import { createKafkaClient } from './kafka-client.js';
+import { log } from './logger.js';
+
+const BACKPRESSURE_CHECK_MS = 1000;
+const MIN_BUFFER_AVAILABLE = 1000; // Reading pauses below this much room in the buffer
+
+export interface KafkaInputStats {
+    running: boolean;
+    topics: string[];
+    group_id: string;
+    events: number;
+    skipped: number; // Read again while the write-ahead log still held them
+    commits: number;
+    paused: boolean; // Waiting for room in the buffer or the write-ahead log
+    last_commit_at: string | null;
+    last_error: string | null;
+}
+
+/**
+ * Kafka Input
+ *
+ * Bridges a customer's Kafka cluster to the collector: the messages of
+ * KAFKA_INPUT_TOPICS (read committed, consumer group KAFKA_INPUT_GROUP_ID,
+ * brokers and security as for the output, see kafka-client.ts) become events,
+ * one per message, the value as the raw message. Each event's event_id is
+ * derived from the message's position (group, topic, partition, offset), so
+ * a message read twice is the same event twice.
+ *
+ * Offsets are committed by hand, once per batch, only after the batch's
+ * events are on disk in the write-ahead log (written and fsynced; WAL_DIR is
+ * required): a crash before the commit reads the messages again, a crash
+ * after it replays them from the log, so nothing is lost. A message read
+ * again while the log still holds its event is skipped; one read again after
+ * its event was delivered (a crash between delivery and the commit) gets the
+ * same event_id, which the backend stores once.
+ *
+ * Reading pauses while the buffer is nearly full or the log is full
+ * (WAL_MAX_BYTES); the message that found it full is read again once there
+ * is room.
+ */
+export class KafkaInput {
+    private buffer: MessageBuffer;
+    private consumer: Consumer | null = null;
+    private resumeTimer: NodeJS.Timeout | null = null;
+    private isRunning = false;
+    private stats = { events: 0, skipped: 0, commits: 0, last_commit_at: null as string | null, last_error: null as string | null };
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+    }
+
+    public async start(): Promise<void> {
+        const kafka = await createKafkaClient();
+        const consumer = kafka.consumer({ groupId: config.KAFKA_INPUT_GROUP_ID, allowAutoTopicCreation: false });
+        consumer.on(consumer.events.CRASH, ({ payload }) => {
+            this.stats.last_error = payload.error.message;
+        });
+
+        this.consumer = consumer;
+        this.isRunning = true;
+        await consumer.connect();
+        await consumer.subscribe({ topics: config.KAFKA_INPUT_TOPICS, fromBeginning: config.KAFKA_INPUT_FROM_BEGINNING });
+        await consumer.run({
+            autoCommit: false,
+            eachBatchAutoResolve: false,
+            eachBatch: (payload) => this.handleBatch(payload),
+        });
+
+        log.info(`📨 Kafka input: ${config.KAFKA_INPUT_TOPICS.join(', ')} (group ${config.KAFKA_INPUT_GROUP_ID})`);
+    }
+
+    public async stop(): Promise<void> {
+        this.isRunning = false;
+        if (this.resumeTimer) clearTimeout(this.resumeTimer);
+        this.resumeTimer = null;
+
+        // Waits for the batch in progress, which commits what it put in the log
+        await this.consumer?.disconnect().catch(() => undefined);
+        this.consumer = null;
+        log.info('   Kafka input stopped.');
+    }
+
+    public getStats(): KafkaInputStats {
+        return {
+            running: this.isRunning && this.consumer !== null,
+            topics: config.KAFKA_INPUT_TOPICS,
+            group_id: config.KAFKA_INPUT_GROUP_ID,
+            paused: this.resumeTimer !== null,
+            ...this.stats,
+        };
+    }
+
+    private async handleBatch({ batch, resolveOffset, heartbeat, isRunning, isStale }: EachBatchPayload): Promise<void> {
+        const { topic, partition } = batch;
+        let committable: string | null = null; // Offset to commit: the one after the last message handled
+
+        for (const message of batch.messages) {
+            if (!isRunning() || isStale()) break;
+            if (this.mustWait()) {
+                this.pauseUntilRoom(topic, partition, message.offset);
+                break;
+            }
+
+            const eventId = uuidv8(`kafka:${config.KAFKA_INPUT_GROUP_ID}:${topic}:${partition}:${message.offset}`);
+            if (wal.holds(eventId)) {
+                this.stats.skipped++; // Recovered from the log, replayed from there
+            } else if (message.value && message.value.length > 0) {
+                const event = createSyslogEvent(message.value.toString('utf8'), { address: '127.0.0.1' }, 'kafka');
+                event.event_id = eventId;
+                event.tags = { kafka_topic: topic };
+                ingestEvent(this.buffer, event, { skipSourcePolicy: true });
+
+                // Kept in memory only: not committed, read again once the log has room
+                if (wal.isFull) {
+                    this.pauseUntilRoom(topic, partition, message.offset);
+                    break;
+                }
+                this.stats.events++;
+            }
+
+            resolveOffset(message.offset);
+            committable = (BigInt(message.offset) + 1n).toString();
+            await heartbeat();
+        }
+
+        if (committable === null) return;
+        try {
+            await wal.sync();
+            await this.consumer!.commitOffsets([{ topic, partition, offset: committable }]);
+            this.stats.commits++;
+            this.stats.last_commit_at = new Date().toISOString();
+        } catch (err) {
+            // Not committed: read again after a restart or a rebalance, with the same event IDs
+            this.stats.last_error = (err as Error).message;
+            log.warn(`⚠️ Kafka input: offsets of ${topic}/${partition} not committed: ${(err as Error).message}`);
+        }
+    }
+
+    private mustWait(): boolean {
+        return this.buffer.available < MIN_BUFFER_AVAILABLE || wal.isFull;
+    }
+
+    // Stop fetching until there is room; the partition is read again from `offset`
+    private pauseUntilRoom(topic: string, partition: number, offset: string): void {
+        const consumer = this.consumer!;
+        consumer.pause([{ topic, partitions: [partition] }]);
+        consumer.seek({ topic, partition, offset });
+
+        const check = () => {
+            // Room in the log is only known from the next append: try again after a while
+            if (!this.isRunning || this.buffer.available >= MIN_BUFFER_AVAILABLE) {
+                this.resumeTimer = null;
+                if (this.isRunning) consumer.resume([{ topic, partitions: [partition] }]);
+            } else {
+                this.resumeTimer = setTimeout(check, BACKPRESSURE_CHECK_MS);
+            }
+        };
+        if (this.resumeTimer) clearTimeout(this.resumeTimer);
+        this.resumeTimer = setTimeout(check, BACKPRESSURE_CHECK_MS);
+    }
+}
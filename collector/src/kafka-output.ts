@@ -0,0 +1,270 @@
+import type { Kafka, Message, Producer, ProducerRecord } from 'kafkajs';
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { buildIngestPayload, getSerializer } from './serializers.js';
+import { log } from './logger.js';
+import { eventContext } from './event-context.js';
+import { createKafkaClient, KAFKA_REQUEST_TIMEOUT_MS } from './kafka-client.js';
+
+const ACKS_ALL = -1; // Every in-sync replica; required by the idempotent producer
+const COMPRESSION = { none: 0, gzip: 1 } as const; // kafkajs CompressionTypes
+const MARKER_PARTITION = 0; // Transaction markers are committed as the offset of this partition of KAFKA_TOPIC
+
+export interface KafkaOutputStats {
+    brokers: string[];
+    topic: string;
+    connected: boolean;
+    transactional: boolean; // KAFKA_TRANSACTIONAL_ID
+    messages: number;
+    bytes: number;
+    errors: number;
+    uncertain_commits: number; // Commits that failed without saying whether they happened, resolved from the marker
+    last_error: string | null;
+}
+
+/**
+ * Kafka Output (OUTPUT_TYPE=kafka)
+ *
+ * Publishes events to the customer's own Kafka topic instead of the Centinela
+ * backend, one message per event: the ingest record (buildIngestPayload)
+ * serialized with KAFKA_FORMAT, keyed by KAFKA_MESSAGE_KEY, with the tenant,
+ * site, collector, event id and trace id as headers. The customer forwards
+ * the topic to the SaaS backend on their side.
+ *
+ * Only the request changes: the transport keeps its retry queue, DLQ, WAL and
+ * drain pacing, so a broker outage is handled like a backend outage. The
+ * producer (see kafka-client.ts) connects lazily and reconnects after a
+ * failure. Topics are never created automatically; the topic must exist.
+ *
+ * The producer is idempotent, with one request in flight per broker and
+ * acks from all in-sync replicas: a produce request kafkajs retries after a
+ * lost acknowledgement is not written twice, and a retry can't overtake the
+ * request behind it, so each device's events stay in order.
+ *
+ * With KAFKA_TRANSACTIONAL_ID each batch is also written in a transaction,
+ * one at a time: consumers reading with isolation.level=read_committed see
+ * a batch whole or not at all. The ID must be unique per collector; a second
+ * producer with the same ID fences off the first. Each transaction also
+ * commits its sequence number as the offset of consumer group
+ * <KAFKA_TRANSACTIONAL_ID>.commits (sendOffsets), atomically with the
+ * batch. A commit can fail without saying whether it happened (the
+ * coordinator answered too late); the producer is then recreated, which
+ * makes the coordinator finish or abort the transaction, and the marker
+ * tells which: if it was committed, the batch's events are dropped when the
+ * transport retries them instead of being written twice.
+ *
+ * With the Kafka input (see kafka-input.ts) the event_id is derived from the
+ * input message's position, so events read again after a collector crash
+ * keep the same event_id header and can be recognized downstream.
+ */
+export class KafkaOutput {
+    private producer: Producer | null = null;
+    private connecting: Promise<Producer> | null = null;
+    private kafka: Kafka | null = null;
+    private counters = { messages: 0, bytes: 0, errors: 0, uncertain_commits: 0 };
+    private lastError: string | null = null;
+    private transactions: Promise<unknown> = Promise.resolve(); // One open transaction per producer
+    private sequence: number | null = null; // Of the next transaction; read from the marker after (re)connecting
+    private uncertain: { sequence: number; eventIds: string[] } | null = null; // Commit failed, outcome not known yet
+    private alreadyWritten = new Set<string>(); // Committed although the commit failed: skipped once when retried
+
+    /**
+     * Publish a batch (one produce request). Throws if the brokers don't
+     * acknowledge it; the caller retries the whole batch.
+     */
+    public async send(events: SyslogEvent[], headers: Record<string, string> = {}): Promise<void> {
+        const serializer = getSerializer(config.KAFKA_FORMAT);
+        const messages = await Promise.all(events.map(async (event): Promise<Message> => {
+            const record = buildIngestPayload(event);
+            const value = await serializer.record(record);
+            return {
+                key: this.messageKey(event),
+                value,
+                timestamp: String(Date.parse(event.received_at) || Date.now()),
+                headers: Object.fromEntries(Object.entries({
+                    ...headers,
+                    'content-type': serializer.contentType,
+                    event_id: record.event_id,
+                    trace_id: eventContext(event).traceId,
+                    collector_name: record.collector_name,
+                    tenant_id: record.tenant_id,
+                    site_id: record.site_id,
+                }).filter((entry): entry is [string, string] => entry[1] !== undefined)),
+            };
+        }));
+
+        try {
+            if (config.KAFKA_TRANSACTIONAL_ID) {
+                await this.inTransaction(events.map((event) => event.event_id), messages);
+            } else {
+                const producer = await this.connect();
+                await producer.send(this.record(messages));
+                this.written(messages);
+            }
+            this.lastError = null;
+        } catch (err) {
+            this.counters.errors++;
+            this.lastError = (err as Error).message;
+            throw err;
+        }
+    }
+
+    public async close(): Promise<void> {
+        await this.disconnect();
+    }
+
+    public getStats(): KafkaOutputStats {
+        return {
+            brokers: config.KAFKA_BROKERS,
+            topic: config.KAFKA_TOPIC,
+            connected: this.producer !== null,
+            transactional: config.KAFKA_TRANSACTIONAL_ID !== undefined,
+            ...this.counters,
+            last_error: this.lastError,
+        };
+    }
+
+    private record(messages: Message[]): ProducerRecord {
+        return {
+            topic: config.KAFKA_TOPIC,
+            messages,
+            acks: ACKS_ALL,
+            compression: COMPRESSION[config.KAFKA_COMPRESSION],
+            timeout: KAFKA_REQUEST_TIMEOUT_MS,
+        };
+    }
+
+    private written(messages: Message[]): void {
+        this.counters.messages += messages.length;
+        for (const message of messages) this.counters.bytes += (message.value as Buffer).length;
+    }
+
+    /**
+     * Write a batch in its own transaction, after the previous one ended,
+     * with the transaction's marker. Events of an earlier transaction whose
+     * commit failed but happened are left out.
+     */
+    private inTransaction(eventIds: string[], messages: Message[]): Promise<void> {
+        const run = this.transactions.then(async () => {
+            await this.resolveUncertain();
+
+            const pendingIds = eventIds.filter((eventId) => !this.alreadyWritten.delete(eventId));
+            const pending = messages.filter((_, i) => pendingIds.includes(eventIds[i]!));
+            if (pending.length === 0) return;
+
+            const producer = await this.connect();
+            this.sequence ??= await this.committedSequence() + 1;
+            const sequence = this.sequence;
+            const transaction = await producer.transaction();
+            let committing = false;
+            try {
+                await transaction.send(this.record(pending));
+                await transaction.sendOffsets({
+                    consumerGroupId: this.markerGroup,
+                    topics: [{ topic: config.KAFKA_TOPIC, partitions: [{ partition: MARKER_PARTITION, offset: String(sequence) }] }],
+                });
+                committing = true;
+                await transaction.commit();
+            } catch (err) {
+                if (!committing) {
+                    await transaction.abort().catch(() => undefined);
+                    throw err;
+                }
+                // The commit may have happened: resolved before anything else is written
+                this.counters.uncertain_commits++;
+                this.uncertain = { sequence, eventIds: pendingIds };
+                await this.resolveUncertain().catch(() => undefined);
+                throw err;
+            }
+            this.sequence = sequence + 1;
+            this.written(pending);
+        });
+        this.transactions = run.catch(() => undefined);
+        return run;
+    }
+
+    /**
+     * Find out whether the transaction whose commit failed was committed: a
+     * new producer with the same transactional ID makes the coordinator
+     * complete or abort it, then its marker is read back. Throws (and stays
+     * unresolved) if the brokers can't be asked.
+     */
+    private async resolveUncertain(): Promise<void> {
+        const uncertain = this.uncertain;
+        if (!uncertain) return;
+
+        await this.disconnect();
+        await this.connect();
+        const committed = await this.committedSequence();
+        this.sequence = committed + 1;
+        this.uncertain = null;
+
+        if (committed >= uncertain.sequence) {
+            for (const eventId of uncertain.eventIds) this.alreadyWritten.add(eventId);
+            log.warn(`⚠️ Kafka: transaction ${uncertain.sequence} was committed although the commit failed; ` +
+                `its ${uncertain.eventIds.length} events won't be written again`);
+        }
+    }
+
+    private get markerGroup(): string {
+        return `${config.KAFKA_TRANSACTIONAL_ID}.commits`;
+    }
+
+    // Sequence number of the last committed transaction, -1 if none yet
+    private async committedSequence(): Promise<number> {
+        this.kafka ??= await createKafkaClient();
+        const admin = this.kafka.admin();
+        await admin.connect();
+        try {
+            const offsets = await admin.fetchOffsets({ groupId: this.markerGroup, topics: [config.KAFKA_TOPIC] });
+            const marker = offsets[0]?.partitions.find((partition) => partition.partition === MARKER_PARTITION);
+            return marker ? Number(marker.offset) : -1;
+        } finally {
+            await admin.disconnect().catch(() => undefined);
+        }
+    }
+
+    private messageKey(event: SyslogEvent): string | null {
+        switch (config.KAFKA_MESSAGE_KEY) {
+            case 'source_ip':
+                return event.source_ip;
+            case 'tenant_id':
+                return event.tenant_id ?? config.TENANT_ID ?? null;
+            case 'none':
+                return null;
+        }
+    }
+
+    private async connect(): Promise<Producer> {
+        if (this.producer) return this.producer;
+
+        this.connecting ??= (async () => {
+            this.kafka ??= await createKafkaClient();
+            const producer = this.kafka.producer({
+                allowAutoTopicCreation: false,
+                idempotent: true,
+                maxInFlightRequests: 1,
+                transactionalId: config.KAFKA_TRANSACTIONAL_ID,
+            });
+            producer.on(producer.events.DISCONNECT, () => {
+                if (this.producer === producer) this.producer = null;
+            });
+            await producer.connect();
+            log.info(`📨 Connected to Kafka (${config.KAFKA_BROKERS.join(', ')}), topic ${config.KAFKA_TOPIC}`);
+            this.producer = producer;
+            return producer;
+        })().finally(() => {
+            this.connecting = null;
+        });
+
+        return this.connecting;
+    }
+
+    private async disconnect(): Promise<void> {
+        const producer = this.producer;
+        this.producer = null;
+        this.connecting = null;
+        this.sequence = null;
+        await producer?.disconnect().catch(() => undefined);
+    }
+}
@@ -0,0 +1,198 @@
+import os from 'node:os';
+import { constants } from 'node:fs';
+import { open, readFile, writeFile, rename, type FileHandle } from 'node:fs/promises';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { log } from './logger.js';
+
+const POLL_INTERVAL_MS = 1000;
+const READ_BUFFER_BYTES = 8192; // One record per read(); longer ones fail with EINVAL
+const BOOT_ID_PATH = '/proc/sys/kernel/random/boot_id';
+
+const LEVELS = ['emerg', 'alert', 'crit', 'err', 'warning', 'notice', 'info', 'debug'] as const;
+
+export interface KmsgInputStats {
+    running: boolean;
+    path: string;
+    events: number;
+    caught_up: number; // Records from before the collector started (boot-time catch-up)
+    filtered: number; // Below KMSG_MIN_LEVEL
+    overwritten: number; // Records lost because the ring buffer wrapped before we read them
+    last_seq: number | null;
+}
+
+interface KmsgState {
+    boot_id: string;
+    seq: number;
+}
+
+/**
+ * Kernel Log Input (/dev/kmsg)
+ *
+ * Reads the kernel ring buffer at startup (what `dmesg` shows: boot messages
+ * from before syslogd was up) and then follows new records, so segfaults, OOM
+ * kills, netfilter LOG lines and other kernel security messages are captured
+ * even on hosts without a local syslog daemon. Needs root or CAP_SYSLOG.
+ *
+ * With KMSG_STATE_FILE the last record sent is remembered per boot, so a
+ * collector restart doesn't send the ring buffer again. Each record becomes
+ * an RFC 5424 message from "kernel" with its wall-clock time, sent as the
+ * collector's own host.
+ */
+export class KmsgInput {
+    private buffer: MessageBuffer;
+    private handle: FileHandle | null = null;
+    private timer: NodeJS.Timeout | null = null;
+    private reading = false;
+    private bootId = '';
+    private bootTimeMs = 0;
+    private startedUptimeUs = 0;
+    private lastSeq: number | null = null;
+    private savedSeq: number | null = null;
+    private resumed = false; // Restored a position from KMSG_STATE_FILE
+    private stats: Omit<KmsgInputStats, 'running' | 'path' | 'last_seq'> = { events: 0, caught_up: 0, filtered: 0, overwritten: 0 };
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+    }
+
+    public async start(): Promise<void> {
+        // Non-blocking: read() returns EAGAIN once caught up, so stop() never waits on a pending read
+        this.handle = await open(config.KMSG_PATH, constants.O_RDONLY | constants.O_NONBLOCK);
+
+        this.bootId = (await readFile(BOOT_ID_PATH, 'utf8').catch(() => '')).trim();
+        this.bootTimeMs = Date.now() - os.uptime() * 1000;
+        this.startedUptimeUs = os.uptime() * 1e6;
+        this.lastSeq = await this.restoreState();
+        this.resumed = this.lastSeq !== null;
+
+        log.info(`🐧 Kernel log: reading ${config.KMSG_PATH}` +
+            (this.resumed ? ` (resuming after record ${this.lastSeq})` : config.KMSG_CATCH_UP ? ' (with boot-time catch-up)' : ''));
+
+        await this.poll();
+        const tick = async () => {
+            await this.poll();
+            this.timer = setTimeout(tick, POLL_INTERVAL_MS);
+        };
+        this.timer = setTimeout(tick, POLL_INTERVAL_MS);
+    }
+
+    public async stop(): Promise<void> {
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+        await this.saveState();
+        await this.handle?.close();
+        this.handle = null;
+    }
+
+    public getStats(): KmsgInputStats {
+        return {
+            running: this.handle !== null,
+            path: config.KMSG_PATH,
+            ...this.stats,
+            last_seq: this.lastSeq,
+        };
+    }
+
+    // Read every record available now
+    private async poll(): Promise<void> {
+        if (this.reading || !this.handle) return;
+        this.reading = true;
+        const chunk = Buffer.alloc(READ_BUFFER_BYTES);
+
+        try {
+            for (;;) {
+                let bytesRead: number;
+                try {
+                    ({ bytesRead } = await this.handle.read(chunk, 0, chunk.length, null));
+                } catch (err) {
+                    const code = (err as NodeJS.ErrnoException).code;
+                    if (code === 'EAGAIN') break;
+                    if (code === 'EPIPE') {
+                        // The ring buffer wrapped past our position; reading continues at the oldest record
+                        this.stats.overwritten++;
+                        continue;
+                    }
+                    throw err;
+                }
+                if (bytesRead === 0) break;
+                this.handleRecord(chunk.toString('utf8', 0, bytesRead));
+            }
+            await this.saveState();
+        } catch (err) {
+            log.error(`❌ Kernel log read failed: ${(err as Error).message}`);
+        } finally {
+            this.reading = false;
+        }
+    }
+
+    /**
+     * "<prefix>;<message>\n[ KEY=value\n...]" where prefix is
+     * "priority,sequence,timestamp_us,flags[,...]"
+     */
+    private handleRecord(record: string): void {
+        const separator = record.indexOf(';');
+        if (separator < 0) return;
+
+        const [priority, seq, timestampUs] = record.slice(0, separator).split(',').map(Number);
+        if (!Number.isFinite(priority) || !Number.isFinite(seq) || !Number.isFinite(timestampUs)) return;
+        if (this.lastSeq !== null && seq! <= this.lastSeq) return; // Sent before a restart
+        this.lastSeq = seq!;
+
+        const fromBefore = timestampUs! < this.startedUptimeUs;
+        if (fromBefore && !config.KMSG_CATCH_UP && !this.resumed) return;
+
+        const level = priority! & 7;
+        if (level > LEVELS.indexOf(config.KMSG_MIN_LEVEL)) {
+            this.stats.filtered++;
+            return;
+        }
+
+        // Only the first line is the message; continuation lines are device properties
+        const message = record.slice(separator + 1).split('\n')[0]!;
+        const timestamp = new Date(this.bootTimeMs + timestampUs! / 1000).toISOString();
+        const raw = `<${priority}>1 ${timestamp} ${os.hostname()} kernel - - - ${message}`;
+
+        const event = createSyslogEvent(raw, { address: '127.0.0.1' }, 'kmsg');
+        event.tags = { kmsg_seq: String(seq) };
+        ingestEvent(this.buffer, event, { skipSourcePolicy: true });
+
+        this.stats.events++;
+        if (fromBefore) this.stats.caught_up++;
+    }
+
+    // Last record sent in this boot, if KMSG_STATE_FILE has one
+    private async restoreState(): Promise<number | null> {
+        if (!config.KMSG_STATE_FILE) return null;
+
+        try {
+            const state = JSON.parse(await readFile(config.KMSG_STATE_FILE, 'utf8')) as KmsgState;
+            if (state.boot_id !== this.bootId || !Number.isInteger(state.seq)) return null; // Rebooted since
+            this.savedSeq = state.seq;
+            return state.seq;
+        } catch (err) {
+            if ((err as NodeJS.ErrnoException).code !== 'ENOENT') {
+                log.warn(`⚠️ Ignoring unreadable kernel log state ${config.KMSG_STATE_FILE}: ${(err as Error).message}`);
+            }
+            return null;
+        }
+    }
+
+    private async saveState(): Promise<void> {
+        if (!config.KMSG_STATE_FILE || this.lastSeq === null || this.lastSeq === this.savedSeq) return;
+
+        const state: KmsgState = { boot_id: this.bootId, seq: this.lastSeq };
+        try {
+            const tmp = `${config.KMSG_STATE_FILE}.tmp`;
+            await writeFile(tmp, JSON.stringify(state));
+            await rename(tmp, config.KMSG_STATE_FILE);
+            this.savedSeq = this.lastSeq;
+        } catch (err) {
+            log.warn(`⚠️ Cannot save kernel log state: ${(err as Error).message}`);
+        }
+    }
+}
@@ -0,0 +1,242 @@
+import { readdir } from 'node:fs/promises';
+import { config } from './config.js';
+import { log } from './logger.js';
+
+const TREND_LOG_INTERVAL_MS = 3600000; // Resource trend in the log once an hour
+const CONSECUTIVE_BREACHES = 3; // Samples over a limit before acting: one spike is not a leak
+const MAX_RESTART_DEFER_MS = 3600000; // Waiting for a quiet moment to restart, at most this long
+
+/**
+ * Exit code of a restart requested by the watchdog (EX_TEMPFAIL): the
+ * shutdown is graceful, the non-zero code makes systemd (Restart=on-failure),
+ * Docker and the supervisor start the collector again
+ */
+export const WATCHDOG_RESTART_EXIT_CODE = 75;
+
+interface Sample {
+    at: number;
+    heapUsed: number;
+    rss: number;
+    fds: number | null; // null where /proc/self/fd doesn't exist
+    handles: number;
+}
+
+export interface LeakWatchdogStats {
+    enabled: boolean;
+    action: 'log' | 'restart';
+    samples: number;
+    window_seconds: number; // Covered by the samples kept
+    heap_used_bytes: number | null;
+    heap_growth_bytes_per_hour: number | null;
+    rss_bytes: number | null;
+    open_fds: number | null;
+    open_fds_growth_per_hour: number | null;
+    active_handles: number | null;
+    active_handles_growth_per_hour: number | null;
+    top_handles: Record<string, number>;
+    breach: string | null; // Limit currently exceeded
+    restart_pending_since: string | null;
+}
+
+/**
+ * Leak Watchdog (soak protection)
+ *
+ * Collectors on edge appliances run for months, and a slow leak (a socket
+ * never closed, a map never pruned) shows only as a gradual slowdown until
+ * someone notices. The watchdog samples the heap, open file descriptors and
+ * active libuv handles every LEAK_WATCHDOG_INTERVAL_MS, keeps
+ * LEAK_WATCHDOG_WINDOW_MS of samples and logs their trend once an hour.
+ *
+ * Growth is measured on the floor of the samples (the lowest of the first
+ * and of the last quarter of the window), so garbage collection's sawtooth
+ * and traffic bursts don't look like leaks. A limit (LEAK_HEAP_MAX_BYTES,
+ * LEAK_HEAP_GROWTH_MAX_BYTES_PER_HOUR, LEAK_FDS_MAX, LEAK_HANDLES_MAX) is
+ * breached after CONSECUTIVE_BREACHES samples over it; with
+ * LEAK_WATCHDOG_ACTION=restart the collector then shuts down gracefully
+ * (listeners closed, buffer flushed, WAL synced) and exits with
+ * WATCHDOG_RESTART_EXIT_CODE for its service manager to start it again. The
+ * restart waits for a quiet moment (no pending retries), for at most an hour.
+ * When a breach starts a support bundle is written first
+ * (SUPPORT_BUNDLE_ON_LEAK), so the evidence survives the restart.
+ */
+export class LeakWatchdog {
+    private samples: Sample[] = [];
+    private timer: NodeJS.Timeout | null = null;
+    private lastTrendLog = 0;
+    private breaches = new Map<string, number>(); // Limit -> consecutive samples over it
+    private breach: string | null = null;
+    private restartPendingSince: number | null = null;
+    private restartRequested = false;
+    private onRestart: ((reason: string) => void) | null = null;
+    private onBreach: ((reason: string) => Promise<unknown>) | null = null;
+    private breachHandled: Promise<unknown> | null = null;
+    private isQuiet: () => boolean = () => true;
+
+    public get enabled(): boolean {
+        return config.LEAK_WATCHDOG_INTERVAL_MS > 0;
+    }
+
+    /**
+     * @param options restart: graceful shutdown with WATCHDOG_RESTART_EXIT_CODE;
+     *                quiet: whether nothing would be lost by restarting now;
+     *                breach: called when a limit starts being breached (a restart waits for it)
+     */
+    public start(options: { restart: (reason: string) => void; quiet: () => boolean; breach?: (reason: string) => Promise<unknown> }): void {
+        if (!this.enabled || this.timer) return;
+        this.onRestart = options.restart;
+        this.onBreach = options.breach ?? null;
+        this.isQuiet = options.quiet;
+        this.lastTrendLog = Date.now();
+        this.timer = setInterval(() => void this.sample(), config.LEAK_WATCHDOG_INTERVAL_MS);
+        this.timer.unref();
+        void this.sample();
+    }
+
+    public stop(): void {
+        if (this.timer) clearInterval(this.timer);
+        this.timer = null;
+    }
+
+    public getStats(): LeakWatchdogStats {
+        const last = this.samples.at(-1);
+        const trend = this.trend();
+        return {
+            enabled: this.enabled,
+            action: config.LEAK_WATCHDOG_ACTION,
+            samples: this.samples.length,
+            window_seconds: this.samples.length > 1 ? Math.round((last!.at - this.samples[0]!.at) / 1000) : 0,
+            heap_used_bytes: last?.heapUsed ?? null,
+            heap_growth_bytes_per_hour: trend?.heap ?? null,
+            rss_bytes: last?.rss ?? null,
+            open_fds: last?.fds ?? null,
+            open_fds_growth_per_hour: trend?.fds ?? null,
+            active_handles: last?.handles ?? null,
+            active_handles_growth_per_hour: trend?.handles ?? null,
+            top_handles: topHandles(),
+            breach: this.breach,
+            restart_pending_since: this.restartPendingSince ? new Date(this.restartPendingSince).toISOString() : null,
+        };
+    }
+
+    private async sample(): Promise<void> {
+        const memory = process.memoryUsage();
+        const sample: Sample = {
+            at: Date.now(),
+            heapUsed: memory.heapUsed,
+            rss: memory.rss,
+            fds: await readdir('/proc/self/fd').then((entries) => entries.length, () => null),
+            handles: process.getActiveResourcesInfo().length,
+        };
+        this.samples.push(sample);
+        while (this.samples.length > 2 && sample.at - this.samples[0]!.at > config.LEAK_WATCHDOG_WINDOW_MS) {
+            this.samples.shift();
+        }
+
+        if (sample.at - this.lastTrendLog >= TREND_LOG_INTERVAL_MS) {
+            this.lastTrendLog = sample.at;
+            this.logTrend(sample);
+        }
+        await this.check(sample);
+    }
+
+    /**
+     * Growth per hour of the sample floors, once the window is at least a
+     * quarter full (null before)
+     */
+    private trend(): { heap: number; fds: number | null; handles: number } | null {
+        if (this.samples.length < 8) return null;
+        const span = this.samples.at(-1)!.at - this.samples[0]!.at;
+        if (span < config.LEAK_WATCHDOG_WINDOW_MS / 4) return null;
+
+        const quarter = Math.max(1, Math.floor(this.samples.length / 4));
+        const head = this.samples.slice(0, quarter);
+        const tail = this.samples.slice(-quarter);
+        const hours = (tail[0]!.at - head[0]!.at) / 3600000;
+        const floor = (samples: Sample[], value: (sample: Sample) => number | null) => {
+            const values = samples.map(value).filter((v): v is number => v !== null);
+            return values.length > 0 ? Math.min(...values) : null;
+        };
+        const growth = (value: (sample: Sample) => number | null) => {
+            const before = floor(head, value);
+            const after = floor(tail, value);
+            return before === null || after === null ? null : Math.round((after - before) / hours);
+        };
+
+        return {
+            heap: growth((sample) => sample.heapUsed)!,
+            fds: growth((sample) => sample.fds),
+            handles: growth((sample) => sample.handles)!,
+        };
+    }
+
+    private async check(sample: Sample): Promise<void> {
+        const trend = this.trend();
+        const limits: Array<[string, boolean]> = [
+            [`heap ${formatMiB(sample.heapUsed)} over LEAK_HEAP_MAX_BYTES`,
+                config.LEAK_HEAP_MAX_BYTES > 0 && sample.heapUsed > config.LEAK_HEAP_MAX_BYTES],
+            [`heap growing ${formatMiB(trend?.heap ?? 0)}/h, over LEAK_HEAP_GROWTH_MAX_BYTES_PER_HOUR`,
+                config.LEAK_HEAP_GROWTH_MAX_BYTES_PER_HOUR > 0 && trend !== null && trend.heap > config.LEAK_HEAP_GROWTH_MAX_BYTES_PER_HOUR],
+            [`${sample.fds} open file descriptors, over LEAK_FDS_MAX`,
+                config.LEAK_FDS_MAX > 0 && sample.fds !== null && sample.fds > config.LEAK_FDS_MAX],
+            [`${sample.handles} active handles, over LEAK_HANDLES_MAX`,
+                config.LEAK_HANDLES_MAX > 0 && sample.handles > config.LEAK_HANDLES_MAX],
+        ];
+
+        let breach: string | null = null;
+        limits.forEach(([description, exceeded], index) => {
+            const key = String(index);
+            const count = exceeded ? (this.breaches.get(key) ?? 0) + 1 : 0;
+            this.breaches.set(key, count);
+            if (count >= CONSECUTIVE_BREACHES) breach ??= description;
+        });
+
+        if (breach && !this.breach) {
+            log.warn(`🩺 LEAK WATCHDOG: ${breach}` +
+                (config.LEAK_WATCHDOG_ACTION === 'restart' ? '; restarting the collector once pending retries are delivered' : ''),
+                { heap_used: sample.heapUsed, open_fds: sample.fds, active_handles: sample.handles });
+            this.logTrend(sample);
+            this.breachHandled = this.onBreach?.(breach).catch(() => undefined) ?? null;
+        } else if (!breach && this.breach) {
+            log.info('🩺 Leak watchdog: back within limits');
+        }
+        this.breach = breach;
+
+        if (!breach || config.LEAK_WATCHDOG_ACTION !== 'restart' || this.restartRequested) {
+            this.restartPendingSince = null;
+            return;
+        }
+        this.restartPendingSince ??= sample.at;
+        if (!this.isQuiet() && sample.at - this.restartPendingSince < MAX_RESTART_DEFER_MS) return;
+
+        this.restartRequested = true;
+        await this.breachHandled;
+        this.onRestart?.(breach);
+    }
+
+    private logTrend(sample: Sample): void {
+        const trend = this.trend();
+        const rate = (value: number | null | undefined, format: (n: number) => string) =>
+            value === null || value === undefined ? '' : ` (${value >= 0 ? '+' : '-'}${format(Math.abs(value))}/h)`;
+        const handles = Object.entries(topHandles()).map(([type, count]) => `${type} ${count}`).join(', ');
+
+        log.info(
+            `🩺 Resources: heap ${formatMiB(sample.heapUsed)}${rate(trend?.heap, formatMiB)}, rss ${formatMiB(sample.rss)}, ` +
+            `fds ${sample.fds ?? 'n/a'}${rate(trend?.fds, String)}, handles ${sample.handles}${rate(trend?.handles, String)}` +
+            (handles ? ` [${handles}]` : ''),
+            { heap_used: sample.heapUsed, rss: sample.rss, open_fds: sample.fds, active_handles: sample.handles, heap_growth_per_hour: trend?.heap },
+        );
+    }
+}
+
+/** The most frequent kinds of active handles (TCPSocketWrap, Timeout, ...) */
+function topHandles(): Record<string, number> {
+    const counts = new Map<string, number>();
+    for (const type of process.getActiveResourcesInfo()) counts.set(type, (counts.get(type) ?? 0) + 1);
+    return Object.fromEntries([...counts].sort(([, a], [, b]) => b - a).slice(0, 5));
+}
+
+function formatMiB(bytes: number): string {
+    return `${(bytes / 1024 ** 2).toFixed(1)} MiB`;
+}
+
+export const leakWatchdog = new LeakWatchdog();
@@ -0,0 +1,53 @@
+/**
+ * Centinela Collector as a library
+ *
+ * The pieces of the collector for programs that embed it (e.g. an agent
+ * that runs the collector next to its own work) and for tests, grouped as
+ * config, listeners, pipeline and forwarding. Imported as
+ * "centinela-collector/lib"; unlike the CLI entry point (index.ts) it has no
+ * side effects of its own, and importing it doesn't read the configuration.
+ *
+ * The configuration comes from the environment (and CONFIG_FILE), as for the
+ * service: set process.env, then call loadConfig(), which throws ConfigError
+ * if it is invalid (resolveConfig() only checks it). Pieces that need the
+ * configuration load it on first use if loadConfig() wasn't called. Parsers
+ * (parseRfc5424, parseRfc3164) don't need it. runCollector() runs the whole
+ * service in this process and owns it (signal handlers, exit on shutdown);
+ * embed the pieces instead to keep control of the process.
+ */
+
+// Config
+export { config, loadConfig, ConfigError, resolveConfig, parseListener, parseSourceMapping, parseParserOverride, parseForwardingPolicy } from './config.js';
+export type { Config, ListenerSpec, SourceMapping, ParserOverride, ForwardingPolicy, BackendEndpoint } from './config.js';
+
+// Listeners
+export { UdpListener } from './udp-listener.js';
+export type { UdpSocketInfo } from './udp-listener.js';
+export { TcpServer } from './tcp-server.js';
+export type { TcpConnectionInfo } from './tcp-server.js';
+export { NamedListeners } from './named-listeners.js';
+export type { NamedListenerStatus, ListenerReconcileResult } from './named-listeners.js';
+
+// Pipeline
+export { MessageBuffer, batchPartition } from './buffer.js';
+export type { SyslogEvent, RelayHop, StreamChunk, SessionMeta } from './buffer.js';
+export { createSyslogEvent, parseSyslogFields } from './events.js';
+export { ingestEvent } from './pipeline.js';
+export { parseRfc5424 } from './parsers/rfc5424.js';
+export type { Rfc5424Message } from './parsers/rfc5424.js';
+export { parseRfc3164 } from './parsers/rfc3164.js';
+export type { Rfc3164Message, Rfc3164Options } from './parsers/rfc3164.js';
+export { forwardingPolicy } from './forwarding-policy.js';
+export type { ForwardingRoute } from './forwarding-policy.js';
+export { enrichmentCache } from './enrichment-cache.js';
+export type { EnrichmentNamespace, EnrichmentCacheStats } from './enrichment-cache.js';
+
+// Forwarding
+export { HttpTransport, HttpError } from './transport.js';
+export { ForwardPool } from './forward-pool.js';
+export { CircuitOpenError } from './circuit-breaker.js';
+export { buildIngestPayload, getSerializer } from './serializers.js';
+export type { IngestRecord, WireFormat } from './serializers.js';
+
+// The whole service
+export { runCollector } from './collector.js';
@@ -0,0 +1,72 @@
+import { CidrList } from './cidr.js';
+import { log } from './logger.js';
+
+export interface ListenerAclStats {
+    allow: number; // Entries
+    deny: number;
+    rejected: number; // Datagrams (UDP) or connections (TCP) refused
+}
+
+const registry = new Map<string, ListenerAcl>();
+
+/**
+ * Listener Source ACL
+ *
+ * Allow/deny lists of one listener (UDP_ALLOWED_SOURCES, named listener
+ * allow=/deny=, ...), checked when a datagram is read or a connection is
+ * accepted, before anything is parsed: an internet-exposed port only takes
+ * traffic from known customer ranges. The deny list wins; an empty allow list
+ * admits everyone else.
+ *
+ * Unlike ALLOWED_SOURCES (UNKNOWN_SOURCE_POLICY), refused traffic never becomes
+ * an event: it is only counted (listener_acl in /metrics).
+ */
+export class ListenerAcl {
+    private readonly name: string;
+    private readonly allow: CidrList;
+    private readonly deny: CidrList;
+    private rejected = 0;
+
+    constructor(name: string, allow: string[] = [], deny: string[] = []) {
+        this.name = name;
+        this.allow = new CidrList(allow);
+        this.deny = new CidrList(deny);
+        if (!this.allow.isEmpty || !this.deny.isEmpty) registry.set(name, this);
+    }
+
+    /**
+     * Whether traffic from this address may be read. Counts refusals.
+     */
+    public admits(address: string | undefined): boolean {
+        if (this.allow.isEmpty && this.deny.isEmpty) return true;
+
+        const ip = address ?? '';
+        if (!this.deny.contains(ip) && (this.allow.isEmpty || this.allow.contains(ip))) return true;
+
+        this.rejected++;
+        log.debug(`🚫 ${this.name}: refused traffic from ${ip || 'unknown peer'} (listener ACL)`, { listener: this.name, source_ip: ip });
+        return false;
+    }
+
+    /**
+     * The listener was removed: drop its stats
+     */
+    public dispose(): void {
+        if (registry.get(this.name) === this) registry.delete(this.name);
+    }
+
+    public getStats(): ListenerAclStats {
+        return {
+            allow: this.allow.entries.length,
+            deny: this.deny.entries.length,
+            rejected: this.rejected,
+        };
+    }
+}
+
+/**
+ * Stats of every listener with an ACL, by listener name
+ */
+export function getListenerAclStats(): Record<string, ListenerAclStats> {
+    return Object.fromEntries([...registry].map(([name, acl]) => [name, acl.getStats()]));
+}
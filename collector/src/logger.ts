@@ -0,0 +1,121 @@
+import pino, { type DestinationStream, type Logger as PinoLogger } from 'pino';
+import { config, type Config } from './config.js';
+
+export type LogLevel = 'debug' | 'info' | 'warn' | 'error';
+
+/**
+ * Context of a log record. Use the stable names where they apply, so the
+ * collector's own logs can be searched once ingested: listener, remote_addr
+ * (ip:port), source_ip, tenant_id, error.
+ */
+export type LogFields = Record<string, unknown>;
+
+export interface Logger {
+    debug(message: string, fields?: LogFields): void;
+    info(message: string, fields?: LogFields): void;
+    warn(message: string, fields?: LogFields): void;
+    error(message: string, fields?: LogFields): void;
+    /** Whether records of this level are written (to skip building costly messages) */
+    enabled(level: LogLevel): boolean;
+    /** A logger adding these fields to every record (e.g. { listener, remote_addr }) */
+    child(fields: LogFields): Logger;
+}
+
+const RECENT_RECORDS = 2000; // Kept in memory for support bundles
+
+const recent: string[] = []; // Ring of RECENT_RECORDS, recentNext is the oldest once full
+let recentNext = 0;
+
+// Leading emoji of the messages ("🔌 ", "⚠️ "), kept out of JSON records
+const LEADING_EMOJI = /^(?:\p{Extended_Pictographic}|️|‍)+\s*/u;
+
+let format: Config['LOG_FORMAT'] = 'text';
+
+// The record pino is writing: it calls the destination synchronously, within the log call
+let writing: { level: LogLevel; message: string } | null = null;
+
+/**
+ * Where pino's records go: the ring of recent records (JSON, whatever
+ * LOG_FORMAT is), then stdout, or stderr for warnings and errors
+ */
+const destination: DestinationStream = {
+    write(line: string): void {
+        recent[recentNext] = line.endsWith('\n') ? line.slice(0, -1) : line;
+        recentNext = (recentNext + 1) % RECENT_RECORDS;
+
+        const output = writing?.level === 'warn' || writing?.level === 'error' ? process.stderr : process.stdout;
+        output.write(format === 'json' || !writing ? line : `${writing.message}\n`);
+    },
+};
+
+function createPino(level: LogLevel, collector?: string): PinoLogger {
+    return pino({
+        level,
+        base: collector ? { collector } : null,
+        messageKey: 'msg',
+        timestamp: () => `,"ts":"${new Date().toISOString()}"`,
+        formatters: { level: (label) => ({ level: label }) },
+    }, destination);
+}
+
+// Info and text until configureLogger() runs (CLI commands, startup)
+let root = createPino('info');
+
+/**
+ * Collector Logger
+ *
+ * Leveled logging on pino, with two formats (LOG_FORMAT):
+ * - text: the human-readable lines ("⚠️ ... from 10.0.0.1:514"); the fields
+ *   are left out, messages already mention what matters to a reader
+ * - json: one JSON object per line (level, ts, collector, the fields and
+ *   msg), for log pipelines that ingest and search the collector's own logs
+ *
+ * Records below LOG_LEVEL are discarded. Modules log through `log` (or a
+ * child of it carrying listener, remote_addr, tenant_id...); the console is
+ * left to CLI commands.
+ */
+export const log: Logger = bind({});
+
+/**
+ * (Re)build the logger from LOG_LEVEL, LOG_FORMAT and COLLECTOR_NAME: once
+ * the configuration is loaded, and after a reload (both can change live)
+ */
+export function configureLogger(settings: Pick<Config, 'LOG_LEVEL' | 'LOG_FORMAT' | 'COLLECTOR_NAME'> = config): void {
+    format = settings.LOG_FORMAT;
+    root = createPino(settings.LOG_LEVEL, settings.COLLECTOR_NAME);
+}
+
+/**
+ * The last records written (as JSON lines, whatever LOG_FORMAT is), oldest first
+ */
+export function recentLogs(): string[] {
+    return [...recent.slice(recentNext), ...recent.slice(0, recentNext)];
+}
+
+function bind(bound: LogFields): Logger {
+    return {
+        debug: (message, fields) => write('debug', message, bound, fields),
+        info: (message, fields) => write('info', message, bound, fields),
+        warn: (message, fields) => write('warn', message, bound, fields),
+        error: (message, fields) => write('error', message, bound, fields),
+        enabled: (level) => root.isLevelEnabled(level),
+        child: (fields) => bind({ ...bound, ...fields }),
+    };
+}
+
+function write(level: LogLevel, message: string, bound: LogFields, fields: LogFields = {}): void {
+    if (!root.isLevelEnabled(level)) return;
+
+    // Errors as their message (JSON.stringify would write {})
+    const record: LogFields = { ...bound };
+    for (const [key, value] of Object.entries(fields)) {
+        record[key] = value instanceof Error ? value.message : value;
+    }
+
+    writing = { level, message };
+    try {
+        root[level](record, message.trim().replace(LEADING_EMOJI, ''));
+    } finally {
+        writing = null;
+    }
+}
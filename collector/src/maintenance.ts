@@ -0,0 +1,301 @@
+import path from 'node:path';
+import { appendFile, mkdir, open, readFile, rename, stat, unlink, writeFile } from 'node:fs/promises';
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { log } from './logger.js';
+
+const SPOOL_FILE = 'spool.ndjson';
+const STATE_FILE = 'state.json';
+const READ_CHUNK_BYTES = 8 * 1024 * 1024; // Larger than any spooled line (MAX_MESSAGE_BYTES, JSON-escaped)
+
+export type MaintenanceSource = 'local' | 'remote';
+
+export interface MaintenanceStats {
+    active: boolean;
+    started_at: string | null;
+    until: string | null;
+    remaining_seconds: number | null;
+    reason: string | null;
+    source: MaintenanceSource | null;
+    spooled: number; // Events on disk not yet replayed
+    spool_bytes: number;
+    replaying: boolean;
+    last_error: string | null;
+}
+
+interface MaintenanceWindow {
+    started_at: number;
+    until: number;
+    reason: string | null;
+    source: MaintenanceSource;
+}
+
+interface PersistedState {
+    window: MaintenanceWindow | null;
+    read_offset: number;
+    pending: number;
+}
+
+/**
+ * Parse "90s", "30m", "2h" or a number of milliseconds
+ */
+export function parseDuration(value: string | number): number | null {
+    if (typeof value === 'number') return Number.isInteger(value) && value > 0 ? value : null;
+
+    const match = /^(\d+)(ms|s|m|h)?$/.exec(value.trim());
+    if (!match) return null;
+    const units = { ms: 1, s: 1000, m: 60000, h: 3600000 };
+    const ms = Number(match[1]) * units[(match[2] ?? 'ms') as keyof typeof units];
+    return ms > 0 ? ms : null;
+}
+
+/**
+ * Maintenance Mode
+ *
+ * For backend-side migrations: for a bounded window nothing is forwarded
+ * (live events and retries alike); every event is spooled to disk under
+ * MAINTENANCE_SPOOL_DIR instead. When the window ends (explicitly, on
+ * expiry, or when the spool reaches MAINTENANCE_MAX_SPOOL_BYTES) the spool
+ * is replayed at the drain pace, live traffic first. The window and the
+ * replay position survive restarts.
+ *
+ * Toggled with `collector maintenance`, POST /maintenance on the health
+ * server, or by the backend through the control channel.
+ */
+export class MaintenanceMode {
+    private window: MaintenanceWindow | null = null;
+    private timer: NodeJS.Timeout | null = null;
+    private readOffset = 0;
+    private pending = 0;
+    private spoolBytes = 0;
+    private lastError: string | null = null;
+    private io: Promise<unknown> = Promise.resolve();
+
+    private get dir(): string {
+        return config.MAINTENANCE_SPOOL_DIR;
+    }
+
+    private get spoolPath(): string {
+        return path.join(this.dir, SPOOL_FILE);
+    }
+
+    public get active(): boolean {
+        return this.window !== null;
+    }
+
+    /**
+     * Spooled events waiting to be replayed
+     */
+    public get hasSpool(): boolean {
+        return this.pending > 0;
+    }
+
+    /**
+     * Resume a window (and the replay position) persisted before a restart
+     */
+    public async restore(): Promise<void> {
+        let state: PersistedState;
+        try {
+            state = JSON.parse(await readFile(path.join(this.dir, STATE_FILE), 'utf8')) as PersistedState;
+            this.spoolBytes = (await stat(this.spoolPath)).size;
+        } catch {
+            return; // Never used
+        }
+
+        this.readOffset = Math.min(state.read_offset, this.spoolBytes);
+        this.pending = this.readOffset < this.spoolBytes ? state.pending : 0;
+
+        if (state.window && state.window.until > Date.now()) {
+            this.window = state.window;
+            this.scheduleExpiry();
+            log.info(`🚧 Maintenance mode resumed until ${new Date(this.window.until).toISOString()} (${this.pending} events spooled)`);
+        } else if (this.pending > 0) {
+            log.info(`🚧 ${this.pending} events spooled during maintenance will be replayed`);
+        }
+        await this.persist();
+    }
+
+    /**
+     * Start (or extend) a maintenance window. The duration is capped at
+     * MAINTENANCE_MAX_DURATION_MS.
+     */
+    public async enable(options: { durationMs?: number; reason?: string; source: MaintenanceSource }): Promise<MaintenanceStats> {
+        const durationMs = Math.min(options.durationMs ?? config.MAINTENANCE_MAX_DURATION_MS, config.MAINTENANCE_MAX_DURATION_MS);
+
+        // Fail now rather than on the first spooled batch
+        await mkdir(this.dir, { recursive: true });
+
+        const now = Date.now();
+        this.window = {
+            started_at: this.window?.started_at ?? now,
+            until: now + durationMs,
+            reason: options.reason ?? null,
+            source: options.source,
+        };
+        this.lastError = null;
+        await this.persist();
+        this.scheduleExpiry();
+
+        log.info(`🚧 Maintenance mode on until ${new Date(this.window.until).toISOString()} ` +
+            `(${options.source}${this.window.reason ? `: ${this.window.reason}` : ''}): spooling to ${this.dir}, nothing is forwarded`);
+        return this.getStats();
+    }
+
+    /**
+     * End the window; spooled events are replayed from now on
+     */
+    public async disable(why = 'disabled'): Promise<MaintenanceStats> {
+        if (!this.window) return this.getStats();
+
+        this.window = null;
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+        await this.persist();
+
+        log.info(`✅ Maintenance mode off (${why}): forwarding resumed, replaying ${this.pending} spooled events`);
+        return this.getStats();
+    }
+
+    /**
+     * Write events to the spool (during a window, or while the backend's
+     * circuit is open). Returns false if they could not be spooled (spool
+     * full or disk error); maintenance then ends so the caller can forward
+     * them instead of losing them.
+     */
+    public spool(events: SyslogEvent[]): Promise<boolean> {
+        return this.exclusive(() => this.append(events));
+    }
+
+    /**
+     * Take up to `limit` spooled events for replay, oldest first. The spool
+     * file is removed once fully replayed.
+     */
+    public readSpool(limit: number): Promise<SyslogEvent[]> {
+        return this.exclusive(() => this.take(limit));
+    }
+
+    private async append(events: SyslogEvent[]): Promise<boolean> {
+        if (events.length === 0) return true;
+
+        const data = events.map((event) => JSON.stringify(event)).join('\n') + '\n';
+        const bytes = Buffer.byteLength(data);
+
+        if (this.spoolBytes + bytes > config.MAINTENANCE_MAX_SPOOL_BYTES) {
+            const error = `spool full (${config.MAINTENANCE_MAX_SPOOL_BYTES} bytes)`;
+            if (this.window || this.lastError !== error) {
+                log.error(`❌ Maintenance spool is full (MAINTENANCE_MAX_SPOOL_BYTES)${this.window ? ', ending maintenance early' : ''}`);
+            }
+            this.lastError = error;
+            await this.disable('spool full');
+            return false;
+        }
+
+        try {
+            if (this.spoolBytes === 0) await mkdir(this.dir, { recursive: true });
+            await appendFile(this.spoolPath, data);
+        } catch (err) {
+            this.lastError = (err as Error).message;
+            log.error(`❌ Cannot write maintenance spool: ${this.lastError}${this.window ? ', ending maintenance early' : ''}`);
+            await this.disable('spool error');
+            return false;
+        }
+
+        this.spoolBytes += bytes;
+        this.pending += events.length;
+        await this.persist();
+        return true;
+    }
+
+    private async take(limit: number): Promise<SyslogEvent[]> {
+        if (this.pending === 0 || limit < 1) return [];
+
+        const handle = await open(this.spoolPath, 'r');
+        let chunk: Buffer;
+        try {
+            chunk = Buffer.alloc(Math.min(READ_CHUNK_BYTES, this.spoolBytes - this.readOffset));
+            await handle.read(chunk, 0, chunk.length, this.readOffset);
+        } finally {
+            await handle.close();
+        }
+
+        const events: SyslogEvent[] = [];
+        let consumed = 0;
+        while (events.length < limit) {
+            const end = chunk.indexOf(0x0a, consumed);
+            if (end < 0) break;
+            try {
+                events.push(JSON.parse(chunk.toString('utf8', consumed, end)) as SyslogEvent);
+            } catch {
+                // Torn write from a crash: skip the line
+            }
+            consumed = end + 1;
+        }
+
+        this.readOffset += consumed;
+        this.pending = Math.max(0, this.pending - events.length);
+
+        if (this.readOffset >= this.spoolBytes && !this.window) {
+            await unlink(this.spoolPath).catch(() => undefined);
+            this.readOffset = 0;
+            this.spoolBytes = 0;
+            this.pending = 0;
+        }
+        await this.persist();
+        return events;
+    }
+
+    public getStats(): MaintenanceStats {
+        return {
+            active: this.window !== null,
+            started_at: this.window ? new Date(this.window.started_at).toISOString() : null,
+            until: this.window ? new Date(this.window.until).toISOString() : null,
+            remaining_seconds: this.window ? Math.max(0, Math.round((this.window.until - Date.now()) / 1000)) : null,
+            reason: this.window?.reason ?? null,
+            source: this.window?.source ?? null,
+            spooled: this.pending,
+            spool_bytes: this.spoolBytes - this.readOffset,
+            replaying: this.window === null && this.pending > 0,
+            last_error: this.lastError,
+        };
+    }
+
+    /**
+     * One spool operation at a time: a replay must not remove the file while
+     * events are being appended to it
+     */
+    private exclusive<T>(task: () => Promise<T>): Promise<T> {
+        const run = this.io.then(task);
+        this.io = run.catch(() => undefined);
+        return run;
+    }
+
+    private scheduleExpiry(): void {
+        if (this.timer) clearTimeout(this.timer);
+        const delay = this.window!.until - Date.now();
+        this.timer = setTimeout(() => {
+            this.timer = null;
+            void this.disable('window expired');
+        }, Math.max(0, delay));
+        this.timer.unref();
+    }
+
+    private async persist(): Promise<void> {
+        if (!this.window && this.pending === 0 && this.spoolBytes === 0) {
+            await unlink(path.join(this.dir, STATE_FILE)).catch(() => undefined);
+            return;
+        }
+
+        const state: PersistedState = { window: this.window, read_offset: this.readOffset, pending: this.pending };
+        const file = path.join(this.dir, STATE_FILE);
+        try {
+            await writeFile(`${file}.tmp`, JSON.stringify(state));
+            await rename(`${file}.tmp`, file);
+        } catch (err) {
+            this.lastError = (err as Error).message;
+        }
+    }
+}
+
+export const maintenance = new MaintenanceMode();
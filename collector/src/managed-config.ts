@@ -0,0 +1,99 @@
+import { readFileSync } from 'node:fs';
+import { rename, writeFile } from 'node:fs/promises';
+
+/**
+ * Backend-managed configuration layers
+ *
+ * With the control channel, the backend can push settings for every
+ * collector (global), for a fleet group (COLLECTOR_GROUP) and for this
+ * collector alone. Layers are merged in that order, each overriding the one
+ * before, and sit between the COLLECTOR_PROFILE defaults and the local
+ * configuration: CONFIG_FILE, the environment and flags still win, so a
+ * device can always be fixed locally. Settings that decide where and as
+ * whom the collector connects can't be managed (LOCAL_ONLY_SETTINGS).
+ *
+ * Kept free of the configuration so config.ts can merge the layers while
+ * resolving it; the control channel receives, validates and stores them.
+ */
+export const CONFIG_LAYERS = ['global', 'group', 'collector'] as const;
+
+export type ConfigLayerName = (typeof CONFIG_LAYERS)[number];
+
+export interface ConfigLayer {
+  layer: ConfigLayerName;
+  version: string;
+  settings: Record<string, string>; // Same keys and formats as the environment
+}
+
+// Where and as whom the collector connects, and where managed settings are kept
+export const LOCAL_ONLY_SETTINGS = new Set([
+  'CENTINELA_API_KEY', 'CENTINELA_API_KEY_FILE', 'CENTINELA_API_URL', 'BACKEND_ENDPOINTS', 'BACKEND_INGEST_URL_FAILOVER',
+  'BACKEND_TLS_CERT', 'BACKEND_TLS_KEY', 'BACKEND_TLS_CA', 'BACKEND_TLS_PINS', 'SOCKS_PROXY',
+  'COLLECTOR_NAME', 'COLLECTOR_ID', 'COLLECTOR_GROUP', 'TENANT_ID',
+  'CONTROL_CHANNEL_ENABLED', 'STATE_DIR', 'MANAGED_CONFIG_FILE',
+]);
+
+let layers: ConfigLayer[] = [];
+
+/**
+ * Read the config_layers of a control channel response:
+ * [{"layer": "group", "version": "7", "settings": {"BATCH_SIZE": 100}}, ...].
+ * Array values become comma-separated lists. Throws if it is malformed.
+ */
+export function parseConfigLayers(raw: unknown): ConfigLayer[] {
+  if (!Array.isArray(raw)) throw new Error('expected an array of layers');
+
+  const parsed = new Map<ConfigLayerName, ConfigLayer>();
+  for (const item of raw) {
+    const { layer, version, settings } = (item ?? {}) as { layer?: unknown; version?: unknown; settings?: unknown };
+    if (!CONFIG_LAYERS.includes(layer as ConfigLayerName)) {
+      throw new Error(`unknown layer ${JSON.stringify(layer)} (expected ${CONFIG_LAYERS.join(', ')})`);
+    }
+    if (typeof version !== 'string' && typeof version !== 'number') throw new Error(`${layer}: missing version`);
+    if (typeof settings !== 'object' || settings === null || Array.isArray(settings)) throw new Error(`${layer}: settings must be an object`);
+    if (parsed.has(layer as ConfigLayerName)) throw new Error(`${layer}: listed twice`);
+
+    const values: Record<string, string> = {};
+    for (const [key, value] of Object.entries(settings)) {
+      values[key] = Array.isArray(value) ? value.join(',') : String(value);
+    }
+    parsed.set(layer as ConfigLayerName, { layer: layer as ConfigLayerName, version: String(version), settings: values });
+  }
+  return CONFIG_LAYERS.flatMap((name) => parsed.get(name) ?? []);
+}
+
+/** Merge layers global -> group -> collector (later layers win) */
+export function mergeLayers(list: ConfigLayer[]): Record<string, string> {
+  return Object.assign({}, ...list.map((layer) => layer.settings)) as Record<string, string>;
+}
+
+/** Version of each layer in effect, e.g. { global: "12", group: "7" } */
+export function layerVersions(list: ConfigLayer[]): Partial<Record<ConfigLayerName, string>> {
+  return Object.fromEntries(list.map((layer) => [layer.layer, layer.version]));
+}
+
+/** The layers in effect (merged by resolveConfig) */
+export function managedLayers(): ConfigLayer[] {
+  return layers;
+}
+
+export function setManagedLayers(next: ConfigLayer[]): void {
+  layers = next;
+}
+
+/** The layers kept by an earlier run (MANAGED_CONFIG_FILE); none if there is no file */
+export function readManagedConfigFile(path: string): ConfigLayer[] {
+  let raw: string;
+  try {
+    raw = readFileSync(path, 'utf8');
+  } catch (err) {
+    if ((err as NodeJS.ErrnoException).code === 'ENOENT') return [];
+    throw err;
+  }
+  return parseConfigLayers(JSON.parse(raw));
+}
+
+export async function writeManagedConfigFile(path: string, list: ConfigLayer[]): Promise<void> {
+  await writeFile(`${path}.tmp`, `${JSON.stringify(list, null, 2)}\n`, { mode: 0o600 });
+  await rename(`${path}.tmp`, path);
+}
@@ -0,0 +1,467 @@
+import dgram from 'node:dgram';
+import os from 'node:os';
+import { randomBytes } from 'node:crypto';
+import { log } from './logger.js';
+
+const MDNS_ADDRESS = '224.0.0.251';
+const MDNS_PORT = 5353;
+const DEFAULT_TTL = 120;
+const LEGACY_UNICAST_TTL = 10; // RFC 6762 §6.7
+
+const TYPE_A = 1;
+const TYPE_PTR = 12;
+const TYPE_TXT = 16;
+const TYPE_SRV = 33;
+const TYPE_ANY = 255;
+const CLASS_IN = 1;
+const CACHE_FLUSH = 0x8000;
+
+export const SERVICE_TYPES = {
+    syslogUdp: '_syslog._udp.local',
+    syslogTcp: '_syslog._tcp.local',
+    syslogTls: '_syslog-tls._tcp.local',
+    relay: '_centinela-relay._tcp.local',
+} as const;
+
+const SERVICES_META = '_services._dns-sd._udp.local';
+
+// ============= DNS WIRE FORMAT =============
+
+interface Question {
+    name: string;
+    type: number;
+}
+
+interface ResourceRecord {
+    name: string;
+    type: number;
+    ttl: number;
+    flush?: boolean;
+    data: string | string[] | { port: number; target: string };
+}
+
+interface DnsMessage {
+    id: number;
+    isResponse: boolean;
+    questions: Question[];
+    records: ResourceRecord[];
+}
+
+function encodeName(name: string): Buffer {
+    const parts = name.split('.').filter((label) => label.length > 0);
+    const buffers = parts.map((label) => {
+        const bytes = Buffer.from(label, 'utf8');
+        return Buffer.concat([Buffer.from([Math.min(bytes.length, 63)]), bytes.subarray(0, 63)]);
+    });
+    return Buffer.concat([...buffers, Buffer.from([0])]);
+}
+
+function encodeRecord(record: ResourceRecord): Buffer {
+    let rdata: Buffer;
+
+    switch (record.type) {
+        case TYPE_PTR:
+            rdata = encodeName(record.data as string);
+            break;
+        case TYPE_SRV: {
+            const srv = record.data as { port: number; target: string };
+            const header = Buffer.alloc(6);
+            header.writeUInt16BE(0, 0); // priority
+            header.writeUInt16BE(0, 2); // weight
+            header.writeUInt16BE(srv.port, 4);
+            rdata = Buffer.concat([header, encodeName(srv.target)]);
+            break;
+        }
+        case TYPE_TXT: {
+            const entries = (record.data as string[]).map((entry) => {
+                const bytes = Buffer.from(entry, 'utf8').subarray(0, 255);
+                return Buffer.concat([Buffer.from([bytes.length]), bytes]);
+            });
+            rdata = entries.length > 0 ? Buffer.concat(entries) : Buffer.from([0]);
+            break;
+        }
+        case TYPE_A:
+            rdata = Buffer.from((record.data as string).split('.').map(Number));
+            break;
+        default:
+            rdata = Buffer.alloc(0);
+    }
+
+    const fixed = Buffer.alloc(10);
+    fixed.writeUInt16BE(record.type, 0);
+    fixed.writeUInt16BE(CLASS_IN | (record.flush ? CACHE_FLUSH : 0), 2);
+    fixed.writeUInt32BE(record.ttl, 4);
+    fixed.writeUInt16BE(rdata.length, 8);
+
+    return Buffer.concat([encodeName(record.name), fixed, rdata]);
+}
+
+function encodeMessage(message: DnsMessage, answerCount?: number): Buffer {
+    const header = Buffer.alloc(12);
+    header.writeUInt16BE(message.id, 0);
+    header.writeUInt16BE(message.isResponse ? 0x8400 : 0, 2); // QR + AA for responses
+    header.writeUInt16BE(message.questions.length, 4);
+    const answers = answerCount ?? message.records.length;
+    header.writeUInt16BE(answers, 6);
+    header.writeUInt16BE(0, 8);
+    header.writeUInt16BE(message.records.length - answers, 10);
+
+    const questions = message.questions.map((q) => {
+        const fixed = Buffer.alloc(4);
+        fixed.writeUInt16BE(q.type, 0);
+        fixed.writeUInt16BE(CLASS_IN, 2);
+        return Buffer.concat([encodeName(q.name), fixed]);
+    });
+
+    return Buffer.concat([header, ...questions, ...message.records.map(encodeRecord)]);
+}
+
+function readName(buf: Buffer, start: number): { name: string; offset: number } {
+    const labels: string[] = [];
+    let offset = start;
+    let end = -1;
+    let jumps = 0;
+
+    while (offset < buf.length) {
+        const length = buf[offset]!;
+
+        if (length === 0) {
+            offset++;
+            break;
+        }
+
+        // Compression pointer
+        if ((length & 0xc0) === 0xc0) {
+            if (++jumps > 16 || offset + 1 >= buf.length) throw new Error('Invalid name pointer');
+            if (end === -1) end = offset + 2;
+            offset = ((length & 0x3f) << 8) | buf[offset + 1]!;
+            continue;
+        }
+
+        labels.push(buf.toString('utf8', offset + 1, offset + 1 + length));
+        offset += length + 1;
+    }
+
+    return { name: labels.join('.'), offset: end === -1 ? offset : end };
+}
+
+function decodeMessage(buf: Buffer): DnsMessage {
+    if (buf.length < 12) throw new Error('Message too short');
+
+    const id = buf.readUInt16BE(0);
+    const flags = buf.readUInt16BE(2);
+    const qdcount = buf.readUInt16BE(4);
+    const rrcount = buf.readUInt16BE(6) + buf.readUInt16BE(8) + buf.readUInt16BE(10);
+
+    let offset = 12;
+    const questions: Question[] = [];
+    for (let i = 0; i < qdcount; i++) {
+        const { name, offset: next } = readName(buf, offset);
+        questions.push({ name, type: buf.readUInt16BE(next) });
+        offset = next + 4;
+    }
+
+    const records: ResourceRecord[] = [];
+    for (let i = 0; i < rrcount && offset < buf.length; i++) {
+        const { name, offset: next } = readName(buf, offset);
+        const type = buf.readUInt16BE(next);
+        const ttl = buf.readUInt32BE(next + 4);
+        const rdlength = buf.readUInt16BE(next + 8);
+        const rdataStart = next + 10;
+        offset = rdataStart + rdlength;
+
+        let data: ResourceRecord['data'];
+        switch (type) {
+            case TYPE_PTR:
+                data = readName(buf, rdataStart).name;
+                break;
+            case TYPE_SRV:
+                data = { port: buf.readUInt16BE(rdataStart + 4), target: readName(buf, rdataStart + 6).name };
+                break;
+            case TYPE_TXT: {
+                const entries: string[] = [];
+                let pos = rdataStart;
+                while (pos < offset) {
+                    const len = buf[pos]!;
+                    if (len > 0) entries.push(buf.toString('utf8', pos + 1, pos + 1 + len));
+                    pos += len + 1;
+                }
+                data = entries;
+                break;
+            }
+            case TYPE_A:
+                data = Array.from(buf.subarray(rdataStart, rdataStart + 4)).join('.');
+                break;
+            default:
+                continue;
+        }
+
+        records.push({ name, type, ttl, data });
+    }
+
+    return { id, isResponse: (flags & 0x8000) !== 0, questions, records };
+}
+
+// ============= ADVERTISER =============
+
+export interface AdvertisedService {
+    type: string; // e.g. _syslog._udp.local
+    port: number;
+}
+
+/**
+ * mDNS / DNS-SD Advertiser
+ *
+ * Announces this collector's listeners on the local network so devices and
+ * edge collectors can find it without IP bookkeeping:
+ * - Answers PTR/SRV/TXT/A queries for the advertised service types
+ * - Supports legacy unicast queries (used by `collector discover`)
+ * - Sends an announcement on start and a goodbye (TTL 0) on stop
+ */
+export class MdnsAdvertiser {
+    private socket: dgram.Socket | null = null;
+    private readonly instance: string;
+    private readonly hostname: string;
+    private readonly services: AdvertisedService[];
+    private readonly txt: string[];
+
+    constructor(options: { instanceName: string; services: AdvertisedService[]; txt: Record<string, string | undefined> }) {
+        this.instance = options.instanceName.replace(/\./g, '-');
+        this.hostname = `${os.hostname().split('.')[0]}.local`;
+        this.services = options.services;
+        this.txt = Object.entries(options.txt)
+            .filter(([, value]) => value !== undefined && value !== '')
+            .map(([key, value]) => `${key}=${value}`);
+    }
+
+    public start(): Promise<void> {
+        return new Promise((resolve, reject) => {
+            const socket = dgram.createSocket({ type: 'udp4', reuseAddr: true });
+
+            socket.on('message', (msg, rinfo) => this.handleQuery(msg, rinfo));
+            socket.on('error', (err) => {
+                log.error(`❌ mDNS Error: ${err.message}`);
+            });
+
+            socket.once('error', reject);
+            socket.bind(MDNS_PORT, () => {
+                try {
+                    socket.addMembership(MDNS_ADDRESS);
+                    socket.setMulticastTTL(255);
+                } catch (err) {
+                    reject(err);
+                    return;
+                }
+
+                this.socket = socket;
+                this.announce(DEFAULT_TTL);
+                log.info(
+                    `📣 mDNS advertising "${this.instance}" as ` +
+                    this.services.map((s) => `${s.type.replace('.local', '')}:${s.port}`).join(', ')
+                );
+                resolve();
+            });
+        });
+    }
+
+    public stop(): Promise<void> {
+        return new Promise((resolve) => {
+            if (!this.socket) {
+                resolve();
+                return;
+            }
+
+            // Goodbye packet so caches drop us immediately
+            this.announce(0);
+            const socket = this.socket;
+            this.socket = null;
+            setTimeout(() => socket.close(() => resolve()), 50);
+        });
+    }
+
+    private announce(ttl: number): void {
+        const records = this.services.flatMap((service) => this.recordsFor(service, ttl));
+        this.send({ id: 0, isResponse: true, questions: [], records }, MDNS_PORT, MDNS_ADDRESS);
+    }
+
+    private handleQuery(msg: Buffer, rinfo: dgram.RemoteInfo): void {
+        let query: DnsMessage;
+        try {
+            query = decodeMessage(msg);
+        } catch {
+            return; // Ignore malformed packets
+        }
+        if (query.isResponse || query.questions.length === 0) return;
+
+        const legacyUnicast = rinfo.port !== MDNS_PORT;
+        const ttl = legacyUnicast ? LEGACY_UNICAST_TTL : DEFAULT_TTL;
+        const answers: ResourceRecord[] = [];
+        const additionals: ResourceRecord[] = [];
+
+        for (const question of query.questions) {
+            const name = question.name.toLowerCase();
+            const wantsPtr = question.type === TYPE_PTR || question.type === TYPE_ANY;
+
+            if (name === SERVICES_META && wantsPtr) {
+                for (const service of this.services) {
+                    answers.push({ name: SERVICES_META, type: TYPE_PTR, ttl, data: service.type });
+                }
+                continue;
+            }
+
+            for (const service of this.services) {
+                const instanceName = `${this.instance}.${service.type}`;
+                if (name === service.type.toLowerCase() && wantsPtr) {
+                    const [ptr, ...rest] = this.recordsFor(service, ttl);
+                    answers.push(ptr!);
+                    additionals.push(...rest);
+                } else if (name === instanceName.toLowerCase()) {
+                    answers.push(...this.recordsFor(service, ttl).slice(1));
+                }
+            }
+
+            if (name === this.hostname.toLowerCase() && (question.type === TYPE_A || question.type === TYPE_ANY)) {
+                answers.push(...this.addressRecords(ttl));
+            }
+        }
+
+        if (answers.length === 0) return;
+
+        const response: DnsMessage = {
+            id: legacyUnicast ? query.id : 0,
+            isResponse: true,
+            questions: legacyUnicast ? query.questions : [],
+            records: [...answers, ...additionals],
+        };
+
+        if (legacyUnicast) {
+            this.send(response, rinfo.port, rinfo.address, answers.length);
+        } else {
+            this.send(response, MDNS_PORT, MDNS_ADDRESS, answers.length);
+        }
+    }
+
+    private recordsFor(service: AdvertisedService, ttl: number): ResourceRecord[] {
+        const instanceName = `${this.instance}.${service.type}`;
+        return [
+            { name: service.type, type: TYPE_PTR, ttl, data: instanceName },
+            { name: instanceName, type: TYPE_SRV, ttl, flush: true, data: { port: service.port, target: this.hostname } },
+            { name: instanceName, type: TYPE_TXT, ttl, flush: true, data: this.txt },
+            ...this.addressRecords(ttl),
+        ];
+    }
+
+    private addressRecords(ttl: number): ResourceRecord[] {
+        const records: ResourceRecord[] = [];
+        for (const addresses of Object.values(os.networkInterfaces())) {
+            for (const address of addresses ?? []) {
+                if (address.family === 'IPv4' && !address.internal) {
+                    records.push({ name: this.hostname, type: TYPE_A, ttl, flush: true, data: address.address });
+                }
+            }
+        }
+        return records;
+    }
+
+    private send(message: DnsMessage, port: number, address: string, answerCount?: number): void {
+        if (!this.socket) return;
+        const packet = encodeMessage(message, answerCount);
+        this.socket.send(packet, port, address);
+    }
+}
+
+// ============= DISCOVERY =============
+
+export interface DiscoveredService {
+    instance: string;
+    type: string;
+    host: string | null;
+    port: number | null;
+    addresses: string[];
+    txt: Record<string, string>;
+}
+
+/**
+ * Browse the LAN for advertised services using a one-shot (legacy unicast) mDNS query.
+ * Collects responses for `timeoutMs` and returns one entry per service instance.
+ */
+export function browse(serviceTypes: string[], timeoutMs: number): Promise<DiscoveredService[]> {
+    return new Promise((resolve, reject) => {
+        const socket = dgram.createSocket('udp4');
+        const records: ResourceRecord[] = [];
+
+        socket.on('message', (msg) => {
+            try {
+                const response = decodeMessage(msg);
+                if (response.isResponse) records.push(...response.records);
+            } catch {
+                // Ignore malformed responses
+            }
+        });
+
+        socket.once('error', reject);
+
+        socket.bind(0, () => {
+            const query: DnsMessage = {
+                id: randomBytes(2).readUInt16BE(0),
+                isResponse: false,
+                questions: serviceTypes.map((type) => ({ name: type, type: TYPE_PTR })),
+                records: [],
+            };
+            socket.setMulticastTTL(255);
+            socket.send(encodeMessage(query), MDNS_PORT, MDNS_ADDRESS);
+
+            setTimeout(() => {
+                socket.close();
+                resolve(assembleServices(serviceTypes, records));
+            }, timeoutMs);
+        });
+    });
+}
+
+function assembleServices(serviceTypes: string[], records: ResourceRecord[]): DiscoveredService[] {
+    const wanted = new Set(serviceTypes.map((type) => type.toLowerCase()));
+    const services = new Map<string, DiscoveredService>();
+
+    for (const record of records) {
+        if (record.type !== TYPE_PTR || !wanted.has(record.name.toLowerCase())) continue;
+        const instanceName = record.data as string;
+        if (services.has(instanceName.toLowerCase())) continue;
+
+        services.set(instanceName.toLowerCase(), {
+            instance: instanceName.slice(0, instanceName.length - record.name.length - 1),
+            type: record.name,
+            host: null,
+            port: null,
+            addresses: [],
+            txt: {},
+        });
+    }
+
+    for (const [key, service] of services) {
+        for (const record of records) {
+            if (record.name.toLowerCase() !== key) continue;
+
+            if (record.type === TYPE_SRV) {
+                const srv = record.data as { port: number; target: string };
+                service.host = srv.target;
+                service.port = srv.port;
+            } else if (record.type === TYPE_TXT) {
+                for (const entry of record.data as string[]) {
+                    const separator = entry.indexOf('=');
+                    if (separator > 0) service.txt[entry.slice(0, separator)] = entry.slice(separator + 1);
+                }
+            }
+        }
+
+        const addresses = new Set<string>();
+        for (const record of records) {
+            if (record.type === TYPE_A && service.host && record.name.toLowerCase() === service.host.toLowerCase()) {
+                addresses.add(record.data as string);
+            }
+        }
+        service.addresses = [...addresses];
+    }
+
+    return [...services.values()];
+}
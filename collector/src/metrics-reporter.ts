@@ -0,0 +1,97 @@
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { metrics, type MetricsSnapshot } from './metrics.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import type { UdpKernelStats } from './udp-stats.js';
+import { log } from './logger.js';
+
+/**
+ * Collector Metrics Events
+ *
+ * Every METRICS_EVENTS_INTERVAL_MS the internal counters are snapshotted and
+ * sent to the backend as a collector.metrics event, so tenants without
+ * Prometheus still get collector health history (throughput, drops, buffer
+ * and retry queue usage) in the SaaS. Counters are cumulative since start;
+ * `interval` holds the deltas since the previous snapshot.
+ */
+export class MetricsReporter {
+    private buffer: MessageBuffer;
+    private getRetryStats: () => { pending: number; dlq: number };
+    private getTcpConnections: () => number;
+    private getUdpKernelStats: () => UdpKernelStats | null;
+    private previous: { at: number; events: MetricsSnapshot['events'] } | null = null;
+    private timer: NodeJS.Timeout | null = null;
+
+    constructor(buffer: MessageBuffer, options: {
+        getRetryStats: () => { pending: number; dlq: number };
+        getTcpConnections: () => number;
+        getUdpKernelStats: () => UdpKernelStats | null;
+    }) {
+        this.buffer = buffer;
+        this.getRetryStats = options.getRetryStats;
+        this.getTcpConnections = options.getTcpConnections;
+        this.getUdpKernelStats = options.getUdpKernelStats;
+    }
+
+    public start(): void {
+        this.previous = { at: Date.now(), events: metrics.getSnapshot().events };
+        log.info(`📈 Sending collector metrics events every ${config.METRICS_EVENTS_INTERVAL_MS / 1000}s`);
+        this.schedule();
+    }
+
+    public stop(): void {
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+    }
+
+    private schedule(): void {
+        this.timer = setTimeout(() => {
+            this.report();
+            this.schedule();
+        }, config.METRICS_EVENTS_INTERVAL_MS);
+    }
+
+    private report(): void {
+        const now = Date.now();
+        const snapshot = metrics.getSnapshot();
+        const previous = this.previous ?? { at: now, events: snapshot.events };
+        this.previous = { at: now, events: snapshot.events };
+
+        const seconds = Math.max((now - previous.at) / 1000, 1);
+        const received = snapshot.events.received - previous.events.received;
+        const udp = this.getUdpKernelStats();
+
+        const record = {
+            metric: 'collector.metrics',
+            collector: config.COLLECTOR_NAME,
+            uptime_ms: snapshot.uptime_ms,
+            events: snapshot.events,
+            interval: {
+                seconds: Math.round(seconds),
+                received,
+                sent: snapshot.events.sent - previous.events.sent,
+                failed: snapshot.events.failed - previous.events.failed,
+                dropped: snapshot.events.dropped - previous.events.dropped,
+                events_per_second: Math.round(received / seconds * 100) / 100,
+            },
+            buffer: {
+                size: this.buffer.size,
+                max: config.MAX_BUFFER_SIZE,
+                usage_percent: Math.round(this.buffer.size / config.MAX_BUFFER_SIZE * 100),
+            },
+            retry_queue: this.getRetryStats(),
+            retries: snapshot.retries,
+            latency: snapshot.latency,
+            tcp_connections: this.getTcpConnections(),
+            ...(udp?.available && { udp_socket_drops: udp.socket_drops, udp_estimated_loss_percent: udp.estimated_loss_percent }),
+            memory_rss_bytes: process.memoryUsage.rss(),
+        };
+
+        const event = createSyslogEvent(JSON.stringify(record), { address: '127.0.0.1' }, 'internal');
+        event.tags = { collector_metrics: 'true' };
+        ingestEvent(this.buffer, event, { skipSourcePolicy: true });
+    }
+}
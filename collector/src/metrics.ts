@@ -12,6 +12,7 @@ class Metrics {
     private eventsSent = 0;
     private eventsFailed = 0;
     private eventsDropped = 0;
+    private eventsRejected = 0; // Refused individually by the backend (subset of failed)
 
     // Retry statistics
     private retryQueued = 0;
@@ -41,6 +42,10 @@ class Metrics {
         this.eventsFailed += count;
     }
 
+    public incrementRejected(count: number = 1): void {
+        this.eventsRejected += count;
+    }
+
     public incrementDropped(count: number = 1): void {
         this.eventsDropped += count;
     }
@@ -78,6 +83,7 @@ class Metrics {
                 sent: this.eventsSent,
                 failed: this.eventsFailed,
                 dropped: this.eventsDropped,
+                rejected: this.eventsRejected,
                 pending: this.eventsReceived - this.eventsSent - this.eventsFailed - this.eventsDropped,
             },
 
@@ -106,6 +112,7 @@ class Metrics {
         this.eventsSent = 0;
         this.eventsFailed = 0;
         this.eventsDropped = 0;
+        this.eventsRejected = 0;
         this.retryQueued = 0;
         this.retrySuccess = 0;
         this.dlqCount = 0;
@@ -135,6 +142,7 @@ export interface MetricsSnapshot {
         sent: number;
         failed: number;
         dropped: number;
+        rejected: number;
         pending: number;
     };
     retries: {
@@ -0,0 +1,211 @@
+import { readFileSync } from 'node:fs';
+import { config, parseMultilineRule, type Config, type MultilineRule } from './config.js';
+import { CidrList } from './cidr.js';
+import { globToRegExp } from './pickup/types.js';
+import { log } from './logger.js';
+
+export interface MultilineStats {
+    rules: number;
+    events: number; // Events made of more than one line
+    lines: number; // Lines joined into them
+    cut: number; // Events sent at a rule's max_lines or the message size limit
+    timed_out: number; // Events sent after a rule's timeout_ms without a new line
+}
+
+export interface CompiledMultilineRule extends MultilineRule {
+    startPattern: RegExp | null;
+    continuePattern: RegExp | null;
+    path?: RegExp; // file rules
+    senders?: CidrList | null; // tcp rules; null: any sender
+}
+
+type LineKind = 'start' | 'continue' | 'single';
+
+const counters = { events: 0, lines: 0, cut: 0, timed_out: 0 };
+
+/**
+ * Multiline Rules
+ *
+ * Java stack traces, Python tracebacks and similar events span many lines,
+ * and each line would otherwise arrive in the backend as a message of its
+ * own. Entries in MULTILINE_RULES and MULTILINE_RULES_FILE select files of
+ * the file tail input (file:<path glob>) or senders of the TCP and TLS
+ * listeners (tcp:<ip|cidr|*>), first matching entry wins, and say which lines
+ * belong together:
+ *   start=<regex>     a line matching it begins an event; others continue it
+ *   continue=<regex>  a line matching it continues the current event; others begin one
+ *   both              lines matching neither are events of their own
+ * The lines of an event are joined with newlines and sent once the next
+ * event begins, after max_lines lines or MAX_MESSAGE_BYTES x
+ * MAX_MESSAGE_PARTS bytes (then split like any long message), or after
+ * timeout_ms without a new line. Patterns see lines as received, so for
+ * syslog-framed senders they include the header.
+ */
+class MultilineRules {
+    private files: CompiledMultilineRule[] = [];
+    private senders: CompiledMultilineRule[] = [];
+
+    /**
+     * (Re)build the table from a configuration (at startup and on SIGHUP,
+     * which also picks up edits to MULTILINE_RULES_FILE). Throws if the file
+     * can't be read or has an invalid line; the current table is then kept.
+     * Open files and connections switch to the new rules with their next line.
+     */
+    public reload(settings: Pick<Config, 'MULTILINE_RULES' | 'MULTILINE_RULES_FILE'> = config): void {
+        const rules = [...settings.MULTILINE_RULES];
+        if (settings.MULTILINE_RULES_FILE) {
+            const lines = readFileSync(settings.MULTILINE_RULES_FILE, 'utf8').split('\n');
+            lines.forEach((line, index) => {
+                const content = line.replace(/(^|\s)#.*/, '').trim();
+                if (!content) return;
+                try {
+                    rules.push(parseMultilineRule(content));
+                } catch (err) {
+                    throw new Error(`${settings.MULTILINE_RULES_FILE}:${index + 1}: ${(err as Error).message}`);
+                }
+            });
+        }
+
+        const compiled = rules.map((rule): CompiledMultilineRule => ({
+            ...rule,
+            startPattern: rule.start ? new RegExp(rule.start) : null,
+            continuePattern: rule.continue ? new RegExp(rule.continue) : null,
+            ...(rule.input === 'file'
+                ? { path: globToRegExp(rule.match, process.platform === 'win32') }
+                : { senders: rule.match === '*' ? null : new CidrList([rule.match]) }),
+        }));
+        this.files = compiled.filter((rule) => rule.input === 'file');
+        this.senders = compiled.filter((rule) => rule.input === 'tcp');
+
+        if (compiled.length > 0) {
+            log.info(`🧩 Multiline rules: ${this.files.length} file pattern(s), ${this.senders.length} sender range(s)`);
+        }
+    }
+
+    /**
+     * Rule for a tailed file, if any
+     */
+    public forFile(path: string): CompiledMultilineRule | undefined {
+        return this.files.find((rule) => rule.path!.test(path));
+    }
+
+    /**
+     * Rule for a TCP/TLS sender, if any
+     */
+    public forAddress(ip: string): CompiledMultilineRule | undefined {
+        return this.senders.find((rule) => !rule.senders || rule.senders.contains(ip));
+    }
+
+    public getStats(): MultilineStats {
+        return { rules: this.files.length + this.senders.length, ...counters };
+    }
+}
+
+/**
+ * Joins the lines of one stream (a file, a connection) following a rule.
+ * Call flush() when the stream ends.
+ */
+export class MultilineAggregator {
+    public readonly rule: CompiledMultilineRule;
+    private readonly maxBytes: number;
+    private readonly emit: (text: string) => void;
+    private lines: string[] = [];
+    private bytes = 0; // UTF-8 length of the joined lines
+    private held = 0; // Input bytes of the lines not sent yet
+    private lastLineAt = 0;
+    private timer: NodeJS.Timeout | null = null;
+
+    /**
+     * @param maxBytes longest event (UTF-8); longer ones are cut before the line that doesn't fit
+     * @param emit     receives each event (one line, or lines joined with \n)
+     */
+    constructor(rule: CompiledMultilineRule, maxBytes: number, emit: (text: string) => void) {
+        this.rule = rule;
+        this.maxBytes = maxBytes;
+        this.emit = emit;
+    }
+
+    /**
+     * Input bytes of the lines held for the current event, so a saved file
+     * offset can leave them to be read again after a restart
+     */
+    public get heldBytes(): number {
+        return this.held;
+    }
+
+    /**
+     * @param inputBytes what the line took in the input, newline included
+     */
+    public push(line: string, inputBytes = 0): void {
+        const kind = this.classify(line);
+        const lineBytes = Buffer.byteLength(line, 'utf8');
+
+        if (kind === 'continue' && this.lines.length > 0) {
+            if (this.lines.length < this.rule.maxLines && this.bytes + 1 + lineBytes <= this.maxBytes) {
+                this.lines.push(line);
+                this.bytes += 1 + lineBytes;
+                this.held += inputBytes;
+                this.lastLineAt = Date.now();
+                return;
+            }
+            counters.cut++;
+        }
+
+        this.flush();
+        if (kind === 'single') {
+            this.emit(line);
+            return;
+        }
+
+        this.lines = [line];
+        this.bytes = lineBytes;
+        this.held = inputBytes;
+        this.lastLineAt = Date.now();
+        this.schedule(this.rule.timeoutMs);
+    }
+
+    /**
+     * Send the current event, if any
+     */
+    public flush(): void {
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+        if (this.lines.length === 0) return;
+
+        const lines = this.lines;
+        this.lines = [];
+        this.bytes = 0;
+        this.held = 0;
+        if (lines.length > 1) {
+            counters.events++;
+            counters.lines += lines.length;
+        }
+        this.emit(lines.join('\n'));
+    }
+
+    private classify(line: string): LineKind {
+        const { startPattern, continuePattern } = this.rule;
+        if (startPattern?.test(line)) return 'start';
+        if (continuePattern) return continuePattern.test(line) ? 'continue' : startPattern ? 'single' : 'start';
+        return 'continue';
+    }
+
+    // Timeout since the last line, not the first
+    private schedule(delayMs: number): void {
+        this.timer = setTimeout(() => {
+            this.timer = null;
+            const idle = Date.now() - this.lastLineAt;
+            if (idle < this.rule.timeoutMs) {
+                this.schedule(this.rule.timeoutMs - idle);
+                return;
+            }
+            counters.timed_out++;
+            this.flush();
+        }, delayMs);
+        this.timer.unref();
+    }
+}
+
+export const multilineRules = new MultilineRules();
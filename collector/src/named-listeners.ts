@@ -0,0 +1,259 @@
+import { config, listenerPortClashes, type ListenerSpec } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { TcpServer, type TcpConnectionInfo } from './tcp-server.js';
+import { UdpListener } from './udp-listener.js';
+import { ListenerAcl } from './listener-acl.js';
+import { ingestEvent } from './pipeline.js';
+import { createSyslogEvent } from './events.js';
+import { splitMessage } from './continuation.js';
+import { logStartError } from './bind-diagnostics.js';
+import { log } from './logger.js';
+
+export interface NamedListenerStatus {
+    name: string;
+    transport: 'udp' | 'tcp';
+    port: number;
+    listening: boolean;
+    tenant: string | null;
+    site: string | null;
+    source: string | null;
+    connections: number | null; // TCP only
+    origin: 'config' | 'admin'; // LISTENERS, or added through the admin API
+}
+
+export interface ListenerReconcileResult {
+    added: string[];
+    removed: string[];
+    updated: string[]; // Same port, new tenant/site/tags/ACL: no rebind
+    rebound: string[]; // Port or transport changed
+    failed: Array<{ name: string; error: string }>;
+}
+
+interface NamedListener {
+    spec: ListenerSpec;
+    origin: 'config' | 'admin';
+    udp: UdpListener | null;
+    udpAcl: ListenerAcl | null;
+    tcp: TcpServer | null;
+}
+
+/**
+ * Named Listeners (LISTENERS)
+ *
+ * Owns the sockets of the named listeners, so they can be added, changed and
+ * removed while the collector runs: onboarding a device type at a site is a
+ * config reload (or an admin API call), not a restart. Changes are applied
+ * per listener by name and never touch the others, nor UDP_PORT / TCP_PORT:
+ * - a new listener is bound; if its port can't be used it is reported, the
+ *   rest still applies, and binding is tried again at the next reload or
+ *   network change
+ * - a removed listener is closed (its TCP connections are dropped)
+ * - a listener whose tenant, site, source, tags or ACL changed keeps its
+ *   socket and connections; the new values apply to the next events
+ * - a listener whose transport or port changed is closed and bound again
+ *
+ * Listeners added through the admin API are not written anywhere: they last
+ * until a restart, and reloads keep them unless LISTENERS takes their name or
+ * port. Put them in LISTENERS (CONFIG_FILE) to keep them.
+ */
+export class NamedListeners {
+    private readonly buffer: MessageBuffer;
+    private listeners = new Map<string, NamedListener>();
+    private applying: Promise<unknown> = Promise.resolve(); // Changes are applied one at a time
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+    }
+
+    /**
+     * Make the running listeners match `specs` (startup and config reload)
+     */
+    public apply(specs: ListenerSpec[]): Promise<ListenerReconcileResult> {
+        return this.serialize(() => this.reconcile(specs));
+    }
+
+    /**
+     * Add one listener (admin API). Throws if the name or port is taken, or
+     * the port can't be bound.
+     */
+    public add(spec: ListenerSpec): Promise<NamedListenerStatus> {
+        return this.serialize(async () => {
+            if (this.listeners.has(spec.name)) throw new Error(`A listener named "${spec.name}" already exists`);
+            const clashes = listenerPortClashes({ ...config, LISTENERS: [...this.specs(), spec] });
+            if (clashes.length > 0) throw new Error(`Port ${clashes.join(', ')} is already used by another listener`);
+
+            const { listener, listening } = await this.open(spec, 'admin');
+            if (!listening) {
+                await this.close(listener);
+                throw new Error(`Cannot listen on ${spec.transport}/${spec.port} (see the collector log)`);
+            }
+            log.info(`➕ Listener ${spec.name} added (${spec.transport}/${spec.port})`);
+            return this.status(listener);
+        });
+    }
+
+    /**
+     * Remove one listener (admin API). Returns false if there is none by that name.
+     */
+    public remove(name: string): Promise<boolean> {
+        return this.serialize(async () => {
+            const listener = this.listeners.get(name);
+            if (!listener) return false;
+            await this.close(listener);
+            log.info(`➖ Listener ${name} removed`);
+            return true;
+        });
+    }
+
+    public list(): NamedListenerStatus[] {
+        return [...this.listeners.values()].map((listener) => this.status(listener));
+    }
+
+    public get connectionCount(): number {
+        let count = 0;
+        for (const listener of this.listeners.values()) count += listener.tcp?.connectionCount ?? 0;
+        return count;
+    }
+
+    public getConnectionDetails(): TcpConnectionInfo[] {
+        return [...this.listeners.values()].flatMap((listener) => listener.tcp?.getConnectionDetails() ?? []);
+    }
+
+    /**
+     * After a network change: bind the listeners that are down
+     */
+    public revalidate(addresses: Set<string>): void {
+        for (const listener of this.listeners.values()) {
+            listener.udp?.revalidate(addresses);
+            listener.tcp?.revalidate(addresses);
+        }
+    }
+
+    /**
+     * Close every listener (shutdown); TCP connections get `graceMs` to
+     * deliver what was already sent (see TcpServer.stop)
+     */
+    public stop(graceMs = 0): Promise<void> {
+        return this.serialize(async () => {
+            await Promise.all([...this.listeners.values()].map((listener) => this.close(listener, graceMs)));
+        });
+    }
+
+    private specs(): ListenerSpec[] {
+        return [...this.listeners.values()].map((listener) => listener.spec);
+    }
+
+    private async reconcile(specs: ListenerSpec[]): Promise<ListenerReconcileResult> {
+        const result: ListenerReconcileResult = { added: [], removed: [], updated: [], rebound: [], failed: [] };
+        const wanted = new Map(specs.map((spec) => [spec.name, spec]));
+
+        // Closed first, so a port moving from one listener to another is free
+        for (const listener of [...this.listeners.values()]) {
+            const spec = wanted.get(listener.spec.name);
+            const samePort = spec && spec.transport === listener.spec.transport && spec.port === listener.spec.port;
+            if (samePort && this.status(listener).listening) continue;
+            if (!spec && listener.origin === 'admin' &&
+                !specs.some((other) => other.transport === listener.spec.transport && other.port === listener.spec.port)) continue;
+            await this.close(listener);
+            // One that couldn't listen is simply tried again
+            if (!spec) result.removed.push(listener.spec.name);
+            else if (!samePort) result.rebound.push(spec.name);
+        }
+
+        for (const spec of specs) {
+            const existing = this.listeners.get(spec.name);
+            if (existing) {
+                existing.origin = 'config';
+                if (JSON.stringify(existing.spec) === JSON.stringify(spec)) continue;
+                this.update(existing, spec);
+                result.updated.push(spec.name);
+                continue;
+            }
+
+            // Kept even if it can't listen yet: bound after a network change (revalidate)
+            const { listening } = await this.open(spec, 'config');
+            if (!listening) {
+                result.failed.push({ name: spec.name, error: `cannot listen on ${spec.transport}/${spec.port}` });
+                result.rebound = result.rebound.filter((name) => name !== spec.name);
+            } else if (!result.rebound.includes(spec.name)) {
+                result.added.push(spec.name);
+            }
+        }
+        return result;
+    }
+
+    /**
+     * Register and bind a listener; `listening` is false (after logging why)
+     * if its port can't be used
+     */
+    private async open(spec: ListenerSpec, origin: 'config' | 'admin'): Promise<{ listener: NamedListener; listening: boolean }> {
+        const listener: NamedListener = { spec, origin, udp: null, udpAcl: null, tcp: null };
+        this.listeners.set(spec.name, listener);
+
+        if (spec.transport === 'udp') {
+            listener.udpAcl = new ListenerAcl(spec.name, spec.allow, spec.deny);
+            // Reads the listener's current definition, which update() may replace
+            listener.udp = new UdpListener({
+                label: `UDP (${spec.name})`,
+                port: spec.port,
+                bindAddress: config.UDP_BIND_ADDRESS,
+                onMessage: (msg, rinfo) => {
+                    if (!listener.udpAcl!.admits(rinfo.address)) return;
+                    const maxBytes = listener.spec.maxMessageBytes;
+                    const parts = maxBytes === undefined ? [{ text: msg.toString('utf8') }] : splitMessage(msg.toString('utf8'), maxBytes);
+                    for (const part of parts) {
+                        const event = createSyslogEvent(part.text, rinfo, 'udp');
+                        if (part.continuation) event.continuation = part.continuation;
+                        ingestEvent(this.buffer, event, { listener: listener.spec });
+                    }
+                },
+            });
+            return { listener, listening: await listener.udp.start() };
+        }
+
+        listener.tcp = new TcpServer(this.buffer, 'tcp', spec);
+        try {
+            await listener.tcp.start();
+            return { listener, listening: true };
+        } catch (err) {
+            logStartError('TCP listener', err);
+            return { listener, listening: false };
+        }
+    }
+
+    private update(listener: NamedListener, spec: ListenerSpec): void {
+        listener.spec = spec;
+        if (listener.udp) {
+            listener.udpAcl?.dispose();
+            listener.udpAcl = new ListenerAcl(spec.name, spec.allow, spec.deny);
+        }
+        listener.tcp?.update(spec);
+    }
+
+    private async close(listener: NamedListener, graceMs = 0): Promise<void> {
+        this.listeners.delete(listener.spec.name);
+        await listener.udp?.close();
+        listener.udpAcl?.dispose();
+        await listener.tcp?.stop(graceMs);
+    }
+
+    private status(listener: NamedListener): NamedListenerStatus {
+        return {
+            name: listener.spec.name,
+            transport: listener.spec.transport,
+            port: listener.spec.port,
+            listening: listener.udp ? listener.udp.isListening : listener.tcp?.listeningPort !== null,
+            tenant: listener.spec.tenant ?? null,
+            site: listener.spec.site ?? null,
+            source: listener.spec.source ?? null,
+            connections: listener.tcp ? listener.tcp.connectionCount : null,
+            origin: listener.origin,
+        };
+    }
+
+    private serialize<T>(task: () => Promise<T>): Promise<T> {
+        const run = this.applying.then(task);
+        this.applying = run.catch(() => undefined);
+        return run;
+    }
+}
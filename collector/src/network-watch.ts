@@ -0,0 +1,64 @@
+import os from 'node:os';
+import { config } from './config.js';
+import { log } from './logger.js';
+
+export interface NetworkChange {
+    added: string[];
+    removed: string[];
+    addresses: Set<string>; // Every local address now
+}
+
+/**
+ * Network Change Watcher
+ *
+ * Polls the host's interface addresses (NETWORK_WATCH_INTERVAL_MS) and
+ * reports when they change: a DHCP renew with a new lease, a VPN coming up or
+ * down, the edge router renumbering the LAN. Listeners use it to bind again
+ * and the transport to drop what it knew about the backend, so none of these
+ * need a collector restart.
+ */
+export class NetworkWatcher {
+    private readonly onChange: (change: NetworkChange) => void;
+    private addresses = localAddresses();
+    private timer: NodeJS.Timeout | null = null;
+
+    constructor(onChange: (change: NetworkChange) => void) {
+        this.onChange = onChange;
+    }
+
+    public start(): void {
+        const tick = () => {
+            this.check();
+            this.timer = setTimeout(tick, config.NETWORK_WATCH_INTERVAL_MS);
+        };
+        this.timer = setTimeout(tick, config.NETWORK_WATCH_INTERVAL_MS);
+    }
+
+    public stop(): void {
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+    }
+
+    private check(): void {
+        const current = localAddresses();
+        const added = [...current].filter((address) => !this.addresses.has(address));
+        const removed = [...this.addresses].filter((address) => !current.has(address));
+        this.addresses = current;
+        if (added.length === 0 && removed.length === 0) return;
+
+        log.info(`🌐 Network change detected:` +
+            (added.length > 0 ? ` +${added.join(' +')}` : '') +
+            (removed.length > 0 ? ` -${removed.join(' -')}` : ''));
+        this.onChange({ added, removed, addresses: current });
+    }
+}
+
+function localAddresses(): Set<string> {
+    const addresses = new Set<string>();
+    for (const entries of Object.values(os.networkInterfaces())) {
+        for (const entry of entries ?? []) addresses.add(entry.address);
+    }
+    return addresses;
+}
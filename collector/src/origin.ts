@@ -0,0 +1,48 @@
+import { parseStructuredData } from './parsers/structured-data.js';
+
+/**
+ * SD-ID used to carry Centinela chain-of-custody metadata in RFC 5424 messages.
+ * (32473 is the IANA example enterprise number, RFC 5612.)
+ */
+export const CENTINELA_SD_ID = 'centinela@32473';
+
+export interface RelayedOrigin {
+    ip: string;
+    transport?: string;
+    port?: number;
+    received_at?: string;
+}
+
+const RFC5424_HEADER = /^<\d{1,3}>1 \S+ \S+ \S+ \S+ \S+ /;
+
+/**
+ * Extract the original sender from an RFC 5424 message forwarded by a syslog relay.
+ *
+ * Recognizes the standard `[origin ip="..."]` element (RFC 5424 §7.2) and our own
+ * `[centinela@32473 ip="..." transport="udp" port="514" rcvd="<ISO8601>"]`.
+ * Returns null if the message carries no origin information.
+ */
+export function extractRelayedOrigin(rawMessage: string): RelayedOrigin | null {
+    const header = RFC5424_HEADER.exec(rawMessage);
+    if (!header) return null;
+
+    const parsed = parseStructuredData(rawMessage, header[0].length);
+    if (!parsed) return null;
+
+    const ours = parsed.data[CENTINELA_SD_ID];
+    const ip = ours?.ip ?? parsed.data.origin?.ip;
+    if (!ip) return null;
+
+    const origin: RelayedOrigin = { ip };
+
+    if (ours?.transport) origin.transport = ours.transport;
+
+    const port = Number(ours?.port);
+    if (Number.isInteger(port) && port > 0 && port < 65536) origin.port = port;
+
+    if (ours?.rcvd && !Number.isNaN(Date.parse(ours.rcvd))) {
+        origin.received_at = new Date(ours.rcvd).toISOString();
+    }
+
+    return origin;
+}
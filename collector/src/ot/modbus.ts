@@ -0,0 +1,273 @@
+import net from 'node:net';
+import { config } from '../config.js';
+import type { MessageBuffer } from '../buffer.js';
+import { createSyslogEvent } from '../events.js';
+import { ingestEvent } from '../pipeline.js';
+import { log } from '../logger.js';
+
+const MBAP_HEADER_BYTES = 7;
+const MAX_ADU_BYTES = 260; // Modbus TCP application data unit
+
+const FUNCTIONS: Record<number, string> = {
+    1: 'read_coils',
+    2: 'read_discrete_inputs',
+    3: 'read_holding_registers',
+    4: 'read_input_registers',
+    5: 'write_single_coil',
+    6: 'write_single_register',
+    8: 'diagnostics',
+    15: 'write_multiple_coils',
+    16: 'write_multiple_registers',
+    22: 'mask_write_register',
+    23: 'read_write_multiple_registers',
+    43: 'encapsulated_interface_transport',
+};
+
+const EXCEPTIONS: Record<number, string> = {
+    1: 'illegal_function',
+    2: 'illegal_data_address',
+    3: 'illegal_data_value',
+    4: 'server_device_failure',
+    5: 'acknowledge',
+    6: 'server_device_busy',
+    8: 'memory_parity_error',
+    10: 'gateway_path_unavailable',
+    11: 'gateway_target_failed_to_respond',
+};
+
+export interface ModbusStats {
+    connections: number;
+    frames: number;
+    exceptions: number;
+    invalid: number;
+}
+
+/**
+ * Normalized Modbus frame, sent as the event's raw message (JSON)
+ */
+interface ModbusRecord {
+    ot_protocol: 'modbus';
+    unit_id: number;
+    transaction_id: number;
+    function_code: number;
+    function: string;
+    address?: number;
+    quantity?: number;
+    values?: number[];
+    exception_code?: number;
+    exception?: string;
+}
+
+/**
+ * Modbus TCP Listener (OT)
+ *
+ * Passive Modbus TCP server for OT gateways and alarm forwarders that push to a
+ * SCADA-style endpoint: every frame becomes an event with its unit, function,
+ * register address and values decoded. Exception frames relayed by gateways
+ * (function code | 0x80) are decoded with the exception name.
+ *
+ * Writes are acknowledged as a real device would, so forwarders don't retry;
+ * nothing is stored, so reads are answered with an "illegal function" exception.
+ * Modbus has no authentication: restrict senders with ALLOWED_SOURCES.
+ */
+export class ModbusListener {
+    private server: net.Server;
+    private buffer: MessageBuffer;
+    private stats: ModbusStats = { connections: 0, frames: 0, exceptions: 0, invalid: 0 };
+    private sockets = new Set<net.Socket>();
+    private isRunning = false;
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+        this.server = net.createServer(this.handleConnection.bind(this));
+        this.server.on('error', (err) => {
+            log.error(`❌ Modbus Listener Error: ${err.message}`);
+        });
+    }
+
+    private handleConnection(socket: net.Socket): void {
+        this.stats.connections++;
+        this.sockets.add(socket);
+        let pending = Buffer.alloc(0);
+
+        socket.on('data', (data: Buffer) => {
+            pending = Buffer.concat([pending, data]);
+
+            while (pending.length >= MBAP_HEADER_BYTES) {
+                const protocolId = pending.readUInt16BE(2);
+                const length = pending.readUInt16BE(4); // Unit ID + PDU
+                if (protocolId !== 0 || length < 2 || MBAP_HEADER_BYTES - 1 + length > MAX_ADU_BYTES) {
+                    // Not Modbus TCP: there is no way to resynchronize the stream
+                    this.stats.invalid++;
+                    log.warn(`⚠️ Invalid Modbus TCP frame from ${socket.remoteAddress}, closing connection`);
+                    socket.destroy();
+                    return;
+                }
+
+                const size = MBAP_HEADER_BYTES - 1 + length;
+                if (pending.length < size) break;
+
+                const frame = pending.subarray(0, size);
+                pending = pending.subarray(size);
+                this.handleFrame(frame, socket);
+            }
+        });
+
+        socket.on('close', () => this.sockets.delete(socket));
+        socket.on('error', (err) => {
+            if ((err as NodeJS.ErrnoException).code !== 'ECONNRESET') {
+                log.error(`❌ Modbus socket error from ${socket.remoteAddress}: ${err.message}`);
+            }
+            socket.destroy();
+        });
+
+        socket.setTimeout(300000);
+        socket.on('timeout', () => socket.end());
+    }
+
+    private handleFrame(frame: Buffer, socket: net.Socket): void {
+        const transactionId = frame.readUInt16BE(0);
+        const unitId = frame.readUInt8(6);
+        const pdu = frame.subarray(MBAP_HEADER_BYTES);
+
+        let record: ModbusRecord;
+        try {
+            record = decodePdu(pdu, unitId, transactionId);
+        } catch {
+            this.stats.invalid++;
+            return;
+        }
+
+        this.stats.frames++;
+        if (record.exception_code !== undefined) this.stats.exceptions++;
+
+        const event = createSyslogEvent(
+            JSON.stringify(record),
+            { address: socket.remoteAddress || 'unknown', port: socket.remotePort },
+            'modbus',
+        );
+        event.tags = { ot_protocol: 'modbus' };
+        ingestEvent(this.buffer, event);
+
+        const response = respond(pdu);
+        if (response) {
+            const header = Buffer.alloc(MBAP_HEADER_BYTES);
+            header.writeUInt16BE(transactionId, 0);
+            header.writeUInt16BE(0, 2);
+            header.writeUInt16BE(response.length + 1, 4);
+            header.writeUInt8(unitId, 6);
+            socket.write(Buffer.concat([header, response]));
+        }
+    }
+
+    public getStats(): ModbusStats {
+        return { ...this.stats };
+    }
+
+    /**
+     * Start the Modbus listener
+     */
+    public start(): Promise<void> {
+        return new Promise((resolve, reject) => {
+            this.server.listen(config.OT_MODBUS_PORT, config.OT_MODBUS_BIND_ADDRESS, () => {
+                this.isRunning = true;
+                log.info(`🏭 Modbus TCP listening on tcp://${config.OT_MODBUS_BIND_ADDRESS}:${config.OT_MODBUS_PORT}`);
+                resolve();
+            });
+
+            this.server.once('error', (err) => {
+                reject(err);
+            });
+        });
+    }
+
+    /**
+     * Stop the Modbus listener
+     */
+    public stop(): Promise<void> {
+        return new Promise((resolve) => {
+            if (!this.isRunning) {
+                resolve();
+                return;
+            }
+
+            for (const socket of this.sockets) {
+                socket.destroy();
+            }
+            this.server.close(() => {
+                this.isRunning = false;
+                log.info('   Modbus listener stopped.');
+                resolve();
+            });
+        });
+    }
+}
+
+function decodePdu(pdu: Buffer, unitId: number, transactionId: number): ModbusRecord {
+    const code = pdu.readUInt8(0);
+    const functionCode = code & 0x7f;
+    const record: ModbusRecord = {
+        ot_protocol: 'modbus',
+        unit_id: unitId,
+        transaction_id: transactionId,
+        function_code: functionCode,
+        function: FUNCTIONS[functionCode] ?? `function_${functionCode}`,
+    };
+
+    if (code & 0x80) {
+        record.exception_code = pdu.readUInt8(1);
+        record.exception = EXCEPTIONS[record.exception_code] ?? `exception_${record.exception_code}`;
+        return record;
+    }
+
+    switch (functionCode) {
+        case 1:
+        case 2:
+        case 3:
+        case 4:
+            record.address = pdu.readUInt16BE(1);
+            record.quantity = pdu.readUInt16BE(3);
+            break;
+        case 5:
+            record.address = pdu.readUInt16BE(1);
+            record.values = [pdu.readUInt16BE(3) === 0xff00 ? 1 : 0];
+            break;
+        case 6:
+            record.address = pdu.readUInt16BE(1);
+            record.values = [pdu.readUInt16BE(3)];
+            break;
+        case 15: {
+            record.address = pdu.readUInt16BE(1);
+            record.quantity = pdu.readUInt16BE(3);
+            const bits = pdu.subarray(6, 6 + pdu.readUInt8(5));
+            record.values = Array.from({ length: record.quantity }, (_, i) => (bits[i >> 3]! >> (i & 7)) & 1);
+            break;
+        }
+        case 16: {
+            record.address = pdu.readUInt16BE(1);
+            record.quantity = pdu.readUInt16BE(3);
+            record.values = Array.from({ length: record.quantity }, (_, i) => pdu.readUInt16BE(6 + i * 2));
+            break;
+        }
+    }
+    return record;
+}
+
+/**
+ * Response PDU for a request, or null for frames that need none (relayed exceptions)
+ */
+function respond(pdu: Buffer): Buffer | null {
+    const code = pdu.readUInt8(0);
+    if (code & 0x80) return null;
+
+    switch (code) {
+        case 5:
+        case 6:
+            return pdu.subarray(0, 5); // Echo of the request
+        case 15:
+        case 16:
+            return pdu.subarray(0, 5); // Function, address, quantity
+        default:
+            return Buffer.from([code | 0x80, 0x01]); // Illegal function
+    }
+}
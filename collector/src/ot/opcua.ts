@@ -0,0 +1,266 @@
+import http from 'node:http';
+import { timingSafeEqual } from 'node:crypto';
+import { config } from '../config.js';
+import type { MessageBuffer } from '../buffer.js';
+import { createSyslogEvent } from '../events.js';
+import { ingestEvent } from '../pipeline.js';
+import { log } from '../logger.js';
+
+const MAX_BODY_BYTES = 5 * 1024 * 1024;
+const EVENTS_PATH = '/v1/ot/opcua/events';
+
+export interface OpcUaStats {
+    requests: number;
+    events: number;
+    invalid: number;
+    unauthorized: number;
+}
+
+/**
+ * Normalized OPC UA event (BaseEventType / AlarmConditionType fields),
+ * sent as the event's raw message (JSON)
+ */
+interface OpcUaRecord {
+    ot_protocol: 'opcua';
+    event_id?: string;
+    event_type?: string;
+    source_name?: string;
+    source_node?: string;
+    time?: string;
+    message?: string;
+    severity?: number; // 1-1000
+    severity_level?: 'low' | 'medium' | 'high' | 'critical';
+    condition?: string;
+    active?: boolean;
+    acknowledged?: boolean;
+    fields?: Record<string, unknown>; // Other fields selected by the subscription
+}
+
+const KNOWN_FIELDS = new Set([
+    'EventId', 'EventType', 'SourceName', 'SourceNode', 'Time', 'ReceiveTime', 'Message', 'Severity',
+    'ConditionName', 'ActiveState', 'AckedState',
+]);
+
+/**
+ * OPC UA Event Receiver (OT)
+ *
+ * OPC UA event subscriptions are held by an OT gateway (Kepware, Ignition,
+ * Node-RED, ...) that forwards the notifications here as JSON:
+ *   POST /v1/ot/opcua/events   Authorization: Bearer <OT_OPCUA_TOKENS entry>
+ * with one event object, an array of them, or newline-delimited objects, using
+ * the BaseEventType field names (EventId, SourceName, Time, Message, Severity...).
+ * Events are normalized (severity bands, LocalizedText and state values flattened)
+ * so alarms from different gateways look the same.
+ */
+export class OpcUaEventReceiver {
+    private server: http.Server;
+    private buffer: MessageBuffer;
+    private tokens: Buffer[];
+    private stats: OpcUaStats = { requests: 0, events: 0, invalid: 0, unauthorized: 0 };
+    private isRunning = false;
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+        this.tokens = config.OT_OPCUA_TOKENS.map((token) => Buffer.from(token));
+
+        this.server = http.createServer(this.handleRequest.bind(this));
+        this.server.on('error', (err) => {
+            log.error(`❌ OPC UA Receiver Error: ${err.message}`);
+        });
+    }
+
+    private handleRequest(req: http.IncomingMessage, res: http.ServerResponse): void {
+        const path = (req.url || '/').split('?')[0];
+        if (req.method !== 'POST' || path !== EVENTS_PATH) {
+            this.reply(res, 404, { error: 'Not Found' });
+            return;
+        }
+
+        if (!this.isAuthorized(req.headers.authorization)) {
+            this.stats.unauthorized++;
+            this.reply(res, 401, { error: 'Invalid token' });
+            return;
+        }
+
+        this.readBody(req)
+            .then((body) => {
+                let items: unknown[];
+                try {
+                    items = parseItems(body);
+                } catch {
+                    this.stats.invalid++;
+                    this.reply(res, 400, { error: 'Expected JSON event objects' });
+                    return;
+                }
+
+                if (this.buffer.available < items.length) {
+                    this.reply(res, 503, { error: 'Buffer full, retry later' });
+                    return;
+                }
+
+                let accepted = 0;
+                for (const item of items) {
+                    if (typeof item !== 'object' || item === null || Array.isArray(item)) {
+                        this.stats.invalid++;
+                        continue;
+                    }
+                    const event = createSyslogEvent(
+                        JSON.stringify(normalize(item as Record<string, unknown>)),
+                        { address: req.socket.remoteAddress || 'unknown', port: req.socket.remotePort },
+                        'opcua',
+                    );
+                    event.tags = { ot_protocol: 'opcua' };
+                    ingestEvent(this.buffer, event);
+                    accepted++;
+                }
+
+                this.stats.requests++;
+                this.stats.events += accepted;
+                this.reply(res, 200, { ok: true, accepted, rejected: items.length - accepted });
+            })
+            .catch((err: Error) => {
+                this.reply(res, 400, { error: err.message });
+            });
+    }
+
+    private isAuthorized(header: string | undefined): boolean {
+        if (!header) return false;
+
+        const [scheme, token] = header.split(' ');
+        if (scheme !== 'Bearer' || !token) return false;
+
+        const candidate = Buffer.from(token);
+        return this.tokens.some((valid) =>
+            valid.length === candidate.length && timingSafeEqual(valid, candidate)
+        );
+    }
+
+    private readBody(req: http.IncomingMessage): Promise<string> {
+        return new Promise((resolve, reject) => {
+            const chunks: Buffer[] = [];
+            let size = 0;
+
+            req.on('data', (chunk: Buffer) => {
+                size += chunk.length;
+                if (size > MAX_BODY_BYTES) {
+                    reject(new Error('Payload too large'));
+                    req.destroy();
+                    return;
+                }
+                chunks.push(chunk);
+            });
+            req.on('end', () => resolve(Buffer.concat(chunks).toString('utf8')));
+            req.on('error', reject);
+        });
+    }
+
+    private reply(res: http.ServerResponse, status: number, body: object): void {
+        res.writeHead(status, { 'Content-Type': 'application/json' });
+        res.end(JSON.stringify(body));
+    }
+
+    public getStats(): OpcUaStats {
+        return { ...this.stats };
+    }
+
+    /**
+     * Start the OPC UA event receiver
+     */
+    public start(): Promise<void> {
+        return new Promise((resolve, reject) => {
+            this.server.listen(config.OT_OPCUA_PORT, config.OT_OPCUA_BIND_ADDRESS, () => {
+                this.isRunning = true;
+                log.info(`🏭 OPC UA event receiver on http://${config.OT_OPCUA_BIND_ADDRESS}:${config.OT_OPCUA_PORT}${EVENTS_PATH}`);
+                resolve();
+            });
+
+            this.server.once('error', (err) => {
+                reject(err);
+            });
+        });
+    }
+
+    /**
+     * Stop the OPC UA event receiver
+     */
+    public stop(): Promise<void> {
+        return new Promise((resolve) => {
+            if (!this.isRunning) {
+                resolve();
+                return;
+            }
+
+            this.server.close(() => {
+                this.isRunning = false;
+                log.info('   OPC UA event receiver stopped.');
+                resolve();
+            });
+        });
+    }
+}
+
+function parseItems(body: string): unknown[] {
+    const trimmed = body.trim();
+    if (trimmed.startsWith('[')) {
+        const items: unknown = JSON.parse(trimmed);
+        if (!Array.isArray(items)) throw new Error('expected an array');
+        return items;
+    }
+    return trimmed.split(/\r?\n/).filter((line) => line.trim().length > 0).map((line) => JSON.parse(line) as unknown);
+}
+
+function normalize(event: Record<string, unknown>): OpcUaRecord {
+    const severity = typeof event.Severity === 'number' ? event.Severity : Number(event.Severity);
+    const fields = Object.fromEntries(Object.entries(event).filter(([key]) => !KNOWN_FIELDS.has(key)));
+
+    return {
+        ot_protocol: 'opcua',
+        event_id: text(event.EventId),
+        event_type: text(event.EventType),
+        source_name: text(event.SourceName),
+        source_node: text(event.SourceNode),
+        time: text(event.Time) ?? text(event.ReceiveTime),
+        message: text(event.Message),
+        ...(Number.isFinite(severity) && severity > 0 && { severity, severity_level: severityLevel(severity) }),
+        condition: text(event.ConditionName),
+        active: state(event.ActiveState),
+        acknowledged: state(event.AckedState),
+        ...(Object.keys(fields).length > 0 && { fields }),
+    };
+}
+
+/**
+ * Severity bands commonly used by SCADA/HMI alarm views (OPC UA severity is 1-1000)
+ */
+function severityLevel(severity: number): OpcUaRecord['severity_level'] {
+    if (severity > 800) return 'critical';
+    if (severity > 500) return 'high';
+    if (severity > 200) return 'medium';
+    return 'low';
+}
+
+/**
+ * Strings, LocalizedText ({ text, locale }) and NodeIds/ByteStrings as strings
+ */
+function text(value: unknown): string | undefined {
+    if (value === undefined || value === null) return undefined;
+    if (typeof value === 'string') return value;
+    if (typeof value === 'object' && 'text' in value) return String((value as { text: unknown }).text);
+    if (typeof value === 'object' && 'Text' in value) return String((value as { Text: unknown }).Text);
+    return typeof value === 'object' ? JSON.stringify(value) : String(value);
+}
+
+/**
+ * TwoStateVariable: boolean, { Id: boolean } or { value: boolean }, or a display string
+ */
+function state(value: unknown): boolean | undefined {
+    if (typeof value === 'boolean') return value;
+    if (typeof value === 'object' && value !== null) {
+        const id = (value as { Id?: unknown; id?: unknown; value?: unknown }).Id
+            ?? (value as { id?: unknown }).id
+            ?? (value as { value?: unknown }).value;
+        if (typeof id === 'boolean') return id;
+    }
+    if (typeof value === 'string') return /^(active|true|acknowledged)$/i.test(value);
+    return undefined;
+}
@@ -0,0 +1,248 @@
+import http2 from 'node:http2';
+import os from 'node:os';
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { OutputQueue, type OverflowPolicy } from './output-queue.js';
+import { decodeRejectedProtobuf, encodeLogsJson, encodeLogsProtobuf, toLogRecord, type LogsResource } from './serializers/otlp.js';
+import { COLLECTOR_VERSION } from './version.js';
+import { log } from './logger.js';
+
+const REQUEST_TIMEOUT_MS = 10000;
+const MAX_ATTEMPTS = 4; // Then the batch is given up (1s, 2s, 4s between attempts)
+const GRPC_PATH = '/opentelemetry.proto.collector.logs.v1.LogsService/Export';
+
+// Retryable per the OTLP specification; anything else is a permanent refusal
+const RETRYABLE_HTTP = new Set([429, 502, 503, 504]);
+const RETRYABLE_GRPC = new Set([1, 4, 8, 10, 11, 14, 15]); // CANCELLED, DEADLINE_EXCEEDED, RESOURCE_EXHAUSTED, ABORTED, OUT_OF_RANGE, UNAVAILABLE, DATA_LOSS
+
+export interface OtlpLogsStats {
+    endpoint: string;
+    protocol: 'grpc' | 'http/protobuf' | 'http/json';
+    exported: number; // Log records accepted
+    rejected: number; // Refused by the receiver (partial success or permanent error)
+    given_up: number; // Still failing after MAX_ATTEMPTS
+    dropped: number; // Queue full
+    queue: number;
+    queue_capacity: number;
+    overflow: OverflowPolicy;
+    responses: Record<string, number>; // HTTP status, "grpc <status>" or "error" -> count
+}
+
+interface ExportResult {
+    rejected: number;
+    message?: string;
+    outcome: string; // For the responses counters
+}
+
+class ExportError extends Error {
+    public readonly retryable: boolean;
+    public readonly outcome: string;
+
+    constructor(message: string, outcome: string, retryable: boolean) {
+        super(message);
+        this.outcome = outcome;
+        this.retryable = retryable;
+    }
+}
+
+/**
+ * OTLP Logs Exporter (OTEL_LOGS_EXPORTER=otlp)
+ *
+ * Exports every event as an OpenTelemetry LogRecord (see serializers/otlp.ts)
+ * to any OTLP receiver (OpenTelemetry Collector, observability vendors), in
+ * addition to the Centinela backend, over OTLP/gRPC or OTLP/HTTP (protobuf or
+ * JSON). Like dual-write it is a secondary output: its own bounded queue
+ * (OutputQueue), a few retries with backoff for the errors OTLP marks
+ * retryable, and never the primary's retry queue, DLQ or write-ahead log.
+ */
+export class OtlpLogsExporter {
+    private readonly endpoint: string;
+    private readonly queue: OutputQueue;
+    private readonly resource: LogsResource;
+    private session: http2.ClientHttp2Session | null = null;
+    private failing = false;
+
+    private exported = 0;
+    private rejected = 0;
+    private givenUp = 0;
+    private responses: Record<string, number> = {};
+
+    constructor() {
+        const base = config.OTEL_EXPORTER_OTLP_ENDPOINT.replace(/\/+$/, '');
+        // The signal-specific endpoint is used as is, the base one gets the signal path (as in the OTel SDKs)
+        this.endpoint = config.OTEL_EXPORTER_OTLP_LOGS_PROTOCOL === 'grpc'
+            ? new URL(config.OTEL_EXPORTER_OTLP_LOGS_ENDPOINT ?? base).origin
+            : config.OTEL_EXPORTER_OTLP_LOGS_ENDPOINT ?? `${base}/v1/logs`;
+        this.resource = {
+            attributes: {
+                'service.name': config.OTEL_SERVICE_NAME,
+                'service.version': COLLECTOR_VERSION,
+                'service.instance.id': config.COLLECTOR_NAME,
+                'host.name': os.hostname(),
+            },
+            scope: { name: 'centinela-collector', version: COLLECTOR_VERSION },
+        };
+        this.queue = new OutputQueue('OTLP logs', {
+            capacity: () => config.OTLP_LOGS_QUEUE_SIZE,
+            overflow: () => config.OTLP_LOGS_OVERFLOW,
+            send: (batch) => this.sendBatch(batch),
+        });
+    }
+
+    /**
+     * Offer events that are about to be sent to the primary (all of them are queued)
+     */
+    public offer(events: SyslogEvent[]): void {
+        this.queue.offer(events);
+    }
+
+    public start(): void {
+        log.info(`🔭 Exporting events as OTLP logs to ${this.endpoint} (${config.OTEL_EXPORTER_OTLP_LOGS_PROTOCOL})`);
+        this.queue.start();
+    }
+
+    public stop(): void {
+        this.queue.stop();
+        this.session?.close();
+        this.session = null;
+    }
+
+    public getStats(): OtlpLogsStats {
+        const queue = this.queue.getStats();
+        return {
+            endpoint: this.endpoint,
+            protocol: config.OTEL_EXPORTER_OTLP_LOGS_PROTOCOL,
+            exported: this.exported,
+            rejected: this.rejected,
+            given_up: this.givenUp,
+            dropped: queue.dropped,
+            queue: queue.queued,
+            queue_capacity: config.OTLP_LOGS_QUEUE_SIZE,
+            overflow: queue.overflow,
+            responses: { ...this.responses },
+        };
+    }
+
+    private async sendBatch(batch: SyslogEvent[]): Promise<void> {
+        const records = batch.map((event) => toLogRecord(event, config.COLLECTOR_NAME));
+        const body = config.OTEL_EXPORTER_OTLP_LOGS_PROTOCOL === 'http/json'
+            ? Buffer.from(encodeLogsJson(records, this.resource))
+            : encodeLogsProtobuf(records, this.resource);
+
+        for (let attempt = 1; ; attempt++) {
+            try {
+                const { rejected, message, outcome } = config.OTEL_EXPORTER_OTLP_LOGS_PROTOCOL === 'grpc'
+                    ? await this.exportGrpc(body)
+                    : await this.exportHttp(body);
+                this.responses[outcome] = (this.responses[outcome] ?? 0) + 1;
+                this.exported += batch.length - rejected;
+                this.rejected += rejected;
+                if (rejected > 0) log.warn(`⚠️ OTLP receiver rejected ${rejected}/${batch.length} log records: ${message ?? 'no reason given'}`);
+                if (this.failing) log.info('🔭 OTLP log export recovered');
+                this.failing = false;
+                return;
+            } catch (err) {
+                const error = err instanceof ExportError ? err : new ExportError((err as Error).message, 'error', true);
+                this.responses[error.outcome] = (this.responses[error.outcome] ?? 0) + 1;
+
+                if (!error.retryable || attempt >= MAX_ATTEMPTS) {
+                    if (error.retryable) this.givenUp += batch.length;
+                    else this.rejected += batch.length;
+                    // Once per outage, not per batch
+                    if (!this.failing) log.warn(`⚠️ OTLP log export to ${this.endpoint} failed, dropping ${batch.length} records: ${error.message}`);
+                    this.failing = true;
+                    return;
+                }
+                await new Promise((resolve) => setTimeout(resolve, 1000 * 2 ** (attempt - 1)));
+            }
+        }
+    }
+
+    private headers(): Record<string, string> {
+        return { ...config.OTEL_EXPORTER_OTLP_HEADERS, ...config.OTEL_EXPORTER_OTLP_LOGS_HEADERS };
+    }
+
+    private async exportHttp(body: Buffer): Promise<ExportResult> {
+        const json = config.OTEL_EXPORTER_OTLP_LOGS_PROTOCOL === 'http/json';
+        const response = await fetch(this.endpoint, {
+            method: 'POST',
+            headers: { ...this.headers(), 'Content-Type': json ? 'application/json' : 'application/x-protobuf' },
+            body,
+            signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS),
+        });
+        const outcome = String(response.status);
+        if (!response.ok) {
+            const text = await response.text().catch(() => '');
+            throw new ExportError(`HTTP ${response.status}: ${text.slice(0, 200)}`, outcome, RETRYABLE_HTTP.has(response.status));
+        }
+        if (json) {
+            const result = await response.json().catch(() => null) as { partialSuccess?: { rejectedLogRecords?: string | number; errorMessage?: string } } | null;
+            return { rejected: Number(result?.partialSuccess?.rejectedLogRecords ?? 0) || 0, message: result?.partialSuccess?.errorMessage, outcome };
+        }
+        return { ...decodeRejectedProtobuf(Buffer.from(await response.arrayBuffer())), outcome };
+    }
+
+    private exportGrpc(body: Buffer): Promise<ExportResult> {
+        return new Promise((resolve, reject) => {
+            const request = this.connect().request({
+                ...Object.fromEntries(Object.entries(this.headers()).map(([key, value]) => [key.toLowerCase(), value])),
+                ':method': 'POST',
+                ':path': GRPC_PATH,
+                'content-type': 'application/grpc',
+                'te': 'trailers',
+            });
+            request.setTimeout(REQUEST_TIMEOUT_MS, () => {
+                request.close(http2.constants.NGHTTP2_CANCEL);
+                reject(new ExportError(`no response within ${REQUEST_TIMEOUT_MS / 1000}s`, 'error', true));
+            });
+
+            let status: number | undefined;
+            let statusMessage = '';
+            const chunks: Buffer[] = [];
+            const readStatus = (headers: http2.IncomingHttpHeaders) => {
+                if (headers['grpc-status'] === undefined) return;
+                status = Number(headers['grpc-status']);
+                statusMessage = decodeURIComponent(String(headers['grpc-message'] ?? ''));
+            };
+
+            request.on('response', (headers) => {
+                const httpStatus = Number(headers[':status']);
+                if (httpStatus !== 200) {
+                    reject(new ExportError(`HTTP ${httpStatus} (not a gRPC receiver?)`, String(httpStatus), RETRYABLE_HTTP.has(httpStatus)));
+                    request.close(http2.constants.NGHTTP2_CANCEL);
+                }
+                readStatus(headers); // Trailers-only response
+            });
+            request.on('data', (chunk: Buffer) => chunks.push(chunk));
+            request.on('trailers', readStatus);
+            request.on('error', (err) => reject(new ExportError(err.message, 'error', true)));
+            request.on('close', () => {
+                const outcome = `grpc ${status ?? 'none'}`;
+                if (status !== 0) {
+                    reject(new ExportError(`gRPC status ${status ?? 'missing'}: ${statusMessage || 'no message'}`, outcome,
+                        status === undefined || RETRYABLE_GRPC.has(status)));
+                    return;
+                }
+                const data = Buffer.concat(chunks);
+                resolve({ ...(data.length >= 5 ? decodeRejectedProtobuf(data.subarray(5, 5 + data.readUInt32BE(1))) : { rejected: 0 }), outcome });
+            });
+
+            const frame = Buffer.alloc(5);
+            frame.writeUInt32BE(body.length, 1);
+            request.end(Buffer.concat([frame, body]));
+        });
+    }
+
+    private connect(): http2.ClientHttp2Session {
+        if (this.session && !this.session.closed && !this.session.destroyed) return this.session;
+
+        const session = http2.connect(this.endpoint);
+        session.on('error', (err) => log.debug(`⚠️ OTLP gRPC connection to ${this.endpoint} failed: ${err.message}`));
+        session.once('close', () => {
+            if (this.session === session) this.session = null;
+        });
+        session.unref();
+        this.session = session;
+        return session;
+    }
+}
@@ -0,0 +1,136 @@
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { log } from './logger.js';
+
+/**
+ * What an output queue does when it is full:
+ * - drop_newest: refuse the incoming events (keeps the oldest backlog)
+ * - drop_oldest: evict the oldest queued events (keeps the output current)
+ */
+export type OverflowPolicy = 'drop_newest' | 'drop_oldest';
+
+export interface OutputQueueStats {
+    queued: number;
+    capacity: number;
+    overflow: OverflowPolicy;
+    dropped: number;
+}
+
+/**
+ * Output Queue (slow-consumer isolation)
+ *
+ * Every secondary output (shadow forwarding, and later sinks) gets its own
+ * bounded queue and sender, fed by the flush loop after the primary batch is
+ * taken. Offering never waits: a slow or unreachable output only fills its
+ * own queue and then loses events according to its overflow policy, while
+ * the primary backend keeps its pace. Capacity and policy are read on every
+ * offer, so they follow config reloads.
+ */
+export class OutputQueue {
+    private readonly name: string;
+    private readonly capacity: () => number;
+    private readonly overflow: () => OverflowPolicy;
+    private readonly send: (batch: SyslogEvent[]) => Promise<void>;
+
+    private queue: SyslogEvent[] = [];
+    private sending = false;
+    private overflowing = false;
+    private dropped = 0;
+    private timer: NodeJS.Timeout | null = null;
+
+    /**
+     * @param name     Output name, for logs
+     * @param options  capacity / overflow: current limits; send: delivers one batch (must not throw)
+     */
+    constructor(name: string, options: {
+        capacity: () => number;
+        overflow: () => OverflowPolicy;
+        send: (batch: SyslogEvent[]) => Promise<void>;
+    }) {
+        this.name = name;
+        this.capacity = options.capacity;
+        this.overflow = options.overflow;
+        this.send = options.send;
+    }
+
+    /**
+     * Queue events for this output (never blocks the caller)
+     */
+    public offer(events: SyslogEvent[]): void {
+        if (events.length === 0) return;
+
+        const capacity = this.capacity();
+        const excess = this.queue.length + events.length - capacity;
+        if (excess > 0) {
+            this.dropped += excess;
+            if (!this.overflowing) {
+                this.overflowing = true;
+                log.warn(`⚠️ ${this.name} output is falling behind (${capacity} events queued): applying ${this.overflow()}`);
+            }
+
+            if (this.overflow() === 'drop_oldest') {
+                this.queue.push(...events);
+                this.queue.splice(0, this.queue.length - capacity);
+            } else {
+                this.queue.push(...events.slice(0, Math.max(0, capacity - this.queue.length)));
+            }
+        } else {
+            this.queue.push(...events);
+        }
+
+        // Full batches go out right away; the rest at the next tick
+        if (this.queue.length >= config.BATCH_SIZE) {
+            void this.drain();
+        }
+    }
+
+    public start(): void {
+        const tick = async () => {
+            await this.drain();
+            this.timer = setTimeout(tick, config.FLUSH_INTERVAL_MS);
+        };
+        this.timer = setTimeout(tick, config.FLUSH_INTERVAL_MS);
+    }
+
+    public stop(): void {
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+    }
+
+    /**
+     * Send everything queued now (shutdown, for outputs that must not lose the tail)
+     */
+    public async flush(): Promise<void> {
+        while (this.sending) await new Promise((resolve) => setTimeout(resolve, 50));
+        await this.drain();
+    }
+
+    public getStats(): OutputQueueStats {
+        return {
+            queued: this.queue.length,
+            capacity: this.capacity(),
+            overflow: this.overflow(),
+            dropped: this.dropped,
+        };
+    }
+
+    // One batch in flight at a time: the output's own pace, whatever it is
+    private async drain(): Promise<void> {
+        if (this.sending) return;
+        this.sending = true;
+
+        try {
+            while (this.queue.length > 0) {
+                await this.send(this.queue.splice(0, config.BATCH_SIZE));
+            }
+            if (this.overflowing) {
+                this.overflowing = false;
+                log.info(`✅ ${this.name} output caught up`);
+            }
+        } finally {
+            this.sending = false;
+        }
+    }
+}
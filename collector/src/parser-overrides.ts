@@ -0,0 +1,113 @@
+import { readFileSync } from 'node:fs';
+import { config, parseParserOverride, type Config, type ParserOverride } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { CidrList, isValidCidr } from './cidr.js';
+import { log } from './logger.js';
+
+export interface ParserOverrideStats {
+    entries: number;
+    applied: number; // Events parsed with an override
+    unparsed: number; // ...whose pinned format didn't match the message (sent raw)
+}
+
+interface CompiledOverride extends ParserOverride {
+    list?: CidrList; // IP/CIDR entries
+    pattern?: RegExp; // Hostname entries
+    prefix: number;
+}
+
+/**
+ * Parser Overrides (per-source format pinning)
+ *
+ * Auto-detection tries RFC 5424, then RFC 3164, which occasionally picks the
+ * wrong one for custom application logs (a free-text line that happens to
+ * start like a header gets split into bogus hostname/tag fields). Entries in
+ * PARSER_OVERRIDES and PARSER_OVERRIDES_FILE, by source IP/range (most
+ * specific wins) or header hostname, either pin the format (raw: send the
+ * message unparsed) or disable formats auto-detection must not try.
+ *
+ * A pinned format is also set as the event's "parser" tag, so the backend
+ * doesn't guess the content format of those events either.
+ */
+class ParserOverrides {
+    private byAddress: CompiledOverride[] = [];
+    private byHostname: CompiledOverride[] = [];
+    private counters = { applied: 0, unparsed: 0 };
+
+    /**
+     * (Re)build the table from a configuration (at startup and on SIGHUP,
+     * which also picks up edits to PARSER_OVERRIDES_FILE). Throws if the file
+     * can't be read or has an invalid line; the current table is then kept.
+     */
+    public reload(settings: Pick<Config, 'PARSER_OVERRIDES' | 'PARSER_OVERRIDES_FILE'> = config): void {
+        const overrides = [...settings.PARSER_OVERRIDES];
+        if (settings.PARSER_OVERRIDES_FILE) {
+            const lines = readFileSync(settings.PARSER_OVERRIDES_FILE, 'utf8').split('\n');
+            lines.forEach((line, index) => {
+                const content = line.replace(/#.*/, '').trim();
+                if (!content) return;
+                try {
+                    overrides.push(parseParserOverride(content));
+                } catch (err) {
+                    throw new Error(`${settings.PARSER_OVERRIDES_FILE}:${index + 1}: ${(err as Error).message}`);
+                }
+            });
+        }
+
+        const addressEntries = overrides.filter((override) => isValidCidr(override.match));
+        this.byAddress = addressEntries
+            .map((override) => ({
+                ...override,
+                list: new CidrList([override.match]),
+                prefix: Number(override.match.split('/')[1] ?? 128),
+            }))
+            .sort((a, b) => b.prefix - a.prefix);
+        this.byHostname = overrides
+            .filter((override) => !addressEntries.includes(override))
+            .map((override) => ({ ...override, pattern: hostnamePattern(override.match), prefix: 0 }));
+
+        if (overrides.length > 0) {
+            log.info(`🧩 Parser overrides: ${this.byAddress.length} source range(s), ${this.byHostname.length} hostname(s)`);
+        }
+    }
+
+    /**
+     * Override for a source IP, if any
+     */
+    public forAddress(ip: string): ParserOverride | undefined {
+        return this.byAddress.find((override) => override.list!.contains(ip));
+    }
+
+    /**
+     * Override for a header hostname (first matching entry), if any
+     */
+    public forHostname(hostname: string): ParserOverride | undefined {
+        return this.byHostname.find((override) => override.pattern!.test(hostname));
+    }
+
+    /**
+     * Record an override applied to an event, and tag it with the pinned format
+     */
+    public record(event: SyslogEvent, override: ParserOverride): void {
+        this.counters.applied++;
+        if (override.format === 'auto') return;
+
+        event.tags = { ...event.tags, parser: override.format };
+        if (override.format !== 'raw' && !event.syslog) this.counters.unparsed++;
+    }
+
+    public getStats(): ParserOverrideStats {
+        return {
+            entries: this.byAddress.length + this.byHostname.length,
+            ...this.counters,
+        };
+    }
+}
+
+// "fw-*.corp.local" -> /^fw-.*\.corp\.local$/i
+function hostnamePattern(match: string): RegExp {
+    const escaped = match.split('*').map((part) => part.replace(/\./g, '\\.')).join('.*');
+    return new RegExp(`^${escaped}$`, 'i');
+}
+
+export const parserOverrides = new ParserOverrides();
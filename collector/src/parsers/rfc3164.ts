@@ -0,0 +1,154 @@
+/**
+ * RFC 3164 (BSD syslog) message parser
+ *
+ *   <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG
+ *
+ * The classic timestamp ("Oct  1 22:14:15") has no year and no time zone, so
+ * both are supplied by the caller: the time zone the device is assumed to log
+ * in, and how to pick the year. Common vendor variants are accepted too: a
+ * year or milliseconds in the timestamp (Cisco "*Oct  1 2023 22:14:15.123"),
+ * an RFC 3339 timestamp (rsyslog), and no HOSTNAME (the tag follows the
+ * timestamp directly).
+ */
+
+export interface Rfc3164Message {
+    format: 'rfc3164';
+    pri: number;
+    facility: number;
+    severity: number;
+    timestamp?: string; // ISO 8601 (UTC)
+    raw_timestamp?: string; // As sent
+    hostname?: string;
+    tag?: string;
+    procid?: string;
+    message?: string;
+}
+
+export interface Rfc3164Options {
+    timezone: string; // IANA name, "UTC" or "local"
+    receivedAt: Date; // Reference for the year
+    yearRollover: 'auto' | 'current'; // auto: year closest to receivedAt (Dec 31 logs received on Jan 1)
+}
+
+const MONTHS = ['Jan', 'Feb', 'Mar', 'Apr', 'May', 'Jun', 'Jul', 'Aug', 'Sep', 'Oct', 'Nov', 'Dec'];
+
+// "Oct 11 22:14:15", "Oct  1 22:14:15", "Oct 11 2023 22:14:15", "Oct 11 22:14:15.123", optional leading "*" or "."
+const BSD_TIMESTAMP = /^[*.]?([A-Z][a-z]{2}) {1,2}(\d{1,2})(?: (\d{4}))? (\d{2}):(\d{2}):(\d{2})(?:\.(\d{1,6}))?:? /;
+const ISO_TIMESTAMP = /^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d{1,9})?(?:Z|[+-]\d{2}:?\d{2})) /;
+// At most 255 characters (as RFC 5424); a longer first token is not taken as a host name
+const HOSTNAME = /^([^\s:[\]]{1,255}) /;
+const TAG = /^([^\s:[\]]{1,48})(?:\[([^\]]{1,128})\])?: ?/;
+
+/**
+ * Parse an RFC 3164 message. Returns null if there is no valid PRI.
+ */
+export function parseRfc3164(raw: string, options: Rfc3164Options): Rfc3164Message | null {
+    const priMatch = /^<(\d{1,3})>/.exec(raw);
+    if (!priMatch) return null;
+    const pri = Number(priMatch[1]);
+    if (pri > 191) return null;
+
+    const parsed: Rfc3164Message = { format: 'rfc3164', pri, facility: pri >> 3, severity: pri & 7 };
+    let rest = raw.slice(priMatch[0].length);
+
+    const bsd = BSD_TIMESTAMP.exec(rest);
+    const iso = bsd ? null : ISO_TIMESTAMP.exec(rest);
+    if (bsd) {
+        const timestamp = resolveBsdTimestamp(bsd, options);
+        if (timestamp) {
+            parsed.timestamp = timestamp;
+            parsed.raw_timestamp = bsd[0].trimEnd().replace(/:$/, '');
+            rest = rest.slice(bsd[0].length);
+        }
+    } else if (iso && !Number.isNaN(Date.parse(iso[1]!))) {
+        parsed.timestamp = new Date(iso[1]!).toISOString();
+        parsed.raw_timestamp = iso[1];
+        rest = rest.slice(iso[0].length);
+    }
+
+    // HOSTNAME, unless the device skipped it and the next token is already the tag
+    if (parsed.timestamp) {
+        const host = HOSTNAME.exec(rest);
+        if (host) {
+            parsed.hostname = host[1];
+            rest = rest.slice(host[0].length);
+        }
+    }
+
+    const tag = TAG.exec(rest);
+    if (tag) {
+        parsed.tag = tag[1];
+        if (tag[2]) parsed.procid = tag[2];
+        rest = rest.slice(tag[0].length);
+    }
+
+    if (rest.length > 0) parsed.message = rest;
+    return parsed;
+}
+
+function resolveBsdTimestamp(match: RegExpExecArray, options: Rfc3164Options): string | null {
+    const month = MONTHS.indexOf(match[1]!);
+    const day = Number(match[2]);
+    if (month < 0 || day < 1 || day > 31) return null;
+
+    const [hour, minute, second] = [Number(match[4]), Number(match[5]), Number(match[6])];
+    if (hour > 23 || minute > 59 || second > 60) return null;
+    const ms = match[7] ? Number(match[7].padEnd(3, '0').slice(0, 3)) : 0;
+
+    const toUtc = (year: number) => zonedToUtc(year, month, day, hour, minute, second, ms, options.timezone);
+
+    let time: number;
+    if (match[3]) {
+        time = toUtc(Number(match[3]));
+    } else {
+        const reference = options.receivedAt.getTime();
+        const year = options.receivedAt.getUTCFullYear();
+        const candidates = options.yearRollover === 'auto' ? [year - 1, year, year + 1] : [year];
+        // Feb 29 only exists in some of the candidate years
+        const times = candidates.map(toUtc).filter((candidate) => !Number.isNaN(candidate));
+        time = times.length === 0 ? NaN : times.reduce((best, candidate) =>
+            Math.abs(candidate - reference) < Math.abs(best - reference) ? candidate : best);
+    }
+
+    return Number.isNaN(time) ? null : new Date(time).toISOString();
+}
+
+/**
+ * Wall-clock time in `timezone` to a UTC timestamp
+ */
+function zonedToUtc(year: number, month: number, day: number, hour: number, minute: number, second: number, ms: number, timezone: string): number {
+    const wall = Date.UTC(year, month, day, hour, minute, second, ms);
+    if (new Date(wall).getUTCDate() !== day) return NaN; // e.g. Feb 30
+    if (timezone === 'UTC') return wall;
+    if (timezone === 'local') return new Date(year, month, day, hour, minute, second, ms).getTime();
+
+    // The offset at the guessed instant, then again at the corrected one (DST transitions)
+    let utc = wall - zoneOffset(wall, timezone);
+    utc = wall - zoneOffset(utc, timezone);
+    return utc;
+}
+
+const formatters = new Map<string, Intl.DateTimeFormat>();
+
+/**
+ * Offset of `timezone` from UTC at `time`, in milliseconds
+ */
+function zoneOffset(time: number, timezone: string): number {
+    let formatter = formatters.get(timezone);
+    if (!formatter) {
+        formatter = new Intl.DateTimeFormat('en-US', {
+            timeZone: timezone,
+            hourCycle: 'h23',
+            year: 'numeric', month: 'numeric', day: 'numeric',
+            hour: 'numeric', minute: 'numeric', second: 'numeric',
+        });
+        formatters.set(timezone, formatter);
+    }
+
+    const parts: Record<string, number> = {};
+    for (const part of formatter.formatToParts(time)) {
+        if (part.type !== 'literal') parts[part.type] = Number(part.value);
+    }
+    const asUtc = Date.UTC(parts.year!, parts.month! - 1, parts.day!, parts.hour!, parts.minute!, parts.second!);
+    return asUtc - Math.floor(time / 1000) * 1000;
+}
@@ -0,0 +1,76 @@
+import { parseStructuredData, type StructuredData } from './structured-data.js';
+
+/**
+ * RFC 5424 syslog message parser
+ *
+ *   SYSLOG-MSG = HEADER SP STRUCTURED-DATA [SP MSG]
+ *   HEADER     = PRI VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID
+ *
+ * NILVALUE ("-") header fields are omitted from the result. The timestamp is
+ * kept as sent (with its offset); a leading UTF-8 BOM is stripped from MSG.
+ */
+
+export interface Rfc5424Message {
+    format: 'rfc5424';
+    pri: number;
+    facility: number;
+    severity: number;
+    version: number;
+    timestamp?: string;
+    hostname?: string;
+    app_name?: string;
+    procid?: string;
+    msgid?: string;
+    structured_data?: StructuredData;
+    message?: string;
+}
+
+// PRI VERSION SP, then five space-separated PRINTUSASCII fields (max lengths checked below)
+const HEADER = /^<(\d{1,3})>([1-9]\d{0,2}) ([!-~]+) ([!-~]+) ([!-~]+) ([!-~]+) ([!-~]+) /;
+
+// FULL-DATE "T" FULL-TIME, fractional seconds up to 6 digits, "Z" or an offset
+const TIMESTAMP = /^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d{1,6})?(Z|[+-]\d{2}:\d{2})$/;
+
+const MAX_LENGTHS = { hostname: 255, app_name: 48, procid: 128, msgid: 32 };
+
+/**
+ * Parse an RFC 5424 message. Returns null if the message is not RFC 5424
+ * (e.g. RFC 3164 or no PRI), so callers can fall back to the raw message.
+ */
+export function parseRfc5424(raw: string): Rfc5424Message | null {
+    const header = HEADER.exec(raw);
+    if (!header) return null;
+
+    const pri = Number(header[1]);
+    if (pri > 191 || (header[1]!.length > 1 && header[1]!.startsWith('0'))) return null;
+
+    const [timestamp, hostname, appName, procid, msgid] = header.slice(3) as [string, string, string, string, string];
+    if (timestamp !== '-' && (!TIMESTAMP.test(timestamp) || Number.isNaN(Date.parse(timestamp)))) return null;
+    if (hostname.length > MAX_LENGTHS.hostname || appName.length > MAX_LENGTHS.app_name ||
+        procid.length > MAX_LENGTHS.procid || msgid.length > MAX_LENGTHS.msgid) {
+        return null;
+    }
+
+    const sd = parseStructuredData(raw, header[0].length);
+    if (!sd || (sd.end < raw.length && raw[sd.end] !== ' ')) return null;
+
+    const parsed: Rfc5424Message = {
+        format: 'rfc5424',
+        pri,
+        facility: pri >> 3,
+        severity: pri & 7,
+        version: Number(header[2]),
+    };
+
+    if (timestamp !== '-') parsed.timestamp = timestamp;
+    if (hostname !== '-') parsed.hostname = hostname;
+    if (appName !== '-') parsed.app_name = appName;
+    if (procid !== '-') parsed.procid = procid;
+    if (msgid !== '-') parsed.msgid = msgid;
+    if (Object.keys(sd.data).length > 0) parsed.structured_data = sd.data;
+
+    const message = raw.slice(sd.end + 1).replace(/^\uFEFF/, '');
+    if (message.length > 0) parsed.message = message;
+
+    return parsed;
+}
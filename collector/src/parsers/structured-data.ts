@@ -0,0 +1,82 @@
+/**
+ * RFC 5424 STRUCTURED-DATA parser
+ *
+ *   STRUCTURED-DATA = NILVALUE / 1*SD-ELEMENT
+ *   SD-ELEMENT      = "[" SD-ID *(SP SD-PARAM) "]"
+ *   SD-PARAM        = PARAM-NAME "=" %d34 PARAM-VALUE %d34
+ *
+ * PARAM-VALUE escapes '"', '\' and ']' with a backslash.
+ */
+
+export type StructuredData = Record<string, Record<string, string>>;
+
+/**
+ * Parse STRUCTURED-DATA starting at `start`.
+ * Returns the parsed elements and the index just past the last element,
+ * or null if the input is not valid structured data.
+ */
+export function parseStructuredData(input: string, start: number): { data: StructuredData; end: number } | null {
+    const data: StructuredData = {};
+    let pos = start;
+
+    if (input[pos] === '-') {
+        return { data, end: pos + 1 };
+    }
+
+    if (input[pos] !== '[') return null;
+
+    while (input[pos] === '[') {
+        pos++;
+
+        const idEnd = findNameEnd(input, pos);
+        if (idEnd === pos) return null;
+        const id = input.slice(pos, idEnd);
+        pos = idEnd;
+
+        const params: Record<string, string> = {};
+
+        while (input[pos] === ' ') {
+            pos++;
+            const nameEnd = findNameEnd(input, pos);
+            if (nameEnd === pos || input[nameEnd] !== '=' || input[nameEnd + 1] !== '"') return null;
+            const name = input.slice(pos, nameEnd);
+            pos = nameEnd + 2;
+
+            let value = '';
+            while (pos < input.length && input[pos] !== '"') {
+                if (input[pos] === '\\' && pos + 1 < input.length && '"\\]'.includes(input[pos + 1]!)) {
+                    value += input[pos + 1];
+                    pos += 2;
+                } else {
+                    value += input[pos];
+                    pos++;
+                }
+            }
+            if (input[pos] !== '"') return null;
+            pos++;
+
+            params[name] = value;
+        }
+
+        if (input[pos] !== ']') return null;
+        pos++;
+
+        // Per RFC 5424 the same SD-ID must not appear twice; keep the first
+        if (!(id in data)) data[id] = params;
+    }
+
+    return { data, end: pos };
+}
+
+/**
+ * SD-NAME: printable US-ASCII except '=', SP, ']' and '"'
+ */
+function findNameEnd(input: string, start: number): number {
+    let pos = start;
+    while (pos < input.length && pos - start < 32) {
+        const code = input.charCodeAt(pos);
+        if (code <= 32 || code >= 127 || code === 61 || code === 93 || code === 34) break;
+        pos++;
+    }
+    return pos;
+}
@@ -0,0 +1,184 @@
+/**
+ * Windows Event XML (as rendered by wevtutil / EvtRender) to JSON
+ *
+ * <Event><System>...</System><EventData><Data Name="...">...</Data></EventData>
+ * <RenderingInfo>...</RenderingInfo></Event> becomes one flat-ish object:
+ * the System fields with snake_case names, EventData as name -> value
+ * (unnamed Data items as a list), UserData as nested objects and, when the
+ * event was rendered, the message and the level/task/opcode names.
+ */
+
+interface XmlElement {
+    name: string; // Local name, prefix dropped
+    attributes: Record<string, string>;
+    children: XmlElement[];
+    text: string;
+}
+
+export interface WindowsEvent {
+    provider?: string;
+    provider_guid?: string;
+    event_id?: number;
+    version?: number;
+    level?: number;
+    task?: number;
+    opcode?: number;
+    keywords?: string;
+    time_created?: string;
+    record_id?: number;
+    activity_id?: string;
+    process_id?: number;
+    thread_id?: number;
+    channel?: string;
+    computer?: string;
+    user_sid?: string;
+    event_data?: Record<string, string | null>;
+    data?: Array<string | null>; // Unnamed EventData items (classic event log providers)
+    binary?: string;
+    user_data?: Record<string, unknown>;
+    message?: string;
+    level_name?: string;
+    task_name?: string;
+    opcode_name?: string;
+    keyword_names?: string[];
+}
+
+const TOKEN = /<!--[\s\S]*?-->|<\?[\s\S]*?\?>|<!\[CDATA\[([\s\S]*?)\]\]>|<(\/?)([\w:.-]+)((?:\s+[\w:.-]+\s*=\s*(?:"[^"]*"|'[^']*'))*)\s*(\/?)>|([^<]+)/g;
+const ATTRIBUTE = /([\w:.-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')/g;
+
+/**
+ * Convert one <Event> element; throws if it isn't one
+ */
+export function windowsEventToJson(xml: string): WindowsEvent {
+    const root = parseXml(xml);
+    if (root?.name !== 'Event') throw new Error('not a Windows <Event>');
+
+    const event: WindowsEvent = {};
+    const system = child(root, 'System');
+    if (system) {
+        const provider = child(system, 'Provider');
+        event.provider = provider?.attributes.Name;
+        event.provider_guid = provider?.attributes.Guid;
+        event.event_id = number(child(system, 'EventID')?.text);
+        event.version = number(child(system, 'Version')?.text);
+        event.level = number(child(system, 'Level')?.text);
+        event.task = number(child(system, 'Task')?.text);
+        event.opcode = number(child(system, 'Opcode')?.text);
+        event.keywords = child(system, 'Keywords')?.text || undefined;
+        event.time_created = child(system, 'TimeCreated')?.attributes.SystemTime;
+        event.record_id = number(child(system, 'EventRecordID')?.text);
+        event.activity_id = child(system, 'Correlation')?.attributes.ActivityID;
+        event.process_id = number(child(system, 'Execution')?.attributes.ProcessID);
+        event.thread_id = number(child(system, 'Execution')?.attributes.ThreadID);
+        event.channel = child(system, 'Channel')?.text || undefined;
+        event.computer = child(system, 'Computer')?.text || undefined;
+        event.user_sid = child(system, 'Security')?.attributes.UserID;
+    }
+
+    const eventData = child(root, 'EventData');
+    if (eventData) {
+        const named: Record<string, string | null> = {};
+        const unnamed: Array<string | null> = [];
+        for (const item of eventData.children) {
+            if (item.name === 'Binary') {
+                event.binary = item.text;
+            } else if (item.attributes.Name !== undefined) {
+                named[item.attributes.Name] = item.text === '' ? null : item.text;
+            } else {
+                unnamed.push(item.text === '' ? null : item.text);
+            }
+        }
+        if (Object.keys(named).length > 0) event.event_data = named;
+        if (unnamed.length > 0) event.data = unnamed;
+    }
+
+    const userData = child(root, 'UserData');
+    if (userData) {
+        event.user_data = Object.fromEntries(userData.children.map((item) => [item.name, toValue(item)]));
+    }
+
+    const rendering = child(root, 'RenderingInfo');
+    if (rendering) {
+        event.message = child(rendering, 'Message')?.text || undefined;
+        event.level_name = child(rendering, 'Level')?.text || undefined;
+        event.task_name = child(rendering, 'Task')?.text || undefined;
+        event.opcode_name = child(rendering, 'Opcode')?.text || undefined;
+        const keywords = child(rendering, 'Keywords')?.children.map((item) => item.text).filter((text) => text.length > 0);
+        if (keywords && keywords.length > 0) event.keyword_names = keywords;
+    }
+
+    // Drop the fields this event doesn't have
+    return Object.fromEntries(Object.entries(event).filter(([, value]) => value !== undefined)) as WindowsEvent;
+}
+
+/**
+ * Minimal XML reader for rendered events: elements, attributes, text,
+ * CDATA and the predefined/numeric entities (no DTDs, no namespaces)
+ */
+function parseXml(xml: string): XmlElement | null {
+    const stack: XmlElement[] = [];
+    let root: XmlElement | null = null;
+
+    for (const match of xml.matchAll(TOKEN)) {
+        const [, cdata, closing, tag, attributes, selfClosing, text] = match;
+        const parent = stack[stack.length - 1];
+
+        if (cdata !== undefined || text !== undefined) {
+            if (parent) parent.text += cdata ?? decodeEntities(text!);
+        } else if (tag !== undefined && closing) {
+            stack.pop();
+        } else if (tag !== undefined) {
+            const element: XmlElement = {
+                name: tag.slice(tag.indexOf(':') + 1),
+                attributes: Object.fromEntries([...(attributes ?? '').matchAll(ATTRIBUTE)].map(([, name, double, single]) => [name!, decodeEntities(double ?? single ?? '')])),
+                children: [],
+                text: '',
+            };
+            if (parent) parent.children.push(element);
+            else root ??= element;
+            if (!selfClosing) stack.push(element);
+        }
+    }
+
+    // Whitespace between elements is formatting, not content
+    const trim = (element: XmlElement): void => {
+        if (element.children.length > 0) element.text = element.text.trim();
+        element.children.forEach(trim);
+    };
+    if (root) trim(root);
+    return root;
+}
+
+function decodeEntities(value: string): string {
+    return value.replace(/&(lt|gt|amp|quot|apos|#x[0-9a-f]+|#\d+);/gi, (_, entity: string) => {
+        switch (entity) {
+            case 'lt': return '<';
+            case 'gt': return '>';
+            case 'amp': return '&';
+            case 'quot': return '"';
+            case 'apos': return '\'';
+            default: return String.fromCodePoint(entity[1] === 'x' || entity[1] === 'X' ? parseInt(entity.slice(2), 16) : Number(entity.slice(1)));
+        }
+    });
+}
+
+function child(element: XmlElement, name: string): XmlElement | undefined {
+    return element.children.find((item) => item.name === name);
+}
+
+/** Elements with children become objects (attributes included), leaves their text */
+function toValue(element: XmlElement): unknown {
+    if (element.children.length === 0) {
+        return Object.keys(element.attributes).length === 0 ? element.text : { ...element.attributes, ...(element.text ? { value: element.text } : {}) };
+    }
+    return {
+        ...element.attributes,
+        ...Object.fromEntries(element.children.map((item) => [item.name, toValue(item)])),
+    };
+}
+
+function number(value: string | undefined): number | undefined {
+    if (value === undefined || value === '') return undefined;
+    const parsed = Number(value);
+    return Number.isFinite(parsed) ? parsed : undefined;
+}
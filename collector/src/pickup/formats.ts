@@ -0,0 +1,74 @@
+/**
+ * Split a picked-up file into records, one event each:
+ * - lines: every non-empty line as-is (syslog files, application logs)
+ * - json: a JSON array (one record per item) or newline-delimited JSON
+ * - csv: one JSON object per row, keyed by the header row (RFC 4180 quoting)
+ */
+export type PickupFormat = 'lines' | 'json' | 'csv';
+
+export function parseRecords(text: string, format: PickupFormat, delimiter = ','): string[] {
+    const body = text.replace(/^\uFEFF/, '');
+
+    switch (format) {
+        case 'lines':
+            return body.split(/\r?\n/).filter((line) => line.trim().length > 0);
+
+        case 'json': {
+            const trimmed = body.trim();
+            if (trimmed.startsWith('[')) {
+                const items: unknown = JSON.parse(trimmed);
+                if (!Array.isArray(items)) throw new Error('expected a JSON array');
+                return items.map((item) => (typeof item === 'string' ? item : JSON.stringify(item)));
+            }
+            return trimmed.split(/\r?\n/).filter((line) => line.trim().length > 0);
+        }
+
+        case 'csv': {
+            const [header, ...rows] = parseCsvRows(body, delimiter);
+            if (!header) return [];
+            return rows
+                .filter((row) => row.some((cell) => cell.length > 0))
+                .map((row) => JSON.stringify(Object.fromEntries(header.map((column, i) => [column, row[i] ?? '']))));
+        }
+    }
+}
+
+function parseCsvRows(text: string, delimiter: string): string[][] {
+    const rows: string[][] = [];
+    let row: string[] = [];
+    let cell = '';
+    let quoted = false;
+
+    for (let i = 0; i < text.length; i++) {
+        const c = text[i];
+        if (quoted) {
+            if (c === '"' && text[i + 1] === '"') {
+                cell += '"';
+                i++;
+            } else if (c === '"') {
+                quoted = false;
+            } else {
+                cell += c;
+            }
+        } else if (c === '"' && cell === '') {
+            quoted = true;
+        } else if (c === delimiter) {
+            row.push(cell);
+            cell = '';
+        } else if (c === '\n' || c === '\r') {
+            if (c === '\r' && text[i + 1] === '\n') i++;
+            row.push(cell);
+            rows.push(row);
+            row = [];
+            cell = '';
+        } else {
+            cell += c;
+        }
+    }
+
+    if (cell !== '' || row.length > 0) {
+        row.push(cell);
+        rows.push(row);
+    }
+    return rows;
+}
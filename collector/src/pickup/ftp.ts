@@ -0,0 +1,274 @@
+import net from 'node:net';
+import tls from 'node:tls';
+import { posix } from 'node:path';
+import type { PickupTarget, RemoteClient, RemoteFile } from './types.js';
+
+const TIMEOUT_MS = 30000;
+
+interface Reply {
+    code: number;
+    text: string;
+}
+
+/**
+ * Minimal FTP client (RFC 959) for file pickup: passive mode, binary transfers,
+ * MLSD listings with a NLST + SIZE/MDTM fallback for older servers, and
+ * explicit TLS (AUTH TLS, RFC 4217) on both connections for ftps://.
+ */
+export class FtpClient implements RemoteClient {
+    private target: PickupTarget;
+    private ca?: Buffer;
+    private socket: net.Socket | null = null;
+    private replies: Reply[] = [];
+    private waiters: { resolve: (reply: Reply) => void; reject: (err: Error) => void }[] = [];
+    private failure: Error | null = null;
+    private pending = '';
+    private multiline: { code: string; lines: string[] } | null = null;
+
+    constructor(target: PickupTarget, ca?: Buffer) {
+        this.target = target;
+        this.ca = ca;
+    }
+
+    public async connect(): Promise<void> {
+        const socket = net.connect(this.target.port, this.target.host);
+        await waitFor(socket, 'connect');
+        this.attach(socket);
+        await this.expect(null, 220);
+
+        if (this.target.protocol === 'ftps') {
+            await this.expect('AUTH TLS', 234);
+            socket.removeAllListeners('data');
+            const secure = tls.connect({ socket, servername: this.target.host, ca: this.ca });
+            await waitFor(secure, 'secureConnect');
+            this.attach(secure);
+            await this.expect('PBSZ 0', 200);
+            await this.expect('PROT P', 200);
+        }
+
+        const user = await this.expect(`USER ${this.target.username}`, 230, 331);
+        if (user.code === 331) {
+            await this.expect(`PASS ${this.target.password ?? ''}`, 230, 202);
+        }
+        await this.expect('TYPE I', 200);
+    }
+
+    public async list(dir: string): Promise<RemoteFile[]> {
+        const mlsd = await this.transfer(`MLSD ${dir}`).catch((err: Error) => err);
+        if (!(mlsd instanceof Error)) {
+            return parseMlsd(mlsd.toString('utf8'), dir);
+        }
+        if (!/^50[0-4]/.test(mlsd.message)) throw mlsd;
+
+        // No MLSD: names from NLST, then SIZE/MDTM per file (fails for directories)
+        const names = (await this.transfer(`NLST ${dir}`)).toString('utf8').split(/\r?\n/).filter((n) => n.length > 0);
+        const files: RemoteFile[] = [];
+        for (const entry of names) {
+            const name = posix.basename(entry);
+            const path = posix.join(dir, name);
+            const size = await this.command(`SIZE ${path}`);
+            if (size.code !== 213) continue;
+            const mdtm = await this.command(`MDTM ${path}`);
+            files.push({
+                name,
+                path,
+                size: Number(size.text),
+                modifiedAt: mdtm.code === 213 ? parseFtpTime(mdtm.text) : 0,
+            });
+        }
+        return files;
+    }
+
+    public download(path: string): Promise<Buffer> {
+        return this.transfer(`RETR ${path}`);
+    }
+
+    public async remove(path: string): Promise<void> {
+        await this.expect(`DELE ${path}`, 250);
+    }
+
+    public async close(): Promise<void> {
+        if (!this.socket) return;
+        await this.command('QUIT').catch(() => undefined);
+        this.socket.destroy();
+        this.socket = null;
+    }
+
+    /**
+     * Run a command that uses a passive data connection and return what it sent
+     */
+    private async transfer(command: string): Promise<Buffer> {
+        const data = await this.openDataConnection();
+        data.setTimeout(TIMEOUT_MS, () => data.destroy(new Error('FTP data connection timed out')));
+        const received = new Promise<Buffer>((resolve, reject) => {
+            const chunks: Buffer[] = [];
+            data.on('data', (chunk: Buffer) => chunks.push(chunk));
+            data.on('end', () => resolve(Buffer.concat(chunks)));
+            data.on('error', reject);
+        });
+        received.catch(() => undefined); // Surfaced below, once the command was accepted
+
+        try {
+            await this.expect(command, 125, 150);
+            const body = await received;
+            await this.expect(null, 226, 250);
+            return body;
+        } finally {
+            data.destroy();
+        }
+    }
+
+    private async openDataConnection(): Promise<net.Socket> {
+        // The control connection's address is used for both modes: servers behind
+        // NAT often advertise a private address in their PASV reply
+        const host = this.socket!.remoteAddress ?? this.target.host;
+        let port: number;
+
+        const epsv = await this.command('EPSV');
+        if (epsv.code === 229) {
+            port = Number(/\(\|\|\|(\d+)\|\)/.exec(epsv.text)?.[1]);
+        } else {
+            const pasv = await this.expect('PASV', 227);
+            const numbers = /(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)/.exec(pasv.text);
+            if (!numbers) throw new Error(`Unexpected PASV reply: ${pasv.text}`);
+            port = Number(numbers[5]) * 256 + Number(numbers[6]);
+        }
+
+        const socket = net.connect(port, host);
+        await waitFor(socket, 'connect');
+        if (this.target.protocol !== 'ftps') return socket;
+
+        // Servers usually require the TLS session of the control connection to be
+        // reused. The handshake completes once the server accepts the transfer.
+        return tls.connect({
+            socket,
+            servername: this.target.host,
+            ca: this.ca,
+            session: (this.socket as tls.TLSSocket).getSession(),
+        });
+    }
+
+    private async expect(command: string | null, ...codes: number[]): Promise<Reply> {
+        const reply = command === null ? await this.read() : await this.command(command);
+        if (!codes.includes(reply.code)) {
+            const shown = command?.startsWith('PASS ') ? 'PASS ***' : command;
+            throw new Error(`${reply.code} ${reply.text}${shown ? ` (after ${shown})` : ''}`);
+        }
+        return reply;
+    }
+
+    private command(command: string): Promise<Reply> {
+        this.socket!.write(`${command}\r\n`);
+        return this.read();
+    }
+
+    private read(): Promise<Reply> {
+        const reply = this.replies.shift();
+        if (reply) return Promise.resolve(reply);
+        if (this.failure) return Promise.reject(this.failure);
+
+        return new Promise((resolve, reject) => {
+            this.waiters.push({ resolve, reject });
+        });
+    }
+
+    private attach(socket: net.Socket): void {
+        this.socket = socket;
+        socket.setTimeout(TIMEOUT_MS, () => socket.destroy(new Error('FTP control connection timed out')));
+        socket.on('data', (chunk: Buffer) => this.onData(chunk.toString('utf8')));
+        socket.on('error', (err) => this.fail(err));
+        socket.on('close', () => this.fail(new Error('FTP control connection closed')));
+    }
+
+    /**
+     * Split the control stream into replies ("123 text", or "123-" ... "123 text")
+     */
+    private onData(text: string): void {
+        this.pending += text;
+        let newline: number;
+        while ((newline = this.pending.indexOf('\n')) >= 0) {
+            const line = this.pending.slice(0, newline).replace(/\r$/, '');
+            this.pending = this.pending.slice(newline + 1);
+
+            if (this.multiline) {
+                this.multiline.lines.push(line);
+                if (line.startsWith(`${this.multiline.code} `)) {
+                    this.deliver({ code: Number(this.multiline.code), text: this.multiline.lines.join('\n') });
+                    this.multiline = null;
+                }
+            } else if (/^\d{3}-/.test(line)) {
+                this.multiline = { code: line.slice(0, 3), lines: [line.slice(4)] };
+            } else if (/^\d{3}( |$)/.test(line)) {
+                this.deliver({ code: Number(line.slice(0, 3)), text: line.slice(4) });
+            }
+        }
+    }
+
+    private deliver(reply: Reply): void {
+        const waiter = this.waiters.shift();
+        if (waiter) waiter.resolve(reply);
+        else this.replies.push(reply);
+    }
+
+    private fail(err: Error): void {
+        this.failure ??= err;
+        for (const waiter of this.waiters.splice(0)) {
+            waiter.reject(err);
+        }
+    }
+}
+
+/**
+ * MLSD lines: "type=file;size=1234;modify=20240131120000; name.csv"
+ */
+function parseMlsd(text: string, dir: string): RemoteFile[] {
+    const files: RemoteFile[] = [];
+    for (const line of text.split(/\r?\n/)) {
+        const space = line.indexOf(' ');
+        if (space < 0) continue;
+
+        const facts = new Map<string, string>();
+        for (const fact of line.slice(0, space).split(';')) {
+            const [key, value] = fact.split('=');
+            if (key && value !== undefined) facts.set(key.toLowerCase(), value);
+        }
+        if (facts.get('type')?.toLowerCase() !== 'file') continue;
+
+        const name = line.slice(space + 1);
+        files.push({
+            name,
+            path: posix.join(dir, name),
+            size: Number(facts.get('size') ?? 0),
+            modifiedAt: parseFtpTime(facts.get('modify') ?? ''),
+        });
+    }
+    return files;
+}
+
+/**
+ * YYYYMMDDHHMMSS[.sss] in UTC (MDTM, MLSD modify)
+ */
+function parseFtpTime(value: string): number {
+    const m = /(\d{4})(\d{2})(\d{2})(\d{2})(\d{2})(\d{2})(?:\.(\d+))?/.exec(value);
+    if (!m) return 0;
+    return Date.UTC(+m[1]!, +m[2]! - 1, +m[3]!, +m[4]!, +m[5]!, +m[6]!, Number(`0.${m[7] ?? 0}`) * 1000);
+}
+
+function waitFor(socket: net.Socket, event: 'connect' | 'secureConnect'): Promise<void> {
+    return new Promise((resolve, reject) => {
+        const timer = setTimeout(() => {
+            socket.destroy();
+            reject(new Error(`Timed out connecting to ${socket.remoteAddress ?? 'server'}`));
+        }, TIMEOUT_MS);
+        socket.once(event, () => {
+            clearTimeout(timer);
+            socket.removeListener('error', onError);
+            resolve();
+        });
+        const onError = (err: Error) => {
+            clearTimeout(timer);
+            reject(err);
+        };
+        socket.once('error', onError);
+    });
+}
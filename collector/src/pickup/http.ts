@@ -0,0 +1,114 @@
+import http from 'node:http';
+import https from 'node:https';
+import type { PickupTarget } from './types.js';
+
+const REQUEST_TIMEOUT_MS = 60000;
+const MAX_RESPONSE_BYTES = 100 * 1024 * 1024;
+const DEFAULT_RETRY_AFTER_MS = 60000; // 429/503 without Retry-After
+
+/**
+ * Validators of the last response, sent back as If-None-Match /
+ * If-Modified-Since
+ */
+export interface HttpValidators {
+    etag?: string;
+    last_modified?: string;
+}
+
+export type HttpPollResult =
+    | { modified: false }
+    | { modified: true; body: Buffer; validators: HttpValidators };
+
+/**
+ * The server asked to slow down (429, or 503 with Retry-After)
+ */
+export class RateLimitedError extends Error {
+    public readonly retryAfterMs: number;
+
+    constructor(status: number, retryAfterMs: number) {
+        super(`HTTP ${status}, retrying in ${Math.round(retryAfterMs / 1000)}s`);
+        this.retryAfterMs = retryAfterMs;
+    }
+}
+
+/**
+ * Conditional GET of a REST endpoint or published export
+ * (http(s):// PICKUP_URLS): with the validators of the previous response,
+ * an unchanged resource costs the server a 304 and nothing is downloaded.
+ * URL credentials are sent as basic auth; other schemes (API tokens, bearer
+ * tokens) go in headers (PICKUP_HTTP_HEADERS).
+ */
+export function fetchConditional(
+    target: PickupTarget,
+    validators: HttpValidators | undefined,
+    options: { headers: Record<string, string>; ca?: Buffer }
+): Promise<HttpPollResult> {
+    const headers: Record<string, string> = { 'Accept-Encoding': 'identity', ...options.headers };
+    if (target.username) {
+        headers.Authorization = `Basic ${Buffer.from(`${target.username}:${target.password ?? ''}`).toString('base64')}`;
+    }
+    if (validators?.etag) headers['If-None-Match'] = validators.etag;
+    if (validators?.last_modified) headers['If-Modified-Since'] = validators.last_modified;
+
+    const request = target.protocol === 'https' ? https.request : http.request;
+    return new Promise((resolve, reject) => {
+        const req = request({
+            host: target.host,
+            port: target.port,
+            path: target.dir,
+            method: 'GET',
+            headers,
+            ca: options.ca,
+            timeout: REQUEST_TIMEOUT_MS,
+        }, (res) => {
+            const status = res.statusCode ?? 0;
+            if (status === 304) {
+                res.resume();
+                resolve({ modified: false });
+                return;
+            }
+            if (status === 429 || (status === 503 && res.headers['retry-after'])) {
+                res.resume();
+                reject(new RateLimitedError(status, retryAfterMs(res.headers['retry-after'])));
+                return;
+            }
+            if (status < 200 || status >= 300) {
+                res.resume();
+                reject(new Error(`HTTP ${status} from ${target.label}`));
+                return;
+            }
+
+            const chunks: Buffer[] = [];
+            let size = 0;
+            res.on('data', (chunk: Buffer) => {
+                size += chunk.length;
+                if (size > MAX_RESPONSE_BYTES) {
+                    req.destroy(new Error(`response from ${target.label} exceeds ${MAX_RESPONSE_BYTES} bytes`));
+                    return;
+                }
+                chunks.push(chunk);
+            });
+            res.on('end', () => resolve({
+                modified: true,
+                body: Buffer.concat(chunks),
+                validators: {
+                    etag: res.headers.etag,
+                    last_modified: res.headers['last-modified'],
+                },
+            }));
+            res.on('error', reject);
+        });
+        req.on('timeout', () => req.destroy(new Error(`no response from ${target.label} in ${REQUEST_TIMEOUT_MS / 1000}s`)));
+        req.on('error', reject);
+        req.end();
+    });
+}
+
+/** Retry-After in seconds or as an HTTP date */
+function retryAfterMs(value: string | undefined): number {
+    if (!value) return DEFAULT_RETRY_AFTER_MS;
+    const seconds = Number(value);
+    if (Number.isFinite(seconds)) return Math.max(0, seconds * 1000);
+    const at = Date.parse(value);
+    return Number.isNaN(at) ? DEFAULT_RETRY_AFTER_MS : Math.max(0, at - Date.now());
+}
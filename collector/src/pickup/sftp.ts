@@ -0,0 +1,108 @@
+import { createHash } from 'node:crypto';
+import { posix } from 'node:path';
+import type { Client, SFTPWrapper } from 'ssh2';
+import type { PickupTarget, RemoteClient, RemoteFile } from './types.js';
+import { log } from '../logger.js';
+
+const S_IFMT = 0o170000;
+const S_IFREG = 0o100000;
+
+const warnedHostKeys = new Set<string>(); // Unpinned keys are reported once
+
+export interface SftpOptions {
+    privateKey?: Buffer;
+    hostKeys: string[]; // Accepted "SHA256:..." fingerprints; empty accepts any (logged)
+}
+
+/**
+ * SFTP client for file pickup, on top of ssh2 (loaded on first use so the
+ * collector does not need it unless an sftp:// source is configured).
+ */
+export class SftpClient implements RemoteClient {
+    private target: PickupTarget;
+    private options: SftpOptions;
+    private conn: Client | null = null;
+    private sftp: SFTPWrapper | null = null;
+
+    constructor(target: PickupTarget, options: SftpOptions) {
+        this.target = target;
+        this.options = options;
+    }
+
+    public async connect(): Promise<void> {
+        const { Client } = await import('ssh2');
+        const conn = new Client();
+        this.conn = conn;
+
+        await new Promise<void>((resolve, reject) => {
+            conn.once('ready', resolve);
+            conn.once('error', reject);
+            conn.connect({
+                host: this.target.host,
+                port: this.target.port,
+                username: this.target.username,
+                password: this.target.password,
+                privateKey: this.options.privateKey,
+                readyTimeout: 30000,
+                hostVerifier: (key: Buffer) => this.verifyHostKey(key),
+            });
+        });
+
+        this.sftp = await new Promise<SFTPWrapper>((resolve, reject) => {
+            conn.sftp((err, sftp) => (err ? reject(err) : resolve(sftp)));
+        });
+    }
+
+    public list(dir: string): Promise<RemoteFile[]> {
+        return new Promise((resolve, reject) => {
+            this.sftp!.readdir(dir, (err, entries) => {
+                if (err) {
+                    reject(err);
+                    return;
+                }
+                resolve(entries
+                    .filter((entry) => (entry.attrs.mode & S_IFMT) === S_IFREG)
+                    .map((entry) => ({
+                        name: entry.filename,
+                        path: posix.join(dir, entry.filename),
+                        size: entry.attrs.size,
+                        modifiedAt: entry.attrs.mtime * 1000,
+                    })));
+            });
+        });
+    }
+
+    public download(path: string): Promise<Buffer> {
+        return new Promise((resolve, reject) => {
+            this.sftp!.readFile(path, (err, data) => (err ? reject(err) : resolve(data)));
+        });
+    }
+
+    public remove(path: string): Promise<void> {
+        return new Promise((resolve, reject) => {
+            this.sftp!.unlink(path, (err) => (err ? reject(err) : resolve()));
+        });
+    }
+
+    public async close(): Promise<void> {
+        this.sftp?.end();
+        this.conn?.end();
+        this.sftp = null;
+        this.conn = null;
+    }
+
+    private verifyHostKey(key: Buffer): boolean {
+        const fingerprint = `SHA256:${createHash('sha256').update(key).digest('base64').replace(/=+$/, '')}`;
+        if (this.options.hostKeys.length === 0) {
+            if (warnedHostKeys.has(fingerprint)) return true;
+            warnedHostKeys.add(fingerprint);
+            log.warn(`⚠️ Pickup: accepting ${this.target.host} host key ${fingerprint} (set PICKUP_SSH_HOST_KEYS to pin it)`);
+            return true;
+        }
+        if (!this.options.hostKeys.includes(fingerprint)) {
+            log.error(`❌ Pickup: ${this.target.host} host key ${fingerprint} is not in PICKUP_SSH_HOST_KEYS`);
+            return false;
+        }
+        return true;
+    }
+}
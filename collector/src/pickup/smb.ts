@@ -0,0 +1,119 @@
+import { execFile } from 'node:child_process';
+import { mkdtemp, readFile, rm } from 'node:fs/promises';
+import { tmpdir } from 'node:os';
+import { join, posix } from 'node:path';
+import { config } from '../config.js';
+import type { PickupTarget, RemoteClient, RemoteFile } from './types.js';
+
+const COMMAND_TIMEOUT_MS = 60000;
+const DOWNLOAD_TIMEOUT_MS = 10 * 60000;
+
+// "  audit 2024-01.csv     A    1234  Mon Jan 15 10:00:00 2024"
+const LS_LINE = /^ {2}(.+?)\s+([A-Z]*)\s+(\d+)\s+(\w{3} \w{3} +\d+ \d\d:\d\d:\d\d \d{4})$/;
+
+/**
+ * SMB/CIFS client for file pickup, driving Samba's smbclient (SMB2/3, NTLMv2
+ * with domain accounts, signing/encryption as negotiated by the server).
+ * Each operation is a short smbclient session; the password is passed in the
+ * environment, never on the command line.
+ *
+ * Remote paths are "/<share>/<dir>/<file>", as in the smb:// URL.
+ */
+export class SmbClient implements RemoteClient {
+    private target: PickupTarget;
+    private share: string;
+
+    constructor(target: PickupTarget) {
+        this.target = target;
+        this.share = target.dir.split('/').filter((part) => part.length > 0)[0] ?? '';
+    }
+
+    public async connect(): Promise<void> {
+        if (!this.share) {
+            throw new Error(`No share in ${this.target.label} (expected smb://server/share/dir)`);
+        }
+    }
+
+    public async list(dir: string): Promise<RemoteFile[]> {
+        const output = await this.run(`cd ${quote(this.sharePath(dir) || '\\')}; ls`, COMMAND_TIMEOUT_MS);
+
+        const files: RemoteFile[] = [];
+        for (const line of output.split('\n')) {
+            const m = LS_LINE.exec(line.replace(/\r$/, ''));
+            if (!m || m[2]!.includes('D')) continue; // Directories (including . and ..)
+
+            const name = m[1]!;
+            files.push({
+                name,
+                path: posix.join(dir, name),
+                size: Number(m[3]),
+                modifiedAt: Date.parse(m[4]!), // smbclient prints local time
+            });
+        }
+        return files;
+    }
+
+    public async download(path: string): Promise<Buffer> {
+        // smbclient can only download to a file; /tmp may be read-only in a container
+        const dir = await mkdtemp(join(config.STATE_DIR ?? tmpdir(), 'centinela-smb-'));
+        const local = join(dir, 'file');
+        try {
+            await this.run(`get ${quote(this.sharePath(path))} ${quote(local)}`, DOWNLOAD_TIMEOUT_MS);
+            return await readFile(local);
+        } finally {
+            await rm(dir, { recursive: true, force: true });
+        }
+    }
+
+    public async remove(path: string): Promise<void> {
+        await this.run(`del ${quote(this.sharePath(path))}`, COMMAND_TIMEOUT_MS);
+    }
+
+    public async close(): Promise<void> {
+        // Nothing kept open between operations
+    }
+
+    /**
+     * "/share/dir/file" -> "dir\file" (relative to the share)
+     */
+    private sharePath(path: string): string {
+        const parts = path.split('/').filter((part) => part.length > 0);
+        return parts.slice(1).join('\\');
+    }
+
+    private run(commands: string, timeout: number): Promise<string> {
+        const args = [
+            `//${this.target.host}/${this.share}`,
+            '--port', String(this.target.port),
+            '--user', this.target.username,
+            '--command', commands,
+        ];
+        if (this.target.domain) args.push('--workgroup', this.target.domain);
+        if (this.target.password === undefined) args.push('--no-pass');
+
+        return new Promise((resolve, reject) => {
+            execFile('smbclient', args, {
+                timeout,
+                maxBuffer: 64 * 1024 * 1024,
+                env: { ...process.env, PASSWD: this.target.password ?? '' },
+            }, (err, stdout, stderr) => {
+                // smbclient reports most failures as NT_STATUS_* (exit code is not always set)
+                const status = /NT_STATUS_\w+/.exec(`${stdout}\n${stderr}`)?.[0];
+                if ((err as NodeJS.ErrnoException | null)?.code === 'ENOENT') {
+                    reject(new Error('smbclient not found (install samba-client)'));
+                } else if (status) {
+                    reject(new Error(status));
+                } else if (err) {
+                    reject(new Error(stderr.trim() || err.message));
+                } else {
+                    resolve(stdout);
+                }
+            });
+        });
+    }
+}
+
+function quote(value: string): string {
+    if (value.includes('"')) throw new Error(`Unsupported character in path: ${value}`);
+    return `"${value}"`;
+}
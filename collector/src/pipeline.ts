@@ -0,0 +1,82 @@
+import type { MessageBuffer, SyslogEvent } from './buffer.js';
+import type { ListenerSpec } from './config.js';
+import { metrics } from './metrics.js';
+import { sourcePolicy } from './greylist.js';
+import { ruleEngine } from './rules.js';
+import { anonymizer } from './anonymize.js';
+import { parseSyslogFields } from './events.js';
+import { sourceMap } from './source-map.js';
+import { sourceRateLimit } from './source-rate-limit.js';
+import { clockSkew } from './clock-skew.js';
+import { reverseDns } from './reverse-dns.js';
+import { forwardingPolicy } from './forwarding-policy.js';
+import { tracer } from './tracing.js';
+import { beginContext, eventLogFields } from './event-context.js';
+import { log } from './logger.js';
+
+/**
+ * Common path for every event received on a local listener (UDP, TCP, raw):
+ * per-source rate limit, source policy, rules, anonymization, reverse DNS, header parsing and
+ * timestamp sanity check, forwarding policy (severity/facility), then the send buffer.
+ *
+ * Events generated by the collector itself (honeypot hits, DNS and discovery
+ * observations, its own metrics) skip the rate limit and source policy: their
+ * address is the subject of the event, not a sender.
+ *
+ * Tenant, site, source and static tags come from the source map, then the
+ * named listener that received the event, unless a relay already set them;
+ * tag rules run after and take precedence.
+ *
+ * The event's context (trace ID, receive time, sender) is created first, so
+ * every later stage can name the event in its logs. With LOG_LEVEL=debug,
+ * each event dropped on the way is logged with the stage that dropped it.
+ */
+export function ingestEvent(
+    buffer: MessageBuffer,
+    event: SyslogEvent,
+    options: { skipSourcePolicy?: boolean; listener?: ListenerSpec } = {},
+): void {
+    metrics.incrementReceived();
+    tracer.begin(event, beginContext(event));
+
+    if (!sourceMap.apply(event)) return dropped(event, 'the source map (UNMAPPED_SOURCE_POLICY)');
+    if (options.listener) {
+        event.tenant_id ??= options.listener.tenant;
+        event.site_id ??= options.listener.site;
+        event.source_id ??= options.listener.source;
+        if (options.listener.tags) event.tags = { ...options.listener.tags, ...event.tags };
+    }
+
+    if (!options.skipSourcePolicy && !sourceRateLimit.admit(event)) return dropped(event, 'the per-source rate limit');
+    if (!options.skipSourcePolicy && !sourcePolicy.admit(event)) return dropped(event, 'the source policy');
+    if (!ruleEngine.apply(event)) return dropped(event, 'a rule');
+    anonymizer.apply(event);
+    reverseDns.apply(event);
+    parseSyslogFields(event);
+
+    // A device with a broken clock is reported (once a day) with its own event
+    const skewAlert = clockSkew.apply(event);
+    if (skewAlert) ingestEvent(buffer, skewAlert, { skipSourcePolicy: true });
+
+    const route = forwardingPolicy.route(event);
+    if (route === 'drop') return dropped(event, 'a forwarding policy');
+    if (route === 'archived') return;
+
+    const added = buffer.push(event);
+    if (added) {
+        tracer.queued(event);
+        if (route === 'immediate') forwardingPolicy.flush();
+    } else {
+        metrics.incrementDropped();
+        dropped(event, 'a full send buffer');
+        if (buffer.dropped % 100 === 0) {
+            log.warn(`⚠️ Buffer full! Dropped ${buffer.dropped} events so far.`);
+        }
+    }
+}
+
+function dropped(event: SyslogEvent, stage: string): void {
+    if (!log.enabled('debug')) return;
+    const fields = eventLogFields(event);
+    log.debug(`🗑️ Event ${fields.trace_id} from ${event.source_ip} dropped by ${stage}`, fields);
+}
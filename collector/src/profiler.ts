@@ -0,0 +1,53 @@
+import v8 from 'node:v8';
+import { Session } from 'node:inspector/promises';
+import type { Readable } from 'node:stream';
+
+let cpuProfiling = false;
+
+/**
+ * Record a CPU profile of the running collector for `seconds`. Returns it in
+ * the .cpuprofile format (open in Chrome DevTools or speedscope). Only one
+ * profile at a time; throws if another is being recorded.
+ */
+export async function captureCpuProfile(seconds: number): Promise<string> {
+    if (cpuProfiling) throw new Error('A CPU profile is already being recorded');
+    cpuProfiling = true;
+
+    const session = new Session();
+    session.connect();
+    try {
+        await session.post('Profiler.enable');
+        await session.post('Profiler.start');
+        await new Promise((resolve) => setTimeout(resolve, seconds * 1000));
+        const { profile } = await session.post('Profiler.stop');
+        return JSON.stringify(profile);
+    } finally {
+        session.disconnect();
+        cpuProfiling = false;
+    }
+}
+
+/**
+ * Heap snapshot in the .heapsnapshot format (Chrome DevTools, Memory tab).
+ * Taking it pauses the collector for about a second per few hundred MB of
+ * heap, so UDP datagrams may be lost meanwhile.
+ */
+export function heapSnapshot(): Readable {
+    return v8.getHeapSnapshot();
+}
+
+/**
+ * Runtime memory figures, to decide whether a heap snapshot is worth taking
+ */
+export function runtimeStats(): Record<string, unknown> {
+    const heap = v8.getHeapStatistics();
+    return {
+        memory: process.memoryUsage(),
+        heap: {
+            used_bytes: heap.used_heap_size,
+            total_bytes: heap.total_heap_size,
+            limit_bytes: heap.heap_size_limit,
+        },
+        cpu_profiling: cpuProfiling,
+    };
+}
@@ -0,0 +1,134 @@
+import { createHmac, timingSafeEqual } from 'node:crypto';
+import type http from 'node:http';
+import type { TLSSocket } from 'node:tls';
+import type { PushAuthSpec } from './config.js';
+
+const STRIPE_TOLERANCE_SECONDS = 300; // Stripe's own default; older signatures are replays
+
+/**
+ * Checks the credentials of one HTTP push source
+ */
+export interface PushAuthProvider {
+    readonly scheme: PushAuthSpec['scheme'];
+    /** The signature covers the body: authorize() runs once it is read, with the bytes as received */
+    readonly signsBody: boolean;
+    /** WWW-Authenticate challenge sent with a 401 */
+    readonly challenge?: string;
+    authorize(req: http.IncomingMessage, body?: Buffer): boolean;
+}
+
+/**
+ * Push Source Authentication
+ *
+ * Each /v1/push/<source> endpoint has its own scheme (HTTP_PUSH_AUTH), so
+ * services that can't send a bearer token can still push:
+ * - token: shared secret as `Authorization: Bearer` or `X-Push-Secret`
+ *   (what HTTP_PUSH_SOURCES configures)
+ * - basic: `Authorization: Basic` user and password
+ * - hmac: hex HMAC-SHA256 of the body in a header of your choice
+ *   (`sha256=` prefix optional)
+ * - hmac-github: GitHub webhooks (X-Hub-Signature-256)
+ * - hmac-stripe: Stripe webhooks (Stripe-Signature, timestamped: older than
+ *   5 minutes is rejected)
+ * - mtls: a client certificate issued by HTTP_PUSH_TLS_CA, optionally with
+ *   a given CN
+ *
+ * Signatures are checked against the body as sent (before gzip decoding).
+ */
+export function createPushAuth(spec: PushAuthSpec): PushAuthProvider {
+    switch (spec.scheme) {
+        case 'token':
+            return tokenAuth(spec.secret!);
+        case 'basic':
+            return basicAuth(spec.user!, spec.secret!);
+        case 'hmac':
+            return hmacAuth('hmac', spec.header!, spec.secret!);
+        case 'hmac-github':
+            return hmacAuth('hmac-github', 'x-hub-signature-256', spec.secret!);
+        case 'hmac-stripe':
+            return stripeAuth(spec.secret!);
+        case 'mtls':
+            return mtlsAuth(spec.subject);
+    }
+}
+
+function tokenAuth(secret: string): PushAuthProvider {
+    const expected = Buffer.from(secret);
+    return {
+        scheme: 'token',
+        signsBody: false,
+        authorize(req) {
+            const header = req.headers.authorization;
+            const provided = header?.startsWith('Bearer ')
+                ? header.slice('Bearer '.length)
+                : req.headers['x-push-secret'];
+            return typeof provided === 'string' && safeEqual(Buffer.from(provided), expected);
+        },
+    };
+}
+
+function basicAuth(user: string, password: string): PushAuthProvider {
+    const expected = Buffer.from(`${user}:${password}`);
+    return {
+        scheme: 'basic',
+        signsBody: false,
+        challenge: 'Basic realm="centinela-push", charset="UTF-8"',
+        authorize(req) {
+            const header = req.headers.authorization;
+            if (!header?.startsWith('Basic ')) return false;
+            return safeEqual(Buffer.from(header.slice('Basic '.length).trim(), 'base64'), expected);
+        },
+    };
+}
+
+function hmacAuth(scheme: 'hmac' | 'hmac-github', header: string, key: string): PushAuthProvider {
+    return {
+        scheme,
+        signsBody: true,
+        authorize(req, body) {
+            const value = req.headers[header];
+            if (typeof value !== 'string' || !body) return false;
+            const signature = value.trim().replace(/^sha256=/i, '');
+            return safeEqualHex(signature, createHmac('sha256', key).update(body).digest('hex'));
+        },
+    };
+}
+
+function stripeAuth(key: string): PushAuthProvider {
+    return {
+        scheme: 'hmac-stripe',
+        signsBody: true,
+        authorize(req, body) {
+            const value = req.headers['stripe-signature'];
+            if (typeof value !== 'string' || !body) return false;
+
+            // t=<unix seconds>,v1=<hex>[,v1=<hex> while a secret is rolled]
+            const fields = value.split(',').map((field) => field.trim().split('='));
+            const timestamp = fields.find(([name]) => name === 't')?.[1];
+            if (!timestamp || Math.abs(Date.now() / 1000 - Number(timestamp)) > STRIPE_TOLERANCE_SECONDS) return false;
+
+            const expected = createHmac('sha256', key).update(`${timestamp}.`).update(body).digest('hex');
+            return fields.some(([name, signature]) => name === 'v1' && signature !== undefined && safeEqualHex(signature, expected));
+        },
+    };
+}
+
+function mtlsAuth(subject?: string): PushAuthProvider {
+    return {
+        scheme: 'mtls',
+        signsBody: false,
+        authorize(req) {
+            const socket = req.socket as TLSSocket;
+            if (!socket.encrypted || !socket.authorized) return false;
+            return subject === undefined || socket.getPeerCertificate().subject?.CN === subject;
+        },
+    };
+}
+
+function safeEqual(candidate: Buffer, expected: Buffer): boolean {
+    return candidate.length === expected.length && timingSafeEqual(candidate, expected);
+}
+
+function safeEqualHex(candidate: string, expected: string): boolean {
+    return safeEqual(Buffer.from(candidate.toLowerCase()), Buffer.from(expected));
+}
@@ -0,0 +1,134 @@
+import { config } from './config.js';
+import { log } from './logger.js';
+
+export interface RateLimitStats {
+    limited: boolean; // A budget has been advertised by the backend
+    allowed_rps: number | null; // Requests/second the collector allows itself
+    limit: number | null;
+    remaining: number | null;
+    window_seconds: number | null;
+    tier: string | null;
+    blocked_until: string | null;
+    responses_429: number;
+    throttled_requests: number; // Requests held back locally instead of sent
+}
+
+/**
+ * Backend Rate Governor
+ *
+ * Cooperates with the backend's per-tenant rate limit instead of retrying blindly:
+ * - Learns the budget from X-RateLimit-Limit / X-RateLimit-Reset on every response
+ *   and paces requests with a token bucket at RATE_LIMIT_HEADROOM of that budget
+ * - On 429, stops sending until Retry-After (or the window reset) has passed
+ * Until the backend advertises a budget, requests are not limited.
+ */
+export class RateGovernor {
+    private rate: number | null = null; // Requests per second
+    private tokens = 0;
+    private lastRefill = Date.now();
+    private blockedUntil = 0;
+
+    private limit: number | null = null;
+    private remaining: number | null = null;
+    private windowSeconds: number | null = null;
+    private tier: string | null = null;
+    private responses429 = 0;
+    private throttled = 0;
+
+    /**
+     * Record the rate limit headers (and status) of a backend response
+     */
+    public observe(status: number, headers: Headers): void {
+        const now = Date.now();
+        const limit = Number(headers.get('x-ratelimit-limit'));
+        const reset = Number(headers.get('x-ratelimit-reset')); // Unix seconds
+        const remaining = headers.get('x-ratelimit-remaining');
+
+        if (limit > 0 && reset > 0) {
+            const windowSeconds = Math.max(1, Math.round(reset - now / 1000));
+            const rate = (limit / windowSeconds) * config.RATE_LIMIT_HEADROOM;
+
+            if (this.rate === null || Math.abs(rate - this.rate) / this.rate > 0.1) {
+                log.info(
+                    `🚦 Backend rate limit: ${limit} requests / ${windowSeconds}s` +
+                    `${headers.get('x-ratelimit-tier') ? ` (${headers.get('x-ratelimit-tier')})` : ''}. ` +
+                    `Pacing at ${rate.toFixed(2)} req/s`
+                );
+                if (this.rate === null) {
+                    this.tokens = Math.max(1, rate);
+                    this.lastRefill = now;
+                }
+            }
+
+            this.rate = rate;
+            this.limit = limit;
+            this.windowSeconds = windowSeconds;
+            this.remaining = remaining !== null ? Number(remaining) : null;
+            this.tier = headers.get('x-ratelimit-tier');
+        }
+
+        if (status === 429) {
+            this.responses429++;
+
+            const retryAfter = Number(headers.get('retry-after'));
+            const waitMs = retryAfter > 0
+                ? retryAfter * 1000
+                : reset > 0 ? Math.max(1000, reset * 1000 - now) : 1000;
+
+            if (now >= this.blockedUntil) {
+                log.warn(`⏳ Backend rate limit exceeded (429). Pausing sends for ${Math.ceil(waitMs / 1000)}s`);
+            }
+            this.blockedUntil = Math.max(this.blockedUntil, now + waitMs);
+            this.tokens = 0;
+        }
+    }
+
+    /**
+     * Take a token for one request. Returns false if the request must wait.
+     */
+    public tryAcquire(): boolean {
+        if (this.available() >= 1) {
+            if (this.rate !== null) this.tokens--;
+            return true;
+        }
+        this.throttled++;
+        return false;
+    }
+
+    /**
+     * Whole requests that may be sent right now
+     */
+    public available(): number {
+        const now = Date.now();
+        if (now < this.blockedUntil) return 0;
+        if (this.rate === null) return Number.POSITIVE_INFINITY;
+
+        const capacity = Math.max(1, this.rate); // Up to one second of burst
+        this.tokens = Math.min(capacity, this.tokens + ((now - this.lastRefill) / 1000) * this.rate);
+        this.lastRefill = now;
+        return Math.floor(this.tokens);
+    }
+
+    /**
+     * How long to hold back a throttled request before trying again
+     */
+    public retryDelayMs(): number {
+        const blocked = this.blockedUntil - Date.now();
+        const paced = this.rate ? 1000 / this.rate : 1000;
+        return Math.ceil(Math.max(blocked, paced));
+    }
+
+    public getStats(): RateLimitStats {
+        return {
+            limited: this.rate !== null,
+            allowed_rps: this.rate !== null ? Math.round(this.rate * 100) / 100 : null,
+            limit: this.limit,
+            remaining: this.remaining,
+            window_seconds: this.windowSeconds,
+            tier: this.tier,
+            blocked_until: this.blockedUntil > Date.now() ? new Date(this.blockedUntil).toISOString() : null,
+            responses_429: this.responses429,
+            throttled_requests: this.throttled,
+        };
+    }
+}
@@ -0,0 +1,192 @@
+import net from 'node:net';
+import { once } from 'node:events';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { uuidv7 } from './event-id.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { ListenerAcl } from './listener-acl.js';
+import { log } from './logger.js';
+
+interface StreamState {
+    id: string;
+    pending: Buffer;
+    offset: number; // Byte offset of `pending` within the stream
+    flushTimer: NodeJS.Timeout | null;
+}
+
+/**
+ * Raw Stream TCP Server
+ *
+ * For devices that send unframed blobs instead of newline-delimited syslog.
+ * Each connection is treated as a byte stream and cut into chunks:
+ * - when RAW_CHUNK_BYTES have accumulated, or
+ * - after RAW_CHUNK_TIMEOUT_MS without new data, or
+ * - when the connection closes (final chunk)
+ *
+ * Every event carries the stream ID and byte offset so the backend can reassemble.
+ */
+export class RawStreamServer {
+    private server: net.Server;
+    private buffer: MessageBuffer;
+    private connections = new Set<net.Socket>();
+    private readonly acl = new ListenerAcl('raw_tcp', config.RAW_TCP_ALLOWED_SOURCES, config.RAW_TCP_DENIED_SOURCES);
+    private isRunning = false;
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+        this.server = net.createServer(this.handleConnection.bind(this));
+
+        this.server.on('error', (err) => {
+            log.error(`❌ Raw Stream Server Error: ${err.message}`);
+        });
+    }
+
+    /**
+     * Handle a new TCP connection
+     */
+    private handleConnection(socket: net.Socket): void {
+        if (!this.acl.admits(socket.remoteAddress)) {
+            socket.destroy();
+            return;
+        }
+
+        const clientAddr = `${socket.remoteAddress}:${socket.remotePort}`;
+        this.connections.add(socket);
+
+        const state: StreamState = { id: uuidv7(), pending: Buffer.alloc(0), offset: 0, flushTimer: null };
+
+        log.debug(`🔌 Raw stream ${state.id} opened from ${clientAddr}`, { listener: 'raw_tcp', remote_addr: clientAddr });
+
+        socket.on('data', (data: Buffer) => {
+            state.pending = Buffer.concat([state.pending, data]);
+
+            while (state.pending.length >= config.RAW_CHUNK_BYTES) {
+                this.emitChunk(state, socket, this.cutPoint(state.pending), false);
+            }
+
+            this.scheduleFlush(state, socket);
+        });
+
+        socket.on('close', () => {
+            if (state.flushTimer) clearTimeout(state.flushTimer);
+            if (state.pending.length > 0) {
+                this.emitChunk(state, socket, state.pending.length, true);
+            }
+            this.connections.delete(socket);
+
+            log.debug(`🔌 Raw stream ${state.id} closed from ${clientAddr} (${state.offset} bytes)`, { listener: 'raw_tcp', remote_addr: clientAddr });
+        });
+
+        socket.on('error', (err) => {
+            if ((err as NodeJS.ErrnoException).code !== 'ECONNRESET') {
+                log.error(`❌ Raw stream socket error from ${clientAddr}: ${err.message}`, { listener: 'raw_tcp', remote_addr: clientAddr, error: err });
+            }
+            socket.destroy();
+        });
+
+        // Set socket timeout (5 minutes of inactivity)
+        socket.setTimeout(300000);
+        socket.on('timeout', () => socket.end());
+    }
+
+    /**
+     * Where to cut a full chunk. In utf8 mode, never split a multi-byte character.
+     */
+    private cutPoint(pending: Buffer): number {
+        let cut = config.RAW_CHUNK_BYTES;
+        if (config.RAW_ENCODING === 'utf8') {
+            // Back off over continuation bytes (10xxxxxx)
+            while (cut > 0 && (pending[cut]! & 0xc0) === 0x80) {
+                cut--;
+            }
+            if (cut === 0) cut = config.RAW_CHUNK_BYTES;
+        }
+        return cut;
+    }
+
+    private scheduleFlush(state: StreamState, socket: net.Socket): void {
+        if (state.flushTimer) clearTimeout(state.flushTimer);
+        if (state.pending.length === 0) return;
+
+        state.flushTimer = setTimeout(() => {
+            state.flushTimer = null;
+            if (state.pending.length > 0) {
+                this.emitChunk(state, socket, state.pending.length, false);
+            }
+        }, config.RAW_CHUNK_TIMEOUT_MS);
+    }
+
+    private emitChunk(state: StreamState, socket: net.Socket, length: number, final: boolean): void {
+        const chunk = state.pending.subarray(0, length);
+        state.pending = state.pending.subarray(length);
+
+        const event = createSyslogEvent(
+            chunk.toString(config.RAW_ENCODING),
+            { address: socket.remoteAddress || 'unknown', port: socket.remotePort },
+            'tcp-raw',
+        );
+        event.stream = {
+            id: state.id,
+            offset: state.offset,
+            length: chunk.length,
+            encoding: config.RAW_ENCODING,
+            final,
+        };
+        state.offset += chunk.length;
+
+        ingestEvent(this.buffer, event);
+    }
+
+    /**
+     * Start the raw stream server
+     */
+    public start(): Promise<void> {
+        return new Promise((resolve, reject) => {
+            this.server.listen(config.RAW_TCP_PORT, config.RAW_TCP_BIND_ADDRESS, () => {
+                this.isRunning = true;
+                log.info(
+                    `👂 Raw stream listening on tcp://${config.RAW_TCP_BIND_ADDRESS}:${config.RAW_TCP_PORT} ` +
+                    `(chunks of ${config.RAW_CHUNK_BYTES} bytes / ${config.RAW_CHUNK_TIMEOUT_MS}ms)`
+                );
+                resolve();
+            });
+
+            this.server.once('error', (err) => {
+                reject(err);
+            });
+        });
+    }
+
+    /**
+     * Stop the raw stream server. Pending partial chunks are flushed as connections close.
+     */
+    public stop(): Promise<void> {
+        return new Promise((resolve) => {
+            if (!this.isRunning) {
+                resolve();
+                return;
+            }
+
+            const closed = [...this.connections].map((socket) => once(socket, 'close'));
+            for (const socket of this.connections) {
+                socket.destroy();
+            }
+
+            this.server.close(() => {
+                void Promise.all(closed).then(() => {
+                    this.isRunning = false;
+                    log.info('   Raw stream server stopped.');
+                    resolve();
+                });
+            });
+        });
+    }
+
+    /**
+     * Get the number of active connections
+     */
+    public get connectionCount(): number {
+        return this.connections.size;
+    }
+}
@@ -0,0 +1,225 @@
+import http from 'node:http';
+import { timingSafeEqual } from 'node:crypto';
+import { z } from 'zod';
+import { config } from './config.js';
+import type { MessageBuffer, RelayHop, SyslogEvent } from './buffer.js';
+import { metrics } from './metrics.js';
+import { uuidv7 } from './event-id.js';
+import { normalizeIp } from './cidr.js';
+import { parseSyslogFields } from './events.js';
+import { log } from './logger.js';
+
+const MAX_BODY_BYTES = 5 * 1024 * 1024; // 5MB
+const MAX_BULK_EVENTS = 1000;
+
+// Same contract as the backend ingest API, plus relay metadata
+const RelayEventSchema = z.object({
+    event_id: z.string().uuid().optional(),
+    raw_message: z.string().min(1),
+    received_at: z.string().datetime().optional(),
+    source_ip: z.string().min(1).optional(),
+    source_port: z.number().int().positive().optional(),
+    transport: z.string().min(1).optional(),
+    collector_name: z.string().min(1).optional(),
+    tenant_id: z.string().min(1).optional(),
+    site_id: z.string().min(1).optional(),
+    relay_hops: z.array(z.object({
+        collector: z.string(),
+        received_at: z.string(),
+        peer_ip: z.string(),
+    })).optional(),
+});
+
+const RelayBulkSchema = z.object({
+    events: z.array(RelayEventSchema).min(1).max(MAX_BULK_EVENTS),
+});
+
+type RelayEvent = z.infer<typeof RelayEventSchema>;
+
+// Tenant of the edge collector's batch, for events that don't carry their own
+function requestTenant(req: http.IncomingMessage): string | undefined {
+    const header = req.headers['x-centinela-tenant'];
+    return typeof header === 'string' && header.length > 0 ? header : undefined;
+}
+
+/**
+ * Relay Ingest Server (concentrator mode)
+ *
+ * Lets edge collectors without internet egress forward to this collector
+ * instead of the SaaS. Exposes the same endpoints as the backend:
+ * - POST /v1/ingest/syslog
+ * - POST /v1/ingest/syslog/bulk
+ *
+ * Edge collectors point CENTINELA_API_URL at this server and use one of
+ * RELAY_TOKENS as their CENTINELA_API_KEY. Original event ID, timestamps,
+ * source IP/port, transport, collector and site are preserved when forwarding
+ * upstream, and each concentrator appends itself to relay_hops.
+ */
+export class RelayServer {
+    private server: http.Server;
+    private buffer: MessageBuffer;
+    private tokens: Buffer[];
+    private isRunning = false;
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+        this.tokens = config.RELAY_TOKENS.map((token) => Buffer.from(token));
+        this.server = http.createServer(this.handleRequest.bind(this));
+
+        this.server.on('error', (err) => {
+            log.error(`❌ Relay Server Error: ${err.message}`);
+        });
+    }
+
+    /**
+     * Handle incoming HTTP requests
+     */
+    private handleRequest(req: http.IncomingMessage, res: http.ServerResponse): void {
+        res.setHeader('Content-Type', 'application/json');
+
+        const path = (req.url || '/').split('?')[0];
+        const isBulk = path === '/v1/ingest/syslog/bulk';
+
+        if (req.method !== 'POST' || (path !== '/v1/ingest/syslog' && !isBulk)) {
+            this.reply(res, 404, { error: 'Not Found' });
+            return;
+        }
+
+        if (!this.isAuthorized(req.headers.authorization)) {
+            this.reply(res, 401, { error: 'Invalid relay token' });
+            return;
+        }
+
+        this.readBody(req)
+            .then((body) => this.handleIngest(body, isBulk, normalizeIp(req.socket.remoteAddress || 'unknown'), requestTenant(req), res))
+            .catch((err: Error) => {
+                this.reply(res, 413, { error: err.message });
+            });
+    }
+
+    private handleIngest(body: string, isBulk: boolean, peer: string, tenant: string | undefined, res: http.ServerResponse): void {
+        let json: unknown;
+        try {
+            json = JSON.parse(body);
+        } catch {
+            this.reply(res, 400, { error: 'Invalid JSON' });
+            return;
+        }
+
+        const parsed = isBulk ? RelayBulkSchema.safeParse(json) : RelayEventSchema.safeParse(json);
+        if (!parsed.success) {
+            this.reply(res, 400, { error: 'Invalid payload', details: parsed.error.format() });
+            return;
+        }
+
+        const incoming: RelayEvent[] = isBulk
+            ? (parsed.data as z.infer<typeof RelayBulkSchema>).events
+            : [parsed.data as RelayEvent];
+
+        // Refuse relay loops (A -> B -> A)
+        if (incoming.some((event) => event.relay_hops?.some((hop) => hop.collector === config.COLLECTOR_NAME))) {
+            this.reply(res, 508, { error: 'Relay loop detected' });
+            return;
+        }
+
+        // Backpressure: let the edge collector retry rather than dropping here
+        if (this.buffer.available < incoming.length) {
+            this.reply(res, 503, { error: 'Buffer full, retry later' });
+            return;
+        }
+
+        const now = new Date().toISOString();
+        const hop: RelayHop = { collector: config.COLLECTOR_NAME, received_at: now, peer_ip: peer };
+
+        for (const item of incoming) {
+            const event: SyslogEvent = {
+                event_id: item.event_id ?? uuidv7(),
+                raw_message: item.raw_message,
+                received_at: item.received_at ?? now,
+                source_ip: item.source_ip ?? peer,
+                source_port: item.source_port,
+                transport: item.transport ?? 'relay',
+                origin_collector: item.collector_name ?? peer,
+                tenant_id: item.tenant_id ?? tenant,
+                site_id: item.site_id,
+                relay_hops: [...(item.relay_hops ?? []), hop],
+            };
+            parseSyslogFields(event);
+            this.buffer.push(event);
+        }
+
+        metrics.incrementReceived(incoming.length);
+        this.reply(res, 202, { ok: true, accepted: incoming.length });
+    }
+
+    private isAuthorized(header: string | undefined): boolean {
+        if (!header) return false;
+
+        const [scheme, token] = header.split(' ');
+        if (scheme !== 'Bearer' || !token) return false;
+
+        const candidate = Buffer.from(token);
+        return this.tokens.some((valid) =>
+            valid.length === candidate.length && timingSafeEqual(valid, candidate)
+        );
+    }
+
+    private readBody(req: http.IncomingMessage): Promise<string> {
+        return new Promise((resolve, reject) => {
+            const chunks: Buffer[] = [];
+            let size = 0;
+
+            req.on('data', (chunk: Buffer) => {
+                size += chunk.length;
+                if (size > MAX_BODY_BYTES) {
+                    reject(new Error('Payload too large'));
+                    req.destroy();
+                    return;
+                }
+                chunks.push(chunk);
+            });
+            req.on('end', () => resolve(Buffer.concat(chunks).toString('utf8')));
+            req.on('error', reject);
+        });
+    }
+
+    private reply(res: http.ServerResponse, status: number, body: object): void {
+        res.writeHead(status);
+        res.end(JSON.stringify(body));
+    }
+
+    /**
+     * Start the relay server
+     */
+    public start(): Promise<void> {
+        return new Promise((resolve, reject) => {
+            this.server.listen(config.RELAY_PORT, config.RELAY_BIND_ADDRESS, () => {
+                this.isRunning = true;
+                log.info(`🔁 Relay ingest listening on http://${config.RELAY_BIND_ADDRESS}:${config.RELAY_PORT}`);
+                resolve();
+            });
+
+            this.server.once('error', (err) => {
+                reject(err);
+            });
+        });
+    }
+
+    /**
+     * Stop the relay server
+     */
+    public stop(): Promise<void> {
+        return new Promise((resolve) => {
+            if (!this.isRunning) {
+                resolve();
+                return;
+            }
+
+            this.server.close(() => {
+                this.isRunning = false;
+                log.info('   Relay server stopped.');
+                resolve();
+            });
+        });
+    }
+}
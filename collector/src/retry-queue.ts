@@ -1,6 +1,11 @@
 import { config } from './config.js';
-import type { SyslogEvent } from './buffer.js';
+import { batchPartition, type SyslogEvent } from './buffer.js';
 import { metrics } from './metrics.js';
+import { wal } from './wal.js';
+import { log } from './logger.js';
+import { tracer } from './tracing.js';
+import { deadLetterFile, type DeadLetterReason } from './dead-letter.js';
+import { eventLogFields } from './event-context.js';
 
 interface RetryableEvent {
     event: SyslogEvent;
@@ -13,7 +18,8 @@ interface RetryableEvent {
  * 
  * Handles failed events with configurable retry logic:
  * - Exponential backoff (1s, 2s, 4s, 8s, 16s...)
- * - Max retries before moving to DLQ
+ * - Max retries before moving to DLQ (or, with a write-ahead log, parking
+ *   the event on disk for a later replay)
  * - Jitter to prevent thundering herd
  */
 export class RetryQueue {
@@ -31,13 +37,17 @@ export class RetryQueue {
         const attempts = currentAttempts + 1;
 
         if (attempts > this.maxRetries) {
+            // Still in the write-ahead log: it is replayed once the backend is back
+            if (wal.park(event)) {
+                log.debug(`💾 Event parked in the write-ahead log after ${this.maxRetries} failed attempts`, eventLogFields(event));
+                return;
+            }
+
             // Max retries exceeded - move to Dead Letter Queue
             this.dlq.push(event);
             metrics.incrementDLQ();
 
-            if (config.LOG_LEVEL === 'debug') {
-                console.warn(`💀 Event moved to DLQ after ${this.maxRetries} failed attempts`);
-            }
+            log.debug(`💀 Event moved to DLQ after ${this.maxRetries} failed attempts`, eventLogFields(event));
             return;
         }
 
@@ -47,21 +57,44 @@ export class RetryQueue {
         this.queue.push({ event, attempts, nextRetryAt });
         metrics.incrementRetryQueued();
 
-        if (config.LOG_LEVEL === 'debug') {
-            console.log(`🔄 Event queued for retry #${attempts} in ${delay}ms`);
+        log.debug(`🔄 Event queued for retry #${attempts} in ${delay}ms`, eventLogFields(event));
+    }
+
+    /**
+     * Move an event straight to the DLQ (the backend refused it; retrying won't
+     * help), and to the dead-letter file with the reason
+     */
+    public deadLetter(event: SyslogEvent, reason: DeadLetterReason): void {
+        wal.ack([event]);
+        deadLetterFile.write(event, reason);
+        this.dlq.push(event);
+        metrics.incrementDLQ();
+        tracer.abandon(event, 'dead-lettered');
+
+        if (log.enabled('debug')) {
+            const fields = eventLogFields(event);
+            log.debug(`💀 Event ${fields.trace_id} refused by the backend, dead-lettered: ${reason.error}`, { ...fields, status: reason.status });
         }
     }
 
     /**
-     * Get events that are ready to be retried
+     * Hold an event back for `delayMs` without counting an attempt
+     * (used when the backend asks us to slow down rather than the send failing)
      */
-    public getReadyEvents(): Array<{ event: SyslogEvent; attempts: number }> {
+    public defer(event: SyslogEvent, attempts: number, delayMs: number): void {
+        this.queue.push({ event, attempts, nextRetryAt: Date.now() + delayMs });
+    }
+
+    /**
+     * Get events that are ready to be retried (up to `limit`)
+     */
+    public getReadyEvents(limit: number = Number.POSITIVE_INFINITY): Array<{ event: SyslogEvent; attempts: number }> {
         const now = Date.now();
         const ready: Array<{ event: SyslogEvent; attempts: number }> = [];
         const pending: RetryableEvent[] = [];
 
         for (const item of this.queue) {
-            if (item.nextRetryAt <= now) {
+            if (item.nextRetryAt <= now && ready.length < limit) {
                 ready.push({ event: item.event, attempts: item.attempts });
             } else {
                 pending.push(item);
@@ -72,6 +105,14 @@ export class RetryQueue {
         return ready;
     }
 
+    /**
+     * Make every waiting event due now (e.g. the network came back)
+     */
+    public retryNow(): void {
+        const now = Date.now();
+        for (const item of this.queue) item.nextRetryAt = Math.min(item.nextRetryAt, now);
+    }
+
     /**
      * Calculate exponential backoff with jitter
      */
@@ -102,6 +143,17 @@ export class RetryQueue {
         return this.dlq.length;
     }
 
+    /**
+     * Events waiting to retry and in the DLQ, per batch partition (tenant/site)
+     */
+    public partitionCounts(): Record<string, { retrying: number; dlq: number }> {
+        const counts: Record<string, { retrying: number; dlq: number }> = {};
+        const entry = (event: SyslogEvent) => (counts[batchPartition(event)] ??= { retrying: 0, dlq: 0 });
+        for (const item of this.queue) entry(item.event).retrying++;
+        for (const event of this.dlq) entry(event).dlq++;
+        return counts;
+    }
+
     /**
      * Export DLQ events (for manual processing or logging)
      */
@@ -111,6 +163,26 @@ export class RetryQueue {
         return events;
     }
 
+    /**
+     * Send events again (replayed from the dead-letter file): due now, and
+     * no longer counted in the DLQ
+     */
+    public replay(events: SyslogEvent[]): void {
+        const ids = new Set(events.map((event) => event.event_id));
+        this.dlq = this.dlq.filter((event) => !ids.has(event.event_id));
+        const now = Date.now();
+        for (const event of events) this.queue.push({ event, attempts: 0, nextRetryAt: now });
+    }
+
+    /**
+     * Take every event still waiting to retry (e.g. to spool them on shutdown)
+     */
+    public exportPending(): SyslogEvent[] {
+        const events = this.queue.map((item) => item.event);
+        this.queue = [];
+        return events;
+    }
+
     /**
      * Check if there are events waiting to retry
      */
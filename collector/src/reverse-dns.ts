@@ -0,0 +1,71 @@
+import { Resolver } from 'node:dns/promises';
+import { isIP } from 'node:net';
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { enrichmentCache } from './enrichment-cache.js';
+
+const LOOKUP_TIMEOUT_MS = 2000;
+const MAX_CONCURRENT_LOOKUPS = 64; // A burst of new senders doesn't flood the resolver
+
+// The address has no name: cached as "not found". Other errors are not cached, so they are retried.
+const NOT_FOUND_CODES = new Set(['ENOTFOUND', 'ENODATA']);
+
+export interface ReverseDnsStats {
+    enabled: boolean;
+    tagged: number; // Events
+    lookups_in_flight: number;
+    skipped: number; // Lookups not started because MAX_CONCURRENT_LOOKUPS were under way
+}
+
+/**
+ * Reverse DNS of the sender (REVERSE_DNS_ENABLED)
+ *
+ * Tags events with the PTR name of their source address (source_hostname),
+ * for devices that send no hostname or a useless one ("localhost", a
+ * factory default). Answers are kept in the shared enrichment cache (rdns)
+ * and an event is never held up for one: the address of an event with no
+ * cached answer is looked up in the background, and the sender's later
+ * events are tagged once it is in. The first events of a new sender go
+ * untagged. Listener, source map and rule tags of the same name take
+ * precedence.
+ */
+class ReverseDns {
+    private resolver = new Resolver({ timeout: LOOKUP_TIMEOUT_MS, tries: 1 });
+    private inFlight = 0;
+    private counts = { tagged: 0, skipped: 0 };
+
+    public apply(event: SyslogEvent): void {
+        if (!config.REVERSE_DNS_ENABLED || !isIP(event.source_ip)) return;
+
+        const hostname = enrichmentCache.get<string>('rdns', event.source_ip);
+        if (hostname) {
+            event.tags = { source_hostname: hostname, ...event.tags };
+            this.counts.tagged++;
+        } else if (hostname === undefined) {
+            if (this.inFlight >= MAX_CONCURRENT_LOOKUPS) {
+                this.counts.skipped++;
+                return;
+            }
+            enrichmentCache.prefetch('rdns', event.source_ip, () => this.resolve(event.source_ip));
+        }
+    }
+
+    public getStats(): ReverseDnsStats {
+        return { enabled: config.REVERSE_DNS_ENABLED, ...this.counts, lookups_in_flight: this.inFlight };
+    }
+
+    private async resolve(address: string): Promise<string | null> {
+        this.inFlight++;
+        try {
+            const [hostname] = await this.resolver.reverse(address);
+            return hostname ?? null;
+        } catch (err) {
+            if (NOT_FOUND_CODES.has((err as NodeJS.ErrnoException).code ?? '')) return null;
+            throw err;
+        } finally {
+            this.inFlight--;
+        }
+    }
+}
+
+export const reverseDns = new ReverseDns();
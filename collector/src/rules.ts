@@ -0,0 +1,317 @@
+import { z } from 'zod';
+import type { SyslogEvent } from './buffer.js';
+import { config } from './config.js';
+import { CidrList, isValidCidr } from './cidr.js';
+import { tokenVault } from './token-vault.js';
+import { log } from './logger.js';
+
+const MAX_RULES = 500;
+const MAX_PATTERN_LENGTH = 1000;
+const MAX_TEST_TIME_MS = 250; // Budget for running a rule set's embedded tests
+const MAX_SAMPLE_LENGTH = 1000;
+
+const RuleSchema = z.object({
+    id: z.string().min(1).max(100),
+    description: z.string().optional(),
+    enabled: z.boolean().default(true),
+    action: z.enum(['drop', 'redact', 'tag']),
+    pattern: z.string().min(1).max(MAX_PATTERN_LENGTH).optional(), // Regex on raw_message
+    flags: z.string().regex(/^[imsu]*$/).default(''),
+    sources: z.array(z.string().refine(isValidCidr, 'Expected an IP or CIDR range')).optional(),
+    replacement: z.string().default('[REDACTED]'), // redact
+    tokenize: z.boolean().default(false), // redact: replace with a vault token instead (see token-vault.ts)
+    tags: z.record(z.string()).optional(), // tag
+}).refine((rule) => rule.action !== 'redact' || rule.pattern, {
+    message: 'redact rules require a pattern',
+    path: ['pattern'],
+}).refine((rule) => !rule.tokenize || rule.action === 'redact', {
+    message: 'only redact rules can tokenize',
+    path: ['tokenize'],
+}).refine((rule) => rule.action !== 'tag' || (rule.tags && Object.keys(rule.tags).length > 0), {
+    message: 'tag rules require tags',
+    path: ['tags'],
+});
+
+// Test cases shipped with a rule set; all must pass before it is activated
+const RuleTestSchema = z.object({
+    message: z.string(),
+    source_ip: z.string().default('192.0.2.1'),
+    expect: z.enum(['drop', 'keep']),
+    output: z.string().optional(), // Expected raw_message after redaction (tokenizing rules: their replacement)
+});
+
+export const RuleSetSchema = z.object({
+    version: z.union([z.string().min(1), z.number().int()]).transform(String),
+    rules: z.array(RuleSchema).max(MAX_RULES),
+    tests: z.array(RuleTestSchema).default([]),
+});
+
+export type RuleSet = z.infer<typeof RuleSetSchema>;
+
+interface CompiledRule {
+    id: string;
+    action: 'drop' | 'redact' | 'tag';
+    pattern: RegExp | null;
+    sources: CidrList | null;
+    replacement: string;
+    tokenize: boolean;
+    tags: Record<string, string>;
+}
+
+export interface RuleStats {
+    version: string | null;
+    rules: number;
+    activated_at: string | null;
+    dropped: number;
+    redacted: number;
+    tagged: number;
+}
+
+export interface RuleSample {
+    received_at: string;
+    source_ip: string;
+    raw_message: string; // After the rule was applied (redacted messages stay redacted)
+}
+
+export interface RuleHitStats {
+    id: string;
+    action: 'drop' | 'redact' | 'tag';
+    hits: number;
+    last_hit_at: string | null;
+    since: string; // Counting since (rule set activation, or an earlier one with the same rule)
+    samples: RuleSample[];
+}
+
+/**
+ * Validate a rule set received from the backend (or the local cache):
+ * schema, regex compilation and the rule set's own test cases.
+ * Returns the compiled rules or a human-readable error.
+ */
+export function validateRuleSet(input: unknown): { ok: true; ruleSet: RuleSet; compiled: CompiledRule[] } | { ok: false; error: string } {
+    const parsed = RuleSetSchema.safeParse(input);
+    if (!parsed.success) {
+        const issue = parsed.error.issues[0];
+        return { ok: false, error: `${issue?.path.join('.') || 'rules'}: ${issue?.message ?? 'invalid'}` };
+    }
+
+    const ruleSet = parsed.data;
+    const compiled: CompiledRule[] = [];
+    for (const rule of ruleSet.rules) {
+        if (!rule.enabled) continue;
+
+        let pattern: RegExp | null = null;
+        if (rule.pattern) {
+            try {
+                pattern = new RegExp(rule.pattern, rule.action === 'redact' ? `${rule.flags}g` : rule.flags);
+            } catch (err) {
+                return { ok: false, error: `rule ${rule.id}: invalid pattern (${(err as Error).message})` };
+            }
+        }
+
+        compiled.push({
+            id: rule.id,
+            action: rule.action,
+            pattern,
+            sources: rule.sources ? new CidrList(rule.sources) : null,
+            replacement: rule.replacement,
+            tokenize: rule.tokenize,
+            tags: rule.tags ?? {},
+        });
+    }
+
+    const started = Date.now();
+    for (const [index, test] of ruleSet.tests.entries()) {
+        const event = { raw_message: test.message, source_ip: test.source_ip } as SyslogEvent;
+        const kept = evaluate(compiled, event, null, null);
+        const outcome = kept ? 'keep' : 'drop';
+
+        if (outcome !== test.expect) {
+            return { ok: false, error: `test ${index}: expected ${test.expect}, got ${outcome}` };
+        }
+        if (kept && test.output !== undefined && event.raw_message !== test.output) {
+            return { ok: false, error: `test ${index}: expected output "${test.output}", got "${event.raw_message}"` };
+        }
+    }
+    if (Date.now() - started > MAX_TEST_TIME_MS) {
+        return { ok: false, error: `tests took over ${MAX_TEST_TIME_MS}ms (pattern too expensive?)` };
+    }
+
+    return { ok: true, ruleSet, compiled };
+}
+
+export interface RuleSetDiff {
+    from_version: string | null;
+    to_version: string;
+    added: string[];
+    removed: string[];
+    changed: string[];
+}
+
+/**
+ * Which rules (by id) a new rule set adds, removes or changes
+ */
+export function diffRuleSets(current: RuleSet | null, next: RuleSet): RuleSetDiff {
+    const before = new Map((current?.rules ?? []).map((rule) => [rule.id, JSON.stringify(rule)]));
+    const after = new Map(next.rules.map((rule) => [rule.id, JSON.stringify(rule)]));
+
+    return {
+        from_version: current?.version ?? null,
+        to_version: next.version,
+        added: [...after.keys()].filter((id) => !before.has(id)),
+        removed: [...before.keys()].filter((id) => !after.has(id)),
+        changed: [...after.keys()].filter((id) => before.has(id) && before.get(id) !== after.get(id)),
+    };
+}
+
+/**
+ * Run compiled rules against an event, in order.
+ * Drop stops evaluation; redact and tag modify the event in place.
+ * onHit is called for every rule that matched (after it was applied).
+ * Without a tokenizer, tokenizing rules use their replacement text.
+ */
+function evaluate(
+    rules: CompiledRule[],
+    event: SyslogEvent,
+    onHit: ((rule: CompiledRule, event: SyslogEvent) => void) | null,
+    tokenize: ((value: string) => string) | null,
+): boolean {
+    for (const rule of rules) {
+        if (rule.sources && !rule.sources.contains(event.source_ip)) continue;
+
+        switch (rule.action) {
+            case 'drop':
+                if (!rule.pattern || rule.pattern.test(event.raw_message)) {
+                    onHit?.(rule, event);
+                    return false;
+                }
+                break;
+
+            case 'redact': {
+                const redacted = rule.tokenize && tokenize
+                    ? event.raw_message.replace(rule.pattern!, (match) => tokenize(match))
+                    : event.raw_message.replace(rule.pattern!, rule.replacement);
+                if (redacted !== event.raw_message) {
+                    event.raw_message = redacted;
+                    onHit?.(rule, event);
+                }
+                break;
+            }
+
+            case 'tag':
+                if (!rule.pattern || rule.pattern.test(event.raw_message)) {
+                    event.tags = { ...event.tags, ...rule.tags };
+                    onHit?.(rule, event);
+                }
+                break;
+        }
+    }
+    return true;
+}
+
+/**
+ * Rule Engine
+ *
+ * Applies the active filter (drop), redaction and tagging rules to every
+ * event before it is buffered. Rule sets are replaced atomically and only
+ * after validateRuleSet() passes; until one is activated, events pass through.
+ *
+ * Every rule keeps a hit count and the last RULE_SAMPLE_SIZE events it matched,
+ * so users can check a rule matches what they think. Counts survive a rule
+ * set update for rules whose definition did not change.
+ */
+class RuleEngine {
+    private ruleSet: RuleSet | null = null;
+    private rules: CompiledRule[] = [];
+    private activatedAt: string | null = null;
+    private counters = { dropped: 0, redacted: 0, tagged: 0 };
+    private hits = new Map<CompiledRule, RuleHitStats>();
+    private readonly recordHit = (rule: CompiledRule, event: SyslogEvent): void => {
+        if (rule.action === 'drop') this.counters.dropped++;
+        else if (rule.action === 'redact') this.counters.redacted++;
+        else this.counters.tagged++;
+
+        const stats = this.hits.get(rule);
+        if (!stats) return;
+        stats.hits++;
+        stats.last_hit_at = new Date().toISOString();
+
+        if (config.RULE_SAMPLE_SIZE > 0) {
+            stats.samples.push({
+                received_at: event.received_at,
+                source_ip: event.source_ip,
+                raw_message: event.raw_message.slice(0, MAX_SAMPLE_LENGTH),
+            });
+            if (stats.samples.length > config.RULE_SAMPLE_SIZE) stats.samples.shift();
+        }
+    };
+
+    private readonly tokenize = (value: string): string => tokenVault.tokenize(value);
+
+    /**
+     * Apply rules to an event. Returns false if the event must be dropped.
+     */
+    public apply(event: SyslogEvent): boolean {
+        if (this.rules.length === 0) return true;
+        return evaluate(this.rules, event, this.recordHit, tokenVault.enabled ? this.tokenize : null);
+    }
+
+    /**
+     * Replace the active rules with an already validated rule set
+     */
+    public activate(ruleSet: RuleSet, compiled: CompiledRule[]): void {
+        const now = new Date().toISOString();
+
+        // Keep the statistics of rules that are unchanged
+        const previous = new Map<string, RuleHitStats>();
+        const before = new Map((this.ruleSet?.rules ?? []).map((rule) => [rule.id, JSON.stringify(rule)]));
+        for (const [rule, stats] of this.hits) {
+            previous.set(rule.id, stats);
+        }
+
+        const hits = new Map<CompiledRule, RuleHitStats>();
+        for (const rule of compiled) {
+            const definition = JSON.stringify(ruleSet.rules.find((r) => r.id === rule.id));
+            const kept = before.get(rule.id) === definition ? previous.get(rule.id) : undefined;
+            hits.set(rule, kept ?? { id: rule.id, action: rule.action, hits: 0, last_hit_at: null, since: now, samples: [] });
+        }
+
+        if (!tokenVault.enabled && compiled.some((rule) => rule.tokenize)) {
+            log.warn('⚠️ Rule set has tokenizing rules but no token vault is configured (TOKEN_VAULT_FILE): they redact with their replacement text');
+        }
+
+        this.ruleSet = ruleSet;
+        this.rules = compiled;
+        this.hits = hits;
+        this.activatedAt = now;
+    }
+
+    /**
+     * Per-rule hit counts and samples, in evaluation order
+     */
+    public getRuleHits(): RuleHitStats[] {
+        return this.rules.map((rule) => {
+            const stats = this.hits.get(rule)!;
+            return { ...stats, samples: [...stats.samples] };
+        });
+    }
+
+    public get activeVersion(): string | null {
+        return this.ruleSet?.version ?? null;
+    }
+
+    public get activeRuleSet(): RuleSet | null {
+        return this.ruleSet;
+    }
+
+    public getStats(): RuleStats {
+        return {
+            version: this.activeVersion,
+            rules: this.rules.length,
+            activated_at: this.activatedAt,
+            ...this.counters,
+        };
+    }
+}
+
+// Singleton instance
+export const ruleEngine = new RuleEngine();
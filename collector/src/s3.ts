@@ -0,0 +1,114 @@
+import { createHash, createHmac } from 'node:crypto';
+
+const REQUEST_TIMEOUT_MS = 60000;
+
+export interface S3Target {
+    endpoint?: string; // Unset = AWS S3 in `region`
+    region: string;
+    bucket: string;
+    accessKeyId: string;
+    secretAccessKey: string;
+    sessionToken?: string;
+    pathStyle: boolean;
+}
+
+/**
+ * The service answered with an error (status and S3 error code)
+ */
+export class S3Error extends Error {
+    public readonly status: number;
+    public readonly code: string;
+
+    constructor(status: number, code: string, message: string) {
+        super(`S3 ${status} ${code}: ${message}`);
+        this.status = status;
+        this.code = code;
+    }
+}
+
+const sha256 = (data: string | Buffer) => createHash('sha256').update(data).digest('hex');
+const hmac = (key: string | Buffer, data: string) => createHmac('sha256', key).update(data).digest();
+
+// RFC 3986 unreserved characters stay, everything else is percent-encoded (S3 keeps the slashes)
+function encodeKey(key: string): string {
+    return key.split('/')
+        .map((segment) => encodeURIComponent(segment).replace(/[!'()*]/g, (c) => `%${c.charCodeAt(0).toString(16).toUpperCase()}`))
+        .join('/');
+}
+
+export function objectUrl(target: S3Target, key: string): URL {
+    const endpoint = new URL(target.endpoint ?? `https://s3.${target.region}.amazonaws.com`);
+    return target.pathStyle
+        ? new URL(`${endpoint.origin}/${target.bucket}/${encodeKey(key)}`)
+        : new URL(`${endpoint.protocol}//${target.bucket}.${endpoint.host}/${encodeKey(key)}`);
+}
+
+/**
+ * AWS Signature Version 4 for one request: returns the headers to send,
+ * including Authorization. Every header passed in is signed.
+ */
+export function signRequest(
+    target: Pick<S3Target, 'region' | 'accessKeyId' | 'secretAccessKey' | 'sessionToken'>,
+    request: { method: string; url: URL; headers: Record<string, string>; payloadHash: string },
+    now = new Date(),
+): Record<string, string> {
+    const amzDate = now.toISOString().replace(/[-:]/g, '').replace(/\.\d{3}/, ''); // 20240115T100000Z
+    const day = amzDate.slice(0, 8);
+    const scope = `${day}/${target.region}/s3/aws4_request`;
+
+    const headers: Record<string, string> = {
+        ...request.headers,
+        host: request.url.host,
+        'x-amz-content-sha256': request.payloadHash,
+        'x-amz-date': amzDate,
+        ...(target.sessionToken ? { 'x-amz-security-token': target.sessionToken } : {}),
+    };
+    const names = Object.keys(headers).map((name) => name.toLowerCase()).sort();
+    const lower = Object.fromEntries(Object.entries(headers).map(([name, value]) => [name.toLowerCase(), value.trim().replace(/\s+/g, ' ')]));
+
+    const query = [...request.url.searchParams]
+        .map(([name, value]) => [encodeURIComponent(name), encodeURIComponent(value)])
+        .sort(([a], [b]) => (a! < b! ? -1 : a! > b! ? 1 : 0))
+        .map(([name, value]) => `${name}=${value}`)
+        .join('&');
+    const canonicalRequest = [
+        request.method,
+        request.url.pathname,
+        query,
+        names.map((name) => `${name}:${lower[name]}\n`).join(''),
+        names.join(';'),
+        request.payloadHash,
+    ].join('\n');
+    const stringToSign = ['AWS4-HMAC-SHA256', amzDate, scope, sha256(canonicalRequest)].join('\n');
+
+    const signingKey = hmac(hmac(hmac(hmac(`AWS4${target.secretAccessKey}`, day), target.region), 's3'), 'aws4_request');
+    const signature = createHmac('sha256', signingKey).update(stringToSign).digest('hex');
+
+    headers.authorization = `AWS4-HMAC-SHA256 Credential=${target.accessKeyId}/${scope}, ` +
+        `SignedHeaders=${names.join(';')}, Signature=${signature}`;
+    delete headers.host; // Set by fetch
+    return headers;
+}
+
+/**
+ * PUT one object (single request; objects here stay well under the 5 GiB limit)
+ */
+export async function putObject(target: S3Target, key: string, body: Buffer, headers: Record<string, string> = {}): Promise<void> {
+    const url = objectUrl(target, key);
+    const response = await fetch(url, {
+        method: 'PUT',
+        headers: signRequest(target, { method: 'PUT', url, headers, payloadHash: sha256(body) }),
+        body,
+        signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS),
+    });
+    if (response.ok) {
+        await response.body?.cancel();
+        return;
+    }
+
+    // <Error><Code>AccessDenied</Code><Message>Access Denied</Message>...</Error>
+    const text = await response.text().catch(() => '');
+    const code = /<Code>([^<]*)<\/Code>/.exec(text)?.[1] ?? 'Error';
+    const message = /<Message>([^<]*)<\/Message>/.exec(text)?.[1] ?? (text.slice(0, 200) || response.statusText);
+    throw new S3Error(response.status, code, message);
+}
@@ -0,0 +1,102 @@
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import * as avro from './serializers/avro.js';
+import * as protobuf from './serializers/protobuf.js';
+import { SchemaRegistry } from './serializers/schema-registry.js';
+
+export type WireFormat = 'json' | 'ndjson' | 'protobuf' | 'avro';
+
+export type IngestRecord = ReturnType<typeof buildIngestPayload>;
+
+/**
+ * How an output puts records on the wire. Outputs pick one by name
+ * (BATCH_FORMAT for the backend, json or ndjson only; KAFKA_FORMAT and
+ * SHADOW_FORMAT), so the event representation (buildIngestPayload) stays
+ * the same everywhere.
+ */
+export interface Serializer {
+    readonly contentType: string;
+    /** Body of one bulk request */
+    batch(records: IngestRecord[]): string | Buffer;
+    /** One record as a standalone message, for message-oriented outputs (e.g. Kafka) */
+    record(record: IngestRecord): Promise<Buffer>;
+}
+
+/**
+ * Build the ingest record for an event (the same for every wire format).
+ * Relayed events keep the origin collector/site and their relay hops. The
+ * parsed header leaves out the message: it is the end of raw_message, which
+ * the backend takes it from, so it isn't sent twice.
+ */
+export function buildIngestPayload(event: SyslogEvent) {
+    return {
+        event_id: event.event_id,
+        raw_message: event.raw_message,
+        received_at: event.received_at,
+        source_ip: event.source_ip,
+        source_port: event.source_port,
+        transport: event.transport,
+        syslog: event.syslog && withoutMessage(event.syslog),
+        collector_name: event.origin_collector ?? config.COLLECTOR_NAME,
+        tenant_id: event.tenant_id ?? config.TENANT_ID,
+        site_id: event.site_id ?? config.SITE_ID,
+        source_id: event.source_id,
+        relay_hops: event.relay_hops,
+        stream: event.stream,
+        continuation: event.continuation,
+        meta: event.meta,
+        quarantined: event.quarantined,
+        tags: event.tags,
+    };
+}
+
+type WithoutMessage<T> = T extends unknown ? Omit<T, 'message'> : never;
+
+function withoutMessage<T extends { message?: string }>(syslog: T): WithoutMessage<T> {
+    const { message: _message, ...header } = syslog;
+    return header as WithoutMessage<T>;
+}
+
+let registry: SchemaRegistry | null = null;
+
+const SERIALIZERS: Record<WireFormat, Serializer> = {
+    // {"events": [...]}
+    json: {
+        contentType: 'application/json',
+        batch: (records) => JSON.stringify({ events: records }),
+        record: async (record) => Buffer.from(JSON.stringify(record)),
+    },
+
+    // One record per line, streamable by the receiver
+    ndjson: {
+        contentType: 'application/x-ndjson',
+        batch: (records) => records.map((record) => `${JSON.stringify(record)}\n`).join(''),
+        record: async (record) => Buffer.from(JSON.stringify(record)),
+    },
+
+    // centinela.ingest.v1.EventBatch / Event (see serializers/protobuf.ts)
+    protobuf: {
+        contentType: 'application/x-protobuf',
+        batch: (records) => protobuf.encodeEventBatch(records),
+        record: async (record) => protobuf.encodeEvent(record),
+    },
+
+    // Batches as object container files (schema embedded); single records in the
+    // Confluent wire format, with the schema registered in SCHEMA_REGISTRY_URL
+    avro: {
+        contentType: 'application/avro',
+        batch: (records) => avro.encodeContainer(records),
+        record: async (record) => {
+            if (!config.SCHEMA_REGISTRY_URL) {
+                throw new Error('SCHEMA_REGISTRY_URL is required for single Avro records');
+            }
+            registry ??= new SchemaRegistry(config.SCHEMA_REGISTRY_URL, config.SCHEMA_REGISTRY_AUTH);
+            const schemaId = await registry.schemaId(config.SCHEMA_REGISTRY_SUBJECT, avro.EVENT_SCHEMA);
+            return avro.encodeConfluent(record, schemaId);
+        },
+    },
+};
+
+export function getSerializer(format: WireFormat): Serializer {
+    return SERIALIZERS[format];
+}
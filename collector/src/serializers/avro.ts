@@ -0,0 +1,153 @@
+import { randomBytes } from 'node:crypto';
+import type { IngestRecord } from '../serializers.js';
+
+/**
+ * Avro encoding of ingest records (binary encoding, no runtime dependency).
+ * Nested objects are JSON strings, with the same shape as the JSON format.
+ */
+export const EVENT_SCHEMA = JSON.stringify({
+    type: 'record',
+    name: 'Event',
+    namespace: 'io.centinela.ingest.v1',
+    fields: [
+        { name: 'event_id', type: 'string' },
+        { name: 'raw_message', type: 'string' },
+        { name: 'received_at', type: 'string' },
+        { name: 'source_ip', type: 'string' },
+        { name: 'source_port', type: ['null', 'int'], default: null },
+        { name: 'transport', type: 'string' },
+        { name: 'collector_name', type: 'string' },
+        { name: 'site_id', type: ['null', 'string'], default: null },
+        { name: 'quarantined', type: 'boolean', default: false },
+        { name: 'tags', type: { type: 'map', values: 'string' }, default: {} },
+        { name: 'syslog_json', type: ['null', 'string'], default: null },
+        { name: 'relay_hops_json', type: ['null', 'string'], default: null },
+        { name: 'stream_json', type: ['null', 'string'], default: null },
+        { name: 'meta_json', type: ['null', 'string'], default: null },
+        { name: 'tenant_id', type: ['null', 'string'], default: null },
+        { name: 'source_id', type: ['null', 'string'], default: null },
+        { name: 'continuation_json', type: ['null', 'string'], default: null },
+    ],
+});
+
+const OCF_MAGIC = Buffer.from([0x4f, 0x62, 0x6a, 0x01]); // "Obj" 1
+
+class Writer {
+    private chunks: Buffer[] = [];
+
+    // int and long: zig-zag varint
+    public long(value: number): this {
+        let remaining = value >= 0 ? value * 2 : -value * 2 - 1;
+        const bytes: number[] = [];
+        while (remaining > 0x7f) {
+            bytes.push((remaining % 0x80) | 0x80);
+            remaining = Math.floor(remaining / 0x80);
+        }
+        bytes.push(remaining);
+        this.chunks.push(Buffer.from(bytes));
+        return this;
+    }
+
+    public bytes(data: Buffer): this {
+        this.long(data.length);
+        this.chunks.push(data);
+        return this;
+    }
+
+    public string(value: string): this {
+        return this.bytes(Buffer.from(value, 'utf8'));
+    }
+
+    public boolean(value: boolean): this {
+        this.chunks.push(Buffer.from([value ? 1 : 0]));
+        return this;
+    }
+
+    // ["null", "string"] / ["null", "int"]: branch index, then the value
+    public optionalString(value: string | undefined): this {
+        return value === undefined ? this.long(0) : this.long(1).string(value);
+    }
+
+    public optionalInt(value: number | undefined): this {
+        return value === undefined ? this.long(0) : this.long(1).long(value);
+    }
+
+    public optionalJson(value: unknown): this {
+        return this.optionalString(value === undefined ? undefined : JSON.stringify(value));
+    }
+
+    public map(entries: Record<string, string>): this {
+        const pairs = Object.entries(entries);
+        if (pairs.length > 0) {
+            this.long(pairs.length);
+            for (const [key, value] of pairs) this.string(key).string(value);
+        }
+        return this.long(0);
+    }
+
+    public raw(data: Buffer): this {
+        this.chunks.push(data);
+        return this;
+    }
+
+    public finish(): Buffer {
+        return Buffer.concat(this.chunks);
+    }
+}
+
+/**
+ * One Event datum (EVENT_SCHEMA), without framing
+ */
+export function encodeEvent(record: IngestRecord): Buffer {
+    return new Writer()
+        .string(record.event_id)
+        .string(record.raw_message)
+        .string(record.received_at)
+        .string(record.source_ip)
+        .optionalInt(record.source_port)
+        .string(record.transport)
+        .string(record.collector_name)
+        .optionalString(record.site_id)
+        .boolean(record.quarantined ?? false)
+        .map(record.tags ?? {})
+        .optionalJson(record.syslog)
+        .optionalJson(record.relay_hops)
+        .optionalJson(record.stream)
+        .optionalJson(record.meta)
+        .optionalString(record.tenant_id)
+        .optionalString(record.source_id)
+        .optionalJson(record.continuation)
+        .finish();
+}
+
+/**
+ * Records as an Avro object container file (schema embedded, one block, no codec)
+ */
+export function encodeContainer(records: IngestRecord[]): Buffer {
+    const sync = randomBytes(16);
+    const block = Buffer.concat(records.map(encodeEvent));
+
+    return new Writer()
+        .raw(OCF_MAGIC)
+        .long(2)
+        .string('avro.schema').bytes(Buffer.from(EVENT_SCHEMA))
+        .string('avro.codec').bytes(Buffer.from('null'))
+        .long(0)
+        .raw(sync)
+        .long(records.length)
+        .long(block.length)
+        .raw(block)
+        .raw(sync)
+        .finish();
+}
+
+/**
+ * A single record in the Confluent wire format (magic byte 0, schema ID, datum),
+ * as expected by Kafka consumers using a schema registry
+ */
+export function encodeConfluent(record: IngestRecord, schemaId: number): Buffer {
+    const header = Buffer.alloc(5);
+    header.writeUInt8(0, 0);
+    header.writeUInt32BE(schemaId, 1);
+    return Buffer.concat([header, encodeEvent(record)]);
+}
@@ -0,0 +1,162 @@
+import type { SyslogEvent } from '../buffer.js';
+import { fields, Writer } from './protobuf.js';
+import { eventContext } from '../event-context.js';
+
+/**
+ * OpenTelemetry LogRecord mapping of events, and the OTLP
+ * ExportLogsServiceRequest in its protobuf and JSON encodings
+ * (opentelemetry/proto/collector/logs/v1/logs_service.proto)
+ *
+ * The body is the message as received. The parsed syslog header becomes
+ * attributes under the names of the OpenTelemetry Collector's syslog
+ * receiver (syslog.*), so pipelines that already handle its output work
+ * unchanged; Centinela's own fields are under centinela.*. The record's
+ * trace ID is the event's (see event-context.ts), so a log backend links it
+ * to the pipeline trace and to the collector's own log records about it.
+ */
+
+type AttributeValue = string | number | boolean;
+
+export interface LogRecord {
+    timeUnixNano: bigint; // Device timestamp when parsed, else receive time
+    observedTimeUnixNano: bigint;
+    severityNumber: number; // 0 = unspecified
+    severityText?: string;
+    body: string;
+    traceId: string; // 32 hex digits
+    attributes: Array<[string, AttributeValue]>;
+}
+
+export interface LogsResource {
+    attributes: Record<string, string>;
+    scope: { name: string; version: string };
+}
+
+// Syslog severity -> OTel SeverityNumber (as the OTel Collector's syslog parser maps it)
+const SEVERITY_NUMBERS = [22, 21, 18, 17, 13, 10, 9, 5];
+const SEVERITY_TEXTS = ['emerg', 'alert', 'crit', 'err', 'warning', 'notice', 'info', 'debug'];
+
+function toNanos(timestamp: string | undefined): bigint {
+    const millis = timestamp ? Date.parse(timestamp) : NaN;
+    return Number.isNaN(millis) ? 0n : BigInt(millis) * 1_000_000n;
+}
+
+export function toLogRecord(event: SyslogEvent, collectorName: string): LogRecord {
+    const syslog = event.syslog;
+    const attributes: Array<[string, AttributeValue | undefined]> = [
+        ['log.record.uid', event.event_id],
+        ['network.peer.address', event.source_ip],
+        ['network.peer.port', event.source_port],
+        ['network.transport', event.transport],
+        ['syslog.format', syslog?.format],
+        ['syslog.priority', syslog?.pri],
+        ['syslog.facility', syslog?.facility],
+        ['syslog.hostname', syslog?.hostname],
+        ['syslog.appname', syslog?.format === 'rfc5424' ? syslog.app_name : syslog?.tag],
+        ['syslog.proc_id', syslog?.procid],
+        ['syslog.msg_id', syslog?.format === 'rfc5424' ? syslog.msgid : undefined],
+        ['syslog.structured_data', syslog?.format === 'rfc5424' && syslog.structured_data ? JSON.stringify(syslog.structured_data) : undefined],
+        ['centinela.collector', event.origin_collector ?? collectorName],
+        ['centinela.tenant_id', event.tenant_id],
+        ['centinela.site_id', event.site_id],
+        ['centinela.source_id', event.source_id],
+        ['centinela.quarantined', event.quarantined || undefined],
+        ...Object.entries(event.tags ?? {}).map(([key, value]): [string, string] => [`centinela.tag.${key}`, value]),
+    ];
+
+    const observed = toNanos(event.received_at);
+    return {
+        timeUnixNano: toNanos(syslog?.timestamp) || observed,
+        observedTimeUnixNano: observed,
+        severityNumber: syslog ? SEVERITY_NUMBERS[syslog.severity] ?? 0 : 0,
+        severityText: syslog ? SEVERITY_TEXTS[syslog.severity] : undefined,
+        body: event.raw_message,
+        traceId: eventContext(event).traceId,
+        attributes: attributes.filter((entry): entry is [string, AttributeValue] => entry[1] !== undefined),
+    };
+}
+
+function encodeAnyValue(value: AttributeValue): Buffer {
+    const writer = new Writer();
+    // oneof members are written even when they hold the default value
+    if (typeof value === 'string') return writer.bytes(1, Buffer.from(value, 'utf8')).finish();
+    if (typeof value === 'boolean') return writer.varint(2 * 8).varint(value ? 1 : 0).finish();
+    return writer.varint(3 * 8).varint(value).finish();
+}
+
+function encodeKeyValue(key: string, value: AttributeValue): Buffer {
+    return new Writer().string(1, key).bytes(2, encodeAnyValue(value)).finish();
+}
+
+/**
+ * ExportLogsServiceRequest, protobuf (OTLP/gRPC and http/protobuf)
+ */
+export function encodeLogsProtobuf(records: LogRecord[], resource: LogsResource): Buffer {
+    const resourceMessage = new Writer();
+    for (const [key, value] of Object.entries(resource.attributes)) resourceMessage.bytes(1, encodeKeyValue(key, value));
+
+    const scopeLogs = new Writer()
+        .bytes(1, new Writer().string(1, resource.scope.name).string(2, resource.scope.version).finish());
+    for (const record of records) {
+        const message = new Writer()
+            .fixed64(1, record.timeUnixNano)
+            .uint(2, record.severityNumber)
+            .string(3, record.severityText)
+            .bytes(5, encodeAnyValue(record.body));
+        for (const [key, value] of record.attributes) message.bytes(6, encodeKeyValue(key, value));
+        message.bytes(9, Buffer.from(record.traceId, 'hex'));
+        scopeLogs.bytes(2, message.fixed64(11, record.observedTimeUnixNano).finish());
+    }
+
+    const resourceLogs = new Writer()
+        .bytes(1, resourceMessage.finish())
+        .bytes(2, scopeLogs.finish());
+    return new Writer().bytes(1, resourceLogs.finish()).finish();
+}
+
+function jsonValue(value: AttributeValue) {
+    if (typeof value === 'string') return { stringValue: value };
+    if (typeof value === 'boolean') return { boolValue: value };
+    return { intValue: String(value) };
+}
+
+/**
+ * ExportLogsServiceRequest, OTLP/JSON (http/json)
+ */
+export function encodeLogsJson(records: LogRecord[], resource: LogsResource): string {
+    return JSON.stringify({
+        resourceLogs: [{
+            resource: { attributes: Object.entries(resource.attributes).map(([key, value]) => ({ key, value: jsonValue(value) })) },
+            scopeLogs: [{
+                scope: resource.scope,
+                logRecords: records.map((record) => ({
+                    timeUnixNano: record.timeUnixNano.toString(),
+                    observedTimeUnixNano: record.observedTimeUnixNano.toString(),
+                    severityNumber: record.severityNumber || undefined,
+                    severityText: record.severityText,
+                    body: { stringValue: record.body },
+                    attributes: record.attributes.map(([key, value]) => ({ key, value: jsonValue(value) })),
+                    traceId: record.traceId,
+                })),
+            }],
+        }],
+    });
+}
+
+/**
+ * Records the receiver refused, from an ExportLogsServiceResponse
+ * (partial_success); 0 when everything was accepted
+ */
+export function decodeRejectedProtobuf(data: Buffer): { rejected: number; message?: string } {
+    for (const { number, value } of fields(data)) {
+        if (number !== 1 || !Buffer.isBuffer(value)) continue;
+        let rejected = 0;
+        let message: string | undefined;
+        for (const field of fields(value)) {
+            if (field.number === 1 && typeof field.value === 'number') rejected = field.value;
+            if (field.number === 2 && Buffer.isBuffer(field.value)) message = field.value.toString('utf8');
+        }
+        return { rejected, message };
+    }
+    return { rejected: 0 };
+}
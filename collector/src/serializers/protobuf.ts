@@ -0,0 +1,205 @@
+import type { IngestRecord } from '../serializers.js';
+
+/**
+ * Protocol Buffers encoding of ingest records (proto3 wire format, no runtime
+ * dependency). Schema: proto/centinela/ingest/v1/ingest.proto (Event,
+ * EventBatch, and the gRPC output's BatchAck).
+ */
+
+const WIRE_VARINT = 0;
+const WIRE_FIXED64 = 1;
+const WIRE_LENGTH_DELIMITED = 2;
+
+/**
+ * proto3 message writer (also used for the OTLP messages, see otlp.ts)
+ */
+export class Writer {
+    private chunks: Buffer[] = [];
+
+    public varint(value: number): this {
+        const bytes: number[] = [];
+        let remaining = value;
+        while (remaining > 0x7f) {
+            bytes.push((remaining % 0x80) | 0x80);
+            remaining = Math.floor(remaining / 0x80);
+        }
+        bytes.push(remaining);
+        this.chunks.push(Buffer.from(bytes));
+        return this;
+    }
+
+    public bytes(field: number, data: Buffer): this {
+        this.varint(field * 8 + WIRE_LENGTH_DELIMITED).varint(data.length);
+        this.chunks.push(data);
+        return this;
+    }
+
+    // proto3: default values (empty, 0, false) are not written
+    public string(field: number, value: string | undefined): this {
+        return value ? this.bytes(field, Buffer.from(value, 'utf8')) : this;
+    }
+
+    public uint(field: number, value: number | undefined): this {
+        return value ? this.varint(field * 8 + WIRE_VARINT).varint(value) : this;
+    }
+
+    public bool(field: number, value: boolean | undefined): this {
+        return value ? this.varint(field * 8 + WIRE_VARINT).varint(1) : this;
+    }
+
+    public fixed64(field: number, value: bigint): this {
+        if (value === 0n) return this;
+        const data = Buffer.alloc(8);
+        data.writeBigUInt64LE(value);
+        this.varint(field * 8 + WIRE_FIXED64);
+        this.chunks.push(data);
+        return this;
+    }
+
+    public json(field: number, value: unknown): this {
+        return value === undefined ? this : this.string(field, JSON.stringify(value));
+    }
+
+    public finish(): Buffer {
+        return Buffer.concat(this.chunks);
+    }
+}
+
+/**
+ * One Event message
+ */
+export function encodeEvent(record: IngestRecord): Buffer {
+    const writer = new Writer()
+        .string(1, record.event_id)
+        .string(2, record.raw_message)
+        .string(3, record.received_at)
+        .string(4, record.source_ip)
+        .uint(5, record.source_port)
+        .string(6, record.transport)
+        .string(7, record.collector_name)
+        .string(8, record.site_id)
+        .bool(9, record.quarantined);
+
+    for (const [key, value] of Object.entries(record.tags ?? {})) {
+        writer.bytes(10, new Writer().string(1, key).string(2, value).finish());
+    }
+
+    return writer
+        .json(11, record.syslog)
+        .json(12, record.relay_hops)
+        .json(13, record.stream)
+        .json(14, record.meta)
+        .string(15, record.tenant_id)
+        .string(16, record.source_id)
+        .json(17, record.continuation)
+        .finish();
+}
+
+/**
+ * An EventBatch message
+ */
+export function encodeEventBatch(records: IngestRecord[]): Buffer {
+    const writer = new Writer();
+    for (const record of records) {
+        writer.bytes(1, encodeEvent(record));
+    }
+    return writer.finish();
+}
+
+/**
+ * An EventBatch of the gRPC stream, numbered so its BatchAck can be matched
+ */
+export function encodeStreamBatch(records: IngestRecord[], sequence: number, traceparent?: string): Buffer {
+    const writer = new Writer();
+    for (const record of records) {
+        writer.bytes(1, encodeEvent(record));
+    }
+    return writer
+        .uint(2, sequence)
+        .string(3, traceparent)
+        .finish();
+}
+
+export interface BatchAck {
+    sequence: number;
+    rejected: Array<{ index: number; event_id?: string; reason: string; retryable: boolean }>;
+}
+
+/**
+ * A BatchAck message
+ */
+export function decodeBatchAck(data: Buffer): BatchAck {
+    const ack: BatchAck = { sequence: 0, rejected: [] };
+    for (const { number, value } of fields(data)) {
+        if (number === 1 && typeof value === 'number') ack.sequence = value;
+        if (number !== 2 || !Buffer.isBuffer(value)) continue;
+
+        const rejection: BatchAck['rejected'][number] = { index: 0, reason: 'unspecified', retryable: false };
+        for (const field of fields(value)) {
+            if (field.number === 1 && typeof field.value === 'number') rejection.index = field.value;
+            else if (field.number === 2 && Buffer.isBuffer(field.value)) rejection.event_id = field.value.toString('utf8');
+            else if (field.number === 3 && Buffer.isBuffer(field.value)) rejection.reason = field.value.toString('utf8');
+            else if (field.number === 4 && typeof field.value === 'number') rejection.retryable = field.value !== 0;
+        }
+        ack.rejected.push(rejection);
+    }
+    return ack;
+}
+
+/**
+ * Minimal protobuf wire format reader: varints (as numbers), fixed32,
+ * fixed64 and length-delimited fields (as Buffers). Unknown fields are the
+ * caller's to skip, as proto3 requires.
+ */
+export function* fields(data: Buffer): Generator<{ number: number; value: number | Buffer }> {
+    let offset = 0;
+    while (offset < data.length) {
+        const key = readVarint(data, offset);
+        offset = key.next;
+        const number = Math.floor(key.value / 8);
+
+        switch (key.value & 7) {
+            case 0: {
+                const varint = readVarint(data, offset);
+                offset = varint.next;
+                yield { number, value: varint.value };
+                break;
+            }
+            case 1:
+                if (offset + 8 > data.length) throw new Error('Truncated fixed64');
+                yield { number, value: Number(data.readBigUInt64LE(offset)) };
+                offset += 8;
+                break;
+            case 2: {
+                const length = readVarint(data, offset);
+                offset = length.next;
+                if (offset + length.value > data.length) throw new Error('Truncated field');
+                yield { number, value: data.subarray(offset, offset + length.value) };
+                offset += length.value;
+                break;
+            }
+            case 5:
+                if (offset + 4 > data.length) throw new Error('Truncated fixed32');
+                yield { number, value: data.readUInt32LE(offset) };
+                offset += 4;
+                break;
+            default:
+                throw new Error(`Unsupported wire type ${key.value & 7}`);
+        }
+    }
+}
+
+function readVarint(data: Buffer, start: number): { value: number; next: number } {
+    let value = 0;
+    let multiplier = 1;
+    let offset = start;
+
+    for (;;) {
+        if (offset >= data.length || offset - start >= 10) throw new Error('Invalid varint');
+        const byte = data[offset++]!;
+        value += (byte & 0x7f) * multiplier;
+        if ((byte & 0x80) === 0) break;
+        multiplier *= 128;
+    }
+    return { value, next: offset };
+}
@@ -0,0 +1,49 @@
+const REQUEST_TIMEOUT_MS = 10000;
+
+/**
+ * Minimal Confluent Schema Registry client: registers a schema under a
+ * subject (idempotent on the registry side) and caches the returned ID.
+ */
+export class SchemaRegistry {
+    private readonly url: string;
+    private readonly auth: string | undefined; // "user:password" (Basic auth)
+    private readonly ids = new Map<string, Promise<number>>();
+
+    constructor(url: string, auth?: string) {
+        this.url = url.replace(/\/$/, '');
+        this.auth = auth;
+    }
+
+    /**
+     * ID of `schema` under `subject`, registering it on first use
+     */
+    public schemaId(subject: string, schema: string): Promise<number> {
+        const key = `${subject}\n${schema}`;
+        let id = this.ids.get(key);
+        if (!id) {
+            id = this.register(subject, schema);
+            // Don't cache failures: the next call tries again
+            id.catch(() => this.ids.delete(key));
+            this.ids.set(key, id);
+        }
+        return id;
+    }
+
+    private async register(subject: string, schema: string): Promise<number> {
+        const response = await fetch(`${this.url}/subjects/${encodeURIComponent(subject)}/versions`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/vnd.schemaregistry.v1+json',
+                ...(this.auth && { 'Authorization': `Basic ${Buffer.from(this.auth).toString('base64')}` }),
+            },
+            body: JSON.stringify({ schema }),
+            signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS),
+        });
+
+        const body = await response.json().catch(() => ({})) as { id?: unknown; message?: string };
+        if (!response.ok || !Number.isInteger(body.id)) {
+            throw new Error(`Schema registry refused ${subject}: ${body.message ?? `HTTP ${response.status}`}`);
+        }
+        return body.id as number;
+    }
+}
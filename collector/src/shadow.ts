@@ -0,0 +1,131 @@
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { buildIngestPayload, getSerializer } from './serializers.js';
+import { identityHeaders } from './identity.js';
+import { OutputQueue, type OverflowPolicy } from './output-queue.js';
+import { backendFetch } from './http-client.js';
+import { apiKey } from './api-key.js';
+import { log } from './logger.js';
+
+const REQUEST_TIMEOUT_MS = 10000;
+
+export interface ShadowStats {
+    url: string;
+    sample_rate: number;
+    sampled: number;
+    sent: number;
+    failed: number;
+    dropped: number; // Queue full (shadow slower than live traffic)
+    queue: number;
+    queue_capacity: number;
+    overflow: OverflowPolicy;
+    avg_latency_ms: number;
+    responses: Record<string, number>; // HTTP status (or "error") -> count
+}
+
+/**
+ * Shadow (canary) Forwarder
+ *
+ * Sends a sample (SHADOW_SAMPLE_RATE) of live events to a secondary backend
+ * (SHADOW_URL) in addition to the primary, to try new ingest API versions
+ * against real traffic. Strictly best-effort and isolated from delivery:
+ * - separate bounded queue (SHADOW_QUEUE_SIZE, see OutputQueue); excess samples
+ *   are dropped per SHADOW_OVERFLOW, never the primary's events
+ * - no retries, no retry queue, no DLQ, no endpoint failover
+ * - responses and latency are recorded for comparison with the primary
+ */
+export class ShadowForwarder {
+    private readonly bulkUrl: string;
+    private readonly headers: Record<string, string>;
+    private readonly queue: OutputQueue;
+
+    private sampled = 0;
+    private sent = 0;
+    private failed = 0;
+    private latencySum = 0;
+    private latencyCount = 0;
+    private responses: Record<string, number> = {};
+
+    constructor(url: string) {
+        this.bulkUrl = url.replace('/syslog', '/syslog/bulk');
+        this.headers = {
+            ...identityHeaders(),
+            'X-Centinela-Shadow': 'true',
+        };
+        this.queue = new OutputQueue('Shadow', {
+            capacity: () => config.SHADOW_QUEUE_SIZE,
+            overflow: () => config.SHADOW_OVERFLOW,
+            send: (batch) => this.sendBatch(batch),
+        });
+    }
+
+    /**
+     * Offer events that are about to be sent to the primary; a sample is queued
+     */
+    public offer(events: SyslogEvent[]): void {
+        const sample = events.filter(() => Math.random() < config.SHADOW_SAMPLE_RATE);
+        this.sampled += sample.length;
+        this.queue.offer(sample);
+    }
+
+    public start(): void {
+        log.info(`🐤 Shadow forwarding ${config.SHADOW_SAMPLE_RATE * 100}% of traffic to ${this.bulkUrl}`);
+
+        this.queue.start();
+    }
+
+    public stop(): void {
+        this.queue.stop();
+    }
+
+    public getStats(): ShadowStats {
+        const queue = this.queue.getStats();
+        return {
+            url: this.bulkUrl,
+            sample_rate: config.SHADOW_SAMPLE_RATE,
+            sampled: this.sampled,
+            sent: this.sent,
+            failed: this.failed,
+            dropped: queue.dropped,
+            queue: queue.queued,
+            queue_capacity: queue.capacity,
+            overflow: queue.overflow,
+            avg_latency_ms: this.latencyCount > 0 ? Math.round(this.latencySum / this.latencyCount) : 0,
+            responses: { ...this.responses },
+        };
+    }
+
+    private async sendBatch(batch: SyslogEvent[]): Promise<void> {
+        const start = Date.now();
+        let outcome: string;
+
+        try {
+            const serializer = getSerializer(config.SHADOW_FORMAT);
+            const response = await backendFetch(this.bulkUrl, {
+                method: 'POST',
+                headers: {
+                    ...this.headers,
+                    'Authorization': `Bearer ${config.SHADOW_API_KEY ?? apiKey()}`,
+                    'Content-Type': serializer.contentType,
+                },
+                body: serializer.batch(batch.map(buildIngestPayload)),
+                signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS),
+            });
+            await response.text().catch(() => '');
+            outcome = String(response.status);
+
+            if (response.ok) {
+                this.sent += batch.length;
+                this.latencySum += Date.now() - start;
+                this.latencyCount++;
+            } else {
+                this.failed += batch.length;
+            }
+        } catch {
+            outcome = 'error';
+            this.failed += batch.length;
+        }
+
+        this.responses[outcome] = (this.responses[outcome] ?? 0) + 1;
+    }
+}
@@ -0,0 +1,121 @@
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { burstSeed, renderMessage, TRAFFIC_PROFILES } from './simulation/profiles.js';
+import { log } from './logger.js';
+
+const TICK_MS = 100;
+const BURST_EVENTS_PER_TICK = 50;
+
+export interface SimulationStats {
+    running: boolean;
+    profile: string;
+    target_eps: number;
+    generated: number;
+    bursts: number;
+    started_at: string | null;
+    ends_at: string | null; // null: until the collector stops
+}
+
+/**
+ * Simulation Input (SIMULATION_PROFILE)
+ *
+ * Generates syslog traffic from a bundled profile (see simulation/profiles.ts)
+ * at SIMULATION_EPS and feeds it through the same pipeline as received
+ * messages: parsing, source policy, rules, anonymization, buffering, WAL and
+ * forwarding. For demos and capacity tests without customer data; run it
+ * against a mock backend with `collector simulate --mock-backend`.
+ *
+ * Every event is tagged simulated=true and comes from 198.18.0.0/15, so it
+ * can't be mistaken for real traffic if it reaches a real tenant.
+ */
+export class SimulationInput {
+    private buffer: MessageBuffer;
+    private timer: NodeJS.Timeout | null = null;
+    private carry = 0; // Fraction of an event owed from previous ticks
+    private burst: { remaining: number; attacker: string } | null = null;
+    private startedAt: number | null = null;
+    private generated = 0;
+    private bursts = 0;
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+    }
+
+    private get endsAt(): number | null {
+        return this.startedAt !== null && config.SIMULATION_DURATION_MS > 0 ? this.startedAt + config.SIMULATION_DURATION_MS : null;
+    }
+
+    public start(): void {
+        this.startedAt = Date.now();
+        log.info(`🧪 SIMULATION: generating ${config.SIMULATION_PROFILE} traffic at ${config.SIMULATION_EPS} events/s` +
+            (config.SIMULATION_DURATION_MS > 0 ? ` for ${config.SIMULATION_DURATION_MS / 1000}s` : '') +
+            ' (tagged simulated=true)');
+        this.timer = setInterval(() => this.tick(), TICK_MS);
+    }
+
+    public stop(): void {
+        if (!this.timer) return;
+        clearInterval(this.timer);
+        this.timer = null;
+
+        const seconds = (Date.now() - this.startedAt!) / 1000;
+        log.info(`🧪 Simulation finished: ${this.generated} events in ${seconds.toFixed(1)}s ` +
+            `(${Math.round(this.generated / Math.max(seconds, 0.001))} events/s, ${this.bursts} bursts)`);
+    }
+
+    public getStats(): SimulationStats {
+        const endsAt = this.endsAt;
+        return {
+            running: this.timer !== null,
+            profile: config.SIMULATION_PROFILE,
+            target_eps: config.SIMULATION_EPS,
+            generated: this.generated,
+            bursts: this.bursts,
+            started_at: this.startedAt ? new Date(this.startedAt).toISOString() : null,
+            ends_at: endsAt ? new Date(endsAt).toISOString() : null,
+        };
+    }
+
+    private tick(): void {
+        const now = new Date();
+        const endsAt = this.endsAt;
+        if (endsAt !== null && now.getTime() >= endsAt) {
+            this.stop();
+            return;
+        }
+
+        const profile = TRAFFIC_PROFILES[config.SIMULATION_PROFILE]!;
+        this.carry += config.SIMULATION_EPS * TICK_MS / 1000;
+        const count = Math.floor(this.carry);
+        this.carry -= count;
+
+        for (let i = 0; i < count; i++) {
+            const message = renderMessage(profile, now);
+            this.emit(message.raw, message.sourceIp);
+            if (profile.burst && !this.burst && Math.random() < profile.burst.chance) {
+                this.burst = { remaining: profile.burst.size, attacker: burstSeed() };
+                this.bursts++;
+            }
+        }
+
+        // On top of the steady rate, like the real thing
+        if (this.burst && profile.burst) {
+            const size = Math.min(this.burst.remaining, BURST_EVENTS_PER_TICK);
+            for (let i = 0; i < size; i++) {
+                const message = profile.burst.render(now, this.burst.attacker);
+                this.emit(message.raw, message.sourceIp);
+            }
+            this.burst.remaining -= size;
+            if (this.burst.remaining <= 0) this.burst = null;
+        }
+    }
+
+    private emit(raw: string, sourceIp: string): void {
+        const event = createSyslogEvent(raw, { address: sourceIp, port: 514 }, 'simulation');
+        event.tags = { ...event.tags, simulated: 'true', simulation_profile: config.SIMULATION_PROFILE };
+        ingestEvent(this.buffer, event);
+        this.generated++;
+    }
+}
@@ -0,0 +1,203 @@
+/**
+ * Traffic profiles for simulation mode: the mix of devices and messages of a
+ * typical site (shapes taken from real traffic, values generated), so demos
+ * and capacity tests never need customer data. Every device uses an address
+ * of 198.18.0.0/15, the range reserved for benchmarking (RFC 2544).
+ */
+
+export interface SimulatedMessage {
+    raw: string;
+    sourceIp: string;
+}
+
+interface Template {
+    weight: number;
+    render: (now: Date) => SimulatedMessage;
+}
+
+export interface TrafficProfile {
+    description: string;
+    templates: Template[];
+    // Occasional bursts on top of the steady rate (e.g. an SSH brute force)
+    burst?: { chance: number; size: number; render: (now: Date, seed: string) => SimulatedMessage };
+}
+
+const MONTHS = ['Jan', 'Feb', 'Mar', 'Apr', 'May', 'Jun', 'Jul', 'Aug', 'Sep', 'Oct', 'Nov', 'Dec'];
+
+const USERS = ['alice', 'bob', 'carol', 'dave', 'erin', 'frank', 'grace', 'heidi', 'svc_backup', 'svc_sql'];
+const BAD_USERS = ['admin', 'root', 'test', 'oracle', 'ubuntu', 'user', 'postgres', 'guest'];
+const SERVICES: Array<[number, string]> = [[443, 'HTTPS'], [80, 'HTTP'], [53, 'DNS'], [123, 'NTP'], [22, 'SSH'], [3389, 'RDP'], [445, 'SMB']];
+const PROCESSES = ['C:\\Windows\\System32\\svchost.exe', 'C:\\Windows\\System32\\cmd.exe', 'C:\\Windows\\System32\\WindowsPowerShell\\v1.0\\powershell.exe',
+    'C:\\Program Files\\Google\\Chrome\\Application\\chrome.exe', 'C:\\Windows\\System32\\wbem\\WmiPrvSE.exe'];
+const COMMANDS = ['/usr/bin/systemctl restart nginx', '/usr/bin/apt-get update', '/usr/bin/journalctl -u sshd', '/bin/cat /var/log/auth.log'];
+
+const FIREWALLS = { fortigate: '198.18.0.1', asa: '198.18.0.2', pfsense: '198.18.0.3' };
+const DOMAIN_CONTROLLERS = [['DC01.corp.example', '198.18.1.10'], ['DC02.corp.example', '198.18.1.11']] as const;
+const WORKSTATIONS = [['WS-0142.corp.example', '198.18.1.42'], ['WS-0157.corp.example', '198.18.1.57']] as const;
+const LINUX_HOSTS = [['web-01', '198.18.2.10'], ['web-02', '198.18.2.11'], ['db-01', '198.18.2.20'], ['bastion', '198.18.2.5']] as const;
+
+function pick<T>(items: readonly T[]): T {
+    return items[Math.floor(Math.random() * items.length)]!;
+}
+
+function int(min: number, max: number): number {
+    return min + Math.floor(Math.random() * (max - min + 1));
+}
+
+function internalIp(): string {
+    return `10.1.${int(10, 40)}.${int(2, 250)}`;
+}
+
+function externalIp(): string {
+    // Documentation ranges (RFC 5737): never a real host
+    return `${pick(['192.0.2', '198.51.100', '203.0.113'])}.${int(1, 254)}`;
+}
+
+function pad(n: number): string {
+    return String(n).padStart(2, '0');
+}
+
+// RFC 3164 timestamp: "Oct  6 04:05:44"
+function bsdTimestamp(now: Date): string {
+    return `${MONTHS[now.getMonth()]} ${String(now.getDate()).padStart(2, ' ')} ${pad(now.getHours())}:${pad(now.getMinutes())}:${pad(now.getSeconds())}`;
+}
+
+function fortigate(now: Date): SimulatedMessage {
+    const [port, service] = pick(SERVICES);
+    const deny = Math.random() < 0.15;
+    const date = `${now.getFullYear()}-${pad(now.getMonth() + 1)}-${pad(now.getDate())}`;
+    const time = `${pad(now.getHours())}:${pad(now.getMinutes())}:${pad(now.getSeconds())}`;
+    const raw = `<${deny ? 188 : 189}>date=${date} time=${time} devname="FGT-HQ-01" devid="FG100FTK19000001" ` +
+        `logid="${deny ? '0000000013' : '0000000020'}" type="traffic" subtype="forward" level="${deny ? 'warning' : 'notice'}" vd="root" ` +
+        `eventtime=${now.getTime()}000000 srcip=${internalIp()} srcport=${int(1024, 65535)} srcintf="port2" ` +
+        `dstip=${externalIp()} dstport=${port} dstintf="wan1" proto=${port === 53 || port === 123 ? 17 : 6} ` +
+        `action="${deny ? 'deny' : 'accept'}" policyid=${deny ? 0 : int(1, 40)} service="${service}" ` +
+        `sentbyte=${deny ? 0 : int(60, 50000)} rcvdbyte=${deny ? 0 : int(60, 500000)} duration=${deny ? 0 : int(1, 300)}`;
+    return { raw, sourceIp: FIREWALLS.fortigate };
+}
+
+function asa(now: Date): SimulatedMessage {
+    const [port] = pick(SERVICES);
+    const message = Math.random() < 0.7
+        ? `%ASA-6-302013: Built outbound TCP connection ${int(100000, 9999999)} for outside:${externalIp()}/${port} ` +
+          `(${externalIp()}/${port}) to inside:${internalIp()}/${int(1024, 65535)} (198.18.0.2/${int(1024, 65535)})`
+        : `%ASA-4-106023: Deny tcp src outside:${externalIp()}/${int(1024, 65535)} dst inside:${internalIp()}/${port} ` +
+          `by access-group "OUTSIDE_IN" [0x0, 0x0]`;
+    return { raw: `<166>${bsdTimestamp(now)} ASA-EDGE : ${message}`, sourceIp: FIREWALLS.asa };
+}
+
+function pfsense(now: Date): SimulatedMessage {
+    const [port] = pick(SERVICES);
+    const block = Math.random() < 0.6;
+    const raw = `<134>${bsdTimestamp(now)} pfsense filterlog[41823]: ${int(4, 120)},,,1000000103,igb0,match,` +
+        `${block ? 'block' : 'pass'},in,4,0x0,,${int(40, 128)},${int(0, 65535)},0,DF,6,tcp,60,${externalIp()},198.18.0.3,` +
+        `${int(1024, 65535)},${port},0,S,${int(100000000, 4000000000)},,64240,,mss;sackOK;TS;nop;wscale`;
+    return { raw, sourceIp: FIREWALLS.pfsense };
+}
+
+// Windows Security log as forwarded by an agent (NXLog-style RFC 5424, key=value)
+function windows(eventId: number, fields: () => string, hosts: ReadonlyArray<readonly [string, string]> = DOMAIN_CONTROLLERS) {
+    return (now: Date): SimulatedMessage => {
+        const [host, ip] = pick(hosts);
+        const severity = eventId === 4625 ? 4 : 6;
+        return {
+            raw: `<${13 * 8 + severity}>1 ${now.toISOString()} ${host} Microsoft-Windows-Security-Auditing - ${eventId} - ` +
+                `EventID=${eventId} Channel=Security ${fields()}`,
+            sourceIp: ip,
+        };
+    };
+}
+
+function sshd(message: () => string) {
+    return (now: Date): SimulatedMessage => {
+        const [host, ip] = pick(LINUX_HOSTS);
+        return { raw: `<38>${bsdTimestamp(now)} ${host} sshd[${int(1000, 65000)}]: ${message()}`, sourceIp: ip };
+    };
+}
+
+const FIREWALL: TrafficProfile = {
+    description: 'Perimeter firewalls: FortiGate traffic logs, Cisco ASA connections and denies, pfSense filterlog',
+    templates: [
+        { weight: 50, render: fortigate },
+        { weight: 30, render: asa },
+        { weight: 20, render: pfsense },
+    ],
+};
+
+const WINDOWS: TrafficProfile = {
+    description: 'Windows Security events from domain controllers and workstations (logons, failures, process creation)',
+    templates: [
+        { weight: 40, render: windows(4624, () => `TargetUserName=${pick(USERS)} TargetDomainName=CORP LogonType=${pick([2, 3, 3, 3, 10])} IpAddress=${internalIp()} AuthenticationPackageName=Kerberos`) },
+        { weight: 25, render: windows(4634, () => `TargetUserName=${pick(USERS)} TargetDomainName=CORP LogonType=3`) },
+        { weight: 15, render: windows(4688, () => `SubjectUserName=${pick(USERS)} NewProcessName=${pick(PROCESSES)} ParentProcessName=C:\\Windows\\explorer.exe`, WORKSTATIONS) },
+        { weight: 10, render: windows(4672, () => `SubjectUserName=${pick(['Administrator', 'svc_backup', 'svc_sql'])} SubjectDomainName=CORP PrivilegeList=SeDebugPrivilege`) },
+        { weight: 10, render: windows(4625, () => `TargetUserName=${pick([...USERS, ...BAD_USERS])} TargetDomainName=CORP LogonType=3 Status=0xC000006D SubStatus=0xC000006A IpAddress=${internalIp()}`) },
+    ],
+};
+
+const LINUX_AUTH: TrafficProfile = {
+    description: 'Linux authentication: sshd logins and failures, sudo, cron sessions, with occasional SSH brute-force bursts',
+    templates: [
+        { weight: 25, render: sshd(() => `Accepted publickey for ${pick(['deploy', ...USERS])} from ${internalIp()} port ${int(1024, 65535)} ssh2: ED25519 SHA256:${Buffer.from(String(Math.random())).toString('base64').slice(0, 43)}`) },
+        { weight: 20, render: sshd(() => `Failed password for invalid user ${pick(BAD_USERS)} from ${externalIp()} port ${int(1024, 65535)} ssh2`) },
+        { weight: 15, render: sshd(() => `Disconnected from authenticating user root ${externalIp()} port ${int(1024, 65535)} [preauth]`) },
+        {
+            weight: 15,
+            render: (now) => {
+                const [host, ip] = pick(LINUX_HOSTS);
+                const user = pick(USERS);
+                return { raw: `<85>${bsdTimestamp(now)} ${host} sudo:    ${user} : TTY=pts/${int(0, 4)} ; PWD=/home/${user} ; USER=root ; COMMAND=${pick(COMMANDS)}`, sourceIp: ip };
+            },
+        },
+        {
+            weight: 25,
+            render: (now) => {
+                const [host, ip] = pick(LINUX_HOSTS);
+                return { raw: `<78>${bsdTimestamp(now)} ${host} CRON[${int(1000, 65000)}]: pam_unix(cron:session): session opened for user root(uid=0) by (uid=0)`, sourceIp: ip };
+            },
+        },
+    ],
+    burst: {
+        chance: 0.002, // Per generated event
+        size: 200,
+        render: (now, attacker) => {
+            const [host, ip] = LINUX_HOSTS[3]; // The bastion faces the internet
+            return { raw: `<38>${bsdTimestamp(now)} ${host} sshd[${int(1000, 65000)}]: Failed password for ${pick([...BAD_USERS, 'root'])} from ${attacker} port ${int(1024, 65535)} ssh2`, sourceIp: ip };
+        },
+    },
+};
+
+export const TRAFFIC_PROFILES: Record<string, TrafficProfile> = {
+    'mixed': {
+        description: 'A small company site: 60% firewall, 25% Windows, 15% Linux authentication',
+        templates: [
+            ...FIREWALL.templates.map((t) => ({ ...t, weight: t.weight * 0.6 })),
+            ...WINDOWS.templates.map((t) => ({ ...t, weight: t.weight * 0.25 })),
+            ...LINUX_AUTH.templates.map((t) => ({ ...t, weight: t.weight * 0.15 })),
+        ],
+        burst: { ...LINUX_AUTH.burst!, chance: LINUX_AUTH.burst!.chance * 0.15 },
+    },
+    'firewall': FIREWALL,
+    'windows': WINDOWS,
+    'linux-auth': LINUX_AUTH,
+};
+
+/**
+ * One message of the profile, picked by weight
+ */
+export function renderMessage(profile: TrafficProfile, now: Date): SimulatedMessage {
+    const total = profile.templates.reduce((sum, t) => sum + t.weight, 0);
+    let roll = Math.random() * total;
+    for (const template of profile.templates) {
+        roll -= template.weight;
+        if (roll < 0) return template.render(now);
+    }
+    return profile.templates.at(-1)!.render(now);
+}
+
+/**
+ * The source of a burst (an attacker), in a documentation range
+ */
+export function burstSeed(): string {
+    return externalIp();
+}
@@ -0,0 +1,297 @@
+import net from 'node:net';
+import tls from 'node:tls';
+import { Duplex } from 'node:stream';
+
+const SOCKS_VERSION = 0x05;
+const AUTH_NONE = 0x00;
+const AUTH_USERPASS = 0x02;
+const AUTH_REFUSED = 0xff;
+const CMD_CONNECT = 0x01;
+const ATYP_IPV4 = 0x01;
+const ATYP_DOMAIN = 0x03;
+const ATYP_IPV6 = 0x04;
+const HANDSHAKE_TIMEOUT_MS = 15000;
+
+const REPLY_ERRORS: Record<number, string> = {
+    0x01: 'general SOCKS server failure',
+    0x02: 'connection not allowed by ruleset',
+    0x03: 'network unreachable',
+    0x04: 'host unreachable',
+    0x05: 'connection refused',
+    0x06: 'TTL expired',
+    0x07: 'command not supported',
+    0x08: 'address type not supported',
+};
+
+interface DeferredSocketOptions {
+    host: string;
+    port: number;
+    tls?: tls.ConnectionOptions | false;
+    onConnect?: () => void;
+}
+
+export interface SocksProxy {
+    host: string;
+    port: number;
+    username?: string;
+    password?: string;
+    remoteDns: boolean; // socks5h: the proxy resolves target names
+}
+
+/**
+ * Parse socks5://[user:pass@]host:port (names resolved locally) or
+ * socks5h://... (resolved by the proxy, e.g. `ssh -D` to reach internal names)
+ */
+export function parseSocksUrl(value: string): SocksProxy {
+    const url = new URL(value);
+    if (url.protocol !== 'socks5:' && url.protocol !== 'socks5h:') {
+        throw new Error(`Unsupported proxy scheme "${url.protocol}" (expected socks5: or socks5h:)`);
+    }
+    return {
+        host: url.hostname.replace(/^\[|\]$/g, ''),
+        port: Number(url.port) || 1080,
+        username: url.username ? decodeURIComponent(url.username) : undefined,
+        password: url.password ? decodeURIComponent(url.password) : undefined,
+        remoteDns: url.protocol === 'socks5h:',
+    };
+}
+
+/**
+ * Open a TCP connection to host:port through a SOCKS5 proxy (RFC 1928, with
+ * username/password authentication per RFC 1929). Resolves once the proxy has
+ * connected to the target; the socket then carries the target's traffic.
+ */
+export async function connectSocks(proxy: SocksProxy, host: string, port: number): Promise<net.Socket> {
+    const socket = net.connect(proxy.port, proxy.host);
+    socket.setTimeout(HANDSHAKE_TIMEOUT_MS, () => socket.destroy(new Error(`SOCKS proxy ${proxy.host}:${proxy.port} timed out`)));
+
+    try {
+        await new Promise<void>((resolve, reject) => {
+            socket.once('connect', resolve);
+            socket.once('error', reject);
+        });
+        const reader = new HandshakeReader(socket);
+
+        // Greeting: offer username/password only when we have credentials
+        const methods = proxy.username ? [AUTH_NONE, AUTH_USERPASS] : [AUTH_NONE];
+        socket.write(Buffer.from([SOCKS_VERSION, methods.length, ...methods]));
+        const [version, method] = await reader.read(2);
+        if (version !== SOCKS_VERSION) throw new Error('not a SOCKS5 proxy');
+        if (method === AUTH_REFUSED || !methods.includes(method!)) {
+            throw new Error(proxy.username ? 'proxy refused our authentication methods' : 'proxy requires authentication');
+        }
+
+        if (method === AUTH_USERPASS) {
+            const username = Buffer.from(proxy.username ?? '');
+            const password = Buffer.from(proxy.password ?? '');
+            socket.write(Buffer.concat([
+                Buffer.from([0x01, username.length]), username,
+                Buffer.from([password.length]), password,
+            ]));
+            const [, status] = await reader.read(2);
+            if (status !== 0x00) throw new Error('proxy authentication failed');
+        }
+
+        // CONNECT, with the name itself when the proxy resolves it
+        const address = await targetAddress(host, proxy.remoteDns);
+        const portBytes = Buffer.alloc(2);
+        portBytes.writeUInt16BE(port);
+        socket.write(Buffer.concat([Buffer.from([SOCKS_VERSION, CMD_CONNECT, 0x00]), address, portBytes]));
+
+        const [, reply, , addressType] = await reader.read(4);
+        if (reply !== 0x00) throw new Error(REPLY_ERRORS[reply!] ?? `proxy reply ${reply}`);
+        // Bound address and port (unused)
+        const addressLength = addressType === ATYP_IPV4 ? 4 : addressType === ATYP_IPV6 ? 16 : (await reader.read(1))[0]!;
+        await reader.read(addressLength + 2);
+
+        reader.release();
+        socket.setTimeout(0);
+        return socket;
+    } catch (err) {
+        socket.destroy();
+        throw new Error(`SOCKS proxy ${proxy.host}:${proxy.port} -> ${host}:${port}: ${(err as Error).message}`);
+    }
+}
+
+/**
+ * Socket-like stream to host:port through the proxy, returned before the
+ * connection exists, for clients that need a socket synchronously (kafkajs'
+ * socketFactory). Writes are held until the tunnel (and TLS, if requested) is
+ * up; `onConnect` is then called, as for net.connect / tls.connect.
+ */
+export function socksSocket(proxy: SocksProxy, options: DeferredSocketOptions): Duplex {
+    return new DeferredSocket(proxy, options);
+}
+
+async function targetAddress(host: string, remoteDns: boolean): Promise<Buffer> {
+    let ip = net.isIP(host) ? host : null;
+    if (!ip && !remoteDns) {
+        const { lookup } = await import('node:dns/promises');
+        ip = (await lookup(host)).address;
+    }
+
+    if (ip && net.isIPv4(ip)) return Buffer.from([ATYP_IPV4, ...ip.split('.').map(Number)]);
+    if (ip) return Buffer.concat([Buffer.from([ATYP_IPV6]), ipv6Bytes(ip)]);
+
+    const name = Buffer.from(host);
+    if (name.length > 255) throw new Error(`host name too long: ${host}`);
+    return Buffer.concat([Buffer.from([ATYP_DOMAIN, name.length]), name]);
+}
+
+function ipv6Bytes(ip: string): Buffer {
+    const [head, tail] = ip.split('::') as [string, string | undefined];
+    const headGroups = head ? head.split(':') : [];
+    const tailGroups = tail ? tail.split(':') : [];
+    const groups = tail === undefined
+        ? headGroups
+        : [...headGroups, ...Array(8 - headGroups.length - tailGroups.length).fill('0'), ...tailGroups];
+    const bytes = Buffer.alloc(16);
+    groups.forEach((group, index) => bytes.writeUInt16BE(parseInt(group, 16), index * 2));
+    return bytes;
+}
+
+/**
+ * Reads exact byte counts off the socket during the handshake
+ */
+class HandshakeReader {
+    private readonly socket: net.Socket;
+    private buffered = Buffer.alloc(0);
+    private waiting: { size: number; resolve: (bytes: Buffer) => void; reject: (err: Error) => void } | null = null;
+    private failure: Error | null = null;
+    private readonly onData = (chunk: Buffer) => {
+        this.buffered = Buffer.concat([this.buffered, chunk]);
+        this.deliver();
+    };
+    private readonly onClose = (err?: Error) => {
+        this.failure = err instanceof Error ? err : new Error('proxy closed the connection');
+        this.waiting?.reject(this.failure);
+        this.waiting = null;
+    };
+
+    constructor(socket: net.Socket) {
+        this.socket = socket;
+        socket.on('data', this.onData);
+        socket.on('error', this.onClose);
+        socket.on('close', this.onClose);
+    }
+
+    public read(size: number): Promise<Buffer> {
+        return new Promise((resolve, reject) => {
+            if (this.failure) return reject(this.failure);
+            this.waiting = { size, resolve, reject };
+            this.deliver();
+        });
+    }
+
+    /** Hand the socket over to its user (nothing is read past the handshake) */
+    public release(): void {
+        this.socket.off('data', this.onData);
+        this.socket.off('error', this.onClose);
+        this.socket.off('close', this.onClose);
+        this.socket.pause();
+        if (this.buffered.length > 0) this.socket.unshift(this.buffered); // Target spoke first
+    }
+
+    private deliver(): void {
+        if (!this.waiting || this.buffered.length < this.waiting.size) return;
+        const { size, resolve } = this.waiting;
+        this.waiting = null;
+        resolve(this.buffered.subarray(0, size));
+        this.buffered = this.buffered.subarray(size);
+    }
+}
+
+class DeferredSocket extends Duplex {
+    private readonly options: DeferredSocketOptions;
+    private inner: net.Socket | null = null;
+    private pending: Array<{ chunk: Buffer; callback: (err?: Error | null) => void }> = [];
+    private keepAlive: [boolean, number] | null = null;
+
+    constructor(proxy: SocksProxy, options: DeferredSocketOptions) {
+        super();
+        this.options = options;
+        connectSocks(proxy, options.host, options.port)
+            .then((raw) => options.tls
+                ? new Promise<net.Socket>((resolve, reject) => {
+                    const secure = tls.connect({
+                        servername: net.isIP(options.host) ? undefined : options.host,
+                        ...options.tls,
+                        socket: raw,
+                    }, () => resolve(secure));
+                    secure.once('error', reject);
+                })
+                : raw)
+            .then((socket) => this.attach(socket), (err: Error) => this.destroy(err));
+    }
+
+    public setKeepAlive(enable = false, initialDelay = 0): this {
+        if (this.inner) this.inner.setKeepAlive(enable, initialDelay);
+        else this.keepAlive = [enable, initialDelay];
+        return this;
+    }
+
+    public setTimeout(timeout: number, callback?: () => void): this {
+        if (callback) this.once('timeout', callback);
+        this.inner?.setTimeout(timeout);
+        return this;
+    }
+
+    public setNoDelay(noDelay = true): this {
+        this.inner?.setNoDelay(noDelay);
+        return this;
+    }
+
+    public ref(): this {
+        this.inner?.ref();
+        return this;
+    }
+
+    public unref(): this {
+        this.inner?.unref();
+        return this;
+    }
+
+    public _read(): void {
+        this.inner?.resume();
+    }
+
+    public _write(chunk: Buffer, _encoding: BufferEncoding, callback: (err?: Error | null) => void): void {
+        if (this.inner) this.inner.write(chunk, callback);
+        else this.pending.push({ chunk, callback });
+    }
+
+    public _final(callback: (err?: Error | null) => void): void {
+        if (this.inner) this.inner.end(callback);
+        else callback();
+    }
+
+    public _destroy(err: Error | null, callback: (err?: Error | null) => void): void {
+        this.inner?.destroy();
+        for (const { callback: pendingCallback } of this.pending) pendingCallback(err ?? new Error('socket destroyed'));
+        this.pending = [];
+        callback(err);
+    }
+
+    private attach(socket: net.Socket): void {
+        if (this.destroyed) {
+            socket.destroy();
+            return;
+        }
+
+        this.inner = socket;
+        if (this.keepAlive) socket.setKeepAlive(...this.keepAlive);
+        socket.on('data', (chunk: Buffer) => {
+            if (!this.push(chunk)) socket.pause();
+        });
+        socket.on('end', () => this.push(null));
+        socket.on('timeout', () => this.emit('timeout'));
+        socket.on('error', (err) => this.destroy(err));
+        socket.on('close', () => this.destroy());
+        socket.resume();
+
+        for (const { chunk, callback } of this.pending) socket.write(chunk, callback);
+        this.pending = [];
+        this.emit(this.options.tls ? 'secureConnect' : 'connect');
+        this.options.onConnect?.();
+    }
+}
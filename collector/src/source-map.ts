@@ -0,0 +1,102 @@
+import { readFileSync } from 'node:fs';
+import { config, parseSourceMapping, type Config, type SourceMapping } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { CidrList } from './cidr.js';
+import { log } from './logger.js';
+
+export interface SourceMapStats {
+    entries: number;
+    unmapped_policy: 'default' | 'reject';
+    mapped: number;
+    unmapped: number;
+    rejected: number;
+}
+
+interface CompiledMapping extends SourceMapping {
+    list: CidrList;
+    prefix: number;
+}
+
+/**
+ * Source Map (source IP -> tenant/site/source)
+ *
+ * Lets one listener serve many tenants: each event's source IP is looked up
+ * in SOURCE_MAP and SOURCE_MAP_FILE (most specific range wins) and the
+ * mapping's tenant, site, source and static tags are set on the event. Events that already
+ * carry a tenant or site (relayed by another collector) are left alone.
+ * Unmapped sources keep the defaults (the listener's, then TENANT_ID/SITE_ID)
+ * or, with UNMAPPED_SOURCE_POLICY=reject, are dropped.
+ */
+class SourceMap {
+    private mappings: CompiledMapping[] = [];
+    private counters = { mapped: 0, unmapped: 0, rejected: 0 };
+
+    /**
+     * (Re)build the table from a configuration (at startup and on SIGHUP,
+     * which also picks up edits to SOURCE_MAP_FILE). Throws if the file can't
+     * be read or has an invalid line; the current table is then kept.
+     */
+    public reload(settings: Pick<Config, 'SOURCE_MAP' | 'SOURCE_MAP_FILE' | 'UNMAPPED_SOURCE_POLICY'> = config): void {
+        const mappings = [...settings.SOURCE_MAP];
+        if (settings.SOURCE_MAP_FILE) {
+            const lines = readFileSync(settings.SOURCE_MAP_FILE, 'utf8').split('\n');
+            lines.forEach((line, index) => {
+                const content = line.replace(/#.*/, '').trim();
+                if (!content) return;
+                try {
+                    mappings.push(parseSourceMapping(content));
+                } catch (err) {
+                    throw new Error(`${settings.SOURCE_MAP_FILE}:${index + 1}: ${(err as Error).message}`);
+                }
+            });
+        }
+
+        this.mappings = mappings
+            .map((mapping) => ({
+                ...mapping,
+                list: new CidrList([mapping.cidr]),
+                prefix: Number(mapping.cidr.split('/')[1] ?? 128),
+            }))
+            .sort((a, b) => b.prefix - a.prefix);
+
+        if (this.mappings.length > 0) {
+            log.info(`🗺️ Source map: ${this.mappings.length} range(s), unmapped sources: ${settings.UNMAPPED_SOURCE_POLICY}`);
+        }
+    }
+
+    /**
+     * Set the tenant/site/source of an event from its source IP. Returns
+     * false if the event must be dropped (unmapped, policy reject).
+     */
+    public apply(event: SyslogEvent): boolean {
+        if (this.mappings.length === 0) return true;
+        if (event.tenant_id !== undefined || event.site_id !== undefined) return true;
+
+        const mapping = this.mappings.find((candidate) => candidate.list.contains(event.source_ip));
+        if (!mapping) {
+            this.counters.unmapped++;
+            if (config.UNMAPPED_SOURCE_POLICY === 'reject') {
+                this.counters.rejected++;
+                return false;
+            }
+            return true;
+        }
+
+        this.counters.mapped++;
+        event.tenant_id = mapping.tenant;
+        event.site_id = mapping.site;
+        event.source_id ??= mapping.source;
+        if (mapping.tags) event.tags = { ...mapping.tags, ...event.tags };
+        return true;
+    }
+
+    public getStats(): SourceMapStats {
+        return {
+            entries: this.mappings.length,
+            unmapped_policy: config.UNMAPPED_SOURCE_POLICY,
+            ...this.counters,
+        };
+    }
+}
+
+export const sourceMap = new SourceMap();
@@ -0,0 +1,181 @@
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { CidrList } from './cidr.js';
+import { createSyslogEvent } from './events.js';
+import { log } from './logger.js';
+
+const MAX_TRACKED_SOURCES = 10000;
+const SUMMARY_TOP_SOURCES = 20;
+
+export interface SourceRateLimitStats {
+    eps: number; // 0 = unlimited
+    burst: number;
+    action: 'drop' | 'tag';
+    exempt_sources: number;
+    tracked_sources: number;
+    throttled: number; // Events over the limit (dropped or tagged)
+    untracked: number; // Events not limited because MAX_TRACKED_SOURCES was reached
+}
+
+export interface ThrottledSource {
+    source_ip: string;
+    throttled: number; // Since the last summary
+    last_throttled: string;
+}
+
+interface Bucket {
+    tokens: number;
+    refilledAt: number;
+    throttled: number; // Since the last summary
+    lastThrottled: number;
+}
+
+/**
+ * Per-Source Rate Limit
+ *
+ * One misbehaving device (a debug level left on, a logging loop) can flood
+ * the collector and use up the tenant's backend budget for everyone else. Each
+ * source IP gets a token bucket of SOURCE_RATE_LIMIT_EPS events/second with
+ * SOURCE_RATE_LIMIT_BURST headroom; events over it are dropped, or with
+ * SOURCE_RATE_LIMIT_ACTION=tag forwarded with a rate_limited tag.
+ *
+ * Every SOURCE_RATE_LIMIT_SUMMARY_INTERVAL_MS, if any source was throttled, a
+ * summary of the noisiest ones is logged and sent as an event, instead of a
+ * line per dropped event.
+ */
+class SourceRateLimiter {
+    private exemptList: CidrList | null = null;
+    private buckets = new Map<string, Bucket>();
+    private counters = { throttled: 0, untracked: 0 };
+    private summaryStart = Date.now();
+    private timer: NodeJS.Timeout | null = null;
+
+    // Built on first use, not when the module is imported
+    private get exempt(): CidrList {
+        return this.exemptList ??= new CidrList(config.SOURCE_RATE_LIMIT_EXEMPT);
+    }
+
+    /**
+     * Take a token for an event's source. Returns false if the event must be
+     * dropped; tagged in place with action=tag.
+     */
+    public admit(event: SyslogEvent): boolean {
+        const eps = config.SOURCE_RATE_LIMIT_EPS;
+        if (eps === 0 || this.exempt.contains(event.source_ip)) return true;
+
+        const now = Date.now();
+        const burst = this.burst();
+        let bucket = this.buckets.get(event.source_ip);
+        if (!bucket) {
+            if (this.buckets.size >= MAX_TRACKED_SOURCES) {
+                // Fail open: a flood of distinct addresses must not silence known devices
+                this.counters.untracked++;
+                return true;
+            }
+            bucket = { tokens: burst, refilledAt: now, throttled: 0, lastThrottled: 0 };
+            this.buckets.set(event.source_ip, bucket);
+        }
+
+        bucket.tokens = Math.min(burst, bucket.tokens + (now - bucket.refilledAt) / 1000 * eps);
+        bucket.refilledAt = now;
+        if (bucket.tokens >= 1) {
+            bucket.tokens--;
+            return true;
+        }
+
+        bucket.throttled++;
+        bucket.lastThrottled = now;
+        this.counters.throttled++;
+        if (config.SOURCE_RATE_LIMIT_ACTION === 'drop') return false;
+
+        event.tags = { ...event.tags, rate_limited: 'true' };
+        return true;
+    }
+
+    /**
+     * Send a summary of throttled sources every SOURCE_RATE_LIMIT_SUMMARY_INTERVAL_MS
+     */
+    public start(onSummary: (event: SyslogEvent) => void): void {
+        this.summaryStart = Date.now();
+        this.timer = setTimeout(() => {
+            const summary = this.summarize();
+            if (summary) onSummary(summary);
+            this.start(onSummary);
+        }, config.SOURCE_RATE_LIMIT_SUMMARY_INTERVAL_MS);
+    }
+
+    public stop(): void {
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+    }
+
+    public getStats(): SourceRateLimitStats {
+        return {
+            eps: config.SOURCE_RATE_LIMIT_EPS,
+            burst: this.burst(),
+            action: config.SOURCE_RATE_LIMIT_ACTION,
+            exempt_sources: this.exempt.entries.length,
+            tracked_sources: this.buckets.size,
+            ...this.counters,
+        };
+    }
+
+    /**
+     * Sources throttled since the last summary, noisiest first
+     */
+    public getThrottledSources(): ThrottledSource[] {
+        return [...this.buckets.entries()]
+            .filter(([, bucket]) => bucket.throttled > 0)
+            .sort(([, a], [, b]) => b.throttled - a.throttled)
+            .map(([ip, bucket]) => ({
+                source_ip: ip,
+                throttled: bucket.throttled,
+                last_throttled: new Date(bucket.lastThrottled).toISOString(),
+            }));
+    }
+
+    private burst(): number {
+        return config.SOURCE_RATE_LIMIT_BURST || Math.max(config.SOURCE_RATE_LIMIT_EPS, 1);
+    }
+
+    // Log and build the summary event, reset the per-source counts and forget idle sources
+    private summarize(): SyslogEvent | null {
+        const now = Date.now();
+        const throttled = this.getThrottledSources();
+        const seconds = Math.round((now - this.summaryStart) / 1000);
+        const eps = config.SOURCE_RATE_LIMIT_EPS;
+        for (const [ip, bucket] of this.buckets) {
+            bucket.throttled = 0;
+            // A bucket that has refilled completely carries no state worth keeping
+            if (eps === 0 || bucket.tokens + (now - bucket.refilledAt) / 1000 * eps >= this.burst()) this.buckets.delete(ip);
+        }
+        if (throttled.length === 0) return null;
+
+        const total = throttled.reduce((sum, source) => sum + source.throttled, 0);
+        const action = config.SOURCE_RATE_LIMIT_ACTION === 'drop' ? 'dropped' : 'tagged';
+        log.warn(
+            `🚦 RATE LIMIT: ${throttled.length} source(s) over ${eps} EPS in the last ${seconds}s, ${total} events ${action}: ` +
+            throttled.slice(0, 5).map((source) => `${source.source_ip} (${source.throttled})`).join(', ') +
+            (throttled.length > 5 ? ', ...' : '')
+        );
+
+        const event = createSyslogEvent(JSON.stringify({
+            event: 'collector.source_rate_limited',
+            severity: 'low',
+            interval_seconds: seconds,
+            eps,
+            burst: this.burst(),
+            action: config.SOURCE_RATE_LIMIT_ACTION,
+            throttled_sources: throttled.length,
+            throttled_events: total,
+            sources: throttled.slice(0, SUMMARY_TOP_SOURCES).map(({ source_ip, throttled }) => ({ source_ip, throttled })),
+        }), { address: '127.0.0.1' }, 'internal');
+        event.tags = { rate_limit_summary: 'true' };
+        return event;
+    }
+}
+
+// Singleton instance
+export const sourceRateLimit = new SourceRateLimiter();
@@ -0,0 +1,252 @@
+import os from 'node:os';
+import path from 'node:path';
+import { mkdir, readFile, stat, statfs, unlink, utimes, writeFile } from 'node:fs/promises';
+import { config } from './config.js';
+import { log } from './logger.js';
+
+const LOCK_FILE = 'collector.lock';
+const CHECK_INTERVAL_MS = 60000; // Free space check and lock heartbeat
+const LOCK_STALE_MS = 3 * CHECK_INTERVAL_MS; // A lock nobody refreshed for this long is left over from a crash
+
+export interface StateDirStats {
+    path: string | null;
+    locked: boolean;
+    free_bytes: number | null;
+    total_bytes: number | null;
+    used_percent: number | null;
+    low_space: boolean; // Below STATE_DIR_MIN_FREE_BYTES
+    last_error: string | null;
+}
+
+interface LockHolder {
+    pid: number;
+    host: string;
+    started_at: string;
+}
+
+/**
+ * State Directory (STATE_DIR)
+ *
+ * Everything the collector keeps across restarts (write-ahead log,
+ * maintenance and archive spools, dead letters, input checkpoints, cached
+ * rule set, token vault) goes under one directory, so it runs with a
+ * read-only root filesystem and a single writable volume mounted there. See
+ * withStateDir in config.ts for the layout; paths set explicitly are still
+ * honoured.
+ *
+ * On startup every persistent path in use is checked for writability, so a
+ * read-only mount fails the start with the setting to fix instead of the
+ * first checkpoint write hours later. The directory is locked
+ * (collector.lock) against a second instance sharing the volume, and its
+ * free space is checked every minute.
+ */
+export class StateDirectory {
+    private timer: NodeJS.Timeout | null = null;
+    private locked = false;
+    private space: { free: number; total: number } | null = null;
+    private lowSpace = false;
+    private lastError: string | null = null;
+
+    private get lockPath(): string {
+        return path.join(config.STATE_DIR!, LOCK_FILE);
+    }
+
+    /**
+     * Check the persistent paths and take the lock. Throws with every
+     * problem found, one per line.
+     */
+    public async prepare(): Promise<void> {
+        if (config.STATE_DIR) {
+            const problem = await checkWritable(config.STATE_DIR);
+            if (problem) throw new Error(`STATE_DIR=${config.STATE_DIR}: ${problem}`);
+            await this.lock();
+        }
+
+        const problems: string[] = [];
+        for (const [key, target, isDir] of statePaths()) {
+            const problem = await checkWritable(isDir ? target : path.dirname(target));
+            if (problem) problems.push(`${key}=${target}: ${problem}`);
+        }
+
+        // Only needed if maintenance mode is ever used
+        const spoolProblem = await checkWritable(config.MAINTENANCE_SPOOL_DIR);
+        if (spoolProblem) {
+            log.warn(`⚠️ MAINTENANCE_SPOOL_DIR=${config.MAINTENANCE_SPOOL_DIR}: ${spoolProblem}; maintenance mode will fail to start`);
+        }
+
+        if (problems.length > 0) {
+            await this.release();
+            throw new Error(problems.join('\n'));
+        }
+
+        if (config.STATE_DIR) {
+            await this.check();
+            log.info(`📁 State directory ${config.STATE_DIR}` +
+                (this.space ? ` (${formatBytes(this.space.free)} free of ${formatBytes(this.space.total)})` : ''));
+            this.timer = setInterval(() => void this.check(), CHECK_INTERVAL_MS);
+            this.timer.unref();
+        }
+    }
+
+    /**
+     * Stop monitoring and drop the lock (shutdown)
+     */
+    public async release(): Promise<void> {
+        if (this.timer) clearInterval(this.timer);
+        this.timer = null;
+        if (!this.locked) return;
+        this.locked = false;
+        await unlink(this.lockPath).catch(() => undefined);
+    }
+
+    public getStats(): StateDirStats {
+        return {
+            path: config.STATE_DIR ?? null,
+            locked: this.locked,
+            free_bytes: this.space?.free ?? null,
+            total_bytes: this.space?.total ?? null,
+            used_percent: this.space && this.space.total > 0
+                ? Math.round((1 - this.space.free / this.space.total) * 100)
+                : null,
+            low_space: this.lowSpace,
+            last_error: this.lastError,
+        };
+    }
+
+    /**
+     * Take collector.lock, replacing it if its holder is gone: a process that
+     * no longer exists on this host, this same pid (a restarted container),
+     * or a lock not refreshed within LOCK_STALE_MS (another host)
+     */
+    private async lock(): Promise<void> {
+        const holder: LockHolder = { pid: process.pid, host: os.hostname(), started_at: new Date().toISOString() };
+
+        for (let attempt = 0; attempt < 2; attempt++) {
+            try {
+                await writeFile(this.lockPath, JSON.stringify(holder) + '\n', { flag: 'wx' });
+                this.locked = true;
+                return;
+            } catch (err) {
+                if ((err as NodeJS.ErrnoException).code !== 'EEXIST') throw err;
+            }
+
+            const current = await readLock(this.lockPath);
+            if (current && !isStale(current.holder, current.mtimeMs)) {
+                throw new Error(`STATE_DIR=${config.STATE_DIR} is in use by another collector ` +
+                    `(pid ${current.holder?.pid} on ${current.holder?.host} since ${current.holder?.started_at}); ` +
+                    `give each instance its own state directory`);
+            }
+            if (current?.holder) {
+                log.warn(`⚠️ Replacing a stale state directory lock (pid ${current.holder.pid} on ${current.holder.host})`);
+            }
+            await unlink(this.lockPath).catch(() => undefined);
+        }
+        throw new Error(`STATE_DIR=${config.STATE_DIR}: cannot take ${LOCK_FILE}`);
+    }
+
+    private async check(): Promise<void> {
+        try {
+            if (this.locked) {
+                const now = new Date();
+                await utimes(this.lockPath, now, now);
+            }
+            const fsStats = await statfs(config.STATE_DIR!);
+            this.space = { free: fsStats.bavail * fsStats.bsize, total: fsStats.blocks * fsStats.bsize };
+            this.lastError = null;
+        } catch (err) {
+            if (this.lastError === null) log.warn(`⚠️ State directory check failed: ${(err as Error).message}`);
+            this.lastError = (err as Error).message;
+            return;
+        }
+
+        const low = config.STATE_DIR_MIN_FREE_BYTES > 0 && this.space.free < config.STATE_DIR_MIN_FREE_BYTES;
+        if (low && !this.lowSpace) {
+            log.warn(`⚠️ Low disk space in ${config.STATE_DIR}: ${formatBytes(this.space.free)} free ` +
+                `(STATE_DIR_MIN_FREE_BYTES ${formatBytes(config.STATE_DIR_MIN_FREE_BYTES)}); the write-ahead log and spool may stop accepting events`);
+        } else if (!low && this.lowSpace) {
+            log.info(`📁 Disk space in ${config.STATE_DIR} recovered: ${formatBytes(this.space.free)} free`);
+        }
+        this.lowSpace = low;
+    }
+}
+
+/**
+ * Persistent paths in use with the current settings: [key, path, is a directory]
+ */
+function statePaths(): Array<[string, string, boolean]> {
+    const paths: Array<[string, string | undefined, boolean]> = [
+        ['WAL_DIR', config.WAL_DIR, true],
+        ['KMSG_STATE_FILE', config.KMSG_ENABLED ? config.KMSG_STATE_FILE : undefined, false],
+        ['WINLOG_STATE_FILE', config.WINLOG_ENABLED ? config.WINLOG_STATE_FILE : undefined, false],
+        ['JOURNALD_STATE_FILE', config.JOURNALD_ENABLED ? config.JOURNALD_STATE_FILE : undefined, false],
+        ['FILE_TAIL_STATE_FILE', config.FILE_TAIL_ENABLED ? config.FILE_TAIL_STATE_FILE : undefined, false],
+        ['DISCOVERY_STATE_FILE', config.DISCOVERY_ENABLED ? config.DISCOVERY_STATE_FILE : undefined, false],
+        ['PICKUP_STATE_FILE', config.PICKUP_ENABLED ? config.PICKUP_STATE_FILE : undefined, false],
+        ['RULES_CACHE_FILE', config.CONTROL_CHANNEL_ENABLED ? config.RULES_CACHE_FILE : undefined, false],
+        ['MANAGED_CONFIG_FILE', config.CONTROL_CHANNEL_ENABLED ? config.MANAGED_CONFIG_FILE : undefined, false],
+        ['TOKEN_VAULT_FILE', config.TOKEN_VAULT_KEY ? config.TOKEN_VAULT_FILE : undefined, false],
+        ['ARCHIVE_SPOOL_DIR', config.ARCHIVE_ENABLED ? config.ARCHIVE_SPOOL_DIR : undefined, true],
+        ['DEAD_LETTER_FILE', config.DEAD_LETTER_FILE, false],
+        ['ZSTD_DICTIONARY_DIR', config.ZSTD_DICTIONARY_ENABLED ? config.ZSTD_DICTIONARY_DIR : undefined, true],
+        ['SUPPORT_BUNDLE_DIR', config.SUPPORT_BUNDLE_PUBLIC_KEY ? config.SUPPORT_BUNDLE_DIR : undefined, true],
+    ];
+    return paths.filter((entry): entry is [string, string, boolean] => entry[1] !== undefined);
+}
+
+/**
+ * Create `dir` if needed and write a probe file in it; null if that worked,
+ * else why not
+ */
+async function checkWritable(dir: string): Promise<string | null> {
+    const probe = path.join(dir, `.write-test-${process.pid}`);
+    try {
+        await mkdir(dir, { recursive: true });
+        if (!(await stat(dir)).isDirectory()) return 'not a directory';
+        await writeFile(probe, '');
+        await unlink(probe);
+        return null;
+    } catch (err) {
+        const code = (err as NodeJS.ErrnoException).code;
+        if (code === 'EROFS') return 'read-only file system (mount a writable volume there, or set STATE_DIR to one)';
+        if (code === 'EACCES' || code === 'EPERM') {
+            return `not writable by ${os.userInfo().username} (uid ${process.getuid?.() ?? '?'})`;
+        }
+        if (code === 'ENOTDIR' || code === 'EEXIST') return 'not a directory';
+        return (err as Error).message;
+    }
+}
+
+async function readLock(file: string): Promise<{ holder: LockHolder | null; mtimeMs: number } | null> {
+    try {
+        const [raw, info] = await Promise.all([readFile(file, 'utf8'), stat(file)]);
+        let holder: LockHolder | null = null;
+        try {
+            holder = JSON.parse(raw) as LockHolder;
+        } catch {
+            // Torn write; treated as stale
+        }
+        return { holder, mtimeMs: info.mtimeMs };
+    } catch {
+        return null; // Removed in the meantime
+    }
+}
+
+function isStale(holder: LockHolder | null, mtimeMs: number): boolean {
+    if (!holder || typeof holder.pid !== 'number') return true;
+    if (Date.now() - mtimeMs > LOCK_STALE_MS) return true;
+    if (holder.host !== os.hostname()) return false;
+    if (holder.pid === process.pid) return true;
+    try {
+        process.kill(holder.pid, 0);
+        return false;
+    } catch (err) {
+        return (err as NodeJS.ErrnoException).code === 'ESRCH';
+    }
+}
+
+function formatBytes(bytes: number): string {
+    if (bytes >= 1024 ** 3) return `${(bytes / 1024 ** 3).toFixed(1)} GiB`;
+    return `${Math.round(bytes / 1024 ** 2)} MiB`;
+}
+
+export const stateDir = new StateDirectory();
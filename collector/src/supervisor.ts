@@ -0,0 +1,242 @@
+import { fork, type ChildProcess } from 'node:child_process';
+import { createInterface } from 'node:readline';
+import type { Readable } from 'node:stream';
+import { log } from './logger.js';
+
+const RESTART_BASE_DELAY_MS = 1000;
+const RESTART_MAX_DELAY_MS = 60000;
+const STABLE_AFTER_MS = 60000; // An instance up this long restarts without backoff next time
+const STOP_TIMEOUT_MS = 30000; // Then SIGKILL (the collector flushes its buffer on SIGTERM)
+
+// Variables passed to every instance; anything else comes from the instance definition
+const INHERITED_ENV = ['PATH', 'HOME', 'TZ', 'LANG', 'NODE_OPTIONS', 'NODE_EXTRA_CA_CERTS'];
+
+export interface InstanceSpec {
+    config_file: string; // CONFIG_FILE of the instance
+    env?: Record<string, string>; // Extra variables (override the file, as usual)
+    autostart?: boolean; // Default true
+}
+
+export type InstanceState = 'running' | 'stopping' | 'stopped' | 'restarting';
+
+export interface InstanceStatus {
+    name: string;
+    state: InstanceState;
+    pid: number | null;
+    config_file: string;
+    restarts: number;
+    started_at: string | null;
+    last_exit: { code: number | null; signal: string | null; at: string } | null;
+    next_restart_at: string | null;
+}
+
+interface Instance {
+    name: string;
+    spec: InstanceSpec;
+    state: InstanceState;
+    child: ChildProcess | null;
+    restarts: number;
+    consecutiveFailures: number;
+    startedAt: number | null;
+    lastExit: InstanceStatus['last_exit'];
+    restartTimer: NodeJS.Timeout | null;
+    nextRestartAt: number | null;
+    stopped: Promise<void> | null;
+}
+
+/**
+ * Collector Supervisor
+ *
+ * Runs several isolated collectors on one host (an MSP appliance serving many
+ * customers): each instance is a child process with its own CONFIG_FILE, so
+ * tenants, ports, queues and WALs never mix, and one crashing or stuck
+ * instance doesn't take the others down.
+ *
+ * Instances that exit unexpectedly are restarted with exponential backoff;
+ * instances stopped through the admin API stay stopped. Child output is
+ * forwarded line by line, prefixed with the instance name.
+ */
+export class Supervisor {
+    private instances = new Map<string, Instance>();
+    private script: string;
+    private shuttingDown = false;
+
+    constructor(script: string) {
+        this.script = script;
+    }
+
+    /**
+     * Apply a set of instance definitions: start new ones (unless autostart is
+     * false), stop removed ones and restart those whose definition changed
+     */
+    public async apply(specs: Record<string, InstanceSpec>): Promise<void> {
+        const removed = [...this.instances.keys()].filter((name) => !(name in specs));
+        await Promise.all(removed.map(async (name) => {
+            await this.stop(name);
+            this.instances.delete(name);
+            log.info(`➖ [${name}] removed`);
+        }));
+
+        for (const [name, spec] of Object.entries(specs)) {
+            const existing = this.instances.get(name);
+            if (existing) {
+                if (JSON.stringify(existing.spec) === JSON.stringify(spec)) continue;
+                existing.spec = spec;
+                log.info(`🔁 [${name}] definition changed`);
+                if (existing.state !== 'stopped') await this.restart(name);
+                continue;
+            }
+
+            this.instances.set(name, {
+                name,
+                spec,
+                state: 'stopped',
+                child: null,
+                restarts: 0,
+                consecutiveFailures: 0,
+                startedAt: null,
+                lastExit: null,
+                restartTimer: null,
+                nextRestartAt: null,
+                stopped: null,
+            });
+            if (spec.autostart !== false) this.start(name);
+        }
+    }
+
+    public has(name: string): boolean {
+        return this.instances.has(name);
+    }
+
+    public start(name: string): void {
+        const instance = this.get(name);
+        if (instance.state === 'running' || instance.state === 'stopping') return;
+        this.clearRestart(instance);
+        this.spawn(instance);
+    }
+
+    /**
+     * SIGTERM (graceful shutdown: the buffer is flushed), SIGKILL after STOP_TIMEOUT_MS
+     */
+    public async stop(name: string): Promise<void> {
+        const instance = this.get(name);
+        this.clearRestart(instance);
+        if (!instance.child) {
+            instance.state = 'stopped';
+            return;
+        }
+
+        instance.state = 'stopping';
+        const child = instance.child;
+        const kill = setTimeout(() => {
+            log.warn(`⚠️ [${name}] did not stop within ${STOP_TIMEOUT_MS / 1000}s, killing it`);
+            child.kill('SIGKILL');
+        }, STOP_TIMEOUT_MS);
+        child.kill('SIGTERM');
+        await instance.stopped;
+        clearTimeout(kill);
+    }
+
+    public async restart(name: string): Promise<void> {
+        await this.stop(name);
+        this.start(name);
+    }
+
+    /**
+     * SIGHUP: the instance re-reads its CONFIG_FILE and applies live settings
+     */
+    public reload(name: string): boolean {
+        const instance = this.get(name);
+        return instance.child?.kill('SIGHUP') ?? false;
+    }
+
+    public async stopAll(): Promise<void> {
+        this.shuttingDown = true;
+        await Promise.all([...this.instances.keys()].map((name) => this.stop(name)));
+    }
+
+    public getStatus(name?: string): InstanceStatus[] {
+        return [...this.instances.values()]
+            .filter((instance) => name === undefined || instance.name === name)
+            .map((instance) => ({
+                name: instance.name,
+                state: instance.state,
+                pid: instance.child?.pid ?? null,
+                config_file: instance.spec.config_file,
+                restarts: instance.restarts,
+                started_at: instance.startedAt ? new Date(instance.startedAt).toISOString() : null,
+                last_exit: instance.lastExit,
+                next_restart_at: instance.nextRestartAt ? new Date(instance.nextRestartAt).toISOString() : null,
+            }));
+    }
+
+    private get(name: string): Instance {
+        const instance = this.instances.get(name);
+        if (!instance) throw new Error(`Unknown instance "${name}"`);
+        return instance;
+    }
+
+    private spawn(instance: Instance): void {
+        const env: Record<string, string> = {};
+        for (const key of INHERITED_ENV) {
+            if (process.env[key] !== undefined) env[key] = process.env[key]!;
+        }
+        Object.assign(env, instance.spec.env, { CONFIG_FILE: instance.spec.config_file });
+
+        const child = fork(this.script, ['run'], { env, stdio: ['ignore', 'pipe', 'pipe', 'ipc'] });
+        instance.child = child;
+        instance.state = 'running';
+        instance.startedAt = Date.now();
+        log.info(`▶️ [${instance.name}] started (pid ${child.pid}, ${instance.spec.config_file})`);
+
+        this.forwardOutput(instance.name, child.stdout!, log.info);
+        this.forwardOutput(instance.name, child.stderr!, log.error);
+
+        instance.stopped = new Promise((resolve) => {
+            child.once('exit', (code, signal) => {
+                this.handleExit(instance, code, signal);
+                resolve();
+            });
+        });
+    }
+
+    private handleExit(instance: Instance, code: number | null, signal: NodeJS.Signals | null): void {
+        const uptime = Date.now() - (instance.startedAt ?? Date.now());
+        instance.child = null;
+        instance.startedAt = null;
+        instance.lastExit = { code, signal, at: new Date().toISOString() };
+
+        if (instance.state === 'stopping' || this.shuttingDown) {
+            instance.state = 'stopped';
+            log.info(`⏹️ [${instance.name}] stopped`);
+            return;
+        }
+
+        // Unexpected exit: restart, backing off while it keeps failing
+        instance.consecutiveFailures = uptime >= STABLE_AFTER_MS ? 1 : instance.consecutiveFailures + 1;
+        const delay = Math.min(RESTART_BASE_DELAY_MS * Math.pow(2, instance.consecutiveFailures - 1), RESTART_MAX_DELAY_MS);
+        instance.state = 'restarting';
+        instance.nextRestartAt = Date.now() + delay;
+        log.error(`💥 [${instance.name}] exited (${signal ?? `code ${code}`}), restarting in ${delay / 1000}s`);
+
+        instance.restartTimer = setTimeout(() => {
+            instance.restartTimer = null;
+            instance.nextRestartAt = null;
+            instance.restarts++;
+            this.spawn(instance);
+        }, delay);
+    }
+
+    private clearRestart(instance: Instance): void {
+        if (instance.restartTimer) {
+            clearTimeout(instance.restartTimer);
+            instance.restartTimer = null;
+            instance.nextRestartAt = null;
+        }
+        if (instance.state === 'restarting') instance.state = 'stopped';
+    }
+
+    private forwardOutput(name: string, stream: Readable, write: (line: string) => void): void {
+        createInterface({ input: stream, crlfDelay: Infinity }).on('line', (line) => write(`[${name}] ${line}`));
+    }
+}
@@ -0,0 +1,202 @@
+import os from 'node:os';
+import { mkdir, readdir, readFile, rename, unlink, writeFile } from 'node:fs/promises';
+import { join } from 'node:path';
+import { gzip as gzipCallback } from 'node:zlib';
+import { promisify } from 'node:util';
+import { config } from './config.js';
+import { sanitizeConfig } from './config-diff.js';
+import { recentLogs } from './logger.js';
+import { captureCpuProfile, heapSnapshot, runtimeStats } from './profiler.js';
+import { buildInfo } from './version.js';
+import { encryptBundle, tarArchive, type ArchiveEntry, type BundleKey } from './bundle-archive.js';
+import { log } from './logger.js';
+
+const gzip = promisify(gzipCallback);
+
+const MAX_CPU_SECONDS = 60;
+const MAX_LOCAL_BUNDLES = 5; // Older bundles in SUPPORT_BUNDLE_DIR are removed
+const BUNDLE_SUFFIX = '.tar.gz.enc';
+
+// /metrics sections that make up queues.json
+const QUEUE_SECTIONS = ['events', 'buffer', 'forwarding', 'partitions', 'retry_queue', 'drain', 'maintenance', 'wal', 'dead_letter', 'state_dir'];
+
+export interface SupportBundleOptions {
+    reason: string;
+    cpuSeconds?: number; // Default SUPPORT_BUNDLE_CPU_SECONDS; 0 for no CPU profile
+    heap?: boolean; // Include a heap snapshot (large; pauses the collector)
+    key?: BundleKey; // Default SUPPORT_BUNDLE_PUBLIC_KEY
+}
+
+export interface SupportBundleStats {
+    created: number;
+    last_created_at: string | null;
+    last_reason: string | null;
+    last_file: string | null; // Last bundle written to SUPPORT_BUNDLE_DIR
+    last_error: string | null;
+}
+
+/**
+ * Support Bundles
+ *
+ * Everything support asks for when a collector misbehaves, in one encrypted
+ * file instead of fragments pasted into emails:
+ *   manifest.json      version, host, reason, contents
+ *   logs.ndjson        the last log records (whatever LOG_LEVEL kept)
+ *   metrics.json       GET /metrics
+ *   queues.json        buffer, retry queue, WAL, spool and dead-letter state
+ *   config.json        running configuration, secrets fingerprinted (as GET /config)
+ *   runtime.json       memory figures and the diagnostic report (JS and native
+ *                      stacks, libuv handles; environment and command line left out)
+ *   cpu.cpuprofile     CPU profile of the next few seconds (SUPPORT_BUNDLE_CPU_SECONDS)
+ *   heap.heapsnapshot  only on request
+ * The gzipped tar is encrypted for support's public key
+ * (SUPPORT_BUNDLE_PUBLIC_KEY, or one sent by the backend) or with a
+ * passphrase (see bundle-archive.ts).
+ *
+ * Bundles are made on request (`collector support-bundle`, POST
+ * /support-bundle), when the backend asks for one (control channel; uploaded
+ * to it) and when the leak watchdog sees a limit breached, so the evidence
+ * is kept before a restart (written to SUPPORT_BUNDLE_DIR).
+ */
+class SupportBundles {
+    private getMetrics: () => Record<string, unknown> = () => ({});
+    private creating: Promise<Buffer> | null = null;
+    private stats: SupportBundleStats = { created: 0, last_created_at: null, last_reason: null, last_file: null, last_error: null };
+
+    /** Source of metrics.json and queues.json (the health server's /metrics) */
+    public setMetricsSource(getMetrics: () => Record<string, unknown>): void {
+        this.getMetrics = getMetrics;
+    }
+
+    public getStats(): SupportBundleStats {
+        return { ...this.stats };
+    }
+
+    /**
+     * Build an encrypted bundle; one at a time
+     */
+    public async create(options: SupportBundleOptions): Promise<Buffer> {
+        if (this.creating) throw new Error('A support bundle is already being created');
+
+        const creating = (async () => {
+            const key = options.key ?? await configuredKey();
+            if (!key) throw new Error('No key to encrypt the bundle with (set SUPPORT_BUNDLE_PUBLIC_KEY, or pass a passphrase)');
+            return this.build(options, key);
+        })();
+        this.creating = creating;
+        try {
+            const bundle = await creating;
+            this.stats.created++;
+            this.stats.last_created_at = new Date().toISOString();
+            this.stats.last_reason = options.reason;
+            this.stats.last_error = null;
+            return bundle;
+        } catch (err) {
+            this.stats.last_error = (err as Error).message;
+            throw err;
+        } finally {
+            this.creating = null;
+        }
+    }
+
+    /**
+     * Create a bundle in SUPPORT_BUNDLE_DIR (keeping the last few); returns its
+     * path, or null if there is no directory or key, or it failed (logged)
+     */
+    public async writeLocal(reason: string): Promise<string | null> {
+        if (!config.SUPPORT_BUNDLE_DIR || !config.SUPPORT_BUNDLE_PUBLIC_KEY) return null;
+
+        try {
+            const bundle = await this.create({ reason });
+            await mkdir(config.SUPPORT_BUNDLE_DIR, { recursive: true });
+            const file = join(config.SUPPORT_BUNDLE_DIR, bundleFileName());
+            await writeFile(`${file}.tmp`, bundle, { mode: 0o600 });
+            await rename(`${file}.tmp`, file);
+            await this.prune();
+            this.stats.last_file = file;
+            log.info(`🧰 Support bundle written to ${file} (${reason})`);
+            return file;
+        } catch (err) {
+            log.warn(`⚠️ Cannot write support bundle: ${(err as Error).message}`);
+            return null;
+        }
+    }
+
+    private async build(options: SupportBundleOptions, key: BundleKey): Promise<Buffer> {
+        const createdAt = new Date();
+        const entries: ArchiveEntry[] = [];
+        const notes: string[] = [];
+        const json = (name: string, value: unknown) => entries.push({ name, data: Buffer.from(JSON.stringify(value, null, 2)) });
+
+        const metrics = this.getMetrics();
+        const logs = recentLogs();
+        entries.push({ name: 'logs.ndjson', data: Buffer.from(logs.length > 0 ? `${logs.join('\n')}\n` : '') });
+        json('metrics.json', metrics);
+        json('queues.json', Object.fromEntries(QUEUE_SECTIONS.filter((name) => name in metrics).map((name) => [name, metrics[name]])));
+        json('config.json', sanitizeConfig(config));
+        json('runtime.json', { ...runtimeStats(), report: diagnosticReport() });
+
+        const cpuSeconds = Math.min(options.cpuSeconds ?? config.SUPPORT_BUNDLE_CPU_SECONDS, MAX_CPU_SECONDS);
+        if (cpuSeconds > 0) {
+            try {
+                entries.push({ name: 'cpu.cpuprofile', data: Buffer.from(await captureCpuProfile(cpuSeconds)) });
+            } catch (err) {
+                notes.push(`no CPU profile: ${(err as Error).message}`);
+            }
+        }
+        if (options.heap) {
+            const chunks: Buffer[] = [];
+            for await (const chunk of heapSnapshot()) chunks.push(Buffer.from(chunk as Buffer));
+            entries.push({ name: 'heap.heapsnapshot', data: Buffer.concat(chunks) });
+        }
+
+        const build = buildInfo();
+        entries.unshift({
+            name: 'manifest.json',
+            data: Buffer.from(JSON.stringify({
+                collector: config.COLLECTOR_NAME,
+                tenant_id: config.TENANT_ID ?? null,
+                site_id: config.SITE_ID ?? null,
+                ...build,
+                hostname: os.hostname(),
+                os: `${os.type()} ${os.release()}`,
+                uptime_seconds: Math.round(process.uptime()),
+                created_at: createdAt.toISOString(),
+                reason: options.reason,
+                files: entries.map((entry) => ({ name: entry.name, bytes: entry.data.length })),
+                notes,
+            }, null, 2)),
+        });
+
+        return encryptBundle(await gzip(tarArchive(entries, createdAt)), key);
+    }
+
+    private async prune(): Promise<void> {
+        const dir = config.SUPPORT_BUNDLE_DIR!;
+        const bundles = (await readdir(dir)).filter((name) => name.endsWith(BUNDLE_SUFFIX)).sort();
+        for (const name of bundles.slice(0, Math.max(0, bundles.length - MAX_LOCAL_BUNDLES))) {
+            await unlink(join(dir, name)).catch(() => undefined);
+        }
+    }
+}
+
+export function bundleFileName(date = new Date()): string {
+    return `${config.COLLECTOR_NAME}-support-${date.toISOString().replace(/[:.]/g, '-')}${BUNDLE_SUFFIX}`;
+}
+
+async function configuredKey(): Promise<BundleKey | null> {
+    if (!config.SUPPORT_BUNDLE_PUBLIC_KEY) return null;
+    return { publicKey: await readFile(config.SUPPORT_BUNDLE_PUBLIC_KEY, 'utf8') };
+}
+
+// process.report without what may hold secrets (environment, command-line flags)
+function diagnosticReport(): unknown {
+    const report = process.report?.getReport() as Record<string, unknown> | undefined;
+    if (!report) return null;
+    delete report.environmentVariables;
+    const header = report.header as Record<string, unknown> | undefined;
+    if (header) delete header.commandLine;
+    return report;
+}
+
+export const supportBundles = new SupportBundles();
@@ -0,0 +1,133 @@
+import { execFile } from 'node:child_process';
+import { log } from './logger.js';
+
+const NOTIFY_TIMEOUT_MS = 5000;
+
+export interface SystemdNotifyStats {
+    enabled: boolean; // NOTIFY_SOCKET set and systemd-notify available
+    ready: boolean;
+    watchdog_interval_ms: number | null; // From WatchdogSec=; null without one
+    watchdog_pings: number;
+    watchdog_skipped: number; // Pings withheld because the collector looked hung
+    last_error: string | null;
+}
+
+/**
+ * systemd Notifications (Type=notify units)
+ *
+ * Tells systemd when the collector is ready (READY=1, once every listener is
+ * bound, so units ordered after it start against a working collector), when
+ * it is stopping (STOPPING=1, with the stop timeout extended to
+ * SHUTDOWN_TIMEOUT_MS so the drain isn't cut short) and, with WatchdogSec=,
+ * pings the watchdog at half its interval. Pings are withheld while the
+ * collector looks hung (the health check passed to startWatchdog fails), so
+ * systemd restarts it; a blocked event loop stops them as well.
+ *
+ * Node can't send to the notification datagram socket itself, so messages go
+ * through systemd-notify (the unit needs NotifyAccess=all). Without
+ * NOTIFY_SOCKET (containers, manual runs, other service managers) every call
+ * is a no-op.
+ */
+class SystemdNotifier {
+    private enabled = Boolean(process.env.NOTIFY_SOCKET);
+    private ready = false;
+    private watchdogMs: number | null = null;
+    private watchdogTimer: NodeJS.Timeout | null = null;
+    private watchdogPings = 0;
+    private watchdogSkipped = 0;
+    private lastError: string | null = null;
+
+    public constructor() {
+        // Only when the watchdog is meant for this process (not a parent that exec'd us)
+        const usec = Number(process.env.WATCHDOG_USEC);
+        const pid = process.env.WATCHDOG_PID;
+        if (usec > 0 && (!pid || Number(pid) === process.pid)) {
+            this.watchdogMs = Math.floor(usec / 1000);
+        }
+    }
+
+    /**
+     * Log whether notifications are sent (once, at startup)
+     */
+    public describe(): void {
+        if (!this.enabled) {
+            log.info('🔔 systemd notifications off: NOTIFY_SOCKET not set (not a Type=notify unit, e.g. in a container)');
+            return;
+        }
+        const watchdog = this.watchdogMs ? `, watchdog every ${this.watchdogMs / 2000}s` : '';
+        log.info(`🔔 systemd notifications on${watchdog}`);
+    }
+
+    /** Listeners are bound: the service is up */
+    public notifyReady(status: string): void {
+        this.ready = true;
+        this.send(['READY=1', `STATUS=${status}`]);
+    }
+
+    /** Human-readable state shown by `systemctl status` */
+    public notifyStatus(status: string): void {
+        this.send([`STATUS=${status}`]);
+    }
+
+    /** Shutdown started; extendMs covers the drain so systemd doesn't kill it */
+    public notifyStopping(extendMs: number): void {
+        this.send(['STOPPING=1', `EXTEND_TIMEOUT_USEC=${extendMs * 1000}`, 'STATUS=Draining']);
+    }
+
+    /**
+     * Ping the watchdog at half of WatchdogSec= while healthy() holds
+     */
+    public startWatchdog(healthy: () => boolean): void {
+        if (!this.enabled || !this.watchdogMs || this.watchdogTimer) return;
+
+        this.watchdogTimer = setInterval(() => {
+            if (!healthy()) {
+                this.watchdogSkipped++;
+                if (this.watchdogSkipped === 1) log.warn('⚠️ Collector looks hung, withholding systemd watchdog pings');
+                return;
+            }
+            this.watchdogSkipped = 0;
+            this.watchdogPings++;
+            this.send(['WATCHDOG=1']);
+        }, this.watchdogMs / 2);
+        this.watchdogTimer.unref();
+    }
+
+    public stopWatchdog(): void {
+        if (this.watchdogTimer) clearInterval(this.watchdogTimer);
+        this.watchdogTimer = null;
+    }
+
+    public getStats(): SystemdNotifyStats {
+        return {
+            enabled: this.enabled,
+            ready: this.ready,
+            watchdog_interval_ms: this.watchdogMs,
+            watchdog_pings: this.watchdogPings,
+            watchdog_skipped: this.watchdogSkipped,
+            last_error: this.lastError,
+        };
+    }
+
+    private send(assignments: string[]): void {
+        if (!this.enabled) return;
+
+        // --pid: systemd attributes the message to the collector, not to systemd-notify
+        execFile('systemd-notify', [`--pid=${process.pid}`, ...assignments], { timeout: NOTIFY_TIMEOUT_MS }, (err) => {
+            if (!err) {
+                this.lastError = null;
+                return;
+            }
+            if ((err as NodeJS.ErrnoException).code === 'ENOENT') {
+                log.warn('⚠️ NOTIFY_SOCKET is set but systemd-notify was not found; systemd notifications off');
+                this.enabled = false;
+                this.stopWatchdog();
+                return;
+            }
+            if (this.lastError === null) log.warn(`⚠️ systemd notification failed: ${err.message}`);
+            this.lastError = err.message;
+        });
+    }
+}
+
+export const systemdNotify = new SystemdNotifier();
@@ -1,160 +1,548 @@
 import net from 'node:net';
-import { config } from './config.js';
-import type { SyslogEvent } from './buffer.js';
-import type { MessageBuffer } from './buffer.js';
-import { metrics } from './metrics.js';
+import tls from 'node:tls';
+import { readFileSync } from 'node:fs';
+import { config, type ListenerSpec } from './config.js';
+import type { MessageBuffer, MessageContinuation } from './buffer.js';
+import { maxMessageSpan, splitMessage } from './continuation.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { isBindError, logStartError } from './bind-diagnostics.js';
+import { isWildcard } from './udp-listener.js';
+import { ListenerAcl } from './listener-acl.js';
+import { log } from './logger.js';
+import { MultilineAggregator, multilineRules } from './multiline.js';
+
+/**
+ * Per-connection activity, exposed on the health server's /connections endpoint
+ */
+export interface TcpConnectionInfo {
+    remote: string;
+    connected_at: string;
+    last_activity_at: string;
+    idle_ms: number;
+    bytes_received: number;
+    messages: number;
+    keepalives: number; // Empty / NUL / whitespace-only frames
+    framing: Framing | null; // Framing of the last message
+    transport: 'tcp' | 'tls';
+    listener?: string; // Named listener (LISTENERS)
+    client_certificate?: string; // Subject CN of a verified TLS client certificate
+}
+
+type Framing = 'octet-counting' | 'lf';
+
+type DisconnectReason = 'peer_closed' | 'idle_timeout' | 'error' | 'shutdown';
+
+interface ConnectionState {
+    remote: string;
+    address: string;
+    port: number | undefined;
+    connectedAt: number;
+    lastActivityAt: number;
+    bytes: number;
+    messages: number;
+    keepalives: number;
+    framing: Framing | null;
+    clientCertificate?: string;
+    closeReason: DisconnectReason;
+    multiline: MultilineAggregator | null; // Lines of an event not complete yet (MULTILINE_RULES)
+    discard: number; // Bytes still to skip of an octet-counted frame over the message limit
+}
+
+// Octet-counted frame header (RFC 6587 3.4.1): "<length> <message>". When
+// detecting, the message must also start with a PRI, so raw lines that begin
+// with a number are not taken for a length. A frame longer than the message
+// limit is truncated as soon as the limit is reached, not held whole.
+const OCTET_HEADER = /^([1-9]\d{0,5}) /;
+const OCTET_HEADER_DETECT = /^([1-9]\d{0,5}) </;
+const OCTET_HEADER_PARTIAL = /^[1-9]\d{0,5} ?$/;
 
 /**
  * TCP Syslog Server
  * 
  * Handles syslog messages over TCP with:
  * - Multiple concurrent connections
- * - Line-based message parsing (syslog messages are newline-delimited)
+ * - Octet-counting (RFC 6587, "123 <34>...", used by Fortinet, Cisco...) and
+ *   LF/NUL-delimited framing, detected per message or forced with TCP_FRAMING
+ * - Tolerance for device keepalives (empty lines, NULs, padding) without
+ *   creating events or dropping the connection
  * - Graceful connection handling
+ * - Optional session meta-events (TCP_SESSION_EVENTS) when senders connect and
+ *   disconnect, so flapping devices and gaps can be correlated in the backend
+ * - Multi-line events (stack traces) joined per connection for senders with
+ *   a multiline rule (MULTILINE_RULES)
+ *
+ * With transport 'tls' it is the RFC 5425 syslog-over-TLS listener (TLS_*
+ * settings): same framing and handling, TLS_CERT/TLS_KEY as server identity
+ * and, when TLS_CA is set, only senders with a client certificate issued by it.
+ *
+ * With a listener spec it is one of the named TCP listeners (LISTENERS): its
+ * own port and message size limit, and its tenant/site/source on every event.
  */
 export class TcpServer {
     private server: net.Server;
     private buffer: MessageBuffer;
-    private connections = new Set<net.Socket>();
+    private readonly transport: 'tcp' | 'tls';
+    private listener: ListenerSpec | undefined;
+    private acl: ListenerAcl;
+    private connections = new Map<net.Socket, ConnectionState>();
     private isRunning = false;
+    private starting = false;
+    private stopped = false;
 
-    constructor(buffer: MessageBuffer) {
+    constructor(buffer: MessageBuffer, transport: 'tcp' | 'tls' = 'tcp', listener?: ListenerSpec) {
         this.buffer = buffer;
-        this.server = net.createServer(this.handleConnection.bind(this));
+        this.transport = transport;
+        this.listener = listener;
+        this.acl = listener ? new ListenerAcl(listener.name, listener.allow, listener.deny)
+            : transport === 'tls' ? new ListenerAcl('tls', config.TLS_ALLOWED_SOURCES, config.TLS_DENIED_SOURCES)
+            : new ListenerAcl('tcp', config.TCP_ALLOWED_SOURCES, config.TCP_DENIED_SOURCES);
+
+        if (transport === 'tls') {
+            const ca = config.TLS_CA ? readFileSync(config.TLS_CA) : undefined;
+            this.server = tls.createServer({
+                cert: readFileSync(config.TLS_CERT!),
+                key: readFileSync(config.TLS_KEY!),
+                ca,
+                requestCert: Boolean(ca),
+                rejectUnauthorized: Boolean(ca),
+                minVersion: 'TLSv1.2',
+            }, this.handleConnection.bind(this));
+
+            // Failed handshakes (bad client certificate, plaintext sent to the TLS port)
+            this.server.on('tlsClientError', (err, socket) => {
+                if (socket.destroyed && !socket.remoteAddress) return; // Refused by the ACL below
+                log.warn(`⚠️ TLS handshake failed from ${socket.remoteAddress ?? 'unknown peer'}: ${err.message}`, { listener: this.name, remote_addr: socket.remoteAddress, error: err });
+            });
+
+            // Refused senders don't get a handshake
+            this.server.prependListener('connection', (socket: net.Socket) => {
+                if (!this.acl.admits(socket.remoteAddress)) socket.destroy();
+            });
+        } else {
+            this.server = net.createServer(this.handleConnection.bind(this));
+        }
 
+        // Listen failures are reported by start()
         this.server.on('error', (err) => {
-            console.error(`❌ TCP Server Error: ${err.message}`);
+            if (this.isRunning) log.error(`❌ ${this.label} Server Error: ${err.message}`);
         });
     }
 
+    private get label(): string {
+        const label = this.transport.toUpperCase();
+        return this.listener ? `${label} (${this.listener.name})` : label;
+    }
+
+    // "listener" field of log records: the named listener, or tcp/tls
+    private get name(): string {
+        return this.listener?.name ?? this.transport;
+    }
+
+    private get port(): number {
+        if (this.listener) return this.listener.port;
+        return this.transport === 'tls' ? config.TLS_PORT : config.TCP_PORT;
+    }
+
+    // TCP_FALLBACK_PORT applies to the default TCP listener only
+    private get fallbackPort(): number | undefined {
+        return this.transport === 'tcp' && !this.listener ? config.TCP_FALLBACK_PORT : undefined;
+    }
+
+    private get maxMessageBytes(): number {
+        return this.listener?.maxMessageBytes ?? config.MAX_MESSAGE_BYTES;
+    }
+
+    private get maxLineBytes(): number {
+        return maxMessageSpan(this.maxMessageBytes);
+    }
+
+    private get bindAddress(): string {
+        return this.transport === 'tls' ? config.TLS_BIND_ADDRESS : config.TCP_BIND_ADDRESS;
+    }
+
     /**
      * Handle a new TCP connection
      */
     private handleConnection(socket: net.Socket): void {
-        const clientAddr = `${socket.remoteAddress}:${socket.remotePort}`;
-        this.connections.add(socket);
+        // TLS senders were checked before the handshake
+        if (this.transport === 'tcp' && !this.acl.admits(socket.remoteAddress)) {
+            socket.destroy();
+            return;
+        }
 
-        if (config.LOG_LEVEL === 'debug') {
-            console.log(`🔌 TCP connection from ${clientAddr}`);
+        const clientAddr = `${socket.remoteAddress}:${socket.remotePort}`;
+        const now = Date.now();
+        const state: ConnectionState = {
+            remote: clientAddr,
+            address: socket.remoteAddress || 'unknown',
+            port: socket.remotePort,
+            connectedAt: now,
+            lastActivityAt: now,
+            bytes: 0,
+            messages: 0,
+            keepalives: 0,
+            framing: null,
+            closeReason: 'peer_closed',
+            multiline: null,
+            discard: 0,
+        };
+        if (socket instanceof tls.TLSSocket && socket.authorized) {
+            state.clientCertificate = String(socket.getPeerCertificate().subject?.CN ?? '');
         }
+        this.connections.set(socket, state);
 
-        // Buffer for incomplete messages (syslog over TCP is line-delimited)
-        let messageBuffer = '';
+        log.debug(`🔌 ${this.label} connection from ${clientAddr}`, { listener: this.name, remote_addr: clientAddr });
+        this.emitSessionEvent(state, 'connected');
 
-        socket.on('data', (data) => {
-            messageBuffer += data.toString('utf8');
+        // Bytes of incomplete frames (octet counts are in bytes, so nothing is decoded early)
+        let pending = Buffer.alloc(0);
 
-            // Process complete lines (syslog messages are newline-terminated)
-            let newlineIndex: number;
-            while ((newlineIndex = messageBuffer.indexOf('\n')) !== -1) {
-                const line = messageBuffer.slice(0, newlineIndex).trim();
-                messageBuffer = messageBuffer.slice(newlineIndex + 1);
+        socket.on('data', (data: Buffer) => {
+            state.lastActivityAt = Date.now();
+            state.bytes += data.length;
+            pending = pending.length > 0 ? Buffer.concat([pending, data]) : data;
 
-                if (line.length > 0) {
-                    this.processMessage(line, socket.remoteAddress || 'unknown');
-                }
+            try {
+                pending = this.processFrames(pending, state);
+            } catch (err) {
+                // A broken octet count leaves no way to find the next frame
+                log.warn(`⚠️ ${(err as Error).message} from ${clientAddr}, closing connection`, { listener: this.name, remote_addr: clientAddr });
+                socket.destroy();
             }
+        });
 
-            // Handle very long lines (protection against memory exhaustion)
-            if (messageBuffer.length > 65536) { // 64KB limit
-                console.warn(`⚠️ TCP message too long from ${clientAddr}, truncating`);
-                this.processMessage(messageBuffer.slice(0, 65536), socket.remoteAddress || 'unknown');
-                messageBuffer = '';
+        // A last LF-framed message needs no LF once the sender closes (octet-counted
+        // frames are complete or not)
+        socket.on('end', () => {
+            const mode = this.transport === 'tls' ? config.TLS_FRAMING : config.TCP_FRAMING;
+            if (pending.length > 0 && mode !== 'octet-counting' && state.framing !== 'octet-counting') {
+                state.framing = 'lf';
+                this.processFrame(pending, state);
             }
+            pending = Buffer.alloc(0);
         });
 
         socket.on('close', () => {
+            state.multiline?.flush();
             this.connections.delete(socket);
-            if (config.LOG_LEVEL === 'debug') {
-                console.log(`🔌 TCP connection closed from ${clientAddr}`);
-            }
+            log.debug(`🔌 ${this.label} connection closed from ${clientAddr}`, { listener: this.name, remote_addr: clientAddr });
+            this.emitSessionEvent(state, 'disconnected');
         });
 
         socket.on('error', (err) => {
             // ECONNRESET is common and not really an error
             if ((err as NodeJS.ErrnoException).code !== 'ECONNRESET') {
-                console.error(`❌ TCP socket error from ${clientAddr}: ${err.message}`);
+                log.error(`❌ ${this.label} socket error from ${clientAddr}: ${err.message}`, { listener: this.name, remote_addr: clientAddr, error: err });
             }
+            state.closeReason = 'error';
             socket.destroy();
-            this.connections.delete(socket);
         });
 
         // Set socket timeout (5 minutes of inactivity)
         socket.setTimeout(300000);
         socket.on('timeout', () => {
-            if (config.LOG_LEVEL === 'debug') {
-                console.log(`⏱️ TCP connection timeout from ${clientAddr}`);
-            }
+            log.debug(`⏱️ ${this.label} connection timeout from ${clientAddr}`, { listener: this.name, remote_addr: clientAddr });
+            state.closeReason = 'idle_timeout';
             socket.end();
         });
     }
 
+    /**
+     * Extract and process every complete frame; returns the unconsumed bytes
+     */
+    private processFrames(pending: Buffer, state: ConnectionState): Buffer {
+        const mode = this.transport === 'tls' ? config.TLS_FRAMING : config.TCP_FRAMING;
+
+        while (pending.length > 0) {
+            // Rest of a truncated frame, skipped as it arrives
+            if (state.discard > 0) {
+                const skip = Math.min(state.discard, pending.length);
+                state.discard -= skip;
+                pending = pending.subarray(skip);
+                continue;
+            }
+
+            if (mode !== 'lf') {
+                // Devices often send a LF after octet-counted frames
+                if (mode === 'octet-counting') {
+                    let skip = 0;
+                    while (skip < pending.length && (pending[skip] === 0x0a || pending[skip] === 0x0d || pending[skip] === 0x00)) skip++;
+                    pending = pending.subarray(skip);
+                    if (pending.length === 0) break;
+                }
+
+                const head = pending.toString('latin1', 0, Math.min(pending.length, 8));
+                const header = (mode === 'octet-counting' ? OCTET_HEADER : OCTET_HEADER_DETECT).exec(head);
+
+                if (header) {
+                    const length = Number(header[1]);
+                    const start = header[1]!.length + 1;
+
+                    // Protection against memory exhaustion: a frame over the limit is not held
+                    // whole but truncated, and framing resumes after its last byte
+                    if (length > this.maxLineBytes) {
+                        if (pending.length <= start + this.maxLineBytes) break;
+                        log.warn(`⚠️ ${this.label} frame of ${length} bytes from ${state.remote}, truncating`, { listener: this.name, remote_addr: state.remote });
+                        state.framing = 'octet-counting';
+                        this.processFrame(pending.subarray(start, start + this.maxLineBytes + 1), state);
+                        state.discard = start + length;
+                        continue;
+                    }
+
+                    if (pending.length < start + length) break;
+
+                    const frame = pending.subarray(start, start + length);
+                    pending = pending.subarray(start + length);
+                    state.framing = 'octet-counting';
+                    this.processFrame(frame, state);
+                    continue;
+                }
+
+                // Possibly the start of a header split across packets
+                if (OCTET_HEADER_PARTIAL.test(head) && pending.length < 8) break;
+                if (mode === 'octet-counting') {
+                    throw new Error(`Invalid octet-counting frame header "${head.replace(/[^\x20-\x7e]/g, '.')}"`);
+                }
+            }
+
+            // LF or NUL terminated; NUL padding before a LF, or a run of NULs, is a single delimiter
+            let end = 0;
+            while (end < pending.length && pending[end] !== 0x0a && pending[end] !== 0x00) end++;
+
+            if (end === pending.length) {
+                // Protection against memory exhaustion on very long lines
+                if (pending.length > this.maxLineBytes) {
+                    log.warn(`⚠️ ${this.label} message too long from ${state.remote}, truncating`, { listener: this.name, remote_addr: state.remote });
+                    state.framing = 'lf';
+                    this.processFrame(pending, state);
+                    pending = Buffer.alloc(0);
+                }
+                break;
+            }
+
+            let next = end;
+            while (next < pending.length && pending[next] === 0x00) next++;
+            if (next < pending.length && pending[next] === 0x0a) next++;
+
+            const frame = pending.subarray(0, end);
+            pending = pending.subarray(next);
+            state.framing = 'lf';
+            this.processFrame(frame, state);
+        }
+
+        return pending;
+    }
+
+    private processFrame(frame: Buffer, state: ConnectionState): void {
+        // One byte over the limit, so a message that doesn't fit is marked truncated
+        const line = frame.subarray(0, this.maxLineBytes + 1).toString('utf8');
+        if (line.trim().length > 0) {
+            state.messages++;
+            this.aggregate(line, state);
+        } else {
+            // Keepalive frame: counts as activity, never as an event or error
+            state.keepalives++;
+        }
+    }
+
+    /**
+     * Send a line, or hold it for the sender's multiline rule (leading
+     * whitespace, which continuation lines often start with, is kept then)
+     */
+    private aggregate(line: string, state: ConnectionState): void {
+        const rule = multilineRules.forAddress(state.address);
+        if (state.multiline && state.multiline.rule !== rule) {
+            state.multiline.flush();
+            state.multiline = null;
+        }
+        if (!rule) {
+            this.send(line.trim(), state);
+            return;
+        }
+        state.multiline ??= new MultilineAggregator(rule, this.maxLineBytes, (event) => this.send(event, state));
+        state.multiline.push(line.trimEnd());
+    }
+
+    private send(message: string, state: ConnectionState): void {
+        for (const part of splitMessage(message, this.maxMessageBytes)) {
+            this.processMessage(part.text, state, part.continuation);
+        }
+    }
+
     /**
      * Process a single syslog message
      */
-    private processMessage(rawMessage: string, sourceIp: string): void {
-        const event: SyslogEvent = {
-            raw_message: rawMessage,
-            received_at: new Date().toISOString(),
-            source_ip: sourceIp,
+    private processMessage(rawMessage: string, state: ConnectionState, continuation?: MessageContinuation): void {
+        const event = createSyslogEvent(
+            rawMessage,
+            { address: state.address, port: state.port },
+            this.transport,
+        );
+        if (continuation) event.continuation = continuation;
+        ingestEvent(this.buffer, event, { listener: this.listener });
+    }
+
+    /**
+     * Emit a session meta-event (connected / disconnected with totals)
+     */
+    private emitSessionEvent(state: ConnectionState, action: 'connected' | 'disconnected'): void {
+        if (!config.TCP_SESSION_EVENTS) return;
+
+        const durationMs = Date.now() - state.connectedAt;
+        const summary = action === 'connected'
+            ? `${this.label} session connected from ${state.remote}`
+            : `${this.label} session disconnected from ${state.remote} (${state.closeReason}) after ${durationMs}ms: ` +
+              `${state.messages} messages, ${state.bytes} bytes`;
+
+        const event = createSyslogEvent(`centinela-collector: ${summary}`, { address: state.address, port: state.port }, this.transport);
+        event.meta = {
+            type: 'tcp_session',
+            action,
+            connected_at: new Date(state.connectedAt).toISOString(),
+            ...(action === 'disconnected' && {
+                reason: state.closeReason,
+                duration_ms: durationMs,
+                bytes: state.bytes,
+                messages: state.messages,
+                keepalives: state.keepalives,
+            }),
         };
+        ingestEvent(this.buffer, event, { listener: this.listener });
+    }
 
-        metrics.incrementReceived();
 
-        const added = this.buffer.push(event);
-        if (!added) {
-            metrics.incrementDropped();
-            if (this.buffer.dropped % 100 === 0) {
-                console.warn(`⚠️ Buffer full! Dropped ${this.buffer.dropped} events so far.`);
-            }
+    /**
+     * Start the TCP server, on the fallback port if the configured one can't be used
+     */
+    public async start(): Promise<void> {
+        this.starting = true;
+        try {
+            await this.listen(this.port);
+        } catch (err) {
+            const fallbackPort = this.fallbackPort;
+            if (!isBindError(err) || !fallbackPort || err.port === fallbackPort) throw err;
+
+            logStartError(`${this.label} server`, err);
+            log.warn(`↪️ Trying fallback port ${fallbackPort} instead`);
+            await this.listen(fallbackPort);
+        } finally {
+            this.starting = false;
         }
     }
 
     /**
-     * Start the TCP server
+     * After a network change: start again if listening failed (e.g. the bind
+     * address didn't exist yet) and the address is now available
      */
-    public start(): Promise<void> {
+    public revalidate(localAddresses: Set<string>): void {
+        if (this.isRunning || this.starting || this.stopped) return;
+        if (isWildcard(this.bindAddress) || localAddresses.has(this.bindAddress)) {
+            log.info(`🌐 ${this.label}: ${this.bindAddress} is available, listening again`);
+            this.start().catch((err) => logStartError(`${this.label} server`, err));
+        }
+    }
+
+    private listen(port: number): Promise<void> {
         return new Promise((resolve, reject) => {
-            this.server.listen(config.TCP_PORT, config.TCP_BIND_ADDRESS, () => {
+            // Both removed whichever fires, so a retry on another port starts clean
+            const onListening = () => {
+                this.server.off('error', onError);
                 this.isRunning = true;
-                console.log(`👂 TCP Syslog listening on tcp://${config.TCP_BIND_ADDRESS}:${config.TCP_PORT}`);
+                log.info(`👂 ${this.label} Syslog listening on ${this.transport}://${this.bindAddress}:${port}`);
                 resolve();
-            });
-
-            this.server.once('error', (err) => {
+            };
+            const onError = (err: Error) => {
+                this.server.off('listening', onListening);
                 reject(err);
-            });
+            };
+
+            this.server.once('listening', onListening);
+            this.server.once('error', onError);
+            this.server.listen(port, this.bindAddress);
         });
     }
 
     /**
-     * Stop the TCP server gracefully
+     * New definition of this named listener, same port: tenant, site, tags
+     * and ACL apply to the next events and connections, without rebinding
      */
-    public stop(): Promise<void> {
+    public update(listener: ListenerSpec): void {
+        this.acl.dispose();
+        this.listener = listener;
+        this.acl = new ListenerAcl(listener.name, listener.allow, listener.deny);
+    }
+
+    /**
+     * Stop the TCP server gracefully. With `graceMs`, connections are
+     * half-closed and get that long to deliver what the senders already
+     * wrote (a sender closing its side ends it sooner); without, they are
+     * closed at once.
+     */
+    public stop(graceMs = 0): Promise<void> {
+        this.stopped = true;
+        if (this.listener) this.acl.dispose();
         return new Promise((resolve) => {
             if (!this.isRunning) {
                 resolve();
                 return;
             }
 
-            // Close all active connections
-            for (const socket of this.connections) {
-                socket.destroy();
+            // Waiting for 'close' so disconnect events are emitted
+            const closed: Promise<unknown>[] = [];
+            for (const [socket, state] of this.connections) {
+                state.closeReason = 'shutdown';
+                closed.push(new Promise((done) => socket.once('close', done)));
+                if (graceMs > 0) socket.end();
+                else socket.destroy();
             }
-            this.connections.clear();
+            const timer = graceMs > 0 && this.connections.size > 0
+                ? setTimeout(() => this.connections.forEach((_, socket) => socket.destroy()), graceMs)
+                : null;
 
             this.server.close(() => {
-                this.isRunning = false;
-                console.log('   TCP server stopped.');
-                resolve();
+                void Promise.all(closed).then(() => {
+                    if (timer) clearTimeout(timer);
+                    this.isRunning = false;
+                    log.info(`   ${this.label} server stopped.`);
+                    resolve();
+                });
             });
         });
     }
 
+    /**
+     * Port actually listened on (null until started)
+     */
+    public get listeningPort(): number | null {
+        const address = this.server.address();
+        return address && typeof address === 'object' ? address.port : null;
+    }
+
     /**
      * Get the number of active connections
      */
     public get connectionCount(): number {
         return this.connections.size;
     }
+
+    /**
+     * Activity details for every open connection
+     */
+    public getConnectionDetails(): TcpConnectionInfo[] {
+        const now = Date.now();
+        return [...this.connections.values()].map((state) => ({
+            remote: state.remote,
+            connected_at: new Date(state.connectedAt).toISOString(),
+            last_activity_at: new Date(state.lastActivityAt).toISOString(),
+            idle_ms: now - state.lastActivityAt,
+            bytes_received: state.bytes,
+            messages: state.messages,
+            keepalives: state.keepalives,
+            framing: state.framing,
+            transport: this.transport,
+            ...(this.listener && { listener: this.listener.name }),
+            ...(state.clientCertificate && { client_certificate: state.clientCertificate }),
+        }));
+    }
 }
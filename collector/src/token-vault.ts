@@ -0,0 +1,188 @@
+import path from 'node:path';
+import { appendFile, mkdir, readFile } from 'node:fs/promises';
+import { createCipheriv, createDecipheriv, createHmac, hkdfSync, randomBytes } from 'node:crypto';
+import { config } from './config.js';
+import { log } from './logger.js';
+
+const TOKEN_PATTERN = /^tok_[0-9a-f]{24}$/;
+
+export interface TokenVaultStats {
+    enabled: boolean;
+    tokens: number; // Originals stored in the vault
+    pending_writes: number;
+    write_errors: number;
+    last_error: string | null;
+}
+
+interface VaultRecord {
+    token: string;
+    iv: string;
+    data: string; // AES-256-GCM ciphertext of the original value
+    tag: string;
+    created_at: string;
+}
+
+/**
+ * Token Vault
+ *
+ * Redaction rules with `tokenize: true` replace each match with a token
+ * (tok_ + 24 hex chars) instead of a fixed text, and the original value is
+ * stored here, encrypted with TOKEN_VAULT_KEY, in the append-only
+ * TOKEN_VAULT_FILE. Only the token leaves the collector; an investigation
+ * that needs the original recovers it on-prem with `collector vault reveal`,
+ * which requires a reason and an approver and is written to an audit log.
+ *
+ * Tokens are keyed hashes of the value, so the same value always gets the
+ * same token and events can still be correlated in the SaaS.
+ */
+export class TokenVault {
+    private tokens = new Set<string>();
+    private queue: Array<{ token: string; line: string }> = [];
+    private writing: Promise<void> | null = null;
+    private writeErrors = 0;
+    private lastError: string | null = null;
+    private keys: { mac: Buffer; enc: Buffer } | null = null;
+
+    public get enabled(): boolean {
+        return Boolean(config.TOKEN_VAULT_FILE && config.TOKEN_VAULT_KEY);
+    }
+
+    private get file(): string {
+        return config.TOKEN_VAULT_FILE!;
+    }
+
+    /**
+     * Load the tokens already in the vault, so their originals aren't stored twice
+     */
+    public async open(): Promise<void> {
+        if (!this.enabled) return;
+
+        await mkdir(path.dirname(this.file), { recursive: true });
+        for (const record of await this.readRecords()) {
+            this.tokens.add(record.token);
+        }
+        log.info(`🔐 Token vault ${this.file} (${this.tokens.size} tokens)`);
+    }
+
+    /**
+     * Token for a value; its original is queued for the vault the first time it is seen
+     */
+    public tokenize(value: string): string {
+        const { mac, enc } = this.deriveKeys();
+        const token = `tok_${createHmac('sha256', mac).update(value).digest('hex').slice(0, 24)}`;
+        if (this.tokens.has(token)) return token;
+
+        const iv = randomBytes(12);
+        const cipher = createCipheriv('aes-256-gcm', enc, iv);
+        cipher.setAAD(Buffer.from(token)); // A record can't be moved to another token
+        const data = Buffer.concat([cipher.update(value, 'utf8'), cipher.final()]);
+        const record: VaultRecord = {
+            token,
+            iv: iv.toString('base64'),
+            data: data.toString('base64'),
+            tag: cipher.getAuthTag().toString('base64'),
+            created_at: new Date().toISOString(),
+        };
+
+        this.tokens.add(token);
+        this.queue.push({ token, line: `${JSON.stringify(record)}\n` });
+        this.writing ??= this.drain();
+        return token;
+    }
+
+    /**
+     * Wait until every queued original is on disk
+     */
+    public async flush(): Promise<void> {
+        while (this.writing) await this.writing;
+    }
+
+    /**
+     * Decrypt the originals of the given tokens. Tokens not in the vault are
+     * missing from the result.
+     */
+    public async reveal(tokens: string[]): Promise<Map<string, string>> {
+        const invalid = tokens.find((token) => !TOKEN_PATTERN.test(token));
+        if (invalid) throw new Error(`Not a vault token: ${invalid}`);
+
+        const { enc } = this.deriveKeys();
+        const wanted = new Set(tokens);
+        const originals = new Map<string, string>();
+
+        for (const record of await this.readRecords()) {
+            if (!wanted.has(record.token) || originals.has(record.token)) continue;
+            try {
+                const decipher = createDecipheriv('aes-256-gcm', enc, Buffer.from(record.iv, 'base64'));
+                decipher.setAAD(Buffer.from(record.token));
+                decipher.setAuthTag(Buffer.from(record.tag, 'base64'));
+                const value = Buffer.concat([decipher.update(Buffer.from(record.data, 'base64')), decipher.final()]);
+                originals.set(record.token, value.toString('utf8'));
+            } catch {
+                throw new Error(`Cannot decrypt ${record.token}: wrong TOKEN_VAULT_KEY or corrupted vault`);
+            }
+        }
+        return originals;
+    }
+
+    public getStats(): TokenVaultStats {
+        return {
+            enabled: this.enabled,
+            tokens: this.tokens.size,
+            pending_writes: this.queue.length,
+            write_errors: this.writeErrors,
+            last_error: this.lastError,
+        };
+    }
+
+    private async drain(): Promise<void> {
+        while (this.queue.length > 0) {
+            const batch = this.queue.splice(0);
+            try {
+                await appendFile(this.file, batch.map((entry) => entry.line).join(''), { mode: 0o600 });
+            } catch (err) {
+                // Forget the tokens so their originals are stored the next time they are seen
+                batch.forEach((entry) => this.tokens.delete(entry.token));
+                this.writeErrors += batch.length;
+                if (this.lastError !== (err as Error).message) {
+                    log.error(`❌ Cannot write token vault: ${(err as Error).message}`);
+                }
+                this.lastError = (err as Error).message;
+            }
+        }
+        this.writing = null;
+    }
+
+    private async readRecords(): Promise<VaultRecord[]> {
+        let content: string;
+        try {
+            content = await readFile(this.file, 'utf8');
+        } catch (err) {
+            if ((err as NodeJS.ErrnoException).code === 'ENOENT') return [];
+            throw err;
+        }
+
+        const records: VaultRecord[] = [];
+        for (const line of content.split('\n')) {
+            if (!line) continue;
+            try {
+                records.push(JSON.parse(line) as VaultRecord);
+            } catch {
+                // Torn write from a crash: skip the line
+            }
+        }
+        return records;
+    }
+
+    private deriveKeys(): { mac: Buffer; enc: Buffer } {
+        if (!this.keys) {
+            const secret = config.TOKEN_VAULT_KEY ?? '';
+            this.keys = {
+                mac: Buffer.from(hkdfSync('sha256', secret, 'centinela-token-vault', 'token', 32)),
+                enc: Buffer.from(hkdfSync('sha256', secret, 'centinela-token-vault', 'encryption', 32)),
+            };
+        }
+        return this.keys;
+    }
+}
+
+export const tokenVault = new TokenVault();
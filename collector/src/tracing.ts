@@ -0,0 +1,306 @@
+import { randomBytes } from 'node:crypto';
+import { performance } from 'node:perf_hooks';
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { COLLECTOR_VERSION } from './version.js';
+import { log } from './logger.js';
+import type { EventContext } from './event-context.js';
+
+const EXPORT_INTERVAL_MS = 5000;
+const EXPORT_BATCH_SIZE = 512; // Spans per OTLP request; a full batch is exported right away
+const MAX_PENDING_SPANS = 8192; // Beyond this (exporter down or slow), new spans are dropped
+
+// OTLP span kinds and status codes
+const SPAN_KIND_INTERNAL = 1;
+const SPAN_KIND_SERVER = 2;
+const SPAN_KIND_CLIENT = 3;
+const STATUS_OK = 1;
+const STATUS_ERROR = 2;
+
+export interface TracingStats {
+    exporter: 'none' | 'otlp';
+    sample_ratio: number;
+    sampled: number; // Events traced (that reached the send buffer)
+    exported: number; // Spans
+    dropped: number; // Spans lost (queue full or export failed)
+    export_errors: number;
+}
+
+export interface ForwardSpan {
+    headers: Record<string, string>; // traceparent of the request
+    end(result: { status?: number; error?: string; rejected?: ReadonlySet<number> }): void;
+}
+
+interface EventTrace {
+    traceId: string;
+    rootSpanId: string;
+    receivedAt: bigint;
+    queuedAt?: bigint;
+    attempts: number;
+}
+
+interface OtlpAttribute {
+    key: string;
+    value: { stringValue: string } | { intValue: string };
+}
+
+interface OtlpSpan {
+    traceId: string;
+    spanId: string;
+    parentSpanId?: string;
+    name: string;
+    kind: number;
+    startTimeUnixNano: string;
+    endTimeUnixNano: string;
+    attributes: OtlpAttribute[];
+    links?: Array<{ traceId: string; spanId: string }>;
+    status: { code: number; message?: string };
+}
+
+/** Wall-clock time in nanoseconds, with sub-millisecond precision */
+function nowNanos(): bigint {
+    return BigInt(Math.round((performance.timeOrigin + performance.now()) * 1000)) * 1000n;
+}
+
+function attributes(values: Record<string, string | number | undefined>): OtlpAttribute[] {
+    return Object.entries(values)
+        .filter(([, value]) => value !== undefined)
+        .map(([key, value]) => ({
+            key,
+            value: typeof value === 'number' ? { intValue: String(value) } : { stringValue: value! },
+        }));
+}
+
+/**
+ * Pipeline Tracing
+ *
+ * Follows a sample of events (OTEL_TRACES_SAMPLER_ARG) through the
+ * collector and exports one trace per event over OTLP/HTTP:
+ *
+ *   collector.ingest      receive -> accepted by the backend (root)
+ *   ├─ collector.parse    source policy, rules, anonymization, header parsing
+ *   ├─ collector.queue    waiting in the send buffer
+ *   └─ collector.forward  the HTTP request, once per attempt
+ *
+ * The forward request carries a W3C traceparent header pointing at the
+ * forward span, so the backend's spans join the trace. A batch has a single
+ * header: with several traced events in it, the header belongs to the first,
+ * and the others' forward spans link to it.
+ *
+ * Trace state lives beside the event (WeakMap), not in it: nothing is added
+ * to what's buffered, written to the WAL or sent. Events read back from disk
+ * (spilled, WAL replays after a restart) therefore lose their trace; dead-lettered events end their
+ * trace with an error. Trace IDs are the events' own (see event-context.ts),
+ * so a trace is found with the trace_id of a log record or dead letter. Exporting is best effort: spans that can't be sent are
+ * dropped and counted, never retried.
+ */
+class PipelineTracer {
+    private traces = new WeakMap<SyslogEvent, EventTrace>();
+    private pending: OtlpSpan[] = [];
+    private timer: NodeJS.Timeout | null = null;
+    private exporting = false;
+    private failing = false;
+    private counters = { sampled: 0, exported: 0, dropped: 0, exportErrors: 0 };
+
+    private get enabled(): boolean {
+        return config.OTEL_TRACES_EXPORTER === 'otlp';
+    }
+
+    /**
+     * Receive: decide whether the event is traced (call first thing). The
+     * trace takes the event's own trace ID, the one in the collector's logs.
+     */
+    public begin(event: SyslogEvent, context: EventContext): void {
+        if (!this.enabled || Math.random() >= config.OTEL_TRACES_SAMPLER_ARG) return;
+
+        this.traces.set(event, {
+            traceId: context.traceId,
+            rootSpanId: randomBytes(8).toString('hex'),
+            receivedAt: nowNanos(),
+            attempts: 0,
+        });
+    }
+
+    /**
+     * End of processing: the event is in the send buffer
+     */
+    public queued(event: SyslogEvent): void {
+        const trace = this.traces.get(event);
+        if (!trace) return;
+
+        trace.queuedAt = nowNanos();
+        // Counted from here: events dropped by policy or rules are simply forgotten
+        this.counters.sampled++;
+        this.record(trace, 'collector.parse', SPAN_KIND_INTERNAL, trace.receivedAt, trace.queuedAt, {
+            'centinela.syslog.format': event.syslog?.format ?? 'raw',
+            'centinela.source_id': event.source_id,
+        });
+    }
+
+    /**
+     * Events leave the collector in one request. Returns null when none of
+     * them is traced (no header to send).
+     */
+    public forward(events: SyslogEvent[]): ForwardSpan | null {
+        const traced = events
+            .map((event, index) => ({ event, index, trace: this.traces.get(event) }))
+            .filter((item): item is { event: SyslogEvent; index: number; trace: EventTrace } => item.trace !== undefined);
+        if (traced.length === 0) return null;
+
+        const start = nowNanos();
+        const spanIds = traced.map(() => randomBytes(8).toString('hex'));
+        const head = { traceId: traced[0]!.trace.traceId, spanId: spanIds[0]! };
+
+        for (const { trace } of traced) {
+            trace.attempts++;
+            // Waiting in the buffer ends at the first attempt; retries show as more forward spans
+            if (trace.attempts === 1 && trace.queuedAt) {
+                this.record(trace, 'collector.queue', SPAN_KIND_INTERNAL, trace.queuedAt, start, {});
+            }
+        }
+
+        return {
+            headers: { traceparent: `00-${head.traceId}-${head.spanId}-01` },
+            end: ({ status, error, rejected }) => {
+                const end = nowNanos();
+                traced.forEach(({ event, index, trace }, position) => {
+                    const failure = error ?? (rejected?.has(index) ? 'rejected by the backend' : undefined);
+                    this.record(trace, 'collector.forward', SPAN_KIND_CLIENT, start, end, {
+                        'http.response.status_code': status,
+                        'centinela.batch_size': events.length,
+                        'centinela.attempt': trace.attempts,
+                    }, {
+                        spanId: spanIds[position]!,
+                        links: position > 0 ? [head] : undefined,
+                        error: failure,
+                    });
+                    if (!failure) this.finish(event, trace, end);
+                });
+            },
+        };
+    }
+
+    /**
+     * The event will not be sent again (dead-lettered): end its trace with an error
+     */
+    public abandon(event: SyslogEvent, reason: string): void {
+        const trace = this.traces.get(event);
+        if (trace) this.finish(event, trace, nowNanos(), reason);
+    }
+
+    public start(): void {
+        if (!this.enabled || this.timer) return;
+        this.timer = setInterval(() => void this.export(), EXPORT_INTERVAL_MS);
+        this.timer.unref();
+    }
+
+    /**
+     * Stop the export timer and send what's pending (shutdown)
+     */
+    public async stop(): Promise<void> {
+        if (this.timer) {
+            clearInterval(this.timer);
+            this.timer = null;
+        }
+        while (this.pending.length > 0 && !this.exporting) {
+            if (!(await this.export())) break;
+        }
+    }
+
+    public getStats(): TracingStats {
+        return {
+            exporter: config.OTEL_TRACES_EXPORTER,
+            sample_ratio: config.OTEL_TRACES_SAMPLER_ARG,
+            sampled: this.counters.sampled,
+            exported: this.counters.exported,
+            dropped: this.counters.dropped,
+            export_errors: this.counters.exportErrors,
+        };
+    }
+
+    private finish(event: SyslogEvent, trace: EventTrace, end: bigint, error?: string): void {
+        this.traces.delete(event);
+        this.record(trace, 'collector.ingest', SPAN_KIND_SERVER, trace.receivedAt, end, {
+            'centinela.event_id': event.event_id,
+            'client.address': event.source_ip,
+            'network.transport': event.transport,
+            'centinela.tenant_id': event.tenant_id,
+            'centinela.attempts': trace.attempts,
+        }, { spanId: trace.rootSpanId, root: true, error });
+    }
+
+    private record(
+        trace: EventTrace,
+        name: string,
+        kind: number,
+        start: bigint,
+        end: bigint,
+        values: Record<string, string | number | undefined>,
+        options: { spanId?: string; root?: boolean; links?: Array<{ traceId: string; spanId: string }>; error?: string } = {},
+    ): void {
+        if (this.pending.length >= MAX_PENDING_SPANS) {
+            this.counters.dropped++;
+            return;
+        }
+
+        this.pending.push({
+            traceId: trace.traceId,
+            spanId: options.spanId ?? randomBytes(8).toString('hex'),
+            parentSpanId: options.root ? undefined : trace.rootSpanId,
+            name,
+            kind,
+            startTimeUnixNano: start.toString(),
+            endTimeUnixNano: end.toString(),
+            attributes: attributes(values),
+            links: options.links,
+            status: options.error ? { code: STATUS_ERROR, message: options.error } : { code: STATUS_OK },
+        });
+        if (this.pending.length >= EXPORT_BATCH_SIZE && !this.exporting) void this.export();
+    }
+
+    /**
+     * Send one batch of pending spans. Returns false if the export failed.
+     */
+    private async export(): Promise<boolean> {
+        if (this.exporting || this.pending.length === 0) return true;
+        this.exporting = true;
+        const spans = this.pending.splice(0, EXPORT_BATCH_SIZE);
+
+        try {
+            const response = await fetch(`${config.OTEL_EXPORTER_OTLP_ENDPOINT.replace(/\/+$/, '')}/v1/traces`, {
+                method: 'POST',
+                headers: { ...config.OTEL_EXPORTER_OTLP_HEADERS, 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    resourceSpans: [{
+                        resource: {
+                            attributes: attributes({
+                                'service.name': config.OTEL_SERVICE_NAME,
+                                'service.version': COLLECTOR_VERSION,
+                                'service.instance.id': config.COLLECTOR_NAME,
+                            }),
+                        },
+                        scopeSpans: [{ scope: { name: 'centinela-collector', version: COLLECTOR_VERSION }, spans }],
+                    }],
+                }),
+                signal: AbortSignal.timeout(10000),
+            });
+            if (!response.ok) throw new Error(`HTTP ${response.status}`);
+
+            this.counters.exported += spans.length;
+            if (this.failing) log.info('🔭 Trace export recovered');
+            this.failing = false;
+            return true;
+        } catch (err) {
+            this.counters.exportErrors++;
+            this.counters.dropped += spans.length;
+            // Once per outage, not per batch
+            if (!this.failing) log.warn(`⚠️ Trace export to ${config.OTEL_EXPORTER_OTLP_ENDPOINT} failed, dropping spans: ${(err as Error).message}`);
+            this.failing = true;
+            return false;
+        } finally {
+            this.exporting = false;
+        }
+    }
+}
+
+export const tracer = new PipelineTracer();
@@ -1,13 +1,95 @@
+import dns from 'node:dns/promises';
 import { config } from './config.js';
-import type { SyslogEvent } from './buffer.js';
+import { groupByPartition, type SyslogEvent } from './buffer.js';
 import { metrics } from './metrics.js';
 import { RetryQueue } from './retry-queue.js';
+import { EndpointSelector, type EndpointStats } from './endpoints.js';
+import { RateGovernor, type RateLimitStats } from './rate-governor.js';
+import { CircuitBreaker, CircuitOpenError, type CircuitBreakerStats } from './circuit-breaker.js';
+import { headerValue, identityHeaders, partitionHeaders } from './identity.js';
+import { wal } from './wal.js';
+import { maintenance } from './maintenance.js';
+import { buildIngestPayload, getSerializer } from './serializers.js';
+import { backendFetch } from './http-client.js';
+import { apiKey } from './api-key.js';
+import { log } from './logger.js';
+import { tracer } from './tracing.js';
+import { eventLogFields } from './event-context.js';
+import { BatchCompressor, type CompressionStats, type EncodedBody } from './compression.js';
+import { KafkaOutput, type KafkaOutputStats } from './kafka-output.js';
+import { GRPC_RESOURCE_EXHAUSTED, GrpcError, GrpcOutput, type GrpcOutputStats } from './grpc-output.js';
+
+// Individual sends refused for the event itself (malformed, too large): dead-lettered, not retried
+const PERMANENT_STATUSES = new Set([400, 413, 422]);
+
+// Bulk requests refused for their format or encoding: a configuration
+// problem (BATCH_FORMAT, BATCH_COMPRESSION) that individual sends would only
+// hide at one request per event. Too large (413) is split instead.
+const BULK_CONFIG_STATUSES = new Set([400, 415]);
+const BULK_REFUSED_LOG_INTERVAL_MS = 60000;
 
 interface SendResult {
   success: boolean;
   event: SyslogEvent;
   attempts: number;
   error?: string;
+  status?: number;
+  held?: boolean; // Not sent: the circuit is open
+}
+
+/**
+ * An event the backend refused within an otherwise accepted batch
+ */
+export interface BatchRejection {
+  index: number; // Position in the request's events array
+  event_id?: string;
+  reason: string;
+  retryable?: boolean; // Transient (e.g. enqueue failure) rather than invalid
+}
+
+/**
+ * Backlog of one batch partition (tenant/site)
+ */
+export interface PartitionStats {
+  buffered: number;
+  retrying: number;
+  dlq: number;
+}
+
+/**
+ * Non-2xx response from the backend
+ */
+export class HttpError extends Error {
+  public readonly status: number;
+
+  constructor(status: number, body: string) {
+    super(`HTTP ${status}: ${body}`);
+    this.status = status;
+  }
+}
+
+/**
+ * Read the rejection manifest of a bulk response, ignoring malformed entries.
+ * A response without one means every event was accepted.
+ */
+function parseRejections(value: unknown, batchSize: number): BatchRejection[] {
+  if (!Array.isArray(value)) return [];
+
+  const seen = new Set<number>();
+  const rejected: BatchRejection[] = [];
+  for (const item of value) {
+    const index = (item as BatchRejection | null)?.index;
+    if (!Number.isInteger(index) || index < 0 || index >= batchSize || seen.has(index)) continue;
+
+    seen.add(index);
+    rejected.push({
+      index,
+      event_id: item.event_id,
+      reason: typeof item.reason === 'string' ? item.reason : 'unspecified',
+      retryable: item.retryable === true,
+    });
+  }
+  return rejected;
 }
 
 /**
@@ -17,135 +99,437 @@ interface SendResult {
  * - Automatic retries with exponential backoff
  * - Dead Letter Queue for permanently failed events
  * - Concurrent batch sending
+ * - Pacing to the backend's advertised rate limit (429 / X-RateLimit-*)
+ * - A circuit breaker: during an outage events go to the disk spool instead
+ *   of through the retry ladder (see CircuitBreaker)
+ * - gzip or zstd bulk requests, zstd with per-tenant dictionaries (see BatchCompressor)
+ *
+ * With OUTPUT_TYPE=grpc, batches are streamed to the backend over HTTP/2
+ * (see GrpcOutput), and with OUTPUT_TYPE=kafka published to Kafka, instead of
+ * the bulk endpoint; retries, DLQ and WAL work the same way.
  */
 export class HttpTransport {
   private headers: Record<string, string>;
   private retryQueue: RetryQueue;
+  private endpoints: EndpointSelector;
+  private governor: RateGovernor;
+  private breaker: CircuitBreaker;
+  private kafka: KafkaOutput | null;
+  private grpc: GrpcOutput | null;
+  private compressor: BatchCompressor;
   private isProcessingRetries = false;
+  private lastBulkRefusedLog = 0;
 
   constructor() {
     this.headers = {
       'Content-Type': 'application/json',
-      'Authorization': `Bearer ${config.CENTINELA_API_KEY}`,
-      'User-Agent': `CentinelaCollector/0.2.0 (${config.COLLECTOR_NAME})`
+      ...identityHeaders(),
     };
     this.retryQueue = new RetryQueue();
+    this.endpoints = new EndpointSelector();
+    this.governor = new RateGovernor();
+    this.breaker = new CircuitBreaker();
+    this.kafka = config.OUTPUT_TYPE === 'kafka' ? new KafkaOutput() : null;
+    this.grpc = config.OUTPUT_TYPE === 'grpc' ? new GrpcOutput() : null;
+    this.compressor = new BatchCompressor((tenant, id, dictionary) => this.uploadDictionary(tenant, id, dictionary));
+    this.compressor.start().catch((err: Error) => log.warn(`⚠️ Cannot load zstd dictionaries: ${err.message}`));
   }
 
   /**
-   * Sends a batch of events to the API using bulk endpoint.
-   * Falls back to individual sends if bulk fails.
-   * Failed events are automatically queued for retry.
+   * Sends a batch of events to the API using bulk endpoint (one request per batch).
+   * If the backend is unreachable or failing, the batch is queued for retry as a
+   * whole, and so is a batch refused for its format or encoding (400, 415: see
+   * refuseBulk). A batch too large for the backend (413) is sent again in two
+   * halves, down to single events; an event too large on its own is
+   * dead-lettered. Only if it refuses the request otherwise (other 4xx) are
+   * the events sent one by one. Events the backend rejects individually
+   * are dead-lettered (or retried if the reason is transient).
    */
   async sendBatch(events: SyslogEvent[]): Promise<void> {
     if (events.length === 0) return;
 
-    // Try bulk endpoint first
+    // One request per tenant/site (spool and WAL replays, shutdown flushes can mix them)
+    const partitions = groupByPartition(events, event => event);
+    if (partitions.length > 1) {
+      for (const partition of partitions) {
+        await this.sendBatch(partition);
+      }
+      return;
+    }
+
     try {
-      await this.sendBulk(events);
-      metrics.incrementSent(events.length);
+      const rejected = await this.sendBulk(events);
+      metrics.incrementSent(events.length - rejected.length);
+      this.handleRejections(events, rejected);
       return;
     } catch (err) {
-      // Bulk failed, fall back to individual sends
-      if (config.LOG_LEVEL === 'debug') {
-        console.warn(`⚠️ Bulk send failed, falling back to individual: ${err}`);
+      if (err instanceof CircuitOpenError) {
+        await this.holdBack(events);
+        return;
+      }
+
+      // Rate limited: hold the whole batch back instead of retrying it event by event
+      if (err instanceof HttpError && err.status === 429) {
+        const delay = this.governor.retryDelayMs();
+        events.forEach(event => this.retryQueue.defer(event, 0, delay));
+        return;
       }
+
+      if (err instanceof HttpError && err.status === 413) {
+        await this.splitOversized(err, events);
+        return;
+      }
+
+      if (err instanceof HttpError && BULK_CONFIG_STATUSES.has(err.status)) {
+        metrics.incrementFailed(events.length);
+        this.refuseBulk(err, events.map(event => ({ event, attempts: 0 })));
+        return;
+      }
+
+      if (err instanceof HttpError && err.status < 500) {
+        log.debug(`⚠️ Bulk request refused, falling back to individual sends: ${err.message}`, { tenant_id: events[0]?.tenant_id });
+        await this.sendIndividually(events.map(event => ({ event, attempts: 0 })), false);
+        return;
+      }
+
+      log.debug(`⚠️ Bulk send failed, batch of ${events.length} queued for retry: ${err}`, { tenant_id: events[0]?.tenant_id });
+      metrics.incrementFailed(events.length);
+      events.forEach(event => this.retryQueue.enqueue(event, 1));
+    }
+  }
+
+  /**
+   * The backend refused a bulk request for its format or encoding:
+   * report it as the configuration error it is and retry the batch later (it
+   * ends in the write-ahead log or the dead-letter file like any batch that
+   * keeps failing), instead of sending its events one request each
+   */
+  private refuseBulk(error: HttpError, items: Array<{ event: SyslogEvent; attempts: number }>): void {
+    const now = Date.now();
+    if (now - this.lastBulkRefusedLog >= BULK_REFUSED_LOG_INTERVAL_MS) {
+      this.lastBulkRefusedLog = now;
+      log.error(
+        `❌ Backend refused a bulk request (${error.message}): check BATCH_FORMAT (${config.BATCH_FORMAT}) ` +
+        `and BATCH_COMPRESSION (${config.BATCH_COMPRESSION}); ${items.length} events queued for retry`,
+        { tenant_id: items[0]?.event.tenant_id, status: error.status },
+      );
+    }
+    items.forEach(({ event, attempts }) => this.retryQueue.enqueue(event, attempts + 1));
+  }
+
+  /**
+   * The bulk request was larger than the backend takes: send each half as
+   * its own batch (splitting again if still too large), so one huge event
+   * costs only itself, which is dead-lettered
+   */
+  private async splitOversized(error: HttpError, events: SyslogEvent[]): Promise<void> {
+    if (events.length === 1) {
+      metrics.incrementFailed();
+      metrics.incrementRejected();
+      this.retryQueue.deadLetter(events[0]!, { status: error.status, error: `Too large for the backend: ${error.message}` });
+      return;
     }
 
-    // Fallback: send individually
+    log.debug(`⚠️ Bulk request of ${events.length} events too large (HTTP 413), sending it in halves`, { tenant_id: events[0]?.tenant_id });
+    const half = Math.ceil(events.length / 2);
+    await this.sendBatch(events.slice(0, half));
+    await this.sendBatch(events.slice(half));
+  }
+
+  /**
+   * Send events one request each and queue the failures for retry
+   * (fallback for a batch the backend refused as a whole). Events refused
+   * for themselves (PERMANENT_STATUSES) are dead-lettered.
+   * Returns the number delivered.
+   */
+  private async sendIndividually(items: Array<{ event: SyslogEvent; attempts: number }>, isRetry: boolean): Promise<number> {
     const results = await Promise.all(
-      events.map(event => this.sendWithTracking(event, 0))
+      items.map(({ event, attempts }) => this.sendWithTracking(event, attempts))
     );
 
-    // Process results
+    let delivered = 0;
+    const held: SyslogEvent[] = [];
     for (const result of results) {
-      if (result.success) {
+      if (result.held) {
+        held.push(result.event);
+      } else if (result.status === 429) {
+        // Not a failure of the event: wait for the rate limit without using up an attempt
+        this.retryQueue.defer(result.event, result.attempts - 1, this.governor.retryDelayMs());
+      } else if (result.success) {
+        delivered++;
+        wal.ack([result.event]);
         metrics.incrementSent();
+        if (isRetry) metrics.incrementRetrySuccess();
+      } else if (result.status !== undefined && PERMANENT_STATUSES.has(result.status)) {
+        // The backend refused the event itself; retrying won't help
+        if (!isRetry) metrics.incrementFailed();
+        metrics.incrementRejected();
+        this.retryQueue.deadLetter(result.event, { status: result.status, error: result.error ?? `HTTP ${result.status}` });
       } else {
-        metrics.incrementFailed();
-        // Queue for retry
+        if (!isRetry) metrics.incrementFailed();
+        // Re-queue for another retry (or DLQ if max retries exceeded)
         this.retryQueue.enqueue(result.event, result.attempts);
       }
     }
+    await this.holdBack(held);
+    return delivered;
   }
 
   /**
-   * Send events using the bulk API endpoint
+   * Send events using the bulk API endpoint.
+   * Returns the events the backend rejected individually (the rest were accepted).
    */
-  private async sendBulk(events: SyslogEvent[]): Promise<void> {
-    const bulkUrl = config.CENTINELA_API_URL.replace('/syslog', '/syslog/bulk');
+  private async sendBulk(events: SyslogEvent[]): Promise<BatchRejection[]> {
+    if (!this.breaker.tryAcquire()) throw new CircuitOpenError();
+    if (!this.governor.tryAcquire()) {
+      throw new HttpError(429, 'Throttled locally (backend rate limit)');
+    }
+    if (this.kafka) return this.publishToKafka(events);
+    if (this.grpc) return this.streamToGrpc(events);
 
-    const payload = {
-      events: events.map(event => ({
-        raw_message: event.raw_message,
-        received_at: event.received_at,
-        source_ip: event.source_ip,
-        collector_name: config.COLLECTOR_NAME,
-        site_id: config.SITE_ID,
-      })),
-    };
+    const bulkUrl = this.endpoints.current().url.replace('/syslog', '/syslog/bulk');
+
+    const serializer = getSerializer(config.BATCH_FORMAT);
+    const records = events.map(event => buildIngestPayload(event));
+    const tenant = events[0]!.tenant_id ?? config.TENANT_ID ?? '';
+    const body = serializer.batch(records);
+    this.compressor.sample(tenant, records, serializer);
 
     const controller = new AbortController();
     const timeoutId = setTimeout(() => controller.abort(), 30000); // 30s for bulk
+    const start = Date.now();
+    const span = tracer.forward(events);
 
     try {
-      const response = await fetch(bulkUrl, {
+      const post = (encoded: EncodedBody) => backendFetch(bulkUrl, {
         method: 'POST',
-        headers: this.headers,
-        body: JSON.stringify(payload),
+        headers: {
+          ...this.headers, ...this.authorization(), ...partitionHeaders(events[0]!), ...span?.headers,
+          'Content-Type': serializer.contentType, ...encoded.headers,
+        },
+        body: encoded.body,
         signal: controller.signal,
       });
 
+      const encoded = await this.compressor.encode(tenant, body);
+      let response = await post(encoded);
+      if (response.status === 412 && encoded.dictionaryId !== undefined) {
+        // The backend doesn't have the dictionary: send the batch without it
+        this.compressor.unknownDictionary(tenant, encoded.dictionaryId);
+        response = await post(await this.compressor.encode(tenant, body, false));
+      }
+
       clearTimeout(timeoutId);
+      this.governor.observe(response.status, response.headers);
 
       if (!response.ok) {
         const text = await response.text().catch(() => 'No body');
-        throw new Error(`HTTP ${response.status}: ${text.slice(0, 200)}`);
+        throw new HttpError(response.status, text.slice(0, 200));
       }
 
-      const start = Date.now();
+      this.recordSuccess();
       metrics.recordLatency(Date.now() - start);
 
+      const result = await response.json().catch(() => null) as { rejected?: unknown } | null;
+      const rejected = parseRejections(result?.rejected, events.length);
+      span?.end({ status: response.status, rejected: new Set(rejected.map(rejection => rejection.index)) });
+      return rejected;
+
     } catch (error) {
       clearTimeout(timeoutId);
+      span?.end({ status: error instanceof HttpError ? error.status : undefined, error: (error as Error).message });
+      this.recordEndpointError(error);
       throw error;
     }
   }
 
   /**
-   * Process pending retries
+   * OUTPUT_TYPE=kafka: publish the batch instead of the bulk request. Kafka
+   * takes a batch as a whole, so nothing is rejected individually.
+   */
+  private async publishToKafka(events: SyslogEvent[]): Promise<BatchRejection[]> {
+    const start = Date.now();
+    const span = tracer.forward(events);
+
+    try {
+      await this.kafka!.send(events, span?.headers);
+    } catch (error) {
+      span?.end({ error: (error as Error).message });
+      this.recordFailure(error); // Broker outages hold back WAL replays like backend outages
+      throw error;
+    }
+
+    span?.end({});
+    this.recordSuccess();
+    metrics.recordLatency(Date.now() - start);
+    return [];
+  }
+
+  /**
+   * OUTPUT_TYPE=grpc: send the batch on the ingest stream instead of the bulk
+   * request. The backend's BatchAck lists rejected events like the bulk
+   * response's manifest.
+   */
+  private async streamToGrpc(events: SyslogEvent[]): Promise<BatchRejection[]> {
+    const target = config.GRPC_URL ?? new URL(this.endpoints.current().url).origin;
+    const start = Date.now();
+    const span = tracer.forward(events);
+
+    try {
+      const rejected = await this.grpc!.send(target, events, { ...identityHeaders(), ...this.authorization() }, span?.headers.traceparent);
+      span?.end({ rejected: new Set(rejected.map(rejection => rejection.index)) });
+      this.recordSuccess();
+      metrics.recordLatency(Date.now() - start);
+      return rejected;
+    } catch (error) {
+      span?.end({ error: (error as Error).message });
+      // Rate limited: deferred like a 429, without counting against the endpoint
+      if (error instanceof GrpcError && error.code === GRPC_RESOURCE_EXHAUSTED) {
+        this.breaker.recordSuccess(); // The backend answered
+        throw new HttpError(429, error.message);
+      }
+      this.recordFailure(error);
+      throw error;
+    }
+  }
+
+  /**
+   * Acknowledge the accepted events to the write-ahead log; dead-letter events
+   * rejected as invalid, re-queue those rejected for a transient reason
+   */
+  private handleRejections(events: SyslogEvent[], rejected: BatchRejection[]): void {
+    const rejectedIndexes = new Set(rejected.map(rejection => rejection.index));
+    wal.ack(events.filter((_, index) => !rejectedIndexes.has(index)));
+    if (rejected.length === 0) return;
+
+    for (const rejection of rejected) {
+      const event = events[rejection.index]!;
+      if (rejection.retryable) {
+        this.retryQueue.enqueue(event);
+      } else {
+        metrics.incrementFailed();
+        metrics.incrementRejected();
+        this.retryQueue.deadLetter(event, { error: rejection.reason });
+      }
+    }
+
+    const first = rejected[0]!;
+    const example = eventLogFields(events[first.index]!);
+    log.warn(
+      `⚠️ Backend rejected ${rejected.length}/${events.length} events in batch ` +
+      `(e.g. #${first.index}, trace ${example.trace_id}: ${first.reason})`,
+      { ...example, tenant_id: example.tenant_id ?? config.TENANT_ID },
+    );
+  }
+
+  /**
+   * Count network errors and 5xx responses towards endpoint failover and the
+   * circuit breaker. 4xx responses are the request's fault, not the
+   * endpoint's: for the breaker they show the backend is up.
+   */
+  private recordEndpointError(error: unknown): void {
+    if (error instanceof HttpError && error.status < 500) {
+      this.breaker.recordSuccess();
+      return;
+    }
+    this.recordFailure(error);
+  }
+
+  private recordSuccess(): void {
+    this.endpoints.recordSuccess();
+    this.breaker.recordSuccess();
+  }
+
+  private recordFailure(error: unknown): void {
+    this.endpoints.recordFailure();
+    this.breaker.recordFailure(error instanceof Error ? error.message : String(error));
+  }
+
+  /**
+   * The circuit is open: spool the events to disk (replayed once it closes),
+   * without using up retry attempts. If the spool can't take them, they wait
+   * in the retry queue for the next probe.
+   */
+  private async holdBack(events: SyslogEvent[]): Promise<void> {
+    if (events.length === 0) return;
+    this.breaker.recordHeld(events.length);
+    if (await maintenance.spool(events)) {
+      log.debug(`🔌 Circuit open, ${events.length} events spooled to disk`, { tenant_id: events[0]?.tenant_id });
+      return;
+    }
+    const delay = Math.max(this.breaker.retryDelayMs(), config.RETRY_BASE_DELAY_MS);
+    events.forEach(event => this.retryQueue.defer(event, 0, delay));
+  }
+
+  /**
+   * Process pending retries (up to `limit` events), in bulk batches of BATCH_SIZE
    * Should be called periodically from the main loop
    */
-  async processRetries(): Promise<void> {
-    if (this.isProcessingRetries) return;
+  async processRetries(limit: number = Number.POSITIVE_INFINITY): Promise<{ attempted: number; delivered: number }> {
+    if (this.isProcessingRetries || limit <= 0) return { attempted: 0, delivered: 0 };
+
+    const readyEvents = this.retryQueue.getReadyEvents(limit);
+    if (readyEvents.length === 0) return { attempted: 0, delivered: 0 };
 
-    const readyEvents = this.retryQueue.getReadyEvents();
-    if (readyEvents.length === 0) return;
+    // Circuit open: to the spool rather than another failed attempt each
+    if (this.breaker.isOpen) {
+      await this.holdBack(readyEvents.map(({ event }) => event));
+      return { attempted: readyEvents.length, delivered: 0 };
+    }
 
     this.isProcessingRetries = true;
+    let delivered = 0;
 
-    try {
-      const results = await Promise.all(
-        readyEvents.map(({ event, attempts }) =>
-          this.sendWithTracking(event, attempts)
-        )
-      );
+    // Batches of at most BATCH_SIZE, never mixing tenants or sites
+    const chunks = groupByPartition(readyEvents, ({ event }) => event).flatMap((group) => {
+      const groupChunks = [];
+      for (let offset = 0; offset < group.length; offset += config.BATCH_SIZE) {
+        groupChunks.push(group.slice(offset, offset + config.BATCH_SIZE));
+      }
+      return groupChunks;
+    });
 
-      for (const result of results) {
-        if (result.success) {
-          metrics.incrementSent();
-          metrics.incrementRetrySuccess();
-          if (config.LOG_LEVEL === 'debug') {
-            console.log(`✅ Retry successful after ${result.attempts} attempts`);
+    try {
+      for (const [index, chunk] of chunks.entries()) {
+        const events = chunk.map(({ event }) => event);
+
+        try {
+          const rejected = await this.sendBulk(events);
+          const accepted = events.length - rejected.length;
+          delivered += accepted;
+          metrics.incrementSent(accepted);
+          metrics.incrementRetrySuccess(accepted);
+          this.handleRejections(events, rejected);
+          log.debug(`✅ Retried batch of ${events.length} events`, { tenant_id: events[0]?.tenant_id });
+        } catch (err) {
+          if (err instanceof CircuitOpenError) {
+            await this.holdBack(chunks.slice(index).flat().map(({ event }) => event));
+            break;
+          }
+          if (err instanceof HttpError && err.status === 429) {
+            // Not a failure of the events: wait for the rate limit without using up an attempt
+            const delay = this.governor.retryDelayMs();
+            chunks.slice(index).flat().forEach(({ event, attempts }) => this.retryQueue.defer(event, attempts, delay));
+            break;
           }
-        } else {
-          // Re-queue for another retry (or DLQ if max retries exceeded)
-          this.retryQueue.enqueue(result.event, result.attempts);
+          if (err instanceof HttpError && BULK_CONFIG_STATUSES.has(err.status)) {
+            this.refuseBulk(err, chunk);
+            continue;
+          }
+          if (err instanceof HttpError && err.status < 500) {
+            delivered += await this.sendIndividually(chunk, true);
+            continue;
+          }
+          // Backend still failing: the remaining batches wait for their next attempt
+          chunks.slice(index).flat().forEach(({ event, attempts }) => this.retryQueue.enqueue(event, attempts + 1));
+          break;
         }
       }
     } finally {
       this.isProcessingRetries = false;
     }
+
+    return { attempted: readyEvents.length, delivered };
   }
 
   /**
@@ -171,6 +555,8 @@ export class HttpTransport {
         event,
         attempts: currentAttempts + 1,
         error: errorMsg,
+        status: error instanceof HttpError ? error.status : undefined,
+        held: error instanceof CircuitOpenError,
       };
     }
   }
@@ -179,37 +565,73 @@ export class HttpTransport {
    * Send a single event to the API
    */
   private async sendOne(event: SyslogEvent): Promise<void> {
-    const payload = {
-      raw_message: event.raw_message,
-      received_at: event.received_at,
-      source_ip: event.source_ip,
-      collector_name: config.COLLECTOR_NAME,
-      site_id: config.SITE_ID,
-    };
+    if (!this.breaker.tryAcquire()) throw new CircuitOpenError();
+    if (!this.governor.tryAcquire()) {
+      throw new HttpError(429, 'Throttled locally (backend rate limit)');
+    }
+
+    const payload = buildIngestPayload(event);
 
     const controller = new AbortController();
     const timeoutId = setTimeout(() => controller.abort(), 10000);
+    const span = tracer.forward([event]);
 
     try {
-      const response = await fetch(config.CENTINELA_API_URL, {
+      const response = await backendFetch(this.endpoints.current().url, {
         method: 'POST',
-        headers: this.headers,
+        headers: { ...this.headers, ...this.authorization(), ...span?.headers },
         body: JSON.stringify(payload),
         signal: controller.signal
       });
 
       clearTimeout(timeoutId);
+      this.governor.observe(response.status, response.headers);
 
       if (!response.ok) {
         const text = await response.text().catch(() => 'No body');
-        throw new Error(`HTTP ${response.status}: ${text.slice(0, 100)}`);
+        throw new HttpError(response.status, text.slice(0, 100));
       }
+
+      this.recordSuccess();
+      span?.end({ status: response.status });
     } catch (error) {
       clearTimeout(timeoutId);
+      span?.end({ status: error instanceof HttpError ? error.status : undefined, error: (error as Error).message });
+      this.recordEndpointError(error);
       throw error;
     }
   }
 
+  /**
+   * Store a zstd dictionary on the backend (see BatchCompressor); resolves
+   * once the backend accepted it
+   */
+  private async uploadDictionary(tenant: string, id: number, dictionary: Buffer): Promise<void> {
+    const url = this.endpoints.current().url.replace('/syslog', '/syslog/dictionaries');
+    const response = await backendFetch(url, {
+      method: 'POST',
+      headers: {
+        ...this.headers, ...this.authorization(),
+        ...(tenant ? { 'X-Centinela-Tenant': headerValue(tenant) } : {}),
+        'Content-Type': 'application/octet-stream',
+        'X-Centinela-Zstd-Dictionary': String(id),
+      },
+      body: dictionary,
+      signal: AbortSignal.timeout(30000),
+    });
+    if (!response.ok) {
+      const text = await response.text().catch(() => 'No body');
+      throw new HttpError(response.status, text.slice(0, 200));
+    }
+  }
+
+  /**
+   * Read per request: the key may be rotated at runtime (CENTINELA_API_KEY_FILE)
+   */
+  private authorization(): Record<string, string> {
+    return { 'Authorization': `Bearer ${apiKey()}` };
+  }
+
   /**
    * Get retry queue statistics
    */
@@ -220,6 +642,87 @@ export class HttpTransport {
     };
   }
 
+  /**
+   * The host's addresses changed (DHCP, VPN, renumbered LAN): connections
+   * and DNS answers from before may be stale. New connections resolve the
+   * backend again; retries go out now instead of waiting out their backoff.
+   */
+  public async handleNetworkChange(): Promise<void> {
+    this.retryQueue.retryNow();
+
+    const { hostname } = new URL(this.endpoints.current().url);
+    try {
+      const { address } = await dns.lookup(hostname);
+      log.info(`🌐 Backend ${hostname} resolves to ${address}`);
+    } catch (err) {
+      log.warn(`⚠️ Backend ${hostname} does not resolve after the network change: ${(err as Error).message}`);
+    }
+  }
+
+  /**
+   * Per tenant/site backlog: events still buffered (`buffered`, from the
+   * buffer), waiting to retry and dead-lettered
+   */
+  public getPartitionStats(buffered: Record<string, number>): Record<string, PartitionStats> {
+    const stats: Record<string, PartitionStats> = {};
+    for (const [key, count] of Object.entries(buffered)) {
+      stats[key] = { buffered: count, retrying: 0, dlq: 0 };
+    }
+    for (const [key, counts] of Object.entries(this.retryQueue.partitionCounts())) {
+      stats[key] = { buffered: stats[key]?.buffered ?? 0, ...counts };
+    }
+    return stats;
+  }
+
+  /**
+   * Get active backend endpoint and failover statistics
+   */
+  public getEndpointStats(): EndpointStats {
+    return this.endpoints.getStats();
+  }
+
+  /**
+   * Circuit breaker state and counters
+   */
+  public getCircuitStats(): CircuitBreakerStats {
+    return this.breaker.getStats();
+  }
+
+  /**
+   * Whether the circuit is open (nothing is sent until the next probe)
+   */
+  public isCircuitOpen(): boolean {
+    return this.breaker.isOpen;
+  }
+
+  /**
+   * Whether the rate limit allows another request right now
+   */
+  public canSend(): boolean {
+    return this.governor.available() >= 1;
+  }
+
+  /**
+   * Requests the rate limit allows right now (Infinity until the backend advertises one)
+   */
+  public requestAllowance(): number {
+    return this.governor.available();
+  }
+
+  /**
+   * Get the backend rate limit as currently understood by the collector
+   */
+  public getRateLimitStats(): RateLimitStats {
+    return this.governor.getStats();
+  }
+
+  /**
+   * Make every waiting retry due now (shutdown drain)
+   */
+  public retryNow(): void {
+    this.retryQueue.retryNow();
+  }
+
   /**
    * Check if there are pending retries
    */
@@ -227,10 +730,53 @@ export class HttpTransport {
     return this.retryQueue.hasEvents();
   }
 
+  /**
+   * Take the events still waiting to retry, without sending them
+   */
+  public exportRetries(): SyslogEvent[] {
+    return this.retryQueue.exportPending();
+  }
+
+  /**
+   * Send dead-lettered events again (after the cause was fixed), at the retry pace
+   */
+  public replay(events: SyslogEvent[]): void {
+    this.retryQueue.replay(events);
+  }
+
   /**
    * Export failed events from DLQ for manual processing
    */
   public exportDLQ(): SyslogEvent[] {
     return this.retryQueue.exportDLQ();
   }
+
+  /**
+   * Kafka producer statistics (null unless OUTPUT_TYPE=kafka)
+   */
+  public getKafkaStats(): KafkaOutputStats | null {
+    return this.kafka?.getStats() ?? null;
+  }
+
+  /**
+   * gRPC stream statistics (null unless OUTPUT_TYPE=grpc)
+   */
+  public getGrpcStats(): GrpcOutputStats | null {
+    return this.grpc?.getStats() ?? null;
+  }
+
+  /**
+   * Bulk request compression and zstd dictionaries
+   */
+  public getCompressionStats(): CompressionStats {
+    return this.compressor.getStats();
+  }
+
+  /**
+   * Release the output's connections (shutdown, after the last send)
+   */
+  public async close(): Promise<void> {
+    await this.kafka?.close();
+    await this.grpc?.close();
+  }
 }
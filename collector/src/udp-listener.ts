@@ -0,0 +1,208 @@
+import dgram from 'node:dgram';
+import { isBindError, logStartError } from './bind-diagnostics.js';
+import { log } from './logger.js';
+
+const REBIND_MIN_DELAY_MS = 1000;
+const REBIND_MAX_DELAY_MS = 60000;
+
+export interface UdpSocketInfo {
+    readers: number;
+    recvBufferBytes: number; // As granted by the kernel (Linux doubles the request, capped by net.core.rmem_max)
+}
+
+let reusePortWarned = false;
+
+/**
+ * UDP Syslog Listener
+ *
+ * One UDP port (UDP_PORT, or a named listener) that keeps itself bound:
+ * - if the port can't be used at startup, it tries the fallback port (if any)
+ * - if the socket fails later (interface gone, VPN flap), it is recreated and
+ *   rebound with backoff instead of staying closed until a restart
+ * - if its bind address doesn't exist yet (DHCP not done), revalidate()
+ *   binds it once the address appears (see NetworkWatcher)
+ *
+ * A single socket read by one event loop tops out around 20k datagrams/s.
+ * With readers > 1 (UDP_READERS), that many sockets are bound to the port
+ * with SO_REUSEPORT and the kernel spreads the senders across them (by
+ * address hash, so each device's order is kept); they fail, fall back and
+ * rebind together. recvBufferSize (UDP_RCVBUF_BYTES) raises each socket's
+ * kernel receive buffer, which absorbs bursts while the loop is busy.
+ */
+export class UdpListener {
+    private readonly label: string;
+    private readonly port: number;
+    private readonly fallbackPort: number | undefined;
+    private readonly bindAddress: string;
+    private readonly onMessage: (msg: Buffer, rinfo: dgram.RemoteInfo) => void;
+    private readonly onListening: (port: number, info: UdpSocketInfo) => void;
+    private readonly readers: number;
+    private readonly recvBufferSize: number | undefined;
+
+    private sockets: dgram.Socket[] | null = null;
+    private listening = false;
+    private stopped = false;
+    private rebindDelayMs = REBIND_MIN_DELAY_MS;
+    private rebindTimer: NodeJS.Timeout | null = null;
+    private started: ((listening: boolean) => void) | null = null;
+
+    constructor(options: {
+        label: string; // e.g. "UDP", "UDP (acme-fw)"
+        port: number;
+        fallbackPort?: number;
+        bindAddress: string;
+        onMessage: (msg: Buffer, rinfo: dgram.RemoteInfo) => void;
+        onListening?: (port: number, info: UdpSocketInfo) => void;
+        readers?: number;
+        recvBufferSize?: number;
+    }) {
+        this.label = options.label;
+        this.port = options.port;
+        this.fallbackPort = options.fallbackPort;
+        this.bindAddress = options.bindAddress;
+        this.onMessage = options.onMessage;
+        this.onListening = options.onListening ?? (() => undefined);
+        this.readers = options.readers ?? 1;
+        this.recvBufferSize = options.recvBufferSize;
+        if (this.readers > 1 && !reusePortSupported()) {
+            if (!reusePortWarned) {
+                log.warn(`⚠️ UDP_READERS=${this.readers} needs SO_REUSEPORT (Linux or FreeBSD, Node.js 22.12+); ` +
+                    `using a single socket (${process.platform}, Node.js ${process.versions.node})`);
+            }
+            reusePortWarned = true;
+            this.readers = 1;
+        }
+    }
+
+    /**
+     * Bind the socket. Resolves once listening (true), or false if neither
+     * the port nor the fallback could be used; never rejects.
+     */
+    public start(): Promise<boolean> {
+        return new Promise((resolve) => {
+            this.started = resolve;
+            this.bind(this.port);
+        });
+    }
+
+    /**
+     * After a network change: bind again if the socket is down and its
+     * address is now available
+     */
+    public revalidate(localAddresses: Set<string>): void {
+        if (this.stopped || this.sockets || this.rebindTimer) return;
+        if (isWildcard(this.bindAddress) || localAddresses.has(this.bindAddress)) {
+            log.info(`🌐 ${this.label}: ${this.bindAddress} is available, binding again`);
+            this.bind(this.port);
+        }
+    }
+
+    public get isListening(): boolean {
+        return this.listening;
+    }
+
+    public close(): Promise<void> {
+        this.stopped = true;
+        if (this.rebindTimer) {
+            clearTimeout(this.rebindTimer);
+            this.rebindTimer = null;
+        }
+
+        const sockets = this.sockets ?? [];
+        this.sockets = null;
+        this.listening = false;
+
+        return Promise.all(sockets.map((socket) => new Promise<void>((resolve) => {
+            try {
+                socket.close(() => resolve());
+            } catch {
+                resolve(); // Already closed
+            }
+        }))).then(() => undefined);
+    }
+
+    private bind(port: number): void {
+        const sockets = Array.from({ length: this.readers }, () => dgram.createSocket({
+            type: 'udp4',
+            reusePort: this.readers > 1,
+            recvBufferSize: this.recvBufferSize,
+        }));
+        this.sockets = sockets;
+        const group = { sockets, bound: 0 };
+        sockets.forEach((socket) => this.attach(socket, group, port));
+    }
+
+    private attach(socket: dgram.Socket, group: { sockets: dgram.Socket[]; bound: number }, port: number): void {
+        const { sockets } = group;
+        socket.on('message', this.onMessage);
+
+        socket.on('error', (err) => {
+            if (sockets !== this.sockets) return;
+            this.discard(sockets);
+
+            if (!this.listening) {
+                logStartError(`${this.label} server`, err);
+                if (isBindError(err) && this.fallbackPort && port !== this.fallbackPort) {
+                    log.warn(`↪️ Trying fallback port ${this.fallbackPort} instead`);
+                    this.bind(this.fallbackPort);
+                    return;
+                }
+                // Otherwise retried by revalidate() after a network change
+                this.started?.(false);
+                this.started = null;
+                return;
+            }
+
+            this.listening = false;
+            log.error(`❌ ${this.label} Server Error: ${err.message}; rebinding in ${this.rebindDelayMs}ms`);
+            this.rebindTimer = setTimeout(() => {
+                this.rebindTimer = null;
+                if (!this.stopped) this.bind(port);
+            }, this.rebindDelayMs);
+            this.rebindDelayMs = Math.min(this.rebindDelayMs * 2, REBIND_MAX_DELAY_MS);
+        });
+
+        socket.on('listening', () => {
+            // Listening once every reader is bound
+            if (sockets !== this.sockets || ++group.bound < sockets.length) return;
+
+            this.listening = true;
+            this.rebindDelayMs = REBIND_MIN_DELAY_MS;
+            const address = socket.address();
+            const recvBufferBytes = socket.getRecvBufferSize();
+            log.info(`👂 ${this.label} Syslog listening on udp://${address.address}:${address.port}` +
+                (sockets.length > 1 ? ` (${sockets.length} readers, SO_REUSEPORT)` : ''));
+            if (this.recvBufferSize && recvBufferBytes < this.recvBufferSize) {
+                log.warn(`⚠️ ${this.label}: the kernel granted a ${recvBufferBytes}-byte receive buffer instead of ` +
+                    `${this.recvBufferSize} (UDP_RCVBUF_BYTES); raise net.core.rmem_max (sysctl) to get it`);
+            }
+            this.onListening(address.port, { readers: sockets.length, recvBufferBytes });
+            this.started?.(true);
+            this.started = null;
+        });
+
+        socket.bind(port, this.bindAddress);
+    }
+
+    private discard(sockets: dgram.Socket[]): void {
+        this.sockets = null;
+        for (const socket of sockets) {
+            try {
+                socket.close();
+            } catch {
+                // Never bound
+            }
+        }
+    }
+}
+
+// SO_REUSEPORT balancing: Linux and FreeBSD, and dgram's reusePort option (Node.js 22.12 / 23.1)
+function reusePortSupported(): boolean {
+    const [major = 0, minor = 0] = process.versions.node.split('.').map(Number);
+    return (process.platform === 'linux' || process.platform === 'freebsd') &&
+        (major > 23 || (major === 23 && minor >= 1) || (major === 22 && minor >= 12));
+}
+
+export function isWildcard(address: string): boolean {
+    return address === '0.0.0.0' || address === '::';
+}
@@ -0,0 +1,166 @@
+import { readFile } from 'node:fs/promises';
+import { config } from './config.js';
+import type { UdpSocketInfo } from './udp-listener.js';
+import { log } from './logger.js';
+
+export interface UdpKernelStats {
+    available: boolean;
+    port: number;
+    readers: number; // Sockets on the port (UDP_READERS)
+    rcvbuf_bytes: number; // Kernel receive buffer of each
+    datagrams_received: number;
+    socket_drops: number; // Kernel drops on our listener socket(s) since start, all readers
+    rx_queue_bytes: number; // Bytes waiting in the socket receive queue
+    system_rcvbuf_errors: number; // Host-wide UDP RcvbufErrors since start
+    estimated_loss_percent: number;
+}
+
+/**
+ * UDP Packet Loss Monitor (Linux)
+ *
+ * UDP drops happen in the kernel before the collector ever sees the datagram,
+ * so they never show up in our own counters. This periodically reads:
+ * - /proc/net/udp{,6}: per-socket `drops` and rx_queue for the listener port
+ * - /proc/net/snmp: host-wide RcvbufErrors
+ * and reports the delta since startup, so "missing logs" can be triaged objectively.
+ */
+export class UdpDropMonitor {
+    private readonly port: number;
+    private readonly sockets: UdpSocketInfo;
+    private timer: NodeJS.Timeout | null = null;
+    private available = true;
+
+    private datagrams = 0;
+    private baselineDrops: number | null = null;
+    private baselineRcvbufErrors: number | null = null;
+    private lastDrops = 0;
+
+    private stats: UdpKernelStats;
+
+    constructor(port: number, sockets: UdpSocketInfo) {
+        this.port = port;
+        this.sockets = sockets;
+        this.stats = {
+            available: false,
+            port,
+            readers: sockets.readers,
+            rcvbuf_bytes: sockets.recvBufferBytes,
+            datagrams_received: 0,
+            socket_drops: 0,
+            rx_queue_bytes: 0,
+            system_rcvbuf_errors: 0,
+            estimated_loss_percent: 0,
+        };
+    }
+
+    /**
+     * Count a datagram delivered to the collector (for the loss estimate)
+     */
+    public recordDatagram(): void {
+        this.datagrams++;
+    }
+
+    public start(): void {
+        const tick = async () => {
+            await this.poll();
+            if (this.available) {
+                this.timer = setTimeout(tick, config.UDP_STATS_INTERVAL_MS);
+            }
+        };
+        void tick();
+    }
+
+    public stop(): void {
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+    }
+
+    public getStats(): UdpKernelStats {
+        return { ...this.stats, datagrams_received: this.datagrams };
+    }
+
+    private async poll(): Promise<void> {
+        let socket: { drops: number; rxQueue: number };
+        let rcvbufErrors: number;
+
+        try {
+            const [udp4, udp6, snmp] = await Promise.all([
+                readFile('/proc/net/udp', 'utf8'),
+                readFile('/proc/net/udp6', 'utf8').catch(() => ''),
+                readFile('/proc/net/snmp', 'utf8'),
+            ]);
+            socket = this.parseSocketTable(udp4 + udp6);
+            rcvbufErrors = this.parseRcvbufErrors(snmp);
+        } catch {
+            if (this.available) {
+                log.info('ℹ️ UDP kernel statistics unavailable on this platform (no /proc/net/udp)');
+            }
+            this.available = false;
+            this.stats.available = false;
+            return;
+        }
+
+        this.baselineDrops ??= socket.drops;
+        this.baselineRcvbufErrors ??= rcvbufErrors;
+
+        const drops = Math.max(0, socket.drops - this.baselineDrops);
+        const total = drops + this.datagrams;
+
+        this.stats = {
+            available: true,
+            port: this.port,
+            readers: this.sockets.readers,
+            rcvbuf_bytes: this.sockets.recvBufferBytes,
+            datagrams_received: this.datagrams,
+            socket_drops: drops,
+            rx_queue_bytes: socket.rxQueue,
+            system_rcvbuf_errors: Math.max(0, rcvbufErrors - this.baselineRcvbufErrors),
+            estimated_loss_percent: total > 0 ? Math.round((drops / total) * 10000) / 100 : 0,
+        };
+
+        const newDrops = drops - this.lastDrops;
+        this.lastDrops = drops;
+        if (newDrops > 0) {
+            log.warn(
+                `⚠️ Kernel dropped ${newDrops} UDP datagrams on port ${this.port} ` +
+                `(receive buffer full; rx_queue ${socket.rxQueue} bytes, raise UDP_RCVBUF_BYTES or UDP_READERS). ` +
+                `Estimated loss since start: ${this.stats.estimated_loss_percent}%`
+            );
+        }
+    }
+
+    /**
+     * Sum drops and rx_queue for every socket bound to our port.
+     * Columns: sl local_address rem_address st tx_queue:rx_queue ... inode ref pointer drops
+     */
+    private parseSocketTable(table: string): { drops: number; rxQueue: number } {
+        const portHex = this.port.toString(16).toUpperCase().padStart(4, '0');
+        let drops = 0;
+        let rxQueue = 0;
+
+        for (const line of table.split('\n')) {
+            const columns = line.trim().split(/\s+/);
+            if (columns.length < 13 || columns[0] === 'sl') continue;
+
+            const localPort = columns[1]!.split(':')[1];
+            if (localPort !== portHex) continue;
+
+            rxQueue += parseInt(columns[4]!.split(':')[1] ?? '0', 16) || 0;
+            drops += Number(columns[columns.length - 1]) || 0;
+        }
+
+        return { drops, rxQueue };
+    }
+
+    private parseRcvbufErrors(snmp: string): number {
+        const lines = snmp.split('\n').filter((line) => line.startsWith('Udp:'));
+        if (lines.length < 2) return 0;
+
+        const names = lines[0]!.split(/\s+/);
+        const values = lines[1]!.split(/\s+/);
+        const index = names.indexOf('RcvbufErrors');
+        return index > 0 ? Number(values[index]) || 0 : 0;
+    }
+}
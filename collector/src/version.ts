@@ -0,0 +1,37 @@
+import { readFileSync } from 'node:fs';
+
+// Kept apart from identity.ts so commands that run without a configuration can use it
+export const COLLECTOR_VERSION = '0.2.0';
+
+export interface BuildInfo {
+  version: string;
+  commit: string;
+  build_date: string;
+  node: string;
+  platform: string;
+  arch: string;
+}
+
+/**
+ * Version, commit and build date of this build. The commit and date are
+ * stamped into dist/build-info.json by `npm run build` (scripts/build-info.mjs;
+ * the Docker image passes them as COLLECTOR_COMMIT / COLLECTOR_BUILD_DATE
+ * build args) and are "unknown" when running from source.
+ */
+export function buildInfo(): BuildInfo {
+  let stamped: { commit?: unknown; build_date?: unknown } = {};
+  try {
+    stamped = JSON.parse(readFileSync(new URL('./build-info.json', import.meta.url), 'utf8'));
+  } catch {
+    // Not built (tsx), or built without the stamp
+  }
+
+  return {
+    version: COLLECTOR_VERSION,
+    commit: typeof stamped.commit === 'string' && stamped.commit ? stamped.commit : 'unknown',
+    build_date: typeof stamped.build_date === 'string' && stamped.build_date ? stamped.build_date : 'unknown',
+    node: process.version,
+    platform: process.platform,
+    arch: process.arch,
+  };
+}
@@ -0,0 +1,391 @@
+import path from 'node:path';
+import { createHash } from 'node:crypto';
+import { appendFile, mkdir, open, readdir, readFile, unlink } from 'node:fs/promises';
+import { config } from './config.js';
+import type { SyslogEvent } from './buffer.js';
+import { log } from './logger.js';
+
+const SEGMENT_PATTERN = /^segment-(\d{8})\.ndjson$/;
+
+export interface WalStats {
+    enabled: boolean;
+    segments: number;
+    bytes: number;
+    unacked: number; // Written and not yet accepted by the backend
+    parked: number; // Of those, only on disk (retries exhausted, or recovered on startup) until replayed
+    spilled: number; // Of those, only on disk because the buffer was above its high-water mark
+    overflow: number; // Not written because WAL_MAX_BYTES was reached
+    corrupt: number; // Records skipped during recovery
+    last_error: string | null;
+}
+
+interface Segment {
+    seq: number;
+    bytes: number;
+    unacked: Set<string>; // event_ids
+    parked: Set<string>;
+    spilled: Set<string>;
+}
+
+type WriteOp = { file: string; data: string } | { remove: string[] };
+
+/**
+ * Write-Ahead Log (persistent queue)
+ *
+ * Every buffered event is appended to a segment file under WAL_DIR before it
+ * is forwarded, and is acknowledged (recorded in the segment's .acks file)
+ * once the backend answers it with a 2xx. A segment is deleted when all its
+ * events are acknowledged. Events that run out of retries during a long
+ * outage are parked here instead of dead-lettered, and together with the
+ * unacknowledged events found on startup they are replayed once the retry
+ * queue is empty. It is also the buffer's overflow: above the high-water
+ * mark, new events are spilled here only and read back once the buffer
+ * drains (see MessageBuffer).
+ *
+ * Each record carries a checksum; torn or corrupted records are skipped on
+ * recovery. Delivery is at-least-once: events sent just before a crash, and
+ * events spooled while the circuit was open that the log still holds
+ * unacknowledged, are sent again. The backend stores each event_id once
+ * (raw_events), so its ingest API sees no duplicates; other outputs (Kafka,
+ * dual-write, relays) may. Writes are not fsynced, so a power loss can lose
+ * the last few milliseconds, except where an input waits for sync() before
+ * acknowledging its source (the Kafka input commits its offsets after it).
+ */
+export class WriteAheadLog {
+    private segments = new Map<number, Segment>();
+    private index = new Map<string, Segment>(); // event_id -> segment
+    private active: Segment | null = null;
+    private ops: WriteOp[] = [];
+    private writing: Promise<void> | null = null;
+    private unsynced = new Set<string>(); // Segment files appended to since the last sync()
+    private writeFailures = 0;
+    private counters = { overflow: 0, corrupt: 0 };
+    private full = false;
+    private lastError: string | null = null;
+
+    public get enabled(): boolean {
+        return Boolean(config.WAL_DIR);
+    }
+
+    /**
+     * Unacknowledged events waiting on disk to be replayed
+     */
+    public get hasParked(): boolean {
+        for (const segment of this.segments.values()) {
+            if (segment.parked.size > 0) return true;
+        }
+        return false;
+    }
+
+    /**
+     * Events spilled by the buffer, waiting on disk to be read back
+     */
+    public get hasSpilled(): boolean {
+        for (const segment of this.segments.values()) {
+            if (segment.spilled.size > 0) return true;
+        }
+        return false;
+    }
+
+    /**
+     * Whether this event is in the log, not yet acknowledged
+     */
+    public holds(eventId: string): boolean {
+        return this.index.has(eventId);
+    }
+
+    /**
+     * Whether the last append was refused because WAL_MAX_BYTES was reached
+     */
+    public get isFull(): boolean {
+        return this.full;
+    }
+
+    /**
+     * Recover the segments left by a previous run; their unacknowledged events are parked for replay
+     */
+    public async open(): Promise<void> {
+        if (!this.enabled) return;
+
+        await mkdir(config.WAL_DIR!, { recursive: true });
+        const seqs = (await readdir(config.WAL_DIR!))
+            .map((name) => SEGMENT_PATTERN.exec(name)?.[1])
+            .filter((seq): seq is string => seq !== undefined)
+            .map(Number)
+            .sort((a, b) => a - b);
+
+        let recovered = 0;
+        for (const seq of seqs) {
+            const segment: Segment = { seq, bytes: 0, unacked: new Set(), parked: new Set(), spilled: new Set() };
+            const content = await readFile(this.segmentPath(seq), 'utf8');
+            segment.bytes = Buffer.byteLength(content);
+
+            const acked = new Set((await readFile(this.acksPath(seq), 'utf8').catch(() => '')).split('\n'));
+            for (const event of this.parseSegment(content, true)) {
+                if (acked.has(event.event_id)) continue;
+                segment.unacked.add(event.event_id);
+                segment.parked.add(event.event_id);
+                this.index.set(event.event_id, segment);
+            }
+
+            if (segment.unacked.size === 0) {
+                this.enqueue({ remove: [this.segmentPath(seq), this.acksPath(seq)] });
+                continue;
+            }
+            this.segments.set(seq, segment);
+            recovered += segment.unacked.size;
+        }
+
+        // New events always go to a new segment, never after a possibly torn record
+        this.rotate((seqs[seqs.length - 1] ?? 0) + 1);
+
+        log.info(`💾 Write-ahead log in ${config.WAL_DIR}` +
+            (recovered > 0 ? `: ${recovered} unacknowledged events from the last run will be replayed` : ''));
+        if (this.counters.corrupt > 0) {
+            log.warn(`⚠️ Write-ahead log: skipped ${this.counters.corrupt} corrupted records`);
+        }
+    }
+
+    /**
+     * Record an event before it is forwarded. Returns false if it was not
+     * written (WAL disabled or WAL_MAX_BYTES reached).
+     */
+    public append(event: SyslogEvent): boolean {
+        if (!this.active) return false;
+
+        const json = JSON.stringify(event);
+        const line = `${checksum(json)}\t${json}\n`;
+        const bytes = Buffer.byteLength(line);
+
+        if (this.totalBytes + bytes > config.WAL_MAX_BYTES) {
+            this.counters.overflow++;
+            if (!this.full) log.warn(`⚠️ Write-ahead log is full (WAL_MAX_BYTES), new events are held in memory only`);
+            this.full = true;
+            return false;
+        }
+        this.full = false;
+
+        if (this.active.bytes > 0 && this.active.bytes + bytes > config.WAL_SEGMENT_BYTES) {
+            this.rotate(this.active.seq + 1);
+        }
+
+        const segment = this.active;
+        segment.bytes += bytes;
+        segment.unacked.add(event.event_id);
+        this.index.set(event.event_id, segment);
+        this.enqueue({ file: this.segmentPath(segment.seq), data: line });
+        return true;
+    }
+
+    /**
+     * Record an event on disk only (the buffer is above its high-water mark).
+     * Returns false if it was not written.
+     */
+    public spill(event: SyslogEvent): boolean {
+        if (!this.append(event)) return false;
+        this.active!.spilled.add(event.event_id);
+        return true;
+    }
+
+    /**
+     * The backend answered these events (accepted, or refused for good): they no longer need the log
+     */
+    public ack(events: SyslogEvent[]): void {
+        this.ackIds(events.map((event) => event.event_id));
+    }
+
+    /**
+     * Keep an event that ran out of retries on disk only, for a later replay.
+     * Returns false if it is not in the log.
+     */
+    public park(event: SyslogEvent): boolean {
+        const segment = this.index.get(event.event_id);
+        if (!segment) return false;
+        segment.parked.add(event.event_id);
+        return true;
+    }
+
+    /**
+     * Take up to `limit` parked events for replay, oldest first. They stay in
+     * the log until acknowledged.
+     */
+    public takeParked(limit: number): Promise<SyslogEvent[]> {
+        return this.take('parked', limit);
+    }
+
+    /**
+     * Take up to `limit` spilled events back into memory, oldest first (from
+     * one segment per call). They stay in the log until acknowledged.
+     */
+    public takeSpilled(limit: number): Promise<SyslogEvent[]> {
+        return this.take('spilled', limit);
+    }
+
+    /**
+     * Wait until everything queued is on disk
+     */
+    public async flush(): Promise<void> {
+        while (this.writing) await this.writing;
+    }
+
+    /**
+     * Wait until everything queued is on disk and fsynced, so it survives a
+     * power loss. Throws if a write failed.
+     */
+    public async sync(): Promise<void> {
+        const failures = this.writeFailures;
+        await this.flush();
+        if (this.writeFailures !== failures) throw new Error(`write-ahead log: ${this.lastError}`);
+
+        const files = [...this.unsynced];
+        this.unsynced.clear();
+        await Promise.all(files.map(async (file) => {
+            const handle = await open(file, 'r').catch(() => null); // Removed meanwhile: nothing left to keep
+            if (!handle) return;
+            try {
+                await handle.datasync();
+            } finally {
+                await handle.close();
+            }
+        }));
+    }
+
+    public getStats(): WalStats {
+        let parked = 0;
+        let spilled = 0;
+        for (const segment of this.segments.values()) {
+            parked += segment.parked.size;
+            spilled += segment.spilled.size;
+        }
+        return {
+            enabled: this.enabled,
+            segments: this.segments.size,
+            bytes: this.totalBytes,
+            unacked: this.index.size,
+            parked,
+            spilled,
+            ...this.counters,
+            last_error: this.lastError,
+        };
+    }
+
+    private get totalBytes(): number {
+        let bytes = 0;
+        for (const segment of this.segments.values()) bytes += segment.bytes;
+        return bytes;
+    }
+
+    private ackIds(eventIds: string[]): void {
+        const acked = new Map<Segment, string[]>();
+        for (const eventId of eventIds) {
+            const segment = this.index.get(eventId);
+            if (!segment) continue;
+
+            this.index.delete(eventId);
+            segment.unacked.delete(eventId);
+            segment.parked.delete(eventId);
+            segment.spilled.delete(eventId);
+            acked.set(segment, [...(acked.get(segment) ?? []), eventId]);
+        }
+
+        for (const [segment, ids] of acked) {
+            if (segment !== this.active && segment.unacked.size === 0) {
+                this.removeSegment(segment);
+            } else {
+                this.enqueue({ file: this.acksPath(segment.seq), data: `${ids.join('\n')}\n` });
+            }
+        }
+    }
+
+    private async take(kind: 'parked' | 'spilled', limit: number): Promise<SyslogEvent[]> {
+        const segment = [...this.segments.values()].find((candidate) => candidate[kind].size > 0);
+        if (!segment || limit < 1) return [];
+
+        await this.flush();
+        const written = [...segment[kind]]; // Events spilled while reading may not be on disk yet
+        const events: SyslogEvent[] = [];
+        for (const event of this.parseSegment(await readFile(this.segmentPath(segment.seq), 'utf8'))) {
+            if (events.length >= limit) break;
+            if (segment[kind].delete(event.event_id)) events.push(event);
+        }
+
+        // Records that can no longer be read are given up
+        if (events.length < limit) {
+            this.ackIds(written.filter((eventId) => segment[kind].has(eventId)));
+        }
+        return events;
+    }
+
+    private rotate(seq: number): void {
+        const previous = this.active;
+        this.active = { seq, bytes: 0, unacked: new Set(), parked: new Set(), spilled: new Set() };
+        this.segments.set(seq, this.active);
+        if (previous && previous.unacked.size === 0) this.removeSegment(previous);
+    }
+
+    private removeSegment(segment: Segment): void {
+        this.segments.delete(segment.seq);
+        this.enqueue({ remove: [this.segmentPath(segment.seq), this.acksPath(segment.seq)] });
+    }
+
+    private parseSegment(content: string, recovering = false): SyslogEvent[] {
+        const events: SyslogEvent[] = [];
+        for (const line of content.split('\n')) {
+            if (!line) continue;
+            const tab = line.indexOf('\t');
+            const json = line.slice(tab + 1);
+            try {
+                if (tab !== 8 || checksum(json) !== line.slice(0, 8)) throw new Error('checksum mismatch');
+                events.push(JSON.parse(json) as SyslogEvent);
+            } catch {
+                if (recovering) this.counters.corrupt++;
+            }
+        }
+        return events;
+    }
+
+    private enqueue(op: WriteOp): void {
+        this.ops.push(op);
+        this.writing ??= this.drain();
+    }
+
+    private async drain(): Promise<void> {
+        while (this.ops.length > 0) {
+            const op = this.ops.shift()!;
+            try {
+                if ('remove' in op) {
+                    await Promise.all(op.remove.map((file) => unlink(file).catch(() => undefined)));
+                } else {
+                    // Coalesce consecutive appends to the same file
+                    let data = op.data;
+                    while (this.ops[0] && 'file' in this.ops[0] && this.ops[0].file === op.file) {
+                        data += (this.ops.shift() as { data: string }).data;
+                    }
+                    await appendFile(op.file, data);
+                    this.unsynced.add(op.file);
+                }
+            } catch (err) {
+                this.writeFailures++;
+                if (this.lastError !== (err as Error).message) {
+                    log.error(`❌ Cannot write to the write-ahead log: ${(err as Error).message}`);
+                }
+                this.lastError = (err as Error).message;
+            }
+        }
+        this.writing = null;
+    }
+
+    private segmentPath(seq: number): string {
+        return path.join(config.WAL_DIR!, `segment-${String(seq).padStart(8, '0')}.ndjson`);
+    }
+
+    private acksPath(seq: number): string {
+        return path.join(config.WAL_DIR!, `segment-${String(seq).padStart(8, '0')}.acks`);
+    }
+}
+
+function checksum(data: string): string {
+    return createHash('sha1').update(data).digest('hex').slice(0, 8);
+}
+
+export const wal = new WriteAheadLog();
@@ -0,0 +1,402 @@
+import http from 'node:http';
+import https from 'node:https';
+import type { TLSSocket } from 'node:tls';
+import { readFileSync } from 'node:fs';
+import { createHash, X509Certificate } from 'node:crypto';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { uuidv7 } from './event-id.js';
+import { log } from './logger.js';
+
+const MAX_BODY_BYTES = 10 * 1024 * 1024; // Windows sends up to MaxEnvelopeSize per batch
+const MAX_ENVELOPE_SIZE = 512000;
+
+const SUBSCRIPTION_MANAGER_PATH = '/wsman/SubscriptionManager/WEC';
+const SUBSCRIPTIONS_PATH = '/wsman/subscriptions/';
+
+const ACTION = {
+    enumerate: 'http://schemas.xmlsoap.org/ws/2004/09/enumeration/Enumerate',
+    enumerateResponse: 'http://schemas.xmlsoap.org/ws/2004/09/enumeration/EnumerateResponse',
+    subscribe: 'http://schemas.xmlsoap.org/ws/2004/08/eventing/Subscribe',
+    subscriptionEnd: 'http://schemas.xmlsoap.org/ws/2004/08/eventing/SubscriptionEnd',
+    events: 'http://schemas.dmtf.org/wbem/wsman/1/wsman/Events',
+    heartbeat: 'http://schemas.dmtf.org/wbem/wsman/1/wsman/Heartbeat',
+    ack: 'http://schemas.dmtf.org/wbem/wsman/1/wsman/Ack',
+};
+
+const NAMESPACES =
+    'xmlns:s="http://www.w3.org/2003/05/soap-envelope" ' +
+    'xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" ' +
+    'xmlns:e="http://schemas.xmlsoap.org/ws/2004/08/eventing" ' +
+    'xmlns:n="http://schemas.xmlsoap.org/ws/2004/09/enumeration" ' +
+    'xmlns:w="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd" ' +
+    'xmlns:p="http://schemas.microsoft.com/wbem/wsman/1/wsman.xsd"';
+
+export interface WefClientInfo {
+    client: string; // Certificate CN, or the peer address without TLS
+    address: string;
+    events: number;
+    last_seen: string;
+    last_heartbeat: string | null;
+}
+
+export interface WefStats {
+    subscription_id: string;
+    enumerations: number;
+    events: number;
+    heartbeats: number;
+    rejected: number; // Batches refused with 503 (buffer full) so Windows resends them
+    clients: WefClientInfo[];
+}
+
+/**
+ * Windows Event Forwarding Server (WEC-compatible)
+ *
+ * Implements the collector side of source-initiated subscriptions, so Windows
+ * hosts configured via Group Policy ("Configure target Subscription Manager"
+ * = Server=https://<collector>:5986/wsman/SubscriptionManager/WEC,Refresh=60)
+ * push events without an agent:
+ * - Enumerate: hands out the subscription (WEF_QUERY), with the last bookmark
+ *   received from that host so it resumes where it left off
+ * - Events: each rendered <Event> XML becomes one event; the batch is acked
+ *   only once buffered (503 when the buffer is full, so Windows retries)
+ * - Heartbeat / SubscriptionEnd: tracked per host
+ *
+ * Windows only allows certificate authentication over HTTPS for
+ * non-domain collectors: set WEF_TLS_CERT/WEF_TLS_KEY and WEF_TLS_CA.
+ */
+export class WefServer {
+    private server: http.Server;
+    private buffer: MessageBuffer;
+    private isRunning = false;
+    private readonly tls: boolean;
+    private readonly subscriptionId: string;
+    private readonly issuerThumbprint: string | null = null;
+
+    private bookmarks = new Map<string, string>(); // client -> last bookmark XML
+    private clients = new Map<string, WefClientInfo>();
+    private stats = { enumerations: 0, events: 0, heartbeats: 0, rejected: 0 };
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+        this.tls = Boolean(config.WEF_TLS_CERT && config.WEF_TLS_KEY);
+
+        // Stable per collector and query: changing the query is a new subscription version
+        this.subscriptionId = toUuid(createHash('sha256').update(`${config.COLLECTOR_NAME}\n${config.WEF_QUERY}`).digest('hex'));
+
+        if (this.tls) {
+            const ca = config.WEF_TLS_CA ? readFileSync(config.WEF_TLS_CA) : undefined;
+            if (ca) {
+                this.issuerThumbprint = new X509Certificate(ca).fingerprint.replace(/:/g, '');
+            }
+
+            this.server = https.createServer({
+                cert: readFileSync(config.WEF_TLS_CERT!),
+                key: readFileSync(config.WEF_TLS_KEY!),
+                ca,
+                requestCert: Boolean(ca),
+                rejectUnauthorized: Boolean(ca),
+            }, this.handleRequest.bind(this));
+        } else {
+            this.server = http.createServer(this.handleRequest.bind(this));
+        }
+
+        this.server.on('error', (err) => {
+            log.error(`❌ WEF Server Error: ${err.message}`);
+        });
+    }
+
+    private get baseUrl(): string {
+        return (config.WEF_PUBLIC_URL ?? `https://${config.COLLECTOR_NAME}:${config.WEF_PORT}`).replace(/\/$/, '');
+    }
+
+    /**
+     * Handle incoming WS-Management requests
+     */
+    private handleRequest(req: http.IncomingMessage, res: http.ServerResponse): void {
+        const path = (req.url || '/').split('?')[0] ?? '/';
+
+        if (req.method !== 'POST' || (path !== SUBSCRIPTION_MANAGER_PATH && !path.startsWith(SUBSCRIPTIONS_PATH))) {
+            res.writeHead(404);
+            res.end();
+            return;
+        }
+
+        this.readBody(req)
+            .then((body) => this.handleEnvelope(req, path, body, res))
+            .catch((err: Error) => {
+                res.writeHead(413);
+                res.end(err.message);
+            });
+    }
+
+    private handleEnvelope(req: http.IncomingMessage, path: string, body: string, res: http.ServerResponse): void {
+        const action = element(body, 'Action')?.trim();
+        const messageId = element(body, 'MessageID')?.trim() ?? '';
+        const client = this.clientName(req);
+
+        if (action === ACTION.enumerate && path === SUBSCRIPTION_MANAGER_PATH) {
+            this.stats.enumerations++;
+            this.touch(client, req);
+            this.sendEnvelope(res, this.enumerateResponse(client, messageId));
+            return;
+        }
+
+        if (!path.startsWith(`${SUBSCRIPTIONS_PATH}${this.subscriptionId}`)) {
+            // Subscription from an older query/version: Windows re-enumerates on 404
+            res.writeHead(404);
+            res.end();
+            return;
+        }
+
+        switch (action) {
+            case ACTION.events:
+                this.handleEvents(req, client, body, messageId, res);
+                return;
+
+            case ACTION.heartbeat:
+                this.stats.heartbeats++;
+                this.touch(client, req).last_heartbeat = new Date().toISOString();
+                this.sendEnvelope(res, this.ackResponse(messageId));
+                return;
+
+            case ACTION.subscriptionEnd:
+                log.info(`🪟 WEF: ${client} ended its subscription`);
+                res.writeHead(200);
+                res.end();
+                return;
+
+            default:
+                res.writeHead(400);
+                res.end();
+        }
+    }
+
+    private handleEvents(req: http.IncomingMessage, client: string, body: string, messageId: string, res: http.ServerResponse): void {
+        const events = extractEvents(body);
+
+        // Backpressure: without an ack Windows keeps the batch and resends it
+        if (this.buffer.available < events.length) {
+            this.stats.rejected++;
+            res.writeHead(503);
+            res.end();
+            return;
+        }
+
+        const address = req.socket.remoteAddress || 'unknown';
+        for (const xml of events) {
+            ingestEvent(this.buffer, createSyslogEvent(xml, { address, port: req.socket.remotePort }, 'wef'));
+        }
+
+        const bookmark = element(body, 'Bookmark');
+        if (bookmark) {
+            this.bookmarks.set(client, bookmark);
+        }
+
+        const info = this.touch(client, req);
+        info.events += events.length;
+        this.stats.events += events.length;
+
+        this.sendEnvelope(res, this.ackResponse(messageId));
+    }
+
+    /**
+     * The subscription handed to a Windows host (one per collector)
+     */
+    private enumerateResponse(client: string, relatesTo: string): string {
+        const notifyTo = `${this.baseUrl}${SUBSCRIPTIONS_PATH}${this.subscriptionId}`;
+        const bookmark = this.bookmarks.get(client);
+        const auth = this.issuerThumbprint
+            ? '<c:Policy xmlns:c="http://schemas.xmlsoap.org/ws/2002/12/policy" xmlns:auth="http://schemas.microsoft.com/wbem/wsman/1/authentication">' +
+              '<c:ExactlyOne><c:All><auth:Authentication Profile="http://schemas.dmtf.org/wbem/wsman/1/wsman/secprofile/https/mutual">' +
+              `<auth:ClientCertificate><auth:Thumbprint Role="issuer">${this.issuerThumbprint}</auth:Thumbprint></auth:ClientCertificate>` +
+              '</auth:Authentication></c:All></c:ExactlyOne></c:Policy>'
+            : '';
+
+        const subscribe =
+            '<s:Envelope><s:Header>' +
+            `<a:Action>${ACTION.subscribe}</a:Action>` +
+            `<a:To>${this.baseUrl}${SUBSCRIPTION_MANAGER_PATH}</a:To>` +
+            '<w:ResourceURI s:mustUnderstand="true">http://schemas.microsoft.com/wbem/wsman/1/windows/EventLog</w:ResourceURI>' +
+            '<a:ReplyTo><a:Address s:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address></a:ReplyTo>' +
+            `<w:MaxEnvelopeSize s:mustUnderstand="true">${MAX_ENVELOPE_SIZE}</w:MaxEnvelopeSize>` +
+            `<a:MessageID>uuid:${uuidv7()}</a:MessageID>` +
+            '<w:OptionSet xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">' +
+            '<w:Option Name="CDATA" xsi:nil="true"/>' +
+            '<w:Option Name="IgnoreChannelError" xsi:nil="true"/>' +
+            (config.WEF_READ_EXISTING && !bookmark ? '<w:Option Name="ReadExistingEvents" xsi:nil="true"/>' : '') +
+            '</w:OptionSet>' +
+            '<w:OperationTimeout>PT60.000S</w:OperationTimeout>' +
+            '</s:Header><s:Body><e:Subscribe>' +
+            `<e:EndTo><a:Address>${notifyTo}</a:Address></e:EndTo>` +
+            '<e:Delivery Mode="http://schemas.dmtf.org/wbem/wsman/1/wsman/Events">' +
+            `<w:Heartbeats>${duration(config.WEF_HEARTBEAT_INTERVAL_MS)}</w:Heartbeats>` +
+            `<e:NotifyTo><a:Address>${notifyTo}</a:Address>${auth}</e:NotifyTo>` +
+            '<w:ConnectionRetry Total="5">PT60.0S</w:ConnectionRetry>' +
+            `<w:MaxTime>${duration(config.WEF_MAX_LATENCY_MS)}</w:MaxTime>` +
+            `<w:MaxEnvelopeSize Policy="Notify">${MAX_ENVELOPE_SIZE}</w:MaxEnvelopeSize>` +
+            '<w:Locale xml:lang="en-US" s:mustUnderstand="false"/>' +
+            '<w:ContentEncoding>UTF-16</w:ContentEncoding>' +
+            '</e:Delivery>' +
+            `<w:Filter Dialect="http://schemas.microsoft.com/win/2004/08/events/eventquery">${config.WEF_QUERY}</w:Filter>` +
+            (bookmark ? `<w:Bookmark>${bookmark}</w:Bookmark>` : '') +
+            '<w:SendBookmarks/>' +
+            '</e:Subscribe></s:Body></s:Envelope>';
+
+        return `<s:Envelope ${NAMESPACES}><s:Header>` +
+            `<a:Action>${ACTION.enumerateResponse}</a:Action>` +
+            `<a:MessageID>uuid:${uuidv7()}</a:MessageID>` +
+            '<a:To>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:To>' +
+            `<a:RelatesTo>${relatesTo}</a:RelatesTo>` +
+            '</s:Header><s:Body><n:EnumerateResponse><n:EnumerationContext/><w:Items>' +
+            '<m:Subscription xmlns:m="http://schemas.microsoft.com/wbem/wsman/1/subscription">' +
+            `<m:Version>uuid:${this.subscriptionId}</m:Version>${subscribe}</m:Subscription>` +
+            '</w:Items><w:EndOfSequence/></n:EnumerateResponse></s:Body></s:Envelope>';
+    }
+
+    private ackResponse(relatesTo: string): string {
+        return `<s:Envelope ${NAMESPACES}><s:Header>` +
+            `<a:Action>${ACTION.ack}</a:Action>` +
+            `<a:MessageID>uuid:${uuidv7()}</a:MessageID>` +
+            '<a:To>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:To>' +
+            `<a:RelatesTo>${relatesTo}</a:RelatesTo>` +
+            '</s:Header><s:Body/></s:Envelope>';
+    }
+
+    private sendEnvelope(res: http.ServerResponse, xml: string): void {
+        res.writeHead(200, { 'Content-Type': 'application/soap+xml;charset=UTF-8' });
+        res.end(xml);
+    }
+
+    /**
+     * Windows hosts are identified by their certificate CN (hostname)
+     */
+    private clientName(req: http.IncomingMessage): string {
+        if (this.tls) {
+            const cn = (req.socket as TLSSocket).getPeerCertificate?.()?.subject?.CN;
+            if (typeof cn === 'string' && cn.length > 0) return cn;
+        }
+        return req.socket.remoteAddress || 'unknown';
+    }
+
+    private touch(client: string, req: http.IncomingMessage): WefClientInfo {
+        let info = this.clients.get(client);
+        if (!info) {
+            info = { client, address: req.socket.remoteAddress || 'unknown', events: 0, last_seen: '', last_heartbeat: null };
+            this.clients.set(client, info);
+            log.info(`🪟 WEF: ${client} subscribed`);
+        }
+        info.last_seen = new Date().toISOString();
+        return info;
+    }
+
+    private readBody(req: http.IncomingMessage): Promise<string> {
+        return new Promise((resolve, reject) => {
+            const chunks: Buffer[] = [];
+            let size = 0;
+
+            req.on('data', (chunk: Buffer) => {
+                size += chunk.length;
+                if (size > MAX_BODY_BYTES) {
+                    reject(new Error('Payload too large'));
+                    req.destroy();
+                    return;
+                }
+                chunks.push(chunk);
+            });
+            req.on('end', () => resolve(decodeBody(Buffer.concat(chunks), req.headers['content-type'])));
+            req.on('error', reject);
+        });
+    }
+
+    public getStats(): WefStats {
+        return {
+            subscription_id: this.subscriptionId,
+            ...this.stats,
+            clients: [...this.clients.values()],
+        };
+    }
+
+    /**
+     * Start the WEF server
+     */
+    public start(): Promise<void> {
+        return new Promise((resolve, reject) => {
+            this.server.listen(config.WEF_PORT, config.WEF_BIND_ADDRESS, () => {
+                this.isRunning = true;
+                const scheme = this.tls ? 'https' : 'http';
+                log.info(`🪟 WEF subscription manager on ${scheme}://${config.WEF_BIND_ADDRESS}:${config.WEF_PORT}${SUBSCRIPTION_MANAGER_PATH}`);
+                if (!this.tls) {
+                    log.warn('⚠️ WEF listener is plain HTTP: Windows requires HTTPS for certificate auth (terminate TLS in front or set WEF_TLS_CERT/WEF_TLS_KEY)');
+                }
+                resolve();
+            });
+
+            this.server.once('error', (err) => {
+                reject(err);
+            });
+        });
+    }
+
+    /**
+     * Stop the WEF server
+     */
+    public stop(): Promise<void> {
+        return new Promise((resolve) => {
+            if (!this.isRunning) {
+                resolve();
+                return;
+            }
+
+            this.server.close(() => {
+                this.isRunning = false;
+                log.info('   WEF server stopped.');
+                resolve();
+            });
+            this.server.closeAllConnections();
+        });
+    }
+}
+
+/**
+ * Windows sends UTF-16 envelopes (per the subscription's ContentEncoding)
+ */
+function decodeBody(body: Buffer, contentType: string | undefined): string {
+    const utf16 = /charset\s*=\s*"?utf-16/i.test(contentType ?? '') || (body[0] === 0xff && body[1] === 0xfe);
+    const text = utf16 ? body.toString('utf16le') : body.toString('utf8');
+    return text.replace(/^\uFEFF/, '');
+}
+
+/**
+ * Text content of the first element with this local name (any prefix)
+ */
+function element(xml: string, name: string): string | null {
+    const match = new RegExp(`<(?:[\\w-]+:)?${name}\\b[^>]*>([\\s\\S]*?)</(?:[\\w-]+:)?${name}>`).exec(xml);
+    return match ? match[1]! : null;
+}
+
+/**
+ * Rendered <Event> documents in an Events envelope (<w:Event> items, CDATA or inline)
+ */
+function extractEvents(xml: string): string[] {
+    const prefix = /<([\w-]+:)Events\b/.exec(xml)?.[1];
+    if (!prefix) return [];
+
+    const events: string[] = [];
+    const item = new RegExp(`<${prefix}Event\\b[^>]*>([\\s\\S]*?)</${prefix}Event>`, 'g');
+    for (const [, content] of xml.matchAll(item)) {
+        const event = content!.trim().replace(/^<!\[CDATA\[([\s\S]*)\]\]>$/, '$1').trim();
+        if (event.length > 0) events.push(event);
+    }
+    return events;
+}
+
+function duration(ms: number): string {
+    return `PT${(ms / 1000).toFixed(3)}S`;
+}
+
+function toUuid(hex: string): string {
+    return `${hex.slice(0, 8)}-${hex.slice(8, 12)}-${hex.slice(12, 16)}-${hex.slice(16, 20)}-${hex.slice(20, 32)}`.toUpperCase();
+}
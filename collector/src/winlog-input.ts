@@ -0,0 +1,232 @@
+import { execFile } from 'node:child_process';
+import { readFile, writeFile, rename } from 'node:fs/promises';
+import { promisify } from 'node:util';
+import { config } from './config.js';
+import type { MessageBuffer } from './buffer.js';
+import { createSyslogEvent } from './events.js';
+import { ingestEvent } from './pipeline.js';
+import { windowsEventToJson } from './parsers/windows-event.js';
+import { log } from './logger.js';
+
+const execFileAsync = promisify(execFile);
+
+const WEVTUTIL_TIMEOUT_MS = 60000;
+const WEVTUTIL_MAX_OUTPUT_BYTES = 64 * 1024 * 1024;
+const EVENT_ELEMENT = /<Event[\s>][\s\S]*?<\/Event>/g;
+const RECORD_ID = /<EventRecordID>(\d+)</;
+
+export interface WinlogChannelStats {
+    events: number;
+    last_record_id: number | null;
+    last_error: string | null;
+}
+
+export interface WinlogInputStats {
+    running: boolean;
+    channels: Record<string, WinlogChannelStats>;
+    unparsed: number; // Records that weren't valid event XML (sent as received)
+}
+
+/**
+ * Windows Event Log Input
+ *
+ * On a collector running on Windows (as a service: `collector service install`),
+ * reads the WINLOG_CHANNELS event logs directly, so a branch office server
+ * needs no separate agent or event forwarding. Every WINLOG_POLL_INTERVAL_MS
+ * the records after the last one sent are read per channel (wevtutil, oldest
+ * first, WINLOG_BATCH_SIZE at most), converted from event XML to JSON (see
+ * parsers/windows-event.ts) and sent as the collector's own host.
+ *
+ * The last record ID per channel is kept in WINLOG_STATE_FILE, so restarts
+ * resume where they stopped. Without a saved position a channel starts at
+ * its newest record, or at its oldest with WINLOG_READ_EXISTING. A channel
+ * that was cleared (its newest ID is below the saved one) starts over.
+ * Reading the Security log needs administrator rights (the service account,
+ * LocalSystem, has them).
+ */
+export class WinlogInput {
+    private buffer: MessageBuffer;
+    private positions = new Map<string, number>(); // Channel -> last record ID sent
+    private stats = new Map<string, WinlogChannelStats>();
+    private unparsed = 0;
+    private timer: NodeJS.Timeout | null = null;
+    private polling: Promise<void> | null = null;
+    private isRunning = false;
+    private dirty = false;
+
+    constructor(buffer: MessageBuffer) {
+        this.buffer = buffer;
+        for (const channel of config.WINLOG_CHANNELS) {
+            this.stats.set(channel, { events: 0, last_record_id: null, last_error: null });
+        }
+    }
+
+    public async start(): Promise<void> {
+        const saved = await this.restoreState();
+        for (const channel of config.WINLOG_CHANNELS) {
+            const stats = this.stats.get(channel)!;
+            try {
+                const newest = await this.newestRecordId(channel);
+                const position = saved[channel];
+                if (position !== undefined && position <= newest) {
+                    this.positions.set(channel, position);
+                } else {
+                    if (position !== undefined) log.warn(`⚠️ Event log ${channel} was cleared, reading it from the start`);
+                    this.positions.set(channel, position !== undefined || config.WINLOG_READ_EXISTING ? 0 : newest);
+                }
+                stats.last_record_id = this.positions.get(channel)!;
+            } catch (err) {
+                // Other channels still work; this one is retried every poll
+                stats.last_error = (err as Error).message;
+                log.error(`❌ Cannot open event log ${channel}: ${stats.last_error}`);
+            }
+        }
+
+        this.isRunning = true;
+        log.info(`🪟 Windows Event Log: ${config.WINLOG_CHANNELS.join(', ')}` +
+            (Object.keys(saved).length > 0 ? ' (resuming)' : config.WINLOG_READ_EXISTING ? ' (with existing events)' : ''));
+        this.schedule(0);
+    }
+
+    public async stop(): Promise<void> {
+        this.isRunning = false;
+        if (this.timer) {
+            clearTimeout(this.timer);
+            this.timer = null;
+        }
+        await this.polling;
+        await this.saveState();
+        log.info('   Windows Event Log input stopped.');
+    }
+
+    public getStats(): WinlogInputStats {
+        return {
+            running: this.isRunning,
+            channels: Object.fromEntries(this.stats),
+            unparsed: this.unparsed,
+        };
+    }
+
+    private schedule(delayMs: number): void {
+        this.timer = setTimeout(() => {
+            this.polling = this.poll().finally(() => {
+                this.polling = null;
+                if (this.isRunning) this.schedule(config.WINLOG_POLL_INTERVAL_MS);
+            });
+        }, delayMs);
+    }
+
+    private async poll(): Promise<void> {
+        for (const channel of config.WINLOG_CHANNELS) {
+            if (!this.isRunning) break;
+
+            const stats = this.stats.get(channel)!;
+            try {
+                // A channel that couldn't be opened at startup starts at its newest record once it can
+                if (!this.positions.has(channel)) {
+                    this.positions.set(channel, config.WINLOG_READ_EXISTING ? 0 : await this.newestRecordId(channel));
+                }
+                // Leave room in the buffer; the rest is read next poll
+                while (this.isRunning && this.buffer.available >= config.WINLOG_BATCH_SIZE) {
+                    const read = await this.readChannel(channel, stats);
+                    if (read < config.WINLOG_BATCH_SIZE) break;
+                }
+                stats.last_error = null;
+            } catch (err) {
+                if (stats.last_error === null) log.error(`❌ Reading event log ${channel} failed: ${(err as Error).message}`);
+                stats.last_error = (err as Error).message;
+            }
+        }
+        await this.saveState();
+    }
+
+    /**
+     * Send the next batch of records of a channel; returns how many were read
+     */
+    private async readChannel(channel: string, stats: WinlogChannelStats): Promise<number> {
+        const after = this.positions.get(channel)!;
+        const xml = await this.wevtutil([
+            'qe', channel,
+            `/q:*[System[EventRecordID>${after}]]`,
+            `/c:${config.WINLOG_BATCH_SIZE}`,
+            '/rd:false',
+            `/f:${config.WINLOG_RENDER_MESSAGES ? 'RenderedXml' : 'xml'}`,
+        ]);
+
+        const records = xml.match(EVENT_ELEMENT) ?? [];
+        for (const record of records) {
+            let raw = record;
+            let recordId: number | undefined;
+            try {
+                const event = windowsEventToJson(record);
+                raw = JSON.stringify(event);
+                recordId = event.record_id;
+            } catch {
+                // Sent as received; the position still moves past it
+                this.unparsed++;
+                const id = RECORD_ID.exec(record)?.[1];
+                recordId = id === undefined ? undefined : Number(id);
+            }
+
+            const event = createSyslogEvent(raw, { address: '127.0.0.1' }, 'winlog');
+            event.tags = { winlog_channel: channel, ...(recordId !== undefined ? { winlog_record_id: String(recordId) } : {}) };
+            ingestEvent(this.buffer, event, { skipSourcePolicy: true });
+            stats.events++;
+
+            if (recordId !== undefined && recordId > this.positions.get(channel)!) {
+                this.positions.set(channel, recordId);
+                stats.last_record_id = recordId;
+                this.dirty = true;
+            }
+        }
+        return records.length;
+    }
+
+    // 0 for an empty channel
+    private async newestRecordId(channel: string): Promise<number> {
+        const xml = await this.wevtutil(['qe', channel, '/c:1', '/rd:true', '/f:xml']);
+        const record = xml.match(EVENT_ELEMENT)?.[0];
+        return record ? windowsEventToJson(record).record_id ?? 0 : 0;
+    }
+
+    private async wevtutil(args: string[]): Promise<string> {
+        try {
+            const { stdout } = await execFileAsync('wevtutil', args, {
+                timeout: WEVTUTIL_TIMEOUT_MS,
+                maxBuffer: WEVTUTIL_MAX_OUTPUT_BYTES,
+                windowsHide: true,
+            });
+            return stdout;
+        } catch (err) {
+            const stderr = String((err as { stderr?: unknown }).stderr ?? '').trim();
+            throw new Error(stderr || (err as Error).message);
+        }
+    }
+
+    private async restoreState(): Promise<Record<string, number>> {
+        if (!config.WINLOG_STATE_FILE) return {};
+
+        try {
+            const state = JSON.parse(await readFile(config.WINLOG_STATE_FILE, 'utf8')) as { channels?: Record<string, number> };
+            return Object.fromEntries(Object.entries(state.channels ?? {}).filter(([, id]) => Number.isInteger(id)));
+        } catch (err) {
+            if ((err as NodeJS.ErrnoException).code !== 'ENOENT') {
+                log.warn(`⚠️ Ignoring unreadable event log state ${config.WINLOG_STATE_FILE}: ${(err as Error).message}`);
+            }
+            return {};
+        }
+    }
+
+    private async saveState(): Promise<void> {
+        if (!config.WINLOG_STATE_FILE || !this.dirty) return;
+
+        try {
+            const tmp = `${config.WINLOG_STATE_FILE}.tmp`;
+            await writeFile(tmp, JSON.stringify({ channels: Object.fromEntries(this.positions) }));
+            await rename(tmp, config.WINLOG_STATE_FILE);
+            this.dirty = false;
+        } catch (err) {
+            log.warn(`⚠️ Cannot save event log state: ${(err as Error).message}`);
+        }
+    }
+}
@@ -0,0 +1,39 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+
+// Nothing configured: the library must import without reading the configuration
+delete process.env.CENTINELA_API_KEY;
+delete process.env.CENTINELA_API_KEY_FILE;
+delete process.env.CONFIG_FILE;
+const lib = await import('../src/lib.js');
+
+test('parseRfc5424 needs no configuration', () => {
+  const parsed = lib.parseRfc5424('<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3"] An application event');
+  assert.ok(parsed);
+  assert.equal(parsed.facility, 20);
+  assert.equal(parsed.severity, 5);
+  assert.equal(parsed.hostname, 'mymachine.example.com');
+  assert.equal(parsed.app_name, 'evntslog');
+  assert.deepEqual(parsed.structured_data, { 'exampleSDID@32473': { iut: '3' } });
+  assert.equal(parsed.message, 'An application event');
+});
+
+test('loadConfig throws ConfigError instead of exiting, then loads once fixed', () => {
+  assert.throws(() => lib.loadConfig(), lib.ConfigError);
+
+  process.env.CENTINELA_API_KEY = 'test-key';
+  process.env.COLLECTOR_NAME = 'lib-test';
+  const config = lib.loadConfig();
+  assert.equal(config.COLLECTOR_NAME, 'lib-test');
+  assert.equal(lib.config, config);
+});
+
+test('events are built and serialized with the loaded configuration', () => {
+  const event = lib.createSyslogEvent('<13>Oct 11 22:14:15 host app: hello', { address: '::ffff:192.0.2.10', port: 5140 }, 'udp');
+  const record = lib.buildIngestPayload(event);
+  assert.equal(record.source_ip, '192.0.2.10');
+  assert.equal(record.source_port, 5140);
+  assert.equal(record.transport, 'udp');
+  assert.equal(record.collector_name, 'lib-test');
+  assert.match(record.event_id, /^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-/);
+});
@@ -0,0 +1,106 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { parseRfc3164, type Rfc3164Options } from '../src/parsers/rfc3164.js';
+import { parseRfc5424 } from '../src/parsers/rfc5424.js';
+
+const options: Rfc3164Options = { timezone: 'UTC', receivedAt: new Date('2026-10-11T22:14:20Z'), yearRollover: 'auto' };
+
+test('parseRfc3164 reads the BSD header', () => {
+  assert.deepEqual(parseRfc3164('<34>Oct 11 22:14:15 mymachine su[230]: \'su root\' failed for lonvick on /dev/pts/8', options), {
+    format: 'rfc3164',
+    pri: 34,
+    facility: 4,
+    severity: 2,
+    timestamp: '2026-10-11T22:14:15.000Z',
+    raw_timestamp: 'Oct 11 22:14:15',
+    hostname: 'mymachine',
+    tag: 'su',
+    procid: '230',
+    message: '\'su root\' failed for lonvick on /dev/pts/8',
+  });
+});
+
+test('parseRfc3164 resolves the year and time zone it lacks', () => {
+  // Logged on Dec 31 in Madrid, received on Jan 1: last year, an hour behind UTC
+  const parsed = parseRfc3164('<13>Dec 31 23:59:58 host app: late', {
+    timezone: 'Europe/Madrid', receivedAt: new Date('2027-01-01T00:00:05Z'), yearRollover: 'auto',
+  });
+  assert.equal(parsed?.timestamp, '2026-12-31T22:59:58.000Z');
+
+  const current = parseRfc3164('<13>Dec 31 23:59:58 host app: late', {
+    timezone: 'UTC', receivedAt: new Date('2027-01-01T00:00:05Z'), yearRollover: 'current',
+  });
+  assert.equal(current?.timestamp, '2027-12-31T23:59:58.000Z');
+});
+
+test('parseRfc3164 accepts vendor timestamps', () => {
+  const cisco = parseRfc3164('<189>*Oct  1 2023 22:14:15.123: %SYS-5-CONFIG_I: Configured from console', options);
+  assert.equal(cisco?.timestamp, '2023-10-01T22:14:15.123Z');
+  assert.equal(cisco?.raw_timestamp, '*Oct  1 2023 22:14:15.123');
+
+  const rsyslog = parseRfc3164('<30>2026-10-11T22:14:15.5+02:00 host sshd[99]: Accepted publickey', options);
+  assert.equal(rsyslog?.timestamp, '2026-10-11T20:14:15.500Z');
+  assert.equal(rsyslog?.hostname, 'host');
+  assert.equal(rsyslog?.tag, 'sshd');
+});
+
+test('parseRfc3164 without a hostname takes the tag after the timestamp', () => {
+  const parsed = parseRfc3164('<13>Oct 11 22:14:15 kernel: eth0 link up', options);
+  assert.equal(parsed?.hostname, undefined);
+  assert.equal(parsed?.tag, 'kernel');
+  assert.equal(parsed?.message, 'eth0 link up');
+});
+
+test('parseRfc3164 takes no hostname longer than 255 characters', () => {
+  const long = 'h'.repeat(256);
+  const parsed = parseRfc3164(`<13>Oct 11 22:14:15 ${long} app: message`, options);
+  assert.equal(parsed?.hostname, undefined);
+  assert.equal(parsed?.tag, undefined);
+  assert.equal(parsed?.message, `${long} app: message`);
+
+  const longest = 'h'.repeat(255);
+  assert.equal(parseRfc3164(`<13>Oct 11 22:14:15 ${longest} app: message`, options)?.hostname, longest);
+});
+
+test('parseRfc3164 keeps a message without a valid timestamp whole', () => {
+  const parsed = parseRfc3164('<13>Foo 11 22:14:15 host app: message', options);
+  assert.equal(parsed?.timestamp, undefined);
+  assert.equal(parsed?.hostname, undefined);
+  assert.equal(parsed?.message, 'Foo 11 22:14:15 host app: message');
+});
+
+test('parseRfc3164 needs a valid PRI', () => {
+  assert.equal(parseRfc3164('Oct 11 22:14:15 host app: message', options), null);
+  assert.equal(parseRfc3164('<192>Oct 11 22:14:15 host app: message', options), null);
+});
+
+test('parseRfc5424 reads the header and structured data', () => {
+  assert.deepEqual(parseRfc5424('<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - [exampleSDID@32473 iut="3" eventSource="Application"][examplePriority@32473 class="high"] ﻿%% It\'s time to make the do-nuts.'), {
+    format: 'rfc5424',
+    pri: 165,
+    facility: 20,
+    severity: 5,
+    version: 1,
+    timestamp: '2003-08-24T05:14:15.000003-07:00',
+    hostname: '192.0.2.1',
+    app_name: 'myproc',
+    procid: '8710',
+    structured_data: {
+      'exampleSDID@32473': { iut: '3', eventSource: 'Application' },
+      'examplePriority@32473': { class: 'high' },
+    },
+    message: '%% It\'s time to make the do-nuts.',
+  });
+});
+
+test('parseRfc5424 leaves NILVALUE fields out', () => {
+  assert.deepEqual(parseRfc5424('<13>1 - - - - - -'), { format: 'rfc5424', pri: 13, facility: 1, severity: 5, version: 1 });
+});
+
+test('parseRfc5424 refuses what is not RFC 5424', () => {
+  assert.equal(parseRfc5424('<34>Oct 11 22:14:15 mymachine su: failed'), null); // RFC 3164
+  assert.equal(parseRfc5424('<13>1 2003-10-11 host app - - - message'), null); // No time
+  assert.equal(parseRfc5424(`<13>1 - ${'h'.repeat(256)} app - - - message`), null); // Hostname too long
+  assert.equal(parseRfc5424('<13>1 - host app - - [unterminated message'), null);
+  assert.equal(parseRfc5424('<013>1 - host app - - - message'), null); // PRI with a leading zero
+});
@@ -0,0 +1,92 @@
+import { test, after } from 'node:test';
+import assert from 'node:assert/strict';
+import { createConnection, createServer, type AddressInfo } from 'node:net';
+import { setTimeout as sleep } from 'node:timers/promises';
+
+// A port free right now for the server under test
+const probe = createServer();
+await new Promise<void>((resolve) => probe.listen(0, '127.0.0.1', resolve));
+const port = (probe.address() as AddressInfo).port;
+await new Promise((resolve) => probe.close(resolve));
+
+process.env.CENTINELA_API_KEY = 'test-key';
+process.env.COLLECTOR_NAME = 'tcp-framing-test';
+process.env.TCP_PORT = String(port);
+process.env.TCP_BIND_ADDRESS = '127.0.0.1';
+process.env.TCP_FRAMING = 'auto';
+process.env.MAX_MESSAGE_BYTES = '480';
+process.env.MAX_MESSAGE_PARTS = '2';
+
+const lib = await import('../src/lib.js');
+lib.loadConfig();
+const buffer = new lib.MessageBuffer();
+const server = new lib.TcpServer(buffer);
+await server.start();
+after(() => server.stop());
+
+const frame = (message: string) => `${Buffer.byteLength(message)} ${message}`;
+
+async function connect() {
+  const socket = createConnection(port, '127.0.0.1');
+  await new Promise((resolve) => socket.once('connect', resolve));
+  return socket;
+}
+
+// Wait until the buffer holds the expected events (or 2 s)
+async function received(expected: number) {
+  for (let waited = 0; buffer.size < expected && waited < 2000; waited += 10) await sleep(10);
+  return buffer.popAll();
+}
+
+// Write the chunks one by one (separate packets), then wait for the events
+async function send(chunks: string[], expected: number) {
+  const socket = await connect();
+  for (const chunk of chunks) {
+    socket.write(chunk);
+    await sleep(10);
+  }
+  const events = await received(expected);
+  socket.end();
+  await new Promise((resolve) => socket.once('close', resolve));
+  return events;
+}
+
+const messages = async (chunks: string[], expected: number) => (await send(chunks, expected)).map((event) => event.raw_message);
+
+test('octet-counted frames, with a header and message split across packets', async () => {
+  const first = '<13>Oct 11 22:14:15 host app: first';
+  const second = '<13>Oct 11 22:14:15 host app: second\nline';
+  const stream = frame(first) + frame(second);
+  const cut = frame(first).length + 1; // Inside the second header
+  assert.deepEqual(await messages([stream.slice(0, cut), stream.slice(cut, cut + 10), stream.slice(cut + 10)], 2), [first, second]);
+});
+
+test('LF-delimited messages, with NUL padding and keepalives', async () => {
+  assert.deepEqual(
+    await messages(['<13>Oct 11 22:14:15 host app: one\n\n', '<13>Oct 11 22:14:15 host app: two\0\0\n', '\0<13>Oct 11 22:14:15 host app: th', 'ree\n'], 3),
+    ['<13>Oct 11 22:14:15 host app: one', '<13>Oct 11 22:14:15 host app: two', '<13>Oct 11 22:14:15 host app: three'],
+  );
+});
+
+test('a frame longer than the message limit is truncated and framing resumes after it', async () => {
+  // Its tail looks like frames, none of which may be taken for one
+  const oversized = '<13>Oct 11 22:14:15 host app: ' + 'x'.repeat(1000) + frame('<13>Oct 11 22:14:15 host app: fake').repeat(40);
+  const next = '<13>Oct 11 22:14:15 host app: next';
+  const bytes = Buffer.from(frame(oversized) + frame(next));
+
+  // The parts kept are sent without waiting for the rest of the frame
+  const socket = await connect();
+  socket.write(bytes.subarray(0, 700));
+  await sleep(10);
+  socket.write(bytes.subarray(700, 1500));
+  const parts = await received(2);
+  assert.equal(parts.length, 2);
+  // MAX_MESSAGE_BYTES * MAX_MESSAGE_PARTS kept, in two parts marked truncated
+  assert.equal(parts[0]!.raw_message + parts[1]!.raw_message, oversized.slice(0, 960));
+  assert.equal(parts[0]!.continuation?.truncated, true);
+  assert.equal(parts[1]!.continuation?.index, 1);
+
+  socket.end(bytes.subarray(1500));
+  await new Promise((resolve) => socket.once('close', resolve));
+  assert.deepEqual((await received(1)).map((event) => event.raw_message), [next]);
+});
@@ -0,0 +1,98 @@
+import { test, after } from 'node:test';
+import assert from 'node:assert/strict';
+import { createServer, type IncomingMessage } from 'node:http';
+import type { AddressInfo } from 'node:net';
+import { gunzipSync } from 'node:zlib';
+
+interface Received {
+  url: string;
+  headers: IncomingMessage['headers'];
+  body: Buffer;
+}
+
+// Stand-in backend: records the requests, answers with the next queued response
+const received: Received[] = [];
+const responses: Array<{ status: number; body: unknown }> = [];
+const server = createServer((req, res) => {
+  const chunks: Buffer[] = [];
+  req.on('data', (chunk: Buffer) => chunks.push(chunk));
+  req.on('end', () => {
+    received.push({ url: req.url ?? '', headers: req.headers, body: Buffer.concat(chunks) });
+    const response = responses.shift() ?? { status: 202, body: { ok: true } };
+    res.writeHead(response.status, { 'Content-Type': 'application/json' });
+    res.end(JSON.stringify(response.body));
+  });
+});
+await new Promise<void>((resolve) => server.listen(0, '127.0.0.1', resolve));
+after(() => server.close());
+
+process.env.CENTINELA_API_URL = `http://127.0.0.1:${(server.address() as AddressInfo).port}/v1/ingest/syslog`;
+process.env.CENTINELA_API_KEY = 'test-key';
+process.env.COLLECTOR_NAME = 'transport-test';
+process.env.BATCH_COMPRESSION = 'gzip';
+
+const lib = await import('../src/lib.js');
+lib.loadConfig();
+const transport = new lib.HttpTransport();
+after(() => transport.close());
+
+const events = (count: number) => Array.from({ length: count }, (_, i) => {
+  const event = lib.createSyslogEvent(`<13>Oct 11 22:14:15 host app: event ${i}`, { address: '192.0.2.10', port: 514 }, 'udp');
+  lib.parseSyslogFields(event);
+  return event;
+});
+
+function decode(request: Received): { events: Array<{ raw_message: string; event_id: string; syslog?: Record<string, unknown> }> } {
+  const body = request.headers['content-encoding'] === 'gzip' ? gunzipSync(request.body) : request.body;
+  return JSON.parse(body.toString('utf8'));
+}
+
+test('sendBatch posts the batch to the bulk endpoint, compressed', async () => {
+  received.length = 0;
+  const batch = events(3);
+  await transport.sendBatch(batch);
+
+  assert.equal(received.length, 1);
+  const [request] = received;
+  assert.equal(request!.url, '/v1/ingest/syslog/bulk');
+  assert.equal(request!.headers.authorization, 'Bearer test-key');
+  assert.equal(request!.headers['content-encoding'], 'gzip');
+  const body = decode(request!);
+  assert.deepEqual(body.events.map((event) => event.raw_message), batch.map((event) => event.raw_message));
+  assert.deepEqual(body.events.map((event) => event.event_id), batch.map((event) => event.event_id));
+  // Parsed header without the message, which is already in raw_message
+  assert.deepEqual(body.events.map((event) => [event.syslog?.hostname, event.syslog?.tag, 'message' in event.syslog!]),
+    batch.map(() => ['host', 'app', false]));
+  assert.equal(transport.isCircuitOpen(), false);
+  assert.deepEqual(transport.getRetryStats(), { pending: 0, dlq: 0 });
+});
+
+test('events rejected in the bulk response are dead-lettered, retryable ones retried', async () => {
+  received.length = 0;
+  responses.push({
+    status: 202,
+    body: { ok: true, rejected: [{ index: 0, reason: 'raw_message: too long', retryable: false }, { index: 2, reason: 'enqueue failed', retryable: true }] },
+  });
+  await transport.sendBatch(events(3));
+
+  assert.equal(received.length, 1);
+  assert.deepEqual(transport.getRetryStats(), { pending: 1, dlq: 1 });
+});
+
+test('a batch too large for the backend is sent again in halves, an event too large alone dead-lettered', async () => {
+  received.length = 0;
+  const before = transport.getRetryStats().dlq;
+  responses.push(
+    { status: 413, body: { ok: false, error: 'FST_ERR_CTP_BODY_TOO_LARGE' } }, // 4 events
+    { status: 413, body: { ok: false, error: 'FST_ERR_CTP_BODY_TOO_LARGE' } }, // first 2
+    { status: 413, body: { ok: false, error: 'FST_ERR_CTP_BODY_TOO_LARGE' } }, // event 0 alone
+  );
+  const batch = events(4);
+  await transport.sendBatch(batch);
+
+  // 4 -> 2 + 2 -> (1 + 1) + 2
+  assert.deepEqual(received.map((request) => decode(request).events.length), [4, 2, 1, 1, 2]);
+  assert.deepEqual(received.slice(3).flatMap((request) => decode(request).events.map((event) => event.event_id)),
+    batch.slice(1).map((event) => event.event_id));
+  assert.equal(transport.getRetryStats().dlq, before + 1);
+});
@@ -0,0 +1,72 @@
+import { test, after } from 'node:test';
+import assert from 'node:assert/strict';
+import { appendFile, mkdtemp, readdir, rm } from 'node:fs/promises';
+import { tmpdir } from 'node:os';
+import path from 'node:path';
+
+const dir = await mkdtemp(path.join(tmpdir(), 'centinela-wal-'));
+after(() => rm(dir, { recursive: true, force: true }));
+
+process.env.CENTINELA_API_KEY = 'test-key';
+process.env.COLLECTOR_NAME = 'wal-test';
+process.env.WAL_DIR = dir;
+
+const lib = await import('../src/lib.js');
+const { WriteAheadLog } = await import('../src/wal.js');
+lib.loadConfig();
+
+const events = (from: number, count: number) => Array.from({ length: count }, (_, i) =>
+  lib.createSyslogEvent(`<13>Oct 11 22:14:15 host app: event ${from + i}`, { address: '192.0.2.10', port: 514 }, 'udp'));
+
+const messages = (list: Array<{ raw_message: string }>) => list.map((event) => event.raw_message);
+
+test('unacknowledged events are replayed after a restart, torn records skipped', async () => {
+  const before = new WriteAheadLog();
+  await before.open();
+  const written = events(0, 4);
+  for (const event of written) assert.equal(before.append(event), true);
+  before.ack([written[1]!]);
+  await before.sync();
+
+  // A crash in the middle of a write
+  const [segment] = (await readdir(dir)).filter((name) => name.endsWith('.ndjson'));
+  await appendFile(path.join(dir, segment!), '0badc0de\t{"event_id":"torn');
+
+  const restarted = new WriteAheadLog();
+  await restarted.open();
+  assert.equal(restarted.hasParked, true);
+  assert.deepEqual({ parked: restarted.getStats().parked, corrupt: restarted.getStats().corrupt }, { parked: 3, corrupt: 1 });
+
+  // Oldest first, the same events (and IDs) as before
+  const replayed = await restarted.takeParked(10);
+  assert.deepEqual(messages(replayed), messages([written[0]!, written[2]!, written[3]!]));
+  assert.deepEqual(replayed.map((event) => event.event_id), [written[0]!, written[2]!, written[3]!].map((event) => event.event_id));
+  assert.equal(restarted.hasParked, false);
+  assert.equal(restarted.holds(written[0]!.event_id), true);
+
+  // Once acknowledged, the old segment is removed and nothing is replayed again
+  restarted.ack(replayed);
+  await restarted.flush();
+  assert.equal((await readdir(dir)).includes(segment!), false);
+
+  const again = new WriteAheadLog();
+  await again.open();
+  assert.equal(again.getStats().unacked, 0);
+});
+
+test('spilled events are read back in order, in batches', async () => {
+  const wal = new WriteAheadLog();
+  await wal.open();
+  const spilled = events(10, 5);
+  for (const event of spilled) assert.equal(wal.spill(event), true);
+  assert.equal(wal.hasSpilled, true);
+
+  assert.deepEqual(messages(await wal.takeSpilled(3)), messages(spilled.slice(0, 3)));
+  assert.deepEqual(messages(await wal.takeSpilled(3)), messages(spilled.slice(3)));
+  assert.equal(wal.hasSpilled, false);
+  assert.equal(wal.getStats().unacked, 5); // Until the backend accepts them
+
+  wal.ack(spilled);
+  assert.equal(wal.getStats().unacked, 0);
+  await wal.flush();
+});